@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// slowRequest is how long a request may take before it is logged as slow,
+// with a breakdown of the upstream calls it waited on.
+var slowRequest = newReloadableDuration("SLOW_REQUEST", time.Second)
+
+// accessLogOff silences the per-request lines; slow requests are still
+// logged.
+var accessLogOff atomic.Bool
+
+// loadAccessLog reads ACCESS_LOG (default true).
+func loadAccessLog() error {
+	v := os.Getenv("ACCESS_LOG")
+	if v == "" {
+		accessLogOff.Store(false)
+		return nil
+	}
+	on, err := strconv.ParseBool(v)
+	if err != nil {
+		return fmt.Errorf("%q is not true or false", v)
+	}
+	accessLogOff.Store(!on)
+	return nil
+}
+
+// statusRecorder captures the status and size of a response. It passes
+// Hijack and Flush through, for WebSockets and streamed exports.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *statusRecorder) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusRecorder) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *statusRecorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response does not support hijacking")
+	}
+	if w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return h.Hijack()
+}
+
+func (w *statusRecorder) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// logRequests logs method, path, status, duration, and size of every
+// request, and runs it in a server span that continues the caller's
+// traceparent. The time spent in upstream calls made on the request's
+// behalf is logged with it, and named call by call when the request is
+// slow. Probes log at debug level; WebSockets log when they close and are
+// never slow.
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := startSpan(r.Context(), r.Method+" "+r.URL.Path, SpanServer,
+			"http.method", r.Method, "http.target", r.URL.Path, "http.request_id", requestID(r))
+		if traceID, parentID, ok := parseTraceparent(r.Header.Get("traceparent")); ok {
+			span.traceID, span.parentID = traceID, parentID
+		}
+		span.request = &requestSpans{}
+		rec := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+			span.SetAttrs("http.status_code", rec.status, "http.response_size", rec.bytes)
+			var err error
+			if rec.status >= 500 {
+				err = fmt.Errorf("HTTP %d", rec.status)
+			}
+			span.End(err)
+			logRequest(r, rec, span)
+		}()
+		next.ServeHTTP(rec, r.WithContext(ctx))
+	})
+}
+
+func logRequest(r *http.Request, rec *statusRecorder, span *Span) {
+	duration := span.Duration()
+	websocket := rec.status == http.StatusSwitchingProtocols
+	slow := !websocket && duration >= slowRequest.Get()
+	if accessLogOff.Load() && !slow {
+		return
+	}
+
+	args := []any{
+		"method", r.Method,
+		"path", r.URL.Path,
+		"status", rec.status,
+		"duration_ms", float64(duration.Microseconds()) / 1000,
+		"bytes", rec.bytes,
+		"client", clientIP(r),
+	}
+	span.request.mu.Lock()
+	children := span.request.spans
+	span.request.mu.Unlock()
+	var upstreamTime time.Duration
+	var calls []string
+	for _, c := range children {
+		if c.kind != SpanClient {
+			continue
+		}
+		if c.parentID == span.spanID { // nested calls, like a token fetch, are already counted
+			upstreamTime += c.Duration()
+		}
+		calls = append(calls, fmt.Sprintf("%s=%dms", c.name, c.Duration().Milliseconds()))
+	}
+	if len(calls) > 0 {
+		args = append(args, "upstream_ms", upstreamTime.Milliseconds())
+	}
+	if otlp != nil {
+		args = append(args, "trace_id", span.TraceID())
+	}
+
+	log := requestLog(serverLog, r)
+	switch {
+	case slow:
+		if len(calls) > 0 {
+			args = append(args, "upstream_calls", strings.Join(calls, " "))
+		}
+		log.Warn("Slow request", args...)
+	case r.URL.Path == "/healthz" || r.URL.Path == "/readyz":
+		log.Debug("Request", args...)
+	default:
+		log.Info("Request", args...)
+	}
+}
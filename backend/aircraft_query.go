@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// AircraftQuery is the sort/page/field selection for /api/aircraft.
+type AircraftQuery struct {
+	SortKey string // "" leaves the picture in feed order
+	Desc    bool
+	Offset  int
+	Limit   int      // 0 = no limit
+	Fields  []string // JSON field names; empty = all
+}
+
+// aircraftSortKeys lists the supported sort keys. Each returns the value to
+// compare and whether the aircraft has one; aircraft without a value sort
+// last in either direction.
+var aircraftSortKeys = map[string]func(ac Aircraft, threats map[string]string) (float64, bool){
+	"altitude":     func(ac Aircraft, _ map[string]string) (float64, bool) { return deref(ac.BaroAltitude) },
+	"velocity":     func(ac Aircraft, _ map[string]string) (float64, bool) { return deref(ac.Velocity) },
+	"verticalRate": func(ac Aircraft, _ map[string]string) (float64, bool) { return deref(ac.VerticalRate) },
+	"lastContact":  func(ac Aircraft, _ map[string]string) (float64, bool) { return float64(ac.LastContact), true },
+	"threat": func(ac Aircraft, threats map[string]string) (float64, bool) {
+		return threatSortScore(ac, threats), true
+	},
+}
+
+func deref(v *float64) (float64, bool) {
+	if v == nil {
+		return 0, false
+	}
+	return *v, true
+}
+
+// threatSortScore ranks by AI-assessed threat level, with watchlist hits and
+// military traffic ahead of other aircraft at the same level.
+func threatSortScore(ac Aircraft, threats map[string]string) float64 {
+	score := float64(threatRank[threats[ac.ICAO24]]) * 10
+	if _, ok := watchlist.Match(ac); ok {
+		score += 2
+	}
+	if mil, _ := classifyMilitary(ac); mil {
+		score++
+	}
+	return score
+}
+
+// parseAircraftQuery reads sort=[-]key, limit, offset, and fields=a,b,c.
+func parseAircraftQuery(q url.Values) (AircraftQuery, error) {
+	var aq AircraftQuery
+
+	if s := q.Get("sort"); s != "" {
+		aq.Desc = strings.HasPrefix(s, "-")
+		aq.SortKey = strings.TrimPrefix(s, "-")
+		if _, ok := aircraftSortKeys[aq.SortKey]; !ok && aq.SortKey != "callsign" && aq.SortKey != "icao24" {
+			return aq, fmt.Errorf("unknown sort key %q", aq.SortKey)
+		}
+	}
+	for name, dst := range map[string]*int{"limit": &aq.Limit, "offset": &aq.Offset} {
+		if v := q.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return aq, fmt.Errorf("invalid %s %q", name, v)
+			}
+			*dst = n
+		}
+	}
+	if f := q.Get("fields"); f != "" {
+		aq.Fields = splitList(f)
+	}
+	return aq, nil
+}
+
+// Apply sorts and pages a copy of the aircraft list, returning the page
+// and the total before paging.
+func (aq AircraftQuery) Apply(region string, aircraft []Aircraft) ([]Aircraft, int) {
+	result := append([]Aircraft{}, aircraft...)
+
+	switch aq.SortKey {
+	case "":
+	case "callsign", "icao24":
+		text := func(ac Aircraft) string { return strings.TrimSpace(ac.Callsign) }
+		if aq.SortKey == "icao24" {
+			text = func(ac Aircraft) string { return ac.ICAO24 }
+		}
+		sort.SliceStable(result, func(i, j int) bool {
+			if aq.Desc {
+				return text(result[i]) > text(result[j])
+			}
+			return text(result[i]) < text(result[j])
+		})
+	default:
+		key := aircraftSortKeys[aq.SortKey]
+		var threats map[string]string
+		if aq.SortKey == "threat" {
+			threats = analysisThreats(region)
+		}
+		sort.SliceStable(result, func(i, j int) bool {
+			vi, oki := key(result[i], threats)
+			vj, okj := key(result[j], threats)
+			if oki != okj {
+				return oki
+			}
+			if aq.Desc {
+				return vi > vj
+			}
+			return vi < vj
+		})
+	}
+
+	total := len(result)
+	if aq.Offset >= total {
+		return []Aircraft{}, total
+	}
+	result = result[aq.Offset:]
+	if aq.Limit > 0 && aq.Limit < len(result) {
+		result = result[:aq.Limit]
+	}
+	return result, total
+}
+
+// SelectFields projects aircraft onto the requested JSON fields. icao24 is
+// always kept so rows stay identifiable.
+func (aq AircraftQuery) SelectFields(aircraft []Aircraft) []map[string]interface{} {
+	keep := map[string]bool{"icao24": true}
+	for _, f := range aq.Fields {
+		keep[f] = true
+	}
+
+	out := make([]map[string]interface{}, 0, len(aircraft))
+	for _, ac := range aircraft {
+		var full map[string]interface{}
+		raw, _ := json.Marshal(ac)
+		json.Unmarshal(raw, &full)
+		for k := range full {
+			if !keep[k] {
+				delete(full, k)
+			}
+		}
+		out = append(out, full)
+	}
+	return out
+}
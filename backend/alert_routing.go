@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// AlertRoute sends alerts matching its regions and severities to the named
+// channels ("pagerduty", "opsgenie", "slack", "webhook", "sms", "email",
+// "push"). Empty Regions or Severities match everything.
+type AlertRoute struct {
+	Regions    []string `json:"regions,omitempty"`
+	Severities []string `json:"severities,omitempty"`
+	Channels   []string `json:"channels"`
+}
+
+// alertRoutes are evaluated in order and the first match wins. With no
+// routes configured every notifier receives every alert.
+var alertRoutes []AlertRoute
+
+// loadAlertRoutesFromEnv reads routes from ALERT_ROUTES (inline JSON) or
+// ALERT_ROUTES_FILE, e.g.
+//
+//	[{"severities": ["CRITICAL"], "channels": ["sms", "pagerduty"]},
+//	 {"regions": ["europe"], "severities": ["HIGH"], "channels": ["slack", "opsgenie"]},
+//	 {"severities": ["HIGH"], "channels": ["slack"]},
+//	 {"severities": ["MEDIUM"], "channels": ["webhook"]}]
+func loadAlertRoutesFromEnv() error {
+	data := []byte(os.Getenv("ALERT_ROUTES"))
+	if path := os.Getenv("ALERT_ROUTES_FILE"); len(data) == 0 && path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return fmt.Errorf("read alert routes: %w", err)
+		}
+	}
+	if len(data) == 0 {
+		return nil
+	}
+
+	var routes []AlertRoute
+	if err := json.Unmarshal(data, &routes); err != nil {
+		return fmt.Errorf("parse alert routes: %w", err)
+	}
+
+	known := make(map[string]bool)
+	for _, n := range alertNotifiers {
+		known[n.Name()] = true
+	}
+	for i, route := range routes {
+		for j, sev := range route.Severities {
+			routes[i].Severities[j] = strings.ToUpper(sev)
+		}
+		for _, ch := range route.Channels {
+			if !known[ch] {
+				alertLog.Warn("Alert route uses a channel that is not configured", "route", i, "channel", ch)
+			}
+		}
+	}
+
+	alertRoutes = routes
+	alertLog.Info("Loaded alert routes", "count", len(routes))
+	return nil
+}
+
+// Matches reports whether the route applies to an alert.
+func (r AlertRoute) Matches(alert *Alert) bool {
+	return matchesAny(r.Regions, alert.Region) && matchesAny(r.Severities, alert.Severity)
+}
+
+// routeAlert returns the notifiers that should hear about an alert opening
+// or changing severity. A workspace's own alerts follow only its routes, and
+// go nowhere if it has none.
+func routeAlert(alert *Alert) []AlertNotifier {
+	routes := alertRoutes
+	if alert.Workspace != "" {
+		routes = workspaces.AlertRoutes(alert.Workspace)
+		if len(routes) == 0 {
+			return nil
+		}
+	} else if len(routes) == 0 {
+		return alertNotifiers
+	}
+	for _, route := range routes {
+		if !route.Matches(alert) {
+			continue
+		}
+		var targets []AlertNotifier
+		for _, n := range alertNotifiers {
+			if matchesAny(route.Channels, n.Name()) {
+				targets = append(targets, n)
+			}
+		}
+		return targets
+	}
+	return nil
+}
+
+// matchesAny reports whether v is in list, treating an empty list as a wildcard.
+func matchesAny(list []string, v string) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxAlertHistory caps how many alerts are kept in memory and on disk.
+const maxAlertHistory = 10000
+
+// AlertStore persists every alert revision to an append-only JSON Lines file
+// and keeps the latest revision of each alert in memory for queries. The file
+// is compacted to one line per alert when it is opened, and again whenever
+// superseded revisions come to outnumber the alerts.
+type AlertStore struct {
+	mu      sync.RWMutex
+	path    string
+	file    *os.File
+	lines   int // lines in the file
+	byID    map[string]*Alert
+	ordered []*Alert // by FirstSeen, oldest first
+}
+
+// alertCompactSlack is how many superseded lines the file may hold beyond
+// one per alert before it is compacted.
+const alertCompactSlack = 1000
+
+// AlertFilter narrows an alert history query. Zero values match everything.
+type AlertFilter struct {
+	Region     string
+	Severities map[string]bool
+	Status     string
+	Since      time.Time
+	Until      time.Time
+	Limit      int
+	Workspace  string // with a workspace, only the common alerts and its own
+}
+
+// OpenAlertStore loads dir/alerts.jsonl, compacts it, and opens it for appending.
+func OpenAlertStore(dir string) (*AlertStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create data dir: %w", err)
+	}
+	s := &AlertStore{
+		path: filepath.Join(dir, "alerts.jsonl"),
+		byID: make(map[string]*Alert),
+	}
+
+	if f, err := os.Open(s.path); err == nil {
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			var a Alert
+			if json.Unmarshal(scanner.Bytes(), &a) != nil || a.ID == "" {
+				continue
+			}
+			if existing, ok := s.byID[a.ID]; ok {
+				*existing = a
+				continue
+			}
+			stored := a
+			s.ordered = append(s.ordered, &stored)
+			s.byID[a.ID] = &stored
+		}
+		f.Close()
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("read alert store: %w", err)
+	}
+
+	sort.SliceStable(s.ordered, func(i, j int) bool {
+		return s.ordered[i].FirstSeen.Before(s.ordered[j].FirstSeen)
+	})
+	s.trimLocked()
+
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// compact rewrites the store with only the latest revision of each alert.
+// Call with s.mu held once the store is shared.
+func (s *AlertStore) compact() error {
+	tmp := s.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("compact alert store: %w", err)
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, a := range s.ordered {
+		enc.Encode(a)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("compact alert store: %w", err)
+	}
+	f.Close()
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("compact alert store: %w", err)
+	}
+
+	if s.file != nil {
+		s.file.Close()
+	}
+	s.file, err = os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("open alert store: %w", err)
+	}
+	s.lines = len(s.ordered)
+	return nil
+}
+
+// Close closes the store's file. Safe to call on a nil store.
+func (s *AlertStore) Close() error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// Save records a new revision of an alert.
+func (s *AlertStore) Save(a Alert) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.byID[a.ID]; ok {
+		*existing = a
+	} else {
+		stored := a
+		s.ordered = append(s.ordered, &stored)
+		s.byID[a.ID] = &stored
+		s.trimLocked()
+	}
+
+	if s.lines >= 2*len(s.ordered)+alertCompactSlack {
+		// The revision being saved is already in memory, so the rewrite
+		// includes it.
+		return s.compact()
+	}
+	line, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	if _, err = s.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	s.lines++
+	return nil
+}
+
+// Get returns the latest revision of an alert by ID.
+func (s *AlertStore) Get(id string) (Alert, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if a, ok := s.byID[id]; ok {
+		return *a, true
+	}
+	return Alert{}, false
+}
+
+// Active returns stored alerts that were still active, used to restore
+// lifecycle state after a restart.
+func (s *AlertStore) Active() []Alert {
+	return s.Query(AlertFilter{Status: AlertStatusActive})
+}
+
+// Query returns matching alerts, newest first.
+func (s *AlertStore) Query(f AlertFilter) []Alert {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]Alert, 0)
+	for i := len(s.ordered) - 1; i >= 0; i-- {
+		a := s.ordered[i]
+		if f.Region != "" && a.Region != f.Region {
+			continue
+		}
+		if len(f.Severities) > 0 && !f.Severities[a.Severity] {
+			continue
+		}
+		if f.Workspace != "" && a.Workspace != "" && a.Workspace != f.Workspace {
+			continue
+		}
+		if f.Status != "" && a.Status != f.Status {
+			continue
+		}
+		if !f.Since.IsZero() && a.LastSeen.Before(f.Since) {
+			continue
+		}
+		if !f.Until.IsZero() && a.FirstSeen.After(f.Until) {
+			continue
+		}
+		result = append(result, *a)
+		if f.Limit > 0 && len(result) >= f.Limit {
+			break
+		}
+	}
+	return result
+}
+
+func (s *AlertStore) trimLocked() {
+	if len(s.ordered) <= maxAlertHistory {
+		return
+	}
+	drop := len(s.ordered) - maxAlertHistory
+	for _, a := range s.ordered[:drop] {
+		delete(s.byID, a.ID)
+	}
+	s.ordered = append([]*Alert(nil), s.ordered[drop:]...)
+}
+
+// parseTimeParam accepts either Unix seconds or RFC 3339.
+func parseTimeParam(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(secs, 0).UTC(), nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+// parseAlertFilter builds a filter from ?region=&severity=&status=&since=&until=&limit=
+func parseAlertFilter(q url.Values) (AlertFilter, error) {
+	get := q.Get
+	f := AlertFilter{
+		Region: get("region"),
+		Status: strings.ToUpper(get("status")),
+		Limit:  100,
+	}
+	if sev := get("severity"); sev != "" {
+		f.Severities = make(map[string]bool)
+		for _, s := range strings.Split(sev, ",") {
+			f.Severities[strings.ToUpper(strings.TrimSpace(s))] = true
+		}
+	}
+	var err error
+	if f.Since, err = parseTimeParam(get("since")); err != nil {
+		return f, fmt.Errorf("invalid since: %w", err)
+	}
+	if f.Until, err = parseTimeParam(get("until")); err != nil {
+		return f, fmt.Errorf("invalid until: %w", err)
+	}
+	if l := get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 {
+			return f, fmt.Errorf("invalid limit")
+		}
+		f.Limit = n
+	}
+	return f, nil
+}
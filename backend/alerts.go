@@ -0,0 +1,547 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Alert transitions delivered to notifiers
+const (
+	AlertOpened   = "opened"
+	AlertUpdated  = "updated"
+	AlertResolved = "resolved"
+	AlertAcked    = "acknowledged"
+)
+
+// Alert statuses
+const (
+	AlertStatusActive   = "ACTIVE"
+	AlertStatusResolved = "RESOLVED"
+)
+
+// threatRank orders the SENTINEL threat levels so severities can be compared.
+var threatRank = map[string]int{
+	"NOMINAL":  0,
+	"LOW":      1,
+	"MEDIUM":   2,
+	"HIGH":     3,
+	"CRITICAL": 4,
+}
+
+// Alert is a single alerting condition. Key identifies what the alert is
+// about (kind, region, subject) so that the same condition re-firing maps
+// onto the same downstream incident instead of paging again.
+type Alert struct {
+	ID         string                 `json:"id"`
+	Key        string                 `json:"key"`
+	Kind       string                 `json:"kind"`
+	Region     string                 `json:"region"`
+	Severity   string                 `json:"severity"`
+	Title      string                 `json:"title"`
+	Message    string                 `json:"message"`
+	ICAO24     string                 `json:"icao24,omitempty"`
+	Callsign   string                 `json:"callsign,omitempty"`
+	Details    map[string]interface{} `json:"details,omitempty"`
+	Status     string                 `json:"status"`
+	FirstSeen  time.Time              `json:"firstSeen"`
+	LastSeen   time.Time              `json:"lastSeen"`
+	ResolvedAt *time.Time             `json:"resolvedAt,omitempty"`
+	Count      int                    `json:"count"`
+	AckedBy    string                 `json:"ackedBy,omitempty"`
+	AckedAt    *time.Time             `json:"ackedAt,omitempty"`
+	AckNote    string                 `json:"ackNote,omitempty"`
+	Simulated  bool                   `json:"simulated,omitempty"` // about a scenario aircraft
+	AudioURL   string                 `json:"audioUrl,omitempty"`  // spoken callout, with TTS_ENGINE
+	Workspace  string                 `json:"workspace,omitempty"` // raised for one workspace only; "" for the common picture
+}
+
+// AlertNotifier delivers alert transitions to an external system.
+type AlertNotifier interface {
+	Name() string
+	Notify(event string, alert *Alert) error
+}
+
+// alertRestorer is implemented by notifiers that remember what they opened
+// downstream. Restore tells them about the alerts SetStore restored, so
+// those are still resolved downstream when they clear.
+type alertRestorer interface {
+	Restore(active []Alert)
+}
+
+// AlertManager owns the alert lifecycle. Ongoing conditions update a single
+// alert in place, alerts that stop being raised auto-resolve, and an alert
+// that re-fires within the cooldown after resolving is suppressed unless its
+// severity has escalated.
+type AlertManager struct {
+	mu          sync.Mutex
+	active      map[string]*Alert // key -> alert
+	resolved    map[string]*Alert // key -> most recent resolution, for cooldown
+	cooldown    time.Duration
+	autoResolve time.Duration
+	suppressed  int
+	store       *AlertStore // optional persistence
+}
+
+var (
+	alertStore     *AlertStore
+	alertNotifiers []AlertNotifier
+	alertMgr       = NewAlertManager(10*time.Minute, 5*time.Minute)
+)
+
+// NewAlertManager creates an alert manager with the given cooldown and
+// auto-resolve windows.
+func NewAlertManager(cooldown, autoResolve time.Duration) *AlertManager {
+	return &AlertManager{
+		active:      make(map[string]*Alert),
+		resolved:    make(map[string]*Alert),
+		cooldown:    cooldown,
+		autoResolve: autoResolve,
+	}
+}
+
+// newAlertManagerFromEnv reads ALERT_COOLDOWN and ALERT_AUTO_RESOLVE
+// (Go durations, e.g. "10m") over the defaults.
+func newAlertManagerFromEnv() *AlertManager {
+	cooldown := 10 * time.Minute
+	autoResolve := 5 * time.Minute
+	if d, err := time.ParseDuration(os.Getenv("ALERT_COOLDOWN")); err == nil {
+		cooldown = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("ALERT_AUTO_RESOLVE")); err == nil && d > 0 {
+		autoResolve = d
+	}
+	return NewAlertManager(cooldown, autoResolve)
+}
+
+// SetStore attaches persistent storage and restores alerts that were still
+// active when the process last stopped. Restored alerts auto-resolve as usual
+// if their condition is not raised again.
+func (m *AlertManager) SetStore(store *AlertStore) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.store = store
+	for _, a := range store.Active() {
+		alert := a
+		m.active[alert.Key] = &alert
+	}
+}
+
+// Raise reports that the condition described by a is currently true.
+// Kind, Region, Key, and Severity are required; the remaining fields
+// refresh the alert's description on every raise.
+func (m *AlertManager) Raise(a Alert) {
+	now := time.Now().UTC()
+	if scenario.Simulates(a.ICAO24) {
+		a.Simulated = true
+		a.Title = "[SIMULATED] " + a.Title
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if alert, ok := m.active[a.Key]; ok {
+		escalated := alert.Severity != a.Severity
+		alert.Severity = a.Severity
+		alert.Title = a.Title
+		alert.Message = a.Message
+		alert.Details = a.Details
+		alert.LastSeen = now
+		alert.Count++
+		if escalated {
+			alertSpeech.Attach(alert)
+			m.transition(AlertUpdated, alert)
+		}
+		return
+	}
+
+	if prev, ok := m.resolved[a.Key]; ok && prev.ResolvedAt != nil &&
+		now.Sub(*prev.ResolvedAt) < m.cooldown &&
+		threatRank[a.Severity] <= threatRank[prev.Severity] {
+		m.suppressed++
+		return
+	}
+
+	alert := a
+	alert.ID = newAlertID()
+	alert.Status = AlertStatusActive
+	alert.FirstSeen = now
+	alert.LastSeen = now
+	alert.ResolvedAt = nil
+	alert.Count = 1
+	m.active[a.Key] = &alert
+	delete(m.resolved, a.Key)
+	alertSpeech.Attach(&alert)
+	m.transition(AlertOpened, &alert)
+}
+
+// Resolve clears the alert with the given key, if active.
+func (m *AlertManager) Resolve(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if alert, ok := m.active[key]; ok {
+		m.resolveLocked(alert)
+	}
+}
+
+// ResolveMissing clears every active alert of the given kind and region whose
+// key is not in seen. Sources that evaluate a full picture each cycle use it
+// to resolve conditions that no longer hold.
+func (m *AlertManager) ResolveMissing(kind, region string, seen map[string]bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, alert := range m.active {
+		if alert.Kind == kind && alert.Region == region && !seen[key] {
+			m.resolveLocked(alert)
+		}
+	}
+}
+
+// Acknowledge records who acknowledged an alert and why. It works on both
+// active and historical alerts so the audit trail is complete.
+func (m *AlertManager) Acknowledge(id, by, note string) (Alert, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var alert *Alert
+	for _, a := range m.active {
+		if a.ID == id {
+			alert = a
+			break
+		}
+	}
+	if alert == nil && m.store != nil {
+		if stored, ok := m.store.Get(id); ok {
+			alert = &stored
+		}
+	}
+	if alert == nil {
+		return Alert{}, fmt.Errorf("alert %s not found", id)
+	}
+
+	now := time.Now().UTC()
+	alert.AckedBy = by
+	alert.AckedAt = &now
+	alert.AckNote = note
+	m.transition(AlertAcked, alert)
+	return *alert, nil
+}
+
+// Get returns an active or stored alert by ID.
+func (m *AlertManager) Get(id string) (Alert, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, a := range m.active {
+		if a.ID == id {
+			return *a, true
+		}
+	}
+	if m.store != nil {
+		return m.store.Get(id)
+	}
+	return Alert{}, false
+}
+
+// Active returns a snapshot of the currently active alerts.
+func (m *AlertManager) Active() []Alert {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result := make([]Alert, 0, len(m.active))
+	for _, a := range m.active {
+		result = append(result, *a)
+	}
+	return result
+}
+
+// Suppressed returns how many re-fires the cooldown has swallowed.
+func (m *AlertManager) Suppressed() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.suppressed
+}
+
+// Run auto-resolves alerts that have not been raised within the
+// auto-resolve window. It blocks, so call it in a goroutine.
+func (m *AlertManager) Run() {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		now := time.Now().UTC()
+		m.mu.Lock()
+		for _, alert := range m.active {
+			if now.Sub(alert.LastSeen) > m.autoResolve {
+				m.resolveLocked(alert)
+			}
+		}
+		for key, alert := range m.resolved {
+			if alert.ResolvedAt != nil && now.Sub(*alert.ResolvedAt) > m.cooldown {
+				delete(m.resolved, key)
+			}
+		}
+		m.mu.Unlock()
+	}
+}
+
+func (m *AlertManager) resolveLocked(alert *Alert) {
+	now := time.Now().UTC()
+	alert.Status = AlertStatusResolved
+	alert.ResolvedAt = &now
+	delete(m.active, alert.Key)
+	m.resolved[alert.Key] = alert
+	m.transition(AlertResolved, alert)
+}
+
+// transition logs, notifies, and broadcasts an alert lifecycle change.
+func (m *AlertManager) transition(event string, alert *Alert) {
+	alertLog.Info("Alert "+event, "region", alert.Region, "alert", alert.Key, "title", alert.Title, "severity", alert.Severity)
+	snapshot := *alert
+	if m.store != nil {
+		if err := m.store.Save(snapshot); err != nil {
+			alertLog.Error("Persist alert failed", "region", alert.Region, "alert", alert.ID, "err", err)
+		}
+	}
+	dispatchAlert(event, &snapshot)
+	go broadcastAlertToClients(event, &snapshot)
+	if event == AlertOpened || event == AlertUpdated {
+		go alertSpeech.Announce(snapshot)
+	}
+}
+
+// newAlertID returns a random identifier for a single alert occurrence.
+func newAlertID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+type alertEvent struct {
+	event string
+	alert *Alert
+}
+
+// alertQueue serializes notifier delivery so an incident is never resolved
+// downstream before the request that opened it.
+var alertQueue = make(chan alertEvent, 256)
+
+// dispatchAlert queues a transition for the notifiers without blocking the
+// caller. With leader election, only the leader for the alert's region
+// notifies; the other replicas track the same alerts silently.
+func dispatchAlert(event string, alert *Alert) {
+	if !isLeader(alert.Region) {
+		return
+	}
+	select {
+	case alertQueue <- alertEvent{event, alert}:
+	default:
+		alertLog.Warn("Alert queue full, dropping notification", "region", alert.Region, "event", event, "alert", alert.Key)
+	}
+}
+
+// runAlertDispatch delivers queued transitions in order, fanning each one
+// out in parallel to the notifiers its route selects. Resolutions and
+// acknowledgments follow the alert to every notifier that was told about
+// it, even if the alert has since been downgraded out of that route.
+func runAlertDispatch() {
+	delivered := make(map[string]map[string]AlertNotifier) // alert key -> notifier name -> notifier
+
+	for e := range alertQueue {
+		var targets []AlertNotifier
+		switch e.event {
+		case AlertOpened, AlertUpdated:
+			targets = routeAlert(e.alert)
+			if delivered[e.alert.Key] == nil {
+				delivered[e.alert.Key] = make(map[string]AlertNotifier)
+			}
+			for _, n := range targets {
+				delivered[e.alert.Key][n.Name()] = n
+			}
+		default:
+			if seen, ok := delivered[e.alert.Key]; ok {
+				for _, n := range seen {
+					targets = append(targets, n)
+				}
+			} else {
+				targets = routeAlert(e.alert) // e.g. restored after a restart
+			}
+			if e.event == AlertResolved {
+				delete(delivered, e.alert.Key)
+			}
+		}
+
+		var wg sync.WaitGroup
+		for _, n := range targets {
+			wg.Add(1)
+			go func(n AlertNotifier) {
+				defer wg.Done()
+				defer recoverPanic("notifier:" + n.Name())
+				if err := n.Notify(e.event, e.alert); err != nil {
+					alertLog.Warn("Notify failed", "region", e.alert.Region, "notifier", n.Name(), "alert", e.alert.Key, "err", err)
+				}
+			}(n)
+		}
+		wg.Wait()
+	}
+}
+
+// broadcastAlertToClients pushes an alert transition to clients watching its
+// region, and for a workspace's own alert, only to that workspace's clients.
+func broadcastAlertToClients(event string, alert *Alert) {
+	message := map[string]interface{}{
+		"type":   "alert",
+		"event":  event,
+		"region": alert.Region,
+		"alert":  alert,
+	}
+	recorder.Broadcast(alert.Region, message)
+
+	clientsMutex.RLock()
+	defer clientsMutex.RUnlock()
+
+	for conn, clientRegion := range clients {
+		if clientRegion == alert.Region && (alert.Workspace == "" || clientWorkspaces[conn] == alert.Workspace) {
+			if err := conn.send(message); err != nil {
+				wsLog.Warn("Write alert to client failed", "err", err)
+			}
+		}
+	}
+}
+
+// syncAnalysisAlerts raises an alert for every aircraft the analysis flagged
+// at MEDIUM or above, and resolves alerts for aircraft it no longer flags.
+func syncAnalysisAlerts(region string, analysis *TacticalAnalysis) {
+	seen := make(map[string]bool)
+
+	for _, aoi := range analysis.AircraftOfInterest {
+		level := strings.ToUpper(stringField(aoi, "threat_level"))
+		if threatRank[level] < threatRank["MEDIUM"] {
+			continue
+		}
+		icao24 := stringField(aoi, "icao24")
+		callsign := strings.TrimSpace(stringField(aoi, "callsign"))
+		subject := icao24
+		if subject == "" {
+			subject = callsign
+		}
+		if subject == "" {
+			continue
+		}
+
+		key := fmt.Sprintf("analysis:%s:%s", region, subject)
+		seen[key] = true
+
+		alertMgr.Raise(Alert{
+			Key:      key,
+			Kind:     "analysis",
+			Region:   region,
+			Severity: level,
+			Title:    fmt.Sprintf("%s threat: %s in %s", level, subject, region),
+			Message:  stringField(aoi, "reason"),
+			ICAO24:   icao24,
+			Callsign: callsign,
+			Details: map[string]interface{}{
+				"recommended_action": stringField(aoi, "recommended_action"),
+				"threat_score":       analysis.ThreatScore,
+				"summary":            analysis.Summary,
+			},
+		})
+	}
+
+	alertMgr.ResolveMissing("analysis", region, seen)
+}
+
+// handleGetAlerts lists alert history, newest first.
+// GET /api/alerts?region=&severity=HIGH,CRITICAL&status=ACTIVE&since=&until=&limit=
+func handleGetAlerts(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseAlertFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if p := principalFrom(r); p != nil {
+		filter.Workspace = p.Workspace
+	}
+	asCSV, ok := wantsCSV(w, r)
+	if !ok {
+		return
+	}
+
+	var result []Alert
+	if alertStore != nil {
+		result = alertStore.Query(filter)
+	} else {
+		// No persistence configured: fall back to what is active right now
+		result = make([]Alert, 0)
+		for _, a := range alertMgr.Active() {
+			if (filter.Region == "" || a.Region == filter.Region) &&
+				(len(filter.Severities) == 0 || filter.Severities[a.Severity]) &&
+				(filter.Workspace == "" || a.Workspace == "" || a.Workspace == filter.Workspace) {
+				result = append(result, a)
+			}
+		}
+	}
+
+	if asCSV {
+		writeAlertsCSV(w, result)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// handleAlertAction routes /api/alerts/{id}/ack.
+func handleAlertAction(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/alerts/"), "/"), "/")
+	if len(parts) != 2 || parts[1] != "ack" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body struct {
+		By   string `json:"by"`
+		Note string `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if p := principalFrom(r); p != nil && p.Kind == "user" {
+		body.By = p.Name // logged-in operators can't ack on someone else's behalf
+	}
+	if strings.TrimSpace(body.By) == "" {
+		http.Error(w, "by is required", http.StatusBadRequest)
+		return
+	}
+	if a, ok := alertMgr.Get(parts[0]); ok && !alertVisible(principalFrom(r), a) {
+		http.Error(w, fmt.Sprintf("alert %s not found", parts[0]), http.StatusNotFound)
+		return
+	}
+
+	alert, err := alertMgr.Acknowledge(parts[0], body.By, body.Note)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	auditLog.Record(r, "alert.ack", map[string]interface{}{"id": parts[0], "by": body.By, "note": body.Note})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(alert)
+}
+
+// stringField reads a string value from a loosely-typed analysis map.
+func stringField(m map[string]interface{}, key string) string {
+	if v, ok := m[key].(string); ok {
+		return v
+	}
+	return ""
+}
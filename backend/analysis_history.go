@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// maxAnalysisHistory caps how many analyses are kept. At the default 30 s
+// cadence for two regions this is roughly a week.
+const maxAnalysisHistory = 40000
+
+// analysisCompactSlack is how many analyses past maxAnalysisHistory the file
+// may hold before the oldest are dropped from it.
+const analysisCompactSlack = maxAnalysisHistory / 10
+
+// analysisRecord stamps an analysis with when we received it; the model's
+// own timestamp field is free text and can't be relied on for lookups.
+type analysisRecord struct {
+	At       time.Time         `json:"at"`
+	Analysis *TacticalAnalysis `json:"analysis"`
+}
+
+// AnalysisHistory keeps completed analyses in an append-only JSON Lines file
+// so past assessments can be retrieved after they leave the cache. The file
+// is rewritten with the latest maxAnalysisHistory analyses when it is
+// opened, and again once it has grown analysisCompactSlack past them.
+type AnalysisHistory struct {
+	mu      sync.RWMutex
+	path    string
+	file    *os.File
+	lines   int              // lines in the file
+	records []analysisRecord // oldest first
+}
+
+var analysisHistory *AnalysisHistory
+
+// OpenAnalysisHistory loads dir/analyses.jsonl, compacts it, and opens it
+// for appending.
+func OpenAnalysisHistory(dir string) (*AnalysisHistory, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create data dir: %w", err)
+	}
+	h := &AnalysisHistory{path: filepath.Join(dir, "analyses.jsonl")}
+
+	if f, err := os.Open(h.path); err == nil {
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			var rec analysisRecord
+			if json.Unmarshal(scanner.Bytes(), &rec) != nil || rec.Analysis == nil {
+				continue
+			}
+			h.records = append(h.records, rec)
+		}
+		f.Close()
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("read analysis history: %w", err)
+	}
+	h.trimLocked()
+
+	if err := h.compact(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// compact rewrites the file with only the analyses still kept. Call with
+// h.mu held once the history is shared.
+func (h *AnalysisHistory) compact() error {
+	tmp := h.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("compact analysis history: %w", err)
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, rec := range h.records {
+		enc.Encode(rec)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("compact analysis history: %w", err)
+	}
+	f.Close()
+	if err := os.Rename(tmp, h.path); err != nil {
+		return fmt.Errorf("compact analysis history: %w", err)
+	}
+
+	if h.file != nil {
+		h.file.Close()
+	}
+	h.file, err = os.OpenFile(h.path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("open analysis history: %w", err)
+	}
+	h.lines = len(h.records)
+	return nil
+}
+
+// Close closes the history file. Safe to call on a nil history.
+func (h *AnalysisHistory) Close() error {
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.file.Close()
+}
+
+// Save records a completed analysis. Safe to call on a nil history.
+func (h *AnalysisHistory) Save(analysis *TacticalAnalysis) error {
+	if h == nil || analysis == nil {
+		return nil
+	}
+	rec := analysisRecord{At: time.Now().UTC(), Analysis: analysis}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records = append(h.records, rec)
+	h.trimLocked()
+	if h.lines >= maxAnalysisHistory+analysisCompactSlack {
+		return h.compact()
+	}
+	if _, err = h.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	h.lines++
+	return nil
+}
+
+// At returns the most recent analysis for region received at or before t.
+func (h *AnalysisHistory) At(region string, t time.Time) (analysisRecord, bool) {
+	if h == nil {
+		return analysisRecord{}, false
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for i := len(h.records) - 1; i >= 0; i-- {
+		rec := h.records[i]
+		if rec.Analysis.Region == region && !rec.At.After(t) {
+			return rec, true
+		}
+	}
+	return analysisRecord{}, false
+}
+
+// Between returns the analyses for region received in [from, to), oldest
+// first.
+func (h *AnalysisHistory) Between(region string, from, to time.Time) []analysisRecord {
+	if h == nil {
+		return nil
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	var result []analysisRecord
+	for _, rec := range h.records {
+		if rec.Analysis.Region == region && !rec.At.Before(from) && rec.At.Before(to) {
+			result = append(result, rec)
+		}
+	}
+	return result
+}
+
+func (h *AnalysisHistory) trimLocked() {
+	if len(h.records) > maxAnalysisHistory {
+		h.records = append([]analysisRecord(nil), h.records[len(h.records)-maxAnalysisHistory:]...)
+	}
+}
@@ -0,0 +1,497 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"swarm-c2/cot"
+)
+
+// Operator classifications, which override the heuristics wherever a track
+// is classified.
+var annotationClasses = map[string]bool{
+	"friendly": true, // own or allied
+	"civil":    true, // not military, whatever the heuristics say
+	"military": true,
+	"hostile":  true,
+	"unknown":  true,
+}
+
+const (
+	maxAnnotationNotes = 50
+	maxAnnotationNote  = 1000 // characters
+	maxAnnotationTags  = 20
+)
+
+// TrackAnnotation is what operators have said about a track: free-text
+// notes, tags, and optionally a classification of their own.
+type TrackAnnotation struct {
+	ICAO24         string           `json:"icao24"`
+	Callsign       string           `json:"callsign,omitempty"` // as last seen when annotated, for reading the file
+	Classification string           `json:"classification,omitempty"`
+	ClassifiedBy   string           `json:"classifiedBy,omitempty"`
+	Tags           []string         `json:"tags"`
+	Notes          []AnnotationNote `json:"notes"`
+	UpdatedAt      time.Time        `json:"updatedAt"`
+}
+
+// AnnotationNote is one operator remark on a track.
+type AnnotationNote struct {
+	ID   string    `json:"id"`
+	Text string    `json:"text"`
+	By   string    `json:"by,omitempty"`
+	At   time.Time `json:"at"`
+}
+
+// AnnotationUpdate is the body of POST /api/tracks/{icao24}/annotations.
+// Every field is optional; an empty classification clears it.
+type AnnotationUpdate struct {
+	Note           string   `json:"note"`
+	AddTags        []string `json:"addTags"`
+	RemoveTags     []string `json:"removeTags"`
+	Classification *string  `json:"classification"`
+}
+
+// Annotations holds track annotations by ICAO24, persisted as a JSON file
+// in the data directory.
+type Annotations struct {
+	mu     sync.RWMutex
+	path   string
+	tracks map[string]*TrackAnnotation
+}
+
+var annotations = &Annotations{tracks: make(map[string]*TrackAnnotation)}
+
+// OpenAnnotations loads dir/annotations.json if it exists.
+func OpenAnnotations(dir string) (*Annotations, error) {
+	a := &Annotations{path: filepath.Join(dir, "annotations.json"), tracks: make(map[string]*TrackAnnotation)}
+	data, err := os.ReadFile(a.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return a, nil
+		}
+		return nil, fmt.Errorf("read annotations: %w", err)
+	}
+	var list []*TrackAnnotation
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("parse annotations: %w", err)
+	}
+	for _, t := range list {
+		a.tracks[t.ICAO24] = t
+	}
+	return a, nil
+}
+
+var errNoAnnotation = errors.New("no annotations for this track")
+
+// Get returns a track's annotation.
+func (a *Annotations) Get(icao24 string) (TrackAnnotation, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	t, ok := a.tracks[strings.ToLower(icao24)]
+	if !ok {
+		return TrackAnnotation{}, false
+	}
+	return t.copy(), true
+}
+
+// All returns every annotation, most recently updated first.
+func (a *Annotations) All() []TrackAnnotation {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	out := make([]TrackAnnotation, 0, len(a.tracks))
+	for _, t := range a.tracks {
+		out = append(out, t.copy())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].UpdatedAt.After(out[j].UpdatedAt) })
+	return out
+}
+
+// Classification returns the operator's classification of a track, or "".
+func (a *Annotations) Classification(icao24 string) string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if t, ok := a.tracks[icao24]; ok {
+		return t.Classification
+	}
+	return ""
+}
+
+// Update applies a change to a track's annotation, creating it if needed,
+// and persists the set.
+func (a *Annotations) Update(icao24, callsign string, u AnnotationUpdate, by string) (TrackAnnotation, error) {
+	u.Note = strings.TrimSpace(u.Note)
+	if len(u.Note) > maxAnnotationNote {
+		return TrackAnnotation{}, fmt.Errorf("note is longer than %d characters", maxAnnotationNote)
+	}
+	if u.Classification != nil {
+		*u.Classification = strings.ToLower(strings.TrimSpace(*u.Classification))
+		if *u.Classification != "" && !annotationClasses[*u.Classification] {
+			return TrackAnnotation{}, fmt.Errorf("unknown classification %q (want friendly, civil, military, hostile, or unknown)", *u.Classification)
+		}
+	}
+	if u.Note == "" && len(u.AddTags) == 0 && len(u.RemoveTags) == 0 && u.Classification == nil {
+		return TrackAnnotation{}, errors.New("nothing to change: give note, addTags, removeTags, or classification")
+	}
+
+	now := time.Now().UTC()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	t, ok := a.tracks[icao24]
+	if !ok {
+		t = &TrackAnnotation{ICAO24: icao24, Tags: []string{}, Notes: []AnnotationNote{}}
+	}
+	next := t.copy()
+	if callsign != "" {
+		next.Callsign = callsign
+	}
+	if u.Note != "" {
+		if len(next.Notes) >= maxAnnotationNotes {
+			return TrackAnnotation{}, fmt.Errorf("track already has %d notes; delete some first", maxAnnotationNotes)
+		}
+		next.Notes = append(next.Notes, AnnotationNote{ID: newAlertID(), Text: u.Note, By: by, At: now})
+	}
+	for _, tag := range u.RemoveTags {
+		tag = normalizeTag(tag)
+		for i, have := range next.Tags {
+			if have == tag {
+				next.Tags = append(next.Tags[:i], next.Tags[i+1:]...)
+				break
+			}
+		}
+	}
+	for _, tag := range u.AddTags {
+		if tag = normalizeTag(tag); tag == "" || slices.Contains(next.Tags, tag) {
+			continue
+		}
+		next.Tags = append(next.Tags, tag)
+	}
+	if len(next.Tags) > maxAnnotationTags {
+		return TrackAnnotation{}, fmt.Errorf("a track can have at most %d tags", maxAnnotationTags)
+	}
+	sort.Strings(next.Tags)
+	if u.Classification != nil {
+		next.Classification, next.ClassifiedBy = *u.Classification, by
+		if next.Classification == "" {
+			next.ClassifiedBy = ""
+		}
+	}
+	next.UpdatedAt = now
+	a.tracks[icao24] = &next
+	if err := a.saveLocked(); err != nil {
+		a.tracks[icao24] = t
+		if !ok {
+			delete(a.tracks, icao24)
+		}
+		return TrackAnnotation{}, err
+	}
+	return next.copy(), nil
+}
+
+// DeleteNote removes one note from a track.
+func (a *Annotations) DeleteNote(icao24, noteID string) (TrackAnnotation, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	t, ok := a.tracks[icao24]
+	if !ok {
+		return TrackAnnotation{}, errNoAnnotation
+	}
+	next := t.copy()
+	for i, n := range next.Notes {
+		if n.ID == noteID {
+			next.Notes = append(next.Notes[:i], next.Notes[i+1:]...)
+			next.UpdatedAt = time.Now().UTC()
+			a.tracks[icao24] = &next
+			if err := a.saveLocked(); err != nil {
+				a.tracks[icao24] = t
+				return TrackAnnotation{}, err
+			}
+			return next.copy(), nil
+		}
+	}
+	return TrackAnnotation{}, errors.New("note not found")
+}
+
+// Clear removes everything operators have said about a track.
+func (a *Annotations) Clear(icao24 string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	t, ok := a.tracks[icao24]
+	if !ok {
+		return errNoAnnotation
+	}
+	delete(a.tracks, icao24)
+	if err := a.saveLocked(); err != nil {
+		a.tracks[icao24] = t
+		return err
+	}
+	return nil
+}
+
+func (a *Annotations) saveLocked() error {
+	if a.path == "" {
+		return nil
+	}
+	list := make([]*TrackAnnotation, 0, len(a.tracks))
+	for _, t := range a.tracks {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ICAO24 < list[j].ICAO24 })
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(a.path, data, 0o644)
+}
+
+func (t *TrackAnnotation) copy() TrackAnnotation {
+	c := *t
+	c.Tags = append([]string{}, t.Tags...)
+	c.Notes = append([]AnnotationNote{}, t.Notes...)
+	return c
+}
+
+// normalizeTag lower-cases a tag and joins its words with hyphens, so
+// "Cargo Charter" and "cargo-charter" are the same tag.
+func normalizeTag(tag string) string {
+	tag = strings.Join(strings.Fields(strings.ToLower(tag)), "-")
+	if len(tag) > 32 {
+		tag = tag[:32]
+	}
+	return tag
+}
+
+// classificationOverride applies an operator classification to the
+// military heuristics: ok is false when there is none that decides it.
+func classificationOverride(icao24 string) (military bool, reason string, ok bool) {
+	switch class := annotations.Classification(icao24); class {
+	case "military", "hostile":
+		return true, "operator classified as " + class, true
+	case "civil":
+		return false, "", true
+	}
+	return false, "", false
+}
+
+// annotationAffiliation maps an operator classification to a CoT
+// affiliation, or "" when there is none.
+func annotationAffiliation(icao24 string) cot.Affiliation {
+	switch annotations.Classification(icao24) {
+	case "friendly":
+		return cot.Friend
+	case "hostile":
+		return cot.Hostile
+	case "civil":
+		return cot.Neutral
+	case "military", "unknown":
+		return cot.Unknown
+	}
+	return ""
+}
+
+// annotationPromptNote lists what operators have said about aircraft in the
+// picture, so SENTINEL can weigh it.
+func annotationPromptNote(aircraft []Aircraft) string {
+	var lines []string
+	for _, ac := range aircraft {
+		t, ok := annotations.Get(ac.ICAO24)
+		if !ok {
+			continue
+		}
+		var parts []string
+		if t.Classification != "" {
+			parts = append(parts, "classified "+t.Classification)
+		}
+		if len(t.Tags) > 0 {
+			parts = append(parts, "tags: "+strings.Join(t.Tags, ", "))
+		}
+		for _, n := range t.Notes {
+			parts = append(parts, fmt.Sprintf("note (%s): %q", n.At.Format("2006-01-02 15:04Z"), n.Text))
+		}
+		if len(parts) > 0 {
+			lines = append(lines, fmt.Sprintf("- %s (%s): %s", ac.ICAO24, displayCallsign(ac), strings.Join(parts, "; ")))
+		}
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return "\n\nOperator annotations (watch-floor knowledge; weigh them, and say so when you rely on one):\n" + strings.Join(lines, "\n")
+}
+
+// broadcastAnnotation tells every WebSocket client about a changed
+// annotation; a nil annotation means it was cleared. Workspace clients hear
+// only about tracks currently in their regions.
+func broadcastAnnotation(icao24 string, a *TrackAnnotation) {
+	msg := map[string]interface{}{"type": "track_annotation", "icao24": icao24, "annotation": a}
+	recorder.Broadcast("", msg)
+	in := trackRegions(icao24)
+	clientsMutex.RLock()
+	defer clientsMutex.RUnlock()
+	for conn := range clients {
+		if !clientAllows(conn, in...) {
+			continue
+		}
+		if err := conn.send(msg); err != nil {
+			wsLog.Warn("Write annotation to client failed", "err", err)
+		}
+	}
+}
+
+// lookupCallsign finds a track's callsign in the current pictures.
+func lookupCallsign(icao24 string) string {
+	for name := range regions {
+		for _, ac := range currentAirspace(name).Aircraft {
+			if ac.ICAO24 == icao24 {
+				return strings.TrimSpace(ac.Callsign)
+			}
+		}
+	}
+	return ""
+}
+
+// trackRegions lists the regions a track is currently seen in.
+func trackRegions(icao24 string) []string {
+	var in []string
+	for name := range regions {
+		for _, ac := range currentAirspace(name).Aircraft {
+			if ac.ICAO24 == icao24 {
+				in = append(in, name)
+				break
+			}
+		}
+	}
+	return in
+}
+
+// annotationsFor returns the annotations a principal may see: all of them,
+// or for a workspace member, those on tracks currently in its regions.
+func annotationsFor(p *Principal) []TrackAnnotation {
+	all := annotations.All()
+	var w *workspaceState
+	if p != nil {
+		w = workspaces.get(p.Workspace)
+	}
+	if w == nil || len(w.Regions) == 0 {
+		return all
+	}
+	visible := make(map[string]bool)
+	for _, region := range w.Regions {
+		for _, ac := range currentAirspace(region).Aircraft {
+			visible[ac.ICAO24] = true
+		}
+	}
+	out := all[:0]
+	for _, t := range all {
+		if visible[t.ICAO24] {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// handleAnnotations serves GET /api/tracks/annotations, every annotation
+// the caller may see.
+func handleAnnotations(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(annotationsFor(principalFrom(r)))
+}
+
+// handleTrackAction serves a track's annotations.
+//
+//	GET    /api/tracks/{icao24}/annotations          — the track's annotation
+//	POST   /api/tracks/{icao24}/annotations          — add a note, add/remove tags, set classification
+//	DELETE /api/tracks/{icao24}/annotations          — clear them all
+//	DELETE /api/tracks/{icao24}/annotations/{noteId} — delete one note
+func handleTrackAction(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/tracks/"), "/"), "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[1] != "annotations" || parts[0] == "" {
+		http.NotFound(w, r)
+		return
+	}
+	icao24 := strings.ToLower(parts[0])
+
+	if len(parts) == 3 {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		t, err := annotations.DeleteNote(icao24, parts[2])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		auditLog.Record(r, "annotation.note.delete", map[string]interface{}{"icao24": icao24, "note": parts[2]})
+		broadcastAnnotation(icao24, &t)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(t)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		t, ok := annotations.Get(icao24)
+		if !ok {
+			t = TrackAnnotation{ICAO24: icao24, Tags: []string{}, Notes: []AnnotationNote{}}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(t)
+
+	case http.MethodPost:
+		var u AnnotationUpdate
+		if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+			http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		by := ""
+		if p := principalFrom(r); p != nil {
+			by = p.Name
+		}
+		t, err := annotations.Update(icao24, lookupCallsign(icao24), u, by)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		details := map[string]interface{}{"icao24": icao24}
+		if u.Note != "" {
+			details["note"] = u.Note
+		}
+		if len(u.AddTags) > 0 || len(u.RemoveTags) > 0 {
+			details["addTags"], details["removeTags"] = u.AddTags, u.RemoveTags
+		}
+		if u.Classification != nil {
+			details["classification"] = *u.Classification
+		}
+		auditLog.Record(r, "annotation.update", details)
+		broadcastAnnotation(icao24, &t)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(t)
+
+	case http.MethodDelete:
+		if err := annotations.Clear(icao24); errors.Is(err, errNoAnnotation) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		auditLog.Record(r, "annotation.clear", map[string]interface{}{"icao24": icao24})
+		broadcastAnnotation(icao24, nil)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,260 @@
+// Package asterix encodes EUROCONTROL ASTERIX Category 021 (ADS-B target
+// reports, edition 2.x UAP) so surveillance tooling can ingest our tracks.
+//
+//	┌──────── Data Block ────────┐
+//	│ CAT(1) │ LEN(2) │ Record…  │   LEN covers the whole block
+//	└────────────────────────────┘
+//	  Record = FSPEC (7 FRN bits + FX per octet) followed by the present items in FRN order
+package asterix
+
+import (
+	"encoding/binary"
+	"math"
+	"strings"
+	"time"
+)
+
+// Category is the ASTERIX category number for ADS-B target reports.
+const Category = 21
+
+// MaxBlockSize keeps data blocks inside a single unfragmented UDP datagram.
+const MaxBlockSize = 1400
+
+// Field reference numbers (FRN) of the CAT021 items we emit.
+const (
+	frnDataSource       = 1  // I021/010
+	frnTargetDescriptor = 2  // I021/040
+	frnTrackNumber      = 3  // I021/161
+	frnTimePosition     = 5  // I021/071
+	frnHighResPosition  = 7  // I021/131
+	frnTargetAddress    = 11 // I021/080
+	frnTimeRxPosition   = 12 // I021/073
+	frnGeometricHeight  = 16 // I021/140
+	frnMOPSVersion      = 18 // I021/210
+	frnMode3A           = 19 // I021/070
+	frnFlightLevel      = 21 // I021/145
+	frnBaroVerticalRate = 24 // I021/155
+	frnGroundVector     = 26 // I021/160
+	frnTimeTransmission = 28 // I021/077
+	frnTargetID         = 29 // I021/170
+	frnEmitterCategory  = 30 // I021/020
+)
+
+// Report is one ADS-B target report. Pointer fields are optional.
+type Report struct {
+	SAC, SIC        uint8
+	TrackNumber     uint16 // 12 bits
+	Address         uint32 // 24-bit ICAO address
+	Time            time.Time
+	Lat, Lon        float64
+	OnGround        bool
+	Callsign        string
+	Squawk          string   // four octal digits
+	BaroAltitude    *float64 // meters
+	GeoAltitude     *float64 // meters
+	GroundSpeed     *float64 // m/s
+	Track           *float64 // degrees true
+	VerticalRate    *float64 // m/s
+	EmitterCategory uint8    // CAT021 ECAT, 0 = unknown
+}
+
+// Encode serializes a single record (FSPEC + items).
+func (r Report) Encode() []byte {
+	var fspec fspecBuilder
+	var items []byte
+
+	add := func(frn int, b ...byte) {
+		fspec.set(frn)
+		items = append(items, b...)
+	}
+	tod := timeOfDay(r.Time)
+
+	add(frnDataSource, r.SAC, r.SIC)
+	if r.OnGround {
+		add(frnTargetDescriptor, 0x01, 0x40) // ATP=24-bit address, ARC=25 ft; ext: GBS
+	} else {
+		add(frnTargetDescriptor, 0x00)
+	}
+	add(frnTrackNumber, byte(r.TrackNumber>>8)&0x0F, byte(r.TrackNumber))
+	add(frnTimePosition, tod...)
+	add(frnHighResPosition, highResPosition(r.Lat, r.Lon)...)
+	add(frnTargetAddress, byte(r.Address>>16), byte(r.Address>>8), byte(r.Address))
+	add(frnTimeRxPosition, tod...)
+	if r.GeoAltitude != nil {
+		add(frnGeometricHeight, int16BE(*r.GeoAltitude/0.3048/6.25)...)
+	}
+	add(frnMOPSVersion, 0x22) // VN=2 (DO-260B), LTT=2 (1090 ES)
+	if code, ok := mode3A(r.Squawk); ok {
+		add(frnMode3A, byte(code>>8), byte(code))
+	}
+	if r.BaroAltitude != nil {
+		add(frnFlightLevel, int16BE(*r.BaroAltitude/0.3048/100*4)...)
+	}
+	if r.VerticalRate != nil {
+		v := uint16(int16(clamp(*r.VerticalRate/0.3048*60/6.25, -16384, 16383))) & 0x7FFF
+		add(frnBaroVerticalRate, byte(v>>8), byte(v))
+	}
+	if r.GroundSpeed != nil && r.Track != nil {
+		gs := uint16(clamp(*r.GroundSpeed/1852*(1<<14), 0, 32767))
+		trk := uint16(math.Mod(*r.Track+360, 360) / 360 * (1 << 16))
+		add(frnGroundVector, byte(gs>>8), byte(gs), byte(trk>>8), byte(trk))
+	}
+	add(frnTimeTransmission, tod...)
+	if r.Callsign != "" {
+		add(frnTargetID, targetID(r.Callsign)...)
+	}
+	if r.EmitterCategory != 0 {
+		add(frnEmitterCategory, r.EmitterCategory)
+	}
+
+	return append(fspec.bytes(), items...)
+}
+
+// Blocks packs encoded records into CAT021 data blocks of at most MaxBlockSize bytes.
+func Blocks(records [][]byte) [][]byte {
+	var blocks [][]byte
+	var block []byte
+	flush := func() {
+		if len(block) > 3 {
+			binary.BigEndian.PutUint16(block[1:3], uint16(len(block)))
+			blocks = append(blocks, block)
+		}
+		block = nil
+	}
+	for _, rec := range records {
+		if block != nil && len(block)+len(rec) > MaxBlockSize {
+			flush()
+		}
+		if block == nil {
+			block = []byte{Category, 0, 0}
+		}
+		block = append(block, rec...)
+	}
+	flush()
+	return blocks
+}
+
+// EmitterCategory maps an OpenSky ADS-B emitter category to CAT021 ECAT.
+func EmitterCategory(opensky int) uint8 {
+	switch opensky {
+	case 2:
+		return 1 // light
+	case 3:
+		return 2 // small
+	case 4:
+		return 3 // medium/large
+	case 5:
+		return 4 // high vortex large
+	case 6:
+		return 5 // heavy
+	case 7:
+		return 6 // highly manoeuvrable
+	case 8:
+		return 10 // rotorcraft
+	case 9:
+		return 11 // glider
+	case 10:
+		return 12 // lighter than air
+	case 11:
+		return 16 // parachutist
+	case 12:
+		return 15 // ultralight
+	case 14:
+		return 13 // unmanned
+	case 15:
+		return 14 // space vehicle
+	}
+	return 0
+}
+
+// fspecBuilder accumulates FRN presence bits, 7 per octet with FX chaining.
+type fspecBuilder struct {
+	octets []byte
+}
+
+func (f *fspecBuilder) set(frn int) {
+	idx := (frn - 1) / 7
+	for len(f.octets) <= idx {
+		f.octets = append(f.octets, 0)
+	}
+	f.octets[idx] |= 0x80 >> uint((frn-1)%7)
+}
+
+func (f *fspecBuilder) bytes() []byte {
+	out := append([]byte{}, f.octets...)
+	for i := 0; i < len(out)-1; i++ {
+		out[i] |= 0x01
+	}
+	return out
+}
+
+// timeOfDay encodes seconds since UTC midnight in 1/128 s units.
+func timeOfDay(t time.Time) []byte {
+	t = t.UTC()
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	v := uint32(t.Sub(midnight).Seconds() * 128)
+	return []byte{byte(v >> 16), byte(v >> 8), byte(v)}
+}
+
+// highResPosition encodes I021/131, WGS-84 latitude and longitude in units
+// of 180/2^30 degrees.
+func highResPosition(lat, lon float64) []byte {
+	return append(int32BE(lat*(1<<30)/180), int32BE(lon*(1<<30)/180)...)
+}
+
+func int32BE(v float64) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, uint32(int32(math.Round(v))))
+	return b
+}
+
+func int16BE(v float64) []byte {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, uint16(int16(clamp(math.Round(v), math.MinInt16, math.MaxInt16))))
+	return b
+}
+
+func clamp(v, lo, hi float64) float64 {
+	return math.Max(lo, math.Min(hi, v))
+}
+
+// mode3A packs a four-digit octal squawk into 12 bits.
+func mode3A(squawk string) (uint16, bool) {
+	if len(squawk) != 4 {
+		return 0, false
+	}
+	var code uint16
+	for _, c := range squawk {
+		if c < '0' || c > '7' {
+			return 0, false
+		}
+		code = code<<3 | uint16(c-'0')
+	}
+	return code, true
+}
+
+// targetID packs up to 8 characters into 48 bits using the ICAO 6-bit
+// character set (A–Z = 1–26, space = 32, 0–9 = 48–57).
+func targetID(callsign string) []byte {
+	callsign = strings.ToUpper(callsign)
+	var v uint64
+	for i := 0; i < 8; i++ {
+		c := byte(' ')
+		if i < len(callsign) {
+			c = callsign[i]
+		}
+		var code uint64
+		switch {
+		case c >= 'A' && c <= 'Z':
+			code = uint64(c-'A') + 1
+		case c >= '0' && c <= '9':
+			code = uint64(c)
+		default:
+			code = 32
+		}
+		v = v<<6 | code
+	}
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b[2:]
+}
@@ -0,0 +1,172 @@
+package asterix
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// TestEncodeRecord checks a whole record against one assembled by hand from
+// the CAT021 edition 2.x UAP.
+func TestEncodeRecord(t *testing.T) {
+	r := Report{
+		SAC:         0x19,
+		SIC:         0xC9,
+		TrackNumber: 0x123,
+		Address:     0xABCDEF,
+		Time:        time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC),
+		Lat:         45,
+		Lon:         -90,
+		Callsign:    "TEST1",
+		Squawk:      "7000",
+	}
+	want := mustHex(t, ""+
+		"EB 19 19 03 80"+ // FSPEC: FRN 1-3, 5, 7 / 11, 12 / 18, 19 / 28 / 29
+		"19 C9"+ // I021/010 SAC, SIC
+		"00"+ // I021/040 airborne, 24-bit address
+		"01 23"+ // I021/161 track number
+		"07 08 00"+ // I021/071 01:00:00 in 1/128 s
+		"10 00 00 00 E0 00 00 00"+ // I021/131 45°, -90°
+		"AB CD EF"+ // I021/080
+		"07 08 00"+ // I021/073
+		"22"+ // I021/210 VN=2, LTT=2
+		"0E 00"+ // I021/070 7000
+		"07 08 00"+ // I021/077
+		"50 54 D4 C6 08 20") // I021/170 "TEST1   "
+	if got := r.Encode(); !bytes.Equal(got, want) {
+		t.Errorf("Encode() =\n% X\nwant\n% X", got, want)
+	}
+}
+
+func TestEncodeOnGround(t *testing.T) {
+	got := Report{OnGround: true}.Encode()
+	// FSPEC (4 octets, up to FRN 28) and I021/010, then I021/040 with its
+	// first extension.
+	if want := []byte{0x01, 0x40}; !bytes.Equal(got[6:8], want) {
+		t.Errorf("I021/040 = % X, want % X", got[6:8], want)
+	}
+}
+
+func TestFSPEC(t *testing.T) {
+	tests := []struct {
+		frns []int
+		want string
+	}{
+		{[]int{1}, "80"},
+		{[]int{7}, "02"},
+		{[]int{1, 2, 3, 4, 5, 6, 7}, "FE"},
+		{[]int{8}, "01 80"},
+		{[]int{14}, "01 02"},
+		{[]int{1, 15}, "81 01 80"},
+		{[]int{29}, "01 01 01 01 80"},
+		{[]int{7, 8, 21, 22}, "03 81 03 80"},
+	}
+	for _, tt := range tests {
+		var f fspecBuilder
+		for _, frn := range tt.frns {
+			f.set(frn)
+		}
+		if got, want := f.bytes(), mustHex(t, tt.want); !bytes.Equal(got, want) {
+			t.Errorf("FRNs %v: FSPEC = % X, want % X", tt.frns, got, want)
+		}
+	}
+}
+
+func TestHighResPosition(t *testing.T) {
+	lsb := 180.0 / (1 << 30)
+	tests := []struct {
+		lat, lon float64
+		want     string
+	}{
+		{0, 0, "00000000 00000000"},
+		{lsb, -lsb, "00000001 FFFFFFFF"},
+		{90, 180, "20000000 40000000"},
+		{-90, -180, "E0000000 C0000000"},
+		{45, -90, "10000000 E0000000"},
+		{1.4 * lsb, 1.6 * lsb, "00000001 00000002"}, // rounded to the nearest unit
+	}
+	for _, tt := range tests {
+		if got, want := highResPosition(tt.lat, tt.lon), mustHex(t, tt.want); !bytes.Equal(got, want) {
+			t.Errorf("highResPosition(%g, %g) = % X, want % X", tt.lat, tt.lon, got, want)
+		}
+	}
+}
+
+func TestTargetID(t *testing.T) {
+	tests := []struct {
+		callsign string
+		want     string
+	}{
+		{"", "82 08 20 82 08 20"}, // eight spaces
+		{"ABC", "04 20 E0 82 08 20"},
+		{"abc", "04 20 E0 82 08 20"},
+		{"TEST1", "50 54 D4 C6 08 20"},
+		{"A-B", "06 00 A0 82 08 20"},        // unsupported characters become spaces
+		{"ABCDEFGHIJ", "04 20 C4 14 61 C8"}, // cut to eight characters
+	}
+	for _, tt := range tests {
+		if got, want := targetID(tt.callsign), mustHex(t, tt.want); !bytes.Equal(got, want) {
+			t.Errorf("targetID(%q) = % X, want % X", tt.callsign, got, want)
+		}
+	}
+}
+
+func TestBlocks(t *testing.T) {
+	rec := func(n int) []byte { return bytes.Repeat([]byte{byte(n)}, n) }
+	tests := []struct {
+		name    string
+		records []int // record sizes
+		want    []int // records per block
+	}{
+		{"none", nil, nil},
+		{"one", []int{50}, []int{1}},
+		{"exactly full", []int{697, 700}, []int{2}},
+		{"one byte over", []int{698, 700}, []int{1, 1}},
+		{"several", []int{400, 400, 400, 400, 400}, []int{3, 2}},
+		{"oversized record", []int{10, 1500, 10}, []int{1, 1, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var records [][]byte
+			for _, n := range tt.records {
+				records = append(records, rec(n))
+			}
+			blocks := Blocks(records)
+			if len(blocks) != len(tt.want) {
+				t.Fatalf("got %d blocks, want %d", len(blocks), len(tt.want))
+			}
+			next := 0
+			for i, b := range blocks {
+				if b[0] != Category {
+					t.Errorf("block %d: CAT = %d", i, b[0])
+				}
+				if n := int(binary.BigEndian.Uint16(b[1:3])); n != len(b) {
+					t.Errorf("block %d: LEN = %d, block is %d bytes", i, n, len(b))
+				}
+				var payload []byte
+				for _, r := range records[next : next+tt.want[i]] {
+					payload = append(payload, r...)
+				}
+				next += tt.want[i]
+				if !bytes.Equal(b[3:], payload) {
+					t.Errorf("block %d doesn't hold records %d to %d", i, next-tt.want[i], next-1)
+				}
+				if len(b) > MaxBlockSize && tt.want[i] > 1 {
+					t.Errorf("block %d is %d bytes", i, len(b))
+				}
+			}
+		})
+	}
+}
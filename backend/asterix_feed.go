@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"swarm-c2/asterix"
+)
+
+// AsterixFeed broadcasts the air picture as ASTERIX CAT021 over UDP at a
+// fixed update rate, independent of the poll interval.
+type AsterixFeed struct {
+	sac, sic uint8
+	interval time.Duration
+	conn     net.PacketConn
+	dests    []net.Addr
+
+	trackNumbers map[string]uint16
+	nextTrack    uint16
+}
+
+// newAsterixFeedFromEnv returns nil when ASTERIX_DESTINATIONS is unset.
+//
+//	ASTERIX_DESTINATIONS — comma-separated host:port UDP destinations (unicast or multicast)
+//	ASTERIX_SAC, ASTERIX_SIC — System Area / Identification codes (default 0 / 1)
+//	ASTERIX_INTERVAL     — update rate (default the aircraft poll interval)
+func newAsterixFeedFromEnv() (*AsterixFeed, error) {
+	destinations := splitList(os.Getenv("ASTERIX_DESTINATIONS"))
+	if len(destinations) == 0 {
+		return nil, nil
+	}
+
+	f := &AsterixFeed{sic: 1, interval: pollInterval.Get(), trackNumbers: make(map[string]uint16)}
+	for name, dst := range map[string]*uint8{"ASTERIX_SAC": &f.sac, "ASTERIX_SIC": &f.sic} {
+		if v := os.Getenv(name); v != "" {
+			n, err := strconv.ParseUint(v, 0, 8)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			*dst = uint8(n)
+		}
+	}
+	if v := os.Getenv("ASTERIX_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("ASTERIX_INTERVAL: invalid duration %q", v)
+		}
+		f.interval = d
+	}
+
+	for _, d := range destinations {
+		addr, err := net.ResolveUDPAddr("udp", d)
+		if err != nil {
+			return nil, fmt.Errorf("ASTERIX destination %q: %w", d, err)
+		}
+		f.dests = append(f.dests, addr)
+	}
+	conn, err := net.ListenPacket("udp", ":0")
+	if err != nil {
+		return nil, fmt.Errorf("open ASTERIX socket: %w", err)
+	}
+	f.conn = conn
+
+	goSupervised("asterix", f.run)
+	return f, nil
+}
+
+func (f *AsterixFeed) run() {
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+
+	names := make([]string, 0, len(regions))
+	for name := range regions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for range ticker.C {
+		var records [][]byte
+		for _, region := range names {
+			for _, ac := range liveAircraft(currentAirspace(region).Aircraft) {
+				if rep, ok := f.report(ac); ok {
+					records = append(records, rep.Encode())
+				}
+			}
+		}
+
+		for _, block := range asterix.Blocks(records) {
+			for _, dst := range f.dests {
+				if _, err := f.conn.WriteTo(block, dst); err != nil {
+					feedLog.Warn("ASTERIX send failed", "destination", dst, "err", err)
+				}
+			}
+		}
+	}
+}
+
+// report converts an aircraft to a CAT021 report, assigning it a stable
+// 12-bit track number.
+func (f *AsterixFeed) report(ac Aircraft) (asterix.Report, bool) {
+	address, err := strconv.ParseUint(ac.ICAO24, 16, 24)
+	if err != nil || ac.Latitude == nil || ac.Longitude == nil {
+		return asterix.Report{}, false
+	}
+
+	tn, ok := f.trackNumbers[ac.ICAO24]
+	if !ok {
+		if len(f.trackNumbers) >= 4095 {
+			f.trackNumbers = make(map[string]uint16)
+		}
+		f.nextTrack = f.nextTrack%4095 + 1
+		tn = f.nextTrack
+		f.trackNumbers[ac.ICAO24] = tn
+	}
+
+	rep := asterix.Report{
+		SAC:             f.sac,
+		SIC:             f.sic,
+		TrackNumber:     tn,
+		Address:         uint32(address),
+		Time:            time.Unix(ac.LastContact, 0),
+		Lat:             *ac.Latitude,
+		Lon:             *ac.Longitude,
+		OnGround:        ac.OnGround,
+		Callsign:        displayCallsign(ac),
+		BaroAltitude:    ac.BaroAltitude,
+		GeoAltitude:     ac.GeoAltitude,
+		GroundSpeed:     ac.Velocity,
+		Track:           ac.TrueTrack,
+		VerticalRate:    ac.VerticalRate,
+		EmitterCategory: asterix.EmitterCategory(ac.Category),
+	}
+	if ac.TimePosition != nil {
+		rep.Time = time.Unix(*ac.TimePosition, 0)
+	}
+	if ac.Squawk != nil {
+		rep.Squawk = *ac.Squawk
+	}
+	return rep, true
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxAuditEntries caps how many audit entries are kept in memory for
+// queries. The file itself is never truncated.
+const maxAuditEntries = 100000
+
+// AuditEntry is one security-relevant action.
+type AuditEntry struct {
+	Time       time.Time              `json:"time"`
+	Actor      string                 `json:"actor"`               // username, API key label, or certificate name; "" if anonymous
+	ActorKind  string                 `json:"actorKind,omitempty"` // "user", "apikey", or "cert"
+	Workspace  string                 `json:"workspace,omitempty"` // the actor's workspace, if any
+	RemoteAddr string                 `json:"remoteAddr,omitempty"`
+	RequestID  string                 `json:"requestId,omitempty"` // matches request_id in the server log
+	Action     string                 `json:"action"`
+	Params     map[string]interface{} `json:"params,omitempty"`
+}
+
+// AuditLog is an append-only JSON Lines trail of who did what, in
+// DATA_DIR/audit.jsonl.
+type AuditLog struct {
+	mu      sync.RWMutex
+	file    *os.File
+	entries []AuditEntry // oldest first
+}
+
+var auditLog *AuditLog
+
+// OpenAuditLog loads dir/audit.jsonl and opens it for appending.
+func OpenAuditLog(dir string) (*AuditLog, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create data dir: %w", err)
+	}
+	path := filepath.Join(dir, "audit.jsonl")
+	a := &AuditLog{}
+
+	if f, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			var e AuditEntry
+			if json.Unmarshal(scanner.Bytes(), &e) != nil {
+				continue
+			}
+			a.entries = append(a.entries, e)
+		}
+		f.Close()
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("read audit log: %w", err)
+	}
+	a.trimLocked()
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open audit log: %w", err)
+	}
+	a.file = f
+	return a, nil
+}
+
+// Record logs an action by whoever authenticated r. Safe to call on a nil
+// log.
+func (a *AuditLog) Record(r *http.Request, action string, params map[string]interface{}) {
+	a.RecordAs(principalFrom(r), r, action, params)
+}
+
+// RecordAs logs an action with an explicit actor, for requests that
+// establish the identity themselves (logins) or have none.
+func (a *AuditLog) RecordAs(p *Principal, r *http.Request, action string, params map[string]interface{}) {
+	if a == nil {
+		return
+	}
+	e := AuditEntry{Time: time.Now().UTC(), Action: action, Params: params}
+	if p != nil {
+		e.Actor, e.ActorKind, e.Workspace = p.Name, p.Kind, p.Workspace
+	}
+	if r != nil {
+		e.RemoteAddr = clientIP(r)
+		e.RequestID = requestID(r)
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		historyLog.Error("Audit entry not encodable", "action", action, "err", err)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.entries = append(a.entries, e)
+	a.trimLocked()
+	if _, err := a.file.Write(append(line, '\n')); err != nil {
+		historyLog.Error("Audit log write failed", "err", err)
+	}
+}
+
+// AuditFilter narrows a query. Action matches exactly or as a dotted prefix,
+// so "user" matches "user.create" and "user.delete".
+type AuditFilter struct {
+	Actor    string
+	Action   string
+	From, To time.Time
+}
+
+func (f AuditFilter) match(e AuditEntry) bool {
+	if f.Actor != "" && e.Actor != f.Actor {
+		return false
+	}
+	if f.Action != "" && e.Action != f.Action && !strings.HasPrefix(e.Action, f.Action+".") {
+		return false
+	}
+	if !f.From.IsZero() && e.Time.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && e.Time.After(f.To) {
+		return false
+	}
+	return true
+}
+
+// Query returns matching entries, oldest first.
+func (a *AuditLog) Query(f AuditFilter) []AuditEntry {
+	result := []AuditEntry{}
+	if a == nil {
+		return result
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	for _, e := range a.entries {
+		if f.match(e) {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+// Close closes the log file. Safe to call on a nil log.
+func (a *AuditLog) Close() error {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.file.Close()
+}
+
+func (a *AuditLog) trimLocked() {
+	if len(a.entries) > maxAuditEntries {
+		a.entries = append([]AuditEntry(nil), a.entries[len(a.entries)-maxAuditEntries:]...)
+	}
+}
+
+// handleAudit serves the audit trail (admin only, see adminPaths).
+//
+//	GET /api/admin/audit?actor=&action=&from=&to=&limit=   — newest first, default limit 200
+//	GET /api/admin/audit?format=jsonl&…                    — everything matching, oldest first, as a download
+func handleAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	filter := AuditFilter{Actor: q.Get("actor"), Action: q.Get("action")}
+	var err error
+	if filter.From, err = parseTimeParam(q.Get("from")); err != nil {
+		http.Error(w, "Invalid from: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if filter.To, err = parseTimeParam(q.Get("to")); err != nil {
+		http.Error(w, "Invalid to: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	entries := auditLog.Query(filter)
+
+	if q.Get("format") == "jsonl" {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", `attachment; filename="audit.jsonl"`)
+		enc := json.NewEncoder(w)
+		for _, e := range entries {
+			enc.Encode(e)
+		}
+		return
+	}
+
+	limit := 200
+	if v := q.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+	newest := make([]AuditEntry, 0, limit)
+	for i := len(entries) - 1; i >= 0 && len(newest) < limit; i-- {
+		newest = append(newest, entries[i])
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Total-Count", strconv.Itoa(len(entries)))
+	json.NewEncoder(w).Encode(newest)
+}
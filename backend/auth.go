@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// APIKey is a labeled client credential with a role (default viewer). The
+// label identifies the client in logs; the key itself is only held as a
+// SHA-256 digest once loaded.
+type APIKey struct {
+	Label     string `json:"label"`
+	Key       string `json:"key,omitempty"`
+	Role      string `json:"role,omitempty"`
+	Workspace string `json:"-"` // set for keys defined in a workspace
+}
+
+// apiKeys maps key digests to their (keyless) definitions.
+var apiKeys map[[32]byte]APIKey
+
+// publicPaths stay reachable without credentials: load balancer probes, the
+// API docs (the spec itself is not sensitive), the login flow, and the drone
+// tasking link, which checks the drones' own tokens.
+var publicPaths = map[string]bool{
+	"/api/health":        true,
+	"/api/openapi.json":  true,
+	"/api/docs":          true,
+	"/api/login":         true,
+	"/api/token/refresh": true,
+	"/api/logout":        true,
+	"/ws/tasking":        true,
+}
+
+// Principal is whoever a request is authenticated as: an API key client, a
+// logged-in user, or a client certificate on the mTLS listener.
+type Principal struct {
+	Kind      string `json:"kind"` // "apikey", "user", or "cert"
+	Name      string `json:"name"`
+	Role      string `json:"role"`
+	SessionID string `json:"sessionId,omitempty"`
+	Workspace string `json:"workspace,omitempty"` // tenant the principal is confined to; "" for server operators
+}
+
+type authContextKey struct{}
+
+// loadAPIKeysFromEnv reads keys from API_KEYS (comma-separated "label:key"
+// or "label:key:role") and/or API_KEYS_FILE, a JSON array of
+// {"label", "key", "role"}.
+func loadAPIKeysFromEnv() error {
+	var keys []APIKey
+	for _, entry := range splitList(getSecret("API_KEYS")) {
+		parts := strings.Split(entry, ":")
+		k := APIKey{Key: strings.TrimSpace(parts[0])}
+		if len(parts) > 1 {
+			k.Label, k.Key = strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		}
+		if len(parts) > 2 {
+			k.Role = strings.TrimSpace(parts[2])
+		}
+		keys = append(keys, k)
+	}
+	if path := os.Getenv("API_KEYS_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("read API keys: %w", err)
+		}
+		var fileKeys []APIKey
+		if err := json.Unmarshal(data, &fileKeys); err != nil {
+			return fmt.Errorf("parse API keys: %w", err)
+		}
+		keys = append(keys, fileKeys...)
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	if err := registerAPIKeys(keys, ""); err != nil {
+		return err
+	}
+	authLog.Info("API key authentication enabled", "keys", len(keys))
+	return nil
+}
+
+// registerAPIKeys validates keys and adds them to apiKeys, confined to a
+// workspace if one is given. A key can't belong to two workspaces. Each key
+// is left labeled and with its secret cleared.
+func registerAPIKeys(keys []APIKey, workspace string) error {
+	if apiKeys == nil {
+		apiKeys = make(map[[32]byte]APIKey, len(keys))
+	}
+	for i := range keys {
+		k := &keys[i]
+		if len(k.Key) < 16 {
+			return fmt.Errorf("API key %d (%q) is shorter than 16 characters", i, k.Label)
+		}
+		if k.Label == "" {
+			k.Label = fmt.Sprintf("key-%d", i+1)
+			if workspace != "" {
+				k.Label = workspace + "-" + k.Label
+			}
+		}
+		if k.Role == "" {
+			k.Role = RoleViewer
+		}
+		if !validRole(k.Role) {
+			return fmt.Errorf("API key %q has unknown role %q", k.Label, k.Role)
+		}
+		digest := sha256.Sum256([]byte(k.Key))
+		if prev, dup := apiKeys[digest]; dup && prev.Workspace != workspace {
+			return fmt.Errorf("API key %q is also defined outside workspace %q", k.Label, workspace)
+		}
+		k.Key = ""
+		k.Workspace = workspace
+		apiKeys[digest] = *k
+	}
+	return nil
+}
+
+// authEnabled reports whether any credentials are configured. With neither
+// API keys nor user accounts the API stays open.
+func authEnabled() bool {
+	return len(apiKeys) > 0 || userStore.Count() > 0
+}
+
+// requireAuth rejects /api, /ws, /data, and /tiles requests without a valid API key
+// or access token with 401, and requests the principal's role doesn't allow
+// (see requiredRole) or its workspace doesn't cover (see scopeToWorkspace)
+// with 403. Credentials may be sent as
+// "Authorization: Bearer <key or JWT>", as X-API-Key, or as ?api_key= /
+// ?access_token= for clients that can't set headers (browser WebSockets,
+// Google Earth network links). On the mTLS listener the client certificate
+// is the credential, and authentication applies even with no keys or users.
+func requireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !(authEnabled() || viaMTLS(r)) || !needsAuth(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		p := requestPrincipal(r)
+		if p == nil {
+			if viaMTLS(r) {
+				requestLog(authLog, r).Warn("Refused client certificate not in MTLS_CLIENTS", "cert", certName(r))
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer realm="swarm-c2"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if need := requiredRole(r); !p.hasRole(need) {
+			auditLog.RecordAs(p, r, "access.denied", map[string]interface{}{"method": r.Method, "path": r.URL.Path})
+			http.Error(w, fmt.Sprintf("Forbidden: requires %s role", need), http.StatusForbidden)
+			return
+		}
+		if msg := scopeToWorkspace(p, r); msg != "" {
+			auditLog.RecordAs(p, r, "access.denied", map[string]interface{}{"method": r.Method, "path": r.URL.Path, "workspace": p.Workspace})
+			http.Error(w, "Forbidden: "+msg, http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), authContextKey{}, p)))
+	})
+}
+
+// authenticate resolves a credential to a principal. Access tokens are
+// checked against the user store as well, so disabling or deleting an
+// account, or ending its session, takes effect immediately rather than at
+// token expiry.
+func authenticate(cred string) *Principal {
+	if cred == "" {
+		return nil
+	}
+	if looksLikeJWT(cred) {
+		claims, err := verifyJWT(cred)
+		if err != nil {
+			return nil
+		}
+		u, ok := userStore.Get(claims.Subject)
+		if !ok || u.Disabled {
+			return nil
+		}
+		if claims.SessionID != "" && !userStore.SessionActive(claims.SessionID) {
+			return nil
+		}
+		return &Principal{Kind: "user", Name: u.Username, Role: u.Role, SessionID: claims.SessionID, Workspace: workspaces.OfUser(u.Username)}
+	}
+	if k, ok := apiKeys[sha256.Sum256([]byte(cred))]; ok {
+		return &Principal{Kind: "apikey", Name: k.Label, Role: k.Role, Workspace: k.Workspace}
+	}
+	return nil
+}
+
+// requestPrincipal authenticates r by client certificate, then by API key or
+// access token.
+func requestPrincipal(r *http.Request) *Principal {
+	if p := certPrincipal(r); p != nil {
+		return p
+	}
+	return authenticate(requestCredential(r))
+}
+
+func needsAuth(path string) bool {
+	if publicPaths[path] {
+		return false
+	}
+	return strings.HasPrefix(path, "/api/") || path == "/ws" || strings.HasPrefix(path, "/ws/") || strings.HasPrefix(path, "/data/") || strings.HasPrefix(path, "/tiles/")
+}
+
+func requestCredential(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if token := r.URL.Query().Get("access_token"); token != "" {
+		return token
+	}
+	return r.URL.Query().Get("api_key")
+}
+
+// principalFrom returns who authenticated the request, or nil when
+// authentication is off.
+func principalFrom(r *http.Request) *Principal {
+	p, _ := r.Context().Value(authContextKey{}).(*Principal)
+	return p
+}
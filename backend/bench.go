@@ -0,0 +1,414 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// BenchLatency is the spread of a duration, in milliseconds.
+type BenchLatency struct {
+	Samples int     `json:"samples"`
+	P50     float64 `json:"p50"`
+	P95     float64 `json:"p95"`
+	P99     float64 `json:"p99"`
+	Max     float64 `json:"max"`
+}
+
+// BenchReport is what the bench command measured.
+type BenchReport struct {
+	Clients      int          `json:"clients"`
+	SlowClients  int          `json:"slowClients"`
+	Regions      []string     `json:"regions"`
+	Aircraft     int          `json:"aircraftPerRegion"`
+	Interval     string       `json:"interval"`
+	Duration     string       `json:"duration"`
+	Coords       []string     `json:"coords,omitempty"`
+	Broadcasts   int          `json:"broadcasts"`
+	MessageBytes int          `json:"messageBytes"` // one region's picture, as sent
+	FanOut       BenchLatency `json:"fanOutMs"`     // time broadcastToClients takes per region
+	Delivery     BenchLatency `json:"deliveryMs"`   // broadcast start to a client having read the message
+	SlowDelivery BenchLatency `json:"slowDeliveryMs,omitempty"`
+	Expected     int          `json:"expected"`
+	Received     int          `json:"received"`
+	Dropped      int          `json:"dropped"`
+	Late         int          `json:"late"` // overran the broadcast interval
+	HeapStartMB  float64      `json:"heapStartMB"`
+	HeapPeakMB   float64      `json:"heapPeakMB"`
+	AllocPerTick float64      `json:"allocPerBroadcastKB"`
+	GCs          uint32       `json:"gcs"`
+	Goroutines   int          `json:"goroutinesPeak"`
+}
+
+func newBenchLatency(samples []time.Duration) BenchLatency {
+	if len(samples) == 0 {
+		return BenchLatency{}
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	ms := func(d time.Duration) float64 { return math.Round(float64(d.Microseconds())) / 1000 }
+	at := func(q float64) float64 { return ms(samples[min(len(samples)-1, int(q*float64(len(samples))))]) }
+	return BenchLatency{Samples: len(samples), P50: at(0.5), P95: at(0.95), P99: at(0.99), Max: ms(samples[len(samples)-1])}
+}
+
+// benchClient is one synthetic WebSocket client. It reads only as much of
+// each message as it needs, so its own cost stays small next to the
+// server's.
+type benchClient struct {
+	conn      *websocket.Conn
+	region    string
+	delay     time.Duration // reading pause per message, for a slow client
+	received  atomic.Int64
+	latencies []time.Duration // read once the client has stopped
+}
+
+var benchTimestampPrefix = []byte(`{"timestamp":`)
+
+// read counts airspace messages until the connection closes. The bench
+// stamps each picture with its broadcast time in Unix nanoseconds.
+func (c *benchClient) read(done *sync.WaitGroup) {
+	defer done.Done()
+	head := make([]byte, 40)
+	for {
+		_, r, err := c.conn.NextReader()
+		if err != nil {
+			return
+		}
+		n, _ := io.ReadFull(r, head)
+		io.Copy(io.Discard, r)
+		now := time.Now()
+		if !bytes.HasPrefix(head[:n], benchTimestampPrefix) {
+			continue // heartbeat, drawings, and other connect-time messages
+		}
+		digits := head[len(benchTimestampPrefix):n]
+		if end := bytes.IndexByte(digits, ','); end >= 0 {
+			digits = digits[:end]
+		}
+		sent, err := strconv.ParseInt(string(digits), 10, 64)
+		if err != nil {
+			continue
+		}
+		c.received.Add(1)
+		c.latencies = append(c.latencies, now.Sub(time.Unix(0, sent)))
+		if c.delay > 0 {
+			time.Sleep(c.delay)
+		}
+	}
+}
+
+// benchTraffic is a region's synthetic aircraft, flying straight lines and
+// bouncing off the region's edges.
+type benchTraffic struct {
+	region   string
+	bounds   Region
+	aircraft []Aircraft
+}
+
+func newBenchTraffic(region string, count int, rng *rand.Rand) *benchTraffic {
+	t := &benchTraffic{region: region, bounds: regions[region]}
+	for i := 0; i < count; i++ {
+		lat := t.bounds.MinLat + rng.Float64()*(t.bounds.MaxLat-t.bounds.MinLat)
+		lon := t.bounds.MinLon + rng.Float64()*(t.bounds.MaxLon-t.bounds.MinLon)
+		alt := 300 + rng.Float64()*12000
+		speed := 60 + rng.Float64()*200
+		track := rng.Float64() * 360
+		vrate := 0.0
+		t.aircraft = append(t.aircraft, Aircraft{
+			ICAO24:        fmt.Sprintf("be%04x", i),
+			Callsign:      fmt.Sprintf("BNCH%03d ", i%1000),
+			OriginCountry: "Benchmark",
+			Latitude:      &lat,
+			Longitude:     &lon,
+			BaroAltitude:  &alt,
+			GeoAltitude:   &alt,
+			Velocity:      &speed,
+			TrueTrack:     &track,
+			VerticalRate:  &vrate,
+		})
+	}
+	return t
+}
+
+// next advances every aircraft by dt and returns a fresh picture.
+func (t *benchTraffic) next(dt time.Duration) *AirspaceData {
+	now := time.Now().Unix()
+	out := make([]Aircraft, len(t.aircraft))
+	for i := range t.aircraft {
+		ac := &t.aircraft[i]
+		dist := *ac.Velocity * dt.Seconds()
+		rad := *ac.TrueTrack * math.Pi / 180
+		*ac.Latitude += dist * math.Cos(rad) / 111320
+		*ac.Longitude += dist * math.Sin(rad) / (111320 * math.Cos(*ac.Latitude*math.Pi/180))
+		if *ac.Latitude < t.bounds.MinLat || *ac.Latitude > t.bounds.MaxLat ||
+			*ac.Longitude < t.bounds.MinLon || *ac.Longitude > t.bounds.MaxLon {
+			*ac.TrueTrack = math.Mod(*ac.TrueTrack+180, 360)
+		}
+		lat, lon := *ac.Latitude, *ac.Longitude
+		out[i] = *ac
+		out[i].Latitude, out[i].Longitude = &lat, &lon
+		out[i].TimePosition = &now
+		out[i].LastContact = now
+	}
+	return &AirspaceData{Region: t.region, Aircraft: out, Count: len(out)}
+}
+
+func cmdBench(args []string) {
+	fs, config := newCommand("bench", "bench [-config FILE] [-clients N] [-aircraft M] [-regions R,R] [-duration D] [-interval D] [-slow N [-slow-delay D]] [-coords F,F] [-json]\n\n"+
+		"Serves the WebSocket endpoint on a loopback port, connects N synthetic clients spread\n"+
+		"across the regions, and broadcasts M synthetic aircraft per region every interval\n"+
+		"through the server's broadcast path. Clients and server share the process, so\n"+
+		"memory figures include both.")
+	clients := fs.Int("clients", 100, "WebSocket clients")
+	aircraft := fs.Int("aircraft", 200, "aircraft per region")
+	regionList := fs.String("regions", "socal", "comma-separated regions to broadcast")
+	duration := fs.Duration("duration", 30*time.Second, "how long to broadcast")
+	interval := fs.Duration("interval", time.Second, "time between broadcasts to each region")
+	slow := fs.Int("slow", 0, "clients that pause after each message, as on a poor link")
+	slowDelay := fs.Duration("slow-delay", 100*time.Millisecond, "pause per message for slow clients")
+	coordsFlag := fs.String("coords", "", "coordinate formats every client asks for (dms, mgrs)")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	parseCommand(fs, config, args)
+
+	benchRegions := splitList(*regionList)
+	for _, r := range benchRegions {
+		if _, ok := regions[r]; !ok {
+			fmt.Fprintf(os.Stderr, "Unknown region %q\n", r)
+			os.Exit(2)
+		}
+	}
+	formats, err := parseCoordFormats(*coordsFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -coords: %v\n", err)
+		os.Exit(2)
+	}
+	if fs.NArg() > 0 || len(benchRegions) == 0 || *clients < 1 || *aircraft < 0 || *duration <= 0 || *interval <= 0 || *slow < 0 || *slow > *clients {
+		fs.Usage()
+		os.Exit(2)
+	}
+	loadSettings()
+	wsIdleTimeout = 0
+
+	report, err := runBench(*clients, *aircraft, benchRegions, *duration, *interval, *slow, *slowDelay, formats)
+	if err != nil {
+		fatal("Bench failed", "err", err)
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+		return
+	}
+	printBenchReport(os.Stdout, report)
+}
+
+// runBench connects the clients, broadcasts for the duration, waits for the
+// last messages to arrive, and measures.
+func runBench(nClients, nAircraft int, benchRegions []string, duration, interval time.Duration, slow int, slowDelay time.Duration, formats []string) (*BenchReport, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(handleWebSocket)}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	url := "ws://" + ln.Addr().String() + "/ws?region="
+	if len(formats) > 0 {
+		formats = append([]string{}, formats...)
+		sort.Strings(formats)
+	}
+	var readers sync.WaitGroup
+	clientList := make([]*benchClient, nClients)
+	for i := range clientList {
+		region := benchRegions[i%len(benchRegions)]
+		target := url + region
+		if len(formats) > 0 {
+			target += "&coords=" + strings.Join(formats, ",")
+		}
+		conn, _, err := websocket.DefaultDialer.Dial(target, nil)
+		if err != nil {
+			return nil, fmt.Errorf("connect client %d: %w", i+1, err)
+		}
+		c := &benchClient{conn: conn, region: region}
+		if i < slow {
+			c.delay = slowDelay
+		}
+		clientList[i] = c
+		readers.Add(1)
+		go c.read(&readers)
+	}
+	defer func() {
+		for _, c := range clientList {
+			if c != nil {
+				c.conn.Close()
+			}
+		}
+		readers.Wait()
+	}()
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		clientsMutex.RLock()
+		n := len(clients)
+		clientsMutex.RUnlock()
+		if n >= nClients {
+			break
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("only %d of %d clients registered", n, nClients)
+		}
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	traffic := make([]*benchTraffic, len(benchRegions))
+	for i, r := range benchRegions {
+		traffic[i] = newBenchTraffic(r, nAircraft, rng)
+	}
+	report := &BenchReport{
+		Clients:     nClients,
+		SlowClients: slow,
+		Regions:     benchRegions,
+		Aircraft:    nAircraft,
+		Interval:    interval.String(),
+		Duration:    duration.String(),
+		Coords:      formats,
+	}
+	sample := traffic[0].next(0)
+	sample.Timestamp = time.Now().UnixNano()
+	raw, _ := json.Marshal(airspaceFor(formats, sample))
+	report.MessageBytes = len(raw) + 1 // WriteJSON ends each message with a newline
+
+	runtime.GC()
+	var start runtime.MemStats
+	runtime.ReadMemStats(&start)
+	report.HeapStartMB = benchRound(float64(start.HeapAlloc) / (1 << 20))
+	var heapPeak uint64
+	var goroutinePeak int
+	stopSampling := make(chan struct{})
+	var sampling sync.WaitGroup
+	sampling.Add(1)
+	go func() {
+		defer sampling.Done()
+		ticker := time.NewTicker(250 * time.Millisecond)
+		defer ticker.Stop()
+		var m runtime.MemStats
+		for {
+			runtime.ReadMemStats(&m)
+			heapPeak = max(heapPeak, m.HeapAlloc)
+			goroutinePeak = max(goroutinePeak, runtime.NumGoroutine())
+			select {
+			case <-stopSampling:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	// Broadcast to every region each interval, as the pollers do, until the
+	// duration is up.
+	var fanOut []time.Duration
+	perRegion := 0
+	ticker := time.NewTicker(interval)
+	end := time.Now().Add(duration)
+	for now := time.Now(); now.Before(end); now = <-ticker.C {
+		tickStart := time.Now()
+		for _, t := range traffic {
+			data := t.next(interval)
+			started := time.Now()
+			data.Timestamp = started.UnixNano()
+			broadcastToClients(t.region, data)
+			fanOut = append(fanOut, time.Since(started))
+			report.Broadcasts++
+		}
+		perRegion++
+		if time.Since(tickStart) > interval {
+			report.Late++
+		}
+	}
+	ticker.Stop()
+
+	// Let slow clients catch up before counting what was lost.
+	report.Expected = perRegion * nClients
+	for deadline := time.Now().Add(max(5*time.Second, time.Duration(perRegion)*slowDelay)); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		if benchReceived(clientList) >= report.Expected {
+			break
+		}
+	}
+	close(stopSampling)
+	sampling.Wait()
+	var done runtime.MemStats
+	runtime.ReadMemStats(&done)
+	for _, c := range clientList {
+		c.conn.Close()
+	}
+	readers.Wait()
+
+	var fast, slowLat []time.Duration
+	for _, c := range clientList {
+		report.Received += int(c.received.Load())
+		if c.delay > 0 {
+			slowLat = append(slowLat, c.latencies...)
+		} else {
+			fast = append(fast, c.latencies...)
+		}
+	}
+	report.Dropped = report.Expected - report.Received
+	report.FanOut = newBenchLatency(fanOut)
+	report.Delivery = newBenchLatency(fast)
+	report.SlowDelivery = newBenchLatency(slowLat)
+	report.HeapPeakMB = benchRound(float64(heapPeak) / (1 << 20))
+	if report.Broadcasts > 0 {
+		report.AllocPerTick = benchRound(float64(done.TotalAlloc-start.TotalAlloc) / 1024 / float64(report.Broadcasts))
+	}
+	report.GCs = done.NumGC - start.NumGC
+	report.Goroutines = goroutinePeak
+	return report, nil
+}
+
+func benchRound(v float64) float64 { return math.Round(v*100) / 100 }
+
+// benchReceived totals what the clients have read so far.
+func benchReceived(list []*benchClient) int {
+	total := 0
+	for _, c := range list {
+		total += int(c.received.Load())
+	}
+	return total
+}
+
+func printBenchReport(w io.Writer, r *BenchReport) {
+	latency := func(l BenchLatency) string {
+		return fmt.Sprintf("p50 %.2f  p95 %.2f  p99 %.2f  max %.2f ms  (%d samples)", l.P50, l.P95, l.P99, l.Max, l.Samples)
+	}
+	fmt.Fprintf(w, "Bench: %d clients (%d slow), %d aircraft in each of %s, every %s for %s\n",
+		r.Clients, r.SlowClients, r.Aircraft, strings.Join(r.Regions, ", "), r.Interval, r.Duration)
+	if len(r.Coords) > 0 {
+		fmt.Fprintf(w, "Coordinates:     %s\n", strings.Join(r.Coords, ", "))
+	}
+	fmt.Fprintf(w, "\nBroadcasts:      %d (%.1f KB per message, %d overran the interval)\n", r.Broadcasts, float64(r.MessageBytes)/1024, r.Late)
+	fmt.Fprintf(w, "Fan-out time:    %s\n", latency(r.FanOut))
+	fmt.Fprintf(w, "Delivery:        %s\n", latency(r.Delivery))
+	if r.SlowClients > 0 {
+		fmt.Fprintf(w, "Slow delivery:   %s\n", latency(r.SlowDelivery))
+	}
+	dropRate := 0.0
+	if r.Expected > 0 {
+		dropRate = float64(r.Dropped) / float64(r.Expected) * 100
+	}
+	fmt.Fprintf(w, "Messages:        %d expected, %d received, %d dropped (%.2f%%)\n", r.Expected, r.Received, r.Dropped, dropRate)
+	fmt.Fprintf(w, "Memory:          heap %.1f MB at start, %.1f MB peak; %.1f KB allocated per broadcast; %d GCs\n",
+		r.HeapStartMB, r.HeapPeakMB, r.AllocPerTick, r.GCs)
+	fmt.Fprintf(w, "Goroutines:      %d peak\n", r.Goroutines)
+}
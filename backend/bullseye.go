@@ -0,0 +1,393 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	metersPerNM      = 1852.0
+	maxBullseyeRings = 20
+	maxBullseyeRange = 1000 // nautical miles
+)
+
+// defaultBullseyeRings are drawn when a bullseye is set without rings.
+var defaultBullseyeRings = []float64{20, 40, 60, 80, 100}
+
+// bullseyeName is a code word: letters, digits, spaces, and hyphens.
+var bullseyeName = regexp.MustCompile(`^[A-Z0-9][A-Z0-9 -]{0,31}$`)
+
+// Bullseye is a region's named reference point. Controllers give positions
+// as bearing and range from it ("ROCK 045/32") so they can be passed on an
+// open net without revealing the reference itself.
+type Bullseye struct {
+	Region    string    `json:"region"`
+	Name      string    `json:"name"` // code word, e.g. "ROCK"
+	Latitude  float64   `json:"latitude"`
+	Longitude float64   `json:"longitude"`
+	Rings     []float64 `json:"rings"` // range rings, nautical miles
+	UpdatedBy string    `json:"updatedBy,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// BullseyeRequest sets a region's bullseye; only the fields given are
+// replaced, and a new bullseye needs a position.
+type BullseyeRequest struct {
+	Name      *string   `json:"name"`
+	Latitude  *float64  `json:"latitude"`
+	Longitude *float64  `json:"longitude"`
+	Rings     []float64 `json:"rings"`
+}
+
+// BullseyeRef is an aircraft's position from its region's bullseye.
+type BullseyeRef struct {
+	Name    string  `json:"name"`
+	Bearing int     `json:"bearing"` // degrees true, 0–359
+	RangeNm float64 `json:"rangeNm"`
+	Call    string  `json:"call"` // e.g. "ROCK 045/32"
+}
+
+// Bullseyes holds one bullseye per region, persisted as a JSON file in the
+// data directory.
+type Bullseyes struct {
+	mu     sync.RWMutex
+	path   string
+	points map[string]*Bullseye
+}
+
+var bullseyes = &Bullseyes{points: make(map[string]*Bullseye)}
+
+var errBullseyeNotFound = errors.New("no bullseye set for region")
+
+// OpenBullseyes loads dir/bullseyes.json if it exists.
+func OpenBullseyes(dir string) (*Bullseyes, error) {
+	b := &Bullseyes{path: filepath.Join(dir, "bullseyes.json"), points: make(map[string]*Bullseye)}
+	data, err := os.ReadFile(b.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return b, nil
+		}
+		return nil, fmt.Errorf("read bullseyes: %w", err)
+	}
+	var list []*Bullseye
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("parse bullseyes: %w", err)
+	}
+	for _, be := range list {
+		b.points[be.Region] = be
+	}
+	return b, nil
+}
+
+// List returns every region's bullseye, by region.
+func (b *Bullseyes) List() []Bullseye {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	out := make([]Bullseye, 0, len(b.points))
+	for _, be := range b.points {
+		out = append(out, be.copy())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Region < out[j].Region })
+	return out
+}
+
+// Get returns a region's bullseye.
+func (b *Bullseyes) Get(region string) (Bullseye, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	be, ok := b.points[region]
+	if !ok {
+		return Bullseye{}, errBullseyeNotFound
+	}
+	return be.copy(), nil
+}
+
+// Put sets or changes a region's bullseye and persists them.
+func (b *Bullseyes) Put(region string, req BullseyeRequest, by string) (Bullseye, bool, error) {
+	if _, ok := regions[region]; !ok {
+		return Bullseye{}, false, fmt.Errorf("unknown region %q", region)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	old, exists := b.points[region]
+	next := Bullseye{Region: region, Name: "BULLSEYE", Rings: defaultBullseyeRings}
+	if exists {
+		next = old.copy()
+	} else if req.Latitude == nil || req.Longitude == nil {
+		return Bullseye{}, false, errors.New("latitude and longitude are required")
+	}
+	if req.Name != nil {
+		name := strings.ToUpper(strings.TrimSpace(*req.Name))
+		if !bullseyeName.MatchString(name) {
+			return Bullseye{}, false, fmt.Errorf("name %q must be 1-32 letters, digits, spaces, or hyphens", *req.Name)
+		}
+		next.Name = name
+	}
+	if req.Latitude != nil {
+		next.Latitude = *req.Latitude
+	}
+	if req.Longitude != nil {
+		next.Longitude = *req.Longitude
+	}
+	if lat, lon := next.Latitude, next.Longitude; math.IsNaN(lat) || math.IsNaN(lon) || lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return Bullseye{}, false, errors.New("latitude must be -90 to 90 and longitude -180 to 180")
+	}
+	if req.Rings != nil {
+		if len(req.Rings) > maxBullseyeRings {
+			return Bullseye{}, false, fmt.Errorf("at most %d rings", maxBullseyeRings)
+		}
+		for _, nm := range req.Rings {
+			if !(nm > 0 && nm <= maxBullseyeRange) {
+				return Bullseye{}, false, fmt.Errorf("ring %v must be above 0 and at most %d nm", nm, maxBullseyeRange)
+			}
+		}
+		next.Rings = append([]float64{}, req.Rings...)
+		sort.Float64s(next.Rings)
+	}
+	next.UpdatedBy, next.UpdatedAt = by, time.Now().UTC()
+
+	b.points[region] = &next
+	if err := b.saveLocked(); err != nil {
+		if exists {
+			b.points[region] = old
+		} else {
+			delete(b.points, region)
+		}
+		return Bullseye{}, false, err
+	}
+	return next.copy(), !exists, nil
+}
+
+// Delete clears a region's bullseye and persists them.
+func (b *Bullseyes) Delete(region string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	be, ok := b.points[region]
+	if !ok {
+		return errBullseyeNotFound
+	}
+	delete(b.points, region)
+	if err := b.saveLocked(); err != nil {
+		b.points[region] = be
+		return err
+	}
+	return nil
+}
+
+func (b *Bullseyes) saveLocked() error {
+	if b.path == "" {
+		return nil
+	}
+	list := make([]*Bullseye, 0, len(b.points))
+	for _, be := range b.points {
+		list = append(list, be)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Region < list[j].Region })
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(b.path, data, 0o644)
+}
+
+func (be *Bullseye) copy() Bullseye {
+	c := *be
+	c.Rings = append([]float64{}, be.Rings...)
+	return c
+}
+
+// From gives a position as bearing and range from the bullseye.
+func (be Bullseye) From(lat, lon float64) BullseyeRef {
+	nm := greatCircleDistance(be.Latitude, be.Longitude, lat, lon) / metersPerNM
+	bearing := int(math.Round(greatCircleBearing(be.Latitude, be.Longitude, lat, lon))) % 360
+	return BullseyeRef{
+		Name:    be.Name,
+		Bearing: bearing,
+		RangeNm: math.Round(nm*10) / 10,
+		Call:    fmt.Sprintf("%s %03d/%d", be.Name, bearing, int(math.Round(nm))),
+	}
+}
+
+// Annotate sets every positioned aircraft's bearing and range from its
+// region's bullseye, or clears it when the region has none.
+func (b *Bullseyes) Annotate(data *AirspaceData) {
+	be, err := b.Get(data.Region)
+	for i := range data.Aircraft {
+		ac := &data.Aircraft[i]
+		ac.Bullseye = nil
+		if err == nil && ac.Latitude != nil && ac.Longitude != nil {
+			ref := be.From(*ac.Latitude, *ac.Longitude)
+			ac.Bullseye = &ref
+		}
+	}
+}
+
+// bullseyePromptNote tells SENTINEL about the region's bullseye, so its
+// observations give positions the way controllers pass them.
+func bullseyePromptNote(region string) string {
+	be, err := bullseyes.Get(region)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("\n\nBullseye %s is the reference point at %.4f, %.4f. Each aircraft's bullseye field gives its bearing (degrees true) and range (nautical miles) from it. "+
+		"When you describe where an aircraft is, give its bullseye call as it appears in the data, e.g. %q, rather than latitude and longitude.",
+		be.Name, be.Latitude, be.Longitude, be.Name+" 045/32")
+}
+
+// bullseyeRing is a range ring as a closed [lon, lat] ring, for GeoJSON.
+func bullseyeRing(be Bullseye, nm float64) [][2]float64 {
+	const steps = 72
+	ring := make([][2]float64, 0, steps+1)
+	for i := 0; i <= steps; i++ {
+		lat, lon := destinationPoint(be.Latitude, be.Longitude, float64(i%steps)*360/steps, nm*metersPerNM)
+		ring = append(ring, [2]float64{lon, lat})
+	}
+	return ring
+}
+
+// broadcastBullseye tells every WebSocket client whose workspace may watch
+// the region about a changed bullseye; nil means it was cleared.
+func broadcastBullseye(region string, be *Bullseye) {
+	msg := map[string]interface{}{"type": "bullseye", "region": region, "bullseye": be}
+	recorder.Broadcast("", msg)
+	clientsMutex.RLock()
+	defer clientsMutex.RUnlock()
+	for conn := range clients {
+		if !clientAllows(conn, region) {
+			continue
+		}
+		if err := conn.send(msg); err != nil {
+			wsLog.Warn("Write bullseye to client failed", "err", err)
+		}
+	}
+}
+
+// bullseyesFor returns the bullseyes in the regions a principal may watch.
+func bullseyesFor(p *Principal) []Bullseye {
+	all := bullseyes.List()
+	out := all[:0]
+	for _, be := range all {
+		if workspaceAllows(p, be.Region) {
+			out = append(out, be)
+		}
+	}
+	return out
+}
+
+// handleBullseyes lists the bullseye of every region the caller may watch.
+// GET /api/bullseye
+func handleBullseyes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(bullseyesFor(principalFrom(r)))
+}
+
+// handleBullseye serves one region's bullseye.
+//
+//	GET    /api/bullseye/{region}
+//	PUT    /api/bullseye/{region} — set it, or change the fields given
+//	DELETE /api/bullseye/{region}
+func handleBullseye(w http.ResponseWriter, r *http.Request) {
+	region := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/bullseye/"), "/")
+	if _, ok := regions[region]; !ok {
+		http.Error(w, fmt.Sprintf("unknown region %q", region), http.StatusNotFound)
+		return
+	}
+	// The region is in the path, where scopeToWorkspace doesn't look.
+	if !workspaceAllows(principalFrom(r), region) {
+		http.Error(w, fmt.Sprintf("region %q is not in your workspace", region), http.StatusForbidden)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		be, err := bullseyes.Get(region)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(be)
+
+	case http.MethodPut:
+		var req BullseyeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		by := ""
+		if p := principalFrom(r); p != nil {
+			by = p.Name
+		}
+		be, created, err := bullseyes.Put(region, req, by)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		auditLog.Record(r, "bullseye.set", map[string]interface{}{"region": region, "name": be.Name, "latitude": be.Latitude, "longitude": be.Longitude})
+		broadcastBullseye(region, &be)
+		status := http.StatusOK
+		if created {
+			status = http.StatusCreated
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(be)
+
+	case http.MethodDelete:
+		if err := bullseyes.Delete(region); errors.Is(err, errBullseyeNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		auditLog.Record(r, "bullseye.delete", map[string]interface{}{"region": region})
+		broadcastBullseye(region, nil)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleBullseyesGeoJSON serves each bullseye as a Point and its range
+// rings as LineStrings.
+// GET /api/bullseye.geojson[?region=]
+func handleBullseyesGeoJSON(w http.ResponseWriter, r *http.Request) {
+	region := r.URL.Query().Get("region")
+	var features []GeoJSONFeature
+	for _, be := range bullseyes.List() {
+		if region != "" && be.Region != region {
+			continue
+		}
+		features = append(features, GeoJSONFeature{
+			Type:       "Feature",
+			ID:         "bullseye:" + be.Region,
+			Geometry:   GeoJSONGeometry{Type: "Point", Coordinates: [2]float64{be.Longitude, be.Latitude}},
+			Properties: map[string]interface{}{"region": be.Region, "name": be.Name},
+		})
+		for _, nm := range be.Rings {
+			features = append(features, GeoJSONFeature{
+				Type:       "Feature",
+				ID:         fmt.Sprintf("bullseye:%s:%g", be.Region, nm),
+				Geometry:   GeoJSONGeometry{Type: "LineString", Coordinates: bullseyeRing(be, nm)},
+				Properties: map[string]interface{}{"region": be.Region, "name": be.Name, "rangeNm": nm},
+			})
+		}
+	}
+	writeGeoJSON(w, features)
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const cliUsage = `Usage: swarm-c2 <command> [flags]
+
+Commands:
+  serve             Run the server (the default when no command is given)
+  replay FILE       Run the server with a recording instead of the live source
+  export            Write stored position history to stdout or a file
+  analyze-once      Run one SENTINEL analysis for a region and print it
+  validate-config   Check the config file and environment, then exit
+  bench             Load-test the WebSocket broadcast path and print a report
+
+Every command takes -config FILE (same as CONFIG_FILE). Run
+"swarm-c2 <command> -h" for its flags.
+`
+
+func main() {
+	args := os.Args[1:]
+	cmd := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
+	}
+	switch cmd {
+	case "serve":
+		cmdServe(args)
+	case "replay":
+		cmdReplay(args)
+	case "export":
+		cmdExport(args)
+	case "analyze-once":
+		cmdAnalyzeOnce(args)
+	case "validate-config":
+		cmdValidateConfig(args)
+	case "bench":
+		cmdBench(args)
+	case "help":
+		fmt.Print(cliUsage)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n%s", cmd, cliUsage)
+		os.Exit(2)
+	}
+}
+
+// newCommand returns a flag set for a subcommand with the shared -config
+// flag. Call parseCommand to parse it.
+func newCommand(name, synopsis string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: swarm-c2 %s\n\nFlags:\n", synopsis)
+		fs.PrintDefaults()
+	}
+	return fs, fs.String("config", "", "YAML config file (overrides CONFIG_FILE)")
+}
+
+// parseCommand parses args and applies -config.
+func parseCommand(fs *flag.FlagSet, config *string, args []string) {
+	fs.Parse(args)
+	if *config != "" {
+		os.Setenv("CONFIG_FILE", *config)
+	}
+}
+
+// loadSettings reads the config file, sets up logging, and loads the
+// reloadable settings, exiting on any error.
+func loadSettings() {
+	if err := loadConfigFile(); err != nil {
+		fmt.Fprintf(os.Stderr, "Config: %v\n", err)
+		os.Exit(1)
+	}
+	if err := setupLogging(); err != nil {
+		fmt.Fprintf(os.Stderr, "Logging: %v\n", err)
+		os.Exit(1)
+	}
+	if configPath != "" {
+		serverLog.Info("Loaded config file", "path", configPath, "settings", len(configValues))
+	}
+	if err := loadReloadableSettings(); err != nil {
+		fatal("Config", "err", err)
+	}
+}
+
+func dataDirFromEnv() string {
+	if dir := os.Getenv("DATA_DIR"); dir != "" {
+		return dir
+	}
+	return "./data"
+}
+
+func cmdServe(args []string) {
+	fs, config := newCommand("serve", "serve [-config FILE] [-scenario FILE] [-record DIR] [-replay FILE [-speed N] [-loop]]")
+	scenarioFile := fs.String("scenario", "", "YAML scenario of simulated aircraft (overrides SCENARIO_FILE)")
+	recordDir := fs.String("record", "", "record the session to a file in this directory (overrides RECORD_DIR)")
+	replayFile := fs.String("replay", "", "re-serve a session recording (.rec) or position history instead of the live source")
+	speed := fs.Float64("speed", 1, "replay speed multiplier")
+	loop := fs.Bool("loop", false, "start the replay over at the end instead of stopping")
+	parseCommand(fs, config, args)
+	if *scenarioFile != "" {
+		os.Setenv("SCENARIO_FILE", *scenarioFile)
+	}
+	if *recordDir != "" {
+		os.Setenv("RECORD_DIR", *recordDir)
+	}
+	if fs.NArg() > 0 || *speed <= 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	var replay Replay
+	if *replayFile != "" {
+		replay = openReplay(*replayFile, *speed, *loop)
+	}
+	serve(replay)
+}
+
+// openReplay opens a session recording (.rec) or position history file,
+// exiting on error.
+func openReplay(path string, speed float64, loop bool) Replay {
+	var replay Replay
+	var err error
+	if strings.HasSuffix(path, ".rec") {
+		replay, err = OpenSessionReplay(path, speed, loop)
+	} else {
+		replay, err = OpenPositionReplay(path, speed, loop)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Replay: %v\n", err)
+		os.Exit(1)
+	}
+	return replay
+}
+
+func cmdReplay(args []string) {
+	fs, config := newCommand("replay", "replay [-config FILE] [-speed N] [-loop] FILE\n\nFILE is a session recording (.rec) from RECORD_DIR, or position history as written\nby export or GET /api/export/stream.")
+	speed := fs.Float64("speed", 1, "playback speed multiplier")
+	loop := fs.Bool("loop", false, "start over at the end instead of stopping")
+	parseCommand(fs, config, args)
+	if fs.NArg() != 1 || *speed <= 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	serve(openReplay(fs.Arg(0), *speed, *loop))
+}
+
+func cmdExport(args []string) {
+	fs, config := newCommand("export", "export [-config FILE] [-region R] [-from T] [-to T] [-format jsonl|csv] [-o FILE]")
+	region := fs.String("region", "", "only this region")
+	fromFlag := fs.String("from", "", "start time, Unix seconds or RFC 3339 (default: oldest)")
+	toFlag := fs.String("to", "", "end time (default: now)")
+	format := fs.String("format", "jsonl", "jsonl or csv")
+	out := fs.String("o", "", "output file (default: stdout)")
+	parseCommand(fs, config, args)
+	if fs.NArg() > 0 || (*format != "jsonl" && *format != "csv") {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if err := loadConfigFile(); err != nil {
+		fmt.Fprintf(os.Stderr, "Config: %v\n", err)
+		os.Exit(1)
+	}
+	from, err := parseTimeParam(*fromFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -from: %v\n", err)
+		os.Exit(2)
+	}
+	to, err := parseTimeParam(*toFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -to: %v\n", err)
+		os.Exit(2)
+	}
+	if to.IsZero() {
+		to = time.Now()
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Export: %v\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		w = f
+	}
+	dir := filepath.Join(dataDirFromEnv(), "positions")
+	count, err := exportPositions(w, dir, *region, from, to, *format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Export: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d positions from %s\n", count, dir)
+}
+
+// exportPositions writes stored positions as JSON Lines or CSV and returns
+// how many were written.
+func exportPositions(w io.Writer, dir, region string, from, to time.Time, format string) (int, error) {
+	count := 0
+	if format == "jsonl" {
+		err := scanPositions(dir, region, from, to, func(line []byte) error {
+			count++
+			if _, err := w.Write(line); err != nil {
+				return err
+			}
+			_, err := w.Write([]byte{'\n'})
+			return err
+		})
+		return count, err
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Write(append([]string{"time", "region"}, aircraftCSVColumns...))
+	err := scanPositions(dir, region, from, to, func(line []byte) error {
+		var rec PositionRecord
+		if json.Unmarshal(line, &rec) != nil {
+			return nil
+		}
+		count++
+		return cw.Write(append([]string{strconv.FormatInt(rec.Time, 10), rec.Region}, aircraftCSVRow(rec.Aircraft)...))
+	})
+	cw.Flush()
+	if err == nil {
+		err = cw.Error()
+	}
+	return count, err
+}
+
+func cmdAnalyzeOnce(args []string) {
+	fs, config := newCommand("analyze-once", "analyze-once -region R [-config FILE] [-save]")
+	region := fs.String("region", "", "region to analyze (required)")
+	save := fs.Bool("save", false, "also record the analysis in the data directory's history")
+	parseCommand(fs, config, args)
+	routes, ok := simRoutes[*region]
+	if fs.NArg() > 0 || !ok {
+		if *region != "" && !ok {
+			fmt.Fprintf(os.Stderr, "Unknown region %q\n", *region)
+		}
+		fs.Usage()
+		os.Exit(2)
+	}
+	loadSettings()
+	if err := loadSecretsFromEnv(); err != nil {
+		fatal("Secrets", "err", err)
+	}
+	apiKey := getSecret("ANTHROPIC_API_KEY")
+	if apiKey == "" {
+		fatal("ANTHROPIC_API_KEY not configured")
+	}
+
+	data := simulatedAirspace(*region, routes, time.Now())
+	analysis, err := callAnthropicAnalysis(context.Background(), apiKey, *region, data.Aircraft)
+	if err != nil {
+		fatal("AI analysis failed", "region", *region, "err", err)
+	}
+	if *save {
+		h, err := OpenAnalysisHistory(dataDirFromEnv())
+		if err == nil {
+			err = h.Save(analysis)
+			h.Close()
+		}
+		if err != nil {
+			fatal("Failed to record analysis", "region", *region, "err", err)
+		}
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(analysis)
+}
+
+func cmdValidateConfig(args []string) {
+	fs, config := newCommand("validate-config", "validate-config [-config FILE]")
+	parseCommand(fs, config, args)
+	if fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	loadSettings()
+
+	// Print where each setting comes from, but not its value: many are secrets.
+	var set []string
+	for _, s := range configSchema {
+		switch {
+		case envOverrides[s.env]:
+			set = append(set, fmt.Sprintf("  %-34s %-28s environment", s.key, s.env))
+		case configValues[s.env] != "":
+			set = append(set, fmt.Sprintf("  %-34s %-28s %s", s.key, s.env, configPath))
+		case os.Getenv(s.env) != "":
+			set = append(set, fmt.Sprintf("  %-34s %-28s environment", s.key, s.env))
+		}
+	}
+	sort.Strings(set)
+	if configPath != "" {
+		fmt.Printf("%s is valid.\n", configPath)
+	} else {
+		fmt.Println("No config file (set CONFIG_FILE or -config); checked the environment only.")
+	}
+	if len(set) == 0 {
+		fmt.Println("No settings configured; defaults apply.")
+		return
+	}
+	fmt.Println("Settings:")
+	fmt.Println(strings.Join(set, "\n"))
+}
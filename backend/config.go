@@ -0,0 +1,505 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The config file (CONFIG_FILE) groups the environment variables into YAML
+// sections, e.g.
+//
+//	server:
+//	  port: 8080
+//	analysis:
+//	  interval: 45s
+//	notifiers:
+//	  webhook_urls: [https://hooks.example.com/swarm]
+//
+// Each setting maps onto the environment variable in configSchema, so the
+// rest of the backend keeps reading the environment. A variable that is
+// already set wins over the file. Settings with a reload hook are re-applied
+// on SIGHUP or when the file changes; the rest need a restart.
+
+type settingKind int
+
+const (
+	kindString settingKind = iota
+	kindInt
+	kindFloat
+	kindBool
+	kindDuration
+	kindList // YAML sequence or comma-separated string
+	kindJSON // YAML structure, passed on as JSON
+)
+
+type configSetting struct {
+	key    string // section.key in the file
+	env    string
+	kind   settingKind
+	reload func() error // non-nil for settings that apply without a restart
+}
+
+var configSchema = []configSetting{
+	{key: "server.port", env: "PORT", kind: kindInt},
+	{key: "server.data_dir", env: "DATA_DIR"},
+	{key: "server.poll_interval", env: "POLL_INTERVAL", kind: kindDuration, reload: pollInterval.load},
+	{key: "server.shutdown_timeout", env: "SHUTDOWN_TIMEOUT", kind: kindDuration},
+	{key: "server.debug_addr", env: "DEBUG_ADDR"},
+	{key: "server.static_dir", env: "STATIC_DIR"},
+
+	{key: "opensky.source", env: "AIRCRAFT_SOURCE"},
+	{key: "opensky.client_id", env: "OPENSKY_CLIENT_ID"},
+	{key: "opensky.client_secret", env: "OPENSKY_CLIENT_SECRET"},
+	{key: "opensky.username", env: "OPENSKY_USERNAME"},
+	{key: "opensky.password", env: "OPENSKY_PASSWORD"},
+	{key: "opensky.url", env: "OPENSKY_URL"},
+	{key: "opensky.token_url", env: "OPENSKY_TOKEN_URL"},
+	{key: "opensky.mock", env: "MOCK_OPENSKY", kind: kindBool},
+	{key: "opensky.mock_addr", env: "MOCK_OPENSKY_ADDR"},
+	{key: "opensky.mock_states", env: "MOCK_OPENSKY_STATES"},
+	{key: "opensky.mock_faults", env: "MOCK_OPENSKY_FAULTS"},
+	{key: "opensky.mock_seed", env: "MOCK_OPENSKY_SEED", kind: kindInt},
+	{key: "scenario.file", env: "SCENARIO_FILE"},
+	{key: "recording.dir", env: "RECORD_DIR"},
+
+	{key: "log.level", env: "LOG_LEVEL", reload: loadLogLevel},
+	{key: "log.format", env: "LOG_FORMAT"},
+	{key: "log.file", env: "LOG_FILE"},
+	{key: "log.sentry_dsn", env: "SENTRY_DSN"},
+	{key: "log.sentry_environment", env: "SENTRY_ENVIRONMENT"},
+	{key: "log.access", env: "ACCESS_LOG", kind: kindBool, reload: loadAccessLog},
+	{key: "log.slow_request", env: "SLOW_REQUEST", kind: kindDuration, reload: slowRequest.load},
+
+	{key: "tracing.otlp_endpoint", env: "OTEL_EXPORTER_OTLP_ENDPOINT"},
+	{key: "tracing.otlp_headers", env: "OTEL_EXPORTER_OTLP_HEADERS"},
+	{key: "tracing.service_name", env: "OTEL_SERVICE_NAME"},
+
+	{key: "cluster.redis_url", env: "LEADER_REDIS_URL"},
+	{key: "cluster.lease", env: "LEADER_LEASE", kind: kindDuration},
+	{key: "cluster.key_prefix", env: "LEADER_KEY_PREFIX"},
+	{key: "cluster.instance_id", env: "INSTANCE_ID"},
+
+	{key: "tls.cert_file", env: "TLS_CERT_FILE"},
+	{key: "tls.key_file", env: "TLS_KEY_FILE"},
+	{key: "tls.autocert_domains", env: "TLS_AUTOCERT_DOMAINS", kind: kindList},
+	{key: "tls.autocert_email", env: "TLS_AUTOCERT_EMAIL"},
+	{key: "tls.http_redirect_addr", env: "HTTP_REDIRECT_ADDR"},
+
+	{key: "mtls.addr", env: "MTLS_ADDR"},
+	{key: "mtls.client_ca", env: "MTLS_CLIENT_CA"},
+	{key: "mtls.clients", env: "MTLS_CLIENTS", kind: kindList},
+	{key: "mtls.cert_file", env: "MTLS_CERT_FILE"},
+	{key: "mtls.key_file", env: "MTLS_KEY_FILE"},
+
+	{key: "network.cors_origins", env: "CORS_ORIGINS", kind: kindList},
+	{key: "network.ip_allow", env: "IP_ALLOW", kind: kindList},
+	{key: "network.ip_deny", env: "IP_DENY", kind: kindList},
+	{key: "network.trusted_proxies", env: "TRUSTED_PROXIES", kind: kindList},
+	{key: "network.rate_limit", env: "RATE_LIMIT"},
+	{key: "network.analyze_rate_limit", env: "ANALYZE_RATE_LIMIT"},
+	{key: "network.login_rate_limit", env: "LOGIN_RATE_LIMIT"},
+
+	{key: "auth.api_keys", env: "API_KEYS", kind: kindList},
+	{key: "auth.api_keys_file", env: "API_KEYS_FILE"},
+	{key: "auth.workspaces", env: "WORKSPACES", kind: kindJSON},
+	{key: "auth.workspaces_file", env: "WORKSPACES_FILE"},
+	{key: "auth.jwt_secret", env: "JWT_SECRET"},
+	{key: "auth.jwt_ttl", env: "JWT_TTL", kind: kindDuration},
+	{key: "auth.refresh_ttl", env: "REFRESH_TTL", kind: kindDuration},
+	{key: "auth.admin_username", env: "ADMIN_USERNAME"},
+	{key: "auth.admin_password", env: "ADMIN_PASSWORD"},
+	{key: "auth.ws_idle_timeout", env: "WS_IDLE_TIMEOUT", kind: kindDuration},
+
+	{key: "vault.addr", env: "VAULT_ADDR"},
+	{key: "vault.token", env: "VAULT_TOKEN"},
+	{key: "vault.token_file", env: "VAULT_TOKEN_FILE"},
+	{key: "vault.secret_path", env: "VAULT_SECRET_PATH"},
+	{key: "vault.refresh", env: "VAULT_REFRESH", kind: kindDuration},
+
+	{key: "analysis.anthropic_api_key", env: "ANTHROPIC_API_KEY"},
+	{key: "analysis.interval", env: "ANALYSIS_INTERVAL", kind: kindDuration, reload: analysisInterval.load},
+	{key: "analysis.prompt_file", env: "ANALYSIS_PROMPT_FILE", reload: loadAnalysisPrompt},
+	{key: "analysis.locale", env: "ANALYSIS_LOCALE", kind: kindList, reload: loadAnalysisLocale},
+	{key: "features.flags", env: "FEATURE_FLAGS", kind: kindList, reload: loadFeatureFlags},
+	{key: "analysis.threat_thresholds", env: "THREAT_THRESHOLDS"},
+	{key: "analysis.threat_smoothing", env: "THREAT_SMOOTHING", kind: kindFloat},
+	{key: "analysis.threat_hysteresis", env: "THREAT_HYSTERESIS", kind: kindFloat},
+	{key: "analysis.plugins", env: "ANALYZER_PLUGINS", kind: kindJSON},
+	{key: "analysis.plugins_file", env: "ANALYZER_PLUGINS_FILE"},
+	{key: "scripts.dir", env: "SCRIPTS_DIR"},
+	{key: "scripts.timeout", env: "SCRIPT_TIMEOUT", kind: kindDuration},
+
+	{key: "history.position_interval", env: "POSITION_HISTORY_INTERVAL", kind: kindDuration},
+	{key: "history.position_retention", env: "POSITION_RETENTION", kind: kindDuration},
+	{key: "history.metrics_retention", env: "METRICS_RETENTION", kind: kindDuration},
+	{key: "reports.times", env: "REPORT_TIMES", kind: kindList},
+	{key: "reports.period", env: "REPORT_PERIOD", kind: kindDuration},
+	{key: "reports.formats", env: "REPORT_FORMATS", kind: kindList},
+	{key: "reports.email_to", env: "REPORT_EMAIL_TO", kind: kindList},
+	{key: "tiles.url", env: "TILE_URL"},
+	{key: "tiles.api_key", env: "TILE_API_KEY"},
+	{key: "tiles.subdomains", env: "TILE_SUBDOMAINS"},
+	{key: "tiles.max_zoom", env: "TILE_MAX_ZOOM", kind: kindInt},
+	{key: "tiles.cache_ttl", env: "TILE_CACHE_TTL", kind: kindDuration},
+	{key: "tiles.cache_max_mb", env: "TILE_CACHE_MAX_MB", kind: kindInt},
+	{key: "tiles.rate_limit", env: "TILE_RATE_LIMIT"},
+
+	{key: "alerts.incident_min_severity", env: "INCIDENT_MIN_SEVERITY"},
+	{key: "alerts.cooldown", env: "ALERT_COOLDOWN", kind: kindDuration},
+	{key: "alerts.auto_resolve", env: "ALERT_AUTO_RESOLVE", kind: kindDuration},
+	{key: "alerts.routes", env: "ALERT_ROUTES", kind: kindJSON},
+	{key: "alerts.routes_file", env: "ALERT_ROUTES_FILE"},
+	{key: "alerts.zones_file", env: "ZONES_FILE"},
+	{key: "alerts.lost_contact_after", env: "LOST_CONTACT_AFTER", kind: kindDuration},
+	{key: "alerts.patrol_callsigns", env: "PATROL_CALLSIGNS", kind: kindList},
+	{key: "alerts.military_contact_severity", env: "MILITARY_CONTACT_SEVERITY"},
+	{key: "tracks.manual_ttl", env: "MANUAL_TRACK_TTL", kind: kindDuration},
+
+	{key: "notifiers.pagerduty_routing_key", env: "PAGERDUTY_ROUTING_KEY"},
+	{key: "notifiers.opsgenie_api_key", env: "OPSGENIE_API_KEY"},
+	{key: "notifiers.opsgenie_api_url", env: "OPSGENIE_API_URL"},
+	{key: "notifiers.slack_webhook_url", env: "SLACK_WEBHOOK_URL"},
+	{key: "notifiers.webhook_urls", env: "WEBHOOK_URLS", kind: kindList},
+	{key: "notifiers.webhook_secrets", env: "WEBHOOK_SECRETS", kind: kindList},
+	{key: "notifiers.twilio_account_sid", env: "TWILIO_ACCOUNT_SID"},
+	{key: "notifiers.twilio_auth_token", env: "TWILIO_AUTH_TOKEN"},
+	{key: "notifiers.twilio_from", env: "TWILIO_FROM"},
+	{key: "notifiers.sms_to", env: "SMS_TO", kind: kindList},
+	{key: "notifiers.smtp_host", env: "SMTP_HOST"},
+	{key: "notifiers.smtp_port", env: "SMTP_PORT", kind: kindInt},
+	{key: "notifiers.smtp_username", env: "SMTP_USERNAME"},
+	{key: "notifiers.smtp_password", env: "SMTP_PASSWORD"},
+	{key: "notifiers.smtp_from", env: "SMTP_FROM"},
+	{key: "notifiers.email_to", env: "EMAIL_TO", kind: kindList},
+	{key: "notifiers.vapid_public_key", env: "VAPID_PUBLIC_KEY"},
+	{key: "notifiers.vapid_private_key", env: "VAPID_PRIVATE_KEY"},
+	{key: "notifiers.vapid_subject", env: "VAPID_SUBJECT"},
+	{key: "notifiers.push_service_hosts", env: "PUSH_SERVICE_HOSTS", kind: kindList},
+	{key: "tts.engine", env: "TTS_ENGINE"},
+	{key: "tts.openai_api_key", env: "OPENAI_API_KEY"},
+	{key: "tts.model", env: "TTS_MODEL"},
+	{key: "tts.voice", env: "TTS_VOICE"},
+	{key: "tts.command", env: "TTS_COMMAND"},
+	{key: "tts.min_severity", env: "TTS_MIN_SEVERITY"},
+	{key: "tts.stream", env: "TTS_STREAM", kind: kindBool},
+	{key: "tts.timeout", env: "TTS_TIMEOUT", kind: kindDuration},
+	{key: "tts.retention", env: "TTS_RETENTION", kind: kindDuration},
+
+	{key: "feeds.tar1090_region", env: "TAR1090_REGION"},
+	{key: "feeds.sbs_listen", env: "SBS_LISTEN"},
+	{key: "feeds.cot_urls", env: "COT_URLS", kind: kindList},
+	{key: "feeds.cot_stale", env: "COT_STALE", kind: kindDuration},
+	{key: "feeds.cot_tls_ca", env: "COT_TLS_CA"},
+	{key: "feeds.cot_tls_cert", env: "COT_TLS_CERT"},
+	{key: "feeds.cot_tls_key", env: "COT_TLS_KEY"},
+	{key: "feeds.asterix_destinations", env: "ASTERIX_DESTINATIONS", kind: kindList},
+	{key: "feeds.asterix_sac", env: "ASTERIX_SAC", kind: kindInt},
+	{key: "feeds.asterix_sic", env: "ASTERIX_SIC", kind: kindInt},
+	{key: "feeds.asterix_interval", env: "ASTERIX_INTERVAL", kind: kindDuration},
+	{key: "feeds.mavlink_outputs", env: "MAVLINK_OUTPUTS", kind: kindList},
+	{key: "feeds.mavlink_regions", env: "MAVLINK_REGIONS", kind: kindList},
+	{key: "feeds.mavlink_system_id", env: "MAVLINK_SYSTEM_ID", kind: kindInt},
+	{key: "feeds.data_push_urls", env: "DATA_PUSH_URLS", kind: kindList},
+	{key: "feeds.data_push_headers", env: "DATA_PUSH_HEADERS"},
+	{key: "feeds.data_push_gzip", env: "DATA_PUSH_GZIP", kind: kindBool},
+	{key: "feeds.data_push_retries", env: "DATA_PUSH_RETRIES", kind: kindInt},
+	{key: "feeds.data_push_timeout", env: "DATA_PUSH_TIMEOUT", kind: kindDuration},
+	{key: "feeds.data_push_secrets", env: "DATA_PUSH_SECRETS", kind: kindList},
+
+	{key: "tasking.drones", env: "TASKING_DRONES", kind: kindList},
+	{key: "tasking.mqtt_url", env: "TASKING_MQTT_URL"},
+	{key: "tasking.mqtt_topic", env: "TASKING_MQTT_TOPIC"},
+	{key: "tasking.ack_timeout", env: "TASKING_ACK_TIMEOUT", kind: kindDuration},
+}
+
+var (
+	configPath   string
+	configValues map[string]string // env name -> value from the file
+	envOverrides map[string]bool   // variables set in the environment at startup
+)
+
+// loadConfigFile applies CONFIG_FILE, if set, to the environment. Call it
+// first thing in main, before anything reads its settings.
+func loadConfigFile() error {
+	configPath = os.Getenv("CONFIG_FILE")
+	if configPath == "" {
+		return nil
+	}
+	values, err := readConfigFile(configPath)
+	if err != nil {
+		return err
+	}
+	envOverrides = make(map[string]bool)
+	for _, s := range configSchema {
+		if _, ok := os.LookupEnv(s.env); ok {
+			envOverrides[s.env] = true
+		}
+	}
+	for env, v := range values {
+		if !envOverrides[env] {
+			os.Setenv(env, v)
+		}
+	}
+	configValues = values
+	return nil
+}
+
+// readConfigFile parses and validates a config file into environment values.
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	values := make(map[string]string)
+	if len(doc.Content) == 0 {
+		return values, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s:%d: expected sections of settings", path, root.Line)
+	}
+
+	byKey := make(map[string]configSetting, len(configSchema))
+	for _, s := range configSchema {
+		byKey[s.key] = s
+	}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		section, body := root.Content[i], root.Content[i+1]
+		if body.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("%s:%d: %s: expected a section of settings", path, body.Line, section.Value)
+		}
+		for j := 0; j+1 < len(body.Content); j += 2 {
+			name, node := body.Content[j], body.Content[j+1]
+			key := section.Value + "." + name.Value
+			s, ok := byKey[key]
+			if !ok {
+				return nil, fmt.Errorf("%s:%d: unknown setting %s", path, name.Line, key)
+			}
+			if node.Tag == "!!null" {
+				continue
+			}
+			v, err := settingValue(s, node)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %s: %w", path, node.Line, key, err)
+			}
+			values[s.env] = v
+		}
+	}
+	return values, nil
+}
+
+// settingValue validates a YAML value against its setting's kind and
+// renders it the way the environment variable expects.
+func settingValue(s configSetting, node *yaml.Node) (string, error) {
+	switch {
+	case s.kind == kindJSON && node.Kind != yaml.ScalarNode:
+		var v interface{}
+		if err := node.Decode(&v); err != nil {
+			return "", err
+		}
+		b, err := json.Marshal(v)
+		return string(b), err
+	case s.kind == kindList && node.Kind == yaml.SequenceNode:
+		items := make([]string, 0, len(node.Content))
+		for _, item := range node.Content {
+			if item.Kind != yaml.ScalarNode {
+				return "", fmt.Errorf("expected a list of values")
+			}
+			items = append(items, item.Value)
+		}
+		return strings.Join(items, ","), nil
+	case node.Kind != yaml.ScalarNode:
+		return "", fmt.Errorf("expected a single value")
+	}
+
+	v := node.Value
+	var err error
+	switch s.kind {
+	case kindInt:
+		_, err = strconv.Atoi(v)
+	case kindFloat:
+		_, err = strconv.ParseFloat(v, 64)
+	case kindBool:
+		_, err = strconv.ParseBool(v)
+	case kindDuration:
+		_, err = time.ParseDuration(v)
+	}
+	if err != nil {
+		return "", fmt.Errorf("invalid value %q", v)
+	}
+	return v, nil
+}
+
+// watchConfig reloads the config file on SIGHUP or when it changes. It
+// blocks, so run it in a goroutine.
+func watchConfig() {
+	if configPath == "" {
+		return
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	modTime := configModTime()
+	for {
+		select {
+		case <-hup:
+			modTime = configModTime()
+			reloadConfig("SIGHUP")
+		case <-ticker.C:
+			if t := configModTime(); !t.Equal(modTime) {
+				modTime = t
+				reloadConfig("file changed")
+			}
+		}
+	}
+}
+
+func configModTime() time.Time {
+	info, err := os.Stat(configPath)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// reloadConfig re-applies reloadable settings that changed in the file.
+// An invalid file is ignored as a whole, and a setting whose reload hook
+// fails keeps its previous value.
+func reloadConfig(reason string) {
+	values, err := readConfigFile(configPath)
+	if err != nil {
+		serverLog.Warn("Config reload failed, keeping current settings", "reason", reason, "err", err)
+		return
+	}
+	var applied, restart []string
+	for _, s := range configSchema {
+		old, had := configValues[s.env]
+		v, has := values[s.env]
+		if old == v && had == has || envOverrides[s.env] {
+			continue
+		}
+		if s.reload == nil {
+			restart = append(restart, s.key)
+			continue
+		}
+		setOrUnsetEnv(s.env, v, has)
+		if err := s.reload(); err != nil {
+			serverLog.Warn("Config reload: setting not applied", "setting", s.key, "err", err)
+			setOrUnsetEnv(s.env, old, had)
+			s.reload()
+			values[s.env] = old
+			if !had {
+				delete(values, s.env)
+			}
+			continue
+		}
+		applied = append(applied, s.key)
+	}
+	configValues = values
+
+	if len(applied) > 0 {
+		serverLog.Info("Config reloaded", "reason", reason, "settings", applied)
+	}
+	if len(restart) > 0 {
+		serverLog.Warn("Config changed but needs a restart", "reason", reason, "settings", restart)
+	}
+}
+
+func setOrUnsetEnv(name, value string, set bool) {
+	if set {
+		os.Setenv(name, value)
+	} else {
+		os.Unsetenv(name)
+	}
+}
+
+// loadReloadableSettings reads the settings that config reloads can change.
+func loadReloadableSettings() error {
+	for _, s := range configSchema {
+		if s.reload != nil {
+			if err := s.reload(); err != nil {
+				return fmt.Errorf("%s: %w", s.env, err)
+			}
+		}
+	}
+	return nil
+}
+
+// reloadableDuration is a duration setting that may change while
+// goroutines are reading it.
+type reloadableDuration struct {
+	env string
+	def time.Duration
+	v   atomic.Int64
+}
+
+func newReloadableDuration(env string, def time.Duration) *reloadableDuration {
+	d := &reloadableDuration{env: env, def: def}
+	d.v.Store(int64(def))
+	return d
+}
+
+func (d *reloadableDuration) Get() time.Duration { return time.Duration(d.v.Load()) }
+
+func (d *reloadableDuration) load() error {
+	v := os.Getenv(d.env)
+	if v == "" {
+		d.v.Store(int64(d.def))
+		return nil
+	}
+	dur, err := time.ParseDuration(v)
+	if err != nil || dur <= 0 {
+		return fmt.Errorf("invalid duration %q", v)
+	}
+	d.v.Store(int64(dur))
+	return nil
+}
+
+var (
+	// pollInterval is how often each region's air picture is refreshed.
+	pollInterval = newReloadableDuration("POLL_INTERVAL", 2*time.Second)
+
+	// analysisInterval is how often SENTINEL analyzes each region.
+	analysisInterval = newReloadableDuration("ANALYSIS_INTERVAL", 30*time.Second)
+
+	analysisPrompt atomic.Pointer[string]
+)
+
+// loadAnalysisPrompt reads SENTINEL's system prompt from
+// ANALYSIS_PROMPT_FILE, or uses the built-in one when unset.
+func loadAnalysisPrompt() error {
+	prompt := TACTICAL_SYSTEM_PROMPT
+	if path := os.Getenv("ANALYSIS_PROMPT_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("read prompt: %w", err)
+		}
+		if prompt = strings.TrimSpace(string(data)); prompt == "" {
+			return fmt.Errorf("%s is empty", path)
+		}
+	}
+	analysisPrompt.Store(&prompt)
+	return nil
+}
+
+func systemPrompt() string {
+	if p := analysisPrompt.Load(); p != nil {
+		return *p
+	}
+	return TACTICAL_SYSTEM_PROMPT
+}
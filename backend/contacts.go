@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+var (
+	// patrolCallsigns are known routine patrols whose appearance is not news.
+	// Entries ending in "*" match as prefixes. Set with PATROL_CALLSIGNS.
+	patrolCallsigns []string
+
+	// militaryContactSeverity is the alert severity for a new military contact.
+	militaryContactSeverity = "HIGH"
+)
+
+// loadContactConfigFromEnv reads PATROL_CALLSIGNS (comma-separated) and
+// MILITARY_CONTACT_SEVERITY.
+func loadContactConfigFromEnv() {
+	for _, cs := range strings.Split(os.Getenv("PATROL_CALLSIGNS"), ",") {
+		if cs = strings.TrimSpace(cs); cs != "" {
+			patrolCallsigns = append(patrolCallsigns, strings.ToUpper(cs))
+		}
+	}
+	if sev := strings.ToUpper(os.Getenv("MILITARY_CONTACT_SEVERITY")); threatRank[sev] > 0 {
+		militaryContactSeverity = sev
+	}
+}
+
+// isPatrolCallsign reports whether an aircraft is a known routine patrol.
+func isPatrolCallsign(ac Aircraft) bool {
+	callsign := strings.ToUpper(strings.TrimSpace(ac.Callsign))
+	for _, p := range patrolCallsigns {
+		if callsignMatches(p, callsign) {
+			return true
+		}
+	}
+	return false
+}
+
+// evaluateNewContacts raises a new-contact alert for each newly appeared
+// aircraft that is watchlisted or classified military. Watchlist matches
+// always alert; military contacts on a known patrol callsign are suppressed.
+func evaluateNewContacts(region string, newContacts []Aircraft) {
+	for _, ac := range newContacts {
+		evaluateWorkspaceContact(region, ac)
+		entry, watchlisted := watchlist.Match(ac)
+		military, reason := classifyMilitary(ac)
+		if !watchlisted && (!military || isPatrolCallsign(ac)) {
+			continue
+		}
+
+		severity := militaryContactSeverity
+		details := aircraftDetails(ac)
+
+		var message string
+		if watchlisted {
+			severity = entry.Severity
+			details["watchlistId"] = entry.ID
+			details["watchlistNote"] = entry.Note
+			message = "Watchlisted aircraft appeared"
+			if entry.Note != "" {
+				message += ": " + entry.Note
+			}
+		}
+		if military {
+			details["military"] = true
+			details["classification"] = reason
+			if message == "" {
+				message = "Military aircraft appeared (" + reason + ")"
+			}
+		}
+
+		alertMgr.Raise(Alert{
+			Key:      fmt.Sprintf("new_contact:%s:%s", region, ac.ICAO24),
+			Kind:     "new_contact",
+			Region:   region,
+			Severity: severity,
+			Title:    fmt.Sprintf("New contact %s in %s", displayCallsign(ac), region),
+			Message:  message,
+			ICAO24:   ac.ICAO24,
+			Callsign: strings.TrimSpace(ac.Callsign),
+			Details:  details,
+		})
+	}
+}
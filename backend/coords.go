@@ -0,0 +1,466 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Coordinate formats a client can ask for alongside latitude and longitude.
+const (
+	coordDD   = "dd"   // decimal degrees, "33.50000, -118.00000"
+	coordDMS  = "dms"  // degrees, minutes, seconds, `33°30'00.0"N 118°00'00.0"W`
+	coordMGRS = "mgrs" // Military Grid Reference System, "11S LT 96334 06859"
+)
+
+var coordFormats = []string{coordDD, coordDMS, coordMGRS}
+
+// Coords is a position written out in the formats a client asked for.
+type Coords struct {
+	DD   string `json:"dd,omitempty"`
+	DMS  string `json:"dms,omitempty"`
+	MGRS string `json:"mgrs,omitempty"` // empty beyond 80°S and 84°N, where UPS applies
+}
+
+// parseCoordFormats reads a comma-separated list of coordinate formats, as
+// given in coords=.
+func parseCoordFormats(v string) ([]string, error) {
+	var out []string
+	for _, f := range splitList(strings.ToLower(v)) {
+		known := false
+		for _, c := range coordFormats {
+			known = known || f == c
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown coordinate format %q (want dd, dms, or mgrs)", f)
+		}
+		out = append(out, f)
+	}
+	return out, nil
+}
+
+// formatCoords writes a position in each of the given formats.
+func formatCoords(lat, lon float64, formats []string) *Coords {
+	c := &Coords{}
+	for _, f := range formats {
+		switch f {
+		case coordDD:
+			c.DD = formatDD(lat, lon)
+		case coordDMS:
+			c.DMS = formatDMS(lat, lon)
+		case coordMGRS:
+			c.MGRS, _ = formatMGRS(lat, lon, 5)
+		}
+	}
+	return c
+}
+
+// withCoords returns a copy of a picture whose positioned aircraft carry
+// their coordinates in the given formats. The cached picture is shared, so
+// it is never changed in place.
+func withCoords(data *AirspaceData, formats []string) *AirspaceData {
+	out := *data
+	out.Aircraft = make([]Aircraft, len(data.Aircraft))
+	for i, ac := range data.Aircraft {
+		if ac.Latitude != nil && ac.Longitude != nil {
+			ac.Coords = formatCoords(*ac.Latitude, *ac.Longitude, formats)
+		}
+		out.Aircraft[i] = ac
+	}
+	return &out
+}
+
+func formatDD(lat, lon float64) string {
+	return fmt.Sprintf("%.5f, %.5f", lat, lon)
+}
+
+// formatDMS writes a position as degrees, minutes, and seconds to a tenth
+// of a second (about 3 m).
+func formatDMS(lat, lon float64) string {
+	part := func(v float64, pos, neg string, width int) string {
+		hemi := pos
+		if v < 0 {
+			hemi, v = neg, -v
+		}
+		tenths := int64(math.Round(v * 36000)) // tenths of a second
+		deg, rest := tenths/36000, tenths%36000
+		return fmt.Sprintf("%0*d°%02d'%04.1f\"%s", width, deg, rest/600, float64(rest%600)/10, hemi)
+	}
+	return part(lat, "N", "S", 2) + " " + part(lon, "E", "W", 3)
+}
+
+// WGS 84 and the UTM projection.
+const (
+	wgs84A  = 6378137.0
+	wgs84F  = 1 / 298.257223563
+	utmK0   = 0.9996
+	utmE0   = 500000.0   // false easting
+	utmN0S  = 10000000.0 // false northing, southern hemisphere
+	mgrsMin = -80.0
+	mgrsMax = 84.0
+)
+
+const (
+	mgrsBands   = "CDEFGHJKLMNPQRSTUVWX"     // 8° latitude bands from 80°S; X is 12°
+	mgrsColumns = "ABCDEFGHJKLMNPQRSTUVWXYZ" // 100 km columns, 8 per zone in three sets
+	mgrsRows    = "ABCDEFGHJKLMNPQRSTUV"     // 100 km rows, repeating every 2,000 km
+)
+
+// utmZone picks the zone for a position, including the widened zones over
+// southwest Norway and Svalbard.
+func utmZone(lat, lon float64) int {
+	zone := int(math.Floor((lon+180)/6)) + 1
+	if zone > 60 {
+		zone = 60
+	}
+	switch {
+	case lat >= 56 && lat < 64 && lon >= 3 && lon < 12:
+		zone = 32
+	case lat >= 72 && lat <= 84 && lon >= 0 && lon < 9:
+		zone = 31
+	case lat >= 72 && lat <= 84 && lon >= 9 && lon < 21:
+		zone = 33
+	case lat >= 72 && lat <= 84 && lon >= 21 && lon < 33:
+		zone = 35
+	case lat >= 72 && lat <= 84 && lon >= 33 && lon < 42:
+		zone = 37
+	}
+	return zone
+}
+
+func utmMeridian(zone int) float64 { return float64(zone)*6 - 183 }
+
+// meridionalArc is the distance from the equator to latitude phi (radians)
+// along a meridian.
+func meridionalArc(phi float64) float64 {
+	e2 := wgs84F * (2 - wgs84F)
+	e4, e6 := e2*e2, e2*e2*e2
+	return wgs84A * ((1-e2/4-3*e4/64-5*e6/256)*phi -
+		(3*e2/8+3*e4/32+45*e6/1024)*math.Sin(2*phi) +
+		(15*e4/256+45*e6/1024)*math.Sin(4*phi) -
+		(35*e6/3072)*math.Sin(6*phi))
+}
+
+// toUTM projects a position into the given zone (Snyder's series, good to
+// well under a metre within a zone).
+func toUTM(lat, lon float64, zone int) (easting, northing float64) {
+	e2 := wgs84F * (2 - wgs84F)
+	ep2 := e2 / (1 - e2)
+	phi := lat * math.Pi / 180
+	sin, cos, tan := math.Sin(phi), math.Cos(phi), math.Tan(phi)
+	n := wgs84A / math.Sqrt(1-e2*sin*sin)
+	t := tan * tan
+	c := ep2 * cos * cos
+	a := cos * (lon - utmMeridian(zone)) * math.Pi / 180
+
+	easting = utmE0 + utmK0*n*(a+(1-t+c)*math.Pow(a, 3)/6+(5-18*t+t*t+72*c-58*ep2)*math.Pow(a, 5)/120)
+	northing = utmK0 * (meridionalArc(phi) + n*tan*(a*a/2+(5-t+9*c+4*c*c)*math.Pow(a, 4)/24+(61-58*t+t*t+600*c-330*ep2)*math.Pow(a, 6)/720))
+	if lat < 0 {
+		northing += utmN0S
+	}
+	return easting, northing
+}
+
+// fromUTM is the inverse of toUTM.
+func fromUTM(easting, northing float64, zone int, south bool) (lat, lon float64) {
+	e2 := wgs84F * (2 - wgs84F)
+	ep2 := e2 / (1 - e2)
+	if south {
+		northing -= utmN0S
+	}
+	m := northing / utmK0
+	mu := m / (wgs84A * (1 - e2/4 - 3*e2*e2/64 - 5*e2*e2*e2/256))
+	e1 := (1 - math.Sqrt(1-e2)) / (1 + math.Sqrt(1-e2))
+	phi1 := mu + (3*e1/2-27*math.Pow(e1, 3)/32)*math.Sin(2*mu) +
+		(21*e1*e1/16-55*math.Pow(e1, 4)/32)*math.Sin(4*mu) +
+		(151*math.Pow(e1, 3)/96)*math.Sin(6*mu) +
+		(1097*math.Pow(e1, 4)/512)*math.Sin(8*mu)
+
+	sin, cos, tan := math.Sin(phi1), math.Cos(phi1), math.Tan(phi1)
+	n1 := wgs84A / math.Sqrt(1-e2*sin*sin)
+	t1 := tan * tan
+	c1 := ep2 * cos * cos
+	r1 := wgs84A * (1 - e2) / math.Pow(1-e2*sin*sin, 1.5)
+	d := (easting - utmE0) / (n1 * utmK0)
+
+	phi := phi1 - (n1*tan/r1)*(d*d/2-(5+3*t1+10*c1-4*c1*c1-9*ep2)*math.Pow(d, 4)/24+
+		(61+90*t1+298*c1+45*t1*t1-252*ep2-3*c1*c1)*math.Pow(d, 6)/720)
+	lam := (d - (1+2*t1+c1)*math.Pow(d, 3)/6 + (5-2*c1+28*t1-3*c1*c1+8*ep2+24*t1*t1)*math.Pow(d, 5)/120) / cos
+	return phi * 180 / math.Pi, utmMeridian(zone) + lam*180/math.Pi
+}
+
+// utmPosition projects a position into its own zone. Longitudes are taken
+// into [-180, 180), so 180° is the western edge of zone 1.
+func utmPosition(lat, lon float64) (zone int, easting, northing float64) {
+	lon = math.Mod(lon+540, 360) - 180
+	zone = utmZone(lat, lon)
+	easting, northing = toUTM(lat, lon, zone)
+	return zone, easting, northing
+}
+
+// mgrsBand returns the latitude band letter's index for a latitude.
+func mgrsBand(lat float64) int {
+	return min(int(math.Floor((lat-mgrsMin)/8)), len(mgrsBands)-1)
+}
+
+// mgrsSquare returns the 100 km square letters for a zone and UTM position.
+// Columns cycle through three sets of eight letters by zone; rows repeat
+// every 2,000 km and are offset by five letters in even zones.
+func mgrsSquare(zone int, easting, northing float64) string {
+	set := (zone - 1) % 3
+	col := set*8 + int(easting/100000) - 1
+	row := int(northing/100000) % 20
+	if zone%2 == 0 {
+		row = (row + 5) % 20
+	}
+	return string(mgrsColumns[col]) + string(mgrsRows[row])
+}
+
+// formatMGRS writes a position as an MGRS reference with digits per
+// coordinate (5 is 1 m, 4 is 10 m, down to 1 for 10 km), e.g.
+// "11S LT 96334 06859". The polar regions use UPS, which isn't supported.
+func formatMGRS(lat, lon float64, digits int) (string, error) {
+	if lat < mgrsMin || lat > mgrsMax || math.IsNaN(lat) || math.IsNaN(lon) {
+		return "", errors.New("MGRS covers 80°S to 84°N")
+	}
+	if digits < 1 || digits > 5 {
+		return "", errors.New("MGRS precision must be 1 to 5 digits")
+	}
+	zone, easting, northing := utmPosition(lat, lon)
+	square := mgrsSquare(zone, easting, northing)
+	scale := math.Pow(10, float64(5-digits))
+	e := int(math.Mod(easting, 100000) / scale)
+	n := int(math.Mod(northing, 100000) / scale)
+	return fmt.Sprintf("%d%c %s %0*d %0*d", zone, mgrsBands[mgrsBand(lat)], square, digits, e, digits, n), nil
+}
+
+var mgrsPattern = regexp.MustCompile(`^(\d{1,2})([C-HJ-NP-X])([A-HJ-NP-Z])([A-HJ-NP-V])(\d{0,10})$`)
+
+// parseMGRS reads an MGRS reference, with or without spaces, and returns
+// the south-west corner of the square it names plus half its size, so the
+// centre of a coarse reference is returned rather than its corner.
+func parseMGRS(s string) (lat, lon float64, err error) {
+	m := mgrsPattern.FindStringSubmatch(strings.ToUpper(strings.Join(strings.Fields(s), "")))
+	if m == nil {
+		return 0, 0, errors.New("not an MGRS reference such as 11S LT 96334 06859")
+	}
+	zone, _ := strconv.Atoi(m[1])
+	if zone < 1 || zone > 60 {
+		return 0, 0, fmt.Errorf("zone %d is not 1 to 60", zone)
+	}
+	digits := m[5]
+	if len(digits)%2 != 0 {
+		return 0, 0, errors.New("MGRS easting and northing must have the same number of digits")
+	}
+	band := strings.IndexByte(mgrsBands, m[2][0])
+
+	set := (zone - 1) % 3
+	col := strings.IndexByte(mgrsColumns, m[3][0]) - set*8
+	if col < 0 || col > 7 {
+		return 0, 0, fmt.Errorf("column letter %s is not used in zone %d", m[3], zone)
+	}
+	row := strings.IndexByte(mgrsRows, m[4][0])
+	if zone%2 == 0 {
+		row = (row + 15) % 20
+	}
+
+	half := len(digits) / 2
+	scale := math.Pow(10, float64(5-half))
+	var e, n float64
+	if half > 0 {
+		ev, _ := strconv.Atoi(digits[:half])
+		nv, _ := strconv.Atoi(digits[half:])
+		e, n = float64(ev)*scale, float64(nv)*scale
+	}
+	e += scale / 2
+	n += scale / 2
+	easting := float64(col+1)*100000 + e
+	northing := float64(row)*100000 + n
+
+	// Rows repeat every 2,000 km; the latitude band says which repeat. A
+	// band spans under 1,000 km of northing, starting from its southern edge
+	// on the central meridian.
+	bandLat := mgrsMin + float64(band)*8
+	_, bandNorthing := toUTM(bandLat, utmMeridian(zone), zone)
+	for northing < bandNorthing-100000 {
+		northing += 2000000
+	}
+
+	lat, lon = fromUTM(easting, northing, zone, bandLat < 0)
+	bandTop := bandLat + 8
+	if m[2] == "X" {
+		bandTop = mgrsMax
+	}
+	if lat < bandLat-1 || lat > bandTop+1 {
+		return 0, 0, fmt.Errorf("%s is not in latitude band %s", s, m[2])
+	}
+	return lat, lon, nil
+}
+
+var (
+	ddPattern  = regexp.MustCompile(`^\s*([-+]?\d{1,2}(?:\.\d+)?)\s*[,\s]\s*([-+]?\d{1,3}(?:\.\d+)?)\s*$`)
+	dmsToken   = regexp.MustCompile(`[NSEW]|\d+(?:\.\d+)?`)
+	dmsAllowed = regexp.MustCompile(`^[\s\dNSEW.,°º'′’"″:]*$`)
+)
+
+// parseDD reads "lat, lon" in decimal degrees.
+func parseDD(s string) (lat, lon float64, err error) {
+	m := ddPattern.FindStringSubmatch(s)
+	if m == nil {
+		return 0, 0, errors.New("not a decimal lat, lon pair")
+	}
+	lat, _ = strconv.ParseFloat(m[1], 64)
+	lon, _ = strconv.ParseFloat(m[2], 64)
+	return lat, lon, checkLatLon(lat, lon)
+}
+
+// parseDMS reads degrees with optional minutes and seconds, and a
+// hemisphere letter before or after each half: `33°30'00"N 118°00'00"W`,
+// "N33 30 00 W118 00 00", or "33:30N 118:00W".
+func parseDMS(s string) (lat, lon float64, err error) {
+	s = strings.ToUpper(s)
+	if !dmsAllowed.MatchString(s) {
+		return 0, 0, errors.New("not a degrees-minutes-seconds position")
+	}
+	tokens := dmsToken.FindAllString(s, -1)
+	type part struct {
+		hemi   string
+		values []float64
+	}
+	var parts []part
+	prefix := len(tokens) > 0 && strings.Contains("NSEW", tokens[0])
+	cur := part{}
+	for _, tok := range tokens {
+		if strings.Contains("NSEW", tok) {
+			if prefix {
+				if cur.hemi != "" {
+					parts = append(parts, cur)
+				}
+				cur = part{hemi: tok}
+			} else {
+				cur.hemi = tok
+				parts = append(parts, cur)
+				cur = part{}
+			}
+			continue
+		}
+		v, _ := strconv.ParseFloat(tok, 64)
+		cur.values = append(cur.values, v)
+	}
+	if prefix && cur.hemi != "" {
+		parts = append(parts, cur)
+	} else if len(cur.values) > 0 {
+		return 0, 0, errors.New("every part needs a hemisphere letter (N, S, E, or W)")
+	}
+	if len(parts) != 2 {
+		return 0, 0, errors.New("want a latitude and a longitude, each with a hemisphere letter")
+	}
+
+	var haveLat, haveLon bool
+	for _, p := range parts {
+		if len(p.values) == 0 || len(p.values) > 3 {
+			return 0, 0, errors.New("each part is degrees, optionally minutes and seconds")
+		}
+		v := p.values[0]
+		for i, scale := range []float64{60, 3600} {
+			if len(p.values) > i+1 {
+				if p.values[i+1] >= 60 {
+					return 0, 0, errors.New("minutes and seconds must be below 60")
+				}
+				v += p.values[i+1] / scale
+			}
+		}
+		if p.hemi == "S" || p.hemi == "W" {
+			v = -v
+		}
+		if p.hemi == "N" || p.hemi == "S" {
+			lat, haveLat = v, true
+		} else {
+			lon, haveLon = v, true
+		}
+	}
+	if !haveLat || !haveLon {
+		return 0, 0, errors.New("want one of N/S and one of E/W")
+	}
+	return lat, lon, checkLatLon(lat, lon)
+}
+
+func checkLatLon(lat, lon float64) error {
+	if lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return errors.New("latitude must be -90 to 90 and longitude -180 to 180")
+	}
+	return nil
+}
+
+// parsePosition reads a position in any supported format, trying MGRS,
+// then decimal degrees, then DMS, and says which it was.
+func parsePosition(s string) (lat, lon float64, format string, err error) {
+	if lat, lon, err = parseMGRS(s); err == nil || mgrsPattern.MatchString(strings.ToUpper(strings.Join(strings.Fields(s), ""))) {
+		return lat, lon, coordMGRS, err
+	}
+	if lat, lon, err = parseDD(s); err == nil || ddPattern.MatchString(s) {
+		return lat, lon, coordDD, err
+	}
+	if lat, lon, err = parseDMS(s); err == nil {
+		return lat, lon, coordDMS, nil
+	}
+	return 0, 0, "", fmt.Errorf("%q is not a position in decimal degrees, DMS, or MGRS", s)
+}
+
+// ConvertResult is the body of /api/convert.
+type ConvertResult struct {
+	Input     string  `json:"input"`
+	Format    string  `json:"format"` // format the input was read as
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Coords
+	UTM string `json:"utm,omitempty"` // "11S 396334 3706859"
+}
+
+// handleConvert converts a position between formats.
+// GET /api/convert?q=<position>[&precision=1-5]
+func handleConvert(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	input := strings.TrimSpace(q.Get("q"))
+	if input == "" {
+		http.Error(w, "q is required: decimal degrees, DMS, or MGRS", http.StatusBadRequest)
+		return
+	}
+	digits := 5
+	if v := q.Get("precision"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 5 {
+			http.Error(w, "precision must be 1 to 5 MGRS digits", http.StatusBadRequest)
+			return
+		}
+		digits = n
+	}
+	lat, lon, format, err := parsePosition(input)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	out := ConvertResult{
+		Input:     input,
+		Format:    format,
+		Latitude:  math.Round(lat*1e6) / 1e6,
+		Longitude: math.Round(lon*1e6) / 1e6,
+		Coords:    Coords{DD: formatDD(lat, lon), DMS: formatDMS(lat, lon)},
+	}
+	if mgrs, err := formatMGRS(lat, lon, digits); err == nil {
+		out.MGRS = mgrs
+		zone, e, n := utmPosition(lat, lon)
+		out.UTM = fmt.Sprintf("%d%c %.0f %.0f", zone, mgrsBands[mgrsBand(lat)], math.Floor(e), math.Floor(n))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// The MGRS references were checked against a Krüger-series transverse
+// Mercator (Karney 2011), which gives the published UTM positions of the
+// CN Tower (17T 630084 4833438) and of 0°, 0° (31N 166021.44 0).
+func TestFormatMGRS(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat, lon float64
+		want     string
+	}{
+		{"equator, prime meridian", 0, 0, "31N AA 66021 00000"},
+		{"CN Tower", 43.642567, -79.387139, "17T PJ 30084 33438"},
+		{"Sydney", -33.8568, 151.2153, "56H LH 34900 52288"},
+		{"Rio de Janeiro", -22.9519, -43.2105, "23K PQ 83476 60687"},
+		{"just south of 0°, 0°", -0.0001, -0.0001, "30M ZE 33967 99988"},
+		{"just north of 0°, 0°", 0.0001, 0.0001, "31N AA 66032 00011"},
+
+		// Zone 32V is widened over southwest Norway, from 56°N to 64°N.
+		{"Bergen", 60.39, 5.32, "32V KN 97230 00510"},
+		{"Norway, 56°N 3°E", 56, 3, "32V JH 26049 22336"},
+		{"south of Norway", 55.99, 3.5, "31U EC 31191 05079"},
+		{"north of Norway", 64, 5, "31W EL 97812 98548"},
+		{"west of Norway", 60, 2.99, "31V DG 99442 51411"},
+
+		// Svalbard has zones 31X, 33X, 35X, and 37X only.
+		{"Longyearbyen", 78.2232, 15.6267, "33X WG 14278 83355"},
+		{"Svalbard, below 9°E", 78, 8.99, "31X FG 38795 65473"},
+		{"Svalbard, 9°E", 78, 9, "33X UG 60973 65496"},
+		{"Svalbard, 21°E", 80, 21, "35X LJ 83885 87579"},
+		{"Svalbard, 33°E", 80, 33, "37X CJ 83885 87579"},
+		{"east of Svalbard", 80, 42, "38X MP 41867 83084"},
+		{"band W", 71.99, 10, "32W NE 34507 88103"},
+		{"band X", 72, 10, "33X UV 27724 96086"},
+
+		// The antimeridian: 180°E is 180°W, the western edge of zone 1.
+		{"west of 180°", 10, 179.5, "60P YS 74071 06451"},
+		{"east of 180°", 10, -179.5, "1P BM 25928 06451"},
+		{"180°E", 10, 180, "1P AM 71071 06908"},
+		{"180°W", 10, -180, "1P AM 71071 06908"},
+		{"longitude past 180°", 10, 540, "1P AM 71071 06908"},
+
+		// The limits of MGRS proper; UPS takes over beyond them.
+		{"84°N", 84, 0.5, "31X DP 70833 28726"},
+		{"80°S", -80, -0.5, "30C WS 48449 17373"},
+		{"beyond 84°N", 84.0001, 0, ""},
+		{"beyond 80°S", -80.0001, 0, ""},
+		{"north pole", 90, 0, ""},
+	}
+	for _, tt := range tests {
+		got, err := formatMGRS(tt.lat, tt.lon, 5)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("%s: formatMGRS(%g, %g) = %q, want an error", tt.name, tt.lat, tt.lon, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s: formatMGRS(%g, %g) = %q, %v; want %q", tt.name, tt.lat, tt.lon, got, err, tt.want)
+		}
+	}
+}
+
+func TestFormatMGRSPrecision(t *testing.T) {
+	tests := []struct {
+		digits int
+		want   string
+	}{
+		{5, "17T PJ 30084 33438"},
+		{4, "17T PJ 3008 3343"},
+		{3, "17T PJ 300 334"},
+		{1, "17T PJ 3 3"},
+	}
+	for _, tt := range tests {
+		if got, err := formatMGRS(43.642567, -79.387139, tt.digits); err != nil || got != tt.want {
+			t.Errorf("%d digits: %q, %v; want %q", tt.digits, got, err, tt.want)
+		}
+	}
+	for _, digits := range []int{0, 6} {
+		if _, err := formatMGRS(0, 0, digits); err == nil {
+			t.Errorf("%d digits: no error", digits)
+		}
+	}
+}
+
+func TestParseMGRS(t *testing.T) {
+	// A 1 m reference comes back as the centre of its square, so within a
+	// metre of where it was written from.
+	for _, pos := range [][2]float64{
+		{0.0001, 0.0001}, {-0.0001, -0.0001}, {43.642567, -79.387139},
+		{-33.8568, 151.2153}, {-22.9519, -43.2105}, {60.39, 5.32},
+		{78.2232, 15.6267}, {72, 10}, {84, 0.5}, {-80, -0.5}, {10, 179.5}, {10, -179.5},
+	} {
+		ref, err := formatMGRS(pos[0], pos[1], 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lat, lon, err := parseMGRS(ref)
+		if err != nil || greatCircleDistance(lat, lon, pos[0], pos[1]) > 1 {
+			t.Errorf("parseMGRS(%q) = %.6f, %.6f, %v; want %g, %g", ref, lat, lon, err, pos[0], pos[1])
+		}
+	}
+
+	// Coarse references give the centre of the square, and spacing and
+	// case don't matter.
+	for _, ref := range []string{"17T PJ 3 3", "17tpj33", " 17T  PJ 35000 35000 "} {
+		lat, lon, err := parseMGRS(ref)
+		if err != nil || greatCircleDistance(lat, lon, 43.655744, -79.325826) > 1 {
+			t.Errorf("parseMGRS(%q) = %.6f, %.6f, %v; want 17T 635000 4835000, about 43.655744, -79.325826", ref, lat, lon, err)
+		}
+	}
+
+	for _, ref := range []string{
+		"",
+		"17T PJ 3008 334",     // uneven digits
+		"61N AA 00000 00000",  // no zone 61
+		"31N JA 00000 00000",  // zone 31 uses columns A to H
+		"17I PJ 30084 33438",  // I isn't a band letter
+		"17T PJ 30084 33438X", // trailing junk
+		"17C PJ 30084 33438",  // PJ in zone 17 is nowhere near band C
+	} {
+		if lat, lon, err := parseMGRS(ref); err == nil {
+			t.Errorf("parseMGRS(%q) = %g, %g; want an error", ref, lat, lon)
+		}
+	}
+}
+
+func TestFormatDMS(t *testing.T) {
+	tests := []struct {
+		lat, lon float64
+		want     string
+	}{
+		{33.5, -118, `33°30'00.0"N 118°00'00.0"W`},
+		{-33.8568, 151.2153, `33°51'24.5"S 151°12'55.1"E`},
+		{12.3456789, 0, `12°20'44.4"N 000°00'00.0"E`},
+		{90, -180, `90°00'00.0"N 180°00'00.0"W`},
+
+		// Rounding to a tenth of a second carries into minutes and degrees
+		// rather than writing 60".
+		{33.999999, -117.999999, `34°00'00.0"N 118°00'00.0"W`},
+		{0.999999, 9.499999, `01°00'00.0"N 009°30'00.0"E`},
+		{-45.99999, 179.99999, `46°00'00.0"S 180°00'00.0"E`},
+		{10 + 59.96/3600, 0, `10°01'00.0"N 000°00'00.0"E`},
+		{10 + 59.94/3600, 0, `10°00'59.9"N 000°00'00.0"E`},
+	}
+	for _, tt := range tests {
+		if got := formatDMS(tt.lat, tt.lon); got != tt.want {
+			t.Errorf("formatDMS(%g, %g) = %s, want %s", tt.lat, tt.lon, got, tt.want)
+		}
+	}
+}
+
+func TestParsePosition(t *testing.T) {
+	tests := []struct {
+		in       string
+		lat, lon float64
+		format   string
+	}{
+		{"33.5, -118", 33.5, -118, coordDD},
+		{"-33.8568 151.2153", -33.8568, 151.2153, coordDD},
+		{`33°30'00.0"N 118°00'00.0"W`, 33.5, -118, coordDMS},
+		{"N33 30 00 W118 00 00", 33.5, -118, coordDMS},
+		{"33:30S 118:00E", -33.5, 118, coordDMS},
+		{"33N 118W", 33, -118, coordDMS},
+		{"31N AA 66021 00000", 0, 0, coordMGRS},
+	}
+	for _, tt := range tests {
+		lat, lon, format, err := parsePosition(tt.in)
+		if err != nil || format != tt.format || math.Abs(lat-tt.lat) > 1e-5 || math.Abs(lon-tt.lon) > 1e-5 {
+			t.Errorf("parsePosition(%q) = %g, %g, %q, %v; want %g, %g, %q", tt.in, lat, lon, format, err, tt.lat, tt.lon, tt.format)
+		}
+	}
+
+	for _, in := range []string{
+		"91, 0",                // latitude out of range
+		"33 60 00N 118 00 00W", // 60 minutes
+		"33 30 60N 118 00 00W", // 60 seconds
+		"33 30N 118 00",        // no hemisphere on the longitude
+		"33N 34S",              // two latitudes
+		"nowhere",
+	} {
+		if lat, lon, _, err := parsePosition(in); err == nil {
+			t.Errorf("parsePosition(%q) = %g, %g; want an error", in, lat, lon)
+		}
+	}
+}
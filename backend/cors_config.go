@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/rs/cors"
+)
+
+// defaultCORSOrigins covers the Vite dev server, which talks to the backend
+// on :8080 directly. Production builds are served from ./static on the same
+// origin and need no CORS at all.
+const defaultCORSOrigins = "http://localhost:5173,http://127.0.0.1:5173"
+
+// corsPolicy is also consulted for WebSocket upgrades.
+var corsPolicy *cors.Cors
+
+// newCORSFromEnv builds the CORS policy from CORS_ORIGINS, a comma-separated
+// list of origins such as "https://c2.example.com". One "*" per origin
+// matches any run of characters, e.g. "https://*.example.com"; "*" alone
+// allows every origin. Credentials travel in the Authorization header, not
+// cookies, so credentialed CORS is never enabled.
+func newCORSFromEnv() (*cors.Cors, []string, error) {
+	v, ok := os.LookupEnv("CORS_ORIGINS")
+	if !ok {
+		v = defaultCORSOrigins
+	}
+	origins := splitList(v)
+	for _, o := range origins {
+		if err := validateCORSOrigin(o); err != nil {
+			return nil, nil, fmt.Errorf("CORS_ORIGINS: %w", err)
+		}
+	}
+	return cors.New(cors.Options{
+		AllowedOrigins: origins,
+		AllowedMethods: []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodOptions},
+		AllowedHeaders: []string{"Authorization", "Content-Type", "X-API-Key", "X-Request-ID"},
+		ExposedHeaders: []string{"X-Total-Count", "Retry-After", "X-Request-ID", "X-Operating-Mode", "X-Heatmap-Bounds", "X-Heatmap-Cell", "X-Heatmap-Observations"},
+	}), origins, nil
+}
+
+func validateCORSOrigin(origin string) error {
+	if origin == "*" {
+		return nil
+	}
+	if strings.Count(origin, "*") > 1 {
+		return fmt.Errorf("%q has more than one wildcard", origin)
+	}
+	u, err := url.Parse(strings.Replace(origin, "*", "wildcard", 1))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q is not an origin like https://c2.example.com", origin)
+	}
+	if u.Path != "" || u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("%q has a path; an origin is scheme://host[:port] only", origin)
+	}
+	return nil
+}
+
+// checkWebSocketOrigin accepts clients without an Origin header (non-browser
+// tools), same-origin pages, and origins allowed by CORS_ORIGINS.
+func checkWebSocketOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	return corsPolicy != nil && corsPolicy.OriginAllowed(r)
+}
@@ -0,0 +1,158 @@
+// Package cot encodes Cursor-on-Target (CoT 2.0) events for TAK clients
+// (ATAK, WinTAK, iTAK) and streams them to TAK servers or multicast groups.
+//
+//	<event version="2.0" uid="ICAO-a1b2c3" type="a-n-A-C-F" how="m-g" time=… start=… stale=…>
+//	  <point lat="33.9" lon="-118.4" hae="3048" ce="50" le="100"/>
+//	  <detail>
+//	    <contact callsign="UAL123"/>
+//	    <track course="270" speed="220"/>
+//	    <remarks>…</remarks>
+//	  </detail>
+//	</event>
+package cot
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// Affiliation is the second atom of a CoT type, mapped to MIL-STD-2525 standard identity.
+type Affiliation string
+
+const (
+	Friend  Affiliation = "f"
+	Hostile Affiliation = "h"
+	Neutral Affiliation = "n"
+	Suspect Affiliation = "s"
+	Unknown Affiliation = "u"
+)
+
+// ADS-B emitter categories as numbered by OpenSky.
+const (
+	CategoryRotorcraft     = 8
+	CategoryGlider         = 9
+	CategoryLighterThanAir = 10
+	CategoryUAV            = 14
+)
+
+// HAEUnknown is the CoT convention for an unknown height or error.
+const HAEUnknown = 9999999.0
+
+const timeFormat = "2006-01-02T15:04:05.000Z"
+
+// Track is one air contact to be reported.
+type Track struct {
+	UID         string
+	Callsign    string
+	Lat, Lon    float64
+	HAE         float64 // meters above the WGS84 ellipsoid, or HAEUnknown
+	Course      float64 // degrees true
+	Speed       float64 // m/s
+	Affiliation Affiliation
+	Military    bool
+	Simulated   bool // synthetic, reported as how="m-s"
+	Manual      bool // entered by an operator, reported as how="h-e"
+	Category    int
+	Remarks     string
+	Time        time.Time
+	Stale       time.Duration
+}
+
+// AirType returns the 2525-derived CoT type for an air track, e.g.
+// a-n-A-C-F (neutral civil fixed wing) or a-u-A-M-H (unknown military rotary wing).
+func AirType(aff Affiliation, military bool, category int) string {
+	function := "C"
+	if military {
+		function = "M"
+	}
+	switch category {
+	case CategoryRotorcraft:
+		function += "-H"
+	case CategoryLighterThanAir:
+		function += "-L"
+	case CategoryUAV:
+		function += "-F-Q"
+	default:
+		function += "-F"
+	}
+	return "a-" + string(aff) + "-A-" + function
+}
+
+// Event is a CoT 2.0 event.
+type Event struct {
+	XMLName xml.Name `xml:"event"`
+	Version string   `xml:"version,attr"`
+	UID     string   `xml:"uid,attr"`
+	Type    string   `xml:"type,attr"`
+	How     string   `xml:"how,attr"`
+	Time    string   `xml:"time,attr"`
+	Start   string   `xml:"start,attr"`
+	Stale   string   `xml:"stale,attr"`
+	Point   Point    `xml:"point"`
+	Detail  Detail   `xml:"detail"`
+}
+
+type Point struct {
+	Lat float64 `xml:"lat,attr"`
+	Lon float64 `xml:"lon,attr"`
+	HAE float64 `xml:"hae,attr"`
+	CE  float64 `xml:"ce,attr"`
+	LE  float64 `xml:"le,attr"`
+}
+
+type Detail struct {
+	Contact *Contact     `xml:"contact,omitempty"`
+	Track   *TrackDetail `xml:"track,omitempty"`
+	Remarks string       `xml:"remarks,omitempty"`
+}
+
+type Contact struct {
+	Callsign string `xml:"callsign,attr"`
+}
+
+type TrackDetail struct {
+	Course float64 `xml:"course,attr"`
+	Speed  float64 `xml:"speed,attr"`
+}
+
+// Event builds the CoT event for a track. Positions are machine-reported
+// (how="m-g"), machine-simulated (how="m-s") for synthetic tracks, or
+// human-estimated (how="h-e") for manual ones; ADS-B positions are good to
+// tens of meters.
+func (t Track) Event() Event {
+	now := t.Time.UTC()
+	le := 100.0
+	if t.HAE == HAEUnknown {
+		le = HAEUnknown
+	}
+	how := "m-g"
+	if t.Simulated {
+		how = "m-s"
+	} else if t.Manual {
+		how = "h-e"
+	}
+	return Event{
+		Version: "2.0",
+		UID:     t.UID,
+		Type:    AirType(t.Affiliation, t.Military, t.Category),
+		How:     how,
+		Time:    now.Format(timeFormat),
+		Start:   now.Format(timeFormat),
+		Stale:   now.Add(t.Stale).Format(timeFormat),
+		Point:   Point{Lat: t.Lat, Lon: t.Lon, HAE: t.HAE, CE: 50, LE: le},
+		Detail: Detail{
+			Contact: &Contact{Callsign: t.Callsign},
+			Track:   &TrackDetail{Course: t.Course, Speed: t.Speed},
+			Remarks: t.Remarks,
+		},
+	}
+}
+
+// Marshal encodes an event as a standalone XML document.
+func (e Event) Marshal() ([]byte, error) {
+	body, err := xml.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
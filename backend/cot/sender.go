@@ -0,0 +1,135 @@
+package cot
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Sender delivers encoded events to one destination:
+//
+//	tcp://takserver:8087      — TAK server streaming input (plain)
+//	tls://takserver:8089      — TAK server streaming input (TLS, usually client certs)
+//	udp://239.2.3.1:6969      — SA multicast (or any unicast UDP listener)
+//
+// Stream connections are opened lazily and re-dialed after a write error;
+// after a failed dial, Send returns ErrBackingOff until redialDelay passes.
+// Multicast datagrams go out with the OS default TTL (1, i.e. the local segment).
+type Sender struct {
+	url       *url.URL
+	tlsConfig *tls.Config
+
+	mu      sync.Mutex
+	conn    conn
+	retryAt time.Time
+}
+
+const redialDelay = 10 * time.Second
+
+// ErrBackingOff is returned while a Sender waits to redial a failed destination.
+var ErrBackingOff = errors.New("cot: waiting to redial")
+
+// conn is the subset of net.Conn used for writing, so UDP can use an
+// unconnected socket.
+type conn interface {
+	Write([]byte) (int, error)
+	SetWriteDeadline(time.Time) error
+	Close() error
+}
+
+// udpConn sends datagrams from an unconnected socket, so ICMP port
+// unreachable from an absent listener doesn't surface as write errors.
+type udpConn struct {
+	net.PacketConn
+	addr net.Addr
+}
+
+func (c udpConn) Write(b []byte) (int, error) { return c.WriteTo(b, c.addr) }
+
+// NewSender validates a destination URL. tlsConfig is required for tls:// URLs.
+func NewSender(rawURL string, tlsConfig *tls.Config) (*Sender, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse %q: %w", rawURL, err)
+	}
+	switch u.Scheme {
+	case "tcp", "udp":
+	case "tls", "ssl":
+		if tlsConfig == nil {
+			return nil, fmt.Errorf("%s: TLS destination needs a TLS config", rawURL)
+		}
+	default:
+		return nil, fmt.Errorf("%s: unsupported scheme %q (use tcp, tls, or udp)", rawURL, u.Scheme)
+	}
+	if u.Port() == "" {
+		return nil, fmt.Errorf("%s: missing port", rawURL)
+	}
+	return &Sender{url: u, tlsConfig: tlsConfig}, nil
+}
+
+func (s *Sender) String() string { return s.url.String() }
+
+// Send writes each event. Over UDP every event is its own datagram; over
+// TCP/TLS events are written back to back, which TAK servers accept.
+func (s *Sender) Send(events [][]byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		if time.Now().Before(s.retryAt) {
+			return ErrBackingOff
+		}
+		c, err := s.dial()
+		if err != nil {
+			s.retryAt = time.Now().Add(redialDelay)
+			return err
+		}
+		s.conn = c
+	}
+
+	for _, ev := range events {
+		s.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+		if _, err := s.conn.Write(ev); err != nil {
+			s.conn.Close()
+			s.conn = nil
+			return fmt.Errorf("write %s: %w", s.url.Host, err)
+		}
+	}
+	return nil
+}
+
+func (s *Sender) dial() (conn, error) {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	switch s.url.Scheme {
+	case "udp":
+		addr, err := net.ResolveUDPAddr("udp", s.url.Host)
+		if err != nil {
+			return nil, err
+		}
+		pc, err := net.ListenPacket("udp", ":0")
+		if err != nil {
+			return nil, err
+		}
+		return udpConn{PacketConn: pc, addr: addr}, nil
+	case "tls", "ssl":
+		return tls.DialWithDialer(dialer, "tcp", s.url.Host, s.tlsConfig)
+	default:
+		return dialer.Dial("tcp", s.url.Host)
+	}
+}
+
+// Close drops the current connection, if any.
+func (s *Sender) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"swarm-c2/cot"
+)
+
+// CoTFeed pushes the air picture to TAK servers and multicast groups as
+// Cursor-on-Target events, one batch per poll.
+type CoTFeed struct {
+	senders []*cot.Sender
+	stale   time.Duration
+	queue   chan cotBatch
+}
+
+type cotBatch struct {
+	region   string
+	aircraft []Aircraft
+}
+
+var cotFeed *CoTFeed
+
+// newCoTFeedFromEnv returns nil when COT_URLS is unset.
+//
+//	COT_URLS                   — comma-separated tcp://, tls://, or udp:// destinations
+//	COT_STALE                  — how long TAK clients keep a track without updates (default 30s)
+//	COT_TLS_CERT, COT_TLS_KEY  — client certificate for tls:// destinations
+//	COT_TLS_CA                 — CA bundle for verifying the TAK server
+func newCoTFeedFromEnv() (*CoTFeed, error) {
+	urls := splitList(os.Getenv("COT_URLS"))
+	if len(urls) == 0 {
+		return nil, nil
+	}
+
+	f := &CoTFeed{stale: 30 * time.Second, queue: make(chan cotBatch, 4)}
+	if v := os.Getenv("COT_STALE"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("COT_STALE: %w", err)
+		}
+		f.stale = d
+	}
+
+	var tlsConfig *tls.Config
+	for _, u := range urls {
+		if strings.HasPrefix(u, "tls://") || strings.HasPrefix(u, "ssl://") {
+			var err error
+			if tlsConfig, err = cotTLSConfigFromEnv(); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	for _, u := range urls {
+		s, err := cot.NewSender(u, tlsConfig)
+		if err != nil {
+			return nil, err
+		}
+		f.senders = append(f.senders, s)
+	}
+
+	goSupervised("cot", f.run)
+	return f, nil
+}
+
+func cotTLSConfigFromEnv() (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if certFile := os.Getenv("COT_TLS_CERT"); certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, os.Getenv("COT_TLS_KEY"))
+		if err != nil {
+			return nil, fmt.Errorf("load CoT client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	if caFile := os.Getenv("COT_TLS_CA"); caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("read COT_TLS_CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("COT_TLS_CA: no certificates found")
+		}
+		cfg.RootCAs = pool
+	}
+	return cfg, nil
+}
+
+// Publish queues a region's picture for sending. It never blocks the poll
+// loop: if the senders are behind, the batch is dropped since the next poll
+// supersedes it anyway.
+func (f *CoTFeed) Publish(region string, aircraft []Aircraft) {
+	if f == nil {
+		return
+	}
+	select {
+	case f.queue <- cotBatch{region: region, aircraft: aircraft}:
+	default:
+	}
+}
+
+func (f *CoTFeed) run() {
+	for batch := range f.queue {
+		threats := analysisThreats(batch.region)
+		now := time.Now().UTC()
+
+		events := make([][]byte, 0, len(batch.aircraft))
+		for _, ac := range batch.aircraft {
+			track, ok := cotTrack(batch.region, ac, threats, now, f.stale)
+			if !ok {
+				continue
+			}
+			ev, err := track.Event().Marshal()
+			if err != nil {
+				feedLog.Warn("CoT encode failed", "region", batch.region, "icao24", ac.ICAO24, "err", err)
+				continue
+			}
+			events = append(events, ev)
+		}
+
+		for _, s := range f.senders {
+			if err := s.Send(events); err != nil && !errors.Is(err, cot.ErrBackingOff) {
+				feedLog.Warn("CoT send failed", "region", batch.region, "destination", s.String(), "err", err)
+			}
+		}
+	}
+}
+
+// cotAffiliation maps what we know about an aircraft to a 2525 identity:
+// An operator's classification decides first. Otherwise AI-assessed
+// HIGH/CRITICAL threats are hostile, MEDIUM threats and watchlist hits are
+// suspect, known patrols are friendly, other military traffic is unknown,
+// and everything else is neutral civil traffic.
+func cotAffiliation(ac Aircraft, threats map[string]string, military bool) cot.Affiliation {
+	if aff := annotationAffiliation(ac.ICAO24); aff != "" {
+		return aff
+	}
+	level := threats[ac.ICAO24]
+	switch {
+	case threatRank[level] >= threatRank["HIGH"]:
+		return cot.Hostile
+	case threatRank[level] >= threatRank["MEDIUM"]:
+		return cot.Suspect
+	}
+	if _, ok := watchlist.Match(ac); ok {
+		return cot.Suspect
+	}
+	if isPatrolCallsign(ac) {
+		return cot.Friend
+	}
+	if military {
+		return cot.Unknown
+	}
+	return cot.Neutral
+}
+
+func cotTrack(region string, ac Aircraft, threats map[string]string, now time.Time, stale time.Duration) (cot.Track, bool) {
+	if ac.Latitude == nil || ac.Longitude == nil {
+		return cot.Track{}, false
+	}
+	military, reason := classifyMilitary(ac)
+
+	hae := cot.HAEUnknown
+	if ac.GeoAltitude != nil {
+		hae = *ac.GeoAltitude
+	} else if ac.BaroAltitude != nil {
+		hae = *ac.BaroAltitude
+	}
+	if ac.OnGround {
+		hae = cot.HAEUnknown
+	}
+	var course, speed float64
+	if ac.TrueTrack != nil {
+		course = *ac.TrueTrack
+	}
+	if ac.Velocity != nil {
+		speed = *ac.Velocity
+	}
+
+	uid := "ICAO-" + ac.ICAO24
+	remarks := []string{"SWARM C2 " + region, "ICAO " + ac.ICAO24}
+	if ac.Source == sourceManual {
+		// Operator-entered: the ID is ours, not an ICAO address
+		uid = "MANUAL-" + strings.TrimPrefix(ac.ICAO24, "~")
+		remarks = []string{"MANUAL track", "SWARM C2 " + region}
+	}
+	if ac.Simulated {
+		remarks = append([]string{"SIMULATED"}, remarks...)
+	}
+	if ac.Squawk != nil {
+		remarks = append(remarks, "squawk "+*ac.Squawk)
+	}
+	if level := threats[ac.ICAO24]; level != "" {
+		remarks = append(remarks, "threat "+level)
+	}
+	if military {
+		remarks = append(remarks, reason)
+	}
+
+	return cot.Track{
+		UID:         uid,
+		Callsign:    displayCallsign(ac),
+		Lat:         *ac.Latitude,
+		Lon:         *ac.Longitude,
+		HAE:         hae,
+		Course:      course,
+		Speed:       speed,
+		Affiliation: cotAffiliation(ac, threats, military),
+		Military:    military,
+		Simulated:   ac.Simulated,
+		Manual:      ac.Source == sourceManual,
+		Category:    ac.Category,
+		Remarks:     strings.Join(remarks, "; "),
+		Time:        now,
+		Stale:       stale,
+	}, true
+}
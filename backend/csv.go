@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Column sets are part of the export contract: append new columns at the
+// end, never reorder or rename, so analysts' spreadsheets keep working.
+var aircraftCSVColumns = []string{
+	"icao24", "callsign", "origin_country", "time_position", "last_contact",
+	"longitude", "latitude", "baro_altitude_m", "on_ground", "velocity_ms",
+	"true_track_deg", "vertical_rate_ms", "geo_altitude_m", "squawk", "spi",
+	"position_source", "category",
+}
+
+var alertCSVColumns = []string{
+	"id", "key", "kind", "region", "severity", "status", "title", "message",
+	"icao24", "callsign", "first_seen", "last_seen", "resolved_at", "count",
+	"acked_by", "acked_at", "ack_note",
+}
+
+// wantsCSV reports whether the request asked for ?format=csv. Any format
+// other than csv or json is rejected with 400.
+func wantsCSV(w http.ResponseWriter, r *http.Request) (asCSV, ok bool) {
+	switch strings.ToLower(r.URL.Query().Get("format")) {
+	case "", "json":
+		return false, true
+	case "csv":
+		return true, true
+	default:
+		http.Error(w, "Unsupported format (use json or csv)", http.StatusBadRequest)
+		return false, false
+	}
+}
+
+// writeCSV streams rows as an attachment. encoding/csv handles quoting of
+// commas, quotes, and newlines.
+func writeCSV(w http.ResponseWriter, filename string, header []string, rows [][]string) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	cw := csv.NewWriter(w)
+	cw.Write(header)
+	cw.WriteAll(rows)
+}
+
+// csvText neutralizes values a spreadsheet would evaluate as a formula.
+// Callsigns, titles, and notes can originate outside our control.
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+func csvFloat(v *float64) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*v, 'f', -1, 64)
+}
+
+func csvTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func aircraftCSVRow(ac Aircraft) []string {
+	timePosition, squawk := "", ""
+	if ac.TimePosition != nil {
+		timePosition = strconv.FormatInt(*ac.TimePosition, 10)
+	}
+	if ac.Squawk != nil {
+		squawk = csvText(*ac.Squawk)
+	}
+	return []string{
+		ac.ICAO24,
+		csvText(strings.TrimSpace(ac.Callsign)),
+		csvText(ac.OriginCountry),
+		timePosition,
+		strconv.FormatInt(ac.LastContact, 10),
+		csvFloat(ac.Longitude),
+		csvFloat(ac.Latitude),
+		csvFloat(ac.BaroAltitude),
+		strconv.FormatBool(ac.OnGround),
+		csvFloat(ac.Velocity),
+		csvFloat(ac.TrueTrack),
+		csvFloat(ac.VerticalRate),
+		csvFloat(ac.GeoAltitude),
+		squawk,
+		strconv.FormatBool(ac.SPI),
+		strconv.Itoa(ac.PositionSource),
+		strconv.Itoa(ac.Category),
+	}
+}
+
+func alertCSVRow(a Alert) []string {
+	return []string{
+		a.ID,
+		csvText(a.Key),
+		a.Kind,
+		a.Region,
+		a.Severity,
+		a.Status,
+		csvText(a.Title),
+		csvText(a.Message),
+		a.ICAO24,
+		csvText(a.Callsign),
+		csvTime(&a.FirstSeen),
+		csvTime(&a.LastSeen),
+		csvTime(a.ResolvedAt),
+		strconv.Itoa(a.Count),
+		csvText(a.AckedBy),
+		csvTime(a.AckedAt),
+		csvText(a.AckNote),
+	}
+}
+
+func writeAircraftCSV(w http.ResponseWriter, data *AirspaceData) {
+	rows := make([][]string, 0, len(data.Aircraft))
+	for _, ac := range data.Aircraft {
+		rows = append(rows, aircraftCSVRow(ac))
+	}
+	filename := fmt.Sprintf("aircraft-%s-%s.csv", data.Region, time.Unix(data.Timestamp, 0).UTC().Format("20060102T150405Z"))
+	writeCSV(w, filename, aircraftCSVColumns, rows)
+}
+
+func writeAlertsCSV(w http.ResponseWriter, alerts []Alert) {
+	rows := make([][]string, 0, len(alerts))
+	for _, a := range alerts {
+		rows = append(rows, alertCSVRow(a))
+	}
+	filename := fmt.Sprintf("alerts-%s.csv", time.Now().UTC().Format("20060102T150405Z"))
+	writeCSV(w, filename, alertCSVColumns, rows)
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// DataPusher POSTs every poll's AirspaceData to downstream HTTP endpoints,
+// for consumers that can't hold a WebSocket open to us (SIEM ingest, data
+// lakes). Each destination has its own queue so a slow one can't hold up
+// the rest.
+type DataPusher struct {
+	destinations []*pushDestination
+}
+
+type pushDestination struct {
+	url     string
+	header  http.Header
+	secret  []byte // nil leaves requests unsigned
+	gzip    bool
+	retries int
+	client  *http.Client
+	queue   chan *AirspaceData
+	dropped atomic.Int64
+}
+
+var dataPusher *DataPusher
+
+// newDataPusherFromEnv returns nil when DATA_PUSH_URLS is unset.
+//
+//	DATA_PUSH_URLS     — comma-separated endpoints
+//	DATA_PUSH_HEADERS  — semicolon-separated "Name: value" headers, e.g. "Authorization: Bearer abc; X-Source: swarm-c2"
+//	DATA_PUSH_SECRETS  — HMAC signing secret for all endpoints, or comma-separated, one per endpoint
+//	DATA_PUSH_GZIP     — gzip request bodies (default true)
+//	DATA_PUSH_RETRIES  — retries after a failed attempt, with exponential backoff (default 3)
+//	DATA_PUSH_TIMEOUT  — per-attempt timeout (default 10s)
+func newDataPusherFromEnv() (*DataPusher, error) {
+	urls := splitList(os.Getenv("DATA_PUSH_URLS"))
+	if len(urls) == 0 {
+		return nil, nil
+	}
+
+	header := make(http.Header)
+	for _, h := range strings.Split(getSecret("DATA_PUSH_HEADERS"), ";") {
+		if h = strings.TrimSpace(h); h == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(h, ":")
+		if !ok {
+			return nil, fmt.Errorf("DATA_PUSH_HEADERS: %q is not \"Name: value\"", h)
+		}
+		header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+
+	useGzip := true
+	if v := os.Getenv("DATA_PUSH_GZIP"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("DATA_PUSH_GZIP: %w", err)
+		}
+		useGzip = b
+	}
+	retries := 3
+	if v := os.Getenv("DATA_PUSH_RETRIES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("DATA_PUSH_RETRIES: invalid value %q", v)
+		}
+		retries = n
+	}
+	timeout := 10 * time.Second
+	if v := os.Getenv("DATA_PUSH_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("DATA_PUSH_TIMEOUT: invalid duration %q", v)
+		}
+		timeout = d
+	}
+
+	secrets, err := endpointSecrets("DATA_PUSH_SECRETS", len(urls))
+	if err != nil {
+		return nil, err
+	}
+
+	p := &DataPusher{}
+	for i, u := range urls {
+		d := &pushDestination{
+			url:     u,
+			header:  header,
+			gzip:    useGzip,
+			retries: retries,
+			client:  &http.Client{Timeout: timeout},
+			queue:   make(chan *AirspaceData, 8),
+		}
+		if secrets != nil {
+			d.secret = secrets[i]
+		}
+		p.destinations = append(p.destinations, d)
+		goSupervised("data_push", d.run)
+	}
+	return p, nil
+}
+
+// Publish queues a poll for every destination without blocking. When a
+// destination's queue is full the new poll is dropped for it.
+func (p *DataPusher) Publish(data *AirspaceData) {
+	if p == nil {
+		return
+	}
+	for _, d := range p.destinations {
+		select {
+		case d.queue <- data:
+		default:
+			if n := d.dropped.Add(1); n == 1 || n%100 == 0 {
+				feedLog.Warn("Data push is falling behind", "url", d.url, "dropped", n)
+			}
+		}
+	}
+}
+
+func (d *pushDestination) run() {
+	for data := range d.queue {
+		body, err := d.encode(data)
+		if err != nil {
+			feedLog.Error("Data push encode failed", "region", data.Region, "err", err)
+			continue
+		}
+
+		backoff := time.Second
+		for attempt := 0; ; attempt++ {
+			retry, err := d.post(body)
+			if err == nil {
+				break
+			}
+			if !retry || attempt >= d.retries {
+				feedLog.Warn("Data push failed", "region", data.Region, "url", d.url, "attempts", attempt+1, "err", err)
+				break
+			}
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+}
+
+func (d *pushDestination) encode(data *AirspaceData) ([]byte, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	if !d.gzip {
+		return raw, nil
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(raw)
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// post sends one attempt and reports whether a failure is worth retrying:
+// network errors, 429, and 5xx are; other 4xx mean the request is wrong.
+func (d *pushDestination) post(body []byte) (retry bool, err error) {
+	req, err := http.NewRequest("POST", d.url, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("create request: %w", err)
+	}
+	for k, v := range d.header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if d.gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	signRequest(req, d.secret, body)
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return retry, fmt.Errorf("%s returned %d: %s", req.URL.Host, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return false, nil
+}
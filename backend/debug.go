@@ -0,0 +1,99 @@
+package main
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+	"time"
+)
+
+// debugPrefix is where the runtime debug endpoints live. It sits under
+// /api/admin, so only admins can reach them (see adminPaths).
+const debugPrefix = "/api/admin/debug/"
+
+var startTime = time.Now()
+
+func init() {
+	expvar.Publish("swarm", expvar.Func(swarmVars))
+}
+
+// swarmVars reports the in-memory structures most likely to grow, next to
+// the runtime's own memstats in /debug/vars.
+func swarmVars() interface{} {
+	cacheMutex.RLock()
+	cached := make(map[string]int, len(airspaceCache))
+	for region, data := range airspaceCache {
+		cached[region] = len(data.Aircraft)
+	}
+	cacheMutex.RUnlock()
+	clientsMutex.RLock()
+	wsClients := len(clients)
+	clientsMutex.RUnlock()
+	droneClientsMutex.RLock()
+	droneWSClients := len(droneClients)
+	droneClientsMutex.RUnlock()
+
+	return map[string]interface{}{
+		"uptimeSeconds":  int64(time.Since(startTime).Seconds()),
+		"goroutines":     runtime.NumGoroutine(),
+		"airspaceCache":  cached,
+		"wsClients":      wsClients,
+		"droneWsClients": droneWSClients,
+		"upstream":       upstream.All(),
+	}
+}
+
+// debugHandler serves net/http/pprof and expvar under debugPrefix:
+//
+//	/api/admin/debug/pprof/            — profile index; heap, goroutine, allocs, block, mutex, …
+//	/api/admin/debug/pprof/profile     — 30 s CPU profile (?seconds=)
+//	/api/admin/debug/pprof/trace       — execution trace (?seconds=)
+//	/api/admin/debug/vars              — expvar JSON: memstats, cmdline, and "swarm"
+//
+// pprof expects its paths under /debug/pprof/, so the /api/admin part is
+// stripped before dispatch.
+func debugHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	return http.StripPrefix("/api/admin", mux)
+}
+
+// mainDebugHandler is debugHandler for the public port. With no API keys or
+// users configured there is no admin to check, so the endpoints stay hidden
+// there and are only reachable through DEBUG_ADDR.
+func mainDebugHandler() http.Handler {
+	debug := debugHandler()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !authEnabled() && !viaMTLS(r) {
+			http.Error(w, "Debug endpoints need authentication enabled, or DEBUG_ADDR", http.StatusNotFound)
+			return
+		}
+		debug.ServeHTTP(w, r)
+	})
+}
+
+// newDebugServerFromEnv returns a server for DEBUG_ADDR (e.g.
+// "127.0.0.1:6060"), or nil when unset. It serves only the debug endpoints,
+// behind the same IP rules and admin check as the main port, so profiling
+// traffic can be kept off the public listener. Without auth configured the
+// bind address is the only protection, so keep it on loopback.
+func newDebugServerFromEnv() *http.Server {
+	addr := os.Getenv("DEBUG_ADDR")
+	if addr == "" {
+		return nil
+	}
+	mux := http.NewServeMux()
+	mux.Handle(debugPrefix, debugHandler())
+	return trackServer(&http.Server{
+		Addr:              addr,
+		Handler:           withRequestID(logRequests(recoverHTTP(filterIPs(requireAuth(mux))))),
+		ReadHeaderTimeout: 10 * time.Second,
+	})
+}
@@ -0,0 +1,470 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Drawing kinds and the vertices each needs.
+var drawingKinds = map[string]int{
+	"point":   1,
+	"line":    2,
+	"polygon": 3,
+}
+
+const (
+	maxDrawings        = 500
+	maxDrawingVertices = 500
+	maxDrawingLabel    = 200 // characters
+)
+
+var drawingColor = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// Drawing is a shape on the shared map layer: a reference point, a route or
+// phase line, or an area of interest. Coordinates are [lon, lat] pairs
+// (GeoJSON order, like zone polygons); a polygon's ring is closed implicitly.
+type Drawing struct {
+	ID          string       `json:"id"`
+	Kind        string       `json:"kind"` // point, line, or polygon
+	Region      string       `json:"region,omitempty"`
+	Coordinates [][2]float64 `json:"coordinates"`
+	Label       string       `json:"label,omitempty"`
+	Color       string       `json:"color,omitempty"` // #rrggbb; the client picks when empty
+	CreatedBy   string       `json:"createdBy,omitempty"`
+	CreatedAt   time.Time    `json:"createdAt"`
+	UpdatedBy   string       `json:"updatedBy,omitempty"`
+	UpdatedAt   time.Time    `json:"updatedAt"`
+}
+
+// DrawingRequest creates a drawing, or with an id, changes one: only the
+// fields given are replaced, and kind and coordinates go together.
+type DrawingRequest struct {
+	ID          string       `json:"id"`
+	Kind        string       `json:"kind"`
+	Region      *string      `json:"region"`
+	Coordinates [][2]float64 `json:"coordinates"`
+	Label       *string      `json:"label"`
+	Color       *string      `json:"color"`
+}
+
+// Drawings holds the shared map layer, persisted as a JSON file in the data
+// directory.
+type Drawings struct {
+	mu       sync.RWMutex
+	path     string
+	drawings map[string]*Drawing
+}
+
+var drawings = &Drawings{drawings: make(map[string]*Drawing)}
+
+var errDrawingNotFound = errors.New("drawing not found")
+
+// OpenDrawings loads dir/drawings.json if it exists.
+func OpenDrawings(dir string) (*Drawings, error) {
+	d := &Drawings{path: filepath.Join(dir, "drawings.json"), drawings: make(map[string]*Drawing)}
+	data, err := os.ReadFile(d.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return d, nil
+		}
+		return nil, fmt.Errorf("read drawings: %w", err)
+	}
+	var list []*Drawing
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("parse drawings: %w", err)
+	}
+	for _, dr := range list {
+		d.drawings[dr.ID] = dr
+	}
+	return d, nil
+}
+
+// List returns the drawings in a region, plus those tied to none, oldest
+// first so later shapes draw on top. An empty region returns them all.
+func (d *Drawings) List(region string) []Drawing {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	out := make([]Drawing, 0, len(d.drawings))
+	for _, dr := range d.drawings {
+		if region == "" || dr.Region == "" || dr.Region == region {
+			out = append(out, dr.copy())
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out
+}
+
+// drawingsFor returns the drawings a principal may see: those in the regions
+// it may watch, plus those tied to none.
+func drawingsFor(p *Principal) []Drawing {
+	all := drawings.List("")
+	out := all[:0]
+	for _, dr := range all {
+		if dr.Region == "" || workspaceAllows(p, dr.Region) {
+			out = append(out, dr)
+		}
+	}
+	return out
+}
+
+// Get returns one drawing.
+func (d *Drawings) Get(id string) (Drawing, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	dr, ok := d.drawings[id]
+	if !ok {
+		return Drawing{}, errDrawingNotFound
+	}
+	return dr.copy(), nil
+}
+
+// Put creates or changes a drawing and persists the layer.
+func (d *Drawings) Put(req DrawingRequest, by string) (Drawing, bool, error) {
+	now := time.Now().UTC()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var next Drawing
+	old, exists := d.drawings[req.ID]
+	switch {
+	case req.ID == "":
+		if len(d.drawings) >= maxDrawings {
+			return Drawing{}, false, fmt.Errorf("the map already has %d drawings; delete some first", maxDrawings)
+		}
+		if req.Kind == "" || req.Coordinates == nil {
+			return Drawing{}, false, errors.New("kind and coordinates are required")
+		}
+		next = Drawing{ID: newAlertID(), CreatedBy: by, CreatedAt: now}
+	case !exists:
+		return Drawing{}, false, errDrawingNotFound
+	default:
+		next = old.copy()
+	}
+
+	if req.Kind != "" || req.Coordinates != nil {
+		kind := strings.ToLower(strings.TrimSpace(req.Kind))
+		if kind == "" {
+			kind = next.Kind
+		}
+		coords := req.Coordinates
+		if coords == nil {
+			coords = next.Coordinates
+		}
+		if err := validateDrawingShape(kind, coords); err != nil {
+			return Drawing{}, false, err
+		}
+		next.Kind, next.Coordinates = kind, append([][2]float64{}, coords...)
+	}
+	if req.Label != nil {
+		label := strings.TrimSpace(*req.Label)
+		if len(label) > maxDrawingLabel {
+			return Drawing{}, false, fmt.Errorf("label is longer than %d characters", maxDrawingLabel)
+		}
+		next.Label = label
+	}
+	if req.Color != nil {
+		if *req.Color != "" && !drawingColor.MatchString(*req.Color) {
+			return Drawing{}, false, fmt.Errorf("color %q is not #rrggbb", *req.Color)
+		}
+		next.Color = strings.ToLower(*req.Color)
+	}
+	switch {
+	case req.Region != nil:
+		if *req.Region != "" {
+			if _, ok := regions[*req.Region]; !ok {
+				return Drawing{}, false, fmt.Errorf("unknown region %q", *req.Region)
+			}
+		}
+		next.Region = *req.Region
+	case !exists:
+		next.Region = regionContaining(next.Coordinates[0][1], next.Coordinates[0][0])
+	}
+	next.UpdatedBy, next.UpdatedAt = by, now
+
+	d.drawings[next.ID] = &next
+	if err := d.saveLocked(); err != nil {
+		if exists {
+			d.drawings[next.ID] = old
+		} else {
+			delete(d.drawings, next.ID)
+		}
+		return Drawing{}, false, err
+	}
+	return next.copy(), !exists, nil
+}
+
+// Delete removes a drawing and persists the layer.
+func (d *Drawings) Delete(id string) (Drawing, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	dr, ok := d.drawings[id]
+	if !ok {
+		return Drawing{}, errDrawingNotFound
+	}
+	delete(d.drawings, id)
+	if err := d.saveLocked(); err != nil {
+		d.drawings[id] = dr
+		return Drawing{}, err
+	}
+	return *dr, nil
+}
+
+func (d *Drawings) saveLocked() error {
+	if d.path == "" {
+		return nil
+	}
+	list := make([]*Drawing, 0, len(d.drawings))
+	for _, dr := range d.drawings {
+		list = append(list, dr)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(d.path, data, 0o644)
+}
+
+func (dr *Drawing) copy() Drawing {
+	c := *dr
+	c.Coordinates = append([][2]float64{}, dr.Coordinates...)
+	return c
+}
+
+// validateDrawingShape checks a kind against its vertices.
+func validateDrawingShape(kind string, coords [][2]float64) error {
+	need, ok := drawingKinds[kind]
+	if !ok {
+		return fmt.Errorf("unknown kind %q (want point, line, or polygon)", kind)
+	}
+	switch {
+	case kind == "point" && len(coords) != 1:
+		return errors.New("a point has exactly one coordinate")
+	case len(coords) < need:
+		return fmt.Errorf("a %s needs at least %d coordinates", kind, need)
+	case len(coords) > maxDrawingVertices:
+		return fmt.Errorf("at most %d coordinates", maxDrawingVertices)
+	}
+	for i, c := range coords {
+		lon, lat := c[0], c[1]
+		if math.IsNaN(lon) || math.IsNaN(lat) || lon < -180 || lon > 180 || lat < -90 || lat > 90 {
+			return fmt.Errorf("coordinate %d is not a [lon, lat] pair", i)
+		}
+	}
+	return nil
+}
+
+// drawingFeature renders a drawing as a GeoJSON feature.
+func drawingFeature(dr Drawing) GeoJSONFeature {
+	var geom GeoJSONGeometry
+	switch dr.Kind {
+	case "point":
+		geom = GeoJSONGeometry{Type: "Point", Coordinates: dr.Coordinates[0]}
+	case "line":
+		geom = GeoJSONGeometry{Type: "LineString", Coordinates: dr.Coordinates}
+	default:
+		ring := append(append([][2]float64{}, dr.Coordinates...), dr.Coordinates[0])
+		geom = GeoJSONGeometry{Type: "Polygon", Coordinates: [][][2]float64{ring}}
+	}
+	return GeoJSONFeature{
+		Type:     "Feature",
+		ID:       dr.ID,
+		Geometry: geom,
+		Properties: map[string]interface{}{
+			"id":        dr.ID,
+			"kind":      dr.Kind,
+			"label":     dr.Label,
+			"color":     dr.Color,
+			"region":    dr.Region,
+			"createdBy": dr.CreatedBy,
+			"updatedAt": dr.UpdatedAt,
+		},
+	}
+}
+
+// putDrawing applies a drawing request from REST or WebSocket, then audits
+// and broadcasts it.
+func putDrawing(r *http.Request, req DrawingRequest) (Drawing, bool, error) {
+	p := principalFrom(r)
+	if req.Region != nil && *req.Region != "" && !workspaceAllows(p, *req.Region) {
+		return Drawing{}, false, fmt.Errorf("region %q is %w", *req.Region, errNotInWorkspace)
+	}
+	if req.ID != "" {
+		if err := checkDrawingWorkspace(p, req.ID); err != nil {
+			return Drawing{}, false, err
+		}
+	}
+	by := ""
+	if p != nil {
+		by = p.Name
+	}
+	dr, created, err := drawings.Put(req, by)
+	if err != nil {
+		return Drawing{}, false, err
+	}
+	action := "drawing.update"
+	if created {
+		action = "drawing.create"
+	}
+	auditLog.Record(r, action, map[string]interface{}{"id": dr.ID, "kind": dr.Kind, "label": dr.Label, "region": dr.Region})
+	broadcastDrawing(dr.Region, map[string]interface{}{"type": "drawing", "drawing": dr})
+	return dr, created, nil
+}
+
+// deleteDrawing removes a drawing from REST or WebSocket, then audits and
+// broadcasts it.
+func deleteDrawing(r *http.Request, id string) error {
+	if err := checkDrawingWorkspace(principalFrom(r), id); err != nil {
+		return err
+	}
+	dr, err := drawings.Delete(id)
+	if err != nil {
+		return err
+	}
+	auditLog.Record(r, "drawing.delete", map[string]interface{}{"id": id, "kind": dr.Kind, "label": dr.Label})
+	broadcastDrawing(dr.Region, map[string]interface{}{"type": "drawing_deleted", "id": id, "region": dr.Region})
+	return nil
+}
+
+// checkDrawingWorkspace refuses changes to a drawing in a region outside the
+// principal's workspace. A missing drawing is left for the store to report.
+func checkDrawingWorkspace(p *Principal, id string) error {
+	if dr, err := drawings.Get(id); err == nil && dr.Region != "" && !workspaceAllows(p, dr.Region) {
+		return fmt.Errorf("drawing %s is %w", id, errNotInWorkspace)
+	}
+	return nil
+}
+
+// broadcastDrawing sends a layer change to every WebSocket client, whatever
+// region it watches, so a client switching regions has nothing to refetch.
+// Workspace clients hear only about drawings in their regions or in none.
+func broadcastDrawing(region string, msg map[string]interface{}) {
+	recorder.Broadcast("", msg)
+	clientsMutex.RLock()
+	defer clientsMutex.RUnlock()
+	for conn := range clients {
+		if !clientAllows(conn, region) {
+			continue
+		}
+		if err := conn.send(msg); err != nil {
+			wsLog.Warn("Write drawing to client failed", "err", err)
+		}
+	}
+}
+
+// handleDrawingMessage handles a "draw" or "erase" action sent on /ws. The
+// result comes back to every client as a broadcast; only errors are answered
+// directly.
+func handleDrawingMessage(r *http.Request, action string, msg []byte) map[string]interface{} {
+	if p := principalFrom(r); p != nil && !p.hasRole(RoleAnalyst) {
+		return map[string]interface{}{"type": "error", "action": action, "error": "Forbidden: requires analyst role"}
+	}
+	var request struct {
+		Drawing DrawingRequest `json:"drawing"`
+		ID      string         `json:"id"`
+	}
+	if err := json.Unmarshal(msg, &request); err != nil {
+		return map[string]interface{}{"type": "error", "action": action, "error": "invalid JSON: " + err.Error()}
+	}
+	var err error
+	if action == "erase" {
+		err = deleteDrawing(r, request.ID)
+	} else {
+		_, _, err = putDrawing(r, request.Drawing)
+	}
+	if err != nil {
+		return map[string]interface{}{"type": "error", "action": action, "error": err.Error()}
+	}
+	return nil
+}
+
+// handleDrawings serves the shared map layer.
+//
+//	GET  /api/drawings[?region=] — drawings in a region (and those in none)
+//	POST /api/drawings           — create, or with an id, change a drawing
+func handleDrawings(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(drawings.List(r.URL.Query().Get("region")))
+
+	case http.MethodPost:
+		var req DrawingRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		dr, created, err := putDrawing(r, req)
+		if errors.Is(err, errDrawingNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		} else if errors.Is(err, errNotInWorkspace) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		status := http.StatusOK
+		if created {
+			status = http.StatusCreated
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(dr)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleDrawing serves GET and DELETE on /api/drawings/{id}.
+func handleDrawing(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/drawings/"), "/")
+	switch r.Method {
+	case http.MethodGet:
+		dr, err := drawings.Get(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(dr)
+
+	case http.MethodDelete:
+		if err := deleteDrawing(r, id); errors.Is(err, errDrawingNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		} else if errors.Is(err, errNotInWorkspace) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleDrawingsGeoJSON serves the shared map layer as a FeatureCollection.
+// GET /api/drawings.geojson[?region=]
+func handleDrawingsGeoJSON(w http.ResponseWriter, r *http.Request) {
+	var features []GeoJSONFeature
+	for _, dr := range drawings.List(r.URL.Query().Get("region")) {
+		features = append(features, drawingFeature(dr))
+	}
+	writeGeoJSON(w, features)
+}
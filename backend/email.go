@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+)
+
+// Mailer sends email through one SMTP server. It backs the email alert
+// channel and scheduled report delivery.
+type Mailer struct {
+	addr     string
+	host     string
+	username string
+	password string
+	from     string
+}
+
+var mailer *Mailer
+
+// mailAttachment is a file attached to an email.
+type mailAttachment struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// newMailerFromEnv returns nil when SMTP_HOST is unset.
+//
+//	SMTP_HOST     — mail server
+//	SMTP_PORT     — default 587; STARTTLS is used when offered, and 465 means implicit TLS
+//	SMTP_USERNAME — with SMTP_PASSWORD (or SMTP_PASSWORD_FILE), PLAIN auth, only over TLS
+//	SMTP_FROM     — sender address
+func newMailerFromEnv() (*Mailer, error) {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return nil, nil
+	}
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+	from := os.Getenv("SMTP_FROM")
+	if _, err := mail.ParseAddress(from); err != nil {
+		return nil, fmt.Errorf("SMTP_FROM: %q is not an email address", from)
+	}
+	return &Mailer{
+		addr:     net.JoinHostPort(host, port),
+		host:     host,
+		username: os.Getenv("SMTP_USERNAME"),
+		password: getSecret("SMTP_PASSWORD"),
+		from:     from,
+	}, nil
+}
+
+// Send delivers one message. body is HTML when it starts with "<", plain
+// text otherwise.
+func (m *Mailer) Send(to []string, subject, body string, attachments ...mailAttachment) error {
+	msg, err := m.compose(to, subject, body, attachments)
+	if err != nil {
+		return err
+	}
+
+	var conn net.Conn
+	dialer := &net.Dialer{Timeout: 15 * time.Second}
+	if strings.HasSuffix(m.addr, ":465") {
+		conn, err = tls.DialWithDialer(dialer, "tcp", m.addr, &tls.Config{ServerName: m.host})
+	} else {
+		conn, err = dialer.Dial("tcp", m.addr)
+	}
+	if err != nil {
+		return fmt.Errorf("smtp %s: %w", m.addr, err)
+	}
+	conn.SetDeadline(time.Now().Add(time.Minute))
+	c, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("smtp %s: %w", m.addr, err)
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: m.host}); err != nil {
+			return fmt.Errorf("smtp starttls: %w", err)
+		}
+	}
+	if m.username != "" {
+		if err := c.Auth(smtp.PlainAuth("", m.username, m.password, m.host)); err != nil {
+			return fmt.Errorf("smtp auth: %w", err)
+		}
+	}
+	if err := c.Mail(m.from); err != nil {
+		return fmt.Errorf("smtp MAIL FROM: %w", err)
+	}
+	for _, rcpt := range to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("smtp RCPT TO %s: %w", rcpt, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("smtp DATA: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("smtp DATA: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("smtp DATA: %w", err)
+	}
+	return c.Quit()
+}
+
+// compose builds a multipart/mixed MIME message.
+func (m *Mailer) compose(to []string, subject, body string, attachments []mailAttachment) ([]byte, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "From: %s\r\n", m.from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@swarm-c2>\r\n", newAlertID())
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%q\r\n\r\n", mw.Boundary())
+
+	contentType := "text/plain; charset=utf-8"
+	if strings.HasPrefix(strings.TrimSpace(body), "<") {
+		contentType = "text/html; charset=utf-8"
+	}
+	part, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	qp := quotedprintable.NewWriter(part)
+	qp.Write([]byte(body))
+	qp.Close()
+
+	for _, a := range attachments {
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {a.ContentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Name})},
+		})
+		if err != nil {
+			return nil, err
+		}
+		enc := base64.StdEncoding.EncodeToString(a.Data)
+		for len(enc) > 76 {
+			part.Write([]byte(enc[:76] + "\r\n"))
+			enc = enc[76:]
+		}
+		part.Write([]byte(enc + "\r\n"))
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// EmailNotifier emails alert openings, escalations, and resolutions.
+type EmailNotifier struct {
+	mailer *Mailer
+	to     []string
+}
+
+func (n *EmailNotifier) Name() string { return "email" }
+
+func (n *EmailNotifier) Notify(event string, alert *Alert) error {
+	if event == AlertAcked {
+		return nil // the person acking already knows
+	}
+	subject := fmt.Sprintf("[SWARM C2] %s %s: %s", alert.Severity, strings.ToUpper(event), alert.Title)
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n\n", alert.Message)
+	fmt.Fprintf(&b, "Region:     %s\n", alert.Region)
+	fmt.Fprintf(&b, "Severity:   %s\n", alert.Severity)
+	if alert.Callsign != "" || alert.ICAO24 != "" {
+		fmt.Fprintf(&b, "Aircraft:   %s\n", strings.TrimSpace(alert.Callsign+" "+alert.ICAO24))
+	}
+	fmt.Fprintf(&b, "First seen: %s\n", alert.FirstSeen.UTC().Format(time.RFC3339))
+	fmt.Fprintf(&b, "Alert ID:   %s\n", alert.ID)
+	return n.mailer.Send(n.to, subject, b.String())
+}
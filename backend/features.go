@@ -0,0 +1,262 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Feature flags gate expensive or experimental subsystems at runtime.
+const (
+	FlagAIAnalysis        = "ai_analysis"        // SENTINEL analysis, scheduled and on demand
+	FlagPushNotifications = "push_notifications" // browser push for alert transitions
+)
+
+// flagDefaults lists every known flag with its built-in state.
+var flagDefaults = map[string]bool{
+	FlagAIAnalysis:        true,
+	FlagPushNotifications: true,
+}
+
+// FlagSetting turns a flag on or off everywhere and/or per region. A nil
+// Enabled leaves the global state to the layer below.
+type FlagSetting struct {
+	Enabled *bool           `json:"enabled,omitempty"`
+	Regions map[string]bool `json:"regions,omitempty"`
+}
+
+// lookup returns the setting's state for region, if it has one.
+func (s FlagSetting) lookup(region string) (bool, bool) {
+	if on, ok := s.Regions[region]; ok && region != "" {
+		return on, true
+	}
+	if s.Enabled != nil {
+		return *s.Enabled, true
+	}
+	return false, false
+}
+
+// FeatureFlags resolves flags from three layers, most specific first within
+// each: admin overrides (set through the API, persisted in the data
+// directory), then FEATURE_FLAGS from the environment or config file, then
+// the built-in default.
+type FeatureFlags struct {
+	mu        sync.RWMutex
+	path      string
+	config    map[string]FlagSetting
+	overrides map[string]FlagSetting
+}
+
+var features = &FeatureFlags{}
+
+// LoadOverrides reads the admin overrides from dir/feature_flags.json, if
+// it exists, and saves later changes there.
+func (f *FeatureFlags) LoadOverrides(dir string) error {
+	path := filepath.Join(dir, "feature_flags.json")
+	var overrides map[string]FlagSetting
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("read feature flags: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &overrides); err != nil {
+			return fmt.Errorf("parse feature flags: %w", err)
+		}
+	}
+	for name := range overrides {
+		if _, ok := flagDefaults[name]; !ok {
+			delete(overrides, name)
+		}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.path = path
+	f.overrides = overrides
+	return nil
+}
+
+// loadFeatureFlags reads FEATURE_FLAGS, comma-separated "flag=on|off" or
+// "flag@region=on|off" entries, e.g. "ai_analysis=off,ai_analysis@socal=on".
+func loadFeatureFlags() error {
+	config := make(map[string]FlagSetting)
+	for _, entry := range splitList(os.Getenv("FEATURE_FLAGS")) {
+		key, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return fmt.Errorf("%q is not flag=on|off", entry)
+		}
+		name, region, scoped := strings.Cut(strings.TrimSpace(key), "@")
+		if _, known := flagDefaults[name]; !known {
+			return fmt.Errorf("unknown flag %q", name)
+		}
+		if scoped {
+			if _, known := regions[region]; !known {
+				return fmt.Errorf("unknown region %q", region)
+			}
+		}
+		var on bool
+		switch strings.ToLower(strings.TrimSpace(value)) {
+		case "on", "true", "1":
+			on = true
+		case "off", "false", "0":
+		default:
+			return fmt.Errorf("%q is not on or off", value)
+		}
+		s := config[name]
+		if scoped {
+			if s.Regions == nil {
+				s.Regions = make(map[string]bool)
+			}
+			s.Regions[region] = on
+		} else {
+			s.Enabled = &on
+		}
+		config[name] = s
+	}
+	features.mu.Lock()
+	features.config = config
+	features.mu.Unlock()
+	return nil
+}
+
+// Enabled reports whether a flag is on for region ("" for the global state).
+func (f *FeatureFlags) Enabled(name, region string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if on, ok := f.overrides[name].lookup(region); ok {
+		return on
+	}
+	if on, ok := f.config[name].lookup(region); ok {
+		return on
+	}
+	return flagDefaults[name]
+}
+
+// FlagState is a flag as reported by the admin API.
+type FlagState struct {
+	Name     string          `json:"name"`
+	Default  bool            `json:"default"`
+	Enabled  bool            `json:"enabled"`
+	Regions  map[string]bool `json:"regions"`
+	Config   *FlagSetting    `json:"config,omitempty"`
+	Override *FlagSetting    `json:"override,omitempty"`
+}
+
+// States returns every flag's effective state globally and per region.
+func (f *FeatureFlags) States() []FlagState {
+	names := make([]string, 0, len(flagDefaults))
+	for name := range flagDefaults {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	states := make([]FlagState, 0, len(names))
+	for _, name := range names {
+		st := FlagState{
+			Name:    name,
+			Default: flagDefaults[name],
+			Enabled: f.Enabled(name, ""),
+			Regions: make(map[string]bool, len(regions)),
+		}
+		for region := range regions {
+			st.Regions[region] = f.Enabled(name, region)
+		}
+		f.mu.RLock()
+		if s, ok := f.config[name]; ok {
+			st.Config = &s
+		}
+		if s, ok := f.overrides[name]; ok {
+			st.Override = &s
+		}
+		f.mu.RUnlock()
+		states = append(states, st)
+	}
+	return states
+}
+
+// SetOverride replaces a flag's admin override and persists it. An empty
+// setting removes the override.
+func (f *FeatureFlags) SetOverride(name string, s FlagSetting) error {
+	if _, ok := flagDefaults[name]; !ok {
+		return fmt.Errorf("unknown flag %q", name)
+	}
+	for region := range s.Regions {
+		if _, ok := regions[region]; !ok {
+			return fmt.Errorf("unknown region %q", region)
+		}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.overrides == nil {
+		f.overrides = make(map[string]FlagSetting)
+	}
+	if s.Enabled == nil && len(s.Regions) == 0 {
+		delete(f.overrides, name)
+	} else {
+		f.overrides[name] = s
+	}
+	if f.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(f.overrides, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(f.path, data, 0o644)
+}
+
+// handleFeatures serves the feature flags (admin).
+//
+//	GET    /api/admin/features          — every flag, effective globally and per region
+//	PUT    /api/admin/features/{flag}   — set the override {"enabled", "regions": {"socal": false}}
+//	DELETE /api/admin/features/{flag}   — drop the override, back to config and defaults
+func handleFeatures(w http.ResponseWriter, r *http.Request) {
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/admin/features"), "/")
+	if name == "" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(features.States())
+		return
+	}
+	if _, ok := flagDefaults[name]; !ok {
+		http.Error(w, "Unknown feature flag", http.StatusNotFound)
+		return
+	}
+
+	var setting FlagSetting
+	switch r.Method {
+	case http.MethodPut:
+		if err := json.NewDecoder(r.Body).Decode(&setting); err != nil {
+			http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	case http.MethodDelete:
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	for region := range setting.Regions {
+		if _, ok := regions[region]; !ok {
+			http.Error(w, "Unknown region: "+region, http.StatusBadRequest)
+			return
+		}
+	}
+	if err := features.SetOverride(name, setting); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	auditLog.Record(r, "feature.set", map[string]interface{}{"flag": name, "enabled": setting.Enabled, "regions": setting.Regions})
+	requestLog(serverLog, r).Info("Feature flag changed", "flag", name, "enabled", features.Enabled(name, ""))
+	for _, st := range features.States() {
+		if st.Name == name {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(st)
+		}
+	}
+}
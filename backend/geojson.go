@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// GeoJSON (RFC 7946) types — just enough for points and polygons.
+type GeoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []GeoJSONFeature `json:"features"`
+}
+
+type GeoJSONFeature struct {
+	Type       string                 `json:"type"`
+	ID         string                 `json:"id,omitempty"`
+	Geometry   GeoJSONGeometry        `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type GeoJSONGeometry struct {
+	Type        string      `json:"type"`
+	Coordinates interface{} `json:"coordinates"`
+}
+
+// currentAirspace returns the cached picture for a region, or an empty one
+// if the region has not been polled yet.
+func currentAirspace(region string) *AirspaceData {
+	cacheMutex.RLock()
+	data, exists := airspaceCache[region]
+	cacheMutex.RUnlock()
+
+	if !exists {
+		data = &AirspaceData{
+			Timestamp: time.Now().Unix(),
+			Aircraft:  []Aircraft{},
+			Region:    region,
+			Count:     0,
+		}
+	}
+	return data
+}
+
+// aircraftFeature converts an aircraft to a Point feature carrying the
+// Aircraft fields as properties. Aircraft without a position are skipped.
+func aircraftFeature(ac Aircraft) (GeoJSONFeature, bool) {
+	if ac.Latitude == nil || ac.Longitude == nil {
+		return GeoJSONFeature{}, false
+	}
+	coords := []float64{*ac.Longitude, *ac.Latitude}
+	if ac.BaroAltitude != nil {
+		coords = append(coords, *ac.BaroAltitude)
+	}
+
+	// Round-trip through JSON so properties use the same names as /api/aircraft
+	var props map[string]interface{}
+	raw, _ := json.Marshal(ac)
+	json.Unmarshal(raw, &props)
+
+	return GeoJSONFeature{
+		Type:       "Feature",
+		ID:         ac.ICAO24,
+		Geometry:   GeoJSONGeometry{Type: "Point", Coordinates: coords},
+		Properties: props,
+	}, true
+}
+
+// zoneFeature converts a zone to a Polygon feature. RFC 7946 wants the ring
+// closed and counterclockwise, so both are enforced here rather than
+// requiring it of ZONES_FILE authors.
+func zoneFeature(z Zone) GeoJSONFeature {
+	ring := z.Ring()
+	var area float64
+	for i := 0; i+1 < len(ring); i++ {
+		area += ring[i][0]*ring[i+1][1] - ring[i+1][0]*ring[i][1]
+	}
+	if area < 0 {
+		for i, j := 0, len(ring)-1; i < j; i, j = i+1, j-1 {
+			ring[i], ring[j] = ring[j], ring[i]
+		}
+	}
+
+	return GeoJSONFeature{
+		Type:     "Feature",
+		ID:       z.ID,
+		Geometry: GeoJSONGeometry{Type: "Polygon", Coordinates: [][][2]float64{ring}},
+		Properties: map[string]interface{}{
+			"id":                 z.ID,
+			"name":               z.Name,
+			"region":             z.Region,
+			"severity":           z.Severity,
+			"alertOnEntry":       z.AlertOnEntry,
+			"alertOnExit":        z.AlertOnExit,
+			"dwellMinutes":       z.DwellMinutes,
+			"alertOnLostContact": z.AlertOnLostContact,
+		},
+	}
+}
+
+func writeGeoJSON(w http.ResponseWriter, features []GeoJSONFeature) {
+	if features == nil {
+		features = []GeoJSONFeature{}
+	}
+	w.Header().Set("Content-Type", "application/geo+json")
+	json.NewEncoder(w).Encode(GeoJSONFeatureCollection{Type: "FeatureCollection", Features: features})
+}
+
+// handleAircraftGeoJSON serves the current air picture as a FeatureCollection.
+// GET /api/aircraft.geojson?region=
+func handleAircraftGeoJSON(w http.ResponseWriter, r *http.Request) {
+	region := r.URL.Query().Get("region")
+	if region == "" {
+		region = "socal"
+	}
+
+	var features []GeoJSONFeature
+	for _, ac := range currentAirspace(region).Aircraft {
+		if f, ok := aircraftFeature(ac); ok {
+			features = append(features, f)
+		}
+	}
+	writeGeoJSON(w, features)
+}
+
+// handleZonesGeoJSON serves airspace zones as a FeatureCollection.
+// GET /api/zones.geojson[?region=]
+func handleZonesGeoJSON(w http.ResponseWriter, r *http.Request) {
+	var features []GeoJSONFeature
+	for _, z := range zonesFiltered(r.URL.Query().Get("region")) {
+		features = append(features, zoneFeature(z))
+	}
+	writeGeoJSON(w, features)
+}
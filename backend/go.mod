@@ -5,6 +5,12 @@ go 1.21
 require (
 	github.com/gorilla/websocket v1.5.1
 	github.com/rs/cors v1.10.1
+	github.com/yuin/gopher-lua v1.1.1
+	golang.org/x/crypto v0.17.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
-require golang.org/x/net v0.17.0 // indirect
+require (
+	golang.org/x/net v0.17.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
+)
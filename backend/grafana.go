@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Grafana JSON datasource (simpod-json-datasource) endpoints. Point the
+// datasource URL at /api/grafana; targets are "<region>:<metric>", e.g.
+// "socal:aircraft_count".
+
+type grafanaQuery struct {
+	Range struct {
+		From time.Time `json:"from"`
+		To   time.Time `json:"to"`
+	} `json:"range"`
+	MaxDataPoints int `json:"maxDataPoints"`
+	Targets       []struct {
+		Target string `json:"target"`
+		RefID  string `json:"refId"`
+		Hide   bool   `json:"hide"`
+	} `json:"targets"`
+}
+
+type grafanaSeries struct {
+	Target     string       `json:"target"`
+	Datapoints [][2]float64 `json:"datapoints"`
+}
+
+// grafanaTargets lists every region:metric combination the principal's
+// workspace may see.
+func grafanaTargets(p *Principal) []string {
+	var targets []string
+	for region := range regions {
+		if !workspaceAllows(p, region) {
+			continue
+		}
+		for metric := range regionMetrics {
+			targets = append(targets, region+":"+metric)
+		}
+	}
+	sort.Strings(targets)
+	return targets
+}
+
+// handleGrafana routes /api/grafana/{,search,metrics,query}.
+func handleGrafana(w http.ResponseWriter, r *http.Request) {
+	switch strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/grafana"), "/") {
+	case "":
+		// Datasource health check
+		w.WriteHeader(http.StatusOK)
+	case "/search":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(grafanaTargets(principalFrom(r)))
+	case "/metrics":
+		var options []map[string]string
+		for _, t := range grafanaTargets(principalFrom(r)) {
+			options = append(options, map[string]string{"label": t, "value": t})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(options)
+	case "/query":
+		handleGrafanaQuery(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func handleGrafanaQuery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var q grafanaQuery
+	if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Targets name their region in the body, where scopeToWorkspace
+	// doesn't look.
+	p := principalFrom(r)
+	result := make([]grafanaSeries, 0, len(q.Targets))
+	for _, t := range q.Targets {
+		if t.Hide || t.Target == "" {
+			continue
+		}
+		region, metric, ok := strings.Cut(t.Target, ":")
+		if !ok {
+			http.Error(w, "target must be <region>:<metric>", http.StatusBadRequest)
+			return
+		}
+		if !workspaceAllows(p, region) {
+			http.Error(w, fmt.Sprintf("region %q is not in your workspace", region), http.StatusForbidden)
+			return
+		}
+		result = append(result, grafanaSeries{
+			Target:     t.Target,
+			Datapoints: metricHistory.Series(region, metric, q.Range.From, q.Range.To, q.MaxDataPoints),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
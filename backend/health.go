@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// storageDir is DATA_DIR, probed by /readyz.
+var storageDir string
+
+// anthropicAuth remembers how the Anthropic API last answered, so /readyz
+// can report a rejected key without spending a request of its own.
+var anthropicAuth struct {
+	sync.Mutex
+	rejected bool
+	status   int
+	at       time.Time
+}
+
+// noteAnthropicStatus records the HTTP status of an Anthropic API call.
+func noteAnthropicStatus(status int) {
+	anthropicAuth.Lock()
+	defer anthropicAuth.Unlock()
+	anthropicAuth.rejected = status == http.StatusUnauthorized || status == http.StatusForbidden
+	anthropicAuth.status = status
+	anthropicAuth.at = time.Now()
+}
+
+// HealthCheck is one dependency in the /readyz response.
+type HealthCheck struct {
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail"`
+}
+
+// RegionFreshness is a region's entry in the data check.
+type RegionFreshness struct {
+	OK         bool            `json:"ok"`
+	AgeSeconds int64           `json:"ageSeconds"`
+	Aircraft   int             `json:"aircraft"`
+	Upstream   *UpstreamStatus `json:"upstream,omitempty"`
+}
+
+// handleHealthz is the liveness probe: it answers as long as the process
+// can serve HTTP, so an orchestrator restarts only a wedged process.
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":        "ok",
+		"uptimeSeconds": int64(time.Since(startTime).Seconds()),
+		"goroutines":    runtime.NumGoroutine(),
+	})
+}
+
+// handleReadyz is the readiness probe. It answers 503 until at least one
+// region has fresh aircraft data, while the Anthropic key is being rejected,
+// when DATA_DIR can't be written, and once shutdown has begun.
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+	dataCheck, regionState := checkDataFreshness()
+	checks := map[string]HealthCheck{
+		"data":      dataCheck,
+		"anthropic": checkAnthropic(),
+		"storage":   checkStorage(),
+	}
+	select {
+	case <-stopping:
+		checks["shutdown"] = HealthCheck{OK: false, Detail: "shutting down"}
+	default:
+	}
+
+	ready := true
+	for _, c := range checks {
+		ready = ready && c.OK
+	}
+	status, code := "ready", http.StatusOK
+	if !ready {
+		status, code = "not ready", http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":    status,
+		"timestamp": time.Now().Unix(),
+		"checks":    checks,
+		"regions":   regionState,
+		"mode":      currentMode(),
+	})
+}
+
+// checkDataFreshness passes if any region's cache was updated within three
+// poll intervals (at least 10s).
+func checkDataFreshness() (HealthCheck, map[string]RegionFreshness) {
+	maxAge := 3 * pollInterval.Get()
+	if maxAge < 10*time.Second {
+		maxAge = 10 * time.Second
+	}
+	now := time.Now().Unix()
+	state := make(map[string]RegionFreshness, len(regions))
+	fresh := 0
+	cacheMutex.RLock()
+	for name := range regions {
+		data := airspaceCache[name]
+		if data == nil {
+			state[name] = RegionFreshness{AgeSeconds: -1, Upstream: upstream.Status(name)}
+			continue
+		}
+		age := now - data.Timestamp
+		ok := age <= int64(maxAge.Seconds())
+		state[name] = RegionFreshness{OK: ok, AgeSeconds: age, Aircraft: len(data.Aircraft), Upstream: upstream.Status(name)}
+		if ok {
+			fresh++
+		}
+	}
+	cacheMutex.RUnlock()
+
+	if fresh == 0 {
+		return HealthCheck{Detail: fmt.Sprintf("no region updated in the last %s", maxAge)}, state
+	}
+	return HealthCheck{OK: true, Detail: fmt.Sprintf("%d of %d regions fresh", fresh, len(regions))}, state
+}
+
+// checkAnthropic passes unless the configured key was rejected on its last
+// use. Without a key, analysis is off and the check passes.
+func checkAnthropic() HealthCheck {
+	if getSecret("ANTHROPIC_API_KEY") == "" {
+		return HealthCheck{OK: true, Detail: "not configured, analysis disabled"}
+	}
+	anthropicAuth.Lock()
+	defer anthropicAuth.Unlock()
+	switch {
+	case anthropicAuth.at.IsZero():
+		return HealthCheck{OK: true, Detail: "configured, not used yet"}
+	case anthropicAuth.rejected:
+		return HealthCheck{Detail: fmt.Sprintf("key rejected with HTTP %d at %s", anthropicAuth.status, anthropicAuth.at.UTC().Format(time.RFC3339))}
+	default:
+		return HealthCheck{OK: true, Detail: fmt.Sprintf("last call HTTP %d at %s", anthropicAuth.status, anthropicAuth.at.UTC().Format(time.RFC3339))}
+	}
+}
+
+// checkStorage passes if a file can be created in DATA_DIR.
+func checkStorage() HealthCheck {
+	f, err := os.CreateTemp(storageDir, ".readyz-*")
+	if err != nil {
+		return HealthCheck{Detail: err.Error()}
+	}
+	name := f.Name()
+	_, err = f.Write([]byte("ok"))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	os.Remove(name)
+	if err != nil {
+		return HealthCheck{Detail: err.Error()}
+	}
+	return HealthCheck{OK: true, Detail: storageDir + " writable"}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxHeatmapCells bounds the grid so a fine cell size over a large region
+// can't exhaust memory.
+const maxHeatmapCells = 250000
+
+// heatmapGrid counts observed positions per cell over a region's bounding
+// box. Rows run south to north and columns west to east.
+type heatmapGrid struct {
+	region       Region
+	cell         float64 // degrees
+	rows, cols   int
+	observations []int
+	aircraft     []map[string]bool
+	total        int
+}
+
+func newHeatmapGrid(r Region, cell float64) (*heatmapGrid, error) {
+	rows := int(math.Ceil((r.MaxLat - r.MinLat) / cell))
+	cols := int(math.Ceil((r.MaxLon - r.MinLon) / cell))
+	if rows*cols > maxHeatmapCells {
+		return nil, fmt.Errorf("cell %g° gives %d cells (max %d); use a larger cell", cell, rows*cols, maxHeatmapCells)
+	}
+	return &heatmapGrid{
+		region: r, cell: cell, rows: rows, cols: cols,
+		observations: make([]int, rows*cols),
+		aircraft:     make([]map[string]bool, rows*cols),
+	}, nil
+}
+
+// index returns the cell containing (lat, lon), or -1 outside the region.
+func (g *heatmapGrid) index(lat, lon float64) int {
+	r := g.region
+	if lat < r.MinLat || lat > r.MaxLat || lon < r.MinLon || lon > r.MaxLon {
+		return -1
+	}
+	row := min(int((lat-r.MinLat)/g.cell), g.rows-1)
+	col := min(int((lon-r.MinLon)/g.cell), g.cols-1)
+	return row*g.cols + col
+}
+
+func (g *heatmapGrid) add(lat, lon float64, icao24 string) {
+	i := g.index(lat, lon)
+	if i < 0 {
+		return
+	}
+	g.observations[i]++
+	if g.aircraft[i] == nil {
+		g.aircraft[i] = make(map[string]bool)
+	}
+	g.aircraft[i][icao24] = true
+	g.total++
+}
+
+func (g *heatmapGrid) peak() int {
+	peak := 0
+	for _, n := range g.observations {
+		peak = max(peak, n)
+	}
+	return peak
+}
+
+// intensity scales a count logarithmically to 0..1 against the peak, so a
+// single busy airport doesn't wash out every corridor.
+func intensity(n, peak int) float64 {
+	if n == 0 || peak == 0 {
+		return 0
+	}
+	return math.Log1p(float64(n)) / math.Log1p(float64(peak))
+}
+
+// Features returns one Polygon per non-empty cell.
+func (g *heatmapGrid) Features() []GeoJSONFeature {
+	peak := g.peak()
+	var features []GeoJSONFeature
+	for i, n := range g.observations {
+		if n == 0 {
+			continue
+		}
+		row, col := i/g.cols, i%g.cols
+		south, west := g.region.MinLat+float64(row)*g.cell, g.region.MinLon+float64(col)*g.cell
+		north, east := math.Min(south+g.cell, g.region.MaxLat), math.Min(west+g.cell, g.region.MaxLon)
+		ring := [][2]float64{{west, south}, {east, south}, {east, north}, {west, north}, {west, south}}
+		features = append(features, GeoJSONFeature{
+			Type:     "Feature",
+			Geometry: GeoJSONGeometry{Type: "Polygon", Coordinates: [][][2]float64{ring}},
+			Properties: map[string]interface{}{
+				"observations": n,
+				"aircraft":     len(g.aircraft[i]),
+				"intensity":    math.Round(intensity(n, peak)*1000) / 1000,
+			},
+		})
+	}
+	return features
+}
+
+// mercatorY projects a latitude to Web Mercator y in radians.
+func mercatorY(lat float64) float64 {
+	lat = math.Max(-85.05112878, math.Min(85.05112878, lat))
+	return math.Log(math.Tan(math.Pi/4 + lat*math.Pi/360))
+}
+
+// mercatorLat inverts mercatorY.
+func mercatorLat(y float64) float64 {
+	return (2*math.Atan(math.Exp(y)) - math.Pi/2) * 180 / math.Pi
+}
+
+// heatColor maps 0..1 to a transparent-blue-to-red ramp.
+func heatColor(t float64) color.NRGBA {
+	stops := []struct {
+		at      float64
+		r, g, b float64
+	}{
+		{0, 0, 0, 255}, {0.35, 0, 255, 255}, {0.6, 0, 255, 0}, {0.8, 255, 255, 0}, {1, 255, 0, 0},
+	}
+	for i := 1; i < len(stops); i++ {
+		if t <= stops[i].at {
+			a, b := stops[i-1], stops[i]
+			f := (t - a.at) / (b.at - a.at)
+			return color.NRGBA{
+				R: uint8(a.r + f*(b.r-a.r)),
+				G: uint8(a.g + f*(b.g-a.g)),
+				B: uint8(a.b + f*(b.b-a.b)),
+				A: uint8(90 + 130*t),
+			}
+		}
+	}
+	return color.NRGBA{R: 255, A: 220}
+}
+
+// PNG renders the grid in Web Mercator over the region's bounding box, so
+// it can be laid on a slippy map as an image overlay with those bounds.
+func (g *heatmapGrid) PNG(width int) ([]byte, error) {
+	r := g.region
+	top, bottom := mercatorY(r.MaxLat), mercatorY(r.MinLat)
+	spanX := (r.MaxLon - r.MinLon) * math.Pi / 180
+	height := max(1, int(math.Round(float64(width)*(top-bottom)/spanX)))
+	peak := g.peak()
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for py := 0; py < height; py++ {
+		lat := mercatorLat(top - (float64(py)+0.5)/float64(height)*(top-bottom))
+		for px := 0; px < width; px++ {
+			lon := r.MinLon + (float64(px)+0.5)/float64(width)*(r.MaxLon-r.MinLon)
+			if i := g.index(lat, lon); i >= 0 && g.observations[i] > 0 {
+				img.SetNRGBA(px, py, heatColor(intensity(g.observations[i], peak)))
+			}
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// handleHeatmap serves a density grid of observed positions from position
+// history.
+// GET /api/heatmap?region=&window=24h[&cell=0.05][&format=geojson|png][&width=1024]
+func handleHeatmap(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if positionHistory == nil {
+		http.Error(w, "Position history disabled", http.StatusServiceUnavailable)
+		return
+	}
+	q := r.URL.Query()
+	regionName := q.Get("region")
+	if regionName == "" {
+		regionName = "socal"
+	}
+	region, ok := regions[regionName]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown region %q", regionName), http.StatusBadRequest)
+		return
+	}
+	window := 24 * time.Hour
+	if v := q.Get("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < time.Minute || d > positionHistory.retention {
+			http.Error(w, fmt.Sprintf("window must be a duration from 1m to %s (POSITION_RETENTION)", positionHistory.retention), http.StatusBadRequest)
+			return
+		}
+		window = d
+	}
+	// Default to about 100 cells across the region's longer side.
+	cell := math.Max(region.MaxLat-region.MinLat, region.MaxLon-region.MinLon) / 100
+	if v := q.Get("cell"); v != "" {
+		c, err := strconv.ParseFloat(v, 64)
+		if err != nil || c < 0.001 || c > 5 {
+			http.Error(w, "cell must be from 0.001 to 5 degrees", http.StatusBadRequest)
+			return
+		}
+		cell = c
+	}
+	format := q.Get("format")
+	if format == "" {
+		format = "geojson"
+	}
+	if format != "geojson" && format != "png" {
+		http.Error(w, "Unsupported format (use geojson or png)", http.StatusBadRequest)
+		return
+	}
+	width := 1024
+	if v := q.Get("width"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 64 || n > 4096 {
+			http.Error(w, "width must be from 64 to 4096", http.StatusBadRequest)
+			return
+		}
+		width = n
+	}
+
+	grid, err := newHeatmapGrid(region, cell)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	to := time.Now().UTC()
+	from := to.Add(-window)
+	err = scanPositions(positionHistory.dir, regionName, from, to, func(line []byte) error {
+		var rec PositionRecord
+		if json.Unmarshal(line, &rec) != nil || rec.Latitude == nil || rec.Longitude == nil || rec.Source == sourceManual {
+			return nil
+		}
+		grid.add(*rec.Latitude, *rec.Longitude, rec.ICAO24)
+		return r.Context().Err()
+	})
+	if err != nil {
+		return // client went away
+	}
+
+	w.Header().Set("X-Heatmap-Observations", strconv.Itoa(grid.total))
+	w.Header().Set("X-Heatmap-Cell", strconv.FormatFloat(cell, 'f', -1, 64))
+	if format == "png" {
+		body, err := grid.PNG(width)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// Leaflet: L.imageOverlay(url, [[minLat, minLon], [maxLat, maxLon]])
+		w.Header().Set("X-Heatmap-Bounds", fmt.Sprintf("%g,%g,%g,%g", region.MinLon, region.MinLat, region.MaxLon, region.MaxLat))
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(body)
+		return
+	}
+	writeGeoJSON(w, grid.Features())
+}
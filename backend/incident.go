@@ -0,0 +1,250 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// PagerDuty Events API v2 severities keyed by SENTINEL threat level
+var pagerDutySeverity = map[string]string{
+	"CRITICAL": "critical",
+	"HIGH":     "error",
+	"MEDIUM":   "warning",
+	"LOW":      "info",
+	"NOMINAL":  "info",
+}
+
+// Opsgenie priorities keyed by SENTINEL threat level
+var opsgeniePriority = map[string]string{
+	"CRITICAL": "P1",
+	"HIGH":     "P2",
+	"MEDIUM":   "P3",
+	"LOW":      "P4",
+	"NOMINAL":  "P5",
+}
+
+// IncidentNotifier opens, updates, and resolves PagerDuty or Opsgenie
+// incidents keyed to alert identity. It remembers the severity last sent for
+// each open incident so a re-firing alert does not page twice.
+type IncidentNotifier struct {
+	provider    string // "pagerduty" or "opsgenie"
+	key         string // PagerDuty routing key or Opsgenie API key
+	apiURL      string
+	minSeverity string
+	client      *http.Client
+
+	mu   sync.Mutex
+	open map[string]string // alert key -> severity last sent
+}
+
+// newIncidentNotifiersFromEnv builds a notifier for each configured provider.
+//
+//	PAGERDUTY_ROUTING_KEY   — Events API v2 integration key
+//	OPSGENIE_API_KEY        — Opsgenie API integration key
+//	OPSGENIE_API_URL        — defaults to https://api.opsgenie.com (use api.eu.opsgenie.com for EU)
+//	INCIDENT_MIN_SEVERITY   — lowest threat level that opens an incident (default HIGH)
+func newIncidentNotifiersFromEnv() []AlertNotifier {
+	minSeverity := strings.ToUpper(os.Getenv("INCIDENT_MIN_SEVERITY"))
+	if _, ok := threatRank[minSeverity]; !ok {
+		minSeverity = "HIGH"
+	}
+
+	var notifiers []AlertNotifier
+	if key := getSecret("PAGERDUTY_ROUTING_KEY"); key != "" {
+		notifiers = append(notifiers, newIncidentNotifier("pagerduty", key, "https://events.pagerduty.com", minSeverity))
+	}
+	if key := getSecret("OPSGENIE_API_KEY"); key != "" {
+		apiURL := os.Getenv("OPSGENIE_API_URL")
+		if apiURL == "" {
+			apiURL = "https://api.opsgenie.com"
+		}
+		notifiers = append(notifiers, newIncidentNotifier("opsgenie", key, apiURL, minSeverity))
+	}
+	return notifiers
+}
+
+func newIncidentNotifier(provider, key, apiURL, minSeverity string) *IncidentNotifier {
+	return &IncidentNotifier{
+		provider:    provider,
+		key:         key,
+		apiURL:      strings.TrimRight(apiURL, "/"),
+		minSeverity: minSeverity,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		open:        make(map[string]string),
+	}
+}
+
+// Restore treats restored alerts at or above the paging threshold as open
+// incidents. Some may never have been opened, if their route skipped this
+// provider or the trigger failed; resolving those is harmless, as both
+// providers ignore a resolve for an unknown dedup key or alias.
+func (n *IncidentNotifier) Restore(active []Alert) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, a := range active {
+		if threatRank[a.Severity] >= threatRank[n.minSeverity] {
+			n.open[a.Key] = a.Severity
+		}
+	}
+}
+
+func (n *IncidentNotifier) Name() string {
+	return n.provider
+}
+
+// Notify maps an alert transition onto the incident lifecycle.
+func (n *IncidentNotifier) Notify(event string, alert *Alert) error {
+	n.mu.Lock()
+	lastSeverity, isOpen := n.open[alert.Key]
+	n.mu.Unlock()
+
+	if event == AlertResolved {
+		if !isOpen {
+			return nil
+		}
+		if err := n.resolve(alert); err != nil {
+			return err
+		}
+		n.mu.Lock()
+		delete(n.open, alert.Key)
+		n.mu.Unlock()
+		return nil
+	}
+
+	if event == AlertAcked {
+		if !isOpen {
+			return nil
+		}
+		return n.acknowledge(alert)
+	}
+
+	if threatRank[alert.Severity] < threatRank[n.minSeverity] {
+		// Dropped below the paging threshold: close anything we opened earlier
+		if isOpen {
+			return n.Notify(AlertResolved, alert)
+		}
+		return nil
+	}
+	if isOpen && lastSeverity == alert.Severity {
+		return nil // re-fire of an incident that is already open at this severity
+	}
+
+	var err error
+	if isOpen {
+		err = n.update(alert)
+	} else {
+		err = n.trigger(alert)
+	}
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	n.open[alert.Key] = alert.Severity
+	n.mu.Unlock()
+	return nil
+}
+
+func (n *IncidentNotifier) trigger(alert *Alert) error {
+	if n.provider == "pagerduty" {
+		return n.pagerDutyEvent("trigger", alert)
+	}
+
+	details := make(map[string]string, len(alert.Details)+2)
+	for k, v := range alert.Details {
+		details[k] = fmt.Sprint(v)
+	}
+	details["region"] = alert.Region
+	details["icao24"] = alert.ICAO24
+
+	return n.post("POST", "/v2/alerts", map[string]interface{}{
+		"message":     truncate(alert.Title, 130),
+		"alias":       alert.Key,
+		"description": alert.Message,
+		"priority":    opsgeniePriority[alert.Severity],
+		"source":      "swarm-c2",
+		"entity":      alert.Callsign,
+		"tags":        []string{alert.Region, alert.Kind},
+		"details":     details,
+	})
+}
+
+func (n *IncidentNotifier) update(alert *Alert) error {
+	if n.provider == "pagerduty" {
+		// A trigger with the same dedup_key updates the open incident in place
+		return n.pagerDutyEvent("trigger", alert)
+	}
+	alias := url.PathEscape(alert.Key)
+	return n.post("PUT", "/v2/alerts/"+alias+"/priority?identifierType=alias", map[string]interface{}{
+		"priority": opsgeniePriority[alert.Severity],
+	})
+}
+
+func (n *IncidentNotifier) resolve(alert *Alert) error {
+	if n.provider == "pagerduty" {
+		return n.pagerDutyEvent("resolve", alert)
+	}
+	alias := url.PathEscape(alert.Key)
+	return n.post("POST", "/v2/alerts/"+alias+"/close?identifierType=alias", map[string]interface{}{
+		"source": "swarm-c2",
+		"note":   "Condition cleared",
+	})
+}
+
+func (n *IncidentNotifier) acknowledge(alert *Alert) error {
+	if n.provider == "pagerduty" {
+		return n.pagerDutyEvent("acknowledge", alert)
+	}
+	alias := url.PathEscape(alert.Key)
+	return n.post("POST", "/v2/alerts/"+alias+"/acknowledge?identifierType=alias", map[string]interface{}{
+		"source": "swarm-c2",
+		"user":   alert.AckedBy,
+		"note":   alert.AckNote,
+	})
+}
+
+func (n *IncidentNotifier) pagerDutyEvent(action string, alert *Alert) error {
+	event := map[string]interface{}{
+		"routing_key":  n.key,
+		"event_action": action,
+		"dedup_key":    alert.Key,
+	}
+	if action == "trigger" {
+		event["payload"] = map[string]interface{}{
+			"summary":        truncate(alert.Title, 1024),
+			"source":         "swarm-c2/" + alert.Region,
+			"severity":       pagerDutySeverity[alert.Severity],
+			"component":      alert.ICAO24,
+			"group":          alert.Region,
+			"class":          alert.Kind,
+			"custom_details": alert.Details,
+		}
+	}
+	return n.post("POST", "/v2/enqueue", event)
+}
+
+func (n *IncidentNotifier) post(method, path string, body interface{}) error {
+	var header http.Header
+	if n.provider == "opsgenie" {
+		header = http.Header{"Authorization": {"GenieKey " + n.key}}
+	}
+	return postJSON(n.client, method, n.apiURL+path, body, header, nil)
+}
+
+// truncate shortens s to at most max bytes without splitting a UTF-8
+// sequence.
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max]
+}
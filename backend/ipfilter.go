@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+// ipFilter holds the network access rules. A nil allow list means any
+// address not denied is allowed.
+type ipFilter struct {
+	allow, deny []netip.Prefix
+}
+
+var (
+	clientFilter   *ipFilter
+	trustedProxies []netip.Prefix
+)
+
+// loadIPRulesFromEnv reads comma-separated IPs or CIDRs:
+//
+//	IP_ALLOW         — only these clients may connect, e.g. "10.20.0.0/16,192.168.1.5"
+//	IP_DENY          — these clients are refused, checked before IP_ALLOW
+//	TRUSTED_PROXIES  — reverse proxies whose X-Forwarded-For is believed
+func loadIPRulesFromEnv() error {
+	var err error
+	if trustedProxies, err = parsePrefixes("TRUSTED_PROXIES"); err != nil {
+		return err
+	}
+	allow, err := parsePrefixes("IP_ALLOW")
+	if err != nil {
+		return err
+	}
+	deny, err := parsePrefixes("IP_DENY")
+	if err != nil {
+		return err
+	}
+	if len(allow) > 0 || len(deny) > 0 {
+		clientFilter = &ipFilter{allow: allow, deny: deny}
+	}
+	return nil
+}
+
+func parsePrefixes(name string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, s := range splitList(os.Getenv(name)) {
+		if !strings.Contains(s, "/") {
+			addr, err := netip.ParseAddr(s)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %q is not an IP or CIDR", name, s)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %q is not an IP or CIDR", name, s)
+		}
+		prefixes = append(prefixes, p.Masked())
+	}
+	return prefixes, nil
+}
+
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowed reports whether a client address passes the rules. Unparseable
+// addresses are refused when any rule is configured.
+func (f *ipFilter) allowed(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	if containsAddr(f.deny, addr) {
+		return false
+	}
+	return len(f.allow) == 0 || containsAddr(f.allow, addr)
+}
+
+// filterIPs refuses clients outside IP_ALLOW or inside IP_DENY with 403
+// before any routing, CORS, or authentication happens.
+func filterIPs(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if clientFilter != nil {
+			if ip := clientIP(r); !clientFilter.allowed(ip) {
+				requestLog(authLog, r).Warn("Refused by IP rules", "method", r.Method, "path", r.URL.Path, "ip", ip)
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientIP returns the address of the client that made the request. When
+// the direct peer is a trusted proxy, X-Forwarded-For is walked from the
+// right, skipping further trusted proxies; entries further left were
+// supplied by the client and can't be believed.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if len(trustedProxies) == 0 || !isTrustedProxy(host) {
+		return host
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		if !isTrustedProxy(hop) {
+			return hop
+		}
+		host = hop
+	}
+	return host
+}
+
+func isTrustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	return err == nil && containsAddr(trustedProxies, addr.Unmap())
+}
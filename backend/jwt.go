@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// accessClaims are the JWT claims of an access token.
+type accessClaims struct {
+	Issuer    string `json:"iss"`
+	Subject   string `json:"sub"`
+	SessionID string `json:"sid,omitempty"`
+	Role      string `json:"role"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+const jwtIssuer = "swarm-c2"
+
+var (
+	jwtSecret []byte
+	jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+	errTokenInvalid = errors.New("invalid token")
+	errTokenExpired = errors.New("token expired")
+)
+
+// loadJWTSecret uses JWT_SECRET, or a random secret generated once into
+// dataDir/jwt_secret so tokens survive restarts.
+func loadJWTSecret(dataDir string) error {
+	if s := getSecret("JWT_SECRET"); s != "" {
+		if len(s) < 32 {
+			return fmt.Errorf("JWT_SECRET must be at least 32 characters")
+		}
+		jwtSecret = []byte(s)
+		return nil
+	}
+
+	path := filepath.Join(dataDir, "jwt_secret")
+	if data, err := os.ReadFile(path); err == nil && len(data) >= 32 {
+		jwtSecret = data
+		return nil
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dataDir, 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, secret, 0o600); err != nil {
+		return fmt.Errorf("write JWT secret: %w", err)
+	}
+	jwtSecret = secret
+	return nil
+}
+
+// signJWT encodes claims as an HS256 JWT.
+func signJWT(claims accessClaims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signingInput + "." + jwtSignature(signingInput), nil
+}
+
+// verifyJWT checks the signature, issuer, and expiry of an HS256 token. Only
+// our own header is accepted, which rules out alg=none and algorithm swaps.
+func verifyJWT(token string) (accessClaims, error) {
+	var claims accessClaims
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != jwtHeader {
+		return claims, errTokenInvalid
+	}
+	if !hmac.Equal([]byte(parts[2]), []byte(jwtSignature(parts[0]+"."+parts[1]))) {
+		return claims, errTokenInvalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || json.Unmarshal(payload, &claims) != nil || claims.Issuer != jwtIssuer {
+		return claims, errTokenInvalid
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return claims, errTokenExpired
+	}
+	return claims, nil
+}
+
+func jwtSignature(signingInput string) string {
+	mac := hmac.New(sha256.New, jwtSecret)
+	mac.Write([]byte(signingInput))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// looksLikeJWT distinguishes bearer JWTs from API keys.
+func looksLikeJWT(s string) bool {
+	return strings.Count(s, ".") == 2
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// withTestAuth gives a test its own JWT secret and an in-memory user store
+// holding one analyst, alice, and returns a live session of hers.
+func withTestAuth(t *testing.T) Session {
+	t.Helper()
+	oldSecret, oldStore := jwtSecret, userStore
+	t.Cleanup(func() { jwtSecret, userStore = oldSecret, oldStore })
+
+	jwtSecret = []byte("0123456789abcdef0123456789abcdef")
+	userStore = &UserStore{users: map[string]*User{}, sessions: map[string]*Session{}, refresh: map[string]refreshToken{}}
+	if _, err := userStore.Create("alice", "correct horse battery", RoleAnalyst); err != nil {
+		t.Fatal(err)
+	}
+	sess, err := userStore.StartSession("alice", httptest.NewRequest("POST", "/api/auth/login", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sess
+}
+
+func testClaims(sessionID string) accessClaims {
+	now := time.Now()
+	return accessClaims{
+		Issuer:    jwtIssuer,
+		Subject:   "alice",
+		SessionID: sessionID,
+		Role:      RoleAnalyst,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(time.Minute).Unix(),
+	}
+}
+
+func mustSign(t *testing.T, c accessClaims) string {
+	t.Helper()
+	token, err := signJWT(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestVerifyJWT(t *testing.T) {
+	withTestAuth(t)
+	valid := mustSign(t, testClaims(""))
+	parts := strings.Split(valid, ".")
+	b64 := base64.RawURLEncoding.EncodeToString
+
+	expired := testClaims("")
+	expired.ExpiresAt = time.Now().Add(-time.Second).Unix()
+	otherIssuer := testClaims("")
+	otherIssuer.Issuer = "someone-else"
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"valid", valid, nil},
+		{"tampered payload", parts[0] + "." + b64([]byte(`{"iss":"swarm-c2","sub":"alice","role":"admin","exp":9999999999}`)) + "." + parts[2], errTokenInvalid},
+		{"tampered signature", parts[0] + "." + parts[1] + "." + b64([]byte("not the signature")), errTokenInvalid},
+		{"alg none", b64([]byte(`{"alg":"none","typ":"JWT"}`)) + "." + parts[1] + ".", errTokenInvalid},
+		{"other header, same signature input", b64([]byte(`{"typ":"JWT","alg":"HS256"}`)) + "." + parts[1] + "." + parts[2], errTokenInvalid},
+		{"two parts", parts[0] + "." + parts[1], errTokenInvalid},
+		{"other issuer", mustSign(t, otherIssuer), errTokenInvalid},
+		{"expired", mustSign(t, expired), errTokenExpired},
+	}
+	for _, tt := range tests {
+		if _, err := verifyJWT(tt.token); !errors.Is(err, tt.want) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	// A token signed with another secret
+	jwtSecret = []byte("fedcba9876543210fedcba9876543210")
+	if _, err := verifyJWT(valid); !errors.Is(err, errTokenInvalid) {
+		t.Errorf("other secret: err = %v, want %v", err, errTokenInvalid)
+	}
+}
+
+func TestAuthenticateAccessToken(t *testing.T) {
+	sess := withTestAuth(t)
+	token := mustSign(t, testClaims(sess.ID))
+
+	p := authenticate(token)
+	if p == nil || p.Kind != "user" || p.Name != "alice" || p.Role != RoleAnalyst || p.SessionID != sess.ID {
+		t.Fatalf("authenticate = %+v", p)
+	}
+
+	// Ending the session cuts off its access tokens before they expire.
+	if _, err := userStore.RevokeSession(sess.ID, ""); err != nil {
+		t.Fatal(err)
+	}
+	if p := authenticate(token); p != nil {
+		t.Errorf("revoked session: authenticate = %+v, want nil", p)
+	}
+
+	// So does disabling the account, whatever the session.
+	sess2, err := userStore.StartSession("alice", httptest.NewRequest("POST", "/api/auth/login", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token = mustSign(t, testClaims(sess2.ID))
+	if authenticate(token) == nil {
+		t.Fatal("new session: authenticate = nil")
+	}
+	disabled := true
+	if _, err := userStore.Update("alice", UserUpdate{Disabled: &disabled}); err != nil {
+		t.Fatal(err)
+	}
+	if p := authenticate(token); p != nil {
+		t.Errorf("disabled user: authenticate = %+v, want nil", p)
+	}
+	if p := authenticate(mustSign(t, testClaims(""))); p != nil {
+		t.Errorf("disabled user, no session: authenticate = %+v, want nil", p)
+	}
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	sess := withTestAuth(t)
+	first, err := userStore.IssueRefreshToken("alice", sess.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, sid, ok := userStore.UseRefreshToken(first)
+	if !ok || u.Username != "alice" || sid != sess.ID {
+		t.Fatalf("UseRefreshToken = %q, %q, %v", u.Username, sid, ok)
+	}
+	second, err := userStore.IssueRefreshToken("alice", sid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second == first {
+		t.Fatal("rotation returned the same token")
+	}
+
+	// A refresh token works once.
+	if _, _, ok := userStore.UseRefreshToken(first); ok {
+		t.Error("reused refresh token was accepted")
+	}
+	if _, _, ok := userStore.UseRefreshToken(second); !ok {
+		t.Error("rotated refresh token was refused")
+	}
+
+	// Logging out ends the session along with its tokens.
+	third, err := userStore.IssueRefreshToken("alice", sid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userStore.RevokeRefreshToken(third)
+	if userStore.SessionActive(sid) {
+		t.Error("session still active after logout")
+	}
+	if _, _, ok := userStore.UseRefreshToken(third); ok {
+		t.Error("refresh token accepted after logout")
+	}
+
+	// Disabling the account revokes its outstanding tokens.
+	sess2, err := userStore.StartSession("alice", httptest.NewRequest("POST", "/api/auth/login", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fourth, err := userStore.IssueRefreshToken("alice", sess2.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	disabled := true
+	if _, err := userStore.Update("alice", UserUpdate{Disabled: &disabled}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := userStore.UseRefreshToken(fourth); ok {
+		t.Error("refresh token accepted for a disabled user")
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// KML colors are aabbggrr.
+type kmlIconStyle struct {
+	ID    string
+	Color string
+	Scale float64
+}
+
+var kmlAircraftStyles = []kmlIconStyle{
+	{"threat-CRITICAL", "ff0000ff", 1.4},
+	{"threat-HIGH", "ff0080ff", 1.3},
+	{"threat-MEDIUM", "ff00ffff", 1.2},
+	{"watchlist", "ffff00ff", 1.2},
+	{"military", "ff00ff00", 1.1},
+	{"civil", "ffffffff", 0.9},
+}
+
+var kmlZoneColors = map[string]string{
+	"CRITICAL": "0000ff",
+	"HIGH":     "0080ff",
+	"MEDIUM":   "00ffff",
+	"LOW":      "ff8000",
+}
+
+const kmlAircraftIcon = "https://maps.google.com/mapfiles/kml/shapes/airports.png"
+
+// kmlStyleFor picks an aircraft's style: an AI threat assessment of MEDIUM
+// or above wins, then watchlist, then military classification.
+func kmlStyleFor(ac Aircraft, threats map[string]string) kmlIconStyle {
+	id := "civil"
+	if level := threats[ac.ICAO24]; threatRank[level] >= threatRank["MEDIUM"] {
+		id = "threat-" + level
+	} else if _, ok := watchlist.Match(ac); ok {
+		id = "watchlist"
+	} else if mil, _ := classifyMilitary(ac); mil {
+		id = "military"
+	}
+	for _, s := range kmlAircraftStyles {
+		if s.ID == id {
+			return s
+		}
+	}
+	return kmlAircraftStyles[len(kmlAircraftStyles)-1]
+}
+
+func xmlEscape(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// requestBaseURL reconstructs the externally visible scheme and host.
+func requestBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host
+}
+
+// handleAircraftKML serves a NetworkLink that Google Earth refreshes every
+// poll interval; the link points back here with snapshot=1 for the data.
+// GET /api/aircraft.kml?region=
+func handleAircraftKML(w http.ResponseWriter, r *http.Request) {
+	region := r.URL.Query().Get("region")
+	if region == "" {
+		region = "socal"
+	}
+	w.Header().Set("Content-Type", "application/vnd.google-earth.kml+xml")
+
+	if r.URL.Query().Get("snapshot") != "" {
+		writeKMLSnapshot(w, region)
+		return
+	}
+
+	params := url.Values{"region": {region}, "snapshot": {"1"}}
+	if p := principalFrom(r); p != nil && p.Kind == "apikey" {
+		params.Set("api_key", requestCredential(r)) // Google Earth can't send headers
+	}
+	href := fmt.Sprintf("%s/api/aircraft.kml?%s", requestBaseURL(r), params.Encode())
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "swarm-c2-"+region+".kml"))
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<kml xmlns="http://www.opengis.net/kml/2.2">
+  <NetworkLink>
+    <name>SWARM C2 — %s</name>
+    <open>1</open>
+    <flyToView>1</flyToView>
+    <Link>
+      <href>%s</href>
+      <refreshMode>onInterval</refreshMode>
+      <refreshInterval>%g</refreshInterval>
+    </Link>
+  </NetworkLink>
+</kml>
+`, xmlEscape(region), xmlEscape(href), pollInterval.Get().Seconds())
+}
+
+// writeKMLSnapshot renders the current air picture and zone overlays.
+func writeKMLSnapshot(w http.ResponseWriter, region string) {
+	data := currentAirspace(region)
+	threats := analysisThreats(region)
+
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<kml xmlns="http://www.opengis.net/kml/2.2">
+<Document>
+`)
+	fmt.Fprintf(&b, "<name>%s — %s</name>\n", xmlEscape(region), time.Unix(data.Timestamp, 0).UTC().Format(time.RFC3339))
+
+	for _, s := range kmlAircraftStyles {
+		fmt.Fprintf(&b, `<Style id="%s"><IconStyle><color>%s</color><scale>%g</scale><Icon><href>%s</href></Icon></IconStyle><LabelStyle><color>%s</color><scale>0.7</scale></LabelStyle></Style>
+`, s.ID, s.Color, s.Scale, kmlAircraftIcon, s.Color)
+	}
+	for sev, bgr := range kmlZoneColors {
+		fmt.Fprintf(&b, `<Style id="zone-%s"><LineStyle><color>ff%s</color><width>2</width></LineStyle><PolyStyle><color>40%s</color></PolyStyle></Style>
+`, sev, bgr, bgr)
+	}
+
+	b.WriteString("<Folder><name>Zones</name>\n")
+	for _, z := range zonesForRegion(region) {
+		coords := make([]string, 0, len(z.Polygon)+1)
+		for _, p := range z.Ring() {
+			coords = append(coords, fmt.Sprintf("%f,%f,0", p[0], p[1]))
+		}
+		fmt.Fprintf(&b, `<Placemark><name>%s</name><description>%s zone</description><styleUrl>#zone-%s</styleUrl><Polygon><outerBoundaryIs><LinearRing><coordinates>%s</coordinates></LinearRing></outerBoundaryIs></Polygon></Placemark>
+`, xmlEscape(z.Name), xmlEscape(z.Severity), xmlEscape(z.Severity), strings.Join(coords, " "))
+	}
+	b.WriteString("</Folder>\n<Folder><name>Aircraft</name>\n")
+
+	for _, ac := range data.Aircraft {
+		if ac.Latitude == nil || ac.Longitude == nil {
+			continue
+		}
+		alt, heading := 0.0, 0.0
+		if ac.BaroAltitude != nil {
+			alt = *ac.BaroAltitude
+		}
+		if ac.TrueTrack != nil {
+			heading = *ac.TrueTrack
+		}
+		altMode := "absolute"
+		if ac.OnGround {
+			altMode = "clampToGround"
+		}
+
+		// The description balloon is HTML, so values are HTML-escaped before
+		// the whole thing is XML-escaped.
+		desc := fmt.Sprintf("ICAO24: %s<br/>Origin: %s<br/>Altitude: %.0f m",
+			html.EscapeString(ac.ICAO24), html.EscapeString(ac.OriginCountry), alt)
+		if ac.Velocity != nil {
+			desc += fmt.Sprintf("<br/>Speed: %.0f m/s", *ac.Velocity)
+		}
+		if ac.Squawk != nil {
+			desc += "<br/>Squawk: " + html.EscapeString(*ac.Squawk)
+		}
+		if level := threats[ac.ICAO24]; level != "" {
+			desc += "<br/>Threat: " + html.EscapeString(level)
+		}
+
+		// The IconStyle is repeated inline because a per-placemark heading
+		// would otherwise replace the shared icon and color.
+		style := kmlStyleFor(ac, threats)
+		fmt.Fprintf(&b, `<Placemark id="%s"><name>%s</name><description>%s</description><styleUrl>#%s</styleUrl><Style><IconStyle><color>%s</color><scale>%g</scale><heading>%.0f</heading><Icon><href>%s</href></Icon></IconStyle></Style><Point><altitudeMode>%s</altitudeMode><coordinates>%f,%f,%.0f</coordinates></Point></Placemark>
+`, xmlEscape(ac.ICAO24), xmlEscape(displayCallsign(ac)), xmlEscape(desc), style.ID,
+			style.Color, style.Scale, heading, kmlAircraftIcon, altMode, *ac.Longitude, *ac.Latitude, alt)
+	}
+	b.WriteString("</Folder>\n</Document>\n</kml>\n")
+
+	w.Write([]byte(b.String()))
+}
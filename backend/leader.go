@@ -0,0 +1,292 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Cluster coordinates replicas through Redis. Each region has a lease, and
+// only its holder polls for aircraft, runs scheduled SENTINEL analysis,
+// sends alert notifications, and feeds outbound CoT, MAVLink, and data
+// pushes for it. The leader writes each picture and analysis to Redis;
+// every other replica reads them from there, so all of them serve clients
+// from the same data. Work that belongs to no region (alerts without one)
+// follows a separate "global" lease.
+type Cluster struct {
+	redis  *redisClient
+	id     string
+	lease  time.Duration
+	prefix string
+
+	mu       sync.RWMutex
+	until    map[string]time.Time // election -> leadership valid until
+	failing  bool
+	analyses map[string]string // region -> last analysis JSON applied
+}
+
+// cluster is nil when running standalone; a nil Cluster leads everything.
+var cluster *Cluster
+
+// globalElection is the lease for work not tied to a region.
+const globalElection = "_global"
+
+// acquireScript takes the lease if it is free and renews it if we hold it.
+const acquireScript = `local v = redis.call('GET', KEYS[1])
+if v == ARGV[1] then return redis.call('PEXPIRE', KEYS[1], ARGV[2]) end
+if not v then redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2]) return 1 end
+return 0`
+
+// releaseScript deletes the lease only if we still hold it.
+const releaseScript = `if redis.call('GET', KEYS[1]) == ARGV[1] then return redis.call('DEL', KEYS[1]) end
+return 0`
+
+// newClusterFromEnv returns nil when LEADER_REDIS_URL is unset.
+//
+//	LEADER_REDIS_URL  — redis://[:password@]host:port[/db] shared by all replicas
+//	LEADER_LEASE      — lease length (default 15s), renewed every third of it
+//	LEADER_KEY_PREFIX — Redis key prefix (default "swarm-c2:")
+//	INSTANCE_ID       — this replica's name in leases and logs (default host-pid)
+func newClusterFromEnv() (*Cluster, error) {
+	raw := getSecret("LEADER_REDIS_URL")
+	if raw == "" {
+		return nil, nil
+	}
+	rc, err := newRedisClient(raw)
+	if err != nil {
+		return nil, fmt.Errorf("LEADER_REDIS_URL: %w", err)
+	}
+	c := &Cluster{
+		redis:    rc,
+		lease:    15 * time.Second,
+		prefix:   "swarm-c2:",
+		until:    make(map[string]time.Time),
+		analyses: make(map[string]string),
+	}
+	if v := os.Getenv("LEADER_LEASE"); v != "" {
+		if c.lease, err = time.ParseDuration(v); err != nil || c.lease < 3*time.Second {
+			return nil, fmt.Errorf("LEADER_LEASE: %q is not a duration of at least 3s", v)
+		}
+	}
+	if v := os.Getenv("LEADER_KEY_PREFIX"); v != "" {
+		c.prefix = v
+	}
+	if c.id = os.Getenv("INSTANCE_ID"); c.id == "" {
+		host, _ := os.Hostname()
+		c.id = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	if _, err := rc.Do("PING"); err != nil {
+		return nil, fmt.Errorf("LEADER_REDIS_URL: %w", err)
+	}
+	return c, nil
+}
+
+// IsLeader reports whether this replica holds region's lease ("" for the
+// global one).
+func (c *Cluster) IsLeader(region string) bool {
+	if c == nil {
+		return true
+	}
+	if region == "" {
+		region = globalElection
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return time.Now().Before(c.until[region])
+}
+
+// isLeader is cluster.IsLeader, for call sites that gate work on it.
+func isLeader(region string) bool {
+	return cluster.IsLeader(region)
+}
+
+// elections returns the leases to campaign for: every region, then global.
+func (c *Cluster) elections() []string {
+	names := make([]string, 0, len(regions)+1)
+	for name := range regions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return append(names, globalElection)
+}
+
+// Run campaigns for every lease until shutdown, then releases the ones held
+// so another replica takes over without waiting for them to expire.
+func (c *Cluster) Run() {
+	ticker := time.NewTicker(c.lease / 3)
+	defer ticker.Stop()
+	for {
+		for _, name := range c.elections() {
+			c.campaign(name)
+		}
+		select {
+		case <-stopping:
+			c.release()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// campaign acquires or renews one lease. Leadership is counted from before
+// the request and ends a fifth of a lease early, so this replica stops
+// acting as leader before Redis would let another one start.
+func (c *Cluster) campaign(name string) {
+	start := time.Now()
+	reply, err := c.redis.Do("EVAL", acquireScript, "1", c.prefix+"leader:"+name, c.id, strconv.FormatInt(c.lease.Milliseconds(), 10))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	was := start.Before(c.until[name])
+	if err != nil {
+		if !c.failing {
+			serverLog.Warn("Leader election: Redis unavailable", "err", err)
+			c.failing = true
+		}
+		if was {
+			serverLog.Warn("Leadership will lapse unless Redis recovers", "election", name, "until", c.until[name].Format(time.RFC3339))
+		}
+		return
+	}
+	if c.failing {
+		serverLog.Info("Leader election: Redis reachable again")
+		c.failing = false
+	}
+	if reply == int64(1) {
+		c.until[name] = start.Add(c.lease * 4 / 5)
+		if !was {
+			serverLog.Info("Became leader", "election", name, "instance", c.id)
+		}
+		return
+	}
+	delete(c.until, name)
+	if was {
+		serverLog.Warn("Lost leadership", "election", name, "instance", c.id)
+	}
+}
+
+func (c *Cluster) release() {
+	c.mu.Lock()
+	held := make([]string, 0, len(c.until))
+	for name := range c.until {
+		held = append(held, name)
+	}
+	c.until = make(map[string]time.Time)
+	c.mu.Unlock()
+	for _, name := range held {
+		if _, err := c.redis.Do("EVAL", releaseScript, "1", c.prefix+"leader:"+name, c.id); err != nil {
+			serverLog.Warn("Failed to release leadership", "election", name, "err", err)
+		}
+	}
+	if len(held) > 0 {
+		serverLog.Info("Released leadership", "elections", len(held))
+	}
+	c.redis.Close()
+}
+
+// PublishAirspace shares the leader's picture of a region with the other
+// replicas. It expires after a lease so followers never serve a picture
+// nobody is updating any more.
+func (c *Cluster) PublishAirspace(data *AirspaceData) {
+	if c == nil {
+		return
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+	if _, err := c.redis.Do("SET", c.prefix+"airspace:"+data.Region, string(raw), "PX", strconv.FormatInt(c.lease.Milliseconds(), 10)); err != nil {
+		fetcherLog.Warn("Failed to share aircraft picture", "region", data.Region, "err", err)
+	}
+}
+
+// PublishAnalysis shares an analysis, scheduled or on demand, with the other
+// replicas.
+func (c *Cluster) PublishAnalysis(analysis *TacticalAnalysis) {
+	if c == nil {
+		return
+	}
+	raw, err := json.Marshal(analysis)
+	if err != nil {
+		return
+	}
+	c.mu.Lock()
+	c.analyses[analysis.Region] = string(raw)
+	c.mu.Unlock()
+	if _, err := c.redis.Do("SET", c.prefix+"analysis:"+analysis.Region, string(raw), "PX", strconv.FormatInt((24*time.Hour).Milliseconds(), 10)); err != nil {
+		analyzerLog.Warn("Failed to share analysis", "region", analysis.Region, "err", err)
+	}
+}
+
+// FetchAirspace returns the region's shared picture, or nil if the leader
+// hasn't written one recently.
+func (c *Cluster) FetchAirspace(region string) (*AirspaceData, error) {
+	reply, err := c.redis.Do("GET", c.prefix+"airspace:"+region)
+	if errors.Is(err, redisNil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var data AirspaceData
+	if err := json.Unmarshal([]byte(reply.(string)), &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// FetchAnalysis returns the region's shared analysis if it is one this
+// replica hasn't applied yet.
+func (c *Cluster) FetchAnalysis(region string) (*TacticalAnalysis, error) {
+	reply, err := c.redis.Do("GET", c.prefix+"analysis:"+region)
+	if errors.Is(err, redisNil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	raw := reply.(string)
+	c.mu.Lock()
+	seen := c.analyses[region] == raw
+	c.analyses[region] = raw
+	c.mu.Unlock()
+	if seen {
+		return nil, nil
+	}
+	var analysis TacticalAnalysis
+	if err := json.Unmarshal([]byte(raw), &analysis); err != nil {
+		return nil, err
+	}
+	return &analysis, nil
+}
+
+// followLeader brings a follower's region up to date from Redis: the
+// aircraft picture, if newer than the cached one, and any analysis not yet
+// applied. Leaders call it too, to pick up on-demand analyses run on other
+// replicas.
+func followLeader(region string) {
+	if !isLeader(region) {
+		data, err := cluster.FetchAirspace(region)
+		if err != nil {
+			fetcherLog.Warn("Failed to read shared aircraft picture", "region", region, "err", err)
+		} else if data != nil {
+			cacheMutex.RLock()
+			cached := airspaceCache[region]
+			cacheMutex.RUnlock()
+			if cached == nil || data.Timestamp > cached.Timestamp {
+				ingestAirspace(data)
+			}
+		}
+	}
+	analysis, err := cluster.FetchAnalysis(region)
+	if err != nil {
+		analyzerLog.Warn("Failed to read shared analysis", "region", region, "err", err)
+	} else if analysis != nil {
+		applyAnalysis(region, analysis)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// sdNotify sends a state string to systemd's notification socket. It does
+// nothing outside a Type=notify unit (NOTIFY_SOCKET unset).
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	// A leading "@" is an abstract socket; the net package handles that.
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// watchdogInterval returns how often to ping systemd's watchdog: half of
+// WatchdogSec, or 0 when it isn't enabled for this process.
+func watchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond / 2
+}
+
+// runSystemdNotify reports readiness to systemd once the server has fresh
+// aircraft data and working storage, so units ordered after this one start
+// against a backend that can serve them. With WatchdogSec set it then pings
+// the watchdog only while data keeps arriving: if the pollers hang, systemd
+// restarts the service. On shutdown it reports STOPPING.
+func runSystemdNotify() {
+	if os.Getenv("NOTIFY_SOCKET") == "" {
+		return
+	}
+	check := time.NewTicker(500 * time.Millisecond)
+	defer check.Stop()
+	for {
+		data, _ := checkDataFreshness()
+		if data.OK && checkStorage().OK {
+			break
+		}
+		select {
+		case <-stopping:
+			sdNotify("STOPPING=1")
+			return
+		case <-check.C:
+		}
+	}
+	if err := sdNotify(fmt.Sprintf("READY=1\nSTATUS=Serving %d regions\nMAINPID=%d", len(regions), os.Getpid())); err != nil {
+		serverLog.Warn("systemd notify failed", "err", err)
+		return
+	}
+	serverLog.Info("Notified systemd: ready")
+
+	var ping <-chan time.Time
+	if interval := watchdogInterval(); interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		ping = ticker.C
+		serverLog.Info("systemd watchdog enabled", "interval", interval.String())
+	}
+	stale := false
+	for {
+		select {
+		case <-stopping:
+			sdNotify("STOPPING=1")
+			return
+		case <-ping:
+		}
+		data, _ := checkDataFreshness()
+		if !data.OK {
+			if !stale {
+				serverLog.Warn("Withholding watchdog ping: no fresh aircraft data", "detail", data.Detail)
+				sdNotify("STATUS=" + data.Detail)
+				stale = true
+			}
+			continue
+		}
+		if stale {
+			sdNotify(fmt.Sprintf("STATUS=Serving %d regions", len(regions)))
+			stale = false
+		}
+		sdNotify("WATCHDOG=1")
+	}
+}
+
+// handleUSR1Signals reopens LOG_FILE (after logrotate has moved it) and
+// dumps the in-memory caches on SIGUSR1. It blocks, so run it in a
+// goroutine.
+func handleUSR1Signals() {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGUSR1)
+	for range sig {
+		if err := logFile.Reopen(); err != nil {
+			serverLog.Error("Failed to reopen log file", "err", err)
+		}
+		path, err := dumpCaches()
+		if err != nil {
+			serverLog.Error("Cache dump failed", "err", err)
+			continue
+		}
+		serverLog.Info("SIGUSR1: reopened log, dumped caches", "path", path)
+	}
+}
+
+// dumpCaches writes the current air picture, analyses, and runtime
+// counters to DATA_DIR/dumps/cache-<time>.json.
+func dumpCaches() (string, error) {
+	cacheMutex.RLock()
+	airspace := make(map[string]*AirspaceData, len(airspaceCache))
+	for region, data := range airspaceCache {
+		airspace[region] = data
+	}
+	cacheMutex.RUnlock()
+	analysisCacheMutex.RLock()
+	analyses := make(map[string]*TacticalAnalysis, len(analysisCache))
+	for region, a := range analysisCache {
+		analyses[region] = a
+	}
+	analysisCacheMutex.RUnlock()
+
+	dir := filepath.Join(storageDir, "dumps")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	now := time.Now().UTC()
+	path := filepath.Join(dir, "cache-"+now.Format("20060102T150405Z")+".json")
+	data, err := json.MarshalIndent(map[string]interface{}{
+		"timestamp": now,
+		"runtime":   swarmVars(),
+		"airspace":  airspace,
+		"analyses":  analyses,
+		"features":  features.States(),
+	}, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return path, os.WriteFile(path, data, 0o644)
+}
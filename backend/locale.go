@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// languageTag matches a BCP 47 tag such as ja, zh-TW, or pt-BR.
+var languageTag = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+
+// languageNames spells out common tags for the prompt; the model handles
+// others from the tag alone.
+var languageNames = map[string]string{
+	"ar":    "Arabic",
+	"de":    "German",
+	"es":    "Spanish",
+	"fr":    "French",
+	"he":    "Hebrew",
+	"hi":    "Hindi",
+	"id":    "Indonesian",
+	"it":    "Italian",
+	"ja":    "Japanese",
+	"ko":    "Korean",
+	"nl":    "Dutch",
+	"pl":    "Polish",
+	"pt":    "Portuguese",
+	"pt-br": "Brazilian Portuguese",
+	"ru":    "Russian",
+	"th":    "Thai",
+	"tr":    "Turkish",
+	"uk":    "Ukrainian",
+	"vi":    "Vietnamese",
+	"zh":    "Simplified Chinese",
+	"zh-cn": "Simplified Chinese",
+	"zh-hk": "Traditional Chinese (Hong Kong)",
+	"zh-tw": "Traditional Chinese (Taiwan)",
+}
+
+// analysisLocales is the language SENTINEL writes in, by region; "" is the
+// default for regions not listed.
+var analysisLocales atomic.Pointer[map[string]string]
+
+// loadAnalysisLocale reads ANALYSIS_LOCALE, comma-separated "tag" or
+// "region=tag" entries, e.g. "zh-TW" or "ja,socal=en". Unset means
+// English.
+func loadAnalysisLocale() error {
+	locales := make(map[string]string)
+	for _, entry := range splitList(os.Getenv("ANALYSIS_LOCALE")) {
+		region, tag, scoped := strings.Cut(entry, "=")
+		if !scoped {
+			region, tag = "", entry
+		}
+		region, tag = strings.TrimSpace(region), strings.TrimSpace(tag)
+		if scoped {
+			if _, ok := regions[region]; !ok {
+				return fmt.Errorf("unknown region %q", region)
+			}
+		}
+		if !languageTag.MatchString(tag) {
+			return fmt.Errorf("%q is not a language tag such as ja or zh-TW", tag)
+		}
+		locales[region] = tag
+	}
+	analysisLocales.Store(&locales)
+	return nil
+}
+
+// analysisLocale returns the language tag for a region's analyses, or ""
+// for English.
+func analysisLocale(region string) string {
+	p := analysisLocales.Load()
+	if p == nil {
+		return ""
+	}
+	tag, ok := (*p)[region]
+	if !ok {
+		tag = (*p)[""]
+	}
+	if lang, _, _ := strings.Cut(strings.ToLower(tag), "-"); lang == "en" {
+		return ""
+	}
+	return tag
+}
+
+// localePromptNote asks SENTINEL to write its prose in another language.
+// Enumerated fields stay in English: alerts, thresholds, and clients match
+// on them.
+func localePromptNote(tag string) string {
+	if tag == "" {
+		return ""
+	}
+	name := languageNames[strings.ToLower(tag)]
+	if name == "" {
+		lang, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		name = languageNames[lang]
+	}
+	lang := fmt.Sprintf("the language with BCP 47 tag %s", tag)
+	if name != "" {
+		lang = fmt.Sprintf("%s (%s)", name, tag)
+	}
+	return fmt.Sprintf("\n\nWrite the free text — summary, each observation's description, each aircraft's reason, and each recommendation's action and rationale — in %s, for operators who read it natively. "+
+		"Keep the JSON keys and every enumerated value (overall_threat_level, type, threat_contribution, threat_level, recommended_action, next_update_priority) exactly as specified in English, "+
+		"and keep callsigns, ICAO24 codes, and squawk codes as they appear in the data.", lang)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// logLevel is shared by every handler so LOG_LEVEL can change on config
+// reload.
+var logLevel = new(slog.LevelVar)
+
+// Component loggers. They are rebuilt by setupLogging; until then they log
+// through the default text handler.
+var (
+	serverLog   = slog.Default()
+	fetcherLog  = slog.Default() // aircraft polling
+	analyzerLog = slog.Default() // SENTINEL analysis
+	wsLog       = slog.Default() // WebSocket connections
+	droneLog    = slog.Default()
+	alertLog    = slog.Default() // alerts, notifiers, zones
+	authLog     = slog.Default() // auth, users, sessions, secrets, access rules
+	feedLog     = slog.Default() // outbound feeds: CoT, ASTERIX, SBS, MAVLink, push
+	historyLog  = slog.Default() // persisted history and audit
+)
+
+// setupLogging installs the slog handler. The standard log package is
+// routed through it too, so stray log.Printf calls and net/http's own
+// messages come out in the same format.
+//
+//	LOG_FORMAT — "text" (default) or "json"
+//	LOG_LEVEL  — debug, info (default), warn, or error; reloads with the config file
+//	LOG_FILE   — append to this file instead of stderr; reopened on SIGUSR1
+func setupLogging() error {
+	if err := loadLogLevel(); err != nil {
+		return err
+	}
+	var out io.Writer = os.Stderr
+	if path := os.Getenv("LOG_FILE"); path != "" {
+		logFile = &reopenableFile{path: path}
+		if err := logFile.Reopen(); err != nil {
+			return fmt.Errorf("LOG_FILE: %w", err)
+		}
+		out = logFile
+	}
+	opts := &slog.HandlerOptions{Level: logLevel}
+	var handler slog.Handler
+	switch format := strings.ToLower(os.Getenv("LOG_FORMAT")); format {
+	case "", "text":
+		handler = slog.NewTextHandler(out, opts)
+	case "json":
+		handler = slog.NewJSONHandler(out, opts)
+	default:
+		return fmt.Errorf("LOG_FORMAT: %q is not text or json", format)
+	}
+	slog.SetDefault(slog.New(handler))
+
+	serverLog = componentLog("server")
+	fetcherLog = componentLog("fetcher")
+	analyzerLog = componentLog("analyzer")
+	wsLog = componentLog("ws")
+	droneLog = componentLog("drones")
+	alertLog = componentLog("alerts")
+	authLog = componentLog("auth")
+	feedLog = componentLog("feeds")
+	historyLog = componentLog("history")
+	return nil
+}
+
+// logFile is LOG_FILE, or nil when logging to stderr.
+var logFile *reopenableFile
+
+// reopenableFile appends to a file that can be reopened by name, so
+// logrotate can move it aside and signal us instead of copytruncate.
+type reopenableFile struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+}
+
+func (r *reopenableFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.f.Write(p)
+}
+
+// Reopen opens the path again and closes the previous file. Safe to call
+// on nil.
+func (r *reopenableFile) Reopen() error {
+	if r == nil {
+		return nil
+	}
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	old := r.f
+	r.f = f
+	r.mu.Unlock()
+	if old != nil {
+		old.Close()
+	}
+	return nil
+}
+
+func componentLog(name string) *slog.Logger {
+	return slog.Default().With("component", name)
+}
+
+// loadLogLevel reads LOG_LEVEL.
+func loadLogLevel() error {
+	v := os.Getenv("LOG_LEVEL")
+	if v == "" {
+		logLevel.Set(slog.LevelInfo)
+		return nil
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(v)); err != nil {
+		return fmt.Errorf("LOG_LEVEL: %q is not debug, info, warn, or error", v)
+	}
+	logLevel.Set(level)
+	return nil
+}
+
+// fatal logs at error level and exits, for configuration errors at startup.
+func fatal(msg string, args ...any) {
+	serverLog.Error(msg, args...)
+	os.Exit(1)
+}
+
+type requestIDKey struct{}
+
+// withRequestID gives every request a correlation ID: the caller's
+// X-Request-ID if it looks sane (e.g. from a proxy), otherwise a new one.
+// It is echoed in the response and attached to the request's log lines,
+// its audit entries, and, for WebSockets, every line about that connection.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			raw := make([]byte, 8)
+			rand.Read(raw)
+			id = hex.EncodeToString(raw)
+		}
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// requestID returns the request's correlation ID, or "" outside
+// withRequestID.
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+	return id
+}
+
+// requestLog returns base annotated with the request's correlation ID.
+func requestLog(base *slog.Logger, r *http.Request) *slog.Logger {
+	if id := requestID(r); id != "" {
+		return base.With("request_id", id)
+	}
+	return base
+}
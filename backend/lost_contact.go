@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// lostContactAfter is how long an airborne track inside a sensitive zone may
+// go without updates before a lost-contact alert fires. Set with LOST_CONTACT_AFTER.
+var lostContactAfter = 60 * time.Second
+
+// evaluateLostContacts raises a lost-contact alert for every aircraft whose
+// last report put it airborne inside a zone with alertOnLostContact, and
+// which has not been heard from since. The alert resolves when the aircraft
+// reappears or the registry forgets it.
+func evaluateLostContacts(region string) {
+	regionZones := zonesForRegion(region)
+	now := time.Now().UTC()
+	seen := make(map[string]bool)
+
+	for _, rec := range trackRegistry.Records(region) {
+		silence := now.Sub(rec.LastSeen)
+		last := rec.Last
+		// Manual tracks go away when an operator or their expiry says so
+		if silence < lostContactAfter || last.OnGround || last.Latitude == nil || last.Longitude == nil || last.Source == sourceManual {
+			continue
+		}
+		lat, lon := *last.Latitude, *last.Longitude
+
+		for _, z := range regionZones {
+			if !z.AlertOnLostContact || !z.Contains(lat, lon) {
+				continue
+			}
+
+			key := fmt.Sprintf("lost_contact:%s:%s", region, rec.ICAO24)
+			seen[key] = true
+
+			details := aircraftDetails(last)
+			details["zoneId"] = z.ID
+			details["zoneName"] = z.Name
+			details["lastSeen"] = rec.LastSeen
+			details["secondsSinceContact"] = math.Round(silence.Seconds())
+			if last.TrueTrack != nil && last.Velocity != nil {
+				// Dead-reckon along the last heading at the last ground speed
+				elat, elon := destinationPoint(lat, lon, *last.TrueTrack, *last.Velocity*silence.Seconds())
+				details["extrapolatedLatitude"] = elat
+				details["extrapolatedLongitude"] = elon
+				details["extrapolatedDistanceKm"] = math.Round(*last.Velocity*silence.Seconds()/10) / 100
+			}
+
+			alertMgr.Raise(Alert{
+				Key:      key,
+				Kind:     "lost_contact",
+				Region:   region,
+				Severity: z.Severity,
+				Title:    fmt.Sprintf("Lost contact with %s in %s", displayCallsign(last), z.Name),
+				Message: fmt.Sprintf("No updates for %s since last report at %.4f, %.4f — possible jamming or low-altitude flight",
+					silence.Round(time.Second), lat, lon),
+				ICAO24:   rec.ICAO24,
+				Callsign: rec.Callsign,
+				Details:  details,
+			})
+			break
+		}
+	}
+
+	alertMgr.ResolveMissing("lost_contact", region, seen)
+}
@@ -2,18 +2,19 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"math"
 	"net/http"
 	"os"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
-	"github.com/rs/cors"
 	"swarm-c2/fprime"
 )
 
@@ -111,8 +112,7 @@ Provide analysis in this JSON structure:
   "pattern_analysis": {
     "formations_detected": 0,
     "unusual_behaviors": 0,
-    "potential_threats": 0,
-    "commercial_density": "LOW|NORMAL|HIGH"
+    "potential_threats": 0
   },
   "next_update_priority": "IMMEDIATE|HIGH|NORMAL|LOW"
 }
@@ -137,6 +137,12 @@ Provide analysis in this JSON structure:
 - Maintain operational security awareness in recommendations`
 
 // Anthropic API structures
+// Anthropic Messages API endpoint and the model SENTINEL runs on
+const (
+	anthropicMessagesURL = "https://api.anthropic.com/v1/messages"
+	anthropicModel       = "claude-sonnet-4-20250514"
+)
+
 type AnthropicMessage struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
@@ -175,6 +181,9 @@ type TacticalAnalysis struct {
 	TacticalRecommendations []map[string]interface{} `json:"tactical_recommendations"`
 	PatternAnalysis       map[string]interface{}   `json:"pattern_analysis"`
 	NextUpdatePriority    string                   `json:"next_update_priority"`
+	SmoothedThreatScore   float64                  `json:"smoothed_threat_score"`
+	Locale                string                   `json:"locale,omitempty"` // language of the free text; empty is English
+	Solar                 *AnalysisSolar           `json:"solar,omitempty"`  // light conditions at analysis time
 	Raw                   string                   `json:"raw,omitempty"`
 }
 
@@ -185,24 +194,29 @@ var (
 
 // Aircraft represents a single aircraft state from OpenSky
 type Aircraft struct {
-	ICAO24         string   `json:"icao24"`
-	Callsign       string   `json:"callsign"`
-	OriginCountry  string   `json:"originCountry"`
-	TimePosition   *int64   `json:"timePosition"`
-	LastContact    int64    `json:"lastContact"`
-	Longitude      *float64 `json:"longitude"`
-	Latitude       *float64 `json:"latitude"`
-	BaroAltitude   *float64 `json:"baroAltitude"`
-	OnGround       bool     `json:"onGround"`
-	Velocity       *float64 `json:"velocity"`
-	TrueTrack      *float64 `json:"trueTrack"`
-	VerticalRate   *float64 `json:"verticalRate"`
-	Sensors        []int    `json:"sensors"`
-	GeoAltitude    *float64 `json:"geoAltitude"`
-	Squawk         *string  `json:"squawk"`
-	SPI            bool     `json:"spi"`
-	PositionSource int      `json:"positionSource"`
-	Category       int      `json:"category"`
+	ICAO24         string           `json:"icao24"`
+	Callsign       string           `json:"callsign"`
+	OriginCountry  string           `json:"originCountry"`
+	TimePosition   *int64           `json:"timePosition"`
+	LastContact    int64            `json:"lastContact"`
+	Longitude      *float64         `json:"longitude"`
+	Latitude       *float64         `json:"latitude"`
+	BaroAltitude   *float64         `json:"baroAltitude"`
+	OnGround       bool             `json:"onGround"`
+	Velocity       *float64         `json:"velocity"`
+	TrueTrack      *float64         `json:"trueTrack"`
+	VerticalRate   *float64         `json:"verticalRate"`
+	Sensors        []int            `json:"sensors"`
+	GeoAltitude    *float64         `json:"geoAltitude"`
+	Squawk         *string          `json:"squawk"`
+	SPI            bool             `json:"spi"`
+	PositionSource int              `json:"positionSource"`
+	Category       int              `json:"category"`
+	Simulated      bool             `json:"simulated,omitempty"`  // injected by a scenario, not a real aircraft
+	Source         string           `json:"source,omitempty"`     // "MANUAL" for operator-entered tracks
+	Bullseye       *BullseyeRef     `json:"bullseye,omitempty"`   // bearing and range from the region's bullseye
+	Coords         *Coords          `json:"coords,omitempty"`     // position in the formats the client asked for
+	Confidence     *TrackConfidence `json:"confidence,omitempty"` // how far the position can be trusted
 }
 
 // AirspaceData represents processed data sent to clients
@@ -211,6 +225,7 @@ type AirspaceData struct {
 	Aircraft  []Aircraft `json:"aircraft"`
 	Region    string     `json:"region"`
 	Count     int        `json:"count"`
+	Scenario  string     `json:"scenario,omitempty"` // name of the scenario mixed in, if any
 }
 
 // Region defines a geographic bounding box
@@ -312,48 +327,396 @@ var (
 	upgrader = websocket.Upgrader{
 		ReadBufferSize:  1024,
 		WriteBufferSize: 1024,
-		CheckOrigin: func(r *http.Request) bool {
-			return true // Allow all origins for demo
-		},
+		CheckOrigin:     checkWebSocketOrigin,
 	}
-	clients      = make(map[*websocket.Conn]string) // conn -> region
-	clientsMutex sync.RWMutex
-	airspaceCache = make(map[string]*AirspaceData)
-	cacheMutex   sync.RWMutex
+	clients          = make(map[*wsClient]string)   // conn -> region
+	clientCoords     = make(map[*wsClient][]string) // conn -> coordinate formats, if any
+	clientWorkspaces = make(map[*wsClient]string)   // conn -> workspace, if any
+	clientsMutex     sync.RWMutex
+	airspaceCache    = make(map[string]*AirspaceData)
+	cacheMutex       sync.RWMutex
 )
 
-func main() {
+// serve runs the server. With a replay, a recording stands in for the
+// aircraft source.
+func serve(replay Replay) {
+	loadSettings()
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
 	}
 
-	// Start simulated aircraft traffic for both regions
-	go simulateAircraftTraffic("socal", 2*time.Second)
-	go simulateAircraftTraffic("europe", 2*time.Second)
+	if err := loadSecretsFromEnv(); err != nil {
+		fatal("Secrets", "err", err)
+	}
+	if s, err := newSentryFromEnv(); err != nil {
+		fatal("Sentry", "err", err)
+	} else if s != nil {
+		sentry = s
+		serverLog.Info("Sentry panic reporting enabled", "environment", s.environment)
+	}
+	if e, err := newOTLPExporterFromEnv(); err != nil {
+		fatal("Tracing", "err", err)
+	} else if e != nil {
+		otlp = e
+		serverLog.Info("OpenTelemetry trace export enabled", "endpoint", e.endpoint, "service", e.service)
+		goPoller("tracing", otlp.Run)
+	}
+	if m, err := startMockOpenSkyFromEnv(); err != nil {
+		fatal("Mock OpenSky", "err", err)
+	} else if m != nil {
+		fetcherLog.Warn("Mock OpenSky enabled: aircraft are simulated, not live", "addr", m.addr, "faults", os.Getenv("MOCK_OPENSKY_FAULTS"))
+	}
+	if o, err := newOpenSkyFromEnv(); err != nil {
+		fatal("OpenSky", "err", err)
+	} else if o != nil {
+		openSky = o
+	}
+	if s, err := newScenarioFromEnv(); err != nil {
+		fatal("Scenario", "err", err)
+	} else if s != nil {
+		scenario = s
+		st := s.Status()
+		fetcherLog.Warn("Scenario loaded: simulated aircraft are mixed into the live picture", "scenario", s.Name,
+			"regions", st.Regions, "aircraft", st.Aircraft, "duration", s.cycle.String(), "loop", s.Loop, "exclusive", s.Exclusive)
+	}
+	if r, err := newSessionRecorderFromEnv(); err != nil {
+		fatal("Session recording", "err", err)
+	} else if r != nil {
+		recorder = r
+		serverLog.Info("Recording session", "path", r.path)
+		goPoller("recorder", recorder.Run)
+	}
 
-	// Start background AI analysis
-	go runTacticalAnalysis("socal", 30*time.Second)
-	go runTacticalAnalysis("europe", 30*time.Second)
+	// Alert lifecycle + notifiers (PagerDuty / Opsgenie / Slack / webhook / SMS / Web Push)
+	alertMgr = newAlertManagerFromEnv()
+	dataDir := os.Getenv("DATA_DIR")
+	if dataDir == "" {
+		dataDir = "./data"
+	}
+	storageDir = dataDir
+	if store, err := OpenAlertStore(dataDir); err != nil {
+		alertLog.Warn("Alert persistence disabled", "err", err)
+	} else {
+		alertStore = store
+		alertMgr.SetStore(store)
+	}
+	if wl, err := OpenWatchlist(dataDir); err != nil {
+		alertLog.Warn("Watchlist not loaded", "err", err)
+	} else {
+		watchlist = wl
+	}
+	if a, err := OpenAnnotations(dataDir); err != nil {
+		serverLog.Warn("Track annotations not loaded", "err", err)
+	} else {
+		annotations = a
+	}
+	if d, err := OpenDrawings(dataDir); err != nil {
+		serverLog.Warn("Map drawings not loaded", "err", err)
+	} else {
+		drawings = d
+	}
+	if b, err := OpenBullseyes(dataDir); err != nil {
+		serverLog.Warn("Bullseyes not loaded", "err", err)
+	} else {
+		bullseyes = b
+	}
+	if err := features.LoadOverrides(dataDir); err != nil {
+		serverLog.Warn("Feature flag overrides not loaded", "err", err)
+	}
+	if h, err := OpenAnalysisHistory(dataDir); err != nil {
+		historyLog.Warn("Analysis history disabled", "err", err)
+	} else {
+		analysisHistory = h
+	}
+	if a, err := OpenAuditLog(dataDir); err != nil {
+		fatal("Audit log", "err", err)
+	} else {
+		auditLog = a
+	}
+	if h, err := newPositionHistoryFromEnv(dataDir); err != nil {
+		fatal("Position history", "err", err)
+	} else if h != nil {
+		positionHistory = h
+		historyLog.Info("Position history enabled", "interval", h.interval.String(), "retention", h.retention.String())
+	}
+	loadContactConfigFromEnv()
+	if d, err := time.ParseDuration(os.Getenv("LOST_CONTACT_AFTER")); err == nil && d > 0 {
+		lostContactAfter = d
+	}
+	if m, err := newMailerFromEnv(); err != nil {
+		fatal("SMTP", "err", err)
+	} else {
+		mailer = m
+	}
+	alertNotifiers = append(alertNotifiers, newIncidentNotifiersFromEnv()...)
+	if channels, err := newChannelNotifiersFromEnv(); err != nil {
+		fatal("Alert notifiers", "err", err)
+	} else {
+		alertNotifiers = append(alertNotifiers, channels...)
+	}
+	if wp, err := newWebPushNotifier(dataDir); err != nil {
+		alertLog.Warn("Web Push disabled", "err", err)
+	} else {
+		webPush = wp
+		alertNotifiers = append(alertNotifiers, wp)
+	}
+	for _, n := range alertNotifiers {
+		alertLog.Info("Alert notifier enabled", "notifier", n.Name())
+		if r, ok := n.(alertRestorer); ok && alertStore != nil {
+			r.Restore(alertStore.Active())
+		}
+	}
+	if err := loadAlertRoutesFromEnv(); err != nil {
+		fatal("Alert routes", "err", err)
+	}
+	if err := loadAPIKeysFromEnv(); err != nil {
+		fatal("API keys", "err", err)
+	}
+	if err := loadWorkspacesFromEnv(dataDir); err != nil {
+		fatal("Workspaces", "err", err)
+	}
+	if store, err := OpenUserStore(dataDir); err != nil {
+		fatal("Users", "err", err)
+	} else {
+		userStore = store
+	}
+	if err := loadJWTSecret(dataDir); err != nil {
+		fatal("JWT secret", "err", err)
+	}
+	if err := loadUserConfigFromEnv(); err != nil {
+		fatal("Users", "err", err)
+	}
+	if err := loadWebSocketConfigFromEnv(); err != nil {
+		fatal("WebSocket", "err", err)
+	}
+	if err := loadShutdownConfigFromEnv(); err != nil {
+		fatal("Shutdown", "err", err)
+	}
+	if !authEnabled() {
+		authLog.Warn("No API_KEYS or user accounts: /api, /ws, and /data are open to anyone who can reach this port")
+	}
+	if err := loadRateLimitsFromEnv(); err != nil {
+		fatal("Rate limits", "err", err)
+	}
+	if err := loadIPRulesFromEnv(); err != nil {
+		fatal("IP rules", "err", err)
+	}
+	if clientFilter != nil {
+		authLog.Info("IP rules enabled", "allowed", len(clientFilter.allow), "denied", len(clientFilter.deny))
+	}
+	c, origins, err := newCORSFromEnv()
+	if err != nil {
+		fatal("CORS", "err", err)
+	}
+	corsPolicy = c
+	if len(origins) == 0 {
+		serverLog.Info("CORS disabled: only same-origin browser clients")
+	} else {
+		serverLog.Info("CORS enabled", "origins", origins)
+	}
+	go alertMgr.Run()
+	goSupervised("alerts", runAlertDispatch)
+	if s, err := newAlertSpeechFromEnv(dataDir); err != nil {
+		fatal("Text-to-speech", "err", err)
+	} else if s != nil {
+		alertSpeech = s
+		alertLog.Info("Alert speech enabled", "engine", s.engine.Name(), "min_severity", s.minSeverity, "stream", s.stream)
+		goPoller("tts", alertSpeech.Run)
+	}
+
+	if err := loadZonesFromEnv(); err != nil {
+		fatal("Zones", "err", err)
+	}
+	if err := loadThreatThresholdsFromEnv(); err != nil {
+		fatal("Threat thresholds", "err", err)
+	}
+	if err := loadManualTrackConfigFromEnv(); err != nil {
+		fatal("Manual tracks", "err", err)
+	}
+	if err := loadAnalyzerPluginsFromEnv(); err != nil {
+		fatal("Analyzer plugins", "err", err)
+	}
+	for _, p := range analyzerPlugins {
+		analyzerLog.Info("Analyzer plugin enabled", "plugin", p.Name, "transport", p.status.Transport, "interval", p.Interval.String())
+		goPoller("plugin:"+p.Name, p.Run)
+	}
+	if host, err := newScriptHostFromEnv(); err != nil {
+		fatal("Scripts", "err", err)
+	} else if host != nil {
+		scriptHost = host
+		alertLog.Info("Scripting enabled", "dir", host.dir, "scripts", len(host.Status()), "timeout", host.timeout.String())
+	}
+	if feed, err := newCoTFeedFromEnv(); err != nil {
+		fatal("CoT feed", "err", err)
+	} else if feed != nil {
+		cotFeed = feed
+		feedLog.Info("CoT feed enabled", "destinations", len(feed.senders))
+	}
+	if feed, err := newAsterixFeedFromEnv(); err != nil {
+		fatal("ASTERIX feed", "err", err)
+	} else if feed != nil {
+		feedLog.Info("ASTERIX CAT021 feed enabled", "sac", feed.sac, "sic", feed.sic, "interval", feed.interval.String(), "destinations", len(feed.dests))
+	}
+	if srv, err := newSBSServerFromEnv(); err != nil {
+		fatal("SBS server", "err", err)
+	} else if srv != nil {
+		sbsServer = srv
+		feedLog.Info("SBS (BaseStation) output listening", "addr", srv.listener.Addr().String())
+	}
+	if pusher, err := newDataPusherFromEnv(); err != nil {
+		fatal("Data push", "err", err)
+	} else if pusher != nil {
+		dataPusher = pusher
+		feedLog.Info("Data push enabled", "destinations", len(pusher.destinations))
+	}
+	if feed, err := newMAVLinkFeedFromEnv(); err != nil {
+		fatal("MAVLink feed", "err", err)
+	} else if feed != nil {
+		mavlinkFeed = feed
+		feedLog.Info("MAVLink ADSB_VEHICLE output enabled", "outputs", len(feed.outputs), "system_id", feed.encoder.SystemID)
+	}
+
+	if rep, err := newReportsFromEnv(dataDir); err != nil {
+		fatal("Scheduled reports", "err", err)
+	} else if rep != nil {
+		reports = rep
+		historyLog.Info("Scheduled reports enabled", "times", os.Getenv("REPORT_TIMES"), "period", rep.period.String(), "email", len(rep.emailTo) > 0)
+		goPoller("reports", reports.Run)
+	}
+
+	if tp, err := newTileProxyFromEnv(dataDir); err != nil {
+		fatal("Tile proxy", "err", err)
+	} else if tp != nil {
+		tileProxy = tp
+		serverLog.Info("Tile proxy enabled", "max_zoom", tp.maxZoom, "cache_ttl", tp.ttl.String(), "cache_max_mb", tp.maxBytes>>20)
+		goPoller("tiles", tileProxy.Run)
+	}
+
+	if t, err := newTaskingFromEnv(); err != nil {
+		fatal("Drone tasking", "err", err)
+	} else if t != nil {
+		tasking = t
+		droneLog.Info("Drone tasking enabled", "drones", len(t.registered), "mqtt", t.broker, "ack_timeout", t.ackTimeout.String())
+		goPoller("tasking", tasking.Run)
+	}
+
+	if c, err := newClusterFromEnv(); err != nil {
+		fatal("Leader election", "err", err)
+	} else if c != nil {
+		cluster = c
+		serverLog.Info("Leader election enabled", "instance", c.id, "lease", c.lease.String())
+		goPoller("leader", cluster.Run)
+	}
+
+	// Poll OpenSky for both regions, or start simulated traffic or the replay
+	modeState.replay = replay != nil
+	modeState.replayAnalysis = replay != nil && replay.ReplaysAnalysis()
+	switch {
+	case replay != nil:
+		goPoller("replay", replay.Run)
+	case openSky != nil:
+		goPoller("fetcher:socal", func() { pollOpenSky("socal") })
+		goPoller("fetcher:europe", func() { pollOpenSky("europe") })
+	default:
+		goPoller("fetcher:socal", func() { simulateAircraftTraffic("socal") })
+		goPoller("fetcher:europe", func() { simulateAircraftTraffic("europe") })
+	}
+
+	// Start background AI analysis, unless the replay has its own
+	if replay == nil || !replay.ReplaysAnalysis() {
+		goPoller("analyzer:socal", func() { runTacticalAnalysis("socal") })
+		goPoller("analyzer:europe", func() { runTacticalAnalysis("europe") })
+	}
+	goPoller("solar", runSolarBroadcast)
+	goSupervised("config", watchConfig)
+	updateMode()
+	goSupervised("mode", runModeMonitor)
 
 	// Start drone simulator
 	droneFleet = fprime.NewFleet()
 	droneSim = fprime.NewSimulator(droneFleet, fprime.DefaultSimConfig())
 	droneSim.Start()
-	log.Println("🚁 Drone simulator started (3 drones in formation)")
+	droneLog.Info("Drone simulator started", "drones", 3)
 
 	mux := http.NewServeMux()
 
 	// WebSocket endpoints
 	mux.HandleFunc("/ws", handleWebSocket)
 	mux.HandleFunc("/ws/drones", handleDroneWebSocket)
+	mux.HandleFunc("/ws/tasking", handleTaskingWebSocket)
 
 	// REST endpoints
 	mux.HandleFunc("/api/aircraft", handleGetAircraft)
+	mux.HandleFunc("/api/aircraft.geojson", handleAircraftGeoJSON)
+	mux.HandleFunc("/api/aircraft.kml", handleAircraftKML)
+	mux.HandleFunc("/data/aircraft.json", handleTar1090Aircraft)
+	mux.HandleFunc("/data/receiver.json", handleTar1090Receiver)
 	mux.HandleFunc("/api/regions", handleGetRegions)
+	mux.HandleFunc("/api/stats", handleStats)
+	mux.HandleFunc("/api/heatmap", handleHeatmap)
+	mux.HandleFunc("/api/snapshot", handleSnapshot)
+	mux.HandleFunc("/tiles/", handleTile)
+	mux.HandleFunc("/api/mode", handleMode)
+	mux.HandleFunc("/api/scenario", handleScenario)
+	mux.HandleFunc("/api/login", handleLogin)
+	mux.HandleFunc("/api/token/refresh", handleTokenRefresh)
+	mux.HandleFunc("/api/logout", handleLogout)
+	mux.HandleFunc("/api/me", handleMe)
+	mux.HandleFunc("/api/users", handleUsers)
+	mux.HandleFunc("/api/users/", handleUserAction)
+	mux.HandleFunc("/api/sessions", handleSessions)
+	mux.HandleFunc("/api/sessions/", handleSessionAction)
+	mux.HandleFunc("/api/admin/audit", handleAudit)
+	mux.HandleFunc("/api/admin/features", handleFeatures)
+	mux.HandleFunc("/api/admin/features/", handleFeatures)
+	mux.HandleFunc("/api/admin/pollers", handlePollers)
+	mux.HandleFunc("/api/admin/pollers/", handlePollers)
+	mux.HandleFunc("/api/admin/analysis/", handleAnalysisControl)
+	mux.HandleFunc("/api/admin/selftest", handleSelfTest)
+	mux.HandleFunc("/api/admin/scenario/restart", handleScenarioRestart)
+	mux.HandleFunc("/api/admin/scripts", handleScripts)
+	mux.HandleFunc("/api/admin/scripts/", handleScripts)
+	mux.HandleFunc("/api/admin/workspaces", handleWorkspaces)
+	mux.HandleFunc("/api/workspace", handleWorkspace)
+	mux.Handle(debugPrefix, mainDebugHandler())
 	mux.HandleFunc("/api/health", handleHealth)
+	mux.HandleFunc("/healthz", handleHealthz)
+	mux.HandleFunc("/readyz", handleReadyz)
+	mux.HandleFunc("/api/openapi.json", handleOpenAPISpec)
+	mux.HandleFunc("/api/grafana", handleGrafana)
+	mux.HandleFunc("/api/grafana/", handleGrafana)
+	mux.HandleFunc("/api/docs", handleAPIDocs)
 	mux.HandleFunc("/api/analysis", handleGetAnalysis)
+	mux.HandleFunc("/api/analysis/export", handleAnalysisExport)
+	mux.HandleFunc("/api/reports", handleReports)
+	mux.HandleFunc("/api/reports/", handleReport)
 	mux.HandleFunc("/api/analyze", handleRunAnalysis)
+	mux.HandleFunc("/api/plugins", handlePlugins)
+	mux.HandleFunc("/api/export/stream", handleExportStream)
+	mux.HandleFunc("/api/alerts", handleGetAlerts)
+	mux.HandleFunc("/api/alerts/", handleAlertAction)
+	mux.HandleFunc("/api/audio/", handleAudio)
+	mux.HandleFunc("/api/tracks/manual", handleManualTracks)
+	mux.HandleFunc("/api/tracks/manual/", handleManualTrack)
+	mux.HandleFunc("/api/tracks/annotations", handleAnnotations)
+	mux.HandleFunc("/api/tracks/", handleTrackAction)
+	mux.HandleFunc("/api/zones", handleGetZones)
+	mux.HandleFunc("/api/zones.geojson", handleZonesGeoJSON)
+	mux.HandleFunc("/api/drawings", handleDrawings)
+	mux.HandleFunc("/api/drawings/", handleDrawing)
+	mux.HandleFunc("/api/drawings.geojson", handleDrawingsGeoJSON)
+	mux.HandleFunc("/api/bullseye", handleBullseyes)
+	mux.HandleFunc("/api/bullseye/", handleBullseye)
+	mux.HandleFunc("/api/bullseye.geojson", handleBullseyesGeoJSON)
+	mux.HandleFunc("/api/solar", handleSolar)
+	mux.HandleFunc("/api/convert", handleConvert)
+	mux.HandleFunc("/api/quality", handleQuality)
+	mux.HandleFunc("/api/watchlist", handleWatchlist)
+	mux.HandleFunc("/api/push/vapid-public-key", handlePushPublicKey)
+	mux.HandleFunc("/api/push/subscribe", handlePushSubscribe)
+	mux.HandleFunc("/api/push/unsubscribe", handlePushUnsubscribe)
 
 	// Drone API endpoints
 	mux.HandleFunc("/api/drones", handleGetDrones)
@@ -362,51 +725,117 @@ func main() {
 	mux.HandleFunc("/api/drones/fsm", handleGetDroneFSM)
 	mux.HandleFunc("/api/drones/config", handleDroneConfig)
 	mux.HandleFunc("/api/drones/validate", handleDroneValidate)
+	mux.HandleFunc("/api/tasking", handleTasking)
+	mux.HandleFunc("/api/tasking/", handleTaskingAction)
 
 	// Serve static files from frontend build (for production)
-	fs := http.FileServer(http.Dir("./static"))
-	mux.Handle("/", fs)
-
-	// CORS configuration
-	c := cors.New(cors.Options{
-		AllowedOrigins:   []string{"*"},
-		AllowedMethods:   []string{"GET", "POST", "OPTIONS"},
-		AllowedHeaders:   []string{"*"},
-		AllowCredentials: true,
-	})
+	static, staticSource, err := staticHandler()
+	if err != nil {
+		fatal("STATIC_DIR", "err", err)
+	}
+	serverLog.Info("Serving web UI", "source", staticSource)
+	mux.Handle("/", static)
+
+	handler := withRequestID(withModeHeader(logRequests(recoverHTTP(filterIPs(c.Handler(rateLimit(requireAuth(mux))))))))
 
-	handler := c.Handler(mux)
+	tlsServer, err := newTLSFromEnv(dataDir)
+	if err != nil {
+		fatal("TLS", "err", err)
+	}
+	httpScheme, wsScheme := "http", "ws"
+	if tlsServer != nil {
+		httpScheme, wsScheme = "https", "wss"
+		serverLog.Info("TLS enabled", "certificates", tlsServer.Mode())
+	}
 
-	log.Printf("Swarm C2 Backend starting on port %s", port)
-	log.Printf("WebSocket: ws://localhost:%s/ws", port)
-	log.Printf("Drone WS: ws://localhost:%s/ws/drones", port)
-	log.Printf("REST API: http://localhost:%s/api/aircraft?region=socal", port)
-	log.Printf("Drone API: http://localhost:%s/api/drones", port)
-	log.Printf("AI Analysis: http://localhost:%s/api/analysis?region=socal", port)
+	if mtlsListener, err = newMTLSFromEnv(); err != nil {
+		fatal("mTLS", "err", err)
+	}
+	if mtlsListener != nil {
+		serverLog.Info("mTLS listener enabled", "addr", mtlsListener.addr, "clients", len(mtlsListener.clients))
+		go func() {
+			if err := mtlsListener.ListenAndServe(handler); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				fatal("mTLS", "err", err)
+			}
+		}()
+	}
+
+	if debugServer := newDebugServerFromEnv(); debugServer != nil {
+		serverLog.Info("Debug listener enabled", "addr", debugServer.Addr)
+		go func() {
+			if err := debugServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				fatal("Debug listener", "err", err)
+			}
+		}()
+	}
 
-	if err := http.ListenAndServe(":"+port, handler); err != nil {
-		log.Fatal(err)
+	serverLog.Info("Swarm C2 Backend starting",
+		"port", port,
+		"websocket", fmt.Sprintf("%s://localhost:%s/ws", wsScheme, port),
+		"drone_ws", fmt.Sprintf("%s://localhost:%s/ws/drones", wsScheme, port),
+		"rest_api", fmt.Sprintf("%s://localhost:%s/api/aircraft?region=socal", httpScheme, port),
+		"drone_api", fmt.Sprintf("%s://localhost:%s/api/drones", httpScheme, port),
+		"analysis", fmt.Sprintf("%s://localhost:%s/api/analysis?region=socal", httpScheme, port))
+
+	go handleShutdownSignals()
+	go handleUSR1Signals()
+	go runSystemdNotify()
+	if tlsServer != nil {
+		err = tlsServer.ListenAndServe(":"+port, handler)
+	} else {
+		err = trackServer(&http.Server{Addr: ":" + port, Handler: handler}).ListenAndServe()
 	}
+	if !errors.Is(err, http.ErrServerClosed) {
+		fatal("Server stopped", "err", err)
+	}
+	<-shutdownDone
 }
 
-// runTacticalAnalysis periodically analyzes aircraft data
-func runTacticalAnalysis(regionName string, interval time.Duration) {
+// runTacticalAnalysis periodically analyzes aircraft data every
+// analysisInterval, picking up changes on config reload and from the admin
+// API.
+func runTacticalAnalysis(regionName string) {
+	interval := pollControl.AnalysisInterval()
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	// Initial analysis after first data fetch
-	time.Sleep(15 * time.Second)
+	select {
+	case <-stopping:
+		return
+	case <-time.After(15 * time.Second):
+	}
 	performAnalysis(regionName)
 
-	for range ticker.C {
+	for {
+		select {
+		case <-stopping:
+			return
+		case <-ticker.C:
+		}
+		if d := pollControl.AnalysisInterval(); d != interval {
+			interval = d
+			ticker.Reset(d)
+		}
 		performAnalysis(regionName)
 	}
 }
 
 func performAnalysis(regionName string) {
-	apiKey := os.Getenv("ANTHROPIC_API_KEY")
+	if !isLeader(regionName) {
+		return
+	}
+	if !features.Enabled(FlagAIAnalysis, regionName) {
+		analyzerLog.Debug("AI analysis disabled by feature flag", "region", regionName)
+		return
+	}
+	if pollControl.AnalysisPaused() {
+		analyzerLog.Debug("AI analysis paused", "region", regionName)
+		return
+	}
+	apiKey := getSecret("ANTHROPIC_API_KEY")
 	if apiKey == "" {
-		log.Printf("[%s] ANTHROPIC_API_KEY not set, skipping analysis", regionName)
+		analyzerLog.Warn("ANTHROPIC_API_KEY not set, skipping analysis", "region", regionName)
 		return
 	}
 
@@ -416,28 +845,60 @@ func performAnalysis(regionName string) {
 	cacheMutex.RUnlock()
 
 	if !exists || len(data.Aircraft) == 0 {
-		log.Printf("[%s] No aircraft data for analysis", regionName)
+		analyzerLog.Info("No aircraft data for analysis", "region", regionName)
 		return
 	}
 
-	analysis, err := callAnthropicAnalysis(apiKey, regionName, data.Aircraft)
+	analysis, err := callAnthropicAnalysis(context.Background(), apiKey, regionName, data.Aircraft)
+	noteAnalysisResult(err)
 	if err != nil {
-		log.Printf("[%s] AI analysis error: %v", regionName, err)
+		analyzerLog.Error("AI analysis failed", "region", regionName, "err", err)
 		return
 	}
 
+	applyAnalysis(regionName, analysis)
+	cluster.PublishAnalysis(analysis)
+	analyzerLog.Info("AI analysis complete", "region", regionName, "threat_level", analysis.OverallThreatLevel, "score", analysis.ThreatScore)
+}
+
+// applyAnalysis scores, caches, records, and broadcasts a new analysis,
+// whether this replica ran it or read it from the leader.
+func applyAnalysis(regionName string, analysis *TacticalAnalysis) {
+	recorder.Analysis(analysis)
+	evaluateThreatThresholds(regionName, analysis)
+
 	// Cache the analysis
 	analysisCacheMutex.Lock()
 	analysisCache[regionName] = analysis
 	analysisCacheMutex.Unlock()
+	if err := analysisHistory.Save(analysis); err != nil {
+		analyzerLog.Error("Failed to record analysis", "region", regionName, "err", err)
+	}
 
-	log.Printf("[%s] AI Analysis complete: %s (Score: %d)", regionName, analysis.OverallThreatLevel, analysis.ThreatScore)
+	syncAnalysisAlerts(regionName, analysis)
 
 	// Broadcast analysis to WebSocket clients
-	broadcastAnalysisToClients(regionName, analysis)
+	broadcastAnalysisToClients(regionName, "", analysis)
+	scriptHost.AnalysisComplete(regionName, analysis)
+}
+
+// applyWorkspaceAnalysis keeps an analysis a workspace ran on demand within
+// the workspace: its members see it until the next shared analysis of the
+// region. The shared cache, history, alerts, and scripts follow only the
+// analyses every workspace sees.
+func applyWorkspaceAnalysis(workspace, region string, analysis *TacticalAnalysis) {
+	analysisCacheMutex.RLock()
+	shared := analysisCache[region]
+	analysisCacheMutex.RUnlock()
+	if shared != nil {
+		// one workspace's run doesn't move the shared threat trend
+		analysis.SmoothedThreatScore = shared.SmoothedThreatScore
+	}
+	workspaces.SetAnalysis(workspace, region, analysis, shared)
+	broadcastAnalysisToClients(region, workspace, analysis)
 }
 
-func callAnthropicAnalysis(apiKey string, region string, aircraft []Aircraft) (*TacticalAnalysis, error) {
+func callAnthropicAnalysis(ctx context.Context, apiKey string, region string, aircraft []Aircraft) (_ *TacticalAnalysis, err error) {
 	// Prepare aircraft data summary for the prompt
 	aircraftJSON, _ := json.MarshalIndent(aircraft, "", "  ")
 
@@ -454,12 +915,18 @@ Provide your tactical analysis in the specified JSON format.`,
 		time.Now().UTC().Format(time.RFC3339),
 		len(aircraft),
 		string(aircraftJSON),
-	)
+	) + manualTrackPromptNote(aircraft) + annotationPromptNote(aircraft) + bullseyePromptNote(region) + qualityPromptNote(aircraft)
+	density := commercialDensity(region, aircraft)
+	userPrompt += commercialDensityPromptNote(density) + analyzerPlugins.PromptNote(region)
+	solar := analysisSolar(region, aircraft)
+	userPrompt += solarPromptNote(solar)
+	locale := analysisLocale(region)
+	userPrompt += localePromptNote(locale)
 
 	reqBody := AnthropicRequest{
-		Model:       "claude-sonnet-4-20250514",
+		Model:       anthropicModel,
 		MaxTokens:   2000,
-		System:      TACTICAL_SYSTEM_PROMPT,
+		System:      systemPrompt(),
 		Messages: []AnthropicMessage{
 			{Role: "user", Content: userPrompt},
 		},
@@ -471,7 +938,9 @@ Provide your tactical analysis in the specified JSON format.`,
 		return nil, fmt.Errorf("marshal request: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", "https://api.anthropic.com/v1/messages", bytes.NewBuffer(jsonBody))
+	ctx, span := startSpan(ctx, "anthropic.messages", SpanClient, "model", anthropicModel, "region", region, "aircraft", len(aircraft))
+	defer func() { span.End(err) }()
+	req, err := http.NewRequestWithContext(ctx, "POST", anthropicMessagesURL, bytes.NewBuffer(jsonBody))
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
@@ -486,6 +955,8 @@ Provide your tactical analysis in the specified JSON format.`,
 		return nil, fmt.Errorf("API request: %w", err)
 	}
 	defer resp.Body.Close()
+	noteAnthropicStatus(resp.StatusCode)
+	span.SetAttrs("http.status_code", resp.StatusCode)
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -535,6 +1006,12 @@ Provide your tactical analysis in the specified JSON format.`,
 
 	analysis.Timestamp = time.Now().UTC().Format(time.RFC3339)
 	analysis.Region = region
+	analysis.Locale = locale
+	analysis.Solar = solar
+	if analysis.PatternAnalysis == nil {
+		analysis.PatternAnalysis = make(map[string]interface{})
+	}
+	analysis.PatternAnalysis["commercial_density"] = density.Level
 
 	return &analysis, nil
 }
@@ -563,20 +1040,25 @@ func findJSONEnd(s string) int {
 	return -1
 }
 
-func broadcastAnalysisToClients(region string, analysis *TacticalAnalysis) {
+// broadcastAnalysisToClients sends an analysis to the region's clients, or
+// with a workspace, to that workspace's clients only.
+func broadcastAnalysisToClients(region, workspace string, analysis *TacticalAnalysis) {
 	message := map[string]interface{}{
 		"type":     "analysis",
 		"region":   region,
 		"analysis": analysis,
 	}
+	if workspace == "" {
+		recorder.Broadcast(region, message)
+	}
 
 	clientsMutex.RLock()
 	defer clientsMutex.RUnlock()
 
 	for conn, clientRegion := range clients {
-		if clientRegion == region {
-			if err := conn.WriteJSON(message); err != nil {
-				log.Printf("Write analysis to client failed: %v", err)
+		if clientRegion == region && (workspace == "" || clientWorkspaces[conn] == workspace) {
+			if err := conn.send(message); err != nil {
+				wsLog.Warn("Write analysis to client failed", "err", err)
 			}
 		}
 	}
@@ -589,10 +1071,13 @@ func handleGetAnalysis(w http.ResponseWriter, r *http.Request) {
 	}
 
 	analysisCacheMutex.RLock()
-	analysis, exists := analysisCache[region]
+	analysis := analysisCache[region]
 	analysisCacheMutex.RUnlock()
+	if p := principalFrom(r); p != nil {
+		analysis = workspaces.Analysis(p.Workspace, region, analysis)
+	}
 
-	if !exists {
+	if analysis == nil {
 		// Return empty analysis if none cached
 		analysis = &TacticalAnalysis{
 			Timestamp:          time.Now().UTC().Format(time.RFC3339),
@@ -619,8 +1104,17 @@ func handleRunAnalysis(w http.ResponseWriter, r *http.Request) {
 		region = "socal"
 	}
 
+	if !features.Enabled(FlagAIAnalysis, region) {
+		http.Error(w, "AI analysis is disabled for this region", http.StatusServiceUnavailable)
+		return
+	}
+	if pollControl.AnalysisPaused() {
+		http.Error(w, "AI analysis is paused", http.StatusServiceUnavailable)
+		return
+	}
+
 	// Run analysis synchronously
-	apiKey := os.Getenv("ANTHROPIC_API_KEY")
+	apiKey := getSecret("ANTHROPIC_API_KEY")
 	if apiKey == "" {
 		http.Error(w, "ANTHROPIC_API_KEY not configured", http.StatusServiceUnavailable)
 		return
@@ -634,101 +1128,161 @@ func handleRunAnalysis(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "No aircraft data available", http.StatusServiceUnavailable)
 		return
 	}
+	workspace := ""
+	if p := principalFrom(r); p != nil {
+		workspace = p.Workspace
+	}
+	if !workspaces.SpendAnalysis(workspace) {
+		w.Header().Set("Retry-After", fmt.Sprint(int(time.Until(nextUTCDay()).Seconds())+1))
+		http.Error(w, fmt.Sprintf("Workspace %s has used its analyses for today", workspace), http.StatusTooManyRequests)
+		return
+	}
 
-	analysis, err := callAnthropicAnalysis(apiKey, region, data.Aircraft)
+	auditLog.Record(r, "analysis.run", map[string]interface{}{"region": region})
+	analysis, err := callAnthropicAnalysis(r.Context(), apiKey, region, data.Aircraft)
+	noteAnalysisResult(err)
 	if err != nil {
+		workspaces.RefundAnalysis(workspace)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// Update cache
-	analysisCacheMutex.Lock()
-	analysisCache[region] = analysis
-	analysisCacheMutex.Unlock()
+	if workspace != "" {
+		applyWorkspaceAnalysis(workspace, region, analysis)
+	} else {
+		applyAnalysis(region, analysis)
+		cluster.PublishAnalysis(analysis)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(analysis)
 }
 
 // simulateAircraftTraffic generates and broadcasts simulated flight positions
-func simulateAircraftTraffic(regionName string, interval time.Duration) {
+// every poll interval, unless paused through the admin API.
+func simulateAircraftTraffic(regionName string) {
 	routes, ok := simRoutes[regionName]
 	if !ok {
 		return
 	}
 
-	log.Printf("[%s] Aircraft simulator started (%d routes)", regionName, len(routes))
-
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
+	fetcherLog.Info("Aircraft simulator started", "region", regionName, "routes", len(routes))
 
-	for range ticker.C {
-		now := time.Now()
-		nowUnix := now.Unix()
-		t := float64(nowUnix)
-
-		var aircraft []Aircraft
-
-		for i, route := range routes {
-			// Each flight cycles along its route with its own period and phase
-			progress := math.Mod((t+route.PhaseOffset), route.CycleSec) / route.CycleSec
-			// Bounce: go out 0→1, then return 1→0
-			if progress > 0.5 {
-				progress = 1.0 - (progress-0.5)*2
-			} else {
-				progress = progress * 2
-			}
-			// Clamp to in-flight range
-			progress = 0.05 + progress*0.9
-
-			lat, lon := greatCircleInterpolate(
-				route.DepLat, route.DepLon,
-				route.ArrLat, route.ArrLon,
-				progress,
-			)
-			bearing := greatCircleBearing(lat, lon, route.ArrLat, route.ArrLon)
-			alt := estimateAltitude(progress)
-			speed := estimateSpeed(progress)
-
-			icao24 := fmt.Sprintf("%06x", (i*7919+42)%0xFFFFFF)
-			vertRate := 0.0
-			if progress < 0.15 {
-				vertRate = 15.0
-			} else if progress > 0.85 {
-				vertRate = -12.0
-			}
+	for {
+		interval := pollControl.Interval(regionName)
+		upstream.SetInterval(regionName, "simulator", interval)
+		forced := false
+		select {
+		case <-stopping:
+			return
+		case <-time.After(interval):
+		case <-pollControl.Wake(regionName):
+			forced = true
+		}
+		if cluster != nil {
+			followLeader(regionName)
+		}
+		if !isLeader(regionName) || (pollControl.Paused(regionName) && !forced) {
+			continue
+		}
+		data := simulatedAirspace(regionName, routes, time.Now())
+		ingestAirspace(data)
+		cluster.PublishAirspace(data)
+	}
+}
 
-			ac := Aircraft{
-				ICAO24:        icao24,
-				Callsign:      route.Callsign,
-				OriginCountry: route.OriginCountry,
-				TimePosition:  &nowUnix,
-				LastContact:   nowUnix,
-				Longitude:     &lon,
-				Latitude:      &lat,
-				BaroAltitude:  &alt,
-				OnGround:      false,
-				Velocity:      &speed,
-				TrueTrack:     &bearing,
-				VerticalRate:  &vertRate,
-				GeoAltitude:   &alt,
-			}
-			aircraft = append(aircraft, ac)
+// simulatedAirspace positions every simulated flight on its route at now.
+func simulatedAirspace(regionName string, routes []SimRoute, now time.Time) *AirspaceData {
+	nowUnix := now.Unix()
+	t := float64(nowUnix)
+
+	var aircraft []Aircraft
+
+	for i, route := range routes {
+		// Each flight cycles along its route with its own period and phase
+		progress := math.Mod((t+route.PhaseOffset), route.CycleSec) / route.CycleSec
+		// Bounce: go out 0→1, then return 1→0
+		if progress > 0.5 {
+			progress = 1.0 - (progress-0.5)*2
+		} else {
+			progress = progress * 2
+		}
+		// Clamp to in-flight range
+		progress = 0.05 + progress*0.9
+
+		lat, lon := greatCircleInterpolate(
+			route.DepLat, route.DepLon,
+			route.ArrLat, route.ArrLon,
+			progress,
+		)
+		bearing := greatCircleBearing(lat, lon, route.ArrLat, route.ArrLon)
+		alt := estimateAltitude(progress)
+		speed := estimateSpeed(progress)
+
+		icao24 := fmt.Sprintf("%06x", (i*7919+42)%0xFFFFFF)
+		vertRate := 0.0
+		if progress < 0.15 {
+			vertRate = 15.0
+		} else if progress > 0.85 {
+			vertRate = -12.0
 		}
 
-		data := &AirspaceData{
-			Timestamp: nowUnix,
-			Aircraft:  aircraft,
-			Region:    regionName,
-			Count:     len(aircraft),
+		ac := Aircraft{
+			ICAO24:        icao24,
+			Callsign:      route.Callsign,
+			OriginCountry: route.OriginCountry,
+			TimePosition:  &nowUnix,
+			LastContact:   nowUnix,
+			Longitude:     &lon,
+			Latitude:      &lat,
+			BaroAltitude:  &alt,
+			OnGround:      false,
+			Velocity:      &speed,
+			TrueTrack:     &bearing,
+			VerticalRate:  &vertRate,
+			GeoAltitude:   &alt,
 		}
+		aircraft = append(aircraft, ac)
+	}
 
-		cacheMutex.Lock()
-		airspaceCache[regionName] = data
-		cacheMutex.Unlock()
+	data := &AirspaceData{
+		Timestamp: nowUnix,
+		Aircraft:  aircraft,
+		Region:    regionName,
+		Count:     len(aircraft),
+	}
+	return data
+}
 
-		broadcastToClients(regionName, data)
+// ingestAirspace caches a new picture of a region and hands it to the
+// clients, alerting, feeds, and history. Outbound pushes come only from the
+// region's leader, so replicas don't send them twice.
+func ingestAirspace(data *AirspaceData) {
+	scenario.Inject(data)
+	manualTracks.Inject(data)
+	bullseyes.Annotate(data)
+	trackQuality.Score(data)
+	recorder.Airspace(data)
+	regionName, aircraft := data.Region, data.Aircraft
+
+	cacheMutex.Lock()
+	airspaceCache[regionName] = data
+	cacheMutex.Unlock()
+
+	broadcastToClients(regionName, data)
+	if isLeader(regionName) {
+		dataPusher.Publish(data)
+		cotFeed.Publish(regionName, aircraft)
+		mavlinkFeed.Publish(regionName, liveAircraft(aircraft))
 	}
+	evaluateGeofences(regionName, aircraft)
+	evaluateNewContacts(regionName, trackRegistry.Observe(regionName, aircraft))
+	evaluateLostContacts(regionName)
+	analyzerPlugins.Publish(data)
+	scriptHost.AircraftUpdate(regionName, aircraft)
+	sbsServer.Publish(liveAircraft(aircraft))
+	recordRegionMetrics(regionName, aircraft)
+	positionHistory.Record(regionName, aircraft)
 }
 
 // greatCircleInterpolate returns lat/lon at fraction t along great circle from A to B
@@ -773,6 +1327,21 @@ func greatCircleBearing(lat1, lon1, lat2, lon2 float64) float64 {
 	return bearing
 }
 
+// destinationPoint returns the point reached from (lat,lon) after travelling distM meters on bearingDeg
+func destinationPoint(lat, lon, bearingDeg, distM float64) (float64, float64) {
+	const earthRadius = 6371000.0
+	latR := lat * math.Pi / 180
+	lonR := lon * math.Pi / 180
+	brg := bearingDeg * math.Pi / 180
+	d := distM / earthRadius
+
+	lat2 := math.Asin(math.Sin(latR)*math.Cos(d) + math.Cos(latR)*math.Sin(d)*math.Cos(brg))
+	lon2 := lonR + math.Atan2(math.Sin(brg)*math.Sin(d)*math.Cos(latR), math.Cos(d)-math.Sin(latR)*math.Sin(lat2))
+
+	lon2Deg := math.Mod(lon2*180/math.Pi+540, 360) - 180
+	return lat2 * 180 / math.Pi, lon2Deg
+}
+
 // estimateAltitude returns altitude in meters based on flight progress
 func estimateAltitude(progress float64) float64 {
 	cruiseAlt := 10668.0 // ~35000 ft in meters
@@ -796,43 +1365,68 @@ func estimateSpeed(progress float64) float64 {
 }
 
 func handleWebSocket(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+	wlog := requestLog(wsLog, r).With("remote", clientIP(r))
+	ws, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Printf("WebSocket upgrade failed: %v", err)
+		wlog.Warn("WebSocket upgrade failed", "err", err)
 		return
 	}
+	conn := &wsClient{conn: ws}
 
 	// Default to Taiwan region
 	region := r.URL.Query().Get("region")
 	if region == "" {
 		region = "socal"
 	}
+	formats, err := parseCoordFormats(r.URL.Query().Get("coords"))
+	if err != nil {
+		wlog.Warn("Ignoring coordinate formats", "err", err)
+	}
 
+	p := principalFrom(r)
 	clientsMutex.Lock()
 	clients[conn] = region
+	if len(formats) > 0 {
+		clientCoords[conn] = formats
+	}
+	if p != nil && p.Workspace != "" {
+		clientWorkspaces[conn] = p.Workspace
+	}
 	clientsMutex.Unlock()
 
-	log.Printf("Client connected, subscribed to: %s", region)
+	wlog.Info("Client connected", "region", region)
 
-	// Send initial cached data if available
+	// Send the operating mode, track annotations, map drawings, bullseyes, the
+	// day/night terminator, and initial cached data if available
+	conn.send(heartbeatMessage(currentMode()))
+	conn.send(map[string]interface{}{"type": "track_annotations", "annotations": annotationsFor(p)})
+	conn.send(map[string]interface{}{"type": "drawings", "drawings": drawingsFor(p)})
+	conn.send(map[string]interface{}{"type": "bullseyes", "bullseyes": bullseyesFor(p)})
+	conn.send(map[string]interface{}{"type": "solar", "solar": computeSolarState(time.Now())})
 	cacheMutex.RLock()
 	if data, exists := airspaceCache[region]; exists {
-		conn.WriteJSON(data)
+		conn.send(airspaceFor(formats, data))
 	}
 	cacheMutex.RUnlock()
 
 	// Handle incoming messages (for region switching)
+	stopWatch := watchWebSocketSession(ws, r)
 	defer func() {
+		stopWatch()
 		clientsMutex.Lock()
 		delete(clients, conn)
+		delete(clientCoords, conn)
+		delete(clientWorkspaces, conn)
 		clientsMutex.Unlock()
-		conn.Close()
-		log.Println("Client disconnected")
+		ws.Close()
+		wlog.Info("Client disconnected")
 	}()
 
 	for {
-		_, msg, err := conn.ReadMessage()
+		touchWebSocket(ws)
+		_, msg, err := ws.ReadMessage()
 		if err != nil {
+			closeIfIdle(ws, err)
 			break
 		}
 
@@ -840,57 +1434,131 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 		var request struct {
 			Action string `json:"action"`
 			Region string `json:"region"`
+			Coords string `json:"coords"`
 		}
 		if json.Unmarshal(msg, &request) == nil && request.Action == "subscribe" {
+			if !workspaceAllows(p, request.Region) {
+				conn.send(map[string]interface{}{"type": "error", "action": request.Action, "error": fmt.Sprintf("region %q is not in your workspace", request.Region)})
+				continue
+			}
 			clientsMutex.Lock()
 			clients[conn] = request.Region
+			formats = clientCoords[conn]
 			clientsMutex.Unlock()
+			auditLog.Record(r, "region.subscribe", map[string]interface{}{"region": request.Region})
 
 			// Send cached data for new region
 			cacheMutex.RLock()
 			if data, exists := airspaceCache[request.Region]; exists {
-				conn.WriteJSON(data)
+				conn.send(airspaceFor(formats, data))
 			}
 			cacheMutex.RUnlock()
 
-			log.Printf("Client switched to region: %s", request.Region)
+			wlog.Info("Client switched region", "region", request.Region)
+		}
+
+		// Handle coordinate format changes; "" goes back to latitude and
+		// longitude only
+		if request.Action == "coords" {
+			formats, err := parseCoordFormats(request.Coords)
+			if err != nil {
+				conn.send(map[string]interface{}{"type": "error", "action": request.Action, "error": err.Error()})
+				continue
+			}
+			clientsMutex.Lock()
+			if len(formats) > 0 {
+				clientCoords[conn] = formats
+			} else {
+				delete(clientCoords, conn)
+			}
+			clientsMutex.Unlock()
+		}
+
+		// Handle map drawing changes
+		if request.Action == "draw" || request.Action == "erase" {
+			if reply := handleDrawingMessage(r, request.Action, msg); reply != nil {
+				conn.send(reply)
+			}
 		}
 	}
 }
 
 func broadcastToClients(region string, data *AirspaceData) {
+	recorder.Broadcast(region, data)
 	clientsMutex.RLock()
 	defer clientsMutex.RUnlock()
 
+	// Clients that asked for other coordinate formats share one copy per
+	// combination.
+	variants := make(map[string]*AirspaceData)
 	for conn, clientRegion := range clients {
 		if clientRegion == region {
-			if err := conn.WriteJSON(data); err != nil {
-				log.Printf("Write to client failed: %v", err)
+			formats := clientCoords[conn]
+			key := fmt.Sprint(formats)
+			out, ok := variants[key]
+			if !ok {
+				out = airspaceFor(formats, data)
+				variants[key] = out
+			}
+			if err := conn.send(out); err != nil {
+				wsLog.Warn("Write to client failed", "err", err)
 			}
 		}
 	}
 }
 
+// airspaceFor returns the picture with coordinates in the given formats.
+func airspaceFor(formats []string, data *AirspaceData) *AirspaceData {
+	if len(formats) == 0 {
+		return data
+	}
+	return withCoords(data, formats)
+}
+
 func handleGetAircraft(w http.ResponseWriter, r *http.Request) {
 	region := r.URL.Query().Get("region")
 	if region == "" {
 		region = "socal"
 	}
+	asCSV, ok := wantsCSV(w, r)
+	if !ok {
+		return
+	}
+	query, err := parseAircraftQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	formats, err := parseCoordFormats(r.URL.Query().Get("coords"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	cacheMutex.RLock()
-	data, exists := airspaceCache[region]
-	cacheMutex.RUnlock()
+	data := *currentAirspace(region)
+	page, total := query.Apply(region, data.Aircraft)
+	data.Aircraft, data.Count = page, len(page)
+	data = *airspaceFor(formats, &data)
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
 
-	if !exists {
-		data = &AirspaceData{
-			Timestamp: time.Now().Unix(),
-			Aircraft:  []Aircraft{},
-			Region:    region,
-			Count:     0,
-		}
+	if asCSV {
+		writeAircraftCSV(w, &data)
+		return
 	}
-
 	w.Header().Set("Content-Type", "application/json")
+	if len(query.Fields) > 0 {
+		if len(formats) > 0 {
+			// coords= asks for the converted positions, so keep them
+			query.Fields = append(query.Fields, "coords")
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"timestamp": data.Timestamp,
+			"aircraft":  query.SelectFields(data.Aircraft),
+			"region":    data.Region,
+			"count":     data.Count,
+		})
+		return
+	}
 	json.NewEncoder(w).Encode(data)
 }
 
@@ -905,21 +1573,23 @@ func handleHealth(w http.ResponseWriter, r *http.Request) {
 		"status":    "ok",
 		"timestamp": time.Now().Unix(),
 		"regions":   len(regions),
+		"upstream":  upstream.All(),
+		"mode":      currentMode(),
 	})
 }
 
 // ========================= DRONE OPS =========================
 
 var (
-	droneFleet      *fprime.Fleet
-	droneSim        *fprime.Simulator
-	droneClients      = make(map[*websocket.Conn]bool)
+	droneFleet        *fprime.Fleet
+	droneSim          *fprime.Simulator
+	droneClients      = make(map[*wsClient]bool)
 	droneClientsMutex sync.RWMutex
 )
 
 func init() {
 	// Start broadcasting drone telemetry to WS clients
-	go broadcastDroneTelemetry()
+	goSupervised("drones", broadcastDroneTelemetry)
 }
 
 func broadcastDroneTelemetry() {
@@ -935,16 +1605,16 @@ func broadcastDroneTelemetry() {
 		events := droneFleet.GetEvents("", 10)
 
 		msg := map[string]interface{}{
-			"type":   "drone_telemetry",
-			"drones": drones,
-			"events": events,
+			"type":      "drone_telemetry",
+			"drones":    drones,
+			"events":    events,
 			"timestamp": time.Now().Unix(),
 		}
 
 		droneClientsMutex.RLock()
 		for conn := range droneClients {
-			if err := conn.WriteJSON(msg); err != nil {
-				log.Printf("Drone WS write error: %v", err)
+			if err := conn.send(msg); err != nil {
+				droneLog.Warn("Drone WS write failed", "err", err)
 			}
 		}
 		droneClientsMutex.RUnlock()
@@ -952,40 +1622,46 @@ func broadcastDroneTelemetry() {
 }
 
 func handleDroneWebSocket(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+	wlog := requestLog(droneLog, r).With("remote", clientIP(r))
+	ws, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Printf("Drone WebSocket upgrade failed: %v", err)
+		wlog.Warn("Drone WebSocket upgrade failed", "err", err)
 		return
 	}
+	conn := &wsClient{conn: ws}
 
 	droneClientsMutex.Lock()
 	droneClients[conn] = true
 	droneClientsMutex.Unlock()
 
-	log.Println("Drone WS client connected")
+	wlog.Info("Drone WS client connected")
 
 	// Send initial state
 	if droneFleet != nil {
-		conn.WriteJSON(map[string]interface{}{
-			"type":   "drone_telemetry",
-			"drones": droneFleet.GetAllDrones(),
-			"events": droneFleet.GetEvents("", 50),
+		conn.send(map[string]interface{}{
+			"type":      "drone_telemetry",
+			"drones":    droneFleet.GetAllDrones(),
+			"events":    droneFleet.GetEvents("", 50),
 			"timestamp": time.Now().Unix(),
 		})
 	}
 
+	stopWatch := watchWebSocketSession(ws, r)
 	defer func() {
+		stopWatch()
 		droneClientsMutex.Lock()
 		delete(droneClients, conn)
 		droneClientsMutex.Unlock()
-		conn.Close()
-		log.Println("Drone WS client disconnected")
+		ws.Close()
+		wlog.Info("Drone WS client disconnected")
 	}()
 
-	// Keep connection alive, read messages (unused for now)
+	// Keep connection alive, read messages (only activity reports for now)
 	for {
-		_, _, err := conn.ReadMessage()
+		touchWebSocket(ws)
+		_, _, err := ws.ReadMessage()
 		if err != nil {
+			closeIfIdle(ws, err)
 			break
 		}
 	}
@@ -1080,6 +1756,8 @@ func handleDroneConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	auditLog.Record(r, "drone.config", map[string]interface{}{"droneId": config.DroneID, "energyBudgetLimit": config.EnergyBudgetLimit})
+
 	// Apply config (in simulation, just update budget limit)
 	drone := droneFleet.GetDrone(config.DroneID)
 	if drone != nil {
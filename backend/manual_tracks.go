@@ -0,0 +1,416 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sourceManual tags aircraft entered by an operator rather than reported by
+// a sensor.
+const sourceManual = "MANUAL"
+
+// manualReports are the kinds of report a manual track can come from.
+var manualReports = map[string]bool{"visual": true, "radio": true, "ew": true, "other": true}
+
+const manualTrackMaxTTL = 24 * time.Hour
+
+// ManualTrack is a track the sensors can't see, entered by an operator from
+// a visual sighting, a radio call, or an EW tip. With a heading and speed it
+// is dead-reckoned from the last reported position.
+type ManualTrack struct {
+	ID         string    `json:"id"` // also the track's icao24: "~" and six hex digits, like tar1090's non-ICAO addresses
+	Callsign   string    `json:"callsign,omitempty"`
+	Region     string    `json:"region"`
+	Lat        float64   `json:"lat"`
+	Lon        float64   `json:"lon"`
+	AltFt      *float64  `json:"altFt,omitempty"`
+	Heading    *float64  `json:"heading,omitempty"`
+	SpeedKt    *float64  `json:"speedKt,omitempty"`
+	Category   int       `json:"category,omitempty"`
+	Squawk     string    `json:"squawk,omitempty"`
+	Report     string    `json:"report"`
+	Note       string    `json:"note,omitempty"`
+	ReportedAt time.Time `json:"reportedAt"` // when lat/lon were last given
+	CreatedBy  string    `json:"createdBy,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedBy  string    `json:"updatedBy,omitempty"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+// ManualTrackRequest is the body of POST /api/tracks/manual. Without an ID
+// it creates a track; with one it updates that track, changing only the
+// fields given, and pushes its expiry back.
+type ManualTrackRequest struct {
+	ID       string   `json:"id"`
+	Callsign *string  `json:"callsign"`
+	Region   string   `json:"region"` // default: the region containing lat/lon
+	Lat      *float64 `json:"lat"`
+	Lon      *float64 `json:"lon"`
+	AltFt    *float64 `json:"altFt"`
+	Heading  *float64 `json:"heading"`
+	SpeedKt  *float64 `json:"speedKt"`
+	Category *int     `json:"category"`
+	Squawk   *string  `json:"squawk"`
+	Report   string   `json:"report"` // visual, radio, ew, or other (default)
+	Note     *string  `json:"note"`
+	TTL      string   `json:"ttl"` // e.g. "45m"; default MANUAL_TRACK_TTL
+}
+
+// ManualTracks holds operator-entered tracks until they expire. They are
+// kept in memory, per replica: a track shows in the pictures the replica
+// that created it builds or ingests.
+type ManualTracks struct {
+	ttl time.Duration
+
+	mu     sync.Mutex
+	tracks map[string]*ManualTrack
+}
+
+var manualTracks = &ManualTracks{ttl: 30 * time.Minute, tracks: make(map[string]*ManualTrack)}
+
+// loadManualTrackConfigFromEnv reads the default lifetime.
+//
+//	MANUAL_TRACK_TTL — how long a manual track lasts after its last update (default 30m, at most 24h)
+func loadManualTrackConfigFromEnv() error {
+	if v := os.Getenv("MANUAL_TRACK_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 || d > manualTrackMaxTTL {
+			return fmt.Errorf("MANUAL_TRACK_TTL: %q is not a duration between 0 and 24h", v)
+		}
+		manualTracks.ttl = d
+	}
+	return nil
+}
+
+var errManualTrackNotFound = errors.New("manual track not found")
+
+// Put creates or updates a track. created says which.
+func (m *ManualTracks) Put(req ManualTrackRequest, by string) (track ManualTrack, created bool, err error) {
+	ttl := m.ttl
+	if req.TTL != "" {
+		if ttl, err = time.ParseDuration(req.TTL); err != nil || ttl <= 0 || ttl > manualTrackMaxTTL {
+			return ManualTrack{}, false, fmt.Errorf("ttl %q is not a duration between 0 and 24h", req.TTL)
+		}
+	}
+	if (req.Lat == nil) != (req.Lon == nil) {
+		return ManualTrack{}, false, errors.New("lat and lon go together")
+	}
+	if req.Lat != nil && (math.Abs(*req.Lat) > 90 || math.Abs(*req.Lon) > 180) {
+		return ManualTrack{}, false, errors.New("lat or lon out of range")
+	}
+	if req.Report != "" && !manualReports[req.Report] {
+		return ManualTrack{}, false, fmt.Errorf("unknown report %q (want visual, radio, ew, or other)", req.Report)
+	}
+	if req.Squawk != nil && *req.Squawk != "" && !squawkPattern.MatchString(*req.Squawk) {
+		return ManualTrack{}, false, fmt.Errorf("squawk %q is not four octal digits", *req.Squawk)
+	}
+	if req.Heading != nil && (*req.Heading < 0 || *req.Heading >= 360) {
+		return ManualTrack{}, false, errors.New("heading must be in [0, 360)")
+	}
+	if req.SpeedKt != nil && *req.SpeedKt < 0 {
+		return ManualTrack{}, false, errors.New("speedKt must not be negative")
+	}
+	if req.Region != "" {
+		if _, ok := regions[req.Region]; !ok {
+			return ManualTrack{}, false, fmt.Errorf("unknown region %q", req.Region)
+		}
+	}
+
+	now := time.Now().UTC()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expireLocked(now)
+
+	t, ok := m.tracks[req.ID]
+	switch {
+	case req.ID == "":
+		if req.Lat == nil {
+			return ManualTrack{}, false, errors.New("lat and lon are required for a new track")
+		}
+		raw := make([]byte, 3)
+		rand.Read(raw)
+		t = &ManualTrack{ID: "~" + hex.EncodeToString(raw), Report: "other", CreatedBy: by, CreatedAt: now}
+		created = true
+	case !ok:
+		return ManualTrack{}, false, errManualTrackNotFound
+	}
+
+	if req.Lat != nil {
+		t.Lat, t.Lon, t.ReportedAt = *req.Lat, *req.Lon, now
+	}
+	region := req.Region
+	if region == "" && (created || req.Lat != nil) {
+		region = regionContaining(t.Lat, t.Lon)
+		if region == "" && created {
+			return ManualTrack{}, false, errors.New("position is outside every region; give region explicitly")
+		}
+	}
+	if region != "" {
+		t.Region = region
+	}
+	if req.Callsign != nil {
+		t.Callsign = strings.ToUpper(strings.TrimSpace(*req.Callsign))
+	}
+	if req.AltFt != nil {
+		t.AltFt = req.AltFt
+	}
+	if req.Heading != nil {
+		t.Heading = req.Heading
+	}
+	if req.SpeedKt != nil {
+		t.SpeedKt = req.SpeedKt
+	}
+	if req.Category != nil {
+		t.Category = *req.Category
+	}
+	if req.Squawk != nil {
+		t.Squawk = *req.Squawk
+	}
+	if req.Report != "" {
+		t.Report = req.Report
+	}
+	if req.Note != nil {
+		t.Note = *req.Note
+	}
+	t.UpdatedBy, t.UpdatedAt, t.ExpiresAt = by, now, now.Add(ttl)
+	m.tracks[t.ID] = t
+	return *t, created, nil
+}
+
+// Delete removes a track and returns it.
+func (m *ManualTracks) Delete(id string) (ManualTrack, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.tracks[id]
+	if !ok {
+		return ManualTrack{}, errManualTrackNotFound
+	}
+	delete(m.tracks, id)
+	return *t, nil
+}
+
+// Get returns a track by ID.
+func (m *ManualTracks) Get(id string) (ManualTrack, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expireLocked(time.Now())
+	t, ok := m.tracks[id]
+	if !ok {
+		return ManualTrack{}, errManualTrackNotFound
+	}
+	return *t, nil
+}
+
+// List returns the live tracks, optionally in one region, newest first.
+func (m *ManualTracks) List(region string) []ManualTrack {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expireLocked(time.Now())
+	out := make([]ManualTrack, 0, len(m.tracks))
+	for _, t := range m.tracks {
+		if region == "" || t.Region == region {
+			out = append(out, *t)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out
+}
+
+// expireLocked drops tracks past their expiry; the caller holds m.mu.
+func (m *ManualTracks) expireLocked(now time.Time) {
+	for id, t := range m.tracks {
+		if now.After(t.ExpiresAt) {
+			delete(m.tracks, id)
+			fetcherLog.Info("Manual track expired", "id", id, "callsign", t.Callsign, "region", t.Region)
+		}
+	}
+}
+
+// Inject adds the region's manual tracks to a picture, replacing any copies
+// of them already in it (a replayed or re-ingested picture).
+func (m *ManualTracks) Inject(data *AirspaceData) {
+	data.Aircraft = m.merge(data.Region, data.Aircraft, time.Unix(data.Timestamp, 0), "")
+	data.Count = len(data.Aircraft)
+}
+
+// merge returns aircraft without this replica's manual tracks (and without
+// drop, one just deleted), followed by the region's current ones at now.
+func (m *ManualTracks) merge(region string, aircraft []Aircraft, now time.Time, drop string) []Aircraft {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expireLocked(time.Now())
+	out := make([]Aircraft, 0, len(aircraft)+len(m.tracks))
+	for _, ac := range aircraft {
+		if _, mine := m.tracks[ac.ICAO24]; !mine && !(ac.Source == sourceManual && ac.ICAO24 == drop) {
+			out = append(out, ac)
+		}
+	}
+	ids := make([]string, 0, len(m.tracks))
+	for id, t := range m.tracks {
+		if t.Region == region {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		out = append(out, m.tracks[id].aircraft(now))
+	}
+	return out
+}
+
+// aircraft renders the track in the picture, dead-reckoned to now.
+func (t *ManualTrack) aircraft(now time.Time) Aircraft {
+	lat, lon := t.Lat, t.Lon
+	reported := t.ReportedAt.Unix()
+	ac := Aircraft{
+		ICAO24:        t.ID,
+		Callsign:      t.Callsign,
+		OriginCountry: "Unknown",
+		TimePosition:  &reported,
+		LastContact:   t.UpdatedAt.Unix(),
+		Category:      t.Category,
+		Source:        sourceManual,
+	}
+	if t.Heading != nil {
+		heading := *t.Heading
+		ac.TrueTrack = &heading
+	}
+	if t.SpeedKt != nil {
+		speed := *t.SpeedKt * knotsToMS
+		ac.Velocity = &speed
+		if t.Heading != nil && now.After(t.ReportedAt) {
+			lat, lon = destinationPoint(lat, lon, *t.Heading, speed*now.Sub(t.ReportedAt).Seconds())
+		}
+	}
+	ac.Latitude, ac.Longitude = &lat, &lon
+	if t.AltFt != nil {
+		alt := *t.AltFt * 0.3048
+		ac.BaroAltitude = &alt
+		ac.OnGround = alt <= 0
+	}
+	if t.Squawk != "" {
+		squawk := t.Squawk
+		ac.Squawk = &squawk
+	}
+	return ac
+}
+
+// refreshManualTracks re-merges a region's manual tracks into its cached
+// picture and broadcasts it, so changes show before the next poll.
+func refreshManualTracks(region, dropped string) {
+	cacheMutex.Lock()
+	data, ok := airspaceCache[region]
+	if !ok {
+		cacheMutex.Unlock()
+		return
+	}
+	updated := *data
+	updated.Aircraft = manualTracks.merge(region, data.Aircraft, time.Now(), dropped)
+	updated.Count = len(updated.Aircraft)
+	airspaceCache[region] = &updated
+	cacheMutex.Unlock()
+	broadcastToClients(region, &updated)
+}
+
+// manualTrackPromptNote explains manual tracks to SENTINEL when the picture
+// has any.
+func manualTrackPromptNote(aircraft []Aircraft) string {
+	for _, ac := range aircraft {
+		if ac.Source == sourceManual {
+			return `
+
+Tracks with "source": "MANUAL" were entered by operators from visual sightings, radio calls, or EW tips that no sensor confirms. Their positions are approximate and may be dead-reckoned from the last report.`
+		}
+	}
+	return ""
+}
+
+// handleManualTracks serves GET (list, ?region=) and POST (create or
+// update) on /api/tracks/manual.
+func handleManualTracks(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(manualTracks.List(r.URL.Query().Get("region")))
+
+	case http.MethodPost:
+		var req ManualTrackRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		by := ""
+		if p := principalFrom(r); p != nil {
+			by = p.Name
+		}
+		var previous string
+		if req.ID != "" {
+			if old, err := manualTracks.Get(req.ID); err == nil {
+				previous = old.Region
+			}
+		}
+		track, created, err := manualTracks.Put(req, by)
+		if errors.Is(err, errManualTrackNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		action, status := "manual_track.update", http.StatusOK
+		if created {
+			action, status = "manual_track.create", http.StatusCreated
+		}
+		auditLog.Record(r, action, map[string]interface{}{"id": track.ID, "callsign": track.Callsign, "region": track.Region,
+			"lat": track.Lat, "lon": track.Lon, "report": track.Report})
+		if previous != "" && previous != track.Region {
+			refreshManualTracks(previous, track.ID)
+		}
+		refreshManualTracks(track.Region, "")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(track)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleManualTrack serves GET and DELETE on /api/tracks/manual/{id}.
+func handleManualTrack(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/tracks/manual/"), "/")
+	switch r.Method {
+	case http.MethodGet:
+		track, err := manualTracks.Get(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(track)
+
+	case http.MethodDelete:
+		track, err := manualTracks.Delete(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		auditLog.Record(r, "manual_track.delete", map[string]interface{}{"id": id, "callsign": track.Callsign})
+		refreshManualTracks(track.Region, id)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,159 @@
+// Package mavlink encodes the handful of MAVLink 2 messages SwarmC2 sends to
+// ground stations and companion computers: HEARTBEAT and ADSB_VEHICLE.
+//
+//	┌──────┬─────┬────────┬────────┬─────┬───────┬───────┬────────┬─────────┬──────────┐
+//	│ 0xFD │ LEN │ INCOMP │ COMPAT │ SEQ │ SYSID │ COMPID│ MSGID  │ PAYLOAD │ CRC16    │
+//	│  1   │  1  │   1    │   1    │  1  │   1   │   1   │ 3 (LE) │  LEN    │ 2 (LE)   │
+//	└──────┴─────┴────────┴────────┴─────┴───────┴───────┴────────┴─────────┴──────────┘
+//
+// Payload fields are little-endian and ordered largest type first; trailing
+// zero bytes are truncated as MAVLink 2 requires.
+package mavlink
+
+import (
+	"encoding/binary"
+	"math"
+	"strings"
+)
+
+const stx = 0xFD
+
+// Message IDs and their CRC_EXTRA seeds (from the common.xml definitions).
+const (
+	MsgHeartbeat   = 0
+	MsgADSBVehicle = 246
+
+	crcExtraHeartbeat   = 50
+	crcExtraADSBVehicle = 184
+)
+
+// Component ID for an ADS-B receiver (MAV_COMP_ID_ADSB).
+const CompIDADSB = 156
+
+// ADSB_FLAGS bits.
+const (
+	FlagValidCoords           = 1
+	FlagValidAltitude         = 2
+	FlagValidHeading          = 4
+	FlagValidVelocity         = 8
+	FlagValidCallsign         = 16
+	FlagValidSquawk           = 32
+	FlagSimulated             = 64
+	FlagVerticalVelocityValid = 128
+	FlagBaroValid             = 256
+)
+
+// ADSB_ALTITUDE_TYPE values.
+const (
+	AltitudePressureQNH = 0
+	AltitudeGeometric   = 1
+)
+
+// Encoder frames messages with a running sequence number.
+type Encoder struct {
+	SystemID    uint8
+	ComponentID uint8
+	seq         uint8
+}
+
+// Frame wraps a payload in a MAVLink 2 frame.
+func (e *Encoder) Frame(msgID uint32, crcExtra uint8, payload []byte) []byte {
+	// Truncate trailing zeros, keeping at least one payload byte
+	n := len(payload)
+	for n > 1 && payload[n-1] == 0 {
+		n--
+	}
+	payload = payload[:n]
+
+	frame := make([]byte, 0, 12+n)
+	frame = append(frame, stx, byte(n), 0, 0, e.seq, e.SystemID, e.ComponentID,
+		byte(msgID), byte(msgID>>8), byte(msgID>>16))
+	frame = append(frame, payload...)
+	e.seq++
+
+	crc := crcX25(frame[1:])
+	crc = crcAccumulate(crcExtra, crc)
+	return append(frame, byte(crc), byte(crc>>8))
+}
+
+// Heartbeat identifies the sender as an ADS-B source (MAV_TYPE_ADSB,
+// MAV_AUTOPILOT_INVALID, MAV_STATE_ACTIVE).
+func (e *Encoder) Heartbeat() []byte {
+	payload := make([]byte, 9)
+	// custom_mode uint32 = 0
+	payload[4] = 27 // type: MAV_TYPE_ADSB
+	payload[5] = 8  // autopilot: MAV_AUTOPILOT_INVALID
+	payload[6] = 0  // base_mode
+	payload[7] = 4  // system_status: MAV_STATE_ACTIVE
+	payload[8] = 3  // mavlink_version
+	return e.Frame(MsgHeartbeat, crcExtraHeartbeat, payload)
+}
+
+// ADSBVehicle is the ADSB_VEHICLE message in SI-friendly units; Encode
+// converts to the wire units (degE7, mm, cdeg, cm/s).
+type ADSBVehicle struct {
+	ICAOAddress  uint32
+	Lat, Lon     float64 // degrees
+	AltitudeType uint8
+	Altitude     float64 // meters
+	Heading      float64 // degrees
+	HorVelocity  float64 // m/s
+	VerVelocity  float64 // m/s
+	Callsign     string
+	EmitterType  uint8
+	TSLC         uint8 // seconds since last communication
+	Flags        uint16
+	Squawk       uint16
+}
+
+// Encode frames an ADSB_VEHICLE message.
+func (e *Encoder) Encode(v ADSBVehicle) []byte {
+	p := make([]byte, 38)
+	le := binary.LittleEndian
+	le.PutUint32(p[0:], v.ICAOAddress)
+	le.PutUint32(p[4:], uint32(int32(math.Round(v.Lat*1e7))))
+	le.PutUint32(p[8:], uint32(int32(math.Round(v.Lon*1e7))))
+	le.PutUint32(p[12:], uint32(int32(math.Round(v.Altitude*1000))))
+	le.PutUint16(p[16:], uint16(math.Round(math.Mod(v.Heading+360, 360)*100))%36000)
+	le.PutUint16(p[18:], uint16(clamp(v.HorVelocity*100, 0, math.MaxUint16)))
+	le.PutUint16(p[20:], uint16(int16(clamp(v.VerVelocity*100, math.MinInt16, math.MaxInt16))))
+	le.PutUint16(p[22:], v.Flags)
+	le.PutUint16(p[24:], v.Squawk)
+	p[26] = v.AltitudeType
+	copy(p[27:35], strings.ToUpper(v.Callsign)) // char[9], NUL-terminated
+	p[36] = v.EmitterType
+	p[37] = v.TSLC
+	return e.Frame(MsgADSBVehicle, crcExtraADSBVehicle, p)
+}
+
+// EmitterType maps an OpenSky ADS-B emitter category to ADSB_EMITTER_TYPE.
+func EmitterType(opensky int) uint8 {
+	switch {
+	case opensky >= 2 && opensky <= 8:
+		return uint8(opensky - 1) // LIGHT … ROTOCRAFT
+	case opensky >= 9 && opensky <= 15:
+		return uint8(opensky) // GLIDER … SPACE
+	case opensky >= 16 && opensky <= 18:
+		return uint8(opensky + 1) // EMERGENCY_SURFACE … POINT_OBSTACLE
+	}
+	return 0
+}
+
+func clamp(v, lo, hi float64) float64 {
+	return math.Max(lo, math.Min(hi, math.Round(v)))
+}
+
+// crcX25 is CRC-16/MCRF4XX as used by MAVLink.
+func crcX25(data []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, b := range data {
+		crc = crcAccumulate(b, crc)
+	}
+	return crc
+}
+
+func crcAccumulate(b uint8, crc uint16) uint16 {
+	tmp := b ^ uint8(crc)
+	tmp ^= tmp << 4
+	return (crc >> 8) ^ (uint16(tmp) << 8) ^ (uint16(tmp) << 3) ^ (uint16(tmp) >> 4)
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"swarm-c2/mavlink"
+)
+
+// MAVLinkFeed sends the air picture as MAVLink ADSB_VEHICLE messages so
+// ground stations (QGroundControl, Mission Planner) and companion computers
+// can display it and feed detect-and-avoid.
+type MAVLinkFeed struct {
+	mu      sync.Mutex
+	encoder *mavlink.Encoder
+	outputs []mavlinkOutput
+	regions []string
+}
+
+type mavlinkOutput struct {
+	name string
+	w    io.Writer
+}
+
+var mavlinkFeed *MAVLinkFeed
+
+// newMAVLinkFeedFromEnv returns nil when MAVLINK_OUTPUTS is unset.
+//
+//	MAVLINK_OUTPUTS   — comma-separated udp://host:port or serial:///dev/ttyUSB0
+//	                    (set the serial baud rate beforehand, e.g. stty -F /dev/ttyUSB0 57600 raw)
+//	MAVLINK_SYSTEM_ID — our MAVLink system ID (default 250, clear of typical vehicle IDs)
+//	MAVLINK_REGIONS   — comma-separated regions to send (default all)
+func newMAVLinkFeedFromEnv() (*MAVLinkFeed, error) {
+	outputs := splitList(os.Getenv("MAVLINK_OUTPUTS"))
+	if len(outputs) == 0 {
+		return nil, nil
+	}
+
+	sysID := uint64(250)
+	if v := os.Getenv("MAVLINK_SYSTEM_ID"); v != "" {
+		var err error
+		if sysID, err = strconv.ParseUint(v, 10, 8); err != nil || sysID == 0 {
+			return nil, fmt.Errorf("MAVLINK_SYSTEM_ID: invalid value %q", v)
+		}
+	}
+	f := &MAVLinkFeed{
+		encoder: &mavlink.Encoder{SystemID: uint8(sysID), ComponentID: mavlink.CompIDADSB},
+		regions: splitList(os.Getenv("MAVLINK_REGIONS")),
+	}
+
+	for _, raw := range outputs {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return nil, fmt.Errorf("MAVLink output %q: %w", raw, err)
+		}
+		var w io.Writer
+		switch u.Scheme {
+		case "udp":
+			addr, err := net.ResolveUDPAddr("udp", u.Host)
+			if err != nil {
+				return nil, fmt.Errorf("MAVLink output %q: %w", raw, err)
+			}
+			conn, err := net.ListenPacket("udp", ":0")
+			if err != nil {
+				return nil, fmt.Errorf("MAVLink output %q: %w", raw, err)
+			}
+			w = udpWriter{conn, addr}
+		case "serial":
+			file, err := os.OpenFile(u.Path, os.O_WRONLY, 0)
+			if err != nil {
+				return nil, fmt.Errorf("MAVLink output %q: %w", raw, err)
+			}
+			w = file
+		default:
+			return nil, fmt.Errorf("MAVLink output %q: unsupported scheme (use udp or serial)", raw)
+		}
+		f.outputs = append(f.outputs, mavlinkOutput{name: raw, w: w})
+	}
+
+	goSupervised("mavlink", f.heartbeat)
+	return f, nil
+}
+
+// heartbeat announces us once a second so ground stations list the source.
+func (f *MAVLinkFeed) heartbeat() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		f.mu.Lock()
+		f.write([][]byte{f.encoder.Heartbeat()})
+		f.mu.Unlock()
+	}
+}
+
+// Publish sends one ADSB_VEHICLE per positioned aircraft in the region.
+func (f *MAVLinkFeed) Publish(region string, aircraft []Aircraft) {
+	if f == nil || !matchesAny(f.regions, region) {
+		return
+	}
+	now := time.Now().Unix()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var frames [][]byte
+	for _, ac := range aircraft {
+		if v, ok := adsbVehicle(ac, now); ok {
+			frames = append(frames, f.encoder.Encode(v))
+		}
+	}
+	f.write(frames)
+}
+
+// udpWriter sends from an unconnected socket, so a ground station that isn't
+// listening yet doesn't turn into ICMP-driven write errors.
+type udpWriter struct {
+	net.PacketConn
+	addr net.Addr
+}
+
+func (u udpWriter) Write(b []byte) (int, error) { return u.WriteTo(b, u.addr) }
+
+// write sends frames to every output; UDP gets one datagram per frame.
+func (f *MAVLinkFeed) write(frames [][]byte) {
+	for _, out := range f.outputs {
+		for _, frame := range frames {
+			if _, err := out.w.Write(frame); err != nil {
+				feedLog.Warn("MAVLink write failed", "output", out.name, "err", err)
+				break
+			}
+		}
+	}
+}
+
+func adsbVehicle(ac Aircraft, now int64) (mavlink.ADSBVehicle, bool) {
+	address, err := strconv.ParseUint(ac.ICAO24, 16, 24)
+	if err != nil || ac.Latitude == nil || ac.Longitude == nil {
+		return mavlink.ADSBVehicle{}, false
+	}
+
+	v := mavlink.ADSBVehicle{
+		ICAOAddress: uint32(address),
+		Lat:         *ac.Latitude,
+		Lon:         *ac.Longitude,
+		EmitterType: mavlink.EmitterType(ac.Category),
+		Flags:       mavlink.FlagValidCoords,
+	}
+	if tslc := now - ac.LastContact; tslc > 255 {
+		v.TSLC = 255
+	} else if tslc > 0 {
+		v.TSLC = uint8(tslc)
+	}
+	if ac.BaroAltitude != nil {
+		v.AltitudeType, v.Altitude = mavlink.AltitudePressureQNH, *ac.BaroAltitude
+		v.Flags |= mavlink.FlagValidAltitude | mavlink.FlagBaroValid
+	} else if ac.GeoAltitude != nil {
+		v.AltitudeType, v.Altitude = mavlink.AltitudeGeometric, *ac.GeoAltitude
+		v.Flags |= mavlink.FlagValidAltitude
+	}
+	if ac.TrueTrack != nil {
+		v.Heading = *ac.TrueTrack
+		v.Flags |= mavlink.FlagValidHeading
+	}
+	if ac.Velocity != nil {
+		v.HorVelocity = *ac.Velocity
+		v.Flags |= mavlink.FlagValidVelocity
+	}
+	if ac.VerticalRate != nil {
+		v.VerVelocity = *ac.VerticalRate
+		v.Flags |= mavlink.FlagVerticalVelocityValid
+	}
+	if cs := strings.TrimSpace(ac.Callsign); cs != "" {
+		v.Callsign = cs
+		v.Flags |= mavlink.FlagValidCallsign
+	}
+	if ac.Squawk != nil {
+		// Squawk is carried as the decimal number spelling the octal code (7700 → 7700)
+		if sq, err := strconv.Atoi(*ac.Squawk); err == nil {
+			v.Squawk = uint16(sq)
+			v.Flags |= mavlink.FlagValidSquawk
+		}
+	}
+	return v, true
+}
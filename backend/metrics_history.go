@@ -0,0 +1,132 @@
+package main
+
+import (
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// regionSample is one poll's worth of aggregate metrics for a region.
+type regionSample struct {
+	At         time.Time
+	Aircraft   float64
+	Military   float64
+	Commercial float64 // airline flights (see isCommercial)
+	Threat     float64 // latest raw AI threat score
+	Smoothed   float64 // latest smoothed threat score
+	Alerts     float64 // active alerts
+}
+
+// regionMetrics names the series available per region.
+var regionMetrics = map[string]func(s regionSample) float64{
+	"aircraft_count":        func(s regionSample) float64 { return s.Aircraft },
+	"military_count":        func(s regionSample) float64 { return s.Military },
+	"commercial_count":      func(s regionSample) float64 { return s.Commercial },
+	"threat_score":          func(s regionSample) float64 { return s.Threat },
+	"smoothed_threat_score": func(s regionSample) float64 { return s.Smoothed },
+	"active_alerts":         func(s regionSample) float64 { return s.Alerts },
+}
+
+// MetricHistory keeps an in-memory time series of regionSamples, trimmed to
+// a retention window. It is lost on restart; it exists for ops dashboards,
+// not as a record.
+type MetricHistory struct {
+	mu        sync.RWMutex
+	retention time.Duration
+	samples   map[string][]regionSample
+}
+
+var metricHistory = newMetricHistoryFromEnv()
+
+// newMetricHistoryFromEnv reads METRICS_RETENTION (default 24h).
+func newMetricHistoryFromEnv() *MetricHistory {
+	h := &MetricHistory{retention: 24 * time.Hour, samples: make(map[string][]regionSample)}
+	if d, err := time.ParseDuration(os.Getenv("METRICS_RETENTION")); err == nil && d > 0 {
+		h.retention = d
+	}
+	return h
+}
+
+// Record appends a sample and drops those older than the retention window.
+func (h *MetricHistory) Record(region string, s regionSample) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	series := append(h.samples[region], s)
+	cutoff := s.At.Add(-h.retention)
+	drop := sort.Search(len(series), func(i int) bool { return !series[i].At.Before(cutoff) })
+	if drop > len(series)/2 {
+		// Reallocate occasionally instead of re-slicing forever
+		series = append([]regionSample(nil), series[drop:]...)
+	} else {
+		series = series[drop:]
+	}
+	h.samples[region] = series
+}
+
+// Samples returns a copy of the samples for a region between from and to.
+func (h *MetricHistory) Samples(region string, from, to time.Time) []regionSample {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	series := h.samples[region]
+	lo := sort.Search(len(series), func(i int) bool { return !series[i].At.Before(from) })
+	hi := sort.Search(len(series), func(i int) bool { return series[i].At.After(to) })
+	return append([]regionSample(nil), series[lo:hi]...)
+}
+
+// Series returns [value, unix ms] points for one metric between from and to,
+// averaged into at most maxPoints buckets.
+func (h *MetricHistory) Series(region, metric string, from, to time.Time, maxPoints int) [][2]float64 {
+	value, ok := regionMetrics[metric]
+	if !ok {
+		return nil
+	}
+
+	window := h.Samples(region, from, to)
+	points := make([][2]float64, 0, len(window))
+	if len(window) == 0 {
+		return points
+	}
+	if maxPoints <= 0 || maxPoints > len(window) {
+		maxPoints = len(window)
+	}
+	bucket := (len(window) + maxPoints - 1) / maxPoints
+	for i := 0; i < len(window); i += bucket {
+		end := i + bucket
+		if end > len(window) {
+			end = len(window)
+		}
+		var sum float64
+		for _, s := range window[i:end] {
+			sum += value(s)
+		}
+		points = append(points, [2]float64{sum / float64(end-i), float64(window[end-1].At.UnixMilli())})
+	}
+	return points
+}
+
+// recordRegionMetrics samples a region after each poll.
+func recordRegionMetrics(region string, aircraft []Aircraft) {
+	s := regionSample{At: time.Now(), Aircraft: float64(len(aircraft))}
+	for _, ac := range aircraft {
+		if mil, _ := classifyMilitary(ac); mil {
+			s.Military++
+		} else if isCommercial(ac) {
+			s.Commercial++
+		}
+	}
+
+	analysisCacheMutex.RLock()
+	if a := analysisCache[region]; a != nil {
+		s.Threat, s.Smoothed = float64(a.ThreatScore), a.SmoothedThreatScore
+	}
+	analysisCacheMutex.RUnlock()
+
+	for _, a := range alertMgr.Active() {
+		if a.Region == region {
+			s.Alerts++
+		}
+	}
+	metricHistory.Record(region, s)
+}
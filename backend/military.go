@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// militaryCallsignPrefixes are callsign prefixes used by military and
+// government operators in the regions we cover.
+var militaryCallsignPrefixes = []string{
+	// United States
+	"RCH", "REACH", "CNV", "PAT", "SAM", "EXEC", "VENUS", "SPAR", "EVAC",
+	"DUKE", "TOPCAT", "HOMER", "JAKE", "FORTE", "LAGR", "QUID", "NCHO",
+	"SNTRY", "GORDO", "BOLT", "VV",
+	// United Kingdom / NATO
+	"RRR", "ASCOT", "TARTN", "KITTY", "COMET", "RFR", "NATO", "MMF",
+	// PRC / ROC
+	"PLA", "CAF",
+}
+
+// militaryHexRanges are ICAO24 address blocks allocated to military operators.
+var militaryHexRanges = []struct {
+	lo, hi  uint32
+	country string
+}{
+	{0xADF7C8, 0xAFFFFF, "United States"},
+	{0x43C000, 0x43CFFF, "United Kingdom"},
+	{0x3F4000, 0x3F7FFF, "Germany"},
+	{0x3B7000, 0x3BFFFF, "France"},
+	{0x480000, 0x480FFF, "Netherlands"},
+}
+
+// classifyMilitary reports whether an aircraft looks military and why.
+// It is a heuristic over callsign prefixes and allocated ICAO24 blocks.
+func classifyMilitary(ac Aircraft) (bool, string) {
+	if military, reason, ok := classificationOverride(ac.ICAO24); ok {
+		return military, reason
+	}
+	if addr, err := strconv.ParseUint(ac.ICAO24, 16, 32); err == nil {
+		for _, r := range militaryHexRanges {
+			if uint32(addr) >= r.lo && uint32(addr) <= r.hi {
+				return true, r.country + " military ICAO24 block"
+			}
+		}
+	}
+
+	callsign := strings.ToUpper(strings.TrimSpace(ac.Callsign))
+	for _, prefix := range militaryCallsignPrefixes {
+		if strings.HasPrefix(callsign, prefix) && len(callsign) > len(prefix) {
+			// Require a digit right after the prefix so callsigns that merely
+			// share letters with it ("SAMSUNG") don't match.
+			if c := callsign[len(prefix)]; c >= '0' && c <= '9' {
+				return true, "military callsign prefix " + prefix
+			}
+		}
+	}
+	return false, ""
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	mathrand "math/rand"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// mockOpenSkyRetryAfter is the retry hint the mock sends with a 429.
+const mockOpenSkyRetryAfter = 30
+
+// MockOpenSky is an in-process stand-in for the OpenSky REST API and its
+// OAuth2 token endpoint, so the real poller, auth, backoff, and upstream
+// stats can be run without credentials or network access. It serves the
+// simulator's traffic, or a canned states file, and fails on request.
+type MockOpenSky struct {
+	addr   string
+	canned [][]interface{} // state vectors from MOCK_OPENSKY_STATES
+	faults map[string]float64
+
+	mu        sync.Mutex
+	rng       *mathrand.Rand
+	tokens    map[string]time.Time // access token -> expiry
+	remaining int64                // credits left, for X-Rate-Limit-Remaining
+}
+
+// mockOpenSkyFaults are the failures MOCK_OPENSKY_FAULTS can inject: a
+// 429 with a retry hint, rejected credentials, a server error, or a 3 s
+// delay from the states endpoint, or a rejected client from the token
+// endpoint.
+var mockOpenSkyFaults = map[string]bool{"429": true, "401": true, "500": true, "slow": true, "token": true}
+
+// startMockOpenSkyFromEnv starts the mock when MOCK_OPENSKY is true and
+// points the OpenSky settings at it, with mock OAuth2 credentials unless
+// others are set. It does nothing otherwise.
+//
+//	MOCK_OPENSKY        — true to serve aircraft from the in-process mock
+//	MOCK_OPENSKY_ADDR   — listen address (default 127.0.0.1, any free port)
+//	MOCK_OPENSKY_STATES — JSON file in OpenSky's /states/all format to serve instead of simulated traffic
+//	MOCK_OPENSKY_FAULTS — failure rates, e.g. "429=0.1,401=0.05,500=0.02,slow=0.05,token=0.1"
+//	MOCK_OPENSKY_SEED   — random seed for the faults, for repeatable runs (default: time)
+func startMockOpenSkyFromEnv() (*MockOpenSky, error) {
+	if v := os.Getenv("MOCK_OPENSKY"); v == "" {
+		return nil, nil
+	} else if on, err := strconv.ParseBool(v); err != nil {
+		return nil, fmt.Errorf("MOCK_OPENSKY: %q is not true or false", v)
+	} else if !on {
+		return nil, nil
+	}
+
+	seed := time.Now().UnixNano()
+	if v := os.Getenv("MOCK_OPENSKY_SEED"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("MOCK_OPENSKY_SEED: %q is not an integer", v)
+		}
+		seed = n
+	}
+	m := &MockOpenSky{
+		faults:    make(map[string]float64),
+		rng:       mathrand.New(mathrand.NewSource(seed)),
+		tokens:    make(map[string]time.Time),
+		remaining: 4000,
+	}
+	for _, kv := range splitList(os.Getenv("MOCK_OPENSKY_FAULTS")) {
+		k, v, _ := strings.Cut(kv, "=")
+		k = strings.TrimSpace(k)
+		if !mockOpenSkyFaults[k] {
+			return nil, fmt.Errorf("MOCK_OPENSKY_FAULTS: unknown fault %q (want 429, 401, 500, slow, or token)", k)
+		}
+		rate, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return nil, fmt.Errorf("MOCK_OPENSKY_FAULTS: %s rate %q is not between 0 and 1", k, v)
+		}
+		m.faults[k] = rate
+	}
+	if path := os.Getenv("MOCK_OPENSKY_STATES"); path != "" {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("MOCK_OPENSKY_STATES: %w", err)
+		}
+		var body struct {
+			States [][]interface{} `json:"states"`
+		}
+		if err := json.Unmarshal(raw, &body); err != nil {
+			return nil, fmt.Errorf("MOCK_OPENSKY_STATES: %s: %w", path, err)
+		}
+		m.canned = body.States
+	}
+
+	addr := os.Getenv("MOCK_OPENSKY_ADDR")
+	if addr == "" {
+		addr = "127.0.0.1:0"
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("MOCK_OPENSKY_ADDR: %w", err)
+	}
+	m.addr = ln.Addr().String()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/states/all", m.handleStates)
+	mux.HandleFunc("/token", m.handleToken)
+	srv := trackServer(&http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second})
+	go func() {
+		defer recoverPanic("mock-opensky")
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fetcherLog.Error("Mock OpenSky stopped", "err", err)
+		}
+	}()
+
+	os.Setenv("AIRCRAFT_SOURCE", "opensky")
+	os.Setenv("OPENSKY_URL", "http://"+m.addr+"/api")
+	os.Setenv("OPENSKY_TOKEN_URL", "http://"+m.addr+"/token")
+	if os.Getenv("OPENSKY_CLIENT_ID") == "" && os.Getenv("OPENSKY_USERNAME") == "" {
+		os.Setenv("OPENSKY_CLIENT_ID", "mock")
+		os.Setenv("OPENSKY_CLIENT_SECRET", "mock")
+	}
+	return m, nil
+}
+
+// fail reports whether the named fault fires this time.
+func (m *MockOpenSky) fail(fault string) bool {
+	rate := m.faults[fault]
+	if rate == 0 {
+		return false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.rng.Float64() < rate
+}
+
+func (m *MockOpenSky) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if r.PostFormValue("grant_type") != "client_credentials" || r.PostFormValue("client_id") == "" || m.fail("token") {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client", "error_description": "Invalid client or Invalid client credentials"})
+		return
+	}
+	raw := make([]byte, 16)
+	rand.Read(raw)
+	token := hex.EncodeToString(raw)
+	m.mu.Lock()
+	m.tokens[token] = time.Now().Add(30 * time.Minute)
+	m.mu.Unlock()
+	json.NewEncoder(w).Encode(map[string]interface{}{"access_token": token, "expires_in": 1800, "token_type": "Bearer"})
+}
+
+func (m *MockOpenSky) handleStates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		m.mu.Lock()
+		expiry, known := m.tokens[bearer]
+		m.mu.Unlock()
+		if !known || time.Now().After(expiry) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+	switch {
+	case m.fail("401"):
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	case m.fail("429"):
+		w.Header().Set("X-Rate-Limit-Retry-After-Seconds", strconv.Itoa(mockOpenSkyRetryAfter))
+		http.Error(w, "Too many requests", http.StatusTooManyRequests)
+		return
+	case m.fail("500"):
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	case m.fail("slow"):
+		select {
+		case <-time.After(3 * time.Second):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	q := r.URL.Query()
+	var box Region
+	for _, p := range []struct {
+		name string
+		dst  *float64
+	}{{"lamin", &box.MinLat}, {"lamax", &box.MaxLat}, {"lomin", &box.MinLon}, {"lomax", &box.MaxLon}} {
+		v, err := strconv.ParseFloat(q.Get(p.name), 64)
+		if err != nil {
+			http.Error(w, "Bad bounding box: "+p.name, http.StatusBadRequest)
+			return
+		}
+		*p.dst = v
+	}
+
+	now := time.Now()
+	states := make([][]interface{}, 0)
+	inBox := func(lat, lon float64) bool {
+		return lat >= box.MinLat && lat <= box.MaxLat && lon >= box.MinLon && lon <= box.MaxLon
+	}
+	if m.canned != nil {
+		for _, s := range m.canned {
+			if len(s) <= 6 {
+				continue
+			}
+			lon, lok := s[5].(float64)
+			lat, aok := s[6].(float64)
+			if lok && aok && inBox(lat, lon) {
+				s = append([]interface{}(nil), s...)
+				s[3], s[4] = now.Unix(), now.Unix() // canned positions are reported as current
+				states = append(states, s)
+			}
+		}
+	} else {
+		for name, routes := range simRoutes {
+			for _, ac := range simulatedAirspace(name, routes, now).Aircraft {
+				if inBox(*ac.Latitude, *ac.Longitude) {
+					states = append(states, mockStateVector(ac))
+				}
+			}
+		}
+	}
+
+	m.mu.Lock()
+	m.remaining = max(m.remaining-1, 0)
+	remaining := m.remaining
+	m.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Rate-Limit-Remaining", strconv.FormatInt(remaining, 10))
+	json.NewEncoder(w).Encode(map[string]interface{}{"time": now.Unix(), "states": states})
+}
+
+// mockStateVector encodes an aircraft as one of OpenSky's extended state
+// arrays, the inverse of parseStateVector.
+func mockStateVector(ac Aircraft) []interface{} {
+	return []interface{}{
+		ac.ICAO24, fmt.Sprintf("%-8s", ac.Callsign), ac.OriginCountry, ac.TimePosition, ac.LastContact,
+		ac.Longitude, ac.Latitude, ac.BaroAltitude, ac.OnGround, ac.Velocity,
+		ac.TrueTrack, ac.VerticalRate, ac.Sensors, ac.GeoAltitude, ac.Squawk,
+		ac.SPI, ac.PositionSource, ac.Category,
+	}
+}
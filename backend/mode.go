@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Operating modes, most severe first when several apply
+const (
+	ModeOfflineReplay = "OFFLINE_REPLAY" // recorded data, not live
+	ModeDegradedData  = "DEGRADED_DATA"  // at least one region's picture is stale
+	ModeDegradedAI    = "DEGRADED_AI"    // SENTINEL analysis isn't running
+	ModeNormal        = "NORMAL"
+)
+
+// heartbeatInterval is how often WebSocket clients get the mode when it
+// hasn't changed.
+const heartbeatInterval = 10 * time.Second
+
+// OperatingMode is the server's overall state, derived from dependency
+// health, so frontends can show an honest status banner. Reasons explain
+// every degradation found, including ones outranked by the mode shown.
+type OperatingMode struct {
+	Mode         string    `json:"mode"`
+	Since        time.Time `json:"since"`
+	Reasons      []string  `json:"reasons,omitempty"`
+	StaleRegions []string  `json:"staleRegions,omitempty"`
+}
+
+// modeState tracks the current mode and what feeds it that the health
+// checks can't see: whether this is a replay, and how analysis is going.
+var modeState struct {
+	sync.Mutex
+	current        OperatingMode
+	replay         bool
+	replayAnalysis bool // analyses come from the recording, not Anthropic
+	analysisFailed error
+}
+
+// noteAnalysisResult records the outcome of an analysis; a failure makes
+// the mode DEGRADED_AI until one succeeds.
+func noteAnalysisResult(err error) {
+	modeState.Lock()
+	modeState.analysisFailed = err
+	modeState.Unlock()
+}
+
+// evaluateMode works out the mode from the current health.
+func evaluateMode() (mode string, reasons, stale []string) {
+	modeState.Lock()
+	replay, replayAnalysis, analysisErr := modeState.replay, modeState.replayAnalysis, modeState.analysisFailed
+	modeState.Unlock()
+
+	var dataReasons, aiReasons []string
+	_, regionState := checkDataFreshness()
+	for name, st := range regionState {
+		if !st.OK {
+			stale = append(stale, name)
+		}
+	}
+	sort.Strings(stale)
+	if len(stale) > 0 && !replay {
+		dataReasons = append(dataReasons, "no fresh aircraft data for "+strings.Join(stale, ", "))
+	}
+
+	switch anthropic := checkAnthropic(); {
+	case replayAnalysis:
+	case getSecret("ANTHROPIC_API_KEY") == "":
+		aiReasons = append(aiReasons, "AI analysis not configured")
+	case !anthropic.OK:
+		aiReasons = append(aiReasons, "Anthropic "+anthropic.Detail)
+	case analysisErr != nil:
+		aiReasons = append(aiReasons, "last analysis failed: "+analysisErr.Error())
+	}
+	if pollControl.AnalysisPaused() {
+		aiReasons = append(aiReasons, "AI analysis paused by an admin")
+	}
+	if !features.Enabled(FlagAIAnalysis, "") {
+		aiReasons = append(aiReasons, "AI analysis disabled by feature flag")
+	}
+
+	reasons = append(dataReasons, aiReasons...)
+	switch {
+	case replay:
+		mode = ModeOfflineReplay
+		reasons = append([]string{"serving recorded data"}, reasons...)
+	case len(dataReasons) > 0:
+		mode = ModeDegradedData
+	case len(aiReasons) > 0:
+		mode = ModeDegradedAI
+	default:
+		mode = ModeNormal
+	}
+	return mode, reasons, stale
+}
+
+// currentMode returns the mode as of the last evaluation.
+func currentMode() OperatingMode {
+	modeState.Lock()
+	defer modeState.Unlock()
+	return modeState.current
+}
+
+// updateMode re-evaluates the mode and returns it, and whether it changed.
+func updateMode() (OperatingMode, bool) {
+	mode, reasons, stale := evaluateMode()
+	modeState.Lock()
+	defer modeState.Unlock()
+	changed := modeState.current.Mode != mode
+	if changed {
+		if from := modeState.current.Mode; from == "" {
+			serverLog.Info("Operating mode", "mode", mode, "reasons", strings.Join(reasons, "; "))
+		} else if mode == ModeNormal {
+			serverLog.Info("Operating mode changed", "from", from, "to", mode)
+		} else {
+			serverLog.Warn("Operating mode changed", "from", from, "to", mode, "reasons", strings.Join(reasons, "; "))
+		}
+		modeState.current.Mode, modeState.current.Since = mode, time.Now().UTC()
+	}
+	modeState.current.Reasons, modeState.current.StaleRegions = reasons, stale
+	return modeState.current, changed
+}
+
+// runModeMonitor re-evaluates the mode every second and sends it to every
+// WebSocket client as a heartbeat: at once when it changes, otherwise every
+// heartbeatInterval.
+func runModeMonitor() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	lastBeat := time.Now()
+	for {
+		select {
+		case <-stopping:
+			return
+		case <-ticker.C:
+		}
+		mode, changed := updateMode()
+		if changed || time.Since(lastBeat) >= heartbeatInterval {
+			broadcastHeartbeat(mode)
+			lastBeat = time.Now()
+		}
+	}
+}
+
+// heartbeatMessage is the WebSocket message carrying the mode.
+func heartbeatMessage(mode OperatingMode) map[string]interface{} {
+	return map[string]interface{}{
+		"type":      "heartbeat",
+		"timestamp": time.Now().Unix(),
+		"mode":      mode,
+	}
+}
+
+func broadcastHeartbeat(mode OperatingMode) {
+	message := heartbeatMessage(mode)
+	recorder.Broadcast("", message)
+	clientsMutex.RLock()
+	defer clientsMutex.RUnlock()
+	for conn := range clients {
+		if err := conn.send(message); err != nil {
+			wsLog.Warn("Write heartbeat to client failed", "err", err)
+		}
+	}
+}
+
+// withModeHeader adds X-Operating-Mode to every response.
+func withModeHeader(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if mode := currentMode().Mode; mode != "" {
+			w.Header().Set("X-Operating-Mode", mode)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleMode serves GET /api/mode.
+func handleMode(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(currentMode())
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// MTLSListener is a second HTTPS port for machines — feeders, TAK bridges,
+// and other downstream consumers — that authenticate with a client
+// certificate instead of an API key. It serves the same API as the main
+// port; a certificate's common name maps to a role via MTLS_CLIENTS.
+type MTLSListener struct {
+	addr    string
+	certs   *certFiles
+	pool    *x509.CertPool
+	clients map[string]string // common name -> role
+}
+
+var mtlsListener *MTLSListener
+
+// newMTLSFromEnv returns nil when MTLS_ADDR is unset.
+//
+//	MTLS_ADDR                      — listen address, e.g. ":8444"
+//	MTLS_CLIENT_CA                 — PEM bundle of CAs that issue client certificates (required)
+//	MTLS_CLIENTS                   — comma-separated "common-name:role", e.g. "feeder-01:analyst,tak-bridge:viewer"
+//	MTLS_CERT_FILE, MTLS_KEY_FILE  — server certificate (default: TLS_CERT_FILE / TLS_KEY_FILE)
+//
+// Certificates from the CA whose common name is not listed are refused.
+func newMTLSFromEnv() (*MTLSListener, error) {
+	addr := os.Getenv("MTLS_ADDR")
+	if addr == "" {
+		return nil, nil
+	}
+	caFile := os.Getenv("MTLS_CLIENT_CA")
+	if caFile == "" {
+		return nil, fmt.Errorf("MTLS_CLIENT_CA is required with MTLS_ADDR")
+	}
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("read MTLS_CLIENT_CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("MTLS_CLIENT_CA: no certificates in %s", caFile)
+	}
+
+	certFile, keyFile := os.Getenv("MTLS_CERT_FILE"), os.Getenv("MTLS_KEY_FILE")
+	if certFile == "" && keyFile == "" {
+		certFile, keyFile = os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE")
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("MTLS_CERT_FILE and MTLS_KEY_FILE (or TLS_CERT_FILE and TLS_KEY_FILE) are required with MTLS_ADDR")
+	}
+	certs := &certFiles{certFile: certFile, keyFile: keyFile}
+	if _, err := certs.GetCertificate(nil); err != nil {
+		return nil, err
+	}
+
+	clients := map[string]string{}
+	for _, entry := range splitList(os.Getenv("MTLS_CLIENTS")) {
+		cn, role, ok := strings.Cut(entry, ":")
+		cn, role = strings.TrimSpace(cn), strings.TrimSpace(role)
+		if !ok || cn == "" || !validRole(role) {
+			return nil, fmt.Errorf("MTLS_CLIENTS: %q is not \"common-name:role\" with role viewer, analyst, or admin", entry)
+		}
+		clients[cn] = role
+	}
+	if len(clients) == 0 {
+		return nil, fmt.Errorf("MTLS_CLIENTS is required with MTLS_ADDR")
+	}
+	return &MTLSListener{addr: addr, certs: certs, pool: pool, clients: clients}, nil
+}
+
+// ListenAndServe serves handler to clients presenting a certificate signed
+// by MTLS_CLIENT_CA. It blocks, so run it in a goroutine.
+func (m *MTLSListener) ListenAndServe(handler http.Handler) error {
+	srv := trackServer(&http.Server{
+		Addr:              m.addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+		TLSConfig: &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: m.certs.GetCertificate,
+			ClientCAs:      m.pool,
+			ClientAuth:     tls.RequireAndVerifyClientCert,
+		},
+	})
+	return srv.ListenAndServeTLS("", "")
+}
+
+// viaMTLS reports whether r arrived on the mTLS listener.
+func viaMTLS(r *http.Request) bool {
+	return mtlsListener != nil && r.TLS != nil && len(r.TLS.VerifiedChains) > 0
+}
+
+// certPrincipal identifies a request made with a verified client
+// certificate. Only the mTLS listener verifies client certificates, so
+// requests on other ports never match.
+func certPrincipal(r *http.Request) *Principal {
+	if !viaMTLS(r) {
+		return nil
+	}
+	cn := certName(r)
+	role, ok := mtlsListener.clients[cn]
+	if !ok {
+		return nil
+	}
+	return &Principal{Kind: "cert", Name: cn, Role: role, Workspace: workspaces.OfCert(cn)}
+}
+
+// certName is the common name of a verified client certificate.
+func certName(r *http.Request) string {
+	return r.TLS.VerifiedChains[0][0].Subject.CommonName
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Slack attachment colors keyed by severity
+var slackColors = map[string]string{
+	"CRITICAL": "#d32f2f",
+	"HIGH":     "#f57c00",
+	"MEDIUM":   "#fbc02d",
+	"LOW":      "#1976d2",
+	"NOMINAL":  "#388e3c",
+}
+
+// newChannelNotifiersFromEnv builds the Slack, webhook, SMS, and email
+// notifiers that have credentials configured.
+//
+//	SLACK_WEBHOOK_URL   — Slack incoming webhook
+//	WEBHOOK_URLS        — comma-separated URLs that receive the raw alert JSON
+//	WEBHOOK_SECRETS     — HMAC signing secret for all WEBHOOK_URLS, or comma-separated, one per URL
+//	TWILIO_ACCOUNT_SID, TWILIO_AUTH_TOKEN, TWILIO_FROM, SMS_TO (comma-separated)
+//	EMAIL_TO            — comma-separated recipients, sent through the SMTP_* server (see newMailerFromEnv)
+func newChannelNotifiersFromEnv() ([]AlertNotifier, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	var notifiers []AlertNotifier
+
+	if u := getSecret("SLACK_WEBHOOK_URL"); u != "" {
+		notifiers = append(notifiers, &SlackNotifier{webhookURL: u, client: client})
+	}
+	if urls := splitList(getSecret("WEBHOOK_URLS")); len(urls) > 0 {
+		secrets, err := endpointSecrets("WEBHOOK_SECRETS", len(urls))
+		if err != nil {
+			return nil, err
+		}
+		if secrets == nil {
+			secrets = make([][]byte, len(urls))
+		}
+		notifiers = append(notifiers, &WebhookNotifier{urls: urls, secrets: secrets, client: client})
+	}
+	sid, token := getSecret("TWILIO_ACCOUNT_SID"), getSecret("TWILIO_AUTH_TOKEN")
+	if to := splitList(os.Getenv("SMS_TO")); sid != "" && token != "" && len(to) > 0 {
+		notifiers = append(notifiers, &SMSNotifier{
+			accountSID: sid,
+			authToken:  token,
+			from:       os.Getenv("TWILIO_FROM"),
+			to:         to,
+			client:     client,
+		})
+	}
+	if to := splitList(os.Getenv("EMAIL_TO")); len(to) > 0 {
+		if mailer == nil {
+			return nil, fmt.Errorf("EMAIL_TO needs SMTP_HOST")
+		}
+		notifiers = append(notifiers, &EmailNotifier{mailer: mailer, to: to})
+	}
+	return notifiers, nil
+}
+
+// SlackNotifier posts alert transitions to a Slack incoming webhook.
+type SlackNotifier struct {
+	webhookURL string
+	client     *http.Client
+}
+
+func (n *SlackNotifier) Name() string { return "slack" }
+
+func (n *SlackNotifier) Notify(event string, alert *Alert) error {
+	color := slackColors[alert.Severity]
+	if event == AlertResolved {
+		color = slackColors["NOMINAL"]
+	}
+
+	fields := []map[string]interface{}{
+		{"title": "Region", "value": alert.Region, "short": true},
+		{"title": "Severity", "value": alert.Severity, "short": true},
+	}
+	if alert.Callsign != "" || alert.ICAO24 != "" {
+		fields = append(fields, map[string]interface{}{
+			"title": "Aircraft", "value": strings.TrimSpace(alert.Callsign + " " + alert.ICAO24), "short": true,
+		})
+	}
+	if event == AlertAcked {
+		fields = append(fields, map[string]interface{}{
+			"title": "Acknowledged by", "value": alert.AckedBy, "short": true,
+		})
+	}
+
+	return postJSON(n.client, "POST", n.webhookURL, map[string]interface{}{
+		"text": fmt.Sprintf("*[%s]* %s", strings.ToUpper(event), alert.Title),
+		"attachments": []map[string]interface{}{{
+			"color":  color,
+			"text":   alert.Message,
+			"fields": fields,
+			"ts":     alert.LastSeen.Unix(),
+		}},
+	}, nil, nil)
+}
+
+// WebhookNotifier posts {"event", "alert"} JSON to each configured URL,
+// signed with that URL's secret when WEBHOOK_SECRETS is set.
+type WebhookNotifier struct {
+	urls    []string
+	secrets [][]byte // parallel to urls
+	client  *http.Client
+}
+
+func (n *WebhookNotifier) Name() string { return "webhook" }
+
+func (n *WebhookNotifier) Notify(event string, alert *Alert) error {
+	body := map[string]interface{}{
+		"event": event,
+		"alert": alert,
+	}
+	var errs []string
+	for i, u := range n.urls {
+		if err := postJSON(n.client, "POST", u, body, nil, n.secrets[i]); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// SMSNotifier texts alert openings, escalations, and resolutions via Twilio.
+type SMSNotifier struct {
+	accountSID string
+	authToken  string
+	from       string
+	to         []string
+	client     *http.Client
+}
+
+func (n *SMSNotifier) Name() string { return "sms" }
+
+func (n *SMSNotifier) Notify(event string, alert *Alert) error {
+	if event == AlertAcked {
+		return nil // the person acking already knows
+	}
+	text := truncate(fmt.Sprintf("SWARM C2 %s %s: %s", alert.Severity, strings.ToUpper(event), alert.Title), 320)
+	endpoint := fmt.Sprintf("https://api.twilio.com/2010-04-01/Accounts/%s/Messages.json", n.accountSID)
+
+	var errs []string
+	for _, to := range n.to {
+		form := url.Values{"To": {to}, "From": {n.from}, "Body": {text}}
+		req, err := http.NewRequest("POST", endpoint, strings.NewReader(form.Encode()))
+		if err != nil {
+			return fmt.Errorf("create request: %w", err)
+		}
+		req.SetBasicAuth(n.accountSID, n.authToken)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		resp, err := n.client.Do(req)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		if resp.StatusCode >= 300 {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+			errs = append(errs, fmt.Sprintf("twilio %s returned %d: %s", to, resp.StatusCode, strings.TrimSpace(string(body))))
+		}
+		resp.Body.Close()
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// postJSON sends body as JSON and treats any non-2xx response as an error.
+// A non-nil secret signs the request (see signRequest).
+func postJSON(client *http.Client, method, url string, body interface{}, header http.Header, secret []byte) error {
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("marshal request: %w", err)
+	}
+
+	req, err := http.NewRequest(method, url, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	signRequest(req, secret, jsonBody)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request %s: %w", req.URL.Host, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s returned %d: %s", req.URL.Host, resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	return nil
+}
+
+// splitList splits a comma-separated value, dropping blanks.
+func splitList(v string) []string {
+	var result []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			result = append(result, s)
+		}
+	}
+	return result
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultOpenSkyURL      = "https://opensky-network.org/api"
+	defaultOpenSkyTokenURL = "https://auth.opensky-network.org/auth/realms/opensky-network/protocol/openid-connect/token"
+
+	// openSkyMaxBackoff caps how long a poller waits after repeated errors
+	// or a 429 without a retry hint. A retry hint is always honored.
+	openSkyMaxBackoff = 5 * time.Minute
+)
+
+// errRateLimited is returned by Fetch on HTTP 429.
+var errRateLimited = errors.New("rate limited")
+
+// OpenSkyClient fetches live state vectors from the OpenSky Network REST
+// API, authenticating with OAuth2 client credentials, legacy Basic auth, or
+// anonymously (with OpenSky's lower anonymous quota).
+type OpenSkyClient struct {
+	baseURL, tokenURL      string
+	clientID, clientSecret string
+	username, password     string
+	client                 *http.Client
+
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+// openSky is nil when aircraft come from the simulator.
+var openSky *OpenSkyClient
+
+// newOpenSkyFromEnv returns nil unless AIRCRAFT_SOURCE is "opensky" or
+// OpenSky credentials are set.
+//
+//	AIRCRAFT_SOURCE       — "simulator" or "opensky" (default: opensky if credentials are set)
+//	OPENSKY_CLIENT_ID     — OAuth2 API client (accounts created since March 2025)
+//	OPENSKY_CLIENT_SECRET
+//	OPENSKY_USERNAME      — Basic auth for older accounts
+//	OPENSKY_PASSWORD
+//	OPENSKY_URL           — API base (default https://opensky-network.org/api)
+//	OPENSKY_TOKEN_URL     — OAuth2 token endpoint (default OpenSky's)
+func newOpenSkyFromEnv() (*OpenSkyClient, error) {
+	o := &OpenSkyClient{
+		baseURL:      strings.TrimRight(os.Getenv("OPENSKY_URL"), "/"),
+		tokenURL:     os.Getenv("OPENSKY_TOKEN_URL"),
+		clientID:     os.Getenv("OPENSKY_CLIENT_ID"),
+		clientSecret: getSecret("OPENSKY_CLIENT_SECRET"),
+		username:     os.Getenv("OPENSKY_USERNAME"),
+		password:     getSecret("OPENSKY_PASSWORD"),
+		client:       &http.Client{Timeout: 20 * time.Second},
+	}
+	if (o.clientID == "") != (o.clientSecret == "") {
+		return nil, fmt.Errorf("OPENSKY_CLIENT_ID and OPENSKY_CLIENT_SECRET must be set together")
+	}
+	if (o.username == "") != (o.password == "") {
+		return nil, fmt.Errorf("OPENSKY_USERNAME and OPENSKY_PASSWORD must be set together")
+	}
+	credentials := o.clientID != "" || o.username != ""
+	switch source := os.Getenv("AIRCRAFT_SOURCE"); source {
+	case "":
+		if !credentials {
+			return nil, nil
+		}
+	case "simulator":
+		return nil, nil
+	case "opensky":
+	default:
+		return nil, fmt.Errorf("AIRCRAFT_SOURCE: unknown source %q (want simulator or opensky)", source)
+	}
+	if o.baseURL == "" {
+		o.baseURL = defaultOpenSkyURL
+	}
+	if o.tokenURL == "" {
+		o.tokenURL = defaultOpenSkyTokenURL
+	}
+	return o, nil
+}
+
+// Auth describes how the client authenticates, for logs.
+func (o *OpenSkyClient) Auth() string {
+	switch {
+	case o.clientID != "":
+		return "oauth2"
+	case o.username != "":
+		return "basic"
+	default:
+		return "anonymous"
+	}
+}
+
+// accessToken returns a cached OAuth2 token, fetching a new one a minute
+// before the old one expires.
+func (o *OpenSkyClient) accessToken(ctx context.Context) (_ string, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.token != "" && time.Now().Before(o.tokenExpiry) {
+		return o.token, nil
+	}
+	ctx, span := startSpan(ctx, "opensky.token", SpanClient)
+	defer func() { span.End(err) }()
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {o.clientID},
+		"client_secret": {o.clientSecret},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("token request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("token request: HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil || tok.AccessToken == "" {
+		return "", fmt.Errorf("token request: no access_token in response")
+	}
+	o.token = tok.AccessToken
+	o.tokenExpiry = time.Now().Add(time.Duration(tok.ExpiresIn)*time.Second - time.Minute)
+	return o.token, nil
+}
+
+func (o *OpenSkyClient) dropToken() {
+	o.mu.Lock()
+	o.token = ""
+	o.mu.Unlock()
+}
+
+// statesRequest builds an authenticated request for the state vectors
+// inside a bounding box.
+func (o *OpenSkyClient) statesRequest(ctx context.Context, box Region) (*http.Request, error) {
+	q := url.Values{
+		"lamin":    {strconv.FormatFloat(box.MinLat, 'f', -1, 64)},
+		"lomin":    {strconv.FormatFloat(box.MinLon, 'f', -1, 64)},
+		"lamax":    {strconv.FormatFloat(box.MaxLat, 'f', -1, 64)},
+		"lomax":    {strconv.FormatFloat(box.MaxLon, 'f', -1, 64)},
+		"extended": {"1"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, o.baseURL+"/states/all?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case o.clientID != "":
+		token, err := o.accessToken(ctx)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	case o.username != "":
+		req.SetBasicAuth(o.username, o.password)
+	}
+	return req, nil
+}
+
+// Fetch gets the current state vectors inside a region and records the
+// request in the upstream stats. On HTTP 429 it returns errRateLimited and
+// OpenSky's retry hint, if it sent one.
+func (o *OpenSkyClient) Fetch(ctx context.Context, regionName string) (_ *AirspaceData, _ time.Duration, err error) {
+	region, ok := regions[regionName]
+	if !ok {
+		return nil, 0, fmt.Errorf("unknown region %q", regionName)
+	}
+	ctx, span := startSpan(ctx, "opensky.states", SpanClient, "region", regionName)
+	defer func() { span.End(err) }()
+	req, err := o.statesRequest(ctx, region)
+	if err != nil {
+		upstream.Record(regionName, "opensky", 0, 0, nil, err)
+		return nil, 0, err
+	}
+
+	start := time.Now()
+	resp, err := o.client.Do(req)
+	if err != nil {
+		upstream.Record(regionName, "opensky", time.Since(start), 0, nil, err)
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	span.SetAttrs("http.status_code", resp.StatusCode)
+	data, err := o.decodeStates(regionName, resp)
+	upstream.Record(regionName, "opensky", time.Since(start), resp.StatusCode, resp.Header, err)
+	if errors.Is(err, errRateLimited) {
+		retry, _ := strconv.Atoi(resp.Header.Get("X-Rate-Limit-Retry-After-Seconds"))
+		return nil, time.Duration(retry) * time.Second, err
+	}
+	return data, 0, err
+}
+
+// Probe fetches a box a tenth of a degree across in the middle of a region,
+// the smallest request OpenSky charges for, and returns how many aircraft
+// were in it. It isn't counted in the upstream stats.
+func (o *OpenSkyClient) Probe(ctx context.Context, regionName string) (_ int, err error) {
+	ctx, span := startSpan(ctx, "opensky.states", SpanClient, "region", regionName, "probe", true)
+	defer func() { span.End(err) }()
+	region := regions[regionName]
+	lat, lon := (region.MinLat+region.MaxLat)/2, (region.MinLon+region.MaxLon)/2
+	req, err := o.statesRequest(ctx, Region{MinLat: lat - 0.05, MaxLat: lat + 0.05, MinLon: lon - 0.05, MaxLon: lon + 0.05})
+	if err != nil {
+		return 0, err
+	}
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	span.SetAttrs("http.status_code", resp.StatusCode)
+	data, err := o.decodeStates(regionName, resp)
+	if err != nil {
+		return 0, err
+	}
+	return data.Count, nil
+}
+
+func (o *OpenSkyClient) decodeStates(regionName string, resp *http.Response) (*AirspaceData, error) {
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusTooManyRequests:
+		return nil, errRateLimited
+	case http.StatusUnauthorized:
+		o.dropToken()
+		return nil, fmt.Errorf("HTTP 401: credentials rejected")
+	default:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var body struct {
+		Time   int64               `json:"time"`
+		States [][]json.RawMessage `json:"states"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("decode states: %w", err)
+	}
+	aircraft := make([]Aircraft, 0, len(body.States))
+	for _, s := range body.States {
+		if ac, ok := parseStateVector(s); ok {
+			aircraft = append(aircraft, ac)
+		}
+	}
+	if body.Time == 0 {
+		body.Time = time.Now().Unix()
+	}
+	return &AirspaceData{
+		Timestamp: body.Time,
+		Aircraft:  aircraft,
+		Region:    regionName,
+		Count:     len(aircraft),
+	}, nil
+}
+
+// parseStateVector reads one of OpenSky's positional state arrays. The
+// 18th field, category, is only sent with extended=1.
+func parseStateVector(s []json.RawMessage) (Aircraft, bool) {
+	var ac Aircraft
+	fields := []interface{}{
+		&ac.ICAO24, &ac.Callsign, &ac.OriginCountry, &ac.TimePosition, &ac.LastContact,
+		&ac.Longitude, &ac.Latitude, &ac.BaroAltitude, &ac.OnGround, &ac.Velocity,
+		&ac.TrueTrack, &ac.VerticalRate, &ac.Sensors, &ac.GeoAltitude, &ac.Squawk,
+		&ac.SPI, &ac.PositionSource, &ac.Category,
+	}
+	if len(s) < len(fields)-1 {
+		return Aircraft{}, false
+	}
+	for i, raw := range s {
+		if i == len(fields) {
+			break
+		}
+		if err := json.Unmarshal(raw, fields[i]); err != nil {
+			return Aircraft{}, false
+		}
+	}
+	ac.Callsign = strings.TrimSpace(ac.Callsign)
+	return ac, ac.ICAO24 != ""
+}
+
+// pollOpenSky fetches a region every poll interval while this replica leads
+// it and polling isn't paused. After a 429 it waits as long as OpenSky asks (X-Rate-Limit-Retry-
+// After-Seconds), and after errors it doubles its wait up to
+// openSkyMaxBackoff; the effective interval is reported in the upstream
+// stats.
+func pollOpenSky(regionName string) {
+	fetcherLog.Info("OpenSky poller started", "region", regionName, "auth", openSky.Auth())
+	var backoff time.Duration
+	for {
+		interval := pollControl.Interval(regionName)
+		if backoff > interval {
+			interval = backoff
+		}
+		upstream.SetInterval(regionName, "opensky", interval)
+		forced := false
+		select {
+		case <-stopping:
+			return
+		case <-time.After(interval):
+		case <-pollControl.Wake(regionName):
+			forced = true
+		}
+		if cluster != nil {
+			followLeader(regionName)
+		}
+		if !isLeader(regionName) || (pollControl.Paused(regionName) && !forced) {
+			continue
+		}
+
+		data, retryAfter, err := openSky.Fetch(context.Background(), regionName)
+		if err != nil {
+			next := backoff * 2
+			if next == 0 {
+				next = 2 * pollControl.Interval(regionName)
+			}
+			backoff = min(next, openSkyMaxBackoff)
+			if retryAfter > 0 {
+				backoff = retryAfter // quota exhausted: retrying sooner won't help
+			}
+			fetcherLog.Warn("OpenSky fetch failed", "region", regionName, "err", err, "retry_in", backoff.String())
+			continue
+		}
+		if backoff > 0 {
+			fetcherLog.Info("OpenSky fetch recovered", "region", regionName)
+			backoff = 0
+		}
+		ingestAirspace(data)
+		cluster.PublishAirspace(data)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// panicCounts is published in /debug/vars as "panics", keyed by where the
+// panic was recovered.
+var panicCounts = expvar.NewMap("panics")
+
+// reportPanic logs a recovered panic with its stack, counts it, and sends it
+// to Sentry if configured.
+func reportPanic(where string, v interface{}, stack []byte, args ...any) {
+	panicCounts.Add(where, 1)
+	args = append([]any{"where", where, "panic", fmt.Sprint(v), "stack", string(stack)}, args...)
+	serverLog.Error("Recovered from panic", args...)
+	sentry.Report(where, v, stack)
+}
+
+// recoverPanic reports a panic in the calling goroutine and lets it end
+// normally. Use it as `defer recoverPanic("name")` in goroutines that have
+// nothing to restart, like one client's connection.
+func recoverPanic(where string) {
+	if v := recover(); v != nil {
+		reportPanic(where, v, debug.Stack())
+	}
+}
+
+// runRecovered runs fn, reporting a panic instead of crashing. It returns
+// true if fn panicked.
+func runRecovered(where string, fn func()) (panicked bool) {
+	defer func() {
+		if v := recover(); v != nil {
+			reportPanic(where, v, debug.Stack())
+			panicked = true
+		}
+	}()
+	fn()
+	return false
+}
+
+// goSupervised runs a long-lived loop in a goroutine and restarts it a
+// second after a panic, until shutdown.
+func goSupervised(name string, fn func()) {
+	go supervise(name, fn)
+}
+
+func supervise(name string, fn func()) {
+	for runRecovered(name, fn) {
+		select {
+		case <-stopping:
+			return
+		case <-time.After(time.Second):
+			serverLog.Warn("Restarting after panic", "where", name)
+		}
+	}
+}
+
+// recoverHTTP turns a handler panic into a 500, with the stack in the log
+// under the request's correlation ID, instead of net/http's bare message.
+// For a WebSocket the connection is already hijacked, so it just closes.
+func recoverHTTP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v) // net/http's way of aborting a response quietly
+			}
+			reportPanic("http", v, debug.Stack(), "request_id", requestID(r), "method", r.Method, "path", r.URL.Path)
+			if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// SentryReporter sends panics to Sentry's store endpoint. A nil reporter
+// does nothing.
+type SentryReporter struct {
+	endpoint    string
+	auth        string
+	environment string
+	client      *http.Client
+}
+
+var sentry *SentryReporter
+
+// newSentryFromEnv returns nil when SENTRY_DSN is unset.
+//
+//	SENTRY_DSN         — https://<key>@<host>/<project>
+//	SENTRY_ENVIRONMENT — environment tag (default "production")
+func newSentryFromEnv() (*SentryReporter, error) {
+	dsn := getSecret("SENTRY_DSN")
+	if dsn == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(dsn)
+	if err != nil || u.User == nil || u.Host == "" {
+		return nil, fmt.Errorf("SENTRY_DSN: %q is not https://<key>@<host>/<project>", dsn)
+	}
+	path, project := "", strings.Trim(u.Path, "/")
+	if i := strings.LastIndex(project, "/"); i >= 0 {
+		path, project = "/"+project[:i], project[i+1:]
+	}
+	if project == "" {
+		return nil, fmt.Errorf("SENTRY_DSN: no project ID in %q", dsn)
+	}
+	s := &SentryReporter{
+		endpoint:    fmt.Sprintf("%s://%s%s/api/%s/store/", u.Scheme, u.Host, path, project),
+		auth:        "Sentry sentry_version=7, sentry_client=swarm-c2/1.0, sentry_key=" + u.User.Username(),
+		environment: os.Getenv("SENTRY_ENVIRONMENT"),
+		client:      &http.Client{Timeout: 10 * time.Second},
+	}
+	if s.environment == "" {
+		s.environment = "production"
+	}
+	return s, nil
+}
+
+// Report sends one panic as an error event, in the background.
+func (s *SentryReporter) Report(where string, v interface{}, stack []byte) {
+	if s == nil {
+		return
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	host, _ := os.Hostname()
+	event := map[string]interface{}{
+		"event_id":    hex.EncodeToString(id),
+		"timestamp":   time.Now().UTC().Format(time.RFC3339),
+		"level":       "error",
+		"platform":    "go",
+		"logger":      where,
+		"server_name": host,
+		"environment": s.environment,
+		"tags":        map[string]string{"where": where},
+		"exception": map[string]interface{}{
+			"values": []map[string]interface{}{{"type": "panic", "value": fmt.Sprint(v)}},
+		},
+		"extra": map[string]string{"stack": string(stack)},
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	go func() {
+		req, err := http.NewRequest(http.MethodPost, s.endpoint, bytes.NewReader(body))
+		if err != nil {
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Sentry-Auth", s.auth)
+		resp, err := s.client.Do(req)
+		if err != nil {
+			serverLog.Warn("Sentry report failed", "err", err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			serverLog.Warn("Sentry report rejected", "status", resp.StatusCode)
+		}
+	}()
+}
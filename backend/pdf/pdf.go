@@ -0,0 +1,330 @@
+// Package pdf writes simple flowing text documents — headings, paragraphs,
+// banners, and tables — as PDF 1.4 using the standard Helvetica fonts, so no
+// font files or external libraries are needed. Text is WinAnsi encoded;
+// characters outside it are replaced with '?'.
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// US Letter with 0.75 in margins, in points.
+const (
+	pageWidth  = 612.0
+	pageHeight = 792.0
+	margin     = 54.0
+	textWidth  = pageWidth - 2*margin
+)
+
+// Color is an RGB fill color with components in 0..1.
+type Color struct{ R, G, B float64 }
+
+// HexColor parses "#rrggbb", returning black for anything else.
+func HexColor(s string) Color {
+	var r, g, b uint8
+	if _, err := fmt.Sscanf(s, "#%02x%02x%02x", &r, &g, &b); err != nil {
+		return Color{}
+	}
+	return Color{float64(r) / 255, float64(g) / 255, float64(b) / 255}
+}
+
+var (
+	black     = Color{}
+	white     = Color{1, 1, 1}
+	headerRow = Color{0.88, 0.88, 0.88}
+	ruleGray  = Color{0.6, 0.6, 0.6}
+)
+
+// Document lays content out top to bottom, starting new pages as needed.
+type Document struct {
+	// Footer is printed on every page next to the page number.
+	Footer string
+
+	pages []*bytes.Buffer
+	page  *bytes.Buffer
+	y     float64 // baseline cursor, from the bottom of the page
+}
+
+// New returns an empty document with one page.
+func New() *Document {
+	d := &Document{}
+	d.newPage()
+	return d
+}
+
+func (d *Document) newPage() {
+	d.page = &bytes.Buffer{}
+	d.pages = append(d.pages, d.page)
+	d.y = pageHeight - margin
+}
+
+// ensure starts a new page unless h points fit above the bottom margin.
+func (d *Document) ensure(h float64) {
+	if d.y-h < margin {
+		d.newPage()
+	}
+}
+
+// Space adds vertical space.
+func (d *Document) Space(h float64) {
+	d.y -= h
+}
+
+// Title writes a large bold line.
+func (d *Document) Title(s string) {
+	d.ensure(24)
+	d.y -= 18
+	d.text(margin, d.y, 18, true, black, s)
+	d.y -= 8
+}
+
+// Heading writes a bold section heading with a rule beneath it.
+func (d *Document) Heading(s string) {
+	d.ensure(40) // keep the heading with at least a line of its section
+	d.y -= 18
+	d.text(margin, d.y, 12, true, black, s)
+	d.y -= 5
+	d.rule(d.y)
+	d.y -= 4
+}
+
+// Paragraph writes wrapped text.
+func (d *Document) Paragraph(s string, size float64, bold bool) {
+	lh := size * 1.3
+	for _, line := range Wrap(s, textWidth, size, bold) {
+		d.ensure(lh)
+		d.y -= lh
+		d.text(margin, d.y+size*0.25, size, bold, black, line)
+	}
+}
+
+// Banner writes s in bold white on a full-width colored bar.
+func (d *Document) Banner(s string, fill Color) {
+	const size, pad = 12.0, 6.0
+	d.ensure(size + 2*pad)
+	d.y -= size + 2*pad
+	d.rect(margin, d.y, textWidth, size+2*pad, fill)
+	d.text(margin+pad, d.y+pad+size*0.2, size, true, white, s)
+}
+
+// Table writes a grid with a shaded header row. widths are fractions of the
+// text width; cells wrap within their column. The header is repeated when
+// the table breaks across pages.
+func (d *Document) Table(widths []float64, header []string, rows [][]string) {
+	const size, pad = 9.0, 3.0
+	lh := size * 1.25
+
+	layout := func(cells []string, bold bool) ([][]string, float64) {
+		wrapped := make([][]string, len(widths))
+		lines := 1
+		for i := range widths {
+			cell := ""
+			if i < len(cells) {
+				cell = cells[i]
+			}
+			wrapped[i] = Wrap(cell, widths[i]*textWidth-2*pad, size, bold)
+			if len(wrapped[i]) > lines {
+				lines = len(wrapped[i])
+			}
+		}
+		return wrapped, float64(lines)*lh + 2*pad
+	}
+	draw := func(wrapped [][]string, h float64, bold bool, fill *Color) {
+		d.y -= h
+		if fill != nil {
+			d.rect(margin, d.y, textWidth, h, *fill)
+		}
+		x := margin
+		for i, lines := range wrapped {
+			for j, line := range lines {
+				d.text(x+pad, d.y+h-pad-float64(j+1)*lh+size*0.25, size, bold, black, line)
+			}
+			x += widths[i] * textWidth
+		}
+		d.rule(d.y)
+	}
+
+	head, headH := layout(header, true)
+	drawHeader := func() { draw(head, headH, true, &headerRow) }
+
+	d.ensure(headH + lh + 2*pad)
+	drawHeader()
+	for _, row := range rows {
+		wrapped, h := layout(row, false)
+		if d.y-h < margin {
+			d.newPage()
+			drawHeader()
+		}
+		draw(wrapped, h, false, nil)
+	}
+}
+
+func (d *Document) text(x, y, size float64, bold bool, c Color, s string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(d.page, "BT %.3f %.3f %.3f rg /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n",
+		c.R, c.G, c.B, font, size, x, y, escape(encode(s)))
+}
+
+func (d *Document) rect(x, y, w, h float64, c Color) {
+	fmt.Fprintf(d.page, "%.3f %.3f %.3f rg %.2f %.2f %.2f %.2f re f\n", c.R, c.G, c.B, x, y, w, h)
+}
+
+func (d *Document) rule(y float64) {
+	fmt.Fprintf(d.page, "%.3f %.3f %.3f RG 0.5 w %.2f %.2f m %.2f %.2f l S\n",
+		ruleGray.R, ruleGray.G, ruleGray.B, margin, y, pageWidth-margin, y)
+}
+
+// Bytes renders the finished document, adding footers and page numbers. Call
+// it once, after all content has been added.
+func (d *Document) Bytes() []byte {
+	var out bytes.Buffer
+	var offsets []int
+	obj := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// Objects 1-4 are fixed; each page then takes a page and a content object.
+	n := len(d.pages)
+	kids := make([]string, n)
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	obj("<< /Type /Catalog /Pages 2 0 R >>")
+	obj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), n))
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+
+	for i, page := range d.pages {
+		d.page = page
+		footer := fmt.Sprintf("Page %d of %d", i+1, n)
+		d.text(pageWidth-margin-Width(footer, 8, false), margin/2, 8, false, ruleGray, footer)
+		if d.Footer != "" {
+			d.text(margin, margin/2, 8, false, ruleGray, d.Footer)
+		}
+
+		obj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %g %g] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, 6+2*i))
+		obj(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.Len(), page.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes()
+}
+
+// Wrap breaks s into lines no wider than width points, splitting on spaces
+// and hard-breaking words that are too long on their own.
+func Wrap(s string, width, size float64, bold bool) []string {
+	var lines []string
+	for _, para := range strings.Split(s, "\n") {
+		line := ""
+		for _, word := range strings.Fields(para) {
+			candidate := word
+			if line != "" {
+				candidate = line + " " + word
+			}
+			if Width(candidate, size, bold) <= width {
+				line = candidate
+				continue
+			}
+			if line != "" {
+				lines = append(lines, line)
+			}
+			for Width(word, size, bold) > width && len([]rune(word)) > 1 {
+				r := []rune(word)
+				cut := len(r) - 1
+				for cut > 1 && Width(string(r[:cut]), size, bold) > width {
+					cut--
+				}
+				lines = append(lines, string(r[:cut]))
+				word = string(r[cut:])
+			}
+			line = word
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// Width returns the rendered width of s in points.
+func Width(s string, size float64, bold bool) float64 {
+	widths := &helvetica
+	if bold {
+		widths = &helveticaBold
+	}
+	var total int
+	for _, b := range encode(s) {
+		if b >= 32 && b < 127 {
+			total += widths[b-32]
+		} else {
+			total += 556
+		}
+	}
+	return float64(total) * size / 1000
+}
+
+// winAnsi maps the Unicode punctuation that commonly shows up in model
+// output to its WinAnsiEncoding byte.
+var winAnsi = map[rune]byte{
+	'€': 0x80, '…': 0x85, '‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94,
+	'•': 0x95, '–': 0x96, '—': 0x97, '™': 0x99,
+}
+
+func encode(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r == '\t':
+			out = append(out, ' ')
+		case r >= 32 && r < 127, r >= 0xA0 && r <= 0xFF:
+			out = append(out, byte(r))
+		case winAnsi[r] != 0:
+			out = append(out, winAnsi[r])
+		default:
+			out = append(out, '?')
+		}
+	}
+	return out
+}
+
+func escape(b []byte) string {
+	var sb strings.Builder
+	for _, c := range b {
+		if c == '(' || c == ')' || c == '\\' {
+			sb.WriteByte('\\')
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
+
+// Advance widths for ASCII 32..126, from the standard Adobe font metrics.
+var helvetica = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+var helveticaBold = [95]int{
+	278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+	975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+	333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+	611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+}
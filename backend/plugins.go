@@ -0,0 +1,537 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pluginProtocolVersion is sent with every request so plugins can refuse a
+// contract they don't understand.
+const pluginProtocolVersion = 1
+
+const (
+	maxPluginObservations = 100
+	maxPluginResponse     = 4 << 20
+	// pluginNoteMaxAge is how old observations may be and still be passed to
+	// SENTINEL.
+	pluginNoteMaxAge = 5 * time.Minute
+)
+
+// PluginRequest is what a plugin receives for each region picture.
+type PluginRequest struct {
+	Version   int        `json:"version"`
+	Type      string     `json:"type"` // "snapshot"
+	Region    string     `json:"region"`
+	Timestamp int64      `json:"timestamp"`
+	Aircraft  []Aircraft `json:"aircraft"`
+}
+
+// PluginResponse is a plugin's answer: everything it currently observes in
+// the region. An observation missing from the next response is over.
+type PluginResponse struct {
+	Observations []PluginObservation `json:"observations"`
+}
+
+// PluginObservation is one finding. ID identifies it across responses, so a
+// condition that persists updates one alert instead of opening new ones.
+type PluginObservation struct {
+	ID       string                 `json:"id"`
+	Severity string                 `json:"severity"` // NOMINAL, LOW, MEDIUM, HIGH, or CRITICAL
+	Title    string                 `json:"title"`
+	Message  string                 `json:"message,omitempty"`
+	ICAO24   string                 `json:"icao24,omitempty"`
+	Callsign string                 `json:"callsign,omitempty"`
+	Details  map[string]interface{} `json:"details,omitempty"`
+}
+
+// pluginTransport carries one request/response exchange, decoding the
+// reply into resp.
+type pluginTransport interface {
+	Call(ctx context.Context, req []byte, resp *PluginResponse) error
+	Close()
+}
+
+// AnalyzerPlugin is an external detector fed each region picture. Its
+// observations raise alerts and are passed to SENTINEL with the next
+// analysis. Pictures that arrive while it is busy replace each other, so a
+// slow plugin sees the latest picture rather than a backlog.
+type AnalyzerPlugin struct {
+	Name        string
+	Regions     []string // empty means all
+	Interval    time.Duration
+	Timeout     time.Duration
+	MinSeverity string // lowest severity that raises an alert
+	transport   pluginTransport
+	kind        string // alert kind, "plugin:<name>"
+	wake        chan struct{}
+
+	mu           sync.Mutex
+	pending      map[string]*AirspaceData
+	lastSent     map[string]time.Time
+	observations map[string]pluginResult // region -> latest answer
+	status       PluginStatus
+}
+
+type pluginResult struct {
+	at           time.Time
+	observations []PluginObservation
+}
+
+// PluginStatus is a plugin's health as reported by /api/plugins.
+type PluginStatus struct {
+	Name         string                         `json:"name"`
+	Transport    string                         `json:"transport"` // "exec" or "http"
+	Regions      []string                       `json:"regions,omitempty"`
+	Interval     string                         `json:"interval"`
+	Calls        int64                          `json:"calls"`
+	Errors       int64                          `json:"errors"`
+	LastCall     *time.Time                     `json:"lastCall,omitempty"`
+	LastError    string                         `json:"lastError,omitempty"`
+	LastMs       float64                        `json:"lastMs"`
+	Observations map[string][]PluginObservation `json:"observations"` // by region
+}
+
+// pluginSet is every configured plugin; nil when none are.
+type pluginSet []*AnalyzerPlugin
+
+var analyzerPlugins pluginSet
+
+// pluginConfig is one entry of ANALYZER_PLUGINS.
+type pluginConfig struct {
+	Name        string   `json:"name"`
+	Command     []string `json:"command"`
+	URL         string   `json:"url"`
+	Regions     []string `json:"regions"`
+	Interval    string   `json:"interval"`
+	Timeout     string   `json:"timeout"`
+	MinSeverity string   `json:"minSeverity"`
+}
+
+// loadAnalyzerPluginsFromEnv reads plugins from ANALYZER_PLUGINS (inline
+// JSON) or ANALYZER_PLUGINS_FILE, e.g.
+//
+//	[{"name": "spoofing", "command": ["python3", "/opt/detectors/spoof.py"], "interval": "10s"},
+//	 {"name": "ml", "url": "http://localhost:9000/analyze", "regions": ["socal"], "timeout": "10s"}]
+//
+// A command runs as a long-lived subprocess exchanging one JSON line each
+// way per picture on stdin/stdout; a url receives each picture as a POST.
+// interval (default 10s) is the least time between pictures per region,
+// timeout (default 5s) bounds each call, and minSeverity (default LOW) is
+// the lowest observation severity that raises an alert.
+func loadAnalyzerPluginsFromEnv() error {
+	data := []byte(os.Getenv("ANALYZER_PLUGINS"))
+	if path := os.Getenv("ANALYZER_PLUGINS_FILE"); len(data) == 0 && path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return fmt.Errorf("read analyzer plugins: %w", err)
+		}
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	var configs []pluginConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return fmt.Errorf("parse analyzer plugins: %w", err)
+	}
+
+	names := make(map[string]bool)
+	var plugins pluginSet
+	for i, c := range configs {
+		if c.Name == "" || strings.ContainsAny(c.Name, ": ") {
+			return fmt.Errorf("plugin %d: name is required and may not contain spaces or colons", i)
+		}
+		if names[c.Name] {
+			return fmt.Errorf("plugin %q: duplicate name", c.Name)
+		}
+		names[c.Name] = true
+		p := &AnalyzerPlugin{
+			Name:         c.Name,
+			Regions:      c.Regions,
+			Interval:     10 * time.Second,
+			Timeout:      5 * time.Second,
+			MinSeverity:  "LOW",
+			kind:         "plugin:" + c.Name,
+			wake:         make(chan struct{}, 1),
+			pending:      make(map[string]*AirspaceData),
+			lastSent:     make(map[string]time.Time),
+			observations: make(map[string]pluginResult),
+		}
+		for _, region := range c.Regions {
+			if _, ok := regions[region]; !ok {
+				return fmt.Errorf("plugin %q: unknown region %q", c.Name, region)
+			}
+		}
+		for _, d := range []struct {
+			v   string
+			dst *time.Duration
+		}{{c.Interval, &p.Interval}, {c.Timeout, &p.Timeout}} {
+			if d.v == "" {
+				continue
+			}
+			v, err := time.ParseDuration(d.v)
+			if err != nil || v <= 0 {
+				return fmt.Errorf("plugin %q: invalid duration %q", c.Name, d.v)
+			}
+			*d.dst = v
+		}
+		if c.MinSeverity != "" {
+			p.MinSeverity = strings.ToUpper(c.MinSeverity)
+			if _, ok := threatRank[p.MinSeverity]; !ok {
+				return fmt.Errorf("plugin %q: unknown minSeverity %q", c.Name, c.MinSeverity)
+			}
+		}
+		switch {
+		case len(c.Command) > 0 && c.URL == "":
+			p.transport = &execTransport{plugin: c.Name, argv: c.Command}
+			p.status.Transport = "exec"
+		case c.URL != "" && len(c.Command) == 0:
+			if !strings.HasPrefix(c.URL, "http://") && !strings.HasPrefix(c.URL, "https://") {
+				return fmt.Errorf("plugin %q: url must be http(s)", c.Name)
+			}
+			p.transport = &httpTransport{url: c.URL, client: &http.Client{}}
+			p.status.Transport = "http"
+		default:
+			return fmt.Errorf("plugin %q: set exactly one of command or url", c.Name)
+		}
+		p.status.Name, p.status.Regions, p.status.Interval = p.Name, p.Regions, p.Interval.String()
+		plugins = append(plugins, p)
+	}
+	analyzerPlugins = plugins
+	return nil
+}
+
+// Publish offers a new picture to every plugin that wants it. It never
+// blocks; plugins run on the region's leader only.
+func (s pluginSet) Publish(data *AirspaceData) {
+	if len(s) == 0 || !isLeader(data.Region) {
+		return
+	}
+	now := time.Now()
+	for _, p := range s {
+		if len(p.Regions) > 0 && !slices.Contains(p.Regions, data.Region) {
+			continue
+		}
+		p.mu.Lock()
+		due := now.Sub(p.lastSent[data.Region]) >= p.Interval
+		if due {
+			p.lastSent[data.Region] = now
+			p.pending[data.Region] = data
+		}
+		p.mu.Unlock()
+		if due {
+			select {
+			case p.wake <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// Run sends pending pictures to the plugin until shutdown.
+func (p *AnalyzerPlugin) Run() {
+	defer p.transport.Close()
+	for {
+		select {
+		case <-stopping:
+			return
+		case <-p.wake:
+		}
+		p.mu.Lock()
+		pending := p.pending
+		p.pending = make(map[string]*AirspaceData)
+		p.mu.Unlock()
+		for _, data := range pending {
+			p.analyze(data)
+		}
+	}
+}
+
+// analyze runs one picture through the plugin and raises or resolves its
+// alerts. A failed call leaves existing alerts to auto-resolve.
+func (p *AnalyzerPlugin) analyze(data *AirspaceData) {
+	req, err := json.Marshal(PluginRequest{
+		Version: pluginProtocolVersion, Type: "snapshot",
+		Region: data.Region, Timestamp: data.Timestamp, Aircraft: data.Aircraft,
+	})
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), p.Timeout)
+	defer cancel()
+	start := time.Now()
+	var resp PluginResponse
+	err = p.transport.Call(ctx, req, &resp)
+	p.record(start, err)
+	if err != nil {
+		analyzerLog.Warn("Analyzer plugin failed", "plugin", p.Name, "region", data.Region, "err", err)
+		return
+	}
+
+	var kept []PluginObservation
+	seen := make(map[string]bool)
+	for _, o := range resp.Observations {
+		o.Severity = strings.ToUpper(o.Severity)
+		if _, ok := threatRank[o.Severity]; !ok || o.ID == "" || o.Title == "" {
+			analyzerLog.Warn("Analyzer plugin observation ignored: needs id, title, and a known severity", "plugin", p.Name, "id", o.ID)
+			continue
+		}
+		if len(kept) == maxPluginObservations {
+			analyzerLog.Warn("Analyzer plugin observations truncated", "plugin", p.Name, "max", maxPluginObservations)
+			break
+		}
+		kept = append(kept, o)
+		if threatRank[o.Severity] < threatRank[p.MinSeverity] {
+			continue
+		}
+		key := fmt.Sprintf("%s:%s:%s", p.kind, data.Region, o.ID)
+		seen[key] = true
+		details := map[string]interface{}{"plugin": p.Name, "observation": o.ID}
+		for k, v := range o.Details {
+			details[k] = v
+		}
+		alertMgr.Raise(Alert{
+			Key:      key,
+			Kind:     p.kind,
+			Region:   data.Region,
+			Severity: o.Severity,
+			Title:    fmt.Sprintf("%s: %s", p.Name, o.Title),
+			Message:  o.Message,
+			ICAO24:   o.ICAO24,
+			Callsign: strings.TrimSpace(o.Callsign),
+			Details:  details,
+		})
+	}
+	alertMgr.ResolveMissing(p.kind, data.Region, seen)
+
+	p.mu.Lock()
+	p.observations[data.Region] = pluginResult{at: time.Now(), observations: kept}
+	p.mu.Unlock()
+}
+
+func (p *AnalyzerPlugin) record(start time.Time, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.status.Calls++
+	p.status.LastCall = &start
+	p.status.LastMs = float64(time.Since(start).Microseconds()) / 1000
+	p.status.LastError = ""
+	if err != nil {
+		p.status.Errors++
+		p.status.LastError = err.Error()
+	}
+}
+
+// Status returns the plugin's health and current observations.
+func (p *AnalyzerPlugin) Status() PluginStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := p.status
+	s.Observations = make(map[string][]PluginObservation)
+	for region, res := range p.observations {
+		s.Observations[region] = append([]PluginObservation{}, res.observations...)
+	}
+	return s
+}
+
+// PromptNote lists the plugins' recent observations for a region so
+// SENTINEL can weigh them.
+func (s pluginSet) PromptNote(region string) string {
+	var lines []string
+	for _, p := range s {
+		p.mu.Lock()
+		res, ok := p.observations[region]
+		p.mu.Unlock()
+		if !ok || time.Since(res.at) > pluginNoteMaxAge {
+			continue
+		}
+		for _, o := range res.observations {
+			line := fmt.Sprintf("- [%s] %s: %s", p.Name, o.Severity, o.Title)
+			if o.Message != "" {
+				line += " — " + o.Message
+			}
+			if subject := strings.TrimSpace(o.Callsign + " " + o.ICAO24); subject != "" {
+				line += " (" + subject + ")"
+			}
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	sort.SliceStable(lines, func(i, j int) bool { return lines[i] < lines[j] })
+	if len(lines) > 30 {
+		lines = append(lines[:30], fmt.Sprintf("- … and %d more", len(lines)-30))
+	}
+	return "\n\nExternal detectors report the following. They are automated and may be wrong; corroborate them against the track data:\n" + strings.Join(lines, "\n")
+}
+
+// execTransport keeps one subprocess running and exchanges one JSON line
+// each way per call. A call that fails, times out, or gets a line that
+// isn't a response kills the process so its next reply can't be mistaken
+// for a later request's; it is restarted on the next call.
+type execTransport struct {
+	plugin string
+	argv   []string
+
+	mu    sync.Mutex
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	lines chan []byte
+	done  chan struct{} // closed when the process is stopped
+}
+
+func (t *execTransport) start() error {
+	cmd := exec.Command(t.argv[0], t.argv[1:]...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("start %s: %w", t.argv[0], err)
+	}
+	lines, done := make(chan []byte), make(chan struct{})
+	go func() {
+		defer close(lines)
+		sc := bufio.NewScanner(stdout)
+		sc.Buffer(make([]byte, 64*1024), maxPluginResponse)
+		for sc.Scan() {
+			select {
+			case lines <- append([]byte(nil), sc.Bytes()...):
+			case <-done:
+				return
+			}
+		}
+	}()
+	go func() {
+		sc := bufio.NewScanner(stderr)
+		for sc.Scan() {
+			analyzerLog.Info("Analyzer plugin stderr", "plugin", t.plugin, "line", sc.Text())
+		}
+	}()
+	analyzerLog.Info("Analyzer plugin started", "plugin", t.plugin, "pid", cmd.Process.Pid)
+	t.cmd, t.stdin, t.lines, t.done = cmd, stdin, lines, done
+	return nil
+}
+
+func (t *execTransport) Call(ctx context.Context, req []byte, resp *PluginResponse) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.cmd == nil {
+		if err := t.start(); err != nil {
+			return err
+		}
+	}
+	if _, err := t.stdin.Write(append(req, '\n')); err != nil {
+		t.stopLocked()
+		return fmt.Errorf("write request: %w", err)
+	}
+	select {
+	case line, ok := <-t.lines:
+		if !ok {
+			t.stopLocked()
+			return errors.New("plugin exited")
+		}
+		if err := json.Unmarshal(line, resp); err != nil {
+			// A stray line, such as a debug print, leaves the real reply
+			// still to come.
+			t.stopLocked()
+			return fmt.Errorf("invalid response: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+		t.stopLocked()
+		return fmt.Errorf("no reply: %w", ctx.Err())
+	}
+}
+
+func (t *execTransport) stopLocked() {
+	if t.cmd == nil {
+		return
+	}
+	close(t.done)
+	t.stdin.Close()
+	t.cmd.Process.Kill()
+	t.cmd.Wait()
+	t.cmd = nil
+}
+
+func (t *execTransport) Close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stopLocked()
+}
+
+// httpTransport POSTs each request to a sidecar.
+type httpTransport struct {
+	url    string
+	client *http.Client
+}
+
+func (t *httpTransport) Call(ctx context.Context, req []byte, resp *PluginResponse) error {
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(req))
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", "application/json")
+	res, err := t.client.Do(r)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d", res.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxPluginResponse))
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, resp); err != nil {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+	return nil
+}
+
+func (t *httpTransport) Close() {}
+
+// handlePlugins reports each analyzer plugin's health and observations.
+// GET /api/plugins
+func handlePlugins(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	caller := principalFrom(r)
+	statuses := make([]PluginStatus, 0, len(analyzerPlugins))
+	for _, p := range analyzerPlugins {
+		status := p.Status()
+		for region := range status.Observations {
+			if !workspaceAllows(caller, region) {
+				delete(status.Observations, region)
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(statuses)
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// minRuntimeInterval is the shortest interval the admin API accepts.
+const minRuntimeInterval = time.Second
+
+// PollControl holds runtime overrides for the aircraft pollers and the
+// analyzers, set through /api/admin/pollers and /api/admin/analysis. They
+// apply to this replica only and last until restart; config reloads don't
+// clear them.
+type PollControl struct {
+	mu               sync.Mutex
+	regions          map[string]*regionControl
+	analysisPaused   bool
+	analysisInterval time.Duration // 0: ANALYSIS_INTERVAL
+}
+
+type regionControl struct {
+	paused   bool
+	interval time.Duration // 0: POLL_INTERVAL
+	wake     chan struct{} // a pending forced fetch
+}
+
+var pollControl = &PollControl{regions: make(map[string]*regionControl)}
+
+func (c *PollControl) region(name string) *regionControl {
+	rc := c.regions[name]
+	if rc == nil {
+		rc = &regionControl{wake: make(chan struct{}, 1)}
+		c.regions[name] = rc
+	}
+	return rc
+}
+
+// Interval is the region's poll interval: the override, or POLL_INTERVAL.
+func (c *PollControl) Interval(region string) time.Duration {
+	c.mu.Lock()
+	d := c.region(region).interval
+	c.mu.Unlock()
+	if d == 0 {
+		d = pollInterval.Get()
+	}
+	return d
+}
+
+// Paused reports whether polling is paused for the region.
+func (c *PollControl) Paused(region string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.region(region).paused
+}
+
+// Wake receives when an admin asks for an immediate fetch. Pollers select
+// on it alongside their timer.
+func (c *PollControl) Wake(region string) <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.region(region).wake
+}
+
+// FetchNow wakes the region's poller. Requests made while one is pending
+// are merged into it.
+func (c *PollControl) FetchNow(region string) {
+	c.mu.Lock()
+	wake := c.region(region).wake
+	c.mu.Unlock()
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
+
+// AnalysisPaused reports whether AI analysis is paused on this replica.
+func (c *PollControl) AnalysisPaused() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.analysisPaused
+}
+
+// AnalysisInterval is the override, or ANALYSIS_INTERVAL.
+func (c *PollControl) AnalysisInterval() time.Duration {
+	c.mu.Lock()
+	d := c.analysisInterval
+	c.mu.Unlock()
+	if d == 0 {
+		d = analysisInterval.Get()
+	}
+	return d
+}
+
+// PollerState is one region's entry in GET /api/admin/pollers.
+type PollerState struct {
+	Paused           bool            `json:"paused"`
+	IntervalSeconds  float64         `json:"intervalSeconds"`
+	IntervalOverride bool            `json:"intervalOverride"`
+	Upstream         *UpstreamStatus `json:"upstream,omitempty"`
+}
+
+// AnalyzerState is the analysis entry in GET /api/admin/pollers.
+type AnalyzerState struct {
+	Paused           bool    `json:"paused"`
+	IntervalSeconds  float64 `json:"intervalSeconds"`
+	IntervalOverride bool    `json:"intervalOverride"`
+}
+
+func (c *PollControl) state() map[string]interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pollers := make(map[string]PollerState, len(regions))
+	for name := range regions {
+		rc := c.region(name)
+		d := rc.interval
+		if d == 0 {
+			d = pollInterval.Get()
+		}
+		pollers[name] = PollerState{
+			Paused:           rc.paused,
+			IntervalSeconds:  d.Seconds(),
+			IntervalOverride: rc.interval != 0,
+			Upstream:         upstream.Status(name),
+		}
+	}
+	d := c.analysisInterval
+	if d == 0 {
+		d = analysisInterval.Get()
+	}
+	return map[string]interface{}{
+		"regions":  pollers,
+		"analysis": AnalyzerState{Paused: c.analysisPaused, IntervalSeconds: d.Seconds(), IntervalOverride: c.analysisInterval != 0},
+	}
+}
+
+// intervalRequest is the body of PUT .../interval. An empty interval
+// returns to the configured one.
+type intervalRequest struct {
+	Interval string `json:"interval"`
+}
+
+func decodeInterval(r *http.Request) (time.Duration, error) {
+	var req intervalRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return 0, fmt.Errorf("Invalid JSON: %v", err)
+	}
+	if req.Interval == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(req.Interval)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid interval %q", req.Interval)
+	}
+	if d < minRuntimeInterval {
+		return 0, fmt.Errorf("Interval must be at least %s", minRuntimeInterval)
+	}
+	return d, nil
+}
+
+// handlePollers serves the poller admin API:
+//
+//	GET  /api/admin/pollers                   — every region's poller and the analyzers
+//	POST /api/admin/pollers/{region}/pause    — stop fetching (clients keep the last picture)
+//	POST /api/admin/pollers/{region}/resume
+//	POST /api/admin/pollers/{region}/fetch    — fetch now, even while paused
+//	PUT  /api/admin/pollers/{region}/interval — {"interval":"30s"}; "" for POLL_INTERVAL
+func handlePollers(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/admin/pollers"), "/")
+	if rest == "" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(pollControl.state())
+		return
+	}
+	region, action, _ := strings.Cut(rest, "/")
+	if _, ok := regions[region]; !ok {
+		http.Error(w, "Unknown region", http.StatusNotFound)
+		return
+	}
+	method := http.MethodPost
+	if action == "interval" {
+		method = http.MethodPut
+	}
+	if r.Method != method {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	details := map[string]interface{}{"region": region}
+	switch action {
+	case "pause", "resume":
+		pollControl.mu.Lock()
+		pollControl.region(region).paused = action == "pause"
+		pollControl.mu.Unlock()
+	case "fetch":
+		pollControl.FetchNow(region)
+	case "interval":
+		d, err := decodeInterval(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		pollControl.mu.Lock()
+		rc := pollControl.region(region)
+		rc.interval = d
+		paused := rc.paused
+		pollControl.mu.Unlock()
+		if !paused {
+			pollControl.FetchNow(region) // start the new interval now
+		}
+		details["interval"] = d.String()
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	auditLog.Record(r, "poller."+action, details)
+	requestLog(fetcherLog, r).Info("Poller changed", "region", region, "action", action, "interval", pollControl.Interval(region).String())
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pollControl.state())
+}
+
+// handleAnalysisControl serves the analyzer admin API. While paused, no
+// scheduled or on-demand analysis calls the Anthropic API; the last
+// analysis stays in place.
+//
+//	POST /api/admin/analysis/pause
+//	POST /api/admin/analysis/resume
+//	PUT  /api/admin/analysis/interval — {"interval":"2m"}; "" for ANALYSIS_INTERVAL
+func handleAnalysisControl(w http.ResponseWriter, r *http.Request) {
+	action := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/admin/analysis"), "/")
+	method := http.MethodPost
+	if action == "interval" {
+		method = http.MethodPut
+	}
+	if action != "pause" && action != "resume" && action != "interval" {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if r.Method != method {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	details := map[string]interface{}{}
+	if action == "interval" {
+		d, err := decodeInterval(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		pollControl.mu.Lock()
+		pollControl.analysisInterval = d
+		pollControl.mu.Unlock()
+		details["interval"] = d.String()
+	} else {
+		pollControl.mu.Lock()
+		pollControl.analysisPaused = action == "pause"
+		pollControl.mu.Unlock()
+	}
+	auditLog.Record(r, "analysis."+action, details)
+	requestLog(analyzerLog, r).Info("Analyzer changed", "action", action, "interval", pollControl.AnalysisInterval().String())
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pollControl.state())
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// positionFileLayout names hourly history files; it sorts chronologically.
+const positionFileLayout = "2006-01-02T15"
+
+// PositionRecord is one aircraft position as stored and exported: the
+// /api/aircraft fields plus when and where it was observed.
+type PositionRecord struct {
+	Time   int64  `json:"time"`
+	Region string `json:"region"`
+	Aircraft
+}
+
+// PositionHistory samples the air picture into hourly JSON Lines files
+// (dir/2006-01-02T15.jsonl, UTC) and prunes files past the retention window.
+type PositionHistory struct {
+	mu        sync.Mutex
+	dir       string
+	interval  time.Duration
+	retention time.Duration
+	lastWrite map[string]time.Time
+	hour      string
+	file      *os.File
+	w         *bufio.Writer
+}
+
+var positionHistory *PositionHistory
+
+// newPositionHistoryFromEnv opens dataDir/positions. Returns nil when
+// POSITION_HISTORY_INTERVAL is 0.
+//
+//	POSITION_HISTORY_INTERVAL — how often each region is sampled (default 10s, 0 disables)
+//	POSITION_RETENTION        — how long hourly files are kept (default 168h)
+func newPositionHistoryFromEnv(dataDir string) (*PositionHistory, error) {
+	h := &PositionHistory{
+		dir:       filepath.Join(dataDir, "positions"),
+		interval:  10 * time.Second,
+		retention: 7 * 24 * time.Hour,
+		lastWrite: make(map[string]time.Time),
+	}
+	if v := os.Getenv("POSITION_HISTORY_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("POSITION_HISTORY_INTERVAL: invalid duration %q", v)
+		}
+		if d == 0 {
+			return nil, nil
+		}
+		h.interval = d
+	}
+	if v := os.Getenv("POSITION_RETENTION"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < time.Hour {
+			return nil, fmt.Errorf("POSITION_RETENTION: must be a duration of at least 1h, got %q", v)
+		}
+		h.retention = d
+	}
+	if err := os.MkdirAll(h.dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create position history dir: %w", err)
+	}
+	h.prune(time.Now())
+	return h, nil
+}
+
+// Record appends positioned aircraft for a region if the region's sampling
+// interval has elapsed. Safe to call on a nil history.
+func (h *PositionHistory) Record(region string, aircraft []Aircraft) {
+	if h == nil {
+		return
+	}
+	now := time.Now().UTC()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if now.Sub(h.lastWrite[region]) < h.interval {
+		return
+	}
+	h.lastWrite[region] = now
+
+	if err := h.rotateLocked(now); err != nil {
+		historyLog.Error("Position history", "err", err)
+		return
+	}
+	enc := json.NewEncoder(h.w)
+	for _, ac := range aircraft {
+		if ac.Latitude == nil || ac.Longitude == nil {
+			continue
+		}
+		enc.Encode(PositionRecord{Time: now.Unix(), Region: region, Aircraft: ac})
+	}
+	// Flush per sample so streaming readers see complete lines promptly.
+	if err := h.w.Flush(); err != nil {
+		historyLog.Error("Position history write failed", "err", err)
+	}
+}
+
+// Close flushes and closes the current hourly file. Safe to call on a nil
+// history.
+func (h *PositionHistory) Close() error {
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.file == nil {
+		return nil
+	}
+	h.w.Flush()
+	err := h.file.Close()
+	h.file = nil
+	return err
+}
+
+// rotateLocked switches to the file for now's hour, pruning on each switch.
+func (h *PositionHistory) rotateLocked(now time.Time) error {
+	hour := now.Format(positionFileLayout)
+	if hour == h.hour && h.file != nil {
+		return nil
+	}
+	if h.file != nil {
+		h.w.Flush()
+		h.file.Close()
+		h.file = nil
+	}
+	f, err := os.OpenFile(filepath.Join(h.dir, hour+".jsonl"), os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", hour, err)
+	}
+	h.hour, h.file, h.w = hour, f, bufio.NewWriterSize(f, 64*1024)
+	go h.prune(now)
+	return nil
+}
+
+// prune deletes hourly files that end before the retention window.
+func (h *PositionHistory) prune(now time.Time) {
+	cutoff := now.Add(-h.retention)
+	for _, f := range h.files() {
+		if f.hour.Add(time.Hour).Before(cutoff) {
+			if err := os.Remove(f.path); err != nil {
+				historyLog.Warn("Position history prune failed", "err", err)
+			}
+		}
+	}
+}
+
+type positionFile struct {
+	path string
+	hour time.Time
+}
+
+// files lists the hourly files, oldest first.
+func (h *PositionHistory) files() []positionFile {
+	return positionFiles(h.dir)
+}
+
+// positionFiles lists the hourly files in dir, oldest first.
+func positionFiles(dir string) []positionFile {
+	entries, _ := os.ReadDir(dir)
+	var files []positionFile
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasSuffix(name, ".jsonl") {
+			continue
+		}
+		hour, err := time.Parse(positionFileLayout, strings.TrimSuffix(name, ".jsonl"))
+		if err != nil {
+			continue
+		}
+		files = append(files, positionFile{path: filepath.Join(dir, name), hour: hour})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].hour.Before(files[j].hour) })
+	return files
+}
+
+// handleExportStream streams stored positions as newline-delimited JSON.
+// Nothing is buffered beyond a line at a time, and the response is chunked,
+// so extractions of any size are bounded in memory on both ends.
+// GET /api/export/stream[?region=&from=&to=]
+func handleExportStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if positionHistory == nil {
+		http.Error(w, "Position history is disabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	q := r.URL.Query()
+	region := q.Get("region")
+	from, err := parseTimeParam(q.Get("from"))
+	if err != nil {
+		http.Error(w, "invalid from: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	to, err := parseTimeParam(q.Get("to"))
+	if err != nil {
+		http.Error(w, "invalid to: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if to.Before(from) {
+		http.Error(w, "to is before from", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	name := region
+	if name == "" {
+		name = "all"
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "positions-"+name+".jsonl"))
+	flusher, _ := w.(http.Flusher)
+
+	const flushEvery = 1000
+	newline := []byte{'\n'}
+	pending := 0
+	scanPositions(positionHistory.dir, region, from, to, func(line []byte) error {
+		if _, err := w.Write(line); err != nil {
+			return err // client went away
+		}
+		w.Write(newline)
+		if pending++; pending >= flushEvery && flusher != nil {
+			flusher.Flush()
+			pending = 0
+		}
+		return r.Context().Err()
+	})
+	if flusher != nil {
+		flusher.Flush()
+	}
+}
+
+// scanPositions calls fn with each stored position line between from and
+// to, for one region or all of them, oldest first, reading a line at a
+// time. It stops at fn's first error and returns it.
+func scanPositions(dir, region string, from, to time.Time, fn func(line []byte) error) error {
+	fromUnix, toUnix := from.Unix(), to.Unix()
+	for _, f := range positionFiles(dir) {
+		if f.hour.Add(time.Hour).Before(from) || f.hour.After(to) {
+			continue
+		}
+		file, err := os.Open(f.path)
+		if err != nil {
+			continue // pruned since listing
+		}
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			line := scanner.Bytes()
+			var head struct {
+				Time   int64  `json:"time"`
+				Region string `json:"region"`
+			}
+			if json.Unmarshal(line, &head) != nil {
+				continue
+			}
+			if head.Time < fromUnix || head.Time > toUnix || (region != "" && head.Region != region) {
+				continue
+			}
+			if err := fn(line); err != nil {
+				file.Close()
+				return err
+			}
+		}
+		file.Close()
+	}
+	return nil
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// qualityHistory is how many recent position times a track's regularity
+	// is judged on.
+	qualityHistory = 8
+	// qualityForget drops a track's history once it hasn't been seen for
+	// this long.
+	qualityForget = 10 * time.Minute
+	// qualityFreshAge is the position age that still counts as current;
+	// confidence in the position falls to nothing by qualityStaleAge.
+	qualityFreshAge = 5.0
+	qualityStaleAge = 60.0
+	// qualityExpectedInterval is the update interval of a healthy ADS-B
+	// track as polled; slower tracks lose confidence in proportion.
+	qualityExpectedInterval = 10.0
+	// qualityExtrapolatedCap bounds the score of a dead-reckoned position,
+	// however recent its last report.
+	qualityExtrapolatedCap = 0.4
+)
+
+// positionMethods are the OpenSky position sources and how far a position
+// from each can be trusted relative to ADS-B.
+var positionMethods = []struct {
+	name   string
+	weight float64
+}{
+	{"adsb", 1.0},
+	{"asterix", 0.9},
+	{"mlat", 0.75},
+	{"flarm", 0.7},
+}
+
+// TrackConfidence is how far a track's position can be trusted. Operators
+// and SENTINEL use it to weight stale or inferred positions.
+type TrackConfidence struct {
+	Score          float64 `json:"score"`                    // 0–1
+	Level          string  `json:"level"`                    // high, medium, or low
+	Source         string  `json:"source"`                   // feed: opensky, simulator, replay, scenario, or manual
+	Method         string  `json:"method"`                   // adsb, asterix, mlat, flarm, or manual
+	PositionAge    float64 `json:"positionAge"`              // seconds since the position was measured; -1 if unknown
+	UpdateInterval float64 `json:"updateInterval,omitempty"` // mean seconds between position updates
+	Regularity     float64 `json:"regularity"`               // 0–1, 1 for evenly spaced updates; 0.5 until known
+	Extrapolated   bool    `json:"extrapolated"`             // dead-reckoned rather than measured
+}
+
+type trackHistory struct {
+	times []int64 // distinct position times, oldest first
+	seen  time.Time
+}
+
+// TrackQuality scores every track as it is ingested from the history of its
+// position updates.
+type TrackQuality struct {
+	mu     sync.Mutex
+	tracks map[string]*trackHistory // region + "/" + icao24
+}
+
+var trackQuality = &TrackQuality{tracks: make(map[string]*trackHistory)}
+
+// feedSource names where a region's measured positions come from.
+func feedSource(region string) string {
+	modeState.Lock()
+	replaying := modeState.replay
+	modeState.Unlock()
+	if replaying {
+		return "replay"
+	}
+	if st := upstream.Status(region); st != nil && st.Source != "" {
+		return st.Source
+	}
+	return "unknown"
+}
+
+// Score sets each aircraft's confidence in a new picture of a region.
+func (q *TrackQuality) Score(data *AirspaceData) {
+	now := time.Now()
+	feed := feedSource(data.Region)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for key, h := range q.tracks {
+		if now.Sub(h.seen) > qualityForget {
+			delete(q.tracks, key)
+		}
+	}
+	for i := range data.Aircraft {
+		ac := &data.Aircraft[i]
+		key := data.Region + "/" + ac.ICAO24
+		h := q.tracks[key]
+		if h == nil {
+			h = &trackHistory{}
+			q.tracks[key] = h
+		}
+		h.seen = now
+		if ac.TimePosition != nil && (len(h.times) == 0 || *ac.TimePosition > h.times[len(h.times)-1]) {
+			h.times = append(h.times, *ac.TimePosition)
+			if len(h.times) > qualityHistory {
+				h.times = h.times[1:]
+			}
+		}
+		ac.Confidence = scoreTrack(*ac, h.times, data.Timestamp, feed)
+	}
+}
+
+// scoreTrack weighs position age (45%), measurement method (30%), and
+// update regularity (25%).
+func scoreTrack(ac Aircraft, times []int64, now int64, feed string) *TrackConfidence {
+	c := &TrackConfidence{Source: feed, Regularity: 0.5}
+	methodWeight := 1.0
+	switch {
+	case ac.Source == sourceManual:
+		c.Source, c.Method, c.Extrapolated, methodWeight = "manual", "manual", true, 0.4
+	case ac.PositionSource >= 0 && ac.PositionSource < len(positionMethods):
+		m := positionMethods[ac.PositionSource]
+		c.Method, methodWeight = m.name, m.weight
+	default:
+		c.Method, methodWeight = "unknown", 0.5
+	}
+	if ac.Simulated {
+		c.Source = "scenario"
+	}
+
+	ageWeight := 0.0
+	if ac.TimePosition != nil {
+		c.PositionAge = math.Max(0, float64(now-*ac.TimePosition))
+		ageWeight = math.Max(0, math.Min(1, 1-(c.PositionAge-qualityFreshAge)/(qualityStaleAge-qualityFreshAge)))
+	} else {
+		c.PositionAge = -1
+	}
+
+	regularityWeight := 0.5
+	if len(times) >= 3 {
+		intervals := make([]float64, 0, len(times)-1)
+		mean := 0.0
+		for i := 1; i < len(times); i++ {
+			d := float64(times[i] - times[i-1])
+			intervals = append(intervals, d)
+			mean += d
+		}
+		mean /= float64(len(intervals))
+		variance := 0.0
+		for _, d := range intervals {
+			variance += (d - mean) * (d - mean)
+		}
+		cv := math.Sqrt(variance/float64(len(intervals))) / mean
+		c.UpdateInterval = math.Round(mean*10) / 10
+		c.Regularity = math.Round(100/(1+cv)) / 100
+		regularityWeight = c.Regularity * math.Min(1, qualityExpectedInterval/mean)
+	}
+
+	score := 0.45*ageWeight + 0.3*methodWeight + 0.25*regularityWeight
+	if c.Extrapolated {
+		score = math.Min(score, qualityExtrapolatedCap)
+	}
+	c.Score = math.Round(score*100) / 100
+	c.Level = confidenceLevel(c.Score)
+	return c
+}
+
+func confidenceLevel(score float64) string {
+	switch {
+	case score >= 0.75:
+		return "high"
+	case score >= 0.5:
+		return "medium"
+	}
+	return "low"
+}
+
+// qualityPromptNote tells SENTINEL how far to trust the positions it is
+// given.
+func qualityPromptNote(aircraft []Aircraft) string {
+	var low, medium, extrapolated int
+	for _, ac := range aircraft {
+		if ac.Confidence == nil {
+			continue
+		}
+		switch ac.Confidence.Level {
+		case "low":
+			low++
+		case "medium":
+			medium++
+		}
+		if ac.Confidence.Extrapolated {
+			extrapolated++
+		}
+	}
+	if low+medium == 0 {
+		return ""
+	}
+	return fmt.Sprintf("\n\nPosition confidence: each aircraft's confidence field scores how far its position can be trusted (0–1) from position age, update regularity, and measurement method. "+
+		"%d positions are low and %d medium confidence; %d are dead-reckoned rather than measured. Treat low-confidence positions as approximate, and don't rest a threat call on one alone.",
+		low, medium, extrapolated)
+}
+
+// SourceQuality summarises the tracks from one source in a region.
+type SourceQuality struct {
+	Source       string           `json:"source"`
+	Tracks       int              `json:"tracks"`
+	Score        float64          `json:"score"` // mean track score
+	Levels       map[string]int   `json:"levels"`
+	Methods      map[string]int   `json:"methods"`
+	Extrapolated int              `json:"extrapolated"`
+	PositionAge  AgeSummary       `json:"positionAgeSeconds"`
+	Upstream     *UpstreamStatus  `json:"upstream,omitempty"` // the feed's request health, for polled sources
+	Lowest       []TrackQualityID `json:"lowest"`             // up to 10 least trusted tracks
+}
+
+// AgeSummary is the spread of position ages, in seconds.
+type AgeSummary struct {
+	P50 float64 `json:"p50"`
+	P95 float64 `json:"p95"`
+	Max float64 `json:"max"`
+}
+
+// TrackQualityID is one track's confidence in a quality report.
+type TrackQualityID struct {
+	ICAO24     string          `json:"icao24"`
+	Callsign   string          `json:"callsign,omitempty"`
+	Confidence TrackConfidence `json:"confidence"`
+}
+
+// summarizeQuality groups a picture's tracks by source.
+func summarizeQuality(region string, aircraft []Aircraft) []SourceQuality {
+	bySource := make(map[string][]Aircraft)
+	for _, ac := range aircraft {
+		if ac.Confidence != nil {
+			bySource[ac.Confidence.Source] = append(bySource[ac.Confidence.Source], ac)
+		}
+	}
+	out := make([]SourceQuality, 0, len(bySource))
+	for source, list := range bySource {
+		sq := SourceQuality{
+			Source:  source,
+			Tracks:  len(list),
+			Levels:  map[string]int{"high": 0, "medium": 0, "low": 0},
+			Methods: make(map[string]int),
+			Lowest:  []TrackQualityID{},
+		}
+		var ages []float64
+		total := 0.0
+		for _, ac := range list {
+			c := ac.Confidence
+			total += c.Score
+			sq.Levels[c.Level]++
+			sq.Methods[c.Method]++
+			if c.Extrapolated {
+				sq.Extrapolated++
+			}
+			if c.PositionAge >= 0 {
+				ages = append(ages, c.PositionAge)
+			}
+		}
+		sq.Score = math.Round(total/float64(len(list))*100) / 100
+		if len(ages) > 0 {
+			sort.Float64s(ages)
+			sq.PositionAge = AgeSummary{P50: ages[len(ages)/2], P95: ages[len(ages)*95/100], Max: ages[len(ages)-1]}
+		}
+		if st := upstream.Status(region); st != nil && st.Source == source {
+			sq.Upstream = st
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].Confidence.Score < list[j].Confidence.Score })
+		for _, ac := range list[:min(10, len(list))] {
+			sq.Lowest = append(sq.Lowest, TrackQualityID{ICAO24: ac.ICAO24, Callsign: strings.TrimSpace(ac.Callsign), Confidence: *ac.Confidence})
+		}
+		out = append(out, sq)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Source < out[j].Source })
+	return out
+}
+
+// handleQuality reports data quality per source for a region.
+// GET /api/quality?region=
+func handleQuality(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	region := r.URL.Query().Get("region")
+	if region == "" {
+		region = "socal"
+	}
+	if _, ok := regions[region]; !ok {
+		http.Error(w, fmt.Sprintf("unknown region %q", region), http.StatusBadRequest)
+		return
+	}
+	data := currentAirspace(region)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"region":    region,
+		"timestamp": data.Timestamp,
+		"sources":   summarizeQuality(region, data.Aircraft),
+	})
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a set of token buckets, one per client. Each bucket holds up
+// to limit tokens and refills at limit per period, so a client can burst the
+// whole allowance and then continues at the average rate.
+type RateLimiter struct {
+	limit  float64
+	period time.Duration
+	now    func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	at     time.Time
+}
+
+func newRateLimiter(limit int, period time.Duration) *RateLimiter {
+	return &RateLimiter{limit: float64(limit), period: period, now: time.Now, buckets: make(map[string]*tokenBucket)}
+}
+
+// Allow takes a token from key's bucket. When it is empty it returns false and
+// how long until the next token.
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.limit, at: now}
+		l.buckets[key] = b
+	}
+	perToken := l.period / time.Duration(l.limit)
+	b.tokens = math.Min(l.limit, b.tokens+float64(now.Sub(b.at))/float64(perToken))
+	b.at = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) * float64(perToken))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep forgets clients whose buckets have refilled, at most once a period.
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.period {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if now.Sub(b.at) >= l.period {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+var (
+	// apiLimiter applies to every /api and /data request; routeLimiters add a
+	// tighter allowance on endpoints that cost money or invite guessing.
+	// tileLimiter has /tiles to itself, as a map view loads dozens of tiles
+	// at once and each miss spends the tile provider's quota.
+	apiLimiter    *RateLimiter
+	routeLimiters = map[string]*RateLimiter{}
+	tileLimiter   *RateLimiter
+)
+
+// loadRateLimitsFromEnv reads "N/period" limits per client, or "off":
+//
+//	RATE_LIMIT          — all /api and /data requests (default 600/1m)
+//	ANALYZE_RATE_LIMIT  — POST /api/analyze, which calls Anthropic (default 20/1h)
+//	LOGIN_RATE_LIMIT    — POST /api/login and /api/token/refresh (default 10/1m)
+//	TILE_RATE_LIMIT     — /tiles requests (default 1200/1m)
+func loadRateLimitsFromEnv() error {
+	var err error
+	if apiLimiter, err = rateLimitFromEnv("RATE_LIMIT", "600/1m"); err != nil {
+		return err
+	}
+	if tileLimiter, err = rateLimitFromEnv("TILE_RATE_LIMIT", "1200/1m"); err != nil {
+		return err
+	}
+	analyze, err := rateLimitFromEnv("ANALYZE_RATE_LIMIT", "20/1h")
+	if err != nil {
+		return err
+	}
+	login, err := rateLimitFromEnv("LOGIN_RATE_LIMIT", "10/1m")
+	if err != nil {
+		return err
+	}
+	routeLimiters = map[string]*RateLimiter{}
+	if analyze != nil {
+		routeLimiters["/api/analyze"] = analyze
+	}
+	if login != nil {
+		routeLimiters["/api/login"] = login
+		routeLimiters["/api/token/refresh"] = login
+	}
+	return nil
+}
+
+func rateLimitFromEnv(name, def string) (*RateLimiter, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		v = def
+	}
+	if v == "off" || v == "0" {
+		return nil, nil
+	}
+	n, per, ok := strings.Cut(v, "/")
+	limit, err := strconv.Atoi(n)
+	if !ok || err != nil || limit <= 0 {
+		return nil, fmt.Errorf("%s: %q is not \"N/period\", e.g. 600/1m", name, v)
+	}
+	period, err := time.ParseDuration(per)
+	if err != nil || period <= 0 {
+		return nil, fmt.Errorf("%s: invalid period %q", name, per)
+	}
+	if period < time.Duration(limit) {
+		// Buckets refill one token per period/limit, which must be at least 1ns.
+		return nil, fmt.Errorf("%s: %d requests per %s is too many", name, limit, period)
+	}
+	return newRateLimiter(limit, period), nil
+}
+
+// rateLimit answers 429 with Retry-After once a client exceeds its
+// allowance. Clients are identified by API key or user when the request
+// carries valid credentials and by IP address otherwise, so one noisy
+// integration can't starve everyone behind the same proxy. WebSockets are
+// long-lived and not limited.
+func rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limiters := make([]*RateLimiter, 0, 2)
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/tiles/"):
+			if tileLimiter != nil {
+				limiters = append(limiters, tileLimiter)
+			}
+		case strings.HasPrefix(r.URL.Path, "/api/"), strings.HasPrefix(r.URL.Path, "/data/"):
+			if l := routeLimiters[r.URL.Path]; l != nil && r.Method == http.MethodPost {
+				limiters = append(limiters, l)
+			}
+			if apiLimiter != nil {
+				limiters = append(limiters, apiLimiter)
+			}
+		}
+		if len(limiters) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := rateLimitKey(r)
+		for _, l := range limiters {
+			if ok, wait := l.Allow(key); !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				http.Error(w, "Too many requests", http.StatusTooManyRequests)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func rateLimitKey(r *http.Request) string {
+	if p := requestPrincipal(r); p != nil {
+		return p.Kind + ":" + p.Name
+	}
+	return "ip:" + clientIP(r)
+}
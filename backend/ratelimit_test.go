@@ -0,0 +1,111 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeClock is a RateLimiter clock the test moves by hand.
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestLimiter(limit int, period time.Duration) (*RateLimiter, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	l := newRateLimiter(limit, period)
+	l.now = clock.now
+	return l, clock
+}
+
+func TestRateLimiterTokenBucket(t *testing.T) {
+	l, clock := newTestLimiter(3, 3*time.Second)
+	allow := func(key string, want bool, wantRetry time.Duration) {
+		t.Helper()
+		ok, retry := l.Allow(key)
+		if ok != want || retry != wantRetry {
+			t.Errorf("Allow(%q) = %v, %v; want %v, %v", key, ok, retry, want, wantRetry)
+		}
+	}
+
+	// A new client may burst the whole allowance.
+	allow("a", true, 0)
+	allow("a", true, 0)
+	allow("a", true, 0)
+	allow("a", false, time.Second)
+
+	// Other clients have buckets of their own.
+	allow("b", true, 0)
+
+	// Tokens come back at limit per period.
+	clock.advance(400 * time.Millisecond)
+	allow("a", false, 600*time.Millisecond)
+	clock.advance(600 * time.Millisecond)
+	allow("a", true, 0)
+	allow("a", false, time.Second)
+
+	// A bucket never holds more than limit.
+	clock.advance(time.Hour)
+	allow("a", true, 0)
+	allow("a", true, 0)
+	allow("a", true, 0)
+	allow("a", false, time.Second)
+}
+
+func TestRateLimiterSweep(t *testing.T) {
+	l, clock := newTestLimiter(10, time.Minute)
+	l.Allow("idle")
+	clock.advance(30 * time.Second)
+	l.Allow("busy")
+	clock.advance(40 * time.Second)
+	l.Allow("busy")
+
+	// "idle" has refilled and is forgotten; "busy" is not yet full.
+	if _, ok := l.buckets["idle"]; ok {
+		t.Error("idle bucket was kept")
+	}
+	if _, ok := l.buckets["busy"]; !ok {
+		t.Error("busy bucket was dropped")
+	}
+}
+
+func TestRateLimitFromEnv(t *testing.T) {
+	tests := []struct {
+		value      string
+		wantOff    bool
+		wantErr    bool
+		wantLimit  float64
+		wantPeriod time.Duration
+	}{
+		{value: "", wantLimit: 600, wantPeriod: time.Minute}, // the default
+		{value: "off", wantOff: true},
+		{value: "0", wantOff: true},
+		{value: "20/1h", wantLimit: 20, wantPeriod: time.Hour},
+		{value: "1000000000/1s", wantLimit: 1e9, wantPeriod: time.Second},
+		{value: "1000000001/1s", wantErr: true}, // under 1ns per token
+		{value: "5/1ns", wantErr: true},
+		{value: "20", wantErr: true},
+		{value: "-1/1m", wantErr: true},
+		{value: "x/1m", wantErr: true},
+		{value: "20/0s", wantErr: true},
+		{value: "20/soon", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Setenv("TEST_RATE_LIMIT", tt.value)
+		l, err := rateLimitFromEnv("TEST_RATE_LIMIT", "600/1m")
+		switch {
+		case tt.wantErr:
+			if err == nil {
+				t.Errorf("%q: no error", tt.value)
+			}
+		case err != nil:
+			t.Errorf("%q: %v", tt.value, err)
+		case tt.wantOff:
+			if l != nil {
+				t.Errorf("%q: limiter is on", tt.value)
+			}
+		case l == nil || l.limit != tt.wantLimit || l.period != tt.wantPeriod:
+			t.Errorf("%q: limiter = %+v, want %g per %s", tt.value, l, tt.wantLimit, tt.wantPeriod)
+		}
+	}
+}
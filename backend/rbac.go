@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Roles, from least to most privileged. Each includes everything below it.
+//
+//	viewer  — read the air picture, analyses, alerts, and exports
+//	analyst — also trigger analyses (which cost money), manage the watchlist,
+//	          acknowledge alerts, deploy drone configurations, task drones,
+//	          and annotate tracks and the shared map
+//	admin   — also manage users and server configuration
+const (
+	RoleViewer  = "viewer"
+	RoleAnalyst = "analyst"
+	RoleAdmin   = "admin"
+)
+
+var roleRank = map[string]int{
+	RoleViewer:  1,
+	RoleAnalyst: 2,
+	RoleAdmin:   3,
+}
+
+func validRole(role string) bool {
+	return roleRank[role] > 0
+}
+
+// hasRole reports whether a principal's role meets the minimum.
+func (p *Principal) hasRole(min string) bool {
+	return p != nil && roleRank[p.Role] >= roleRank[min]
+}
+
+// adminPaths need the admin role for every method.
+var adminPaths = []string{
+	"/api/users",
+	"/api/admin",
+}
+
+// viewerWrites are non-GET endpoints any signed-in principal may call: they
+// either read (Grafana queries, config validation) or only affect the caller.
+var viewerWrites = map[string]bool{
+	"/api/grafana/search":   true,
+	"/api/grafana/metrics":  true,
+	"/api/grafana/query":    true,
+	"/api/drones/validate":  true,
+	"/api/push/subscribe":   true,
+	"/api/push/unsubscribe": true,
+}
+
+// viewerWritePrefixes are like viewerWrites for path families whose handlers
+// do their own ownership checks.
+var viewerWritePrefixes = []string{
+	"/api/sessions/",
+}
+
+// requiredRole maps a request to the minimum role allowed to make it. Reads
+// are open to viewers and writes need analyst unless listed otherwise, so a
+// new mutating endpoint is restricted by default.
+func requiredRole(r *http.Request) string {
+	for _, prefix := range adminPaths {
+		if r.URL.Path == prefix || strings.HasPrefix(r.URL.Path, prefix+"/") {
+			return RoleAdmin
+		}
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return RoleViewer
+	}
+	if viewerWrites[r.URL.Path] {
+		return RoleViewer
+	}
+	for _, prefix := range viewerWritePrefixes {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return RoleViewer
+		}
+	}
+	return RoleAnalyst
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// Session recording event kinds. Inbound events are what the server took
+// in; broadcast events are what it sent WebSocket clients.
+const (
+	recordSession   = "session"   // first line: when and what was recorded
+	recordAirspace  = "airspace"  // inbound aircraft picture, as ingested
+	recordAnalysis  = "analysis"  // inbound SENTINEL analysis, as applied
+	recordBroadcast = "broadcast" // outbound WebSocket message
+)
+
+// sessionEvent is one line of a session recording.
+type sessionEvent struct {
+	Time   time.Time       `json:"t"`
+	Kind   string          `json:"kind"`
+	Region string          `json:"region,omitempty"`
+	Data   json.RawMessage `json:"data"`
+}
+
+// SessionRecorder writes everything the server takes in and broadcasts to
+// a JSON Lines file, for reproducing bugs and offline demos. A nil recorder
+// records nothing.
+type SessionRecorder struct {
+	path    string
+	file    *os.File
+	queue   chan sessionEvent
+	events  int64
+	dropped atomic.Int64
+}
+
+var recorder *SessionRecorder
+
+// newSessionRecorderFromEnv returns nil when RECORD_DIR is unset.
+//
+//	RECORD_DIR — directory for session recordings, one session-<UTC start>.rec per run
+func newSessionRecorderFromEnv() (*SessionRecorder, error) {
+	dir := os.Getenv("RECORD_DIR")
+	if dir == "" {
+		return nil, nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("RECORD_DIR: %w", err)
+	}
+	now := time.Now().UTC()
+	path := filepath.Join(dir, "session-"+now.Format("20060102T150405Z")+".rec")
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	r := &SessionRecorder{path: path, file: f, queue: make(chan sessionEvent, 4096)}
+	names := make([]string, 0, len(regions))
+	for name := range regions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	r.record(recordSession, "", map[string]interface{}{"version": 1, "started": now, "regions": names})
+	return r, nil
+}
+
+// Airspace records an inbound picture.
+func (r *SessionRecorder) Airspace(data *AirspaceData) {
+	r.record(recordAirspace, data.Region, data)
+}
+
+// Analysis records an inbound analysis.
+func (r *SessionRecorder) Analysis(analysis *TacticalAnalysis) {
+	r.record(recordAnalysis, analysis.Region, analysis)
+}
+
+// Broadcast records a message sent to a region's WebSocket clients, or to
+// all of them when region is empty.
+func (r *SessionRecorder) Broadcast(region string, message interface{}) {
+	r.record(recordBroadcast, region, message)
+}
+
+// record snapshots v now, since callers go on changing what they passed,
+// and queues it without blocking; a full queue drops the event.
+func (r *SessionRecorder) record(kind, region string, v interface{}) {
+	if r == nil {
+		return
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	select {
+	case r.queue <- sessionEvent{Time: time.Now().UTC(), Kind: kind, Region: region, Data: raw}:
+	default:
+		r.dropped.Add(1)
+	}
+}
+
+// Run writes queued events, flushing every second, until shutdown.
+func (r *SessionRecorder) Run() {
+	w := bufio.NewWriterSize(r.file, 64*1024)
+	enc := json.NewEncoder(w)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	write := func(ev sessionEvent) {
+		if err := enc.Encode(ev); err != nil {
+			r.dropped.Add(1)
+			return
+		}
+		r.events++
+	}
+	for {
+		select {
+		case <-stopping:
+			for len(r.queue) > 0 {
+				write(<-r.queue)
+			}
+			w.Flush()
+			r.file.Close()
+			serverLog.Info("Session recording closed", "path", r.path, "events", r.events, "dropped", r.dropped.Load())
+			return
+		case ev := <-r.queue:
+			write(ev)
+		case <-ticker.C:
+			if err := w.Flush(); err != nil {
+				serverLog.Warn("Session recording write failed", "path", r.path, "err", err)
+			}
+		}
+	}
+}
+
+// SessionReplay re-serves a session recording's inbound events through the
+// live pipeline, so REST, WebSocket, alerts, and feeds behave as they did.
+// Broadcasts are regenerated by the pipeline rather than replayed, so they
+// can be compared with the recorded ones.
+type SessionReplay struct {
+	path   string
+	events []sessionEvent
+	speed  float64
+	loop   bool
+}
+
+// OpenSessionReplay reads a recording written with RECORD_DIR. Events for
+// regions this server doesn't know are skipped.
+func OpenSessionReplay(path string, speed float64, loop bool) (*SessionReplay, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := &SessionReplay{path: path, speed: speed, loop: loop}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var ev sessionEvent
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if ev.Kind != recordAirspace && ev.Kind != recordAnalysis {
+			continue
+		}
+		if _, ok := regions[ev.Region]; !ok {
+			continue
+		}
+		r.events = append(r.events, ev)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(r.events) == 0 {
+		return nil, fmt.Errorf("%s: no aircraft or analysis events for a known region", path)
+	}
+	sort.SliceStable(r.events, func(i, j int) bool { return r.events[i].Time.Before(r.events[j].Time) })
+	return r, nil
+}
+
+// ReplaysAnalysis is true: the recorded analyses are replayed instead of
+// calling Anthropic, so the replay matches the session.
+func (r *SessionReplay) ReplaysAnalysis() bool { return true }
+
+// Run plays the events at the recorded pace divided by speed until the end
+// (or forever with loop) or shutdown. Timestamps are shifted to the moment
+// each event is played.
+func (r *SessionReplay) Run() {
+	first, last := r.events[0].Time, r.events[len(r.events)-1].Time
+	fetcherLog.Info("Session replay started", "file", r.path, "events", len(r.events),
+		"recorded", first.Format(time.RFC3339), "duration", last.Sub(first).Round(time.Second), "speed", r.speed)
+	for {
+		start := time.Now()
+		for _, ev := range r.events {
+			due := start.Add(time.Duration(float64(ev.Time.Sub(first)) / r.speed))
+			select {
+			case <-stopping:
+				return
+			case <-time.After(time.Until(due)):
+			}
+			if err := r.play(ev, time.Now()); err != nil {
+				fetcherLog.Warn("Skipped replay event", "kind", ev.Kind, "region", ev.Region, "err", err)
+			}
+		}
+		if !r.loop {
+			fetcherLog.Info("Session replay finished", "file", r.path)
+			return
+		}
+	}
+}
+
+// play feeds one event into the pipeline as if it happened at now.
+func (r *SessionReplay) play(ev sessionEvent, now time.Time) error {
+	switch ev.Kind {
+	case recordAirspace:
+		var data AirspaceData
+		if err := json.Unmarshal(ev.Data, &data); err != nil {
+			return err
+		}
+		shifted := replayFrame{time: data.Timestamp, region: data.Region, aircraft: data.Aircraft}.shifted(now.Unix())
+		shifted.Scenario = data.Scenario
+		ingestAirspace(shifted)
+	case recordAnalysis:
+		var analysis TacticalAnalysis
+		if err := json.Unmarshal(ev.Data, &analysis); err != nil {
+			return err
+		}
+		analysis.Timestamp = now.UTC().Format(time.RFC3339)
+		applyAnalysis(analysis.Region, &analysis)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// Replay stands in for the live aircraft source.
+type Replay interface {
+	Run()
+	// ReplaysAnalysis is true when the recording's analyses replace the
+	// live analyzer.
+	ReplaysAnalysis() bool
+}
+
+// replayFrame is every recorded position in one region at one time.
+type replayFrame struct {
+	time     int64
+	region   string
+	aircraft []Aircraft
+}
+
+// PositionReplay feeds recorded position history through the live pipeline
+// in place of the simulator, so clients, alerts, and analysis see it as
+// current traffic.
+type PositionReplay struct {
+	path   string
+	frames []replayFrame
+	speed  float64
+	loop   bool
+}
+
+// OpenPositionReplay reads a JSON Lines position file (export's format) and
+// groups it into frames. Regions this server doesn't know are skipped.
+func OpenPositionReplay(path string, speed float64, loop bool) (*PositionReplay, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	type frameKey struct {
+		time   int64
+		region string
+	}
+	byKey := make(map[frameKey]*replayFrame)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var rec PositionRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if _, ok := regions[rec.Region]; !ok {
+			continue
+		}
+		k := frameKey{rec.Time, rec.Region}
+		if byKey[k] == nil {
+			byKey[k] = &replayFrame{time: rec.Time, region: rec.Region}
+		}
+		byKey[k].aircraft = append(byKey[k].aircraft, rec.Aircraft)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(byKey) == 0 {
+		return nil, fmt.Errorf("%s: no positions for a known region", path)
+	}
+
+	r := &PositionReplay{path: path, speed: speed, loop: loop}
+	for _, fr := range byKey {
+		r.frames = append(r.frames, *fr)
+	}
+	sort.Slice(r.frames, func(i, j int) bool {
+		if r.frames[i].time != r.frames[j].time {
+			return r.frames[i].time < r.frames[j].time
+		}
+		return r.frames[i].region < r.frames[j].region
+	})
+	return r, nil
+}
+
+// ReplaysAnalysis is false: position history has no analyses.
+func (r *PositionReplay) ReplaysAnalysis() bool { return false }
+
+// Run plays the frames at the recorded pace divided by speed until the end
+// (or forever with loop) or shutdown. Timestamps are shifted to the moment
+// each frame is played, so freshness and lost-contact checks behave as they
+// would live.
+func (r *PositionReplay) Run() {
+	first, last := r.frames[0].time, r.frames[len(r.frames)-1].time
+	fetcherLog.Info("Replay started", "file", r.path, "frames", len(r.frames),
+		"recorded", time.Unix(first, 0).UTC().Format(time.RFC3339), "duration", time.Duration(last-first)*time.Second, "speed", r.speed)
+	for {
+		start := time.Now()
+		for _, fr := range r.frames {
+			due := start.Add(time.Duration(float64(time.Duration(fr.time-first)*time.Second) / r.speed))
+			select {
+			case <-stopping:
+				return
+			case <-time.After(time.Until(due)):
+			}
+			ingestAirspace(fr.shifted(time.Now().Unix()))
+		}
+		if !r.loop {
+			fetcherLog.Info("Replay finished", "file", r.path)
+			return
+		}
+	}
+}
+
+// shifted returns the frame as live data observed at now.
+func (fr replayFrame) shifted(now int64) *AirspaceData {
+	delta := now - fr.time
+	aircraft := make([]Aircraft, len(fr.aircraft))
+	for i, ac := range fr.aircraft {
+		if ac.TimePosition != nil {
+			t := *ac.TimePosition + delta
+			ac.TimePosition = &t
+		}
+		ac.LastContact += delta
+		aircraft[i] = ac
+	}
+	return &AirspaceData{
+		Timestamp: now,
+		Aircraft:  aircraft,
+		Region:    fr.region,
+		Count:     len(aircraft),
+	}
+}
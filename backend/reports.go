@@ -0,0 +1,620 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"swarm-c2/pdf"
+)
+
+// sortieGap is how long an aircraft must be absent from a region's picture
+// before its next appearance counts as a new sortie.
+const sortieGap = 30 * time.Minute
+
+// Reports compiles a periodic report per region at fixed times of day: the
+// period's analyses, alerts, sortie counts, and notable tracks. Reports are
+// stored in the data directory and optionally emailed.
+type Reports struct {
+	dir     string
+	times   []int // minutes after midnight UTC, ascending
+	period  time.Duration
+	formats []string
+	emailTo []string
+}
+
+var reports *Reports
+
+// newReportsFromEnv returns nil when REPORT_TIMES is unset.
+//
+//	REPORT_TIMES    — comma-separated UTC times of day to compile reports, e.g. 06:00,18:00
+//	REPORT_PERIOD   — how far back each report looks (default 24h)
+//	REPORT_FORMATS  — html, pdf, or both (default html,pdf)
+//	REPORT_EMAIL_TO — comma-separated recipients, sent through the SMTP_* server
+func newReportsFromEnv(dataDir string) (*Reports, error) {
+	v := os.Getenv("REPORT_TIMES")
+	if v == "" {
+		return nil, nil
+	}
+	r := &Reports{dir: filepath.Join(dataDir, "reports"), period: 24 * time.Hour, formats: []string{"html", "pdf"}}
+	for _, t := range splitList(v) {
+		at, err := time.Parse("15:04", t)
+		if err != nil {
+			return nil, fmt.Errorf("REPORT_TIMES: %q is not HH:MM", t)
+		}
+		r.times = append(r.times, at.Hour()*60+at.Minute())
+	}
+	sort.Ints(r.times)
+	if v := os.Getenv("REPORT_PERIOD"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < time.Hour || d > 31*24*time.Hour {
+			return nil, fmt.Errorf("REPORT_PERIOD: must be a duration from 1h to 744h, got %q", v)
+		}
+		r.period = d
+	}
+	if v := os.Getenv("REPORT_FORMATS"); v != "" {
+		r.formats = nil
+		for _, f := range splitList(strings.ToLower(v)) {
+			if f != "html" && f != "pdf" {
+				return nil, fmt.Errorf("REPORT_FORMATS: unknown format %q (want html or pdf)", f)
+			}
+			r.formats = append(r.formats, f)
+		}
+	}
+	r.emailTo = splitList(os.Getenv("REPORT_EMAIL_TO"))
+	if len(r.emailTo) > 0 && mailer == nil {
+		return nil, errors.New("REPORT_EMAIL_TO needs SMTP_HOST")
+	}
+	if err := os.MkdirAll(r.dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create reports dir: %w", err)
+	}
+	return r, nil
+}
+
+// next returns the first scheduled time after now.
+func (r *Reports) next(now time.Time) time.Time {
+	day := now.UTC().Truncate(24 * time.Hour)
+	for _, m := range r.times {
+		if t := day.Add(time.Duration(m) * time.Minute); t.After(now) {
+			return t
+		}
+	}
+	return day.Add(24*time.Hour + time.Duration(r.times[0])*time.Minute)
+}
+
+// Run compiles reports at each scheduled time until shutdown. In a cluster
+// only the global leader compiles them, so each is made once.
+func (r *Reports) Run() {
+	for {
+		due := r.next(time.Now())
+		timer := time.NewTimer(time.Until(due))
+		select {
+		case <-stopping:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if !isLeader("") {
+			continue
+		}
+		names := make([]string, 0, len(regions))
+		for name := range regions {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, region := range names {
+			if _, err := r.Generate(region, due); err != nil {
+				historyLog.Error("Scheduled report failed", "region", region, "err", err)
+			}
+		}
+	}
+}
+
+// Generate compiles the report for the period ending at end, writes it in
+// each format, and emails it if configured. It returns the files written.
+func (r *Reports) Generate(region string, end time.Time) ([]string, error) {
+	report := compileReport(region, end.Add(-r.period), end)
+	var files []string
+	var attachments []mailAttachment
+	// The picture as it is now, which for a scheduled run is the period's end.
+	snapshot, err := renderSnapshot(region, 900)
+	if err != nil {
+		historyLog.Warn("Report snapshot failed", "region", region, "err", err)
+	} else {
+		report.Snapshot = pngDataURL(snapshot)
+	}
+	var htmlBody []byte
+	for _, format := range r.formats {
+		var data []byte
+		var contentType string
+		switch format {
+		case "pdf":
+			data, contentType = report.PDF(), "application/pdf"
+		default:
+			body, err := report.HTML()
+			if err != nil {
+				return files, err
+			}
+			data, contentType, htmlBody = body, "text/html", body
+		}
+		name := report.filename(format)
+		if err := os.WriteFile(filepath.Join(r.dir, name), data, 0o644); err != nil {
+			return files, fmt.Errorf("write report: %w", err)
+		}
+		files = append(files, name)
+		attachments = append(attachments, mailAttachment{Name: name, ContentType: contentType, Data: data})
+	}
+	if snapshot != nil {
+		attachments = append(attachments, mailAttachment{Name: report.filename("png"), ContentType: "image/png", Data: snapshot})
+	}
+	historyLog.Info("Report compiled", "region", region, "files", files)
+
+	if len(r.emailTo) > 0 {
+		body := string(htmlBody)
+		if body == "" {
+			body = fmt.Sprintf("%s for %s to %s is attached.", report.Title(),
+				report.From.Format("2006-01-02 15:04Z"), report.To.Format("2006-01-02 15:04Z"))
+		}
+		subject := fmt.Sprintf("[SWARM C2] %s %s", report.Title(), report.To.Format("2006-01-02 15:04Z"))
+		if err := mailer.Send(r.emailTo, subject, body, attachments...); err != nil {
+			return files, fmt.Errorf("email report: %w", err)
+		}
+		historyLog.Info("Report emailed", "region", region, "recipients", len(r.emailTo))
+	}
+	return files, nil
+}
+
+// storedReport is one file in the reports directory.
+type storedReport struct {
+	Name    string    `json:"name"`
+	Region  string    `json:"region"`
+	Format  string    `json:"format"`
+	Period  time.Time `json:"periodEnd"`
+	Size    int64     `json:"size"`
+	Created time.Time `json:"created"`
+}
+
+// List returns stored reports for a region, or all of them, newest first.
+func (r *Reports) List(region string) []storedReport {
+	entries, _ := os.ReadDir(r.dir)
+	result := make([]storedReport, 0, len(entries))
+	for _, e := range entries {
+		rep, ok := parseReportName(e.Name())
+		if !ok || (region != "" && rep.Region != region) {
+			continue
+		}
+		if info, err := e.Info(); err == nil {
+			rep.Size, rep.Created = info.Size(), info.ModTime().UTC()
+		}
+		result = append(result, rep)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].Period.Equal(result[j].Period) {
+			return result[i].Period.After(result[j].Period)
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// parseReportName reads report-<region>-<20060102T1504Z>.<format>.
+func parseReportName(name string) (storedReport, bool) {
+	base, format, ok := strings.Cut(name, ".")
+	if !ok || (format != "html" && format != "pdf") {
+		return storedReport{}, false
+	}
+	rest, ok := strings.CutPrefix(base, "report-")
+	if !ok {
+		return storedReport{}, false
+	}
+	i := strings.LastIndex(rest, "-")
+	if i <= 0 {
+		return storedReport{}, false
+	}
+	end, err := time.Parse("20060102T1504Z", rest[i+1:])
+	if err != nil {
+		return storedReport{}, false
+	}
+	return storedReport{Name: name, Region: rest[:i], Format: format, Period: end}, true
+}
+
+// periodReport is what happened in one region over a reporting period,
+// shared by the HTML and PDF renderers.
+type periodReport struct {
+	Region     string
+	RegionName string
+	From, To   time.Time
+
+	Analyses      int
+	ThreatLevels  [][]string // level, analyses
+	PeakLevel     string
+	PeakScore     int
+	PeakAt        time.Time
+	PeakSummary   string
+	LatestSummary string
+
+	AlertCounts [][]string // severity, alerts, still active
+	Alerts      [][]string // first seen, severity, kind, title, status
+
+	SortiesKnown   bool // false when position history is off
+	AircraftSeen   int
+	Sorties        int
+	MilSorties     int
+	BusiestHour    string
+	BusiestCount   int
+	HourlyAircraft [][]string // hour, distinct aircraft
+
+	Notable [][]string // callsign, icao24, highest threat, mentions, last reason
+
+	Snapshot template.URL // air picture when the report was compiled, as a data: URL
+}
+
+var (
+	reportAlertColumns   = []string{"First seen", "Severity", "Kind", "Title", "Status"}
+	reportNotableColumns = []string{"Callsign", "ICAO24", "Highest threat", "Mentions", "Latest reason"}
+	reportLevelOrder     = []string{"CRITICAL", "HIGH", "MEDIUM", "LOW", "NOMINAL"}
+)
+
+// maxReportAlerts and maxReportTracks cap the alert and notable track
+// tables; the counts above them cover the rest.
+const (
+	maxReportAlerts = 50
+	maxReportTracks = 25
+)
+
+// compileReport gathers a region's activity in [from, to).
+func compileReport(region string, from, to time.Time) periodReport {
+	rep := periodReport{Region: region, RegionName: region, From: from.UTC(), To: to.UTC()}
+	if r, ok := regions[region]; ok {
+		rep.RegionName = r.Name
+	}
+
+	// Analyses: how threat levels were distributed, the peak, and the last word.
+	type notable struct {
+		callsign, icao24, level, reason string
+		mentions                        int
+	}
+	levels := make(map[string]int)
+	tracks := make(map[string]*notable)
+	analyses := analysisHistory.Between(region, from, to)
+	rep.Analyses = len(analyses)
+	for _, rec := range analyses {
+		a := rec.Analysis
+		levels[a.OverallThreatLevel]++
+		if rep.PeakAt.IsZero() || a.ThreatScore > rep.PeakScore {
+			rep.PeakLevel, rep.PeakScore, rep.PeakAt, rep.PeakSummary = a.OverallThreatLevel, a.ThreatScore, rec.At, a.Summary
+		}
+		rep.LatestSummary = a.Summary
+		for _, ac := range a.AircraftOfInterest {
+			icao24, callsign := sitrepField(ac, "icao24"), sitrepField(ac, "callsign")
+			key := icao24
+			if key == "" {
+				key = callsign
+			}
+			if key == "" {
+				continue
+			}
+			t, ok := tracks[key]
+			if !ok {
+				t = &notable{icao24: icao24, callsign: callsign}
+				tracks[key] = t
+			}
+			t.mentions++
+			if level := strings.ToUpper(sitrepField(ac, "threat_level")); threatRank[level] >= threatRank[t.level] {
+				t.level = level
+			}
+			if reason := sitrepField(ac, "reason"); reason != "" {
+				t.reason = reason
+			}
+		}
+	}
+	for _, level := range reportLevelOrder {
+		if levels[level] > 0 {
+			rep.ThreatLevels = append(rep.ThreatLevels, []string{level, strconv.Itoa(levels[level])})
+		}
+	}
+	list := make([]*notable, 0, len(tracks))
+	for _, t := range tracks {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if threatRank[list[i].level] != threatRank[list[j].level] {
+			return threatRank[list[i].level] > threatRank[list[j].level]
+		}
+		return list[i].mentions > list[j].mentions
+	})
+	for i, t := range list {
+		if i == maxReportTracks {
+			break
+		}
+		rep.Notable = append(rep.Notable, []string{t.callsign, t.icao24, t.level, strconv.Itoa(t.mentions), t.reason})
+	}
+
+	// Alerts raised or still firing in the period, most severe first. Reports
+	// are shared by every workspace watching the region, so a workspace's
+	// own alerts stay out of them.
+	if alertStore != nil {
+		var alerts []Alert
+		for _, a := range alertStore.Query(AlertFilter{Region: region, Since: from, Until: to}) {
+			if a.Workspace == "" {
+				alerts = append(alerts, a)
+			}
+		}
+		total, active := make(map[string]int), make(map[string]int)
+		for _, a := range alerts {
+			total[a.Severity]++
+			if a.Status == AlertStatusActive {
+				active[a.Severity]++
+			}
+		}
+		for _, sev := range reportLevelOrder {
+			if total[sev] > 0 {
+				rep.AlertCounts = append(rep.AlertCounts, []string{sev, strconv.Itoa(total[sev]), strconv.Itoa(active[sev])})
+			}
+		}
+		sort.SliceStable(alerts, func(i, j int) bool { return threatRank[alerts[i].Severity] > threatRank[alerts[j].Severity] })
+		for i, a := range alerts {
+			if i == maxReportAlerts {
+				break
+			}
+			rep.Alerts = append(rep.Alerts, []string{a.FirstSeen.UTC().Format("01-02 15:04Z"), a.Severity, a.Kind, a.Title, a.Status})
+		}
+	}
+
+	// Sorties from position history: an aircraft's appearance after more than
+	// sortieGap out of the picture starts a new one.
+	if positionHistory != nil {
+		rep.SortiesKnown = true
+		lastSeen := make(map[string]int64)
+		hourly := make(map[int64]map[string]bool)
+		scanPositions(positionHistory.dir, region, from, to.Add(-time.Second), func(line []byte) error {
+			var rec PositionRecord
+			if json.Unmarshal(line, &rec) != nil || rec.Source == sourceManual {
+				return nil
+			}
+			if last, ok := lastSeen[rec.ICAO24]; !ok || rec.Time-last > int64(sortieGap/time.Second) {
+				rep.Sorties++
+				if military, _ := classifyMilitary(rec.Aircraft); military {
+					rep.MilSorties++
+				}
+			}
+			lastSeen[rec.ICAO24] = rec.Time
+			hour := rec.Time - rec.Time%3600
+			if hourly[hour] == nil {
+				hourly[hour] = make(map[string]bool)
+			}
+			hourly[hour][rec.ICAO24] = true
+			return nil
+		})
+		rep.AircraftSeen = len(lastSeen)
+		hours := make([]int64, 0, len(hourly))
+		for h := range hourly {
+			hours = append(hours, h)
+		}
+		sort.Slice(hours, func(i, j int) bool { return hours[i] < hours[j] })
+		for _, h := range hours {
+			label := time.Unix(h, 0).UTC().Format("01-02 15:00Z")
+			n := len(hourly[h])
+			rep.HourlyAircraft = append(rep.HourlyAircraft, []string{label, strconv.Itoa(n)})
+			if n > rep.BusiestCount {
+				rep.BusiestHour, rep.BusiestCount = label, n
+			}
+		}
+	}
+	return rep
+}
+
+func (p periodReport) Title() string {
+	return fmt.Sprintf("Periodic Report — %s", p.RegionName)
+}
+
+func (p periodReport) Period() string {
+	return fmt.Sprintf("%s to %s", p.From.Format("2006-01-02 15:04Z"), p.To.Format("2006-01-02 15:04Z"))
+}
+
+func (p periodReport) filename(ext string) string {
+	return fmt.Sprintf("report-%s-%s.%s", p.Region, p.To.Format("20060102T1504Z"), ext)
+}
+
+// Facts are the headline numbers, as label/value rows.
+func (p periodReport) Facts() [][]string {
+	facts := [][]string{{"Analyses", strconv.Itoa(p.Analyses)}}
+	if p.Analyses > 0 {
+		facts = append(facts, []string{"Peak threat", fmt.Sprintf("%s, score %d/100 at %s", p.PeakLevel, p.PeakScore, p.PeakAt.Format("01-02 15:04Z"))})
+	}
+	alerts := 0
+	for _, row := range p.AlertCounts {
+		n, _ := strconv.Atoi(row[1])
+		alerts += n
+	}
+	facts = append(facts, []string{"Alerts", strconv.Itoa(alerts)})
+	if !p.SortiesKnown {
+		return append(facts, []string{"Sorties", "Not available (position history disabled)"})
+	}
+	facts = append(facts,
+		[]string{"Aircraft seen", strconv.Itoa(p.AircraftSeen)},
+		[]string{"Sorties", fmt.Sprintf("%d (%d military)", p.Sorties, p.MilSorties)},
+	)
+	if p.BusiestHour != "" {
+		facts = append(facts, []string{"Busiest hour", fmt.Sprintf("%s, %d aircraft", p.BusiestHour, p.BusiestCount)})
+	}
+	return facts
+}
+
+var reportHTML = template.Must(template.Must(sitrepHTML.Clone()).New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.R.Title}} {{.R.Period}}</title>
+<style>
+` + reportCSS + `</style>
+</head>
+<body>
+<h1>{{.R.Title}}</h1>
+<p class="meta">{{.R.Period}} &middot; Region {{.R.RegionName}} ({{.R.Region}})</p>
+{{if .R.Analyses}}<div class="banner" style="background: {{.Color}}">PEAK THREAT: {{.R.PeakLevel}} &mdash; SCORE {{.R.PeakScore}}/100</div>{{end}}
+{{if .R.Snapshot}}<p><img src="{{.R.Snapshot}}" alt="Air picture at {{.R.To.Format "15:04Z"}}" style="width: 100%"></p>{{end}}
+
+<h2>1. Summary</h2>
+{{template "table" (rows .FactColumns .R.Facts)}}
+{{if .R.LatestSummary}}<p><b>Latest assessment:</b> {{.R.LatestSummary}}</p>{{end}}
+{{if and .R.PeakSummary (ne .R.PeakSummary .R.LatestSummary)}}<p><b>At peak:</b> {{.R.PeakSummary}}</p>{{end}}
+
+<h2>2. Threat Levels</h2>
+{{template "table" (rows .LevelColumns .R.ThreatLevels)}}
+
+<h2>3. Alerts</h2>
+{{template "table" (rows .AlertCountColumns .R.AlertCounts)}}
+{{if .R.Alerts}}<h3>Most severe</h3>
+{{template "table" (rows .AlertColumns .R.Alerts)}}{{end}}
+
+<h2>4. Activity</h2>
+{{if .R.SortiesKnown}}{{template "table" (rows .HourColumns .R.HourlyAircraft)}}{{else}}<p>Position history is disabled, so sorties were not counted.</p>{{end}}
+
+<h2>5. Notable Tracks</h2>
+{{template "table" (rows .NotableColumns .R.Notable)}}
+</body>
+</html>`))
+
+func (p periodReport) HTML() ([]byte, error) {
+	var b strings.Builder
+	err := reportHTML.Execute(&b, map[string]interface{}{
+		"R":                 p,
+		"Color":             template.CSS(sitrepColor(p.PeakLevel)),
+		"FactColumns":       []string{"Measure", "Value"},
+		"LevelColumns":      []string{"Threat level", "Analyses"},
+		"AlertCountColumns": []string{"Severity", "Alerts", "Still active"},
+		"AlertColumns":      reportAlertColumns,
+		"HourColumns":       []string{"Hour", "Aircraft"},
+		"NotableColumns":    reportNotableColumns,
+	})
+	return []byte(b.String()), err
+}
+
+func (p periodReport) PDF() []byte {
+	doc := pdf.New()
+	doc.Footer = fmt.Sprintf("SWARM C2 %s %s", p.Title(), p.Period())
+
+	doc.Title(p.Title())
+	doc.Paragraph(fmt.Sprintf("%s  ·  Region %s (%s)", p.Period(), p.RegionName, p.Region), 9, false)
+	if p.Analyses > 0 {
+		doc.Space(6)
+		doc.Banner(fmt.Sprintf("PEAK THREAT: %s — SCORE %d/100", p.PeakLevel, p.PeakScore), pdf.HexColor(sitrepColor(p.PeakLevel)))
+	}
+
+	pdfTable := func(heading string, widths []float64, columns []string, rows [][]string) {
+		if heading != "" {
+			doc.Heading(heading)
+		}
+		if len(rows) == 0 {
+			doc.Paragraph("None.", 10, false)
+			return
+		}
+		doc.Table(widths, columns, rows)
+	}
+	pdfTable("1. Summary", []float64{0.3, 0.7}, []string{"Measure", "Value"}, p.Facts())
+	if p.LatestSummary != "" {
+		doc.Paragraph("Latest assessment: "+p.LatestSummary, 10, false)
+	}
+	if p.PeakSummary != "" && p.PeakSummary != p.LatestSummary {
+		doc.Paragraph("At peak: "+p.PeakSummary, 10, false)
+	}
+	pdfTable("2. Threat Levels", []float64{0.5, 0.5}, []string{"Threat level", "Analyses"}, p.ThreatLevels)
+	pdfTable("3. Alerts", []float64{0.4, 0.3, 0.3}, []string{"Severity", "Alerts", "Still active"}, p.AlertCounts)
+	if len(p.Alerts) > 0 {
+		doc.Space(6)
+		pdfTable("", []float64{0.15, 0.12, 0.15, 0.44, 0.14}, reportAlertColumns, p.Alerts)
+	}
+	doc.Heading("4. Activity")
+	if p.SortiesKnown {
+		pdfTable("", []float64{0.5, 0.5}, []string{"Hour", "Aircraft"}, p.HourlyAircraft)
+	} else {
+		doc.Paragraph("Position history is disabled, so sorties were not counted.", 10, false)
+	}
+	pdfTable("5. Notable Tracks", []float64{0.14, 0.12, 0.14, 0.1, 0.5}, reportNotableColumns, p.Notable)
+	return doc.Bytes()
+}
+
+// handleReports lists stored reports.
+// GET /api/reports[?region=]
+func handleReports(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if reports == nil {
+		http.Error(w, "Scheduled reports not configured", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reports.List(r.URL.Query().Get("region")))
+}
+
+// handleReport serves a stored report, or compiles one now.
+//
+//	GET  /api/reports/{name}             — download a stored report
+//	POST /api/reports/generate?region=   — compile a report for the period ending now
+func handleReport(w http.ResponseWriter, r *http.Request) {
+	if reports == nil {
+		http.Error(w, "Scheduled reports not configured", http.StatusServiceUnavailable)
+		return
+	}
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/reports/"), "/")
+
+	if name == "generate" {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		region := r.URL.Query().Get("region")
+		if _, ok := regions[region]; !ok {
+			http.Error(w, fmt.Sprintf("unknown region %q", region), http.StatusBadRequest)
+			return
+		}
+		files, err := reports.Generate(region, time.Now().UTC())
+		if err != nil && len(files) == 0 {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		auditLog.Record(r, "report.generate", map[string]interface{}{"region": region, "files": files})
+		result := map[string]interface{}{"files": files}
+		if err != nil {
+			result["error"] = err.Error()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(result)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	rep, ok := parseReportName(name)
+	if !ok || strings.ContainsAny(name, `/\`) || !workspaceAllows(principalFrom(r), rep.Region) {
+		http.NotFound(w, r)
+		return
+	}
+	data, err := os.ReadFile(filepath.Join(reports.dir, rep.Name))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if rep.Format == "pdf" {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", rep.Name))
+	} else {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", rep.Name))
+	}
+	w.Write(data)
+}
@@ -0,0 +1,97 @@
+// Package sbs formats BaseStation (SBS-1) "port 30003" messages, the CSV
+// text feed that dump1090, Virtual Radar Server, and PlanePlotter consume.
+//
+//	MSG,3,1,1,4CA123,1,2026/01/01,12:00:00.000,2026/01/01,12:00:00.000,,35000,,,51.50000,-0.12000,,,0,0,0,0
+//	 │   │ │ │  │    │  └ generated ─────────┘ └ logged ───────────────┘ │   │   ... 22 fields, one per line
+//	 │   │ │ │  hex  flight id                                         callsign altitude
+//	 │   transmission type
+//	 message type
+package sbs
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Transmission types.
+const (
+	Identification   = 1 // callsign
+	SurfacePosition  = 2
+	AirbornePosition = 3
+	AirborneVelocity = 4
+	Surveillance     = 6 // squawk
+)
+
+// State is one aircraft's current state. Pointer fields are optional.
+type State struct {
+	ICAO24       string
+	Callsign     string
+	Time         time.Time
+	Lat, Lon     *float64
+	AltitudeFt   *float64 // barometric
+	GroundSpeed  *float64 // knots
+	Track        *float64 // degrees true
+	VerticalRate *float64 // ft/min
+	Squawk       string
+	SPI          bool
+	OnGround     bool
+}
+
+// Messages renders the MSG lines that describe a state: identification,
+// position (airborne or surface), velocity, and squawk, as available.
+// Each line ends with CRLF like a real BaseStation.
+func Messages(s State) []string {
+	var lines []string
+	emit := func(tt int, callsign, alt, gs, track, lat, lon, vr, squawk, flags string) {
+		ts := s.Time.UTC()
+		date, clock := ts.Format("2006/01/02"), ts.Format("15:04:05.000")
+		lines = append(lines, fmt.Sprintf("MSG,%d,1,1,%s,1,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s\r\n",
+			tt, strings.ToUpper(s.ICAO24), date, clock, date, clock,
+			callsign, alt, gs, track, lat, lon, vr, squawk, flags))
+	}
+	ground := flag(s.OnGround)
+
+	if cs := sanitize(s.Callsign); cs != "" {
+		emit(Identification, cs, "", "", "", "", "", "", "", ",,,"+ground)
+	}
+	if s.Lat != nil && s.Lon != nil {
+		lat, lon := fmt.Sprintf("%.5f", *s.Lat), fmt.Sprintf("%.5f", *s.Lon)
+		if s.OnGround {
+			emit(SurfacePosition, "", "", num(s.GroundSpeed), num(s.Track), lat, lon, "", "", ",,,"+ground)
+		} else {
+			emit(AirbornePosition, "", num(s.AltitudeFt), "", "", lat, lon, "", "", "0,0,"+flag(s.SPI)+","+ground)
+		}
+	}
+	if !s.OnGround && s.GroundSpeed != nil && s.Track != nil {
+		emit(AirborneVelocity, "", "", num(s.GroundSpeed), num(s.Track), "", "", num(s.VerticalRate), "", ",,,"+ground)
+	}
+	if sq := sanitize(s.Squawk); sq != "" {
+		emergency := "0"
+		if sq == "7500" || sq == "7600" || sq == "7700" {
+			emergency = "-1"
+		}
+		emit(Surveillance, "", num(s.AltitudeFt), "", "", "", "", "", sq, "0,"+emergency+","+flag(s.SPI)+","+ground)
+	}
+	return lines
+}
+
+// BaseStation flags are -1 for true and 0 for false.
+func flag(b bool) string {
+	if b {
+		return "-1"
+	}
+	return "0"
+}
+
+func num(v *float64) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprintf("%.0f", *v)
+}
+
+// sanitize keeps commas and line breaks out of free-text fields.
+func sanitize(s string) string {
+	return strings.TrimSpace(strings.NewReplacer(",", "", "\r", "", "\n", "").Replace(s))
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"swarm-c2/sbs"
+)
+
+// SBSServer re-broadcasts the fused picture as BaseStation port-30003 text
+// to every connected TCP client, so tools expecting a local receiver
+// (Virtual Radar Server, PlanePlotter) can use SwarmC2 as one.
+type SBSServer struct {
+	listener net.Listener
+
+	mu      sync.Mutex
+	clients map[net.Conn]chan []byte
+}
+
+var sbsServer *SBSServer
+
+// newSBSServerFromEnv listens on SBS_LISTEN (e.g. ":30003"); nil when unset.
+func newSBSServerFromEnv() (*SBSServer, error) {
+	addr := os.Getenv("SBS_LISTEN")
+	if addr == "" {
+		return nil, nil
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("listen %s: %w", addr, err)
+	}
+	s := &SBSServer{listener: ln, clients: make(map[net.Conn]chan []byte)}
+	goSupervised("sbs", s.accept)
+	return s, nil
+}
+
+func (s *SBSServer) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				continue
+			}
+			feedLog.Warn("SBS listener stopped", "err", err)
+			return
+		}
+		out := make(chan []byte, 16)
+		s.mu.Lock()
+		s.clients[conn] = out
+		s.mu.Unlock()
+		feedLog.Info("SBS client connected", "remote", conn.RemoteAddr().String())
+		go func() {
+			defer recoverPanic("sbs")
+			s.serve(conn, out)
+		}()
+	}
+}
+
+// serve writes batches to one client until it disconnects or falls behind.
+func (s *SBSServer) serve(conn net.Conn, out chan []byte) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, conn)
+		s.mu.Unlock()
+		conn.Close()
+		feedLog.Info("SBS client disconnected", "remote", conn.RemoteAddr().String())
+	}()
+	for batch := range out {
+		conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		if _, err := conn.Write(batch); err != nil {
+			return
+		}
+	}
+}
+
+// Publish sends one region's picture to all clients. Clients whose buffer
+// is full are disconnected rather than allowed to stall the feed.
+func (s *SBSServer) Publish(aircraft []Aircraft) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.clients) == 0 {
+		return
+	}
+
+	var b strings.Builder
+	for _, ac := range aircraft {
+		for _, line := range sbs.Messages(sbsState(ac)) {
+			b.WriteString(line)
+		}
+	}
+	batch := []byte(b.String())
+
+	for conn, out := range s.clients {
+		select {
+		case out <- batch:
+		default:
+			feedLog.Warn("SBS client too slow, dropping", "remote", conn.RemoteAddr().String())
+			close(out)
+			delete(s.clients, conn)
+		}
+	}
+}
+
+// sbsState converts to BaseStation units: feet, knots, ft/min.
+func sbsState(ac Aircraft) sbs.State {
+	st := sbs.State{
+		ICAO24:   ac.ICAO24,
+		Callsign: ac.Callsign,
+		Time:     time.Unix(ac.LastContact, 0),
+		Lat:      ac.Latitude,
+		Lon:      ac.Longitude,
+		Track:    ac.TrueTrack,
+		SPI:      ac.SPI,
+		OnGround: ac.OnGround,
+	}
+	if ac.BaroAltitude != nil {
+		ft := *ac.BaroAltitude / 0.3048
+		st.AltitudeFt = &ft
+	}
+	if ac.Velocity != nil {
+		kt := *ac.Velocity * 3600 / 1852
+		st.GroundSpeed = &kt
+	}
+	if ac.VerticalRate != nil {
+		fpm := *ac.VerticalRate / 0.3048 * 60
+		st.VerticalRate = &fpm
+	}
+	if ac.Squawk != nil {
+		st.Squawk = *ac.Squawk
+	}
+	return st
+}
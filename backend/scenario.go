@@ -0,0 +1,474 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Scenario is a script of synthetic aircraft, loaded from YAML, that is
+// mixed into a region's live picture for demos, training, and exercising
+// alert rules. Every aircraft it adds has Simulated set, and pictures that
+// contain them carry the scenario's name.
+type Scenario struct {
+	Name      string             `yaml:"name"`
+	Region    string             `yaml:"region"`    // default region for its aircraft
+	Loop      bool               `yaml:"loop"`      // start over when it ends
+	Duration  time.Duration      `yaml:"duration"`  // default: until the last aircraft finishes
+	Exclusive bool               `yaml:"exclusive"` // hide real traffic in its regions
+	Aircraft  []ScenarioAircraft `yaml:"aircraft"`
+
+	path      string
+	cycle     time.Duration
+	icao      map[string]bool
+	mu        sync.Mutex
+	start     time.Time
+	regionSet map[string]bool // regions with scenario aircraft
+}
+
+// ScenarioAircraft is one scripted aircraft. It flies its waypoints in
+// order, or holds station on a lead aircraft in formation. Start and squawk
+// times are from the start of the scenario.
+type ScenarioAircraft struct {
+	Callsign  string             `yaml:"callsign"`
+	ICAO24    string             `yaml:"icao24"` // default: derived from the callsign
+	Country   string             `yaml:"country"`
+	Category  int                `yaml:"category"` // OpenSky emitter category
+	Region    string             `yaml:"region"`
+	Start     time.Duration      `yaml:"start"`
+	Squawk    string             `yaml:"squawk"`
+	Squawks   []ScenarioSquawk   `yaml:"squawks"`
+	Waypoints []ScenarioWaypoint `yaml:"waypoints"`
+	Follow    string             `yaml:"follow"` // lead callsign, instead of waypoints
+	Offset    ScenarioOffset     `yaml:"offset"`
+
+	legs []scenarioLeg
+	end  time.Duration // when it lands, from the start of the scenario
+}
+
+// ScenarioWaypoint is a point on a route. Speed changes evenly along the
+// leg to the next waypoint; a waypoint without a speed keeps the last one.
+type ScenarioWaypoint struct {
+	Lat     float64 `yaml:"lat"`
+	Lon     float64 `yaml:"lon"`
+	AltFt   float64 `yaml:"alt_ft"`
+	SpeedKt float64 `yaml:"speed_kt"`
+}
+
+// ScenarioSquawk changes the transponder code at a time.
+type ScenarioSquawk struct {
+	At   time.Duration `yaml:"at"`
+	Code string        `yaml:"code"`
+}
+
+// ScenarioOffset places a wingman relative to its lead: Bearing is degrees
+// clockwise from the lead's track (135 is behind and to the right).
+type ScenarioOffset struct {
+	Bearing   float64 `yaml:"bearing"`
+	DistanceM float64 `yaml:"distance_m"`
+	AltFt     float64 `yaml:"alt_ft"`
+}
+
+// scenarioLeg is the flight between two waypoints, under constant
+// acceleration.
+type scenarioLeg struct {
+	from, to   ScenarioWaypoint
+	start, dur float64 // seconds from the aircraft's start
+	v0, v1     float64 // m/s
+	dist       float64 // meters
+}
+
+var scenario *Scenario
+
+var squawkPattern = regexp.MustCompile(`^[0-7]{4}$`)
+
+// newScenarioFromEnv returns nil when SCENARIO_FILE is unset.
+//
+//	SCENARIO_FILE — YAML scenario of simulated aircraft to mix into the live picture
+func newScenarioFromEnv() (*Scenario, error) {
+	path := os.Getenv("SCENARIO_FILE")
+	if path == "" {
+		return nil, nil
+	}
+	return LoadScenario(path)
+}
+
+// LoadScenario reads and checks a scenario file, working out each route's
+// timing up front.
+func LoadScenario(path string) (*Scenario, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &Scenario{path: path, icao: make(map[string]bool), regionSet: make(map[string]bool)}
+	dec := yaml.NewDecoder(bytes.NewReader(raw))
+	dec.KnownFields(true)
+	if err := dec.Decode(s); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := s.prepare(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	s.start = time.Now()
+	return s, nil
+}
+
+func (s *Scenario) prepare() error {
+	if s.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if len(s.Aircraft) == 0 {
+		return fmt.Errorf("no aircraft")
+	}
+	leads := make(map[string]*ScenarioAircraft)
+	for i := range s.Aircraft {
+		ac := &s.Aircraft[i]
+		where := fmt.Sprintf("aircraft %d", i+1)
+		if ac.Callsign == "" {
+			return fmt.Errorf("%s: callsign is required", where)
+		}
+		where = "aircraft " + ac.Callsign
+		if leads[ac.Callsign] != nil {
+			return fmt.Errorf("%s: callsign used twice", where)
+		}
+		if ac.Region == "" {
+			ac.Region = s.Region
+		}
+		if _, ok := regions[ac.Region]; !ok {
+			return fmt.Errorf("%s: unknown region %q", where, ac.Region)
+		}
+		if ac.ICAO24 == "" {
+			h := fnv.New32a()
+			h.Write([]byte(s.Name + "/" + ac.Callsign))
+			ac.ICAO24 = fmt.Sprintf("%06x", h.Sum32()&0xFFFFFF)
+		}
+		ac.ICAO24 = strings.ToLower(ac.ICAO24)
+		if len(ac.ICAO24) != 6 || strings.Trim(ac.ICAO24, "0123456789abcdef") != "" {
+			return fmt.Errorf("%s: icao24 %q is not 6 hex digits", where, ac.ICAO24)
+		}
+		if s.icao[ac.ICAO24] {
+			return fmt.Errorf("%s: icao24 %s used twice", where, ac.ICAO24)
+		}
+		if ac.Country == "" {
+			ac.Country = "Simulated"
+		}
+		for _, sq := range append([]ScenarioSquawk{{Code: ac.Squawk}}, ac.Squawks...) {
+			if sq.Code != "" && !squawkPattern.MatchString(sq.Code) {
+				return fmt.Errorf("%s: squawk %q is not four octal digits", where, sq.Code)
+			}
+		}
+
+		switch {
+		case ac.Follow != "":
+			lead := leads[ac.Follow]
+			if lead == nil || lead.Follow != "" {
+				return fmt.Errorf("%s: follow must name an earlier aircraft that flies waypoints", where)
+			}
+			if len(ac.Waypoints) > 0 {
+				return fmt.Errorf("%s: has both follow and waypoints", where)
+			}
+			if ac.Region != lead.Region {
+				return fmt.Errorf("%s: not in its lead's region", where)
+			}
+			ac.end = lead.end
+		case len(ac.Waypoints) < 2:
+			return fmt.Errorf("%s: needs at least two waypoints, or follow", where)
+		default:
+			if err := ac.planRoute(); err != nil {
+				return fmt.Errorf("%s: %w", where, err)
+			}
+		}
+		leads[ac.Callsign] = ac
+		s.icao[ac.ICAO24] = true
+		s.regionSet[ac.Region] = true
+		if ac.end > s.cycle {
+			s.cycle = ac.end
+		}
+	}
+	if s.Duration > 0 {
+		s.cycle = s.Duration
+	}
+	return nil
+}
+
+// planRoute times each leg from the waypoint speeds.
+func (ac *ScenarioAircraft) planRoute() error {
+	speed := ac.Waypoints[0].SpeedKt
+	if speed <= 0 {
+		return fmt.Errorf("the first waypoint needs a speed_kt")
+	}
+	for i := range ac.Waypoints {
+		wp := &ac.Waypoints[i]
+		if wp.Lat < -90 || wp.Lat > 90 || wp.Lon < -180 || wp.Lon > 180 {
+			return fmt.Errorf("waypoint %d: lat/lon out of range", i+1)
+		}
+		if wp.SpeedKt <= 0 {
+			wp.SpeedKt = speed
+		}
+		speed = wp.SpeedKt
+	}
+	t := 0.0
+	for i := 0; i+1 < len(ac.Waypoints); i++ {
+		from, to := ac.Waypoints[i], ac.Waypoints[i+1]
+		leg := scenarioLeg{
+			from: from, to: to, start: t,
+			v0:   from.SpeedKt * knotsToMS,
+			v1:   to.SpeedKt * knotsToMS,
+			dist: greatCircleDistance(from.Lat, from.Lon, to.Lat, to.Lon),
+		}
+		if leg.dist < 1 {
+			return fmt.Errorf("waypoint %d is where waypoint %d is", i+2, i+1)
+		}
+		leg.dur = 2 * leg.dist / (leg.v0 + leg.v1)
+		t += leg.dur
+		ac.legs = append(ac.legs, leg)
+	}
+	ac.end = ac.Start + time.Duration(t*float64(time.Second))
+	return nil
+}
+
+const knotsToMS = 0.514444
+
+// greatCircleDistance returns the distance in meters between two points.
+func greatCircleDistance(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadius = 6371000.0
+	lat1R, lat2R := lat1*math.Pi/180, lat2*math.Pi/180
+	dLat, dLon := lat2R-lat1R, (lon2-lon1)*math.Pi/180
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1R)*math.Cos(lat2R)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// elapsed returns how far into the scenario it is, and false once a
+// scenario that doesn't loop has ended.
+func (s *Scenario) elapsed(now time.Time) (time.Duration, bool) {
+	s.mu.Lock()
+	e := now.Sub(s.start)
+	s.mu.Unlock()
+	if s.Loop && s.cycle > 0 {
+		return e % s.cycle, true
+	}
+	return e, e <= s.cycle
+}
+
+// Restart starts the scenario over from the beginning.
+func (s *Scenario) Restart() {
+	s.mu.Lock()
+	s.start = time.Now()
+	s.mu.Unlock()
+}
+
+// Simulates reports whether icao24 is one of the scenario's aircraft.
+func (s *Scenario) Simulates(icao24 string) bool {
+	return s != nil && s.icao[strings.ToLower(icao24)]
+}
+
+// Inject adds the scenario's aircraft in the picture's region as of its
+// timestamp. A picture that already has them, like one a cluster leader
+// shared, is left alone.
+func (s *Scenario) Inject(data *AirspaceData) {
+	if s == nil || data.Scenario != "" || !s.regionSet[data.Region] {
+		return
+	}
+	data.Scenario = s.Name
+	if s.Exclusive {
+		data.Aircraft = nil
+	}
+	data.Aircraft = append(data.Aircraft, s.airspace(data.Region, time.Unix(data.Timestamp, 0))...)
+	data.Count = len(data.Aircraft)
+}
+
+// airspace positions the region's scenario aircraft at now.
+func (s *Scenario) airspace(region string, now time.Time) []Aircraft {
+	e, running := s.elapsed(now)
+	if !running {
+		return nil
+	}
+	nowUnix := now.Unix()
+	leads := make(map[string]Aircraft)
+	var out []Aircraft
+	for i := range s.Aircraft {
+		sa := &s.Aircraft[i]
+		if sa.Region != region {
+			continue
+		}
+		var ac Aircraft
+		var ok bool
+		if sa.Follow != "" {
+			ac, ok = sa.wingman(leads[sa.Follow], e)
+		} else {
+			ac, ok = sa.position(e)
+			if ok {
+				leads[sa.Callsign] = ac
+			}
+		}
+		if !ok {
+			continue
+		}
+		ac.ICAO24, ac.Callsign, ac.OriginCountry, ac.Category = sa.ICAO24, sa.Callsign, sa.Country, sa.Category
+		ac.TimePosition, ac.LastContact = &nowUnix, nowUnix
+		ac.Simulated = true
+		if code := sa.squawkAt(e); code != "" {
+			ac.Squawk = &code
+		}
+		out = append(out, ac)
+	}
+	return out
+}
+
+// position flies the route to e, or returns false before takeoff and after
+// the last waypoint.
+func (sa *ScenarioAircraft) position(e time.Duration) (Aircraft, bool) {
+	if e < sa.Start || e > sa.end {
+		return Aircraft{}, false
+	}
+	t := (e - sa.Start).Seconds()
+	leg := sa.legs[len(sa.legs)-1]
+	for _, l := range sa.legs {
+		if t <= l.start+l.dur {
+			leg = l
+			break
+		}
+	}
+	tau := math.Min(t-leg.start, leg.dur)
+	accel := (leg.v1 - leg.v0) / leg.dur
+	frac := 1.0
+	if leg.dist > 0 {
+		frac = (leg.v0*tau + accel*tau*tau/2) / leg.dist
+	}
+	lat, lon := greatCircleInterpolate(leg.from.Lat, leg.from.Lon, leg.to.Lat, leg.to.Lon, frac)
+	track := greatCircleBearing(lat, lon, leg.to.Lat, leg.to.Lon)
+	alt := (leg.from.AltFt + (leg.to.AltFt-leg.from.AltFt)*frac) * 0.3048
+	speed := leg.v0 + accel*tau
+	vertRate := (leg.to.AltFt - leg.from.AltFt) * 0.3048 / leg.dur
+	return Aircraft{
+		Latitude:     &lat,
+		Longitude:    &lon,
+		BaroAltitude: &alt,
+		GeoAltitude:  &alt,
+		Velocity:     &speed,
+		TrueTrack:    &track,
+		VerticalRate: &vertRate,
+	}, true
+}
+
+// wingman holds the offset from its lead, once it has joined.
+func (sa *ScenarioAircraft) wingman(lead Aircraft, e time.Duration) (Aircraft, bool) {
+	if lead.Latitude == nil || e < sa.Start {
+		return Aircraft{}, false
+	}
+	lat, lon := destinationPoint(*lead.Latitude, *lead.Longitude, *lead.TrueTrack+sa.Offset.Bearing, sa.Offset.DistanceM)
+	alt := *lead.BaroAltitude + sa.Offset.AltFt*0.3048
+	return Aircraft{
+		Latitude:     &lat,
+		Longitude:    &lon,
+		BaroAltitude: &alt,
+		GeoAltitude:  &alt,
+		Velocity:     lead.Velocity,
+		TrueTrack:    lead.TrueTrack,
+		VerticalRate: lead.VerticalRate,
+	}, true
+}
+
+// squawkAt returns the transponder code at e.
+func (sa *ScenarioAircraft) squawkAt(e time.Duration) string {
+	code := sa.Squawk
+	for _, sq := range sa.Squawks {
+		if sq.At <= e {
+			code = sq.Code
+		}
+	}
+	return code
+}
+
+// ScenarioStatus is what GET /api/scenario reports.
+type ScenarioStatus struct {
+	Active          bool     `json:"active"`
+	Name            string   `json:"name,omitempty"`
+	File            string   `json:"file,omitempty"`
+	Regions         []string `json:"regions,omitempty"`
+	Loop            bool     `json:"loop"`
+	Exclusive       bool     `json:"exclusive"`
+	ElapsedSeconds  int64    `json:"elapsedSeconds"`
+	DurationSeconds int64    `json:"durationSeconds"`
+	Finished        bool     `json:"finished"`
+	Aircraft        int      `json:"aircraft"`
+	Airborne        int      `json:"airborne"`
+}
+
+// Status reports the scenario's progress.
+func (s *Scenario) Status() ScenarioStatus {
+	if s == nil {
+		return ScenarioStatus{}
+	}
+	now := time.Now()
+	e, running := s.elapsed(now)
+	st := ScenarioStatus{
+		Active:          true,
+		Name:            s.Name,
+		File:            s.path,
+		Loop:            s.Loop,
+		Exclusive:       s.Exclusive,
+		ElapsedSeconds:  int64(e.Seconds()),
+		DurationSeconds: int64(s.cycle.Seconds()),
+		Finished:        !running,
+		Aircraft:        len(s.Aircraft),
+	}
+	for name := range regions {
+		if s.regionSet[name] {
+			st.Regions = append(st.Regions, name)
+			st.Airborne += len(s.airspace(name, now))
+		}
+	}
+	sort.Strings(st.Regions)
+	return st
+}
+
+// handleScenario serves GET /api/scenario.
+func handleScenario(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(scenario.Status())
+}
+
+// handleScenarioRestart serves POST /api/admin/scenario/restart.
+func handleScenarioRestart(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if scenario == nil {
+		http.Error(w, "No scenario loaded (set SCENARIO_FILE)", http.StatusNotFound)
+		return
+	}
+	scenario.Restart()
+	auditLog.Record(r, "scenario.restart", map[string]interface{}{"scenario": scenario.Name})
+	requestLog(fetcherLog, r).Info("Scenario restarted", "scenario", scenario.Name)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(scenario.Status())
+}
+
+// liveAircraft drops simulated aircraft and manual tracks, for outbound
+// formats that have no way to mark them.
+func liveAircraft(aircraft []Aircraft) []Aircraft {
+	out := make([]Aircraft, 0, len(aircraft))
+	for _, ac := range aircraft {
+		if !ac.Simulated && ac.Source != sourceManual {
+			out = append(out, ac)
+		}
+	}
+	return out
+}
@@ -0,0 +1,662 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Hook names a script may define as globals.
+const (
+	hookAircraftUpdate   = "on_aircraft_update"
+	hookZoneEvent        = "on_zone_event"
+	hookAnalysisComplete = "on_analysis_complete"
+)
+
+var scriptHooks = []string{hookAircraftUpdate, hookZoneEvent, hookAnalysisComplete}
+
+const (
+	// maxScriptString caps string.rep, the one library call that can build
+	// an arbitrarily large value in a single step.
+	maxScriptString = 1 << 20
+	// maxScriptDepth bounds nested tables passed back to Go.
+	maxScriptDepth = 8
+	// scriptErrorLogEvery rate-limits error logging for a failing script.
+	scriptErrorLogEvery = time.Minute
+)
+
+// ZoneEvent is an aircraft crossing a zone boundary or overstaying its
+// dwell limit, passed to on_zone_event.
+type ZoneEvent struct {
+	Type         string   `json:"type"` // "entry", "exit", or "dwell"
+	Region       string   `json:"region"`
+	Zone         Zone     `json:"zone"`
+	Aircraft     Aircraft `json:"aircraft"`
+	DwellMinutes float64  `json:"dwellMinutes"`
+}
+
+// Script is one Lua file with its own interpreter. Calls into it are
+// serialised; different scripts run independently.
+type Script struct {
+	Name string
+	path string
+	kind string // alert kind, "script:<name>"
+
+	mu     sync.Mutex
+	L      *lua.LState
+	closed bool
+	region string          // region of the hook running
+	hook   string          // hook running
+	raised map[string]bool // alert keys raised by the hook running
+	held   map[string]map[string]bool
+	status ScriptStatus
+	logged time.Time // last error logged
+}
+
+// ScriptStatus is a script's health as reported by /api/admin/scripts.
+type ScriptStatus struct {
+	Name      string     `json:"name"`
+	File      string     `json:"file"`
+	Hooks     []string   `json:"hooks"`
+	Calls     int64      `json:"calls"`
+	Errors    int64      `json:"errors"`
+	LastCall  *time.Time `json:"lastCall,omitempty"`
+	LastError string     `json:"lastError,omitempty"`
+	LastMs    float64    `json:"lastMs"`
+}
+
+// ScriptHost runs the scripts in SCRIPTS_DIR against live events. A nil
+// host does nothing.
+type ScriptHost struct {
+	dir     string
+	timeout time.Duration
+
+	mu       sync.RWMutex
+	scripts  []*Script
+	loadedAt time.Time
+}
+
+var scriptHost *ScriptHost
+
+// newScriptHostFromEnv loads every *.lua file in SCRIPTS_DIR, in name
+// order. Returns nil when SCRIPTS_DIR is unset.
+//
+//	SCRIPTS_DIR    — directory of Lua rule scripts
+//	SCRIPT_TIMEOUT — how long one hook call may run (default 250ms)
+func newScriptHostFromEnv() (*ScriptHost, error) {
+	dir := os.Getenv("SCRIPTS_DIR")
+	if dir == "" {
+		return nil, nil
+	}
+	h := &ScriptHost{dir: dir, timeout: 250 * time.Millisecond}
+	if v := os.Getenv("SCRIPT_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < time.Millisecond || d > 10*time.Second {
+			return nil, fmt.Errorf("SCRIPT_TIMEOUT: must be a duration from 1ms to 10s, got %q", v)
+		}
+		h.timeout = d
+	}
+	if err := h.Reload(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Reload compiles every script again and swaps them in. On any error the
+// running scripts are kept.
+func (h *ScriptHost) Reload() error {
+	paths, err := filepath.Glob(filepath.Join(h.dir, "*.lua"))
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(h.dir); err != nil {
+		return fmt.Errorf("scripts dir: %w", err)
+	}
+	sort.Strings(paths)
+	var loaded []*Script
+	fail := func(err error) error {
+		for _, s := range loaded {
+			s.close()
+		}
+		return err
+	}
+	for _, path := range paths {
+		s, err := h.load(path)
+		if err != nil {
+			return fail(err)
+		}
+		loaded = append(loaded, s)
+	}
+
+	h.mu.Lock()
+	old := h.scripts
+	h.scripts, h.loadedAt = loaded, time.Now().UTC()
+	h.mu.Unlock()
+	for _, s := range old {
+		s.close()
+	}
+	return nil
+}
+
+// load creates a sandboxed interpreter for one file and runs its top level,
+// which defines the hooks.
+func (h *ScriptHost) load(path string) (*Script, error) {
+	name := strings.TrimSuffix(filepath.Base(path), ".lua")
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("script %s: %w", name, err)
+	}
+	s := &Script{
+		Name:   name,
+		path:   path,
+		kind:   "script:" + name,
+		held:   make(map[string]map[string]bool),
+		status: ScriptStatus{Name: name, File: filepath.Base(path), Hooks: []string{}},
+	}
+	s.L = lua.NewState(lua.Options{SkipOpenLibs: true, CallStackSize: 200})
+	s.sandbox()
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+	defer cancel()
+	s.L.SetContext(ctx)
+	fn, err := s.L.Load(bytes.NewReader(src), s.status.File)
+	if err == nil {
+		s.L.Push(fn)
+		err = s.L.PCall(0, lua.MultRet, nil)
+	}
+	s.L.RemoveContext()
+	if err != nil {
+		s.L.Close()
+		return nil, fmt.Errorf("script %s: %w", name, err)
+	}
+	for _, hook := range scriptHooks {
+		if _, ok := s.L.GetGlobal(hook).(*lua.LFunction); ok {
+			s.status.Hooks = append(s.status.Hooks, hook)
+		}
+	}
+	if len(s.status.Hooks) == 0 {
+		s.L.Close()
+		return nil, fmt.Errorf("script %s: defines none of %s", name, strings.Join(scriptHooks, ", "))
+	}
+	return s, nil
+}
+
+// sandbox opens the pure libraries only — no io, os, package, or debug —
+// drops the base functions that load code or reach the filesystem, and
+// installs the swarm API.
+func (s *Script) sandbox() {
+	L := s.L
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	for _, name := range []string{"dofile", "loadfile", "load", "loadstring", "require", "module", "collectgarbage", "getfenv", "setfenv", "newproxy", "_printregs"} {
+		L.SetGlobal(name, lua.LNil)
+	}
+	if str, ok := L.GetGlobal("string").(*lua.LTable); ok {
+		str.RawSetString("rep", L.NewFunction(scriptStringRep))
+	}
+	L.SetGlobal("print", L.NewFunction(s.luaLog))
+
+	api := L.NewTable()
+	L.SetFuncs(api, map[string]lua.LGFunction{
+		"alert":          s.luaAlert,
+		"resolve":        s.luaResolve,
+		"flag":           s.luaFlag,
+		"unflag":         s.luaUnflag,
+		"flags":          s.luaFlags,
+		"note":           s.luaNote,
+		"classify":       s.luaClassify,
+		"classification": s.luaClassification,
+		"log":            s.luaLog,
+		"now":            func(L *lua.LState) int { L.Push(lua.LNumber(float64(time.Now().UnixMilli()) / 1000)); return 1 },
+		"distance_km":    luaDistanceKm,
+	})
+	L.SetGlobal("swarm", api)
+}
+
+func (s *Script) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		s.L.Close()
+	}
+}
+
+// call runs one hook if the script defines it. args converts Go values in
+// the script's own interpreter.
+func (s *Script) call(timeout time.Duration, hook, region string, args func(L *lua.LState) []lua.LValue) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	fn, ok := s.L.GetGlobal(hook).(*lua.LFunction)
+	if !ok {
+		return
+	}
+	s.hook, s.region, s.raised = hook, region, make(map[string]bool)
+	defer func() { s.hook, s.region, s.raised = "", "", nil }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	s.L.SetContext(ctx)
+	start := time.Now()
+	err := s.L.CallByParam(lua.P{Fn: fn, NRet: 0, Protect: true}, args(s.L)...)
+	s.L.RemoveContext()
+	s.L.SetTop(0)
+
+	now := time.Now().UTC()
+	s.status.Calls++
+	s.status.LastCall = &now
+	s.status.LastMs = float64(time.Since(start).Microseconds()) / 1000
+	if err != nil {
+		s.status.Errors++
+		s.status.LastError = err.Error()
+		if time.Since(s.logged) >= scriptErrorLogEvery {
+			s.logged = time.Now()
+			alertLog.Warn("Script hook failed", "script", s.Name, "hook", hook, "region", region, "errors", s.status.Errors, "err", err)
+		}
+	}
+
+	// Alerts from aircraft updates are conditions: they hold while the
+	// script keeps raising them and resolve when it stops. A failed call
+	// leaves them as they were.
+	if hook == hookAircraftUpdate && err == nil {
+		for key := range s.held[region] {
+			if !s.raised[key] {
+				alertMgr.Resolve(key)
+			}
+		}
+		s.held[region] = s.raised
+	}
+}
+
+// each runs fn on a snapshot of the loaded scripts.
+func (h *ScriptHost) each(fn func(s *Script)) {
+	if h == nil {
+		return
+	}
+	h.mu.RLock()
+	list := h.scripts
+	h.mu.RUnlock()
+	for _, s := range list {
+		fn(s)
+	}
+}
+
+// AircraftUpdate calls on_aircraft_update(region, aircraft) with a region's
+// new picture.
+func (h *ScriptHost) AircraftUpdate(region string, aircraft []Aircraft) {
+	if h == nil {
+		return
+	}
+	list := jsonValue(aircraft)
+	h.each(func(s *Script) {
+		s.call(h.timeout, hookAircraftUpdate, region, func(L *lua.LState) []lua.LValue {
+			return []lua.LValue{lua.LString(region), luaValue(L, list)}
+		})
+	})
+}
+
+// ZoneEvents calls on_zone_event(event) for each event.
+func (h *ScriptHost) ZoneEvents(events []ZoneEvent) {
+	if h == nil {
+		return
+	}
+	for _, ev := range events {
+		v := jsonValue(ev)
+		h.each(func(s *Script) {
+			s.call(h.timeout, hookZoneEvent, ev.Region, func(L *lua.LState) []lua.LValue {
+				return []lua.LValue{luaValue(L, v)}
+			})
+		})
+	}
+}
+
+// AnalysisComplete calls on_analysis_complete(region, analysis).
+func (h *ScriptHost) AnalysisComplete(region string, analysis *TacticalAnalysis) {
+	if h == nil {
+		return
+	}
+	v := jsonValue(analysis)
+	h.each(func(s *Script) {
+		s.call(h.timeout, hookAnalysisComplete, region, func(L *lua.LState) []lua.LValue {
+			return []lua.LValue{lua.LString(region), luaValue(L, v)}
+		})
+	})
+}
+
+// Status reports every loaded script.
+func (h *ScriptHost) Status() []ScriptStatus {
+	out := []ScriptStatus{}
+	h.each(func(s *Script) {
+		s.mu.Lock()
+		st := s.status
+		s.mu.Unlock()
+		out = append(out, st)
+	})
+	return out
+}
+
+// jsonValue turns a Go value into plain maps, slices, and scalars with its
+// JSON field names, so scripts see the same shapes as API clients.
+func jsonValue(v interface{}) interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var out interface{}
+	json.Unmarshal(data, &out)
+	return out
+}
+
+// luaValue converts a jsonValue result into Lua.
+func luaValue(L *lua.LState, v interface{}) lua.LValue {
+	switch v := v.(type) {
+	case bool:
+		return lua.LBool(v)
+	case float64:
+		return lua.LNumber(v)
+	case string:
+		return lua.LString(v)
+	case []interface{}:
+		t := L.CreateTable(len(v), 0)
+		for _, e := range v {
+			t.Append(luaValue(L, e))
+		}
+		return t
+	case map[string]interface{}:
+		t := L.CreateTable(0, len(v))
+		for k, e := range v {
+			t.RawSetString(k, luaValue(L, e))
+		}
+		return t
+	}
+	return lua.LNil
+}
+
+// goValue converts a Lua value for an alert payload. Tables with a
+// sequence become arrays, others objects with string keys; functions and
+// other userdata are dropped.
+func goValue(v lua.LValue, depth int) interface{} {
+	switch v := v.(type) {
+	case lua.LBool:
+		return bool(v)
+	case lua.LNumber:
+		return float64(v)
+	case lua.LString:
+		return string(v)
+	case *lua.LTable:
+		if depth >= maxScriptDepth {
+			return nil
+		}
+		if n := v.MaxN(); n > 0 {
+			out := make([]interface{}, 0, n)
+			for i := 1; i <= n; i++ {
+				out = append(out, goValue(v.RawGetInt(i), depth+1))
+			}
+			return out
+		}
+		out := make(map[string]interface{})
+		v.ForEach(func(k, e lua.LValue) {
+			if ks, ok := k.(lua.LString); ok {
+				if g := goValue(e, depth+1); g != nil {
+					out[string(ks)] = g
+				}
+			}
+		})
+		return out
+	}
+	return nil
+}
+
+func scriptStringRep(L *lua.LState) int {
+	str, n := L.CheckString(1), L.CheckInt(2)
+	if n > 0 && len(str)*n > maxScriptString {
+		L.RaiseError("string.rep: result longer than %d bytes", maxScriptString)
+	}
+	L.Push(lua.LString(strings.Repeat(str, max(n, 0))))
+	return 1
+}
+
+func luaDistanceKm(L *lua.LState) int {
+	L.Push(lua.LNumber(greatCircleDistance(float64(L.CheckNumber(1)), float64(L.CheckNumber(2)), float64(L.CheckNumber(3)), float64(L.CheckNumber(4))) / 1000))
+	return 1
+}
+
+// luaLog writes its arguments to the server log: swarm.log(...) and print.
+func (s *Script) luaLog(L *lua.LState) int {
+	parts := make([]string, L.GetTop())
+	for i := range parts {
+		parts[i] = L.ToStringMeta(L.Get(i + 1)).String()
+	}
+	alertLog.Info("Script: "+strings.Join(parts, " "), "script", s.Name, "hook", s.hook, "region", s.region)
+	return 0
+}
+
+// alertKey namespaces a script's key so scripts can't touch each other's
+// alerts or anyone else's.
+func (s *Script) alertKey(region, key string) string {
+	return s.kind + ":" + region + ":" + key
+}
+
+// luaAlert raises an alert and returns its full key.
+//
+//	swarm.alert{key=, title=, severity="MEDIUM", message=, icao24=, callsign=, region=, details={}}
+func (s *Script) luaAlert(L *lua.LState) int {
+	t := L.CheckTable(1)
+	field := func(name string) string { return strings.TrimSpace(lua.LVAsString(t.RawGetString(name))) }
+	key, title := field("key"), field("title")
+	if key == "" || title == "" {
+		L.ArgError(1, "key and title are required")
+	}
+	severity := strings.ToUpper(field("severity"))
+	if severity == "" {
+		severity = "MEDIUM"
+	}
+	if _, ok := threatRank[severity]; !ok {
+		L.ArgError(1, fmt.Sprintf("unknown severity %q", severity))
+	}
+	region := field("region")
+	if region == "" {
+		region = s.region
+	}
+	if _, ok := regions[region]; !ok {
+		L.ArgError(1, fmt.Sprintf("unknown region %q", region))
+	}
+	icao24 := strings.ToLower(field("icao24"))
+	callsign := field("callsign")
+	if callsign == "" && icao24 != "" {
+		callsign = lookupCallsign(icao24)
+	}
+	details, _ := goValue(t.RawGetString("details"), 0).(map[string]interface{})
+
+	full := s.alertKey(region, key)
+	alertMgr.Raise(Alert{
+		Key:      full,
+		Kind:     s.kind,
+		Region:   region,
+		Severity: severity,
+		Title:    title,
+		Message:  field("message"),
+		ICAO24:   icao24,
+		Callsign: callsign,
+		Details:  details,
+	})
+	if region == s.region && s.raised != nil {
+		s.raised[full] = true
+	}
+	L.Push(lua.LString(full))
+	return 1
+}
+
+// luaResolve clears one of the script's alerts: swarm.resolve(key[, region]).
+func (s *Script) luaResolve(L *lua.LState) int {
+	key := L.CheckString(1)
+	region := L.OptString(2, s.region)
+	full := s.alertKey(region, key)
+	alertMgr.Resolve(full)
+	delete(s.held[region], full)
+	return 0
+}
+
+// annotate applies a change on behalf of the script and tells clients.
+func (s *Script) annotate(L *lua.LState, icao24 string, u AnnotationUpdate) int {
+	t, err := annotations.Update(icao24, lookupCallsign(icao24), u, s.kind)
+	if err != nil {
+		L.Push(lua.LFalse)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	broadcastAnnotation(icao24, &t)
+	L.Push(lua.LTrue)
+	return 1
+}
+
+func checkICAO24(L *lua.LState, n int) string {
+	icao24 := strings.ToLower(strings.TrimSpace(L.CheckString(n)))
+	if icao24 == "" {
+		L.ArgError(n, "icao24 is empty")
+	}
+	return icao24
+}
+
+// luaFlag tags a track: swarm.flag(icao24, tag). Flagging a track that
+// already carries the tag changes nothing, so scripts can flag on every
+// update.
+func (s *Script) luaFlag(L *lua.LState) int {
+	icao24, tag := checkICAO24(L, 1), normalizeTag(L.CheckString(2))
+	if tag == "" {
+		L.ArgError(2, "tag is empty")
+	}
+	if t, ok := annotations.Get(icao24); ok && slices.Contains(t.Tags, tag) {
+		L.Push(lua.LTrue)
+		return 1
+	}
+	return s.annotate(L, icao24, AnnotationUpdate{AddTags: []string{tag}})
+}
+
+// luaUnflag removes a tag: swarm.unflag(icao24, tag).
+func (s *Script) luaUnflag(L *lua.LState) int {
+	icao24, tag := checkICAO24(L, 1), normalizeTag(L.CheckString(2))
+	if t, ok := annotations.Get(icao24); !ok || !slices.Contains(t.Tags, tag) {
+		L.Push(lua.LTrue)
+		return 1
+	}
+	return s.annotate(L, icao24, AnnotationUpdate{RemoveTags: []string{tag}})
+}
+
+// luaFlags returns a track's tags: swarm.flags(icao24).
+func (s *Script) luaFlags(L *lua.LState) int {
+	t, _ := annotations.Get(checkICAO24(L, 1))
+	list := L.CreateTable(len(t.Tags), 0)
+	for _, tag := range t.Tags {
+		list.Append(lua.LString(tag))
+	}
+	L.Push(list)
+	return 1
+}
+
+// luaNote adds a note to a track: swarm.note(icao24, text). A note the
+// script already left as the track's latest is not repeated.
+func (s *Script) luaNote(L *lua.LState) int {
+	icao24, text := checkICAO24(L, 1), strings.TrimSpace(L.CheckString(2))
+	if text == "" {
+		L.ArgError(2, "note is empty")
+	}
+	if t, ok := annotations.Get(icao24); ok && len(t.Notes) > 0 {
+		if last := t.Notes[len(t.Notes)-1]; last.By == s.kind && last.Text == text {
+			L.Push(lua.LTrue)
+			return 1
+		}
+	}
+	return s.annotate(L, icao24, AnnotationUpdate{Note: text})
+}
+
+// luaClassify sets a track's classification: swarm.classify(icao24, class),
+// where "" clears it.
+func (s *Script) luaClassify(L *lua.LState) int {
+	icao24, class := checkICAO24(L, 1), strings.ToLower(strings.TrimSpace(L.CheckString(2)))
+	if annotations.Classification(icao24) == class {
+		L.Push(lua.LTrue)
+		return 1
+	}
+	return s.annotate(L, icao24, AnnotationUpdate{Classification: &class})
+}
+
+// luaClassification returns a track's classification, or nil.
+func (s *Script) luaClassification(L *lua.LState) int {
+	if class := annotations.Classification(checkICAO24(L, 1)); class != "" {
+		L.Push(lua.LString(class))
+	} else {
+		L.Push(lua.LNil)
+	}
+	return 1
+}
+
+// handleScripts reports loaded scripts, or reloads them from SCRIPTS_DIR.
+// GET /api/admin/scripts, POST /api/admin/scripts/reload
+func handleScripts(w http.ResponseWriter, r *http.Request) {
+	if scriptHost == nil {
+		http.Error(w, "Scripting not configured (set SCRIPTS_DIR)", http.StatusServiceUnavailable)
+		return
+	}
+	switch strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/admin/scripts"), "/") {
+	case "":
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+	case "reload":
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := scriptHost.Reload(); err != nil {
+			requestLog(alertLog, r).Warn("Script reload failed", "err", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		names := []string{}
+		for _, st := range scriptHost.Status() {
+			names = append(names, st.Name)
+		}
+		auditLog.Record(r, "scripts.reload", map[string]interface{}{"scripts": names})
+		requestLog(alertLog, r).Info("Scripts reloaded", "scripts", len(names))
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	scriptHost.mu.RLock()
+	loadedAt := scriptHost.loadedAt
+	scriptHost.mu.RUnlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"dir":      scriptHost.dir,
+		"timeout":  scriptHost.timeout.String(),
+		"loadedAt": loadedAt,
+		"scripts":  scriptHost.Status(),
+	})
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// getSecret returns the current value of a secret such as ANTHROPIC_API_KEY,
+// or "" if it is unset. Secrets can come from three places, checked in order:
+//
+//  1. HashiCorp Vault, when VAULT_ADDR and VAULT_SECRET_PATH are set. Keys in
+//     the secret are named like the environment variables they replace.
+//  2. A file named by NAME_FILE, e.g. ANTHROPIC_API_KEY_FILE=/run/secrets/anthropic
+//     (Docker and Kubernetes secrets). Read on every use.
+//  3. The NAME environment variable itself.
+//
+// Values read on every use (ANTHROPIC_API_KEY) pick up rotations without a
+// restart; the rest are read once at startup.
+func getSecret(name string) string {
+	if v, ok := vault.get(name); ok {
+		return v
+	}
+	if path := os.Getenv(name + "_FILE"); path != "" && !ownFileFormat[name] {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			authLog.Warn("Secret file unreadable", "variable", name+"_FILE", "err", err)
+			return ""
+		}
+		return strings.TrimRight(string(data), "\r\n")
+	}
+	return os.Getenv(name)
+}
+
+// ownFileFormat lists secrets whose NAME_FILE variable predates this
+// convention and holds a different format, read by its own loader.
+var ownFileFormat = map[string]bool{
+	"API_KEYS": true, // API_KEYS_FILE is a JSON array
+}
+
+// vaultSource polls a KV secret (v1 or v2) and caches its string values.
+type vaultSource struct {
+	addr, path string
+	client     *http.Client
+
+	mu     sync.RWMutex
+	values map[string]string
+}
+
+var vault *vaultSource
+
+func (v *vaultSource) get(name string) (string, bool) {
+	if v == nil {
+		return "", false
+	}
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	val, ok := v.values[name]
+	return val, ok
+}
+
+// loadSecretsFromEnv connects to Vault if configured and starts refreshing.
+//
+//	VAULT_ADDR         — e.g. https://vault.internal:8200
+//	VAULT_TOKEN        — or VAULT_TOKEN_FILE; re-read on every refresh so an agent can rotate it
+//	VAULT_SECRET_PATH  — API path under /v1, e.g. secret/data/swarm-c2 (KV v2) or kv/swarm-c2 (KV v1)
+//	VAULT_REFRESH      — how often to re-read the secret (default 5m)
+func loadSecretsFromEnv() error {
+	addr, path := os.Getenv("VAULT_ADDR"), os.Getenv("VAULT_SECRET_PATH")
+	if addr == "" && path == "" {
+		return nil
+	}
+	if addr == "" || path == "" {
+		return fmt.Errorf("VAULT_ADDR and VAULT_SECRET_PATH must be set together")
+	}
+	refresh := 5 * time.Minute
+	if s := os.Getenv("VAULT_REFRESH"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("VAULT_REFRESH: invalid duration %q", s)
+		}
+		refresh = d
+	}
+
+	v := &vaultSource{
+		addr:   strings.TrimRight(addr, "/"),
+		path:   strings.Trim(path, "/"),
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+	if err := v.refresh(); err != nil {
+		return fmt.Errorf("vault: %w", err)
+	}
+	vault = v
+	authLog.Info("Secrets from Vault", "addr", v.addr, "path", v.path, "keys", len(v.values), "refresh", refresh.String())
+
+	go func() {
+		for range time.Tick(refresh) {
+			if err := v.refresh(); err != nil {
+				authLog.Warn("Vault refresh failed, keeping previous secrets", "err", err)
+			}
+		}
+	}()
+	return nil
+}
+
+func (v *vaultSource) refresh() error {
+	token := os.Getenv("VAULT_TOKEN")
+	if path := os.Getenv("VAULT_TOKEN_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("read VAULT_TOKEN_FILE: %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+
+	req, err := http.NewRequest(http.MethodGet, v.addr+"/v1/"+v.path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", v.path, resp.Status)
+	}
+
+	// KV v2 nests the values in data.data alongside data.metadata; KV v1
+	// returns them directly in data.
+	var body struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	fields := body.Data
+	if nested, ok := fields["data"]; ok {
+		if _, hasMeta := fields["metadata"]; hasMeta {
+			fields = nil
+			if err := json.Unmarshal(nested, &fields); err != nil {
+				return fmt.Errorf("decode KV v2 data: %w", err)
+			}
+		}
+	}
+	values := make(map[string]string, len(fields))
+	for k, raw := range fields {
+		var s string
+		if json.Unmarshal(raw, &s) == nil {
+			values[k] = s
+		}
+	}
+
+	v.mu.Lock()
+	changed := v.values != nil && !maps.Equal(v.values, values)
+	v.values = values
+	v.mu.Unlock()
+	if changed {
+		authLog.Info("Secrets rotated from Vault")
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Self-test outcomes
+const (
+	SelfTestPass = "pass"
+	SelfTestFail = "fail"
+	SelfTestSkip = "skip"
+)
+
+// SelfTestCheck is one dependency exercised by POST /api/admin/selftest.
+type SelfTestCheck struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latencyMs"`
+	Detail    string  `json:"detail"`
+}
+
+// selfTest is one named check. It returns a detail message, or an error
+// for a failure.
+type selfTest struct {
+	name string
+	run  func(ctx context.Context) (string, error)
+}
+
+// skipped is returned by checks whose dependency isn't configured.
+type skipped string
+
+func (s skipped) Error() string { return string(s) }
+
+// runSelfTests runs the checks in parallel and returns them sorted by name.
+func runSelfTests(ctx context.Context, tests []selfTest) []SelfTestCheck {
+	results := make([]SelfTestCheck, len(tests))
+	var wg sync.WaitGroup
+	for i, t := range tests {
+		wg.Add(1)
+		go func(i int, t selfTest) {
+			defer wg.Done()
+			defer recoverPanic("selftest:" + t.name)
+			results[i] = SelfTestCheck{Name: t.name, Status: SelfTestFail, Detail: "panicked"}
+			start := time.Now()
+			detail, err := t.run(ctx)
+			results[i].LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+			switch err.(type) {
+			case nil:
+				results[i].Status, results[i].Detail = SelfTestPass, detail
+			case skipped:
+				results[i].Status, results[i].Detail = SelfTestSkip, err.Error()
+			default:
+				results[i].Detail = err.Error()
+			}
+		}(i, t)
+	}
+	wg.Wait()
+	sort.Slice(results, func(i, j int) bool { return results[i].Name < results[j].Name })
+	return results
+}
+
+// selfTestOpenSky gets a token (with OAuth2 credentials) and fetches a
+// tiny box of state vectors.
+func selfTestOpenSky(ctx context.Context) (string, error) {
+	if openSky == nil {
+		return "", skipped("not configured, aircraft are simulated")
+	}
+	n, err := openSky.Probe(ctx, "socal")
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s auth, %d aircraft in a test box", openSky.Auth(), n), nil
+}
+
+// selfTestAnthropic sends a one-token message with the configured key.
+func selfTestAnthropic(ctx context.Context) (_ string, err error) {
+	apiKey := getSecret("ANTHROPIC_API_KEY")
+	if apiKey == "" {
+		return "", skipped("ANTHROPIC_API_KEY not set, analysis disabled")
+	}
+	body, _ := json.Marshal(AnthropicRequest{
+		Model:     anthropicModel,
+		MaxTokens: 1,
+		Messages:  []AnthropicMessage{{Role: "user", Content: "ping"}},
+	})
+	ctx, span := startSpan(ctx, "anthropic.messages", SpanClient, "model", anthropicModel, "max_tokens", 1)
+	defer func() { span.End(err) }()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, anthropicMessagesURL, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", apiKey)
+	req.Header.Set("anthropic-version", "2023-06-01")
+	resp, err := (&http.Client{Timeout: 30 * time.Second}).Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	noteAnthropicStatus(resp.StatusCode)
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return anthropicModel + " answered", nil
+}
+
+// selfTestStorage writes, reads back, and removes a file in DATA_DIR.
+func selfTestStorage(ctx context.Context) (string, error) {
+	want := make([]byte, 32)
+	rand.Read(want)
+	path := filepath.Join(storageDir, ".selftest-"+hex.EncodeToString(want[:4]))
+	if err := os.WriteFile(path, want, 0o600); err != nil {
+		return "", err
+	}
+	got, err := os.ReadFile(path)
+	os.Remove(path)
+	if err != nil {
+		return "", err
+	}
+	if !bytes.Equal(got, want) {
+		return "", fmt.Errorf("read back %d bytes that differ from what was written", len(got))
+	}
+	return storageDir + " read/write ok", nil
+}
+
+// selfTestNotifier sends a LOW test alert through one notifier, and
+// resolves it right away so incident tools close what they opened.
+func selfTestNotifier(n AlertNotifier) selfTest {
+	return selfTest{name: "notifier:" + n.Name(), run: func(context.Context) (string, error) {
+		now := time.Now().UTC()
+		alert := &Alert{
+			ID:        "selftest-" + now.Format("20060102T150405"),
+			Key:       "selftest",
+			Kind:      "selftest",
+			Severity:  "LOW",
+			Title:     "Swarm C2 self-test",
+			Message:   "Test message from POST /api/admin/selftest. No action needed.",
+			Status:    AlertStatusActive,
+			FirstSeen: now,
+			LastSeen:  now,
+			Count:     1,
+		}
+		if err := n.Notify(AlertOpened, alert); err != nil {
+			return "", err
+		}
+		alert.Status, alert.ResolvedAt = AlertStatusResolved, &now
+		if err := n.Notify(AlertResolved, alert); err != nil {
+			return "", fmt.Errorf("sent, but resolving failed: %w", err)
+		}
+		return "test alert sent and resolved", nil
+	}}
+}
+
+// handleSelfTest serves POST /api/admin/selftest. Notifiers are only
+// exercised when named in ?notify= (or "all"), since a test page is real
+// noise for whoever is on call; the others are listed as skipped.
+func handleSelfTest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	notify := splitList(r.URL.Query().Get("notify"))
+	known := make(map[string]bool)
+	for _, n := range alertNotifiers {
+		known[n.Name()] = true
+	}
+	sendTo := make(map[string]bool)
+	for _, name := range notify {
+		if name != "all" && !known[name] {
+			http.Error(w, "Unknown notifier: "+name, http.StatusBadRequest)
+			return
+		}
+		sendTo[name] = true
+	}
+
+	tests := []selfTest{
+		{name: "opensky", run: selfTestOpenSky},
+		{name: "anthropic", run: selfTestAnthropic},
+		{name: "storage", run: selfTestStorage},
+	}
+	for _, n := range alertNotifiers {
+		if sendTo["all"] || sendTo[n.Name()] {
+			tests = append(tests, selfTestNotifier(n))
+			continue
+		}
+		hint := skipped("configured; add ?notify=" + n.Name() + " to send a test alert")
+		tests = append(tests, selfTest{name: "notifier:" + n.Name(), run: func(context.Context) (string, error) { return "", hint }})
+	}
+
+	auditLog.Record(r, "selftest.run", map[string]interface{}{"notify": notify})
+	checks := runSelfTests(r.Context(), tests)
+	passed := true
+	for _, c := range checks {
+		passed = passed && c.Status != SelfTestFail
+	}
+	requestLog(serverLog, r).Info("Self-test finished", "passed", passed)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"passed":    passed,
+		"timestamp": time.Now().Unix(),
+		"checks":    checks,
+	})
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Session is one login: it starts with a password login, survives refresh
+// token rotation, and ends on logout, revocation, a password change, or when
+// its refresh token expires. Access tokens carry the session ID, so ending a
+// session cuts off its access tokens and WebSockets immediately.
+type Session struct {
+	ID         string    `json:"id"`
+	Username   string    `json:"username"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastSeen   time.Time `json:"lastSeen"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	RemoteAddr string    `json:"remoteAddr,omitempty"`
+	UserAgent  string    `json:"userAgent,omitempty"`
+	Current    bool      `json:"current,omitempty"` // set in responses only
+}
+
+var errSessionNotFound = errors.New("session not found")
+
+// StartSession records a new login from r.
+func (s *UserStore) StartSession(username string, r *http.Request) (Session, error) {
+	raw := make([]byte, 12)
+	if _, err := rand.Read(raw); err != nil {
+		return Session{}, err
+	}
+	now := time.Now().UTC()
+	sess := &Session{
+		ID:         hex.EncodeToString(raw),
+		Username:   username,
+		CreatedAt:  now,
+		LastSeen:   now,
+		ExpiresAt:  now.Add(refreshTokenTTL),
+		RemoteAddr: clientIP(r),
+		UserAgent:  r.UserAgent(),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[sess.ID] = sess
+	return *sess, s.saveLocked()
+}
+
+// SessionActive reports whether a session has not ended.
+func (s *UserStore) SessionActive(id string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sess, ok := s.sessions[id]
+	return ok && time.Now().Before(sess.ExpiresAt)
+}
+
+// Sessions lists live sessions, newest first. An empty username lists
+// everyone's.
+func (s *UserStore) Sessions(username string) []Session {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	now := time.Now()
+	list := []Session{}
+	for _, sess := range s.sessions {
+		if (username == "" || sess.Username == username) && now.Before(sess.ExpiresAt) {
+			list = append(list, *sess)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	return list
+}
+
+// RevokeSession ends a session. Unless owner is empty, the session must
+// belong to owner.
+func (s *UserStore) RevokeSession(id, owner string) (Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.sessions[id]
+	if !ok || (owner != "" && sess.Username != owner) {
+		return Session{}, errSessionNotFound
+	}
+	s.endSessionLocked(id)
+	return *sess, s.saveLocked()
+}
+
+func (s *UserStore) endSessionLocked(id string) {
+	delete(s.sessions, id)
+	for k, t := range s.refresh {
+		if t.SessionID == id {
+			delete(s.refresh, k)
+		}
+	}
+}
+
+// expireSessionsLocked drops sessions whose refresh token has run out.
+func (s *UserStore) expireSessionsLocked(now time.Time) {
+	for id, sess := range s.sessions {
+		if !now.Before(sess.ExpiresAt) {
+			delete(s.sessions, id)
+		}
+	}
+}
+
+// extendSessionLocked moves a session's expiry along with its newest
+// refresh token.
+func (s *UserStore) extendSessionLocked(id string, until time.Time) {
+	if sess, ok := s.sessions[id]; ok {
+		sess.ExpiresAt = until
+	}
+}
+
+// stillAuthorized re-checks a principal for long-lived connections: the
+// account must still exist and be enabled, and its session must not have
+// ended.
+func stillAuthorized(p *Principal) bool {
+	if p == nil || p.Kind != "user" {
+		return true
+	}
+	u, ok := userStore.Get(p.Name)
+	if !ok || u.Disabled {
+		return false
+	}
+	return p.SessionID == "" || userStore.SessionActive(p.SessionID)
+}
+
+// handleSessions lists sessions.
+//
+//	GET /api/sessions             — the caller's own sessions, with the current one flagged
+//	GET /api/sessions?user=name   — another user's sessions (admin); user=* lists everyone's
+//
+// Admins inside a workspace only see their own sessions: accounts aren't
+// scoped to workspaces, so other users' are left to server operators.
+func handleSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	p := principalFrom(r)
+	username := ""
+	if p != nil && p.Kind == "user" {
+		username = p.Name
+	}
+	if u := r.URL.Query().Get("user"); u != "" && u != username {
+		if p != nil && (!p.hasRole(RoleAdmin) || p.Workspace != "") {
+			http.Error(w, "Forbidden: requires admin role outside any workspace", http.StatusForbidden)
+			return
+		}
+		username = u
+		if u == "*" {
+			username = ""
+		}
+	} else if username == "" && p != nil {
+		// API keys and certificates have no sessions of their own
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]Session{})
+		return
+	}
+
+	list := userStore.Sessions(username)
+	if p != nil {
+		for i := range list {
+			list[i].Current = list[i].ID == p.SessionID
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// handleSessionAction revokes a session. Users may revoke their own; admins
+// outside any workspace may revoke anyone's.
+// DELETE /api/sessions/{id}
+func handleSessionAction(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/sessions/"), "/")
+	if id == "" || strings.Contains(id, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	owner := ""
+	if p := principalFrom(r); p != nil && (!p.hasRole(RoleAdmin) || p.Workspace != "") {
+		owner = p.Name
+	}
+	sess, err := userStore.RevokeSession(id, owner)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	auditLog.Record(r, "session.revoke", map[string]interface{}{"session": sess.ID, "username": sess.Username})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// WebSocket close codes in the private range, so the web UI can tell why it
+// was disconnected.
+const (
+	wsCloseIdle         = 4000 // no client activity within WS_IDLE_TIMEOUT
+	wsCloseSessionEnded = 4001 // session revoked or account disabled
+)
+
+// wsIdleTimeout closes WebSockets that send nothing for this long. Pongs
+// don't count: the web UI reports operator activity explicitly.
+var wsIdleTimeout = 30 * time.Minute
+
+// loadWebSocketConfigFromEnv reads WS_IDLE_TIMEOUT (default 30m; 0 disables).
+func loadWebSocketConfigFromEnv() error {
+	if v := os.Getenv("WS_IDLE_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return fmt.Errorf("WS_IDLE_TIMEOUT: invalid duration %q", v)
+		}
+		wsIdleTimeout = d
+	}
+	return nil
+}
+
+// wsClient is a dashboard WebSocket connection. gorilla/websocket allows one
+// writer at a time, and broadcasts, heartbeats, and replies to the client's
+// own requests all come from different goroutines, so every write goes
+// through send.
+type wsClient struct {
+	conn *websocket.Conn
+	mu   sync.Mutex
+}
+
+func (c *wsClient) send(v interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	return c.conn.WriteJSON(v)
+}
+
+// touchWebSocket pushes back the idle deadline; call before every read.
+func touchWebSocket(conn *websocket.Conn) {
+	if wsIdleTimeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(wsIdleTimeout))
+	}
+}
+
+// closeIfIdle tells the client why its connection is ending when a read
+// failed because of the idle deadline.
+func closeIfIdle(conn *websocket.Conn, err error) {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		closeWebSocket(conn, wsCloseIdle, "idle timeout")
+	}
+}
+
+func closeWebSocket(conn *websocket.Conn, code int, reason string) {
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+	conn.Close()
+}
+
+// watchWebSocketSession closes conn once the principal that opened it is no
+// longer authorized. Call the returned function when the connection ends.
+func watchWebSocketSession(conn *websocket.Conn, r *http.Request) (stop func()) {
+	p := principalFrom(r)
+	done := make(chan struct{})
+	if p == nil || p.Kind != "user" {
+		return func() { close(done) }
+	}
+	go func() {
+		ticker := time.NewTicker(15 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if !stillAuthorized(p) {
+					requestLog(wsLog, r).Info("Closing WebSocket: session ended", "user", p.Name)
+					closeWebSocket(conn, wsCloseSessionEnded, "session ended")
+					return
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var (
+	// stopping is closed when shutdown begins; pollers select on it.
+	stopping = make(chan struct{})
+
+	// pollers tracks background loops that must finish before persistence
+	// is flushed.
+	pollers sync.WaitGroup
+
+	// shutdownDone is closed once shutdown has finished, so main can exit.
+	shutdownDone = make(chan struct{})
+
+	httpServersMu sync.Mutex
+	httpServers   []*http.Server
+
+	// shutdownTimeout bounds draining requests and waiting for pollers.
+	shutdownTimeout = 15 * time.Second
+)
+
+// loadShutdownConfigFromEnv reads SHUTDOWN_TIMEOUT (default 15s).
+func loadShutdownConfigFromEnv() error {
+	if v := os.Getenv("SHUTDOWN_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("SHUTDOWN_TIMEOUT: invalid duration %q", v)
+		}
+		shutdownTimeout = d
+	}
+	return nil
+}
+
+// trackServer registers srv to be drained on shutdown and returns it. Its
+// error log (TLS handshake failures and the like) goes to slog as warnings.
+func trackServer(srv *http.Server) *http.Server {
+	if srv.ErrorLog == nil {
+		srv.ErrorLog = slog.NewLogLogger(serverLog.Handler(), slog.LevelWarn)
+	}
+	httpServersMu.Lock()
+	defer httpServersMu.Unlock()
+	httpServers = append(httpServers, srv)
+	return srv
+}
+
+// goPoller runs fn in a goroutine that shutdown waits for, restarting it
+// after a panic. fn should return once stopping is closed.
+func goPoller(name string, fn func()) {
+	pollers.Add(1)
+	go func() {
+		defer pollers.Done()
+		supervise(name, fn)
+	}()
+}
+
+// handleShutdownSignals shuts down gracefully on SIGTERM or SIGINT. A second
+// signal exits immediately. It blocks, so run it in a goroutine.
+func handleShutdownSignals() {
+	sig := make(chan os.Signal, 2)
+	signal.Notify(sig, syscall.SIGTERM, syscall.SIGINT)
+	s := <-sig
+	go func() {
+		<-sig
+		serverLog.Warn("Second signal, exiting without draining")
+		os.Exit(1)
+	}()
+	shutdown(s.String())
+}
+
+// shutdown stops pollers, tells WebSocket clients the server is restarting,
+// drains in-flight requests, and flushes persistence, all within
+// shutdownTimeout.
+func shutdown(reason string) {
+	serverLog.Info("Shutting down", "reason", reason, "timeout", shutdownTimeout.String())
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	close(stopping)
+	if droneSim != nil {
+		droneSim.Stop()
+	}
+	closeAllWebSockets(websocket.CloseServiceRestart, "server restarting")
+
+	httpServersMu.Lock()
+	servers := httpServers
+	httpServersMu.Unlock()
+	var wg sync.WaitGroup
+	for _, srv := range servers {
+		wg.Add(1)
+		go func(srv *http.Server) {
+			defer wg.Done()
+			if err := srv.Shutdown(ctx); err != nil {
+				serverLog.Warn("Server shutdown incomplete", "addr", srv.Addr, "err", err)
+			}
+		}(srv)
+	}
+	wg.Wait()
+
+	finished := make(chan struct{})
+	go func() {
+		pollers.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-ctx.Done():
+		serverLog.Warn("Pollers still running at the shutdown deadline")
+	}
+
+	positionHistory.Close()
+	analysisHistory.Close()
+	alertStore.Close()
+	auditLog.Close()
+	serverLog.Info("Shutdown complete")
+	close(shutdownDone)
+}
+
+// closeAllWebSockets sends a close frame to every WebSocket client. Shutting
+// down the HTTP server doesn't touch hijacked connections.
+func closeAllWebSockets(code int, reason string) {
+	clientsMutex.RLock()
+	conns := make([]*websocket.Conn, 0, len(clients))
+	for conn := range clients {
+		conns = append(conns, conn.conn)
+	}
+	clientsMutex.RUnlock()
+	droneClientsMutex.RLock()
+	for conn := range droneClients {
+		conns = append(conns, conn.conn)
+	}
+	droneClientsMutex.RUnlock()
+	conns = append(conns, tasking.conns()...)
+
+	for _, conn := range conns {
+		closeWebSocket(conn, code, reason)
+	}
+	if len(conns) > 0 {
+		wsLog.Info("Closed WebSocket connections", "count", len(conns))
+	}
+}
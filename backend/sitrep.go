@@ -0,0 +1,366 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"swarm-c2/pdf"
+)
+
+// sitrep is a TacticalAnalysis flattened into the rows and fields of a
+// situation report, shared by the Markdown, HTML, and PDF renderers.
+type sitrep struct {
+	Region          string
+	RegionName      string
+	Issued          time.Time
+	ThreatLevel     string
+	ThreatScore     int
+	SmoothedScore   float64
+	Summary         string
+	Observations    [][]string // type, description, aircraft, contribution
+	Aircraft        [][]string // callsign, icao24, threat, reason, action
+	Recommendations [][]string // priority, action, rationale
+	Patterns        [][]string // label, value
+	NextUpdate      string
+	Snapshot        template.URL // air picture as a data: URL; HTML only, and only for current reports
+}
+
+var (
+	sitrepObservationColumns    = []string{"Type", "Description", "Aircraft", "Contribution"}
+	sitrepAircraftColumns       = []string{"Callsign", "ICAO24", "Threat", "Reason", "Action"}
+	sitrepRecommendationColumns = []string{"Priority", "Action", "Rationale"}
+)
+
+func newSitrep(region string, issued time.Time, a *TacticalAnalysis) sitrep {
+	s := sitrep{
+		Region:        region,
+		RegionName:    region,
+		Issued:        issued.UTC(),
+		ThreatLevel:   a.OverallThreatLevel,
+		ThreatScore:   a.ThreatScore,
+		SmoothedScore: a.SmoothedThreatScore,
+		Summary:       a.Summary,
+		NextUpdate:    a.NextUpdatePriority,
+	}
+	if r, ok := regions[region]; ok {
+		s.RegionName = r.Name
+	}
+
+	for _, o := range a.KeyObservations {
+		s.Observations = append(s.Observations, []string{
+			sitrepField(o, "type"), sitrepField(o, "description"),
+			sitrepField(o, "aircraft_involved"), sitrepField(o, "threat_contribution"),
+		})
+	}
+	for _, ac := range a.AircraftOfInterest {
+		s.Aircraft = append(s.Aircraft, []string{
+			sitrepField(ac, "callsign"), sitrepField(ac, "icao24"), sitrepField(ac, "threat_level"),
+			sitrepField(ac, "reason"), sitrepField(ac, "recommended_action"),
+		})
+	}
+
+	recs := append([]map[string]interface{}(nil), a.TacticalRecommendations...)
+	sort.SliceStable(recs, func(i, j int) bool {
+		return sitrepPriority(recs[i]) < sitrepPriority(recs[j])
+	})
+	for _, rec := range recs {
+		s.Recommendations = append(s.Recommendations, []string{
+			sitrepField(rec, "priority"), sitrepField(rec, "action"), sitrepField(rec, "rationale"),
+		})
+	}
+
+	keys := make([]string, 0, len(a.PatternAnalysis))
+	for k := range a.PatternAnalysis {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		label := strings.ReplaceAll(k, "_", " ")
+		s.Patterns = append(s.Patterns, []string{strings.ToUpper(label[:1]) + label[1:], sitrepField(a.PatternAnalysis, k)})
+	}
+	return s
+}
+
+// sitrepField formats a value from the model's loosely typed JSON.
+func sitrepField(m map[string]interface{}, key string) string {
+	switch v := m[key].(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []interface{}:
+		parts := make([]string, 0, len(v))
+		for _, item := range v {
+			parts = append(parts, fmt.Sprint(item))
+		}
+		return strings.Join(parts, ", ")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// sitrepPriority orders recommendations; missing priorities go last.
+func sitrepPriority(m map[string]interface{}) float64 {
+	if p, ok := m["priority"].(float64); ok {
+		return p
+	}
+	return 99
+}
+
+// DTG is the military date-time group, e.g. 161230ZOCT26.
+func (s sitrep) DTG() string {
+	return strings.ToUpper(s.Issued.Format("021504ZJan06"))
+}
+
+func (s sitrep) Title() string {
+	return fmt.Sprintf("SITREP — %s", s.RegionName)
+}
+
+func (s sitrep) filename(ext string) string {
+	return fmt.Sprintf("sitrep-%s-%s.%s", s.Region, s.Issued.Format("20060102T1504Z"), ext)
+}
+
+func (s sitrep) Markdown() []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", s.Title())
+	fmt.Fprintf(&b, "**DTG:** %s (%s)  \n", s.DTG(), s.Issued.Format(time.RFC3339))
+	fmt.Fprintf(&b, "**Region:** %s (`%s`)  \n", s.RegionName, s.Region)
+	fmt.Fprintf(&b, "**Threat level:** %s — score %d/100 (smoothed %.0f)\n\n", s.ThreatLevel, s.ThreatScore, s.SmoothedScore)
+
+	b.WriteString("## 1. Situation\n\n")
+	b.WriteString(s.Summary + "\n\n")
+
+	mdTable := func(heading string, columns []string, rows [][]string) {
+		fmt.Fprintf(&b, "## %s\n\n", heading)
+		if len(rows) == 0 {
+			b.WriteString("None.\n\n")
+			return
+		}
+		b.WriteString("| " + strings.Join(columns, " | ") + " |\n")
+		b.WriteString("|" + strings.Repeat("---|", len(columns)) + "\n")
+		for _, row := range rows {
+			cells := make([]string, len(row))
+			for i, c := range row {
+				cells[i] = strings.NewReplacer("|", "\\|", "\n", " ").Replace(c)
+			}
+			b.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+		}
+		b.WriteString("\n")
+	}
+	mdTable("2. Key Observations", sitrepObservationColumns, s.Observations)
+	mdTable("3. Aircraft of Interest", sitrepAircraftColumns, s.Aircraft)
+
+	b.WriteString("## 4. Pattern Analysis\n\n")
+	if len(s.Patterns) == 0 {
+		b.WriteString("None.\n\n")
+	} else {
+		for _, p := range s.Patterns {
+			fmt.Fprintf(&b, "- **%s:** %s\n", p[0], p[1])
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString("## 5. Recommendations\n\n")
+	if len(s.Recommendations) == 0 {
+		b.WriteString("None.\n\n")
+	} else {
+		for i, rec := range s.Recommendations {
+			fmt.Fprintf(&b, "%d. **%s** (priority %s) — %s\n", i+1, rec[1], rec[0], rec[2])
+		}
+		b.WriteString("\n")
+	}
+
+	fmt.Fprintf(&b, "Next update priority: **%s**\n", s.NextUpdate)
+	return []byte(b.String())
+}
+
+// reportCSS styles the HTML reports, inline so they need nothing external.
+const reportCSS = `body { font-family: Helvetica, Arial, sans-serif; font-size: 14px; color: #222; max-width: 900px; margin: 24px auto; padding: 0 16px; }
+h1 { font-size: 22px; margin-bottom: 4px; }
+h2 { font-size: 16px; border-bottom: 1px solid #999; padding-bottom: 3px; margin-top: 24px; }
+.meta { color: #555; margin: 0 0 12px; }
+.banner { color: #fff; font-weight: bold; padding: 8px 12px; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border: 1px solid #ccc; padding: 4px 6px; text-align: left; vertical-align: top; }
+th { background: #e0e0e0; }
+`
+
+// sitrepHTML is self-contained (inline CSS, no scripts or external assets) so
+// it survives being pasted into or attached to an email.
+var sitrepHTML = template.Must(template.New("sitrep").Funcs(template.FuncMap{
+	"rows": func(columns []string, rows [][]string) map[string]interface{} {
+		return map[string]interface{}{"Columns": columns, "Rows": rows}
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.S.Title}} {{.S.DTG}}</title>
+<style>
+` + reportCSS + `</style>
+</head>
+<body>
+<h1>{{.S.Title}}</h1>
+<p class="meta">DTG {{.S.DTG}} &middot; {{.S.Issued.Format "2006-01-02 15:04 UTC"}} &middot; Region {{.S.RegionName}} ({{.S.Region}})</p>
+<div class="banner" style="background: {{.Color}}">THREAT LEVEL: {{.S.ThreatLevel}} &mdash; SCORE {{.S.ThreatScore}}/100 (SMOOTHED {{printf "%.0f" .S.SmoothedScore}})</div>
+{{if .S.Snapshot}}<p><img src="{{.S.Snapshot}}" alt="Air picture" style="width: 100%"></p>{{end}}
+
+<h2>1. Situation</h2>
+<p>{{.S.Summary}}</p>
+
+<h2>2. Key Observations</h2>
+{{template "table" (rows .ObservationColumns .S.Observations)}}
+
+<h2>3. Aircraft of Interest</h2>
+{{template "table" (rows .AircraftColumns .S.Aircraft)}}
+
+<h2>4. Pattern Analysis</h2>
+{{if .S.Patterns}}<ul>{{range .S.Patterns}}<li><b>{{index . 0}}:</b> {{index . 1}}</li>{{end}}</ul>{{else}}<p>None.</p>{{end}}
+
+<h2>5. Recommendations</h2>
+{{if .S.Recommendations}}<ol>{{range .S.Recommendations}}<li><b>{{index . 1}}</b> (priority {{index . 0}}) &mdash; {{index . 2}}</li>{{end}}</ol>{{else}}<p>None.</p>{{end}}
+
+<p>Next update priority: <b>{{.S.NextUpdate}}</b></p>
+</body>
+</html>
+{{define "table"}}{{if .Rows}}<table>
+<tr>{{range .Columns}}<th>{{.}}</th>{{end}}</tr>
+{{range .Rows}}<tr>{{range .}}<td>{{.}}</td>{{end}}</tr>
+{{end}}</table>{{else}}<p>None.</p>{{end}}{{end}}`))
+
+func (s sitrep) HTML() ([]byte, error) {
+	var b strings.Builder
+	err := sitrepHTML.Execute(&b, map[string]interface{}{
+		"S":                  s,
+		"Color":              template.CSS(sitrepColor(s.ThreatLevel)),
+		"ObservationColumns": sitrepObservationColumns,
+		"AircraftColumns":    sitrepAircraftColumns,
+	})
+	return []byte(b.String()), err
+}
+
+func (s sitrep) PDF() []byte {
+	doc := pdf.New()
+	doc.Footer = fmt.Sprintf("SWARM C2 %s %s", s.Title(), s.DTG())
+
+	doc.Title(s.Title())
+	doc.Paragraph(fmt.Sprintf("DTG %s  ·  %s  ·  Region %s (%s)",
+		s.DTG(), s.Issued.Format("2006-01-02 15:04 UTC"), s.RegionName, s.Region), 9, false)
+	doc.Space(6)
+	doc.Banner(fmt.Sprintf("THREAT LEVEL: %s — SCORE %d/100 (SMOOTHED %.0f)",
+		s.ThreatLevel, s.ThreatScore, s.SmoothedScore), pdf.HexColor(sitrepColor(s.ThreatLevel)))
+
+	doc.Heading("1. Situation")
+	doc.Paragraph(s.Summary, 10, false)
+
+	pdfTable := func(heading string, widths []float64, columns []string, rows [][]string) {
+		doc.Heading(heading)
+		if len(rows) == 0 {
+			doc.Paragraph("None.", 10, false)
+			return
+		}
+		doc.Table(widths, columns, rows)
+	}
+	pdfTable("2. Key Observations", []float64{0.14, 0.5, 0.22, 0.14}, sitrepObservationColumns, s.Observations)
+	pdfTable("3. Aircraft of Interest", []float64{0.13, 0.11, 0.12, 0.48, 0.16}, sitrepAircraftColumns, s.Aircraft)
+	pdfTable("4. Pattern Analysis", []float64{0.4, 0.6}, []string{"Indicator", "Value"}, s.Patterns)
+	pdfTable("5. Recommendations", []float64{0.1, 0.4, 0.5}, sitrepRecommendationColumns, s.Recommendations)
+
+	doc.Space(8)
+	doc.Paragraph("Next update priority: "+s.NextUpdate, 10, true)
+	return doc.Bytes()
+}
+
+// sitrepColor reuses the Slack palette so exports match alert notifications.
+func sitrepColor(level string) string {
+	if c, ok := slackColors[level]; ok {
+		return c
+	}
+	return slackColors["NOMINAL"]
+}
+
+// handleAnalysisExport renders the latest analysis for a region, or the one
+// in effect at a past time, as a situation report.
+// GET /api/analysis/export?region=&format=html|pdf|md[&at=]
+func handleAnalysisExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	region := q.Get("region")
+	if region == "" {
+		region = "socal"
+	}
+	format := strings.ToLower(q.Get("format"))
+	if format == "" {
+		format = "html"
+	}
+	if format != "html" && format != "pdf" && format != "md" {
+		http.Error(w, "Unsupported format (use html, pdf, or md)", http.StatusBadRequest)
+		return
+	}
+
+	var report sitrep
+	if v := q.Get("at"); v != "" {
+		at, err := parseTimeParam(v)
+		if err != nil {
+			http.Error(w, "invalid at: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		rec, ok := analysisHistory.At(region, at)
+		if !ok {
+			http.Error(w, "No analysis recorded for region at or before that time", http.StatusNotFound)
+			return
+		}
+		report = newSitrep(region, rec.At, rec.Analysis)
+	} else {
+		analysisCacheMutex.RLock()
+		analysis := analysisCache[region]
+		analysisCacheMutex.RUnlock()
+		if analysis == nil {
+			http.Error(w, "No analysis available for region yet", http.StatusNotFound)
+			return
+		}
+		issued := time.Now()
+		if rec, ok := analysisHistory.At(region, issued); ok && rec.Analysis == analysis {
+			issued = rec.At
+		} else if t, err := time.Parse(time.RFC3339, analysis.Timestamp); err == nil {
+			issued = t
+		}
+		report = newSitrep(region, issued, analysis)
+		if format == "html" {
+			if img, err := renderSnapshot(region, 900); err == nil {
+				report.Snapshot = pngDataURL(img)
+			}
+		}
+	}
+
+	switch format {
+	case "md":
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", report.filename("md")))
+		w.Write(report.Markdown())
+	case "pdf":
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", report.filename("pdf")))
+		w.Write(report.PDF())
+	default:
+		body, err := report.HTML()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", report.filename("html")))
+		w.Write(body)
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"image"
+	"image/color"
+	_ "image/jpeg" // basemap tiles
+	"image/png"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// snapshotBackground fills the image where there is no basemap.
+var snapshotBackground = color.NRGBA{R: 0x0b, G: 0x12, B: 0x20, A: 0xff}
+
+// Aircraft glyph colors, matching the frontend map.
+var (
+	glyphDefault  = color.NRGBA{R: 0x00, G: 0xd4, B: 0xff, A: 0xff}
+	glyphGround   = color.NRGBA{R: 0xff, G: 0x95, B: 0x00, A: 0xff}
+	glyphMilitary = color.NRGBA{R: 0xff, G: 0x3b, B: 0x30, A: 0xff}
+	glyphManual   = color.NRGBA{R: 0xff, G: 0xd6, B: 0x0a, A: 0xff}
+	glyphHalo     = color.NRGBA{A: 0xc0}
+)
+
+// snapshotView maps a region's bounding box onto an image in Web Mercator.
+// x0..x1 and y0..y1 are world coordinates (0..1 across the whole map, y down).
+type snapshotView struct {
+	width, height  int
+	x0, y0, x1, y1 float64
+}
+
+func worldX(lon float64) float64 { return (lon + 180) / 360 }
+func worldY(lat float64) float64 { return (1 - mercatorY(lat)/math.Pi) / 2 }
+
+func newSnapshotView(r Region, width int) snapshotView {
+	v := snapshotView{width: width, x0: worldX(r.MinLon), x1: worldX(r.MaxLon), y0: worldY(r.MaxLat), y1: worldY(r.MinLat)}
+	v.height = max(1, int(math.Round(float64(width)*(v.y1-v.y0)/(v.x1-v.x0))))
+	return v
+}
+
+// point projects a position to pixel coordinates.
+func (v snapshotView) point(lat, lon float64) [2]float64 {
+	return [2]float64{
+		(worldX(lon) - v.x0) / (v.x1 - v.x0) * float64(v.width),
+		(worldY(lat) - v.y0) / (v.y1 - v.y0) * float64(v.height),
+	}
+}
+
+// drawBasemap composites tiles from the tile proxy at the zoom where one
+// output pixel is no larger than one tile pixel. Missing tiles are left as
+// background.
+func (v snapshotView) drawBasemap(img *image.RGBA) {
+	if tileProxy == nil {
+		return
+	}
+	z := int(math.Ceil(math.Log2(float64(v.width) / ((v.x1 - v.x0) * 256))))
+	z = max(0, min(z, tileProxy.maxZoom))
+	n := float64(int(1) << z)
+	tx0, tx1 := int(v.x0*n), min(int(v.x1*n), int(n)-1)
+	ty0, ty1 := int(v.y0*n), min(int(v.y1*n), int(n)-1)
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		tiles   = make(map[[2]int]image.Image)
+		lastErr error
+		sem     = make(chan struct{}, 8)
+	)
+	for tx := tx0; tx <= tx1; tx++ {
+		for ty := ty0; ty <= ty1; ty++ {
+			wg.Add(1)
+			go func(tx, ty int) {
+				defer wg.Done()
+				sem <- struct{}{}
+				defer func() { <-sem }()
+				data, _, err := tileProxy.Tile(z, tx, ty)
+				var im image.Image
+				if err == nil {
+					im, _, err = image.Decode(bytes.NewReader(data))
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					lastErr = err
+					return
+				}
+				tiles[[2]int{tx, ty}] = im
+			}(tx, ty)
+		}
+	}
+	wg.Wait()
+	if lastErr != nil {
+		serverLog.Warn("Snapshot basemap incomplete", "zoom", z, "tiles", len(tiles), "err", lastErr)
+	}
+	for py := 0; py < v.height; py++ {
+		gy := (v.y0 + (float64(py)+0.5)/float64(v.height)*(v.y1-v.y0)) * n
+		for px := 0; px < v.width; px++ {
+			gx := (v.x0 + (float64(px)+0.5)/float64(v.width)*(v.x1-v.x0)) * n
+			tile := tiles[[2]int{int(gx), int(gy)}]
+			if tile == nil {
+				continue
+			}
+			b := tile.Bounds()
+			sx := b.Min.X + int((gx-math.Floor(gx))*float64(b.Dx()))
+			sy := b.Min.Y + int((gy-math.Floor(gy))*float64(b.Dy()))
+			img.Set(px, py, tile.At(sx, sy))
+		}
+	}
+}
+
+// blend paints c over one pixel using c's alpha.
+func blend(img *image.RGBA, x, y int, c color.NRGBA) {
+	if !(image.Point{x, y}).In(img.Rect) {
+		return
+	}
+	i := img.PixOffset(x, y)
+	a := uint32(c.A)
+	for k, v := range [3]uint8{c.R, c.G, c.B} {
+		img.Pix[i+k] = uint8((uint32(v)*a + uint32(img.Pix[i+k])*(255-a)) / 255)
+	}
+	img.Pix[i+3] = 0xff
+}
+
+// fillPolygon fills a polygon in pixel coordinates (even-odd rule), sampling
+// at pixel centres.
+func fillPolygon(img *image.RGBA, pts [][2]float64, c color.NRGBA) {
+	if len(pts) < 3 {
+		return
+	}
+	minY, maxY := pts[0][1], pts[0][1]
+	for _, p := range pts {
+		minY, maxY = math.Min(minY, p[1]), math.Max(maxY, p[1])
+	}
+	var xs []float64
+	for y := max(int(minY), 0); y <= min(int(maxY), img.Rect.Dy()-1); y++ {
+		cy := float64(y) + 0.5
+		xs = xs[:0]
+		for i, a := range pts {
+			b := pts[(i+1)%len(pts)]
+			if (a[1] <= cy) != (b[1] <= cy) {
+				xs = append(xs, a[0]+(cy-a[1])/(b[1]-a[1])*(b[0]-a[0]))
+			}
+		}
+		sort.Float64s(xs)
+		for i := 0; i+1 < len(xs); i += 2 {
+			for x := max(int(math.Ceil(xs[i]-0.5)), 0); float64(x)+0.5 <= xs[i+1] && x < img.Rect.Dx(); x++ {
+				blend(img, x, y, c)
+			}
+		}
+	}
+}
+
+// strokePolygon outlines a closed polygon with an opaque line about width
+// pixels wide.
+func strokePolygon(img *image.RGBA, pts [][2]float64, width int, c color.NRGBA) {
+	for i, a := range pts {
+		b := pts[(i+1)%len(pts)]
+		steps := int(math.Ceil(math.Hypot(b[0]-a[0], b[1]-a[1]) * 2))
+		for s := 0; s <= steps; s++ {
+			t := float64(s) / float64(max(steps, 1))
+			x, y := int(a[0]+t*(b[0]-a[0])), int(a[1]+t*(b[1]-a[1]))
+			for dx := -width / 2; dx < width-width/2; dx++ {
+				for dy := -width / 2; dy < width-width/2; dy++ {
+					blend(img, x+dx, y+dy, c)
+				}
+			}
+		}
+	}
+}
+
+// glyphArrow is an aircraft arrow pointing north, in pixels around its
+// position; glyphDiamond marks aircraft with no known heading.
+var (
+	glyphArrow   = [][2]float64{{0, -9}, {6, 7}, {0, 3}, {-6, 7}}
+	glyphDiamond = [][2]float64{{0, -5}, {5, 0}, {0, 5}, {-5, 0}}
+)
+
+// drawGlyph draws a shape at p, rotated clockwise by heading degrees, over a
+// dark halo so it reads on light and dark basemaps alike.
+func drawGlyph(img *image.RGBA, shape [][2]float64, p [2]float64, heading float64, c color.NRGBA) {
+	sin, cos := math.Sincos(heading * math.Pi / 180)
+	place := func(scale float64) [][2]float64 {
+		pts := make([][2]float64, len(shape))
+		for i, s := range shape {
+			x, y := s[0]*scale, s[1]*scale
+			pts[i] = [2]float64{p[0] + x*cos - y*sin, p[1] + x*sin + y*cos}
+		}
+		return pts
+	}
+	fillPolygon(img, place(1.4), glyphHalo)
+	fillPolygon(img, place(1), c)
+}
+
+// hexNRGBA parses "#rrggbb" with the given alpha.
+func hexNRGBA(s string, alpha uint8) color.NRGBA {
+	c := color.NRGBA{A: alpha}
+	fmt.Sscanf(s, "#%02x%02x%02x", &c.R, &c.G, &c.B)
+	return c
+}
+
+// renderSnapshot draws a region's current picture as a PNG: the basemap
+// when the tile proxy is configured, zones in their severity colours, and
+// aircraft glyphs oriented by track, military on top.
+func renderSnapshot(region string, width int) ([]byte, error) {
+	r, ok := regions[region]
+	if !ok {
+		return nil, fmt.Errorf("unknown region %q", region)
+	}
+	v := newSnapshotView(r, width)
+	img := image.NewRGBA(image.Rect(0, 0, v.width, v.height))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = snapshotBackground.R, snapshotBackground.G, snapshotBackground.B, 0xff
+	}
+	v.drawBasemap(img)
+
+	for _, z := range zonesForRegion(region) {
+		pts := make([][2]float64, len(z.Polygon))
+		for i, p := range z.Polygon {
+			pts[i] = v.point(p[1], p[0])
+		}
+		fillPolygon(img, pts, hexNRGBA(sitrepColor(z.Severity), 0x40))
+		strokePolygon(img, pts, 2, hexNRGBA(sitrepColor(z.Severity), 0xff))
+	}
+
+	aircraft := append([]Aircraft(nil), currentAirspace(region).Aircraft...)
+	military := make(map[string]bool)
+	for _, ac := range aircraft {
+		military[ac.ICAO24], _ = classifyMilitary(ac)
+	}
+	sort.SliceStable(aircraft, func(i, j int) bool { return !military[aircraft[i].ICAO24] && military[aircraft[j].ICAO24] })
+	for _, ac := range aircraft {
+		if ac.Latitude == nil || ac.Longitude == nil {
+			continue
+		}
+		c := glyphDefault
+		switch {
+		case military[ac.ICAO24]:
+			c = glyphMilitary
+		case ac.Source == sourceManual:
+			c = glyphManual
+		case ac.OnGround:
+			c = glyphGround
+		}
+		p := v.point(*ac.Latitude, *ac.Longitude)
+		if ac.TrueTrack != nil {
+			drawGlyph(img, glyphArrow, p, *ac.TrueTrack, c)
+		} else {
+			drawGlyph(img, glyphDiamond, p, 0, c)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// pngDataURL inlines a PNG in an HTML report.
+func pngDataURL(data []byte) template.URL {
+	return template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(data))
+}
+
+// handleSnapshot renders the current picture for a region to a PNG.
+// GET /api/snapshot?region=[&width=1024]
+func handleSnapshot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	region := q.Get("region")
+	if region == "" {
+		region = "socal"
+	}
+	if _, ok := regions[region]; !ok {
+		http.Error(w, fmt.Sprintf("unknown region %q", region), http.StatusBadRequest)
+		return
+	}
+	width := 1024
+	if v := q.Get("width"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 256 || n > 2048 {
+			http.Error(w, "width must be from 256 to 2048", http.StatusBadRequest)
+			return
+		}
+		width = n
+	}
+	data, err := renderSnapshot(region, width)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	name := fmt.Sprintf("snapshot-%s-%s.png", region, time.Now().UTC().Format("20060102T150405Z"))
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", name))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(data)
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Sun elevations, in degrees, that bound each phase of the day. Sunrise and
+// sunset are when the upper limb touches the horizon, allowing for
+// refraction.
+const (
+	sunriseElevation      = -0.833
+	civilTwilightEnd      = -6.0
+	nauticalTwilightEnd   = -12.0
+	astronomicalTwilightE = -18.0
+)
+
+// solarBroadcastInterval is how often clients get the terminator; it moves
+// a quarter of a degree a minute.
+const solarBroadcastInterval = time.Minute
+
+// sunPosition returns the sun's declination and the subsolar point at t,
+// in degrees, from the low-precision almanac formulas (good to about 0.01°).
+func sunPosition(t time.Time) (decl, subLat, subLon float64) {
+	rad := math.Pi / 180
+	n := float64(t.UnixMilli())/86400000 + 2440587.5 - 2451545.0 // days since J2000
+	l := math.Mod(280.460+0.9856474*n, 360)
+	g := math.Mod(357.528+0.9856003*n, 360) * rad
+	lambda := (l + 1.915*math.Sin(g) + 0.020*math.Sin(2*g)) * rad
+	eps := (23.439 - 0.0000004*n) * rad
+	ra := math.Atan2(math.Cos(eps)*math.Sin(lambda), math.Cos(lambda)) / rad
+	decl = math.Asin(math.Sin(eps)*math.Sin(lambda)) / rad
+	gmst := math.Mod(280.46061837+360.98564736629*n, 360)
+	subLon = math.Mod(ra-gmst+540, 360) - 180
+	return decl, decl, subLon
+}
+
+// sunElevation returns the sun's elevation and azimuth in degrees as seen
+// from (lat, lon) at t, ignoring refraction.
+func sunElevation(t time.Time, lat, lon float64) (elevation, azimuth float64) {
+	_, subLat, subLon := sunPosition(t)
+	return sunFrom(subLat, subLon, lat, lon)
+}
+
+// sunFrom is sunElevation for a known subsolar point: the sun is 90° up
+// there, and drops one degree per degree of arc away from it.
+func sunFrom(subLat, subLon, lat, lon float64) (elevation, azimuth float64) {
+	arc := greatCircleDistance(lat, lon, subLat, subLon) / 6371000 * 180 / math.Pi
+	return 90 - arc, greatCircleBearing(lat, lon, subLat, subLon)
+}
+
+// sunPhase names the part of the day for a sun elevation.
+func sunPhase(elevation float64) string {
+	switch {
+	case elevation > sunriseElevation:
+		return "day"
+	case elevation > civilTwilightEnd:
+		return "civil_twilight"
+	case elevation > nauticalTwilightEnd:
+		return "nautical_twilight"
+	case elevation > astronomicalTwilightE:
+		return "astronomical_twilight"
+	}
+	return "night"
+}
+
+// isDark reports whether the sun is below civil twilight, the usual line
+// for night operations.
+func isDark(elevation float64) bool { return elevation <= civilTwilightEnd }
+
+// nextSunCrossing finds when the sun next rises (rising) or sets after t at
+// (lat, lon), searching 36 hours. Nil in polar day or night.
+func nextSunCrossing(t time.Time, lat, lon float64, rising bool) *time.Time {
+	above := func(at time.Time) bool {
+		el, _ := sunElevation(at, lat, lon)
+		return el > sunriseElevation
+	}
+	const step = 10 * time.Minute
+	prev := above(t)
+	for at := t.Add(step); at.Sub(t) <= 36*time.Hour; at = at.Add(step) {
+		cur := above(at)
+		if cur != prev && cur == rising {
+			lo, hi := at.Add(-step), at
+			for hi.Sub(lo) > time.Second {
+				mid := lo.Add(hi.Sub(lo) / 2)
+				if above(mid) == rising {
+					hi = mid
+				} else {
+					lo = mid
+				}
+			}
+			hi = hi.Truncate(time.Second).UTC()
+			return &hi
+		}
+		prev = cur
+	}
+	return nil
+}
+
+// terminatorLine returns the day/night line (sun on the horizon) as
+// [lon, lat] points every 2° of longitude, and the polygon of the night
+// side, closed along whichever pole is in darkness. Latitudes are clamped
+// to the Web Mercator limit so the polygon renders on slippy maps.
+func terminatorLine(decl, subLon float64) (line [][2]float64, night [][2]float64) {
+	rad := math.Pi / 180
+	if math.Abs(decl) < 0.01 {
+		decl = math.Copysign(0.01, decl) // equinox: the line is nearly a meridian pair
+	}
+	const limit = 85.05112878
+	for lon := -180.0; lon <= 180; lon += 2 {
+		lat := math.Atan(-math.Cos((lon-subLon)*rad)/math.Tan(decl*rad)) / rad
+		lat = math.Max(-limit, math.Min(limit, lat))
+		line = append(line, [2]float64{lon, math.Round(lat*1000) / 1000})
+	}
+	pole := -limit // northern summer: the south pole is dark
+	if decl < 0 {
+		pole = limit
+	}
+	night = append(night, line...)
+	night = append(night, [2]float64{180, pole}, [2]float64{-180, pole}, line[0])
+	return line, night
+}
+
+// SunSummary is the sun at one place.
+type SunSummary struct {
+	Elevation   float64    `json:"sunElevation"` // degrees above the horizon
+	Azimuth     float64    `json:"sunAzimuth"`   // degrees true
+	Phase       string     `json:"phase"`        // day, civil_twilight, nautical_twilight, astronomical_twilight, or night
+	Dark        bool       `json:"dark"`         // below civil twilight
+	NextSunrise *time.Time `json:"nextSunrise,omitempty"`
+	NextSunset  *time.Time `json:"nextSunset,omitempty"`
+}
+
+func newSunSummary(subLat, subLon, lat, lon float64) SunSummary {
+	el, az := sunFrom(subLat, subLon, lat, lon)
+	return SunSummary{
+		Elevation: math.Round(el*100) / 100,
+		Azimuth:   math.Round(az*10) / 10,
+		Phase:     sunPhase(el),
+		Dark:      isDark(el),
+	}
+}
+
+// regionCentre is the middle of a region's bounding box.
+func regionCentre(r Region) (lat, lon float64) {
+	return (r.MinLat + r.MaxLat) / 2, (r.MinLon + r.MaxLon) / 2
+}
+
+// SolarState is the global day/night picture, broadcast to clients as
+// "solar" messages.
+type SolarState struct {
+	Time        time.Time             `json:"time"`
+	Declination float64               `json:"declination"`
+	Subsolar    [2]float64            `json:"subsolar"` // [lon, lat]
+	Terminator  GeoJSONGeometry       `json:"terminator"`
+	Night       GeoJSONGeometry       `json:"night"`
+	Regions     map[string]SunSummary `json:"regions"` // at each region's centre
+}
+
+func computeSolarState(t time.Time) SolarState {
+	decl, subLat, subLon := sunPosition(t)
+	line, night := terminatorLine(decl, subLon)
+	s := SolarState{
+		Time:        t.UTC(),
+		Declination: math.Round(decl*1000) / 1000,
+		Subsolar:    [2]float64{math.Round(subLon*1000) / 1000, math.Round(subLat*1000) / 1000},
+		Terminator:  GeoJSONGeometry{Type: "LineString", Coordinates: line},
+		Night:       GeoJSONGeometry{Type: "Polygon", Coordinates: [][][2]float64{night}},
+		Regions:     make(map[string]SunSummary, len(regions)),
+	}
+	for name, r := range regions {
+		lat, lon := regionCentre(r)
+		s.Regions[name] = newSunSummary(subLat, subLon, lat, lon)
+	}
+	return s
+}
+
+// AircraftSun is the sun as seen from one aircraft.
+type AircraftSun struct {
+	ICAO24   string `json:"icao24"`
+	Callsign string `json:"callsign,omitempty"`
+	SunSummary
+}
+
+// RegionSolar is the body of /api/solar.
+type RegionSolar struct {
+	SolarState
+	Region   string        `json:"region"`
+	Centre   SunSummary    `json:"centre"`
+	Dark     int           `json:"darkAircraft"` // airborne aircraft below civil twilight
+	Airborne int           `json:"airborneAircraft"`
+	Aircraft []AircraftSun `json:"aircraft"`
+}
+
+// computeRegionSolar adds a region's centre, with its next sunrise and
+// sunset, and every positioned aircraft to the global picture.
+func computeRegionSolar(region string, t time.Time, aircraft []Aircraft) RegionSolar {
+	_, subLat, subLon := sunPosition(t)
+	lat, lon := regionCentre(regions[region])
+	out := RegionSolar{
+		SolarState: computeSolarState(t),
+		Region:     region,
+		Centre:     newSunSummary(subLat, subLon, lat, lon),
+		Aircraft:   []AircraftSun{},
+	}
+	out.Centre.NextSunrise = nextSunCrossing(t, lat, lon, true)
+	out.Centre.NextSunset = nextSunCrossing(t, lat, lon, false)
+	for _, ac := range aircraft {
+		if ac.Latitude == nil || ac.Longitude == nil {
+			continue
+		}
+		sun := newSunSummary(subLat, subLon, *ac.Latitude, *ac.Longitude)
+		if !ac.OnGround {
+			out.Airborne++
+			if sun.Dark {
+				out.Dark++
+			}
+		}
+		out.Aircraft = append(out.Aircraft, AircraftSun{ICAO24: ac.ICAO24, Callsign: strings.TrimSpace(ac.Callsign), SunSummary: sun})
+	}
+	sort.Slice(out.Aircraft, func(i, j int) bool { return out.Aircraft[i].ICAO24 < out.Aircraft[j].ICAO24 })
+	return out
+}
+
+// AnalysisSolar is the sun at analysis time, attached to each analysis.
+type AnalysisSolar struct {
+	SunSummary
+	DarkAircraft     int `json:"darkAircraft"`
+	AirborneAircraft int `json:"airborneAircraft"`
+}
+
+// analysisSolar summarises a picture's light conditions for SENTINEL.
+func analysisSolar(region string, aircraft []Aircraft) *AnalysisSolar {
+	s := computeRegionSolar(region, time.Now(), aircraft)
+	return &AnalysisSolar{SunSummary: s.Centre, DarkAircraft: s.Dark, AirborneAircraft: s.Airborne}
+}
+
+// solarPromptNote gives SENTINEL the computed light conditions, so night
+// activity is judged from geometry rather than guessed from the timestamp.
+func solarPromptNote(s *AnalysisSolar) string {
+	return fmt.Sprintf("\n\nSolar geometry (computed): at the region centre the sun is %.1f° above the horizon (%s); %d of %d airborne aircraft are in darkness (sun below -6°). Weigh activity in darkness accordingly.",
+		s.Elevation, strings.ReplaceAll(s.Phase, "_", " "), s.DarkAircraft, s.AirborneAircraft)
+}
+
+// runSolarBroadcast sends every client the day/night picture each minute.
+func runSolarBroadcast() {
+	ticker := time.NewTicker(solarBroadcastInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopping:
+			return
+		case <-ticker.C:
+		}
+		broadcastSolar()
+	}
+}
+
+func broadcastSolar() {
+	msg := map[string]interface{}{"type": "solar", "solar": computeSolarState(time.Now())}
+	recorder.Broadcast("", msg)
+	clientsMutex.RLock()
+	defer clientsMutex.RUnlock()
+	for conn := range clients {
+		if err := conn.send(msg); err != nil {
+			wsLog.Warn("Write solar to client failed", "err", err)
+		}
+	}
+}
+
+// handleSolar serves the day/night terminator and the sun over a region and
+// each of its aircraft, now or at another time.
+// GET /api/solar?region=[&at=RFC3339][&format=json|geojson]
+func handleSolar(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	region := q.Get("region")
+	if region == "" {
+		region = "socal"
+	}
+	if _, ok := regions[region]; !ok {
+		http.Error(w, fmt.Sprintf("unknown region %q", region), http.StatusBadRequest)
+		return
+	}
+	at := time.Now()
+	if v := q.Get("at"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "at must be an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+		at = t
+	}
+	var aircraft []Aircraft
+	if q.Get("at") == "" {
+		aircraft = currentAirspace(region).Aircraft
+	}
+	s := computeRegionSolar(region, at, aircraft)
+
+	switch q.Get("format") {
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s)
+	case "geojson":
+		writeGeoJSON(w, []GeoJSONFeature{
+			{Type: "Feature", ID: "terminator", Geometry: s.Terminator, Properties: map[string]interface{}{"time": s.Time}},
+			{Type: "Feature", ID: "night", Geometry: s.Night, Properties: map[string]interface{}{"time": s.Time}},
+			{Type: "Feature", ID: "subsolar", Geometry: GeoJSONGeometry{Type: "Point", Coordinates: s.Subsolar}, Properties: map[string]interface{}{"declination": s.Declination}},
+		})
+	default:
+		http.Error(w, "Unsupported format (use json or geojson)", http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+)
+
+// embeddedStatic is the frontend build, copied into ./static before
+// `go build` (see the Dockerfile), so the binary runs from any directory.
+//
+//go:embed all:static
+var embeddedStatic embed.FS
+
+// staticHandler serves the web UI: from STATIC_DIR if set (a newer build,
+// or frontend work without rebuilding the backend), otherwise from the
+// files embedded at build time.
+func staticHandler() (http.Handler, string, error) {
+	if dir := os.Getenv("STATIC_DIR"); dir != "" {
+		if info, err := os.Stat(dir); err != nil {
+			return nil, "", err
+		} else if !info.IsDir() {
+			return nil, "", fmt.Errorf("%s is not a directory", dir)
+		}
+		return http.FileServer(http.Dir(dir)), dir, nil
+	}
+	sub, err := fs.Sub(embeddedStatic, "static")
+	if err != nil {
+		return nil, "", err
+	}
+	return http.FileServer(http.FS(sub)), "embedded", nil
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxStatsWindow is how far back /api/stats can look: the track registry
+// forgets aircraft unseen for this long, so older contacts can't be counted.
+const maxStatsWindow = 6 * time.Hour
+
+// altitudeBands are the histogram buckets in feet; the last is open-ended.
+var altitudeBands = []float64{0, 5000, 10000, 20000, 30000, 40000}
+
+// airlineCallsign matches an ICAO airline designator plus flight number,
+// e.g. UAL123 or BAW9KP.
+var airlineCallsign = regexp.MustCompile(`^[A-Z]{3}[0-9][0-9A-Z]{0,3}$`)
+
+// isCommercial reports whether an aircraft looks like an airline flight:
+// not military, and flying under an airline callsign.
+func isCommercial(ac Aircraft) bool {
+	if !airlineCallsign.MatchString(strings.ToUpper(strings.TrimSpace(ac.Callsign))) {
+		return false
+	}
+	military, _ := classifyMilitary(ac)
+	return !military
+}
+
+// RegionStats is the body of /api/stats.
+type RegionStats struct {
+	Region            string            `json:"region"`
+	Window            string            `json:"window"`
+	From              time.Time         `json:"from"`
+	To                time.Time         `json:"to"`
+	Current           int               `json:"current"` // aircraft in the picture now
+	Seen              int               `json:"seen"`    // distinct aircraft seen in the window
+	Series            []StatsPoint      `json:"series"`
+	AltitudeHistogram []AltitudeBucket  `json:"altitudeHistogram"`
+	Countries         []CountryCount    `json:"countries"`
+	Split             map[string]int    `json:"split"` // military, civilian, and commercial (a subset of civilian)
+	CommercialDensity CommercialDensity `json:"commercialDensity"`
+	BusiestHour       *BusiestHour      `json:"busiestHour"`
+	NewContacts       []NewContact      `json:"newContacts"`
+}
+
+// StatsPoint is the picture size at one time, averaged over its bucket.
+type StatsPoint struct {
+	Time     int64   `json:"time"` // Unix ms
+	Aircraft float64 `json:"aircraft"`
+	Military float64 `json:"military"`
+}
+
+type AltitudeBucket struct {
+	Band  string `json:"band"` // "ground", "0-5000", ..., "40000+" (feet)
+	Count int    `json:"count"`
+}
+
+type CountryCount struct {
+	Country string `json:"country"`
+	Count   int    `json:"count"`
+}
+
+// CommercialDensity rates airline traffic now against the region's average
+// over the metrics retention window.
+type CommercialDensity struct {
+	Level      string  `json:"level"` // LOW, NORMAL, or HIGH
+	Current    int     `json:"current"`
+	Baseline   float64 `json:"baseline"`
+	Per10kKm2  float64 `json:"per10kKm2"`
+	BaselineOf string  `json:"baselineOf"` // how much history the baseline covers
+}
+
+type BusiestHour struct {
+	Hour         time.Time `json:"hour"`
+	PeakAircraft int       `json:"peakAircraft"`
+}
+
+type NewContact struct {
+	ICAO24    string    `json:"icao24"`
+	Callsign  string    `json:"callsign,omitempty"`
+	Country   string    `json:"country,omitempty"`
+	FirstSeen time.Time `json:"firstSeen"`
+	Military  bool      `json:"military"`
+}
+
+// regionAreaKm2 approximates a region's bounding box area on a sphere.
+func regionAreaKm2(r Region) float64 {
+	const earthRadiusKm = 6371.0
+	rad := math.Pi / 180
+	return earthRadiusKm * earthRadiusKm * (r.MaxLon - r.MinLon) * rad *
+		math.Abs(math.Sin(r.MaxLat*rad)-math.Sin(r.MinLat*rad))
+}
+
+// commercialDensity rates the airline traffic in a picture. Below 60% of the
+// region's recent average is LOW and above 140% is HIGH.
+func commercialDensity(region string, aircraft []Aircraft) CommercialDensity {
+	d := CommercialDensity{Level: "NORMAL"}
+	for _, ac := range aircraft {
+		if isCommercial(ac) {
+			d.Current++
+		}
+	}
+	if r, ok := regions[region]; ok {
+		if area := regionAreaKm2(r); area > 0 {
+			d.Per10kKm2 = math.Round(float64(d.Current)/area*10000*100) / 100
+		}
+	}
+
+	now := time.Now()
+	samples := metricHistory.Samples(region, now.Add(-metricHistory.retention), now)
+	if len(samples) == 0 {
+		d.Baseline = float64(d.Current)
+		d.BaselineOf = "0s"
+		return d
+	}
+	var sum float64
+	for _, s := range samples {
+		sum += s.Commercial
+	}
+	d.Baseline = math.Round(sum/float64(len(samples))*10) / 10
+	d.BaselineOf = now.Sub(samples[0].At).Truncate(time.Second).String()
+	switch {
+	case d.Baseline == 0 && d.Current > 0:
+		d.Level = "HIGH"
+	case float64(d.Current) < 0.6*d.Baseline:
+		d.Level = "LOW"
+	case float64(d.Current) > 1.4*d.Baseline:
+		d.Level = "HIGH"
+	}
+	return d
+}
+
+// commercialDensityPromptNote gives SENTINEL the computed density so it
+// doesn't estimate its own.
+func commercialDensityPromptNote(d CommercialDensity) string {
+	return fmt.Sprintf("\n\nCommercial traffic density (computed; use it rather than estimating): %s — %d airline flights against a recent average of %.1f.",
+		d.Level, d.Current, d.Baseline)
+}
+
+// computeRegionStats summarises a region over the window ending now.
+func computeRegionStats(region string, window time.Duration) RegionStats {
+	to := time.Now().UTC()
+	from := to.Add(-window)
+	current := currentAirspace(region).Aircraft
+	st := RegionStats{
+		Region:            region,
+		Window:            window.String(),
+		From:              from,
+		To:                to,
+		Current:           len(current),
+		Series:            []StatsPoint{},
+		AltitudeHistogram: make([]AltitudeBucket, 0, len(altitudeBands)+1),
+		Countries:         []CountryCount{},
+		Split:             map[string]int{"military": 0, "civilian": 0, "commercial": 0},
+		CommercialDensity: commercialDensity(region, current),
+		NewContacts:       []NewContact{},
+	}
+
+	// Picture size over time, and the hour with the highest peak.
+	aircraftSeries := metricHistory.Series(region, "aircraft_count", from, to, 60)
+	militarySeries := metricHistory.Series(region, "military_count", from, to, 60)
+	for i, p := range aircraftSeries {
+		pt := StatsPoint{Time: int64(p[1]), Aircraft: math.Round(p[0]*10) / 10}
+		if i < len(militarySeries) {
+			pt.Military = math.Round(militarySeries[i][0]*10) / 10
+		}
+		st.Series = append(st.Series, pt)
+	}
+	peaks := make(map[time.Time]int)
+	for _, s := range metricHistory.Samples(region, from, to) {
+		hour := s.At.UTC().Truncate(time.Hour)
+		peaks[hour] = max(peaks[hour], int(s.Aircraft))
+	}
+	for hour, peak := range peaks {
+		if st.BusiestHour == nil || peak > st.BusiestHour.PeakAircraft ||
+			(peak == st.BusiestHour.PeakAircraft && hour.After(st.BusiestHour.Hour)) {
+			st.BusiestHour = &BusiestHour{Hour: hour, PeakAircraft: peak}
+		}
+	}
+
+	// Distributions over every aircraft seen in the window, by its last report.
+	bands := make([]int, len(altitudeBands)+1) // [0] is on the ground
+	countries := make(map[string]int)
+	for _, rec := range trackRegistry.Records(region) {
+		if rec.LastSeen.Before(from) {
+			continue
+		}
+		ac := rec.Last
+		st.Seen++
+		military, _ := classifyMilitary(ac)
+		switch {
+		case military:
+			st.Split["military"]++
+		case isCommercial(ac):
+			st.Split["commercial"]++
+			st.Split["civilian"]++
+		default:
+			st.Split["civilian"]++
+		}
+		country := ac.OriginCountry
+		if country == "" {
+			country = "Unknown"
+		}
+		countries[country]++
+
+		switch {
+		case ac.OnGround:
+			bands[0]++
+		case ac.BaroAltitude != nil:
+			ft := *ac.BaroAltitude * 3.28084
+			i := sort.SearchFloat64s(altitudeBands, ft)
+			if i < len(altitudeBands) && altitudeBands[i] == ft {
+				i++
+			}
+			bands[max(i, 1)]++
+		}
+
+		if !rec.seeded && !rec.FirstSeen.Before(from) {
+			st.NewContacts = append(st.NewContacts, NewContact{
+				ICAO24: rec.ICAO24, Callsign: rec.Callsign, Country: ac.OriginCountry,
+				FirstSeen: rec.FirstSeen, Military: military,
+			})
+		}
+	}
+
+	st.AltitudeHistogram = append(st.AltitudeHistogram, AltitudeBucket{Band: "ground", Count: bands[0]})
+	for i, lo := range altitudeBands {
+		band := fmt.Sprintf("%.0f+", lo)
+		if i+1 < len(altitudeBands) {
+			band = fmt.Sprintf("%.0f-%.0f", lo, altitudeBands[i+1])
+		}
+		st.AltitudeHistogram = append(st.AltitudeHistogram, AltitudeBucket{Band: band, Count: bands[i+1]})
+	}
+	for country, n := range countries {
+		st.Countries = append(st.Countries, CountryCount{Country: country, Count: n})
+	}
+	sort.Slice(st.Countries, func(i, j int) bool {
+		if st.Countries[i].Count != st.Countries[j].Count {
+			return st.Countries[i].Count > st.Countries[j].Count
+		}
+		return st.Countries[i].Country < st.Countries[j].Country
+	})
+	sort.Slice(st.NewContacts, func(i, j int) bool { return st.NewContacts[i].FirstSeen.After(st.NewContacts[j].FirstSeen) })
+	return st
+}
+
+// handleStats serves computed statistics for a region.
+// GET /api/stats?region=&window=1h
+func handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	region := q.Get("region")
+	if region == "" {
+		region = "socal"
+	}
+	if _, ok := regions[region]; !ok {
+		http.Error(w, fmt.Sprintf("unknown region %q", region), http.StatusBadRequest)
+		return
+	}
+	window := time.Hour
+	if v := q.Get("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < time.Minute || d > maxStatsWindow {
+			http.Error(w, fmt.Sprintf("window must be a duration from 1m to %s", maxStatsWindow), http.StatusBadRequest)
+			return
+		}
+		window = d
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(computeRegionStats(region, window))
+}
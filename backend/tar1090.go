@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// readsbAircraft is one entry of readsb's aircraft.json, the format tar1090
+// and other dump1090-family web UIs poll.
+type readsbAircraft struct {
+	Hex       string      `json:"hex"`
+	Type      string      `json:"type"`
+	Flight    string      `json:"flight,omitempty"`
+	AltBaro   interface{} `json:"alt_baro,omitempty"` // feet, or "ground"
+	AltGeom   *float64    `json:"alt_geom,omitempty"`
+	GS        *float64    `json:"gs,omitempty"`
+	Track     *float64    `json:"track,omitempty"`
+	BaroRate  *float64    `json:"baro_rate,omitempty"`
+	Squawk    string      `json:"squawk,omitempty"`
+	Emergency string      `json:"emergency,omitempty"`
+	Category  string      `json:"category,omitempty"`
+	Lat       *float64    `json:"lat,omitempty"`
+	Lon       *float64    `json:"lon,omitempty"`
+	SPI       int         `json:"spi"`
+	Seen      float64     `json:"seen"`
+	SeenPos   *float64    `json:"seen_pos,omitempty"`
+	Messages  int         `json:"messages"`
+	RSSI      float64     `json:"rssi"`
+}
+
+// tar1090Region is the region served when the UI doesn't ask for one, since
+// tar1090 itself knows nothing about regions. Set with TAR1090_REGION.
+func tar1090Region(r *http.Request) string {
+	if region := r.URL.Query().Get("region"); region != "" {
+		return region
+	}
+	if region := os.Getenv("TAR1090_REGION"); region != "" {
+		return region
+	}
+	return "socal"
+}
+
+// readsbCategory maps OpenSky's emitter category numbering to the DO-260
+// set/code form (A1–A7, B1–B7, C1–C7) that readsb reports.
+func readsbCategory(c int) string {
+	switch {
+	case c >= 2 && c <= 8:
+		return fmt.Sprintf("A%d", c-1)
+	case c >= 9 && c <= 15:
+		return fmt.Sprintf("B%d", c-8)
+	case c >= 16 && c <= 20:
+		return fmt.Sprintf("C%d", c-15)
+	}
+	return ""
+}
+
+var readsbEmergencies = map[string]string{"7500": "unlawful", "7600": "nordo", "7700": "general"}
+
+func toReadsb(ac Aircraft, now float64) readsbAircraft {
+	out := readsbAircraft{
+		Hex:      strings.ToLower(ac.ICAO24),
+		Type:     "adsb_icao",
+		Track:    ac.TrueTrack,
+		Category: readsbCategory(ac.Category),
+		Lat:      ac.Latitude,
+		Lon:      ac.Longitude,
+		Seen:     now - float64(ac.LastContact),
+		Messages: 1,
+		RSSI:     -20,
+	}
+	if cs := strings.TrimSpace(ac.Callsign); cs != "" {
+		out.Flight = fmt.Sprintf("%-8s", cs)
+	}
+	if ac.OnGround {
+		out.AltBaro = "ground"
+	} else if ac.BaroAltitude != nil {
+		out.AltBaro = roundTo(*ac.BaroAltitude/0.3048, 25)
+	}
+	if ac.GeoAltitude != nil {
+		ft := roundTo(*ac.GeoAltitude/0.3048, 25)
+		out.AltGeom = &ft
+	}
+	if ac.Velocity != nil {
+		kt := *ac.Velocity * 3600 / 1852
+		out.GS = &kt
+	}
+	if ac.VerticalRate != nil {
+		fpm := roundTo(*ac.VerticalRate/0.3048*60, 64)
+		out.BaroRate = &fpm
+	}
+	if ac.Squawk != nil {
+		out.Squawk = *ac.Squawk
+		out.Emergency = readsbEmergencies[*ac.Squawk]
+	}
+	if ac.SPI {
+		out.SPI = 1
+	}
+	if ac.TimePosition != nil && ac.Latitude != nil {
+		seenPos := now - float64(*ac.TimePosition)
+		out.SeenPos = &seenPos
+	}
+	return out
+}
+
+func roundTo(v, step float64) float64 {
+	return float64(int64(v/step+0.5)) * step
+}
+
+// handleTar1090Aircraft serves the regional cache as readsb aircraft.json.
+// GET /data/aircraft.json[?region=]
+func handleTar1090Aircraft(w http.ResponseWriter, r *http.Request) {
+	data := currentAirspace(tar1090Region(r))
+	now := float64(time.Now().UnixMilli()) / 1000
+
+	aircraft := make([]readsbAircraft, 0, len(data.Aircraft))
+	for _, ac := range data.Aircraft {
+		aircraft = append(aircraft, toReadsb(ac, now))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"now":      now,
+		"messages": len(aircraft),
+		"aircraft": aircraft,
+	})
+}
+
+// handleTar1090Receiver serves receiver.json, which tar1090 reads once at
+// startup for its refresh rate and initial map center. History is off.
+// GET /data/receiver.json[?region=]
+func handleTar1090Receiver(w http.ResponseWriter, r *http.Request) {
+	region, ok := regions[tar1090Region(r)]
+	if !ok {
+		http.Error(w, "Unknown region", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"version": "swarm-c2",
+		"refresh": pollInterval.Get().Milliseconds(),
+		"history": 0,
+		"lat":     (region.MinLat + region.MaxLat) / 2,
+		"lon":     (region.MinLon + region.MaxLon) / 2,
+	})
+}
@@ -0,0 +1,934 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"swarm-c2/mqtt"
+)
+
+// Tasking command kinds.
+const (
+	taskGoto        = "goto"        // fly to lat/lon (and altM)
+	taskOrbit       = "orbit"       // circle lat/lon at radiusM
+	taskInvestigate = "investigate" // fly to a contact in the air picture
+)
+
+// Tasking command states. A command is queued until it reaches the drone,
+// sent until the drone acknowledges it, then follows the drone's reports.
+// rejected, completed, failed, cancelled, and superseded are final;
+// timed_out is not, since a late acknowledgment still counts.
+const (
+	commandQueued     = "queued"
+	commandSent       = "sent"
+	commandAccepted   = "accepted"
+	commandRejected   = "rejected"
+	commandExecuting  = "executing"
+	commandCompleted  = "completed"
+	commandFailed     = "failed"
+	commandCancelled  = "cancelled"
+	commandSuperseded = "superseded"
+	commandTimedOut   = "timed_out"
+)
+
+// droneAckStates are the states a drone may report for a command.
+var droneAckStates = map[string]bool{
+	commandAccepted: true, commandRejected: true, commandExecuting: true,
+	commandCompleted: true, commandFailed: true,
+}
+
+func commandFinal(state string) bool {
+	switch state {
+	case commandRejected, commandCompleted, commandFailed, commandCancelled, commandSuperseded:
+		return true
+	}
+	return false
+}
+
+// friendlyDroneClass is the track class of tasked drones, kept apart from
+// aircraft so own assets never raise alerts or reach the outbound feeds.
+const friendlyDroneClass = "friendly_drone"
+
+const (
+	taskingMaxCommands   = 1000             // finished commands beyond this are forgotten, oldest first
+	taskingTelemetryTTL  = 30 * time.Second // a drone silent this long is shown offline
+	taskingDefaultOrbitM = 500
+)
+
+// TaskingCommand is one order to one drone and everything it has reported
+// about it since.
+type TaskingCommand struct {
+	ID       string         `json:"id"`
+	Drone    string         `json:"drone"`
+	Kind     string         `json:"kind"`
+	Lat      float64        `json:"lat"`
+	Lon      float64        `json:"lon"`
+	AltM     *float64       `json:"altM,omitempty"`
+	RadiusM  float64        `json:"radiusM,omitempty"`
+	Contact  string         `json:"contact,omitempty"`
+	Target   *TaskingTarget `json:"target,omitempty"`
+	State    string         `json:"state"`
+	Detail   string         `json:"detail,omitempty"`
+	IssuedBy string         `json:"issuedBy,omitempty"`
+	IssuedAt time.Time      `json:"issuedAt"`
+	SentAt   *time.Time     `json:"sentAt,omitempty"`
+	Updated  time.Time      `json:"updatedAt"`
+	History  []CommandEvent `json:"history"`
+}
+
+// TaskingTarget is where a contact was when an investigate command was
+// issued.
+type TaskingTarget struct {
+	ICAO24   string   `json:"icao24"`
+	Callsign string   `json:"callsign,omitempty"`
+	Region   string   `json:"region"`
+	Lat      float64  `json:"lat"`
+	Lon      float64  `json:"lon"`
+	AltM     *float64 `json:"altM,omitempty"`
+	Seen     int64    `json:"seen"` // Unix time of the picture it came from
+}
+
+// CommandEvent is one state change of a command.
+type CommandEvent struct {
+	State  string    `json:"state"`
+	At     time.Time `json:"at"`
+	Detail string    `json:"detail,omitempty"`
+}
+
+// DroneTrack is a friendly drone's last reported telemetry.
+type DroneTrack struct {
+	ID       string     `json:"id"`
+	Class    string     `json:"class"`
+	Region   string     `json:"region,omitempty"` // region whose box holds the position, if any
+	Lat      *float64   `json:"lat"`
+	Lon      *float64   `json:"lon"`
+	AltM     *float64   `json:"altM,omitempty"`
+	Heading  *float64   `json:"heading,omitempty"`
+	SpeedMS  *float64   `json:"speedMs,omitempty"`
+	Battery  *float64   `json:"battery,omitempty"` // percent
+	Status   string     `json:"status,omitempty"`
+	Link     string     `json:"link,omitempty"` // "websocket" or "mqtt", whichever reported last
+	Online   bool       `json:"online"`
+	LastSeen *time.Time `json:"lastSeen,omitempty"`
+	Command  string     `json:"command,omitempty"` // active command ID
+}
+
+// droneMessage is what a drone sends: telemetry or an acknowledgment. Over
+// MQTT the topic says which, and type may be left out.
+type droneMessage struct {
+	Type      string   `json:"type"`
+	Lat       *float64 `json:"lat"`
+	Lon       *float64 `json:"lon"`
+	Alt       *float64 `json:"alt"` // meters
+	Heading   *float64 `json:"heading"`
+	Speed     *float64 `json:"speed"` // m/s
+	Battery   *float64 `json:"battery"`
+	Status    string   `json:"status"`
+	CommandID string   `json:"commandId"`
+	Detail    string   `json:"detail"`
+}
+
+// droneLink is a drone's WebSocket connection. gorilla/websocket allows one
+// writer at a time, and commands are sent from API handlers as well as the
+// connection's own goroutine.
+type droneLink struct {
+	conn *websocket.Conn
+	mu   sync.Mutex
+}
+
+func (l *droneLink) send(v interface{}) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	return l.conn.WriteJSON(v)
+}
+
+// Tasking registers friendly drones, tracks their telemetry, and sends them
+// commands over WebSocket or MQTT, following each command from issue to
+// completion. State is kept in memory only. A nil Tasking means drone
+// tasking is off.
+type Tasking struct {
+	tokens     map[string][32]byte // drone ID -> token digest; absent for MQTT-only drones
+	registered map[string]bool
+	ackTimeout time.Duration
+	mqttURL    string
+	broker     string // mqttURL without the password, for logs
+	clientID   string
+	topic      string
+
+	mu       sync.Mutex
+	drones   map[string]*DroneTrack
+	links    map[string]*droneLink
+	commands map[string]*TaskingCommand
+	order    []string // command IDs, oldest first
+	mqtt     *mqtt.Client
+}
+
+var tasking *Tasking
+
+// newTaskingFromEnv returns nil when TASKING_DRONES is unset.
+//
+//	TASKING_DRONES      — comma-separated "id:token" (WebSocket and MQTT) or bare "id" (MQTT only)
+//	TASKING_MQTT_URL    — mqtt:// or mqtts:// broker, with user:pass if it needs them
+//	TASKING_MQTT_TOPIC  — topic prefix (default swarmc2/drones): <prefix>/<id>/telemetry, /ack, /command
+//	TASKING_ACK_TIMEOUT — how long a sent command may go unacknowledged (default 30s)
+func newTaskingFromEnv() (*Tasking, error) {
+	entries := splitList(getSecret("TASKING_DRONES"))
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	t := &Tasking{
+		tokens:     make(map[string][32]byte),
+		registered: make(map[string]bool),
+		ackTimeout: 30 * time.Second,
+		mqttURL:    getSecret("TASKING_MQTT_URL"),
+		topic:      strings.Trim(os.Getenv("TASKING_MQTT_TOPIC"), "/"),
+		drones:     make(map[string]*DroneTrack),
+		links:      make(map[string]*droneLink),
+		commands:   make(map[string]*TaskingCommand),
+	}
+	if t.topic == "" {
+		t.topic = "swarmc2/drones"
+	}
+	if t.mqttURL != "" {
+		u, err := url.Parse(t.mqttURL)
+		if err != nil || (u.Scheme != "mqtt" && u.Scheme != "mqtts") || u.Host == "" {
+			return nil, errors.New("TASKING_MQTT_URL: not mqtt://[user:pass@]host[:port] or mqtts://")
+		}
+		t.broker = u.Redacted()
+		host, _ := os.Hostname()
+		t.clientID = fmt.Sprintf("swarm-c2-%s-%d", host, os.Getpid())
+	}
+	for _, entry := range entries {
+		id, token, hasToken := strings.Cut(entry, ":")
+		id = strings.TrimSpace(id)
+		if id == "" || strings.ContainsAny(id, "/+#") {
+			return nil, fmt.Errorf("TASKING_DRONES: %q is not a valid drone ID", id)
+		}
+		if t.registered[id] {
+			return nil, fmt.Errorf("TASKING_DRONES: drone %q listed twice", id)
+		}
+		t.registered[id] = true
+		if hasToken {
+			if token = strings.TrimSpace(token); len(token) < 16 {
+				return nil, fmt.Errorf("TASKING_DRONES: token for %q is shorter than 16 characters", id)
+			}
+			t.tokens[id] = sha256.Sum256([]byte(token))
+		}
+		t.drones[id] = &DroneTrack{ID: id, Class: friendlyDroneClass}
+	}
+	if len(t.tokens) < len(t.registered) && t.mqttURL == "" {
+		return nil, fmt.Errorf("TASKING_DRONES: drones without a token can only connect over MQTT, but TASKING_MQTT_URL is unset")
+	}
+	if v := os.Getenv("TASKING_ACK_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("TASKING_ACK_TIMEOUT: invalid duration %q", v)
+		}
+		t.ackTimeout = d
+	}
+	return t, nil
+}
+
+// Run expires unacknowledged commands and broadcasts friendly tracks every
+// second, and keeps the MQTT connection up if there is one.
+func (t *Tasking) Run() {
+	if t.mqttURL != "" {
+		goSupervised("tasking:mqtt", t.runMQTT)
+	}
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopping:
+			return
+		case now := <-ticker.C:
+			t.expire(now)
+			t.broadcastTracks(now)
+		}
+	}
+}
+
+// runMQTT connects to the broker, reconnecting with backoff, until
+// shutdown. Queued commands are flushed on every connect.
+func (t *Tasking) runMQTT() {
+	backoff := time.Second
+	for {
+		client, err := mqtt.Dial(t.mqttURL, t.clientID, 30*time.Second, nil, t.handleMQTT)
+		if err == nil {
+			for _, kind := range []string{"telemetry", "ack"} {
+				if err = client.Subscribe(t.topic + "/+/" + kind); err != nil {
+					break
+				}
+			}
+			if err != nil {
+				client.Close()
+			}
+		}
+		if err != nil {
+			droneLog.Warn("Tasking MQTT connect failed", "broker", t.broker, "err", err, "retry_in", backoff.String())
+			select {
+			case <-stopping:
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, 30*time.Second)
+			continue
+		}
+
+		backoff = time.Second
+		droneLog.Info("Tasking MQTT connected", "broker", t.broker, "topic", t.topic)
+		t.mu.Lock()
+		t.mqtt = client
+		t.mu.Unlock()
+		t.flushQueued("")
+
+		select {
+		case <-stopping:
+			client.Close()
+			return
+		case <-client.Done():
+			droneLog.Warn("Tasking MQTT connection lost", "err", client.Err())
+		}
+		t.mu.Lock()
+		t.mqtt = nil
+		t.mu.Unlock()
+	}
+}
+
+// handleMQTT takes <prefix>/<id>/telemetry and <prefix>/<id>/ack messages.
+func (t *Tasking) handleMQTT(msg mqtt.Message) {
+	rest, ok := strings.CutPrefix(msg.Topic, t.topic+"/")
+	if !ok {
+		return
+	}
+	id, kind, ok := strings.Cut(rest, "/")
+	if !ok || !t.registered[id] {
+		droneLog.Warn("Ignored MQTT message from unregistered drone", "topic", msg.Topic)
+		return
+	}
+	var m droneMessage
+	if err := json.Unmarshal(msg.Payload, &m); err != nil {
+		droneLog.Warn("Bad MQTT message from drone", "drone", id, "topic", msg.Topic, "err", err)
+		return
+	}
+	m.Type = kind
+	if err := t.receive(id, "mqtt", m); err != nil {
+		droneLog.Warn("Rejected MQTT message from drone", "drone", id, "err", err)
+	}
+}
+
+// receive applies telemetry or an acknowledgment from a drone.
+func (t *Tasking) receive(id, link string, m droneMessage) error {
+	switch m.Type {
+	case "telemetry":
+		if (m.Lat == nil) != (m.Lon == nil) {
+			return errors.New("telemetry needs both lat and lon")
+		}
+		t.mu.Lock()
+		d := t.drones[id]
+		if m.Lat != nil {
+			d.Lat, d.Lon = m.Lat, m.Lon
+			d.Region = regionContaining(*m.Lat, *m.Lon)
+		}
+		if m.Alt != nil {
+			d.AltM = m.Alt
+		}
+		if m.Heading != nil {
+			d.Heading = m.Heading
+		}
+		if m.Speed != nil {
+			d.SpeedMS = m.Speed
+		}
+		if m.Battery != nil {
+			d.Battery = m.Battery
+		}
+		if m.Status != "" {
+			d.Status = m.Status
+		}
+		now := time.Now().UTC()
+		d.Link, d.LastSeen = link, &now
+		t.mu.Unlock()
+		return nil
+
+	case "ack":
+		if !droneAckStates[m.Status] {
+			return fmt.Errorf("unknown command status %q", m.Status)
+		}
+		t.mu.Lock()
+		cmd, ok := t.commands[m.CommandID]
+		if !ok || cmd.Drone != id {
+			t.mu.Unlock()
+			return fmt.Errorf("unknown command %q", m.CommandID)
+		}
+		if commandFinal(cmd.State) {
+			t.mu.Unlock()
+			return nil // e.g. "completed" for a command already superseded
+		}
+		t.transition(cmd, m.Status, m.Detail)
+		if commandFinal(cmd.State) && t.drones[id].Command == cmd.ID {
+			t.drones[id].Command = ""
+		}
+		now := time.Now().UTC()
+		t.drones[id].LastSeen = &now
+		snapshot := cmd.snapshot()
+		t.mu.Unlock()
+		droneLog.Info("Tasking command acknowledged", "drone", id, "command", cmd.ID, "state", m.Status, "detail", m.Detail)
+		broadcastTaskingCommand(snapshot)
+		return nil
+	}
+	return fmt.Errorf("unknown message type %q", m.Type)
+}
+
+// regionContaining returns the region whose bounding box holds a position,
+// or "" if none does.
+func regionContaining(lat, lon float64) string {
+	for name, r := range regions {
+		if lat >= r.MinLat && lat <= r.MaxLat && lon >= r.MinLon && lon <= r.MaxLon {
+			return name
+		}
+	}
+	return ""
+}
+
+// transition records a state change; the caller holds t.mu.
+func (t *Tasking) transition(cmd *TaskingCommand, state, detail string) {
+	now := time.Now().UTC()
+	cmd.State, cmd.Detail, cmd.Updated = state, detail, now
+	if state == commandSent {
+		cmd.SentAt = &now
+	}
+	cmd.History = append(cmd.History, CommandEvent{State: state, At: now, Detail: detail})
+}
+
+// order is what the drone is sent: the command without its bookkeeping.
+func (c *TaskingCommand) order() map[string]interface{} {
+	o := map[string]interface{}{"id": c.ID, "kind": c.Kind, "lat": c.Lat, "lon": c.Lon}
+	if c.AltM != nil {
+		o["altM"] = *c.AltM
+	}
+	if c.RadiusM != 0 {
+		o["radiusM"] = c.RadiusM
+	}
+	if c.Target != nil {
+		o["target"] = c.Target
+	}
+	return o
+}
+
+func (c *TaskingCommand) snapshot() TaskingCommand {
+	s := *c
+	s.History = append([]CommandEvent(nil), c.History...)
+	return s
+}
+
+// TaskingRequest is the body of POST /api/tasking.
+type TaskingRequest struct {
+	Drone   string   `json:"drone"`
+	Kind    string   `json:"kind"`
+	Lat     *float64 `json:"lat"`
+	Lon     *float64 `json:"lon"`
+	AltM    *float64 `json:"altM"`
+	RadiusM float64  `json:"radiusM"`
+	Contact string   `json:"contact"`
+}
+
+// Issue validates and queues a command, superseding the drone's active
+// one, and sends it if the drone is reachable.
+func (t *Tasking) Issue(req TaskingRequest, by string) (TaskingCommand, error) {
+	if !t.registered[req.Drone] {
+		return TaskingCommand{}, fmt.Errorf("unknown drone %q", req.Drone)
+	}
+	cmd := &TaskingCommand{Drone: req.Drone, Kind: req.Kind, AltM: req.AltM, IssuedBy: by}
+	switch req.Kind {
+	case taskGoto, taskOrbit:
+		if req.Lat == nil || req.Lon == nil {
+			return TaskingCommand{}, fmt.Errorf("%s needs lat and lon", req.Kind)
+		}
+		if math.Abs(*req.Lat) > 90 || math.Abs(*req.Lon) > 180 {
+			return TaskingCommand{}, errors.New("lat or lon out of range")
+		}
+		cmd.Lat, cmd.Lon = *req.Lat, *req.Lon
+		if req.Kind == taskOrbit {
+			cmd.RadiusM = req.RadiusM
+			if cmd.RadiusM == 0 {
+				cmd.RadiusM = taskingDefaultOrbitM
+			}
+			if cmd.RadiusM < 0 {
+				return TaskingCommand{}, errors.New("radiusM must be positive")
+			}
+		}
+	case taskInvestigate:
+		target, ok := findContact(req.Contact)
+		if !ok {
+			return TaskingCommand{}, fmt.Errorf("contact %q is not in the air picture", req.Contact)
+		}
+		cmd.Contact, cmd.Target = target.ICAO24, target
+		cmd.Lat, cmd.Lon = target.Lat, target.Lon
+		if cmd.AltM == nil {
+			cmd.AltM = target.AltM
+		}
+	default:
+		return TaskingCommand{}, fmt.Errorf("unknown kind %q (want goto, orbit, or investigate)", req.Kind)
+	}
+
+	raw := make([]byte, 8)
+	rand.Read(raw)
+	cmd.ID = hex.EncodeToString(raw)
+	cmd.IssuedAt = time.Now().UTC()
+
+	t.mu.Lock()
+	var superseded *TaskingCommand
+	if prev, ok := t.commands[t.drones[req.Drone].Command]; ok && !commandFinal(prev.State) {
+		t.transition(prev, commandSuperseded, "superseded by "+cmd.ID)
+		s := prev.snapshot()
+		superseded = &s
+	}
+	t.transition(cmd, commandQueued, "")
+	t.commands[cmd.ID] = cmd
+	t.order = append(t.order, cmd.ID)
+	t.drones[req.Drone].Command = cmd.ID
+	t.trim()
+	t.mu.Unlock()
+
+	if superseded != nil {
+		broadcastTaskingCommand(*superseded)
+	}
+	droneLog.Info("Tasking command issued", "drone", cmd.Drone, "command", cmd.ID, "kind", cmd.Kind, "by", by)
+	t.flushQueued(req.Drone)
+	return t.Get(cmd.ID)
+}
+
+// findContact looks an aircraft up by ICAO24 in every region's current
+// picture.
+func findContact(icao24 string) (*TaskingTarget, bool) {
+	icao24 = strings.ToLower(strings.TrimSpace(icao24))
+	if icao24 == "" {
+		return nil, false
+	}
+	for name := range regions {
+		data := currentAirspace(name)
+		for _, ac := range data.Aircraft {
+			if ac.ICAO24 != icao24 || ac.Latitude == nil || ac.Longitude == nil {
+				continue
+			}
+			alt := ac.GeoAltitude
+			if alt == nil {
+				alt = ac.BaroAltitude
+			}
+			return &TaskingTarget{ICAO24: ac.ICAO24, Callsign: strings.TrimSpace(ac.Callsign), Region: name,
+				Lat: *ac.Latitude, Lon: *ac.Longitude, AltM: alt, Seen: data.Timestamp}, true
+		}
+	}
+	return nil, false
+}
+
+// trim forgets the oldest finished commands beyond taskingMaxCommands; the
+// caller holds t.mu.
+func (t *Tasking) trim() {
+	excess := len(t.order) - taskingMaxCommands
+	if excess <= 0 {
+		return
+	}
+	kept := t.order[:0]
+	for _, id := range t.order {
+		if excess > 0 && commandFinal(t.commands[id].State) {
+			delete(t.commands, id)
+			excess--
+			continue
+		}
+		kept = append(kept, id)
+	}
+	t.order = kept
+}
+
+// Cancel ends an active command and tells the drone.
+func (t *Tasking) Cancel(id, by string) (TaskingCommand, error) {
+	t.mu.Lock()
+	cmd, ok := t.commands[id]
+	if !ok {
+		t.mu.Unlock()
+		return TaskingCommand{}, errTaskingNotFound
+	}
+	if commandFinal(cmd.State) {
+		t.mu.Unlock()
+		return TaskingCommand{}, fmt.Errorf("command is already %s", cmd.State)
+	}
+	wasQueued := cmd.State == commandQueued
+	t.transition(cmd, commandCancelled, "cancelled by "+by)
+	if t.drones[cmd.Drone].Command == id {
+		t.drones[cmd.Drone].Command = ""
+	}
+	snapshot := cmd.snapshot()
+	t.mu.Unlock()
+
+	if !wasQueued {
+		if err := t.send(cmd.Drone, map[string]interface{}{"type": "cancel", "commandId": id}); err != nil {
+			droneLog.Warn("Could not send cancel to drone", "drone", cmd.Drone, "command", id, "err", err)
+		}
+	}
+	droneLog.Info("Tasking command cancelled", "drone", cmd.Drone, "command", id, "by", by)
+	broadcastTaskingCommand(snapshot)
+	return snapshot, nil
+}
+
+var errTaskingNotFound = errors.New("command not found")
+
+// Get returns a command by ID.
+func (t *Tasking) Get(id string) (TaskingCommand, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	cmd, ok := t.commands[id]
+	if !ok {
+		return TaskingCommand{}, errTaskingNotFound
+	}
+	return cmd.snapshot(), nil
+}
+
+// Commands returns commands newest first, optionally for one drone and
+// only those not yet finished.
+func (t *Tasking) Commands(drone string, activeOnly bool) []TaskingCommand {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]TaskingCommand, 0)
+	for i := len(t.order) - 1; i >= 0; i-- {
+		cmd := t.commands[t.order[i]]
+		if (drone != "" && cmd.Drone != drone) || (activeOnly && commandFinal(cmd.State)) {
+			continue
+		}
+		out = append(out, cmd.snapshot())
+	}
+	return out
+}
+
+// Drones returns every registered drone's track, by ID.
+func (t *Tasking) Drones() []DroneTrack {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.tracksLocked(time.Now(), "")
+}
+
+// tracksLocked snapshots the tracks, optionally only those in one region;
+// the caller holds t.mu.
+func (t *Tasking) tracksLocked(now time.Time, region string) []DroneTrack {
+	out := make([]DroneTrack, 0, len(t.drones))
+	for id, d := range t.drones {
+		if region != "" && d.Region != region {
+			continue
+		}
+		track := *d
+		track.Online = t.links[id] != nil || (d.LastSeen != nil && now.Sub(*d.LastSeen) < taskingTelemetryTTL)
+		out = append(out, track)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// flushQueued sends queued commands to one drone, or to all when drone is
+// empty, oldest first.
+func (t *Tasking) flushQueued(drone string) {
+	t.mu.Lock()
+	type pendingCommand struct {
+		id, drone string
+		order     map[string]interface{}
+	}
+	var pending []pendingCommand
+	for _, id := range t.order {
+		if cmd := t.commands[id]; cmd.State == commandQueued && (drone == "" || cmd.Drone == drone) {
+			pending = append(pending, pendingCommand{cmd.ID, cmd.Drone, cmd.order()})
+		}
+	}
+	t.mu.Unlock()
+
+	for _, cmd := range pending {
+		if err := t.send(cmd.drone, map[string]interface{}{"type": "command", "command": cmd.order}); err != nil {
+			continue // stays queued until the drone connects
+		}
+		t.mu.Lock()
+		live := t.commands[cmd.id]
+		if live == nil || live.State != commandQueued {
+			t.mu.Unlock()
+			continue
+		}
+		t.transition(live, commandSent, "")
+		snapshot := live.snapshot()
+		t.mu.Unlock()
+		broadcastTaskingCommand(snapshot)
+	}
+}
+
+var errDroneUnreachable = errors.New("drone is not connected")
+
+// send delivers a message over the drone's WebSocket if it has one, or
+// MQTT otherwise.
+func (t *Tasking) send(drone string, msg interface{}) error {
+	t.mu.Lock()
+	link, broker := t.links[drone], t.mqtt
+	t.mu.Unlock()
+	if link != nil {
+		return link.send(msg)
+	}
+	if broker == nil {
+		return errDroneUnreachable
+	}
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return broker.Publish(t.topic+"/"+drone+"/command", payload)
+}
+
+// expire times out commands sent longer than the ack timeout ago.
+func (t *Tasking) expire(now time.Time) {
+	var expired []TaskingCommand
+	t.mu.Lock()
+	for _, id := range t.order {
+		cmd := t.commands[id]
+		if cmd.State == commandSent && now.Sub(*cmd.SentAt) > t.ackTimeout {
+			t.transition(cmd, commandTimedOut, fmt.Sprintf("no acknowledgment within %s", t.ackTimeout))
+			expired = append(expired, cmd.snapshot())
+		}
+	}
+	t.mu.Unlock()
+	for _, cmd := range expired {
+		droneLog.Warn("Tasking command timed out", "drone", cmd.Drone, "command", cmd.ID)
+		broadcastTaskingCommand(cmd)
+	}
+}
+
+// broadcastTracks sends each region's WebSocket clients the friendly drones
+// in it.
+func (t *Tasking) broadcastTracks(now time.Time) {
+	t.mu.Lock()
+	byRegion := make(map[string][]DroneTrack)
+	for _, track := range t.tracksLocked(now, "") {
+		if track.Region != "" && track.Online {
+			byRegion[track.Region] = append(byRegion[track.Region], track)
+		}
+	}
+	t.mu.Unlock()
+
+	for region, tracks := range byRegion {
+		msg := map[string]interface{}{"type": "friendly_tracks", "region": region, "tracks": tracks, "timestamp": now.Unix()}
+		recorder.Broadcast(region, msg)
+		clientsMutex.RLock()
+		for conn, clientRegion := range clients {
+			if clientRegion == region {
+				if err := conn.send(msg); err != nil {
+					wsLog.Warn("Write friendly tracks to client failed", "err", err)
+				}
+			}
+		}
+		clientsMutex.RUnlock()
+	}
+}
+
+// broadcastTaskingCommand tells every WebSocket client about a command's
+// new state.
+func broadcastTaskingCommand(cmd TaskingCommand) {
+	msg := map[string]interface{}{"type": "tasking_command", "command": cmd}
+	recorder.Broadcast("", msg)
+	clientsMutex.RLock()
+	defer clientsMutex.RUnlock()
+	for conn := range clients {
+		if err := conn.send(msg); err != nil {
+			wsLog.Warn("Write tasking update to client failed", "err", err)
+		}
+	}
+}
+
+// conns returns the drones' WebSocket connections, for closing at shutdown.
+func (t *Tasking) conns() []*websocket.Conn {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]*websocket.Conn, 0, len(t.links))
+	for _, l := range t.links {
+		out = append(out, l.conn)
+	}
+	return out
+}
+
+// authorizeDrone checks a drone's token.
+func (t *Tasking) authorizeDrone(id, token string) bool {
+	want, ok := t.tokens[id]
+	got := sha256.Sum256([]byte(token))
+	return ok && subtle.ConstantTimeCompare(want[:], got[:]) == 1
+}
+
+// handleTaskingWebSocket is the drones' own link: /ws/tasking?drone=ID
+// with the drone's token as a Bearer header or ?token=. It is outside
+// requireAuth, since drones hold tokens rather than API keys.
+func handleTaskingWebSocket(w http.ResponseWriter, r *http.Request) {
+	if tasking == nil {
+		http.Error(w, "Drone tasking not configured", http.StatusServiceUnavailable)
+		return
+	}
+	id := r.URL.Query().Get("drone")
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" {
+		token = r.URL.Query().Get("token")
+	}
+	wlog := requestLog(droneLog, r).With("remote", clientIP(r), "drone", id)
+	if !tasking.authorizeDrone(id, token) {
+		wlog.Warn("Refused drone link: unknown drone or bad token")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		wlog.Warn("Drone link upgrade failed", "err", err)
+		return
+	}
+
+	link := &droneLink{conn: conn}
+	tasking.mu.Lock()
+	if old := tasking.links[id]; old != nil {
+		closeWebSocket(old.conn, websocket.ClosePolicyViolation, "replaced by a new connection")
+	}
+	tasking.links[id] = link
+	tasking.mu.Unlock()
+	wlog.Info("Drone link connected")
+	auditLog.Record(r, "tasking.connect", map[string]interface{}{"drone": id})
+
+	defer func() {
+		tasking.mu.Lock()
+		if tasking.links[id] == link {
+			delete(tasking.links, id)
+		}
+		tasking.mu.Unlock()
+		conn.Close()
+		wlog.Info("Drone link disconnected")
+	}()
+
+	link.send(map[string]interface{}{"type": "hello", "drone": id, "ackTimeoutSeconds": tasking.ackTimeout.Seconds()})
+	tasking.flushQueued(id)
+
+	for {
+		touchWebSocket(conn)
+		_, raw, err := conn.ReadMessage()
+		if err != nil {
+			closeIfIdle(conn, err)
+			return
+		}
+		var m droneMessage
+		if err := json.Unmarshal(raw, &m); err != nil {
+			link.send(map[string]interface{}{"type": "error", "error": "invalid JSON: " + err.Error()})
+			continue
+		}
+		if err := tasking.receive(id, "websocket", m); err != nil {
+			link.send(map[string]interface{}{"type": "error", "error": err.Error()})
+		}
+	}
+}
+
+// handleTasking serves GET (list commands) and POST (issue a command) on
+// /api/tasking.
+func handleTasking(w http.ResponseWriter, r *http.Request) {
+	if tasking == nil {
+		http.Error(w, "Drone tasking not configured", http.StatusServiceUnavailable)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tasking.Commands(q.Get("drone"), q.Get("active") == "true"))
+
+	case http.MethodPost:
+		var req TaskingRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		by := ""
+		if p := principalFrom(r); p != nil {
+			by = p.Name
+		}
+		cmd, err := tasking.Issue(req, by)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		auditLog.Record(r, "tasking.issue", map[string]interface{}{"id": cmd.ID, "drone": cmd.Drone, "kind": cmd.Kind, "contact": cmd.Contact})
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(cmd)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleTaskingAction serves GET /api/tasking/drones, GET
+// /api/tasking/{id}, and POST /api/tasking/{id}/cancel.
+func handleTaskingAction(w http.ResponseWriter, r *http.Request) {
+	if tasking == nil {
+		http.Error(w, "Drone tasking not configured", http.StatusServiceUnavailable)
+		return
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/tasking/"), "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "drones":
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tasking.Drones())
+
+	case len(parts) == 1 && parts[0] != "":
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		cmd, err := tasking.Get(parts[0])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(cmd)
+
+	case len(parts) == 2 && parts[1] == "cancel":
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		by := "anonymous"
+		if p := principalFrom(r); p != nil {
+			by = p.Name
+		}
+		cmd, err := tasking.Cancel(parts[0], by)
+		if errors.Is(err, errTaskingNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		auditLog.Record(r, "tasking.cancel", map[string]interface{}{"id": cmd.ID, "drone": cmd.Drone})
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(cmd)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
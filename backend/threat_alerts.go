@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// threatThreshold is one escalation step on the smoothed threat score.
+type threatThreshold struct {
+	Score    float64
+	Severity string
+}
+
+// regionThreatState is the smoothed score and current threshold band for a region.
+type regionThreatState struct {
+	smoothed    float64
+	initialized bool
+	band        int // number of thresholds currently exceeded
+}
+
+var (
+	threatThresholds = []threatThreshold{
+		{40, "MEDIUM"},
+		{60, "HIGH"},
+		{80, "CRITICAL"},
+	}
+	threatSmoothing  = 0.3 // EMA weight given to each new analysis
+	threatHysteresis = 5.0 // points below a threshold before it counts as crossed downward
+
+	threatStates      = make(map[string]*regionThreatState)
+	threatStatesMutex sync.Mutex
+)
+
+// loadThreatThresholdsFromEnv reads the threshold configuration.
+//
+//	THREAT_THRESHOLDS  — "40:MEDIUM,60:HIGH,80:CRITICAL"
+//	THREAT_SMOOTHING   — EMA alpha in (0, 1], 1 disables smoothing (default 0.3)
+//	THREAT_HYSTERESIS  — points below a threshold before de-escalating (default 5)
+func loadThreatThresholdsFromEnv() error {
+	if v := os.Getenv("THREAT_THRESHOLDS"); v != "" {
+		var parsed []threatThreshold
+		for _, part := range strings.Split(v, ",") {
+			scoreStr, sev, ok := strings.Cut(strings.TrimSpace(part), ":")
+			score, err := strconv.ParseFloat(scoreStr, 64)
+			sev = strings.ToUpper(sev)
+			if !ok || err != nil || threatRank[sev] == 0 {
+				return fmt.Errorf("invalid THREAT_THRESHOLDS entry %q (want score:SEVERITY)", part)
+			}
+			parsed = append(parsed, threatThreshold{score, sev})
+		}
+		sort.Slice(parsed, func(i, j int) bool { return parsed[i].Score < parsed[j].Score })
+		threatThresholds = parsed
+	}
+	if v := os.Getenv("THREAT_SMOOTHING"); v != "" {
+		alpha, err := strconv.ParseFloat(v, 64)
+		if err != nil || alpha <= 0 || alpha > 1 {
+			return fmt.Errorf("invalid THREAT_SMOOTHING %q (want 0 < alpha <= 1)", v)
+		}
+		threatSmoothing = alpha
+	}
+	if v := os.Getenv("THREAT_HYSTERESIS"); v != "" {
+		h, err := strconv.ParseFloat(v, 64)
+		if err != nil || h < 0 {
+			return fmt.Errorf("invalid THREAT_HYSTERESIS %q", v)
+		}
+		threatHysteresis = h
+	}
+	return nil
+}
+
+// evaluateThreatThresholds folds a new analysis into the region's smoothed
+// threat score and raises, updates, or resolves the region's threat alert
+// when the score crosses a threshold. Analyses that stay within a band do
+// not notify anyone.
+func evaluateThreatThresholds(region string, analysis *TacticalAnalysis) {
+	if analysis.OverallThreatLevel == "UNKNOWN" {
+		return // unparseable response, don't drag the score toward zero
+	}
+
+	threatStatesMutex.Lock()
+	state, ok := threatStates[region]
+	if !ok {
+		state = &regionThreatState{}
+		threatStates[region] = state
+	}
+	score := float64(analysis.ThreatScore)
+	if state.initialized {
+		state.smoothed = threatSmoothing*score + (1-threatSmoothing)*state.smoothed
+	} else {
+		state.smoothed = score
+		state.initialized = true
+	}
+	analysis.SmoothedThreatScore = state.smoothed
+
+	prevBand := state.band
+	for state.band < len(threatThresholds) && state.smoothed >= threatThresholds[state.band].Score {
+		state.band++
+	}
+	for state.band > 0 && state.smoothed < threatThresholds[state.band-1].Score-threatHysteresis {
+		state.band--
+	}
+	band, smoothed := state.band, state.smoothed
+	threatStatesMutex.Unlock()
+
+	key := "threat_threshold:" + region
+	if band == 0 {
+		if prevBand > 0 {
+			analyzerLog.Info("Threat score fell below lowest threshold", "region", region, "score", smoothed, "threshold", threatThresholds[0].Score)
+		}
+		alertMgr.Resolve(key)
+		return
+	}
+
+	threshold := threatThresholds[band-1]
+	direction := "steady"
+	if band > prevBand {
+		direction = "rising"
+	} else if band < prevBand {
+		direction = "falling"
+	}
+
+	observations := make([]string, 0, 3)
+	for _, obs := range analysis.KeyObservations {
+		if desc := stringField(obs, "description"); desc != "" {
+			observations = append(observations, desc)
+		}
+		if len(observations) == 3 {
+			break
+		}
+	}
+
+	alertMgr.Raise(Alert{
+		Key:      key,
+		Kind:     "threat_threshold",
+		Region:   region,
+		Severity: threshold.Severity,
+		Title:    fmt.Sprintf("%s threat level in %s (score %.0f)", threshold.Severity, region, smoothed),
+		Message:  analysis.Summary,
+		Details: map[string]interface{}{
+			"smoothedScore":   smoothed,
+			"rawScore":        analysis.ThreatScore,
+			"threshold":       threshold.Score,
+			"direction":       direction,
+			"overallLevel":    analysis.OverallThreatLevel,
+			"summary":         analysis.Summary,
+			"topObservations": observations,
+		},
+	})
+}
+
+// analysisThreats maps icao24 to the threat level from the region's latest analysis.
+func analysisThreats(region string) map[string]string {
+	analysisCacheMutex.RLock()
+	analysis := analysisCache[region]
+	analysisCacheMutex.RUnlock()
+
+	threats := make(map[string]string)
+	if analysis == nil {
+		return threats
+	}
+	for _, aoi := range analysis.AircraftOfInterest {
+		if icao24 := stringField(aoi, "icao24"); icao24 != "" {
+			threats[icao24] = strings.ToUpper(stringField(aoi, "threat_level"))
+		}
+	}
+	return threats
+}
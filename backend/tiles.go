@@ -0,0 +1,353 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxTileBytes caps one upstream tile; raster tiles are a few hundred KB at
+// most.
+const maxTileBytes = 8 << 20
+
+// errTileNotFound is an upstream 404: the provider has no tile there.
+var errTileNotFound = errors.New("tile not found")
+
+// TileProxy serves slippy-map tiles from one upstream provider through a
+// disk cache, so browsers never contact the tile CDN and never see its API
+// key. Cached tiles are kept past their TTL and served stale when the
+// provider can't be reached.
+type TileProxy struct {
+	template   string
+	subdomains []string
+	key        string
+	maxZoom    int
+	ttl        time.Duration
+	maxBytes   int64 // 0 means unbounded
+	dir        string
+	client     *http.Client
+	next       atomic.Uint32 // subdomain rotation
+	size       atomic.Int64  // cache size as of the last eviction, plus tiles since
+	evicting   atomic.Bool
+
+	mu       sync.Mutex
+	inflight map[string]*tileFetch
+}
+
+// tileFetch is one upstream request that concurrent misses for the same
+// tile wait on.
+type tileFetch struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+var tileProxy *TileProxy
+
+// newTileProxyFromEnv caches under dataDir/tiles. Returns nil when TILE_URL
+// is unset.
+//
+//	TILE_URL          — provider template with {z}, {x}, {y}, and optionally {s} and {key},
+//	                    e.g. https://{s}.basemaps.cartocdn.com/dark_nolabels/{z}/{x}/{y}@2x.png
+//	TILE_API_KEY      — substituted for {key} (or TILE_API_KEY_FILE)
+//	TILE_SUBDOMAINS   — values for {s}, one per character (default abc)
+//	TILE_MAX_ZOOM     — highest zoom served (default 19)
+//	TILE_CACHE_TTL    — how long a cached tile is fresh (default 720h)
+//	TILE_CACHE_MAX_MB — cache size limit; the oldest tiles are evicted first (default 1024, 0 is unlimited)
+func newTileProxyFromEnv(dataDir string) (*TileProxy, error) {
+	tmpl := os.Getenv("TILE_URL")
+	if tmpl == "" {
+		return nil, nil
+	}
+	for _, p := range []string{"{z}", "{x}", "{y}"} {
+		if !strings.Contains(tmpl, p) {
+			return nil, fmt.Errorf("TILE_URL: missing %s placeholder", p)
+		}
+	}
+	if !strings.HasPrefix(tmpl, "https://") && !strings.HasPrefix(tmpl, "http://") {
+		return nil, fmt.Errorf("TILE_URL: must be an http(s) URL")
+	}
+	p := &TileProxy{
+		template: tmpl,
+		key:      getSecret("TILE_API_KEY"),
+		maxZoom:  19,
+		ttl:      30 * 24 * time.Hour,
+		maxBytes: 1024 << 20,
+		dir:      filepath.Join(dataDir, "tiles"),
+		client:   &http.Client{Timeout: 20 * time.Second},
+		inflight: make(map[string]*tileFetch),
+	}
+	if strings.Contains(tmpl, "{key}") && p.key == "" {
+		return nil, errors.New("TILE_URL has a {key} placeholder but TILE_API_KEY is unset")
+	}
+	subdomains := os.Getenv("TILE_SUBDOMAINS")
+	if subdomains == "" {
+		subdomains = "abc"
+	}
+	for _, c := range subdomains {
+		p.subdomains = append(p.subdomains, string(c))
+	}
+	if v := os.Getenv("TILE_MAX_ZOOM"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > 22 {
+			return nil, fmt.Errorf("TILE_MAX_ZOOM: must be from 0 to 22, got %q", v)
+		}
+		p.maxZoom = n
+	}
+	if v := os.Getenv("TILE_CACHE_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < time.Minute {
+			return nil, fmt.Errorf("TILE_CACHE_TTL: must be a duration of at least 1m, got %q", v)
+		}
+		p.ttl = d
+	}
+	if v := os.Getenv("TILE_CACHE_MAX_MB"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("TILE_CACHE_MAX_MB: invalid size %q", v)
+		}
+		p.maxBytes = n << 20
+	}
+	if err := os.MkdirAll(p.dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create tile cache dir: %w", err)
+	}
+	return p, nil
+}
+
+// upstreamURL fills in the template for one tile.
+func (p *TileProxy) upstreamURL(z, x, y int) string {
+	s := p.subdomains[int(p.next.Add(1))%len(p.subdomains)]
+	return strings.NewReplacer(
+		"{z}", strconv.Itoa(z), "{x}", strconv.Itoa(x), "{y}", strconv.Itoa(y),
+		"{s}", s, "{key}", p.key,
+	).Replace(p.template)
+}
+
+// redact keeps the provider key out of errors, which include the URL.
+func (p *TileProxy) redact(err error) string {
+	if p.key == "" {
+		return err.Error()
+	}
+	return strings.ReplaceAll(err.Error(), p.key, "REDACTED")
+}
+
+func (p *TileProxy) path(z, x, y int) string {
+	return filepath.Join(p.dir, strconv.Itoa(z), strconv.Itoa(x), strconv.Itoa(y))
+}
+
+// Tile returns a tile's bytes and where they came from: "HIT", "MISS", or
+// "STALE" (expired, and the provider failed).
+func (p *TileProxy) Tile(z, x, y int) ([]byte, string, error) {
+	path := p.path(z, x, y)
+	cached, cacheErr := os.ReadFile(path)
+	if cacheErr == nil {
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) < p.ttl {
+			return cached, "HIT", nil
+		}
+	}
+	data, err := p.fetch(z, x, y)
+	if err != nil {
+		if cacheErr == nil && !errors.Is(err, errTileNotFound) {
+			return cached, "STALE", nil
+		}
+		return nil, "", err
+	}
+	return data, "MISS", nil
+}
+
+// fetch downloads a tile into the cache. Concurrent requests for the same
+// tile share one upstream request.
+func (p *TileProxy) fetch(z, x, y int) ([]byte, error) {
+	id := fmt.Sprintf("%d/%d/%d", z, x, y)
+	p.mu.Lock()
+	if f, ok := p.inflight[id]; ok {
+		p.mu.Unlock()
+		<-f.done
+		return f.data, f.err
+	}
+	f := &tileFetch{done: make(chan struct{})}
+	p.inflight[id] = f
+	p.mu.Unlock()
+
+	f.data, f.err = p.download(z, x, y)
+	p.mu.Lock()
+	delete(p.inflight, id)
+	p.mu.Unlock()
+	close(f.done)
+	return f.data, f.err
+}
+
+func (p *TileProxy) download(z, x, y int) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, p.upstreamURL(z, x, y), nil)
+	if err != nil {
+		return nil, errors.New(p.redact(err))
+	}
+	req.Header.Set("User-Agent", "swarm-c2 tile proxy")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, errors.New(p.redact(err))
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusNoContent:
+		return nil, errTileNotFound
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("tile provider returned HTTP %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxTileBytes+1))
+	if err != nil {
+		return nil, errors.New(p.redact(err))
+	}
+	if len(data) > maxTileBytes {
+		return nil, fmt.Errorf("tile larger than %d bytes", maxTileBytes)
+	}
+
+	path := p.path(z, x, y)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+	if p.maxBytes > 0 && p.size.Add(int64(len(data))) > p.maxBytes {
+		go runRecovered("tiles", p.evict)
+	}
+	return data, nil
+}
+
+// Run evicts the oldest tiles while the cache is over TILE_CACHE_MAX_MB:
+// at startup, every 10 minutes, and as soon as new tiles take it over.
+func (p *TileProxy) Run() {
+	if p.maxBytes == 0 {
+		return
+	}
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+	for {
+		p.evict()
+		select {
+		case <-stopping:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// evict deletes the least recently fetched tiles until the cache is back
+// under 90% of its limit. One eviction runs at a time.
+func (p *TileProxy) evict() {
+	if !p.evicting.CompareAndSwap(false, true) {
+		return
+	}
+	defer p.evicting.Store(false)
+
+	type tileFile struct {
+		path    string
+		size    int64
+		fetched time.Time
+	}
+	var files []tileFile
+	var total int64
+	filepath.WalkDir(p.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		files = append(files, tileFile{path, info.Size(), info.ModTime()})
+		total += info.Size()
+		return nil
+	})
+	if total <= p.maxBytes {
+		p.size.Store(total)
+		return
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].fetched.Before(files[j].fetched) })
+	target, removed := p.maxBytes*9/10, 0
+	for _, f := range files {
+		if total <= target {
+			break
+		}
+		if err := os.Remove(f.path); err != nil {
+			serverLog.Warn("Tile cache eviction failed", "err", err)
+			continue
+		}
+		total -= f.size
+		removed++
+	}
+	p.size.Store(total)
+	serverLog.Info("Tile cache evicted", "tiles", removed, "size_mb", total>>20)
+}
+
+// parseTilePath splits "{z}/{x}/{y}" (y may carry an extension such as
+// .png) and checks the tile exists at that zoom.
+func parseTilePath(s string, maxZoom int) (z, x, y int, err error) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 3 {
+		return 0, 0, 0, errors.New("want /tiles/{z}/{x}/{y}")
+	}
+	parts[2], _, _ = strings.Cut(parts[2], ".")
+	var n [3]int
+	for i, part := range parts {
+		if n[i], err = strconv.Atoi(part); err != nil || n[i] < 0 {
+			return 0, 0, 0, errors.New("tile coordinates must be non-negative integers")
+		}
+	}
+	z, x, y = n[0], n[1], n[2]
+	if z > maxZoom {
+		return 0, 0, 0, fmt.Errorf("zoom above %d", maxZoom)
+	}
+	if x >= 1<<z || y >= 1<<z {
+		return 0, 0, 0, fmt.Errorf("tile outside zoom %d", z)
+	}
+	return z, x, y, nil
+}
+
+// handleTile serves one map tile through the cache.
+// GET /tiles/{z}/{x}/{y}
+func handleTile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if tileProxy == nil {
+		http.Error(w, "Tile proxy not configured", http.StatusServiceUnavailable)
+		return
+	}
+	z, x, y, err := parseTilePath(strings.TrimPrefix(r.URL.Path, "/tiles/"), tileProxy.maxZoom)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	data, cache, err := tileProxy.Tile(z, x, y)
+	if errors.Is(err, errTileNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		serverLog.Warn("Tile fetch failed", "z", z, "x", x, "y", y, "err", err)
+		http.Error(w, "Tile provider unavailable", http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", http.DetectContentType(data))
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	w.Header().Set("X-Cache", cache)
+	w.Write(data)
+}
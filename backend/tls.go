@@ -0,0 +1,168 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// TLSServer terminates HTTPS itself, with either certificate files or
+// certificates obtained from Let's Encrypt, and optionally redirects plain
+// HTTP to HTTPS.
+type TLSServer struct {
+	certs        *certFiles
+	manager      *autocert.Manager
+	redirectAddr string
+}
+
+// newTLSFromEnv returns nil when TLS is not configured.
+//
+//	TLS_CERT_FILE, TLS_KEY_FILE  — PEM certificate chain and key; reloaded when they change
+//	TLS_AUTOCERT_DOMAINS         — comma-separated hostnames to obtain Let's Encrypt certificates for
+//	TLS_AUTOCERT_EMAIL           — contact address for expiry notices (optional)
+//	HTTP_REDIRECT_ADDR           — plain HTTP listener that redirects to HTTPS and answers ACME
+//	                               challenges (default ":80"; "off" disables)
+func newTLSFromEnv(dataDir string) (*TLSServer, error) {
+	certFile, keyFile := os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE")
+	domains := splitList(os.Getenv("TLS_AUTOCERT_DOMAINS"))
+
+	t := &TLSServer{redirectAddr: ":80"}
+	switch {
+	case certFile != "" || keyFile != "":
+		if certFile == "" || keyFile == "" {
+			return nil, fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+		}
+		if len(domains) > 0 {
+			return nil, fmt.Errorf("use either TLS_CERT_FILE/TLS_KEY_FILE or TLS_AUTOCERT_DOMAINS, not both")
+		}
+		t.certs = &certFiles{certFile: certFile, keyFile: keyFile}
+		if _, err := t.certs.GetCertificate(nil); err != nil {
+			return nil, err
+		}
+	case len(domains) > 0:
+		t.manager = &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(domains...),
+			Cache:      autocert.DirCache(filepath.Join(dataDir, "autocert")),
+			Email:      os.Getenv("TLS_AUTOCERT_EMAIL"),
+		}
+	default:
+		return nil, nil
+	}
+
+	if v, ok := os.LookupEnv("HTTP_REDIRECT_ADDR"); ok {
+		t.redirectAddr = v
+	}
+	if t.redirectAddr == "off" {
+		t.redirectAddr = ""
+	}
+	if t.manager != nil && t.redirectAddr == "" {
+		serverLog.Warn("HTTP_REDIRECT_ADDR is off: Let's Encrypt must reach this server via TLS-ALPN on port 443")
+	}
+	return t, nil
+}
+
+// Mode describes the certificate source for the startup log.
+func (t *TLSServer) Mode() string {
+	if t.manager != nil {
+		return "Let's Encrypt"
+	}
+	return t.certs.certFile
+}
+
+// ListenAndServe serves handler over HTTPS on addr, plus the redirect
+// listener if configured.
+func (t *TLSServer) ListenAndServe(addr string, handler http.Handler) error {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	redirect := http.Handler(http.HandlerFunc(redirectToHTTPS(addr)))
+	if t.manager != nil {
+		cfg = t.manager.TLSConfig()
+		cfg.MinVersion = tls.VersionTLS12
+		redirect = t.manager.HTTPHandler(redirect)
+	} else {
+		cfg.GetCertificate = t.certs.GetCertificate
+	}
+
+	if t.redirectAddr != "" {
+		go func() {
+			serverLog.Info("Redirecting HTTP to HTTPS", "addr", t.redirectAddr)
+			srv := trackServer(&http.Server{Addr: t.redirectAddr, Handler: redirect, ReadHeaderTimeout: 10 * time.Second})
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				serverLog.Error("HTTP redirect listener stopped", "err", err)
+			}
+		}()
+	}
+
+	srv := trackServer(&http.Server{Addr: addr, Handler: handler, TLSConfig: cfg})
+	return srv.ListenAndServeTLS("", "")
+}
+
+// redirectToHTTPS sends clients to the same host and path on the HTTPS
+// listener.
+func redirectToHTTPS(httpsAddr string) http.HandlerFunc {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	}
+}
+
+// certFiles serves a certificate from disk and reloads it when either file's
+// modification time changes, so renewals (e.g. by certbot) need no restart.
+type certFiles struct {
+	certFile, keyFile string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+func (c *certFiles) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var latest time.Time
+	for _, path := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			if c.cert != nil {
+				return c.cert, nil // mid-renewal; keep serving the old one
+			}
+			return nil, fmt.Errorf("TLS certificate: %w", err)
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	if c.cert != nil && !latest.After(c.modTime) {
+		return c.cert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		if c.cert != nil {
+			serverLog.Warn("Reloading TLS certificate failed, keeping the old one", "err", err)
+			return c.cert, nil
+		}
+		return nil, fmt.Errorf("TLS certificate: %w", err)
+	}
+	if c.cert != nil {
+		serverLog.Info("Reloaded TLS certificate", "file", c.certFile)
+	}
+	c.cert, c.modTime = &cert, latest
+	return c.cert, nil
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OpenTelemetry span kinds and status codes, as numbered in OTLP.
+const (
+	SpanInternal = 1
+	SpanServer   = 2
+	SpanClient   = 3
+
+	spanStatusError = 2
+)
+
+// Span is one timed operation in a trace. Spans started from a request's
+// context join its trace, and the request's access log line breaks down
+// the time its child spans took.
+type Span struct {
+	name     string
+	kind     int
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	start    time.Time
+	end      time.Time
+	attrs    map[string]interface{}
+	err      error
+	request  *requestSpans // set on every span under a request
+}
+
+// requestSpans collects the finished child spans of one request.
+type requestSpans struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+type spanKey struct{}
+
+// startSpan starts a span as a child of the one in ctx, or a new trace.
+// Attributes are key, value pairs.
+func startSpan(ctx context.Context, name string, kind int, attrs ...any) (context.Context, *Span) {
+	s := &Span{name: name, kind: kind, start: time.Now(), attrs: make(map[string]interface{})}
+	rand.Read(s.spanID[:])
+	if parent, ok := ctx.Value(spanKey{}).(*Span); ok {
+		s.traceID, s.parentID, s.request = parent.traceID, parent.spanID, parent.request
+	} else {
+		rand.Read(s.traceID[:])
+	}
+	s.SetAttrs(attrs...)
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// SetAttrs adds key, value pairs to the span.
+func (s *Span) SetAttrs(attrs ...any) {
+	for i := 0; i+1 < len(attrs); i += 2 {
+		s.attrs[fmt.Sprint(attrs[i])] = attrs[i+1]
+	}
+}
+
+// End finishes the span, marking it failed if err is non-nil, and hands it
+// to the exporter.
+func (s *Span) End(err error) {
+	s.end = time.Now()
+	s.err = err
+	if s.request != nil && s.kind != SpanServer {
+		s.request.mu.Lock()
+		s.request.spans = append(s.request.spans, s)
+		s.request.mu.Unlock()
+	}
+	otlp.Export(s)
+}
+
+// Duration is how long the span ran.
+func (s *Span) Duration() time.Duration { return s.end.Sub(s.start) }
+
+// TraceID is the span's trace ID in hex.
+func (s *Span) TraceID() string { return hex.EncodeToString(s.traceID[:]) }
+
+// parseTraceparent reads a W3C traceparent header, so requests traced by a
+// proxy or frontend continue its trace here.
+func parseTraceparent(h string) (traceID [16]byte, parentID [8]byte, ok bool) {
+	parts := strings.Split(h, "-")
+	if len(parts) != 4 || parts[0] != "00" || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return traceID, parentID, false
+	}
+	if _, err := hex.Decode(traceID[:], []byte(parts[1])); err != nil {
+		return traceID, parentID, false
+	}
+	if _, err := hex.Decode(parentID[:], []byte(parts[2])); err != nil {
+		return traceID, parentID, false
+	}
+	return traceID, parentID, traceID != [16]byte{}
+}
+
+// OTLPExporter batches finished spans and posts them as OTLP/HTTP JSON to a
+// collector (Jaeger, Tempo, the OpenTelemetry Collector). A nil exporter
+// drops them.
+type OTLPExporter struct {
+	endpoint string
+	headers  map[string]string
+	service  string
+	client   *http.Client
+	queue    chan *Span
+}
+
+var otlp *OTLPExporter
+
+// newOTLPExporterFromEnv returns nil when OTEL_EXPORTER_OTLP_ENDPOINT is
+// unset.
+//
+//	OTEL_EXPORTER_OTLP_ENDPOINT — collector base URL, e.g. http://otel-collector:4318
+//	OTEL_EXPORTER_OTLP_HEADERS  — extra headers, "key=value,key=value"
+//	OTEL_SERVICE_NAME           — service.name resource attribute (default "swarm-c2")
+func newOTLPExporterFromEnv() (*OTLPExporter, error) {
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	if endpoint == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		return nil, fmt.Errorf("OTEL_EXPORTER_OTLP_ENDPOINT: %q is not an http(s) URL", endpoint)
+	}
+	e := &OTLPExporter{
+		endpoint: strings.TrimRight(endpoint, "/") + "/v1/traces",
+		headers:  make(map[string]string),
+		service:  os.Getenv("OTEL_SERVICE_NAME"),
+		client:   &http.Client{Timeout: 10 * time.Second},
+		queue:    make(chan *Span, 4096),
+	}
+	for _, kv := range splitList(getSecret("OTEL_EXPORTER_OTLP_HEADERS")) {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return nil, fmt.Errorf("OTEL_EXPORTER_OTLP_HEADERS: %q is not key=value", kv)
+		}
+		e.headers[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	if e.service == "" {
+		e.service = "swarm-c2"
+	}
+	return e, nil
+}
+
+// Export queues a finished span, dropping it if the queue is full.
+func (e *OTLPExporter) Export(s *Span) {
+	if e == nil {
+		return
+	}
+	select {
+	case e.queue <- s:
+	default:
+	}
+}
+
+// Run sends queued spans every 5 seconds, or sooner when 512 are waiting,
+// and once more on shutdown.
+func (e *OTLPExporter) Run() {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	var batch []*Span
+	for {
+		select {
+		case <-stopping:
+			for len(e.queue) > 0 {
+				batch = append(batch, <-e.queue)
+			}
+			e.send(batch)
+			return
+		case s := <-e.queue:
+			if batch = append(batch, s); len(batch) < 512 {
+				continue
+			}
+		case <-ticker.C:
+		}
+		e.send(batch)
+		batch = batch[:0]
+	}
+}
+
+func (e *OTLPExporter) send(batch []*Span) {
+	if len(batch) == 0 {
+		return
+	}
+	spans := make([]map[string]interface{}, len(batch))
+	for i, s := range batch {
+		span := map[string]interface{}{
+			"traceId":           hex.EncodeToString(s.traceID[:]),
+			"spanId":            hex.EncodeToString(s.spanID[:]),
+			"name":              s.name,
+			"kind":              s.kind,
+			"startTimeUnixNano": fmt.Sprint(s.start.UnixNano()),
+			"endTimeUnixNano":   fmt.Sprint(s.end.UnixNano()),
+			"attributes":        otlpAttributes(s.attrs),
+		}
+		if s.parentID != [8]byte{} {
+			span["parentSpanId"] = hex.EncodeToString(s.parentID[:])
+		}
+		if s.err != nil {
+			span["status"] = map[string]interface{}{"code": spanStatusError, "message": s.err.Error()}
+		}
+		spans[i] = span
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"resourceSpans": []map[string]interface{}{{
+			"resource":   map[string]interface{}{"attributes": otlpAttributes(map[string]interface{}{"service.name": e.service})},
+			"scopeSpans": []map[string]interface{}{{"scope": map[string]string{"name": "swarm-c2"}, "spans": spans}},
+		}},
+	})
+	if err != nil {
+		return
+	}
+	req, err := http.NewRequest(http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		serverLog.Warn("Trace export failed", "spans", len(batch), "err", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		serverLog.Warn("Trace export rejected", "spans", len(batch), "status", resp.StatusCode)
+	}
+}
+
+func otlpAttributes(attrs map[string]interface{}) []map[string]interface{} {
+	out := make([]map[string]interface{}, 0, len(attrs))
+	for k, v := range attrs {
+		var value map[string]interface{}
+		switch v := v.(type) {
+		case string:
+			value = map[string]interface{}{"stringValue": v}
+		case bool:
+			value = map[string]interface{}{"boolValue": v}
+		case int:
+			value = map[string]interface{}{"intValue": fmt.Sprint(v)}
+		case int64:
+			value = map[string]interface{}{"intValue": fmt.Sprint(v)}
+		case float64:
+			value = map[string]interface{}{"doubleValue": v}
+		default:
+			value = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+		}
+		out = append(out, map[string]interface{}{"key": k, "value": value})
+	}
+	return out
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// TrackRecord is the registry's memory of one aircraft in one region.
+type TrackRecord struct {
+	ICAO24    string    `json:"icao24"`
+	Callsign  string    `json:"callsign"`
+	Region    string    `json:"region"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+	Last      Aircraft  `json:"last"` // most recent state report
+
+	seeded bool // already present in the first picture, so not a new contact
+}
+
+// TrackRegistry remembers when each aircraft was first and last seen per
+// region. An aircraft not seen for longer than forgetAfter is forgotten, so
+// its next appearance counts as a new contact again.
+type TrackRegistry struct {
+	mu          sync.RWMutex
+	regions     map[string]map[string]*TrackRecord // region -> icao24 -> record
+	seeded      map[string]bool
+	forgetAfter time.Duration
+}
+
+var trackRegistry = NewTrackRegistry(6 * time.Hour)
+
+// NewTrackRegistry creates a first-seen registry.
+func NewTrackRegistry(forgetAfter time.Duration) *TrackRegistry {
+	return &TrackRegistry{
+		regions:     make(map[string]map[string]*TrackRecord),
+		seeded:      make(map[string]bool),
+		forgetAfter: forgetAfter,
+	}
+}
+
+// Observe records a region's latest picture and returns the aircraft that
+// appeared for the first time. The first picture after startup only seeds
+// the registry, so a restart does not report every aircraft as new.
+func (r *TrackRegistry) Observe(region string, aircraft []Aircraft) []Aircraft {
+	now := time.Now().UTC()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tracks, ok := r.regions[region]
+	if !ok {
+		tracks = make(map[string]*TrackRecord)
+		r.regions[region] = tracks
+	}
+
+	var newContacts []Aircraft
+	for _, ac := range aircraft {
+		rec, exists := tracks[ac.ICAO24]
+		if !exists {
+			rec = &TrackRecord{ICAO24: ac.ICAO24, Region: region, FirstSeen: now, seeded: !r.seeded[region]}
+			tracks[ac.ICAO24] = rec
+			if r.seeded[region] {
+				newContacts = append(newContacts, ac)
+			}
+		}
+		if cs := strings.TrimSpace(ac.Callsign); cs != "" {
+			rec.Callsign = cs
+		}
+		rec.LastSeen = now
+		rec.Last = ac
+	}
+	r.seeded[region] = true
+
+	for icao24, rec := range tracks {
+		if now.Sub(rec.LastSeen) > r.forgetAfter {
+			delete(tracks, icao24)
+		}
+	}
+	return newContacts
+}
+
+// Get returns the registry record for an aircraft in a region.
+func (r *TrackRegistry) Get(region, icao24 string) (TrackRecord, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if rec, ok := r.regions[region][icao24]; ok {
+		return *rec, true
+	}
+	return TrackRecord{}, false
+}
+
+// Records returns a snapshot of every record in a region.
+func (r *TrackRegistry) Records(region string) []TrackRecord {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	result := make([]TrackRecord, 0, len(r.regions[region]))
+	for _, rec := range r.regions[region] {
+		result = append(result, *rec)
+	}
+	return result
+}
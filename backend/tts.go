@@ -0,0 +1,462 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxSpeechBytes caps one synthesized clip.
+const maxSpeechBytes = 16 << 20
+
+// openAISpeechURL is OpenAI's text-to-speech endpoint.
+const openAISpeechURL = "https://api.openai.com/v1/audio/speech"
+
+// speechExtensions names clip files by audio type, and speechTypes reads
+// the type back when serving them.
+var (
+	speechExtensions = map[string]string{"audio/mpeg": ".mp3", "audio/wav": ".wav", "audio/ogg": ".ogg", "application/ogg": ".ogg", "audio/aiff": ".aiff", "audio/basic": ".au"}
+	speechTypes      = map[string]string{".mp3": "audio/mpeg", ".wav": "audio/wav", ".ogg": "audio/ogg", ".aiff": "audio/aiff", ".au": "audio/basic"}
+)
+
+// speechEngine turns text into audio.
+type speechEngine interface {
+	Name() string // identifies the engine and voice, so a change makes new clips
+	Synthesize(ctx context.Context, text string) (audio []byte, contentType string, err error)
+}
+
+// AlertSpeech speaks alerts at or above a severity. Each alert gets an audio
+// URL derived from what it says, and the clip is synthesized on first
+// request. The region's leader synthesizes it as soon as the alert opens;
+// with TTS_STREAM, any replica also does so to push the audio to its own
+// WebSocket clients.
+type AlertSpeech struct {
+	engine      speechEngine
+	minSeverity string
+	stream      bool
+	retention   time.Duration
+	timeout     time.Duration
+	dir         string
+
+	mu       sync.Mutex
+	texts    map[string]speechText // clip id -> what it says
+	inflight map[string]*speechFetch
+}
+
+type speechText struct {
+	text string
+	at   time.Time
+}
+
+// speechFetch is one synthesis that concurrent requests for the same clip
+// wait on.
+type speechFetch struct {
+	done        chan struct{}
+	audio       []byte
+	contentType string
+	err         error
+}
+
+var alertSpeech *AlertSpeech
+
+// newAlertSpeechFromEnv stores clips under dataDir/tts. Returns nil when
+// TTS_ENGINE is unset.
+//
+//	TTS_ENGINE       — openai or command
+//	OPENAI_API_KEY   — for openai (or OPENAI_API_KEY_FILE)
+//	TTS_MODEL        — openai model (default tts-1)
+//	TTS_VOICE        — openai voice (default onyx)
+//	TTS_COMMAND      — for command: reads text on stdin and writes audio to stdout,
+//	                   e.g. "espeak-ng --stdin --stdout" or "piper --model en_US-ryan-high.onnx --output_file -"
+//	TTS_MIN_SEVERITY — lowest severity spoken (default CRITICAL)
+//	TTS_STREAM       — true to push clips to WebSocket clients as alert_audio messages
+//	TTS_TIMEOUT      — how long one synthesis may take (default 20s)
+//	TTS_RETENTION    — how long clips are kept (default 168h)
+func newAlertSpeechFromEnv(dataDir string) (*AlertSpeech, error) {
+	s := &AlertSpeech{
+		minSeverity: "CRITICAL",
+		stream:      os.Getenv("TTS_STREAM") == "true",
+		retention:   7 * 24 * time.Hour,
+		timeout:     20 * time.Second,
+		dir:         filepath.Join(dataDir, "tts"),
+		texts:       make(map[string]speechText),
+		inflight:    make(map[string]*speechFetch),
+	}
+	switch engine := os.Getenv("TTS_ENGINE"); engine {
+	case "":
+		return nil, nil
+	case "openai":
+		key := getSecret("OPENAI_API_KEY")
+		if key == "" {
+			return nil, errors.New("TTS_ENGINE=openai needs OPENAI_API_KEY")
+		}
+		e := &openAISpeech{key: key, model: "tts-1", voice: "onyx", client: &http.Client{}}
+		if v := os.Getenv("TTS_MODEL"); v != "" {
+			e.model = v
+		}
+		if v := os.Getenv("TTS_VOICE"); v != "" {
+			e.voice = v
+		}
+		s.engine = e
+	case "command":
+		argv := strings.Fields(os.Getenv("TTS_COMMAND"))
+		if len(argv) == 0 {
+			return nil, errors.New("TTS_ENGINE=command needs TTS_COMMAND")
+		}
+		s.engine = &commandSpeech{argv: argv}
+	default:
+		return nil, fmt.Errorf("TTS_ENGINE: unknown engine %q (want openai or command)", engine)
+	}
+	if v := os.Getenv("TTS_MIN_SEVERITY"); v != "" {
+		s.minSeverity = strings.ToUpper(v)
+		if _, ok := threatRank[s.minSeverity]; !ok {
+			return nil, fmt.Errorf("TTS_MIN_SEVERITY: unknown severity %q", v)
+		}
+	}
+	for _, d := range []struct {
+		env string
+		dst *time.Duration
+	}{{"TTS_TIMEOUT", &s.timeout}, {"TTS_RETENTION", &s.retention}} {
+		if v := os.Getenv(d.env); v != "" {
+			dur, err := time.ParseDuration(v)
+			if err != nil || dur <= 0 {
+				return nil, fmt.Errorf("%s: invalid duration %q", d.env, v)
+			}
+			*d.dst = dur
+		}
+	}
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create tts dir: %w", err)
+	}
+	return s, nil
+}
+
+// alertSpeechText is the callout for an alert, e.g. "Critical alert,
+// Southern California. Emergency squawk 7700 UAL123. Heading 270, 12,000
+// feet. Bearing 045, 32 nautical miles from region centre."
+func alertSpeechText(a *Alert) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s alert", strings.ToLower(a.Severity))
+	if r, ok := regions[a.Region]; ok {
+		fmt.Fprintf(&b, ", %s", r.Name)
+	}
+	b.WriteString(". " + strings.TrimSuffix(strings.TrimPrefix(a.Title, "[SIMULATED] "), ".") + ".")
+	if a.Simulated {
+		b.WriteString(" Simulated.")
+	}
+	if a.Message != "" {
+		b.WriteString(" " + strings.TrimSuffix(a.Message, ".") + ".")
+	}
+	num := func(k string) (float64, bool) {
+		v, ok := a.Details[k].(float64)
+		return v, ok
+	}
+	var motion []string
+	if h, ok := num("heading"); ok {
+		motion = append(motion, fmt.Sprintf("Heading %03.0f", math.Mod(math.Round(h), 360)))
+	}
+	if alt, ok := num("altitude"); ok {
+		motion = append(motion, fmt.Sprintf("%s feet", groupThousands(int(math.Round(alt*3.28084/100)*100))))
+	}
+	if len(motion) > 0 {
+		b.WriteString(" " + strings.Join(motion, ", ") + ".")
+	}
+	lat, okLat := num("latitude")
+	lon, okLon := num("longitude")
+	if r, ok := regions[a.Region]; ok && okLat && okLon {
+		cLat, cLon := (r.MinLat+r.MaxLat)/2, (r.MinLon+r.MaxLon)/2
+		nm := greatCircleDistance(cLat, cLon, lat, lon) / 1852
+		brg := greatCircleBearing(cLat, cLon, lat, lon)
+		fmt.Fprintf(&b, " Bearing %03.0f, %.0f nautical miles from region centre.", math.Mod(math.Round(brg), 360), nm)
+	}
+	s := b.String()
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// groupThousands writes 12000 as "12,000", which engines read as a number
+// rather than digit by digit.
+func groupThousands(n int) string {
+	s := fmt.Sprint(n)
+	if n < 0 {
+		return "-" + groupThousands(-n)
+	}
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
+
+// Attach sets or clears an alert's audio URL for its current severity and
+// text. Called with the alert manager's lock held, so it only computes.
+func (s *AlertSpeech) Attach(a *Alert) {
+	if s == nil {
+		return
+	}
+	if threatRank[a.Severity] < threatRank[s.minSeverity] {
+		a.AudioURL = ""
+		return
+	}
+	text := alertSpeechText(a)
+	sum := sha256.Sum256([]byte(s.engine.Name() + "\n" + text))
+	id := hex.EncodeToString(sum[:12])
+	s.mu.Lock()
+	s.texts[id] = speechText{text: text, at: time.Now()}
+	s.mu.Unlock()
+	a.AudioURL = "/api/audio/" + id
+}
+
+// Announce synthesizes an opened or escalated alert's clip ahead of the
+// first request and, with TTS_STREAM, pushes it to clients watching the
+// region.
+func (s *AlertSpeech) Announce(a Alert) {
+	if s == nil || a.AudioURL == "" {
+		return
+	}
+	streaming := s.stream && clientsWatching(a.Region)
+	if !isLeader(a.Region) && !streaming {
+		return
+	}
+	id := strings.TrimPrefix(a.AudioURL, "/api/audio/")
+	audio, contentType, err := s.Clip(id)
+	if err != nil {
+		alertLog.Warn("Alert speech failed", "region", a.Region, "alert", a.Key, "err", err)
+		return
+	}
+	if !streaming {
+		return
+	}
+	message := map[string]interface{}{
+		"type":        "alert_audio",
+		"region":      a.Region,
+		"alertId":     a.ID,
+		"alertKey":    a.Key,
+		"severity":    a.Severity,
+		"url":         a.AudioURL,
+		"contentType": contentType,
+		"data":        base64.StdEncoding.EncodeToString(audio),
+	}
+	clientsMutex.RLock()
+	defer clientsMutex.RUnlock()
+	for conn, clientRegion := range clients {
+		if clientRegion == a.Region {
+			if err := conn.send(message); err != nil {
+				wsLog.Warn("Write alert audio to client failed", "err", err)
+			}
+		}
+	}
+}
+
+func clientsWatching(region string) bool {
+	clientsMutex.RLock()
+	defer clientsMutex.RUnlock()
+	for _, clientRegion := range clients {
+		if clientRegion == region {
+			return true
+		}
+	}
+	return false
+}
+
+// errUnknownClip is a clip id that no alert on this replica has produced.
+var errUnknownClip = errors.New("unknown clip")
+
+// Clip returns a clip from disk, synthesizing it on first use. Concurrent
+// requests for the same clip share one synthesis.
+func (s *AlertSpeech) Clip(id string) ([]byte, string, error) {
+	if matches, _ := filepath.Glob(filepath.Join(s.dir, id+".*")); len(matches) > 0 {
+		if audio, err := os.ReadFile(matches[0]); err == nil {
+			return audio, speechTypes[filepath.Ext(matches[0])], nil
+		}
+	}
+	s.mu.Lock()
+	t, ok := s.texts[id]
+	if !ok {
+		s.mu.Unlock()
+		return nil, "", errUnknownClip
+	}
+	if f, ok := s.inflight[id]; ok {
+		s.mu.Unlock()
+		<-f.done
+		return f.audio, f.contentType, f.err
+	}
+	f := &speechFetch{done: make(chan struct{})}
+	s.inflight[id] = f
+	s.mu.Unlock()
+
+	f.audio, f.contentType, f.err = s.synthesize(id, t.text)
+	s.mu.Lock()
+	delete(s.inflight, id)
+	s.mu.Unlock()
+	close(f.done)
+	return f.audio, f.contentType, f.err
+}
+
+func (s *AlertSpeech) synthesize(id, text string) ([]byte, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	start := time.Now()
+	audio, contentType, err := s.engine.Synthesize(ctx, text)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(audio) == 0 {
+		return nil, "", errors.New("engine returned no audio")
+	}
+	ext, ok := speechExtensions[contentType]
+	if !ok {
+		return nil, "", fmt.Errorf("unsupported audio type %s", contentType)
+	}
+	path := filepath.Join(s.dir, id+ext)
+	if err := os.WriteFile(path+".tmp", audio, 0o644); err != nil {
+		return nil, "", err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		os.Remove(path + ".tmp")
+		return nil, "", err
+	}
+	alertLog.Info("Alert speech synthesized", "clip", id, "engine", s.engine.Name(), "bytes", len(audio), "duration_ms", time.Since(start).Milliseconds())
+	return audio, contentType, nil
+}
+
+// Run deletes clips, and forgets texts, older than TTS_RETENTION.
+func (s *AlertSpeech) Run() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopping:
+			return
+		case <-ticker.C:
+		}
+		cutoff := time.Now().Add(-s.retention)
+		s.mu.Lock()
+		for id, t := range s.texts {
+			if t.at.Before(cutoff) {
+				delete(s.texts, id)
+			}
+		}
+		s.mu.Unlock()
+		entries, _ := os.ReadDir(s.dir)
+		for _, e := range entries {
+			if info, err := e.Info(); err == nil && info.ModTime().Before(cutoff) {
+				os.Remove(filepath.Join(s.dir, e.Name()))
+			}
+		}
+	}
+}
+
+// openAISpeech calls OpenAI's speech endpoint for MP3.
+type openAISpeech struct {
+	key, model, voice string
+	client            *http.Client
+}
+
+func (e *openAISpeech) Name() string { return "openai/" + e.model + "/" + e.voice }
+
+func (e *openAISpeech) Synthesize(ctx context.Context, text string) ([]byte, string, error) {
+	body, _ := json.Marshal(map[string]string{"model": e.model, "voice": e.voice, "input": text, "response_format": "mp3"})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, openAISpeechURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+e.key)
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSpeechBytes+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("OpenAI returned HTTP %d: %s", resp.StatusCode, truncate(string(data), 200))
+	}
+	if len(data) > maxSpeechBytes {
+		return nil, "", fmt.Errorf("clip larger than %d bytes", maxSpeechBytes)
+	}
+	return data, "audio/mpeg", nil
+}
+
+// commandSpeech runs a local engine such as espeak-ng or Piper for each
+// clip: text on stdin, audio on stdout.
+type commandSpeech struct {
+	argv []string
+}
+
+func (e *commandSpeech) Name() string { return "command/" + strings.Join(e.argv, " ") }
+
+func (e *commandSpeech) Synthesize(ctx context.Context, text string) ([]byte, string, error) {
+	cmd := exec.CommandContext(ctx, e.argv[0], e.argv[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, "", fmt.Errorf("%w: %s", err, truncate(msg, 200))
+		}
+		return nil, "", err
+	}
+	if stdout.Len() > maxSpeechBytes {
+		return nil, "", fmt.Errorf("clip larger than %d bytes", maxSpeechBytes)
+	}
+	audio := stdout.Bytes()
+	contentType := http.DetectContentType(audio)
+	switch {
+	case contentType == "audio/wave":
+		contentType = "audio/wav"
+	case !strings.HasPrefix(contentType, "audio/") && !strings.HasPrefix(contentType, "application/ogg"):
+		if len(audio) > 1 && audio[0] == 0xff && audio[1]&0xe0 == 0xe0 {
+			contentType = "audio/mpeg" // MP3 frame without an ID3 tag
+		} else {
+			return nil, "", fmt.Errorf("command output is %s, not audio", contentType)
+		}
+	}
+	return audio, contentType, nil
+}
+
+// handleAudio serves a spoken alert clip.
+// GET /api/audio/{id}
+func handleAudio(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if alertSpeech == nil {
+		http.Error(w, "Text-to-speech not configured", http.StatusServiceUnavailable)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/api/audio/")
+	if len(id) != 24 || strings.Trim(id, "0123456789abcdef") != "" {
+		http.NotFound(w, r)
+		return
+	}
+	audio, contentType, err := alertSpeech.Clip(id)
+	if errors.Is(err, errUnknownClip) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		alertLog.Warn("Alert speech failed", "clip", id, "err", err)
+		http.Error(w, "Speech synthesis failed", http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "private, max-age=86400, immutable")
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(audio))
+}
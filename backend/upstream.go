@@ -0,0 +1,144 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// latencyWindow is how many recent requests the latency summary covers.
+const latencyWindow = 32
+
+// UpstreamStatus is what a region's aircraft source has been doing lately,
+// reported by /readyz and /api/health so a stale region can be explained
+// without reading the logs.
+type UpstreamStatus struct {
+	Source              string         `json:"source"`
+	PollIntervalSeconds float64        `json:"pollIntervalSeconds"` // effective, including backoff
+	Requests            int64          `json:"requests"`
+	Errors              int64          `json:"errors"`
+	RateLimited         int64          `json:"rateLimited"` // HTTP 429 responses
+	RateLimitRemaining  *int64         `json:"rateLimitRemaining,omitempty"`
+	RetryAfterSeconds   *int64         `json:"retryAfterSeconds,omitempty"`
+	LastStatus          int            `json:"lastStatus,omitempty"`
+	LastError           string         `json:"lastError,omitempty"`
+	LastSuccess         int64          `json:"lastSuccess,omitempty"`
+	LatencyMs           LatencySummary `json:"latencyMs"`
+}
+
+// LatencySummary covers the last latencyWindow requests.
+type LatencySummary struct {
+	Samples int     `json:"samples"`
+	Last    float64 `json:"last"`
+	P50     float64 `json:"p50"`
+	P95     float64 `json:"p95"`
+	Max     float64 `json:"max"`
+}
+
+type regionUpstream struct {
+	status    UpstreamStatus
+	latencies []time.Duration // ring of the last latencyWindow
+	next      int
+}
+
+// upstreamStats tracks each region's aircraft source. Pollers report every
+// request and their current interval; readers get copies.
+type upstreamStats struct {
+	mu      sync.Mutex
+	regions map[string]*regionUpstream
+}
+
+var upstream = &upstreamStats{regions: make(map[string]*regionUpstream)}
+
+func (u *upstreamStats) region(name, source string) *regionUpstream {
+	r := u.regions[name]
+	if r == nil {
+		r = &regionUpstream{}
+		u.regions[name] = r
+	}
+	r.status.Source = source
+	return r
+}
+
+// SetInterval records how long the region's poller is waiting between
+// requests, which grows past POLL_INTERVAL while it backs off.
+func (u *upstreamStats) SetInterval(region, source string, d time.Duration) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.region(region, source).status.PollIntervalSeconds = d.Seconds()
+}
+
+// Record notes one request: its latency, HTTP status (0 when none was
+// received), the OpenSky rate limit headers if present, and any error.
+func (u *upstreamStats) Record(region, source string, latency time.Duration, status int, h http.Header, err error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	r := u.region(region, source)
+	s := &r.status
+	s.Requests++
+	s.LastStatus = status
+	if status == http.StatusTooManyRequests {
+		s.RateLimited++
+	}
+	if v, perr := strconv.ParseInt(h.Get("X-Rate-Limit-Remaining"), 10, 64); perr == nil {
+		s.RateLimitRemaining = &v
+	}
+	s.RetryAfterSeconds = nil
+	if v, perr := strconv.ParseInt(h.Get("X-Rate-Limit-Retry-After-Seconds"), 10, 64); perr == nil {
+		s.RetryAfterSeconds = &v
+	}
+	if err != nil {
+		s.Errors++
+		s.LastError = err.Error()
+	} else {
+		s.LastError = ""
+		s.LastSuccess = time.Now().Unix()
+	}
+
+	if len(r.latencies) < latencyWindow {
+		r.latencies = append(r.latencies, latency)
+	} else {
+		r.latencies[r.next] = latency
+	}
+	r.next = (r.next + 1) % latencyWindow
+	s.LatencyMs = summarizeLatencies(r.latencies, latency)
+}
+
+func summarizeLatencies(window []time.Duration, last time.Duration) LatencySummary {
+	sorted := append([]time.Duration(nil), window...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	ms := func(d time.Duration) float64 { return float64(d.Microseconds()) / 1000 }
+	return LatencySummary{
+		Samples: len(sorted),
+		Last:    ms(last),
+		P50:     ms(sorted[len(sorted)/2]),
+		P95:     ms(sorted[len(sorted)*95/100]),
+		Max:     ms(sorted[len(sorted)-1]),
+	}
+}
+
+// Status returns a copy of the region's status, or nil if nothing has
+// polled it.
+func (u *upstreamStats) Status(region string) *UpstreamStatus {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	r := u.regions[region]
+	if r == nil {
+		return nil
+	}
+	s := r.status
+	return &s
+}
+
+// All returns a copy of every region's status.
+func (u *upstreamStats) All() map[string]UpstreamStatus {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	all := make(map[string]UpstreamStatus, len(u.regions))
+	for name, r := range u.regions {
+		all[name] = r.status
+	}
+	return all
+}
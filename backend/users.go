@@ -0,0 +1,619 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// User is an operator account. Accounts are created by an admin; there is no
+// self-registration.
+type User struct {
+	Username     string     `json:"username"`
+	PasswordHash string     `json:"passwordHash,omitempty"`
+	Role         string     `json:"role"`
+	Disabled     bool       `json:"disabled,omitempty"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	LastLogin    *time.Time `json:"lastLogin,omitempty"`
+}
+
+// public strips the password hash for API responses.
+func (u User) public() User {
+	u.PasswordHash = ""
+	return u
+}
+
+type refreshToken struct {
+	Username  string    `json:"username"`
+	SessionID string    `json:"sessionId,omitempty"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// UserStore holds accounts, login sessions, and outstanding refresh tokens,
+// persisted as a JSON file in the data directory. Refresh tokens are stored
+// as SHA-256 digests and rotated on every use; each belongs to a session.
+type UserStore struct {
+	mu       sync.RWMutex
+	path     string
+	users    map[string]*User
+	sessions map[string]*Session
+	refresh  map[string]refreshToken // sha256 hex -> token
+}
+
+type userStoreFile struct {
+	Users         []*User                 `json:"users"`
+	Sessions      []*Session              `json:"sessions,omitempty"`
+	RefreshTokens map[string]refreshToken `json:"refreshTokens"`
+}
+
+var (
+	userStore = &UserStore{users: map[string]*User{}, sessions: map[string]*Session{}, refresh: map[string]refreshToken{}}
+
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 30 * 24 * time.Hour
+
+	usernamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{1,31}$`)
+
+	errUserExists   = errors.New("user already exists")
+	errUserNotFound = errors.New("user not found")
+	errLastAdmin    = errors.New("at least one enabled admin must remain")
+
+	// dummyHash keeps failed logins for unknown users as slow as for known ones.
+	dummyHash, _ = bcrypt.GenerateFromPassword([]byte("swarm-c2-dummy-password"), bcrypt.DefaultCost)
+)
+
+// OpenUserStore loads dir/users.json if it exists.
+func OpenUserStore(dir string) (*UserStore, error) {
+	s := &UserStore{
+		path:     filepath.Join(dir, "users.json"),
+		users:    map[string]*User{},
+		sessions: map[string]*Session{},
+		refresh:  map[string]refreshToken{},
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("read users: %w", err)
+	}
+	var f userStoreFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parse users: %w", err)
+	}
+	for _, u := range f.Users {
+		s.users[u.Username] = u
+	}
+	now := time.Now()
+	for _, sess := range f.Sessions {
+		s.sessions[sess.ID] = sess
+	}
+	for k, t := range f.RefreshTokens {
+		if t.ExpiresAt.After(now) {
+			s.refresh[k] = t
+		}
+	}
+	return s, nil
+}
+
+// loadUserConfigFromEnv applies token lifetimes and creates the first admin
+// from ADMIN_USERNAME / ADMIN_PASSWORD when there are no accounts yet.
+//
+//	JWT_TTL     — access token lifetime (default 15m)
+//	REFRESH_TTL — refresh token lifetime (default 720h)
+func loadUserConfigFromEnv() error {
+	if v := os.Getenv("JWT_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("JWT_TTL: invalid duration %q", v)
+		}
+		accessTokenTTL = d
+	}
+	if v := os.Getenv("REFRESH_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("REFRESH_TTL: invalid duration %q", v)
+		}
+		refreshTokenTTL = d
+	}
+
+	name, password := os.Getenv("ADMIN_USERNAME"), getSecret("ADMIN_PASSWORD")
+	if name != "" && password != "" && userStore.Count() == 0 {
+		if _, err := userStore.Create(name, password, RoleAdmin); err != nil {
+			return fmt.Errorf("create admin %q: %w", name, err)
+		}
+		authLog.Info("Created admin user", "user", name)
+	}
+	return nil
+}
+
+// Count returns the number of accounts.
+func (s *UserStore) Count() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.users)
+}
+
+// List returns all accounts sorted by username, without password hashes.
+func (s *UserStore) List() []User {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	users := make([]User, 0, len(s.users))
+	for _, u := range s.users {
+		users = append(users, u.public())
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+	return users
+}
+
+// Get returns an account by username.
+func (s *UserStore) Get(username string) (User, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if u, ok := s.users[username]; ok {
+		return *u, true
+	}
+	return User{}, false
+}
+
+// Create adds an account with a bcrypt-hashed password.
+func (s *UserStore) Create(username, password, role string) (User, error) {
+	username = strings.ToLower(strings.TrimSpace(username))
+	if !usernamePattern.MatchString(username) {
+		return User{}, fmt.Errorf("username must be 2-32 characters of a-z, 0-9, '.', '_', '-'")
+	}
+	if !validRole(role) {
+		return User{}, fmt.Errorf("role must be viewer, analyst, or admin")
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return User{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.users[username]; exists {
+		return User{}, errUserExists
+	}
+	u := &User{Username: username, PasswordHash: hash, Role: role, CreatedAt: time.Now().UTC()}
+	s.users[username] = u
+	return u.public(), s.saveLocked()
+}
+
+// UserUpdate changes selected fields of an account; nil fields are left alone.
+type UserUpdate struct {
+	Password *string `json:"password"`
+	Role     *string `json:"role"`
+	Disabled *bool   `json:"disabled"`
+}
+
+// Update applies changes to an account. Disabling an account or changing its
+// password ends all of its sessions.
+func (s *UserStore) Update(username string, upd UserUpdate) (User, error) {
+	if upd.Role != nil && !validRole(*upd.Role) {
+		return User{}, fmt.Errorf("role must be viewer, analyst, or admin")
+	}
+	var hash string
+	if upd.Password != nil {
+		var err error
+		if hash, err = hashPassword(*upd.Password); err != nil {
+			return User{}, err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[username]
+	if !ok {
+		return User{}, errUserNotFound
+	}
+	next := *u
+	if upd.Role != nil {
+		next.Role = *upd.Role
+	}
+	if upd.Disabled != nil {
+		next.Disabled = *upd.Disabled
+	}
+	if u.Role == RoleAdmin && !u.Disabled && (next.Role != RoleAdmin || next.Disabled) && s.enabledAdminsLocked() == 1 {
+		return User{}, errLastAdmin
+	}
+	if hash != "" {
+		next.PasswordHash = hash
+	}
+	*u = next
+	if hash != "" || next.Disabled {
+		s.revokeUserLocked(username)
+	}
+	return u.public(), s.saveLocked()
+}
+
+// Delete removes an account and its sessions.
+func (s *UserStore) Delete(username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[username]
+	if !ok {
+		return errUserNotFound
+	}
+	if u.Role == RoleAdmin && !u.Disabled && s.enabledAdminsLocked() == 1 {
+		return errLastAdmin
+	}
+	delete(s.users, username)
+	s.revokeUserLocked(username)
+	return s.saveLocked()
+}
+
+// Authenticate checks a username and password and records the login.
+func (s *UserStore) Authenticate(username, password string) (User, bool) {
+	username = strings.ToLower(strings.TrimSpace(username))
+	s.mu.RLock()
+	u, ok := s.users[username]
+	hash, disabled := dummyHash, false
+	if ok {
+		hash, disabled = []byte(u.PasswordHash), u.Disabled
+	}
+	s.mu.RUnlock()
+
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil || !ok || disabled {
+		return User{}, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// The account may have changed while the password was checked.
+	if u, ok = s.users[username]; !ok || u.Disabled {
+		return User{}, false
+	}
+	now := time.Now().UTC()
+	u.LastLogin = &now
+	s.saveLocked()
+	return *u, true
+}
+
+// IssueRefreshToken returns a new opaque refresh token for a session.
+func (s *UserStore) IssueRefreshToken(username, sessionID string) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(raw)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expires := time.Now().Add(refreshTokenTTL).UTC()
+	s.refresh[tokenDigest(token)] = refreshToken{Username: username, SessionID: sessionID, ExpiresAt: expires}
+	s.extendSessionLocked(sessionID, expires)
+	return token, s.saveLocked()
+}
+
+// UseRefreshToken consumes a refresh token, returning its user and session if
+// the token was valid and the account is still enabled.
+func (s *UserStore) UseRefreshToken(token string) (User, string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := tokenDigest(token)
+	t, ok := s.refresh[key]
+	if !ok {
+		return User{}, "", false
+	}
+	delete(s.refresh, key)
+	s.saveLocked()
+	u, exists := s.users[t.Username]
+	if !exists || u.Disabled || time.Now().After(t.ExpiresAt) {
+		return User{}, "", false
+	}
+	sess, live := s.sessions[t.SessionID]
+	if !live {
+		return User{}, "", false
+	}
+	sess.LastSeen = time.Now().UTC()
+	return *u, sess.ID, true
+}
+
+// RevokeRefreshToken ends the session a refresh token belongs to (logout).
+func (s *UserStore) RevokeRefreshToken(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, ok := s.refresh[tokenDigest(token)]; ok {
+		s.endSessionLocked(t.SessionID)
+	}
+	delete(s.refresh, tokenDigest(token))
+	s.saveLocked()
+}
+
+func (s *UserStore) revokeUserLocked(username string) {
+	for id, sess := range s.sessions {
+		if sess.Username == username {
+			s.endSessionLocked(id)
+		}
+	}
+	for k, t := range s.refresh {
+		if t.Username == username {
+			delete(s.refresh, k)
+		}
+	}
+}
+
+func (s *UserStore) enabledAdminsLocked() int {
+	n := 0
+	for _, u := range s.users {
+		if u.Role == RoleAdmin && !u.Disabled {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *UserStore) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+	now := time.Now()
+	s.expireSessionsLocked(now)
+	f := userStoreFile{RefreshTokens: map[string]refreshToken{}}
+	for _, u := range s.users {
+		f.Users = append(f.Users, u)
+	}
+	sort.Slice(f.Users, func(i, j int) bool { return f.Users[i].Username < f.Users[j].Username })
+	for _, sess := range s.sessions {
+		f.Sessions = append(f.Sessions, sess)
+	}
+	sort.Slice(f.Sessions, func(i, j int) bool { return f.Sessions[i].CreatedAt.Before(f.Sessions[j].CreatedAt) })
+	for k, t := range s.refresh {
+		if t.ExpiresAt.After(now) {
+			f.RefreshTokens[k] = t
+		}
+	}
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, data, 0o600)
+}
+
+func hashPassword(password string) (string, error) {
+	if len(password) < 10 {
+		return "", fmt.Errorf("password must be at least 10 characters")
+	}
+	if len(password) > 72 {
+		return "", fmt.Errorf("password must be at most 72 bytes")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+func tokenDigest(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// tokenResponse is returned by login and refresh.
+type tokenResponse struct {
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+	TokenType    string `json:"tokenType"`
+	ExpiresIn    int    `json:"expiresIn"`
+	User         User   `json:"user"`
+}
+
+func issueTokens(w http.ResponseWriter, u User, sessionID string) {
+	now := time.Now()
+	access, err := signJWT(accessClaims{
+		Issuer:    jwtIssuer,
+		Subject:   u.Username,
+		SessionID: sessionID,
+		Role:      u.Role,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(accessTokenTTL).Unix(),
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	refresh, err := userStore.IssueRefreshToken(u.Username, sessionID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(tokenResponse{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(accessTokenTTL.Seconds()),
+		User:         u.public(),
+	})
+}
+
+// handleLogin exchanges a username and password for tokens.
+// POST /api/login {"username", "password"}
+func handleLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var body struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	u, ok := userStore.Authenticate(body.Username, body.Password)
+	if !ok {
+		requestLog(authLog, r).Warn("Failed login", "user", body.Username, "ip", clientIP(r))
+		auditLog.RecordAs(nil, r, "login.failed", map[string]interface{}{"username": body.Username})
+		http.Error(w, "Invalid username or password", http.StatusUnauthorized)
+		return
+	}
+	sess, err := userStore.StartSession(u.Username, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	auditLog.RecordAs(&Principal{Kind: "user", Name: u.Username, Role: u.Role}, r, "login", map[string]interface{}{"session": sess.ID})
+	issueTokens(w, u, sess.ID)
+}
+
+// handleTokenRefresh trades a refresh token for a new access/refresh pair.
+// POST /api/token/refresh {"refreshToken"}
+func handleTokenRefresh(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var body struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	u, sessionID, ok := userStore.UseRefreshToken(body.RefreshToken)
+	if !ok {
+		http.Error(w, "Invalid or expired refresh token", http.StatusUnauthorized)
+		return
+	}
+	issueTokens(w, u, sessionID)
+}
+
+// handleLogout ends the session a refresh token belongs to, which also
+// invalidates its access tokens.
+// POST /api/logout {"refreshToken"}
+func handleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var body struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	userStore.RevokeRefreshToken(body.RefreshToken)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleMe returns who the request is authenticated as.
+// GET /api/me
+func handleMe(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if p := principalFrom(r); p != nil {
+		json.NewEncoder(w).Encode(p)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"authenticated": false})
+}
+
+// handleUsers lists and creates accounts (admin only, see adminPaths).
+//
+//	GET  /api/users  — list accounts
+//	POST /api/users  — create {"username", "password", "role"}
+func handleUsers(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(userStore.List())
+
+	case http.MethodPost:
+		var body struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+			Role     string `json:"role"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if body.Role == "" {
+			body.Role = RoleViewer
+		}
+		u, err := userStore.Create(body.Username, body.Password, body.Role)
+		if errors.Is(err, errUserExists) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		auditLog.Record(r, "user.create", map[string]interface{}{"username": u.Username, "role": u.Role})
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(u)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleUserAction updates or deletes one account (admin only).
+//
+//	PUT    /api/users/{username}  — {"password", "role", "disabled"}, all optional
+//	DELETE /api/users/{username}
+func handleUserAction(w http.ResponseWriter, r *http.Request) {
+	username := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/users/"), "/")
+	if username == "" || strings.Contains(username, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	var err error
+	var u User
+	switch r.Method {
+	case http.MethodPut:
+		var upd UserUpdate
+		if err := json.NewDecoder(r.Body).Decode(&upd); err != nil {
+			http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		u, err = userStore.Update(username, upd)
+		if err == nil {
+			params := map[string]interface{}{"username": username, "passwordChanged": upd.Password != nil}
+			if upd.Role != nil {
+				params["role"] = *upd.Role
+			}
+			if upd.Disabled != nil {
+				params["disabled"] = *upd.Disabled
+			}
+			auditLog.Record(r, "user.update", params)
+		}
+	case http.MethodDelete:
+		if err = userStore.Delete(username); err == nil {
+			auditLog.Record(r, "user.delete", map[string]interface{}{"username": username})
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch {
+	case errors.Is(err, errUserNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, errLastAdmin):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case r.Method == http.MethodDelete:
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(u)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WatchlistEntry flags an aircraft of interest by ICAO24 address or callsign.
+// A callsign ending in "*" matches as a prefix.
+type WatchlistEntry struct {
+	ID       string    `json:"id"`
+	ICAO24   string    `json:"icao24,omitempty"`
+	Callsign string    `json:"callsign,omitempty"`
+	Note     string    `json:"note,omitempty"`
+	Severity string    `json:"severity"`
+	AddedAt  time.Time `json:"addedAt"`
+}
+
+// Watchlist is the set of aircraft operators want to hear about, persisted
+// as a JSON file in the data directory.
+type Watchlist struct {
+	mu      sync.RWMutex
+	path    string
+	entries []WatchlistEntry
+}
+
+var watchlist = &Watchlist{}
+
+// OpenWatchlist loads dir/watchlist.json if it exists.
+func OpenWatchlist(dir string) (*Watchlist, error) {
+	w := &Watchlist{path: filepath.Join(dir, "watchlist.json")}
+	data, err := os.ReadFile(w.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return w, nil
+		}
+		return nil, fmt.Errorf("read watchlist: %w", err)
+	}
+	if err := json.Unmarshal(data, &w.entries); err != nil {
+		return nil, fmt.Errorf("parse watchlist: %w", err)
+	}
+	return w, nil
+}
+
+// Match returns the first entry matching the aircraft, if any.
+func (w *Watchlist) Match(ac Aircraft) (WatchlistEntry, bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	callsign := strings.ToUpper(strings.TrimSpace(ac.Callsign))
+	for _, e := range w.entries {
+		if e.ICAO24 != "" && strings.EqualFold(e.ICAO24, ac.ICAO24) {
+			return e, true
+		}
+		if e.Callsign != "" && callsignMatches(e.Callsign, callsign) {
+			return e, true
+		}
+	}
+	return WatchlistEntry{}, false
+}
+
+// Entries returns a copy of the watchlist.
+func (w *Watchlist) Entries() []WatchlistEntry {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return append([]WatchlistEntry{}, w.entries...)
+}
+
+// Add appends an entry and persists the list.
+func (w *Watchlist) Add(e WatchlistEntry) (WatchlistEntry, error) {
+	e.ICAO24 = strings.ToLower(strings.TrimSpace(e.ICAO24))
+	e.Callsign = strings.ToUpper(strings.TrimSpace(e.Callsign))
+	if e.ICAO24 == "" && e.Callsign == "" {
+		return e, fmt.Errorf("icao24 or callsign is required")
+	}
+	e.Severity = strings.ToUpper(e.Severity)
+	if threatRank[e.Severity] == 0 {
+		e.Severity = "HIGH"
+	}
+	e.ID = newAlertID()
+	e.AddedAt = time.Now().UTC()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.entries = append(w.entries, e)
+	return e, w.saveLocked()
+}
+
+// Remove deletes an entry by ID.
+func (w *Watchlist) Remove(id string) (bool, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for i, e := range w.entries {
+		if e.ID == id {
+			w.entries = append(w.entries[:i], w.entries[i+1:]...)
+			return true, w.saveLocked()
+		}
+	}
+	return false, nil
+}
+
+func (w *Watchlist) saveLocked() error {
+	if w.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(w.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(w.path, data, 0o644)
+}
+
+// callsignMatches compares a pattern (exact, or prefix when it ends in "*")
+// against an upper-cased callsign.
+func callsignMatches(pattern, callsign string) bool {
+	pattern = strings.ToUpper(strings.TrimSpace(pattern))
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return callsign != "" && strings.HasPrefix(callsign, prefix)
+	}
+	return pattern == callsign
+}
+
+// handleWatchlist serves the caller's watchlist: its workspace's, or the
+// server-wide list for operators outside any workspace.
+//
+//	GET    /api/watchlist           — list entries
+//	POST   /api/watchlist           — add {"icao24"|"callsign", "note", "severity"}
+//	DELETE /api/watchlist?id=       — remove an entry
+func handleWatchlist(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(watchlistFor(r).Entries())
+
+	case http.MethodPost:
+		var entry WatchlistEntry
+		if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
+			http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		added, err := watchlistFor(r).Add(entry)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		auditLog.Record(r, "watchlist.add", map[string]interface{}{"id": added.ID, "icao24": added.ICAO24, "callsign": added.Callsign})
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(added)
+
+	case http.MethodDelete:
+		removed, err := watchlistFor(r).Remove(r.URL.Query().Get("id"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !removed {
+			http.Error(w, "Watchlist entry not found", http.StatusNotFound)
+			return
+		}
+		auditLog.Record(r, "watchlist.remove", map[string]interface{}{"id": r.URL.Query().Get("id")})
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
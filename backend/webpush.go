@@ -0,0 +1,515 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PushSubscription is a browser PushSubscription plus per-subscription filters.
+type PushSubscription struct {
+	ID       string `json:"id"`
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+	MinSeverity string    `json:"minSeverity"`
+	Regions     []string  `json:"regions,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// WebPushNotifier delivers alerts to browsers via the Web Push protocol:
+// payloads are encrypted per RFC 8291 (aes128gcm) and requests are
+// authorized with VAPID (RFC 8292).
+type WebPushNotifier struct {
+	subject    string // VAPID contact, e.g. mailto:ops@example.com
+	privateKey *ecdsa.PrivateKey
+	publicKey  []byte // uncompressed P-256 point
+	hosts      []string
+	client     *http.Client
+
+	mu            sync.RWMutex
+	path          string
+	subscriptions []PushSubscription
+}
+
+var webPush *WebPushNotifier
+
+// defaultPushServiceHosts are the push services of Chrome, Firefox, Safari,
+// and Edge. A leading dot matches any subdomain.
+const defaultPushServiceHosts = "fcm.googleapis.com,updates.push.services.mozilla.com,web.push.apple.com,.notify.windows.com"
+
+// pushRecordSize is the aes128gcm record size we declare. RFC 8291 has push
+// services accept 4096-byte bodies, which is one record here: the 86-byte
+// header (salt, record size, key id length, and a 65-byte key id), then the
+// plaintext, its delimiter octet, and the 16-byte AEAD tag.
+const pushRecordSize = 4096
+
+const maxPushPlaintext = pushRecordSize - 86 - 1 - 16
+
+// newWebPushNotifier loads or creates VAPID keys and the subscription store.
+//
+//	VAPID_PUBLIC_KEY / VAPID_PRIVATE_KEY — base64url keys; generated into dataDir/vapid.json if unset
+//	VAPID_SUBJECT                        — contact URI sent to push services (default mailto:admin@localhost)
+//	PUSH_SERVICE_HOSTS                   — hosts subscriptions may point at (default: the major browsers' push services)
+func newWebPushNotifier(dataDir string) (*WebPushNotifier, error) {
+	n := &WebPushNotifier{
+		subject: os.Getenv("VAPID_SUBJECT"),
+		hosts:   splitList(os.Getenv("PUSH_SERVICE_HOSTS")),
+		client:  &http.Client{Timeout: 10 * time.Second},
+		path:    filepath.Join(dataDir, "push_subscriptions.json"),
+	}
+	if n.subject == "" {
+		n.subject = "mailto:admin@localhost"
+	}
+	if len(n.hosts) == 0 {
+		n.hosts = splitList(defaultPushServiceHosts)
+	}
+
+	privB64 := getSecret("VAPID_PRIVATE_KEY")
+	if privB64 == "" {
+		keyPath := filepath.Join(dataDir, "vapid.json")
+		var stored struct {
+			PublicKey  string `json:"publicKey"`
+			PrivateKey string `json:"privateKey"`
+		}
+		if data, err := os.ReadFile(keyPath); err == nil {
+			if err := json.Unmarshal(data, &stored); err != nil {
+				return nil, fmt.Errorf("parse %s: %w", keyPath, err)
+			}
+		} else {
+			key, err := ecdh.P256().GenerateKey(rand.Reader)
+			if err != nil {
+				return nil, fmt.Errorf("generate VAPID key: %w", err)
+			}
+			stored.PrivateKey = base64.RawURLEncoding.EncodeToString(key.Bytes())
+			stored.PublicKey = base64.RawURLEncoding.EncodeToString(key.PublicKey().Bytes())
+			data, _ := json.MarshalIndent(stored, "", "  ")
+			if err := os.WriteFile(keyPath, data, 0o600); err != nil {
+				return nil, fmt.Errorf("save VAPID key: %w", err)
+			}
+			alertLog.Info("Generated VAPID key pair", "file", keyPath)
+		}
+		privB64 = stored.PrivateKey
+	}
+
+	if err := n.setKey(privB64); err != nil {
+		return nil, err
+	}
+	if pub := os.Getenv("VAPID_PUBLIC_KEY"); pub != "" && pub != n.PublicKey() {
+		return nil, fmt.Errorf("VAPID_PUBLIC_KEY does not match VAPID_PRIVATE_KEY")
+	}
+
+	if data, err := os.ReadFile(n.path); err == nil {
+		if err := json.Unmarshal(data, &n.subscriptions); err != nil {
+			return nil, fmt.Errorf("parse push subscriptions: %w", err)
+		}
+	}
+	return n, nil
+}
+
+// setKey installs a VAPID private key given as a base64url P-256 scalar.
+func (n *WebPushNotifier) setKey(privB64 string) error {
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(privB64, "="))
+	if err != nil {
+		return fmt.Errorf("decode VAPID private key: %w", err)
+	}
+	key, err := ecdh.P256().NewPrivateKey(raw)
+	if err != nil {
+		return fmt.Errorf("invalid VAPID private key: %w", err)
+	}
+	pub := key.PublicKey().Bytes()
+	n.publicKey = pub
+	n.privateKey = &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(pub[1:33]),
+			Y:     new(big.Int).SetBytes(pub[33:65]),
+		},
+		D: new(big.Int).SetBytes(raw),
+	}
+	return nil
+}
+
+// PublicKey returns the VAPID application server key for PushManager.subscribe.
+func (n *WebPushNotifier) PublicKey() string {
+	return base64.RawURLEncoding.EncodeToString(n.publicKey)
+}
+
+func (n *WebPushNotifier) Name() string { return "push" }
+
+// allowsEndpoint reports whether a subscription endpoint is an https URL on
+// a known push service, so subscribing can't make the server post to an
+// arbitrary URL.
+func (n *WebPushNotifier) allowsEndpoint(endpoint string) bool {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme != "https" || u.User != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, h := range n.hosts {
+		h = strings.ToLower(h)
+		if host == h || strings.HasPrefix(h, ".") && strings.HasSuffix(host, h) {
+			return true
+		}
+	}
+	return false
+}
+
+// pushPayload is what the service worker shows for an alert transition.
+// Details are left out and the message shortened, so the payload fits one
+// aes128gcm record.
+func pushPayload(event string, alert *Alert) ([]byte, error) {
+	msg := map[string]string{
+		"title":   fmt.Sprintf("%s %s", alert.Severity, alert.Title),
+		"body":    alert.Message,
+		"tag":     alert.Key,
+		"event":   event,
+		"alertId": alert.ID,
+	}
+	if event == AlertResolved {
+		msg["title"] = "RESOLVED " + alert.Title
+	}
+	payload, err := json.Marshal(msg)
+	if err != nil || len(payload) <= maxPushPlaintext {
+		return payload, err
+	}
+
+	// Keep the longest start of the message that fits; JSON escaping makes
+	// its encoded length hard to predict.
+	message := msg["body"]
+	fits := func(n int) bool {
+		msg["body"] = truncate(message, n)
+		payload, _ := json.Marshal(msg)
+		return len(payload) <= maxPushPlaintext
+	}
+	lo, hi := 0, len(message)
+	for lo < hi {
+		if mid := (lo + hi + 1) / 2; fits(mid) {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	if !fits(lo) {
+		return nil, fmt.Errorf("push payload for %s doesn't fit in a record", alert.Key)
+	}
+	return json.Marshal(msg)
+}
+
+// Notify pushes an alert transition to every subscription whose filters match.
+func (n *WebPushNotifier) Notify(event string, alert *Alert) error {
+	if !features.Enabled(FlagPushNotifications, alert.Region) {
+		return nil
+	}
+	payload, err := pushPayload(event, alert)
+	if err != nil {
+		return err
+	}
+
+	n.mu.RLock()
+	subs := append([]PushSubscription{}, n.subscriptions...)
+	n.mu.RUnlock()
+
+	var gone []string
+	var errs []string
+	for _, sub := range subs {
+		if threatRank[alert.Severity] < threatRank[sub.MinSeverity] || !matchesAny(sub.Regions, alert.Region) {
+			continue
+		}
+		if !n.allowsEndpoint(sub.Endpoint) {
+			continue // stored before PUSH_SERVICE_HOSTS changed
+		}
+		status, err := n.send(sub, payload, alert.Severity)
+		if status == http.StatusNotFound || status == http.StatusGone {
+			gone = append(gone, sub.Endpoint)
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	for _, endpoint := range gone {
+		n.Unsubscribe(endpoint)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// send encrypts and delivers one push message, returning the push service's status.
+func (n *WebPushNotifier) send(sub PushSubscription, payload []byte, severity string) (int, error) {
+	body, err := encryptPushPayload(sub, payload)
+	if err != nil {
+		return 0, err
+	}
+
+	endpoint, err := url.Parse(sub.Endpoint)
+	if err != nil {
+		return 0, fmt.Errorf("invalid endpoint: %w", err)
+	}
+	jwt, err := n.vapidToken(endpoint.Scheme + "://" + endpoint.Host)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequest("POST", sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", "86400")
+	req.Header.Set("Authorization", fmt.Sprintf("vapid t=%s, k=%s", jwt, n.PublicKey()))
+	if threatRank[severity] >= threatRank["HIGH"] {
+		req.Header.Set("Urgency", "high")
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("push %s: %w", endpoint.Host, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return resp.StatusCode, fmt.Errorf("push %s returned %d: %s", endpoint.Host, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return resp.StatusCode, nil
+}
+
+// vapidToken signs an ES256 JWT for the push service origin (RFC 8292).
+func (n *WebPushNotifier) vapidToken(audience string) (string, error) {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"typ":"JWT","alg":"ES256"}`))
+	claims, _ := json.Marshal(map[string]interface{}{
+		"aud": audience,
+		"exp": time.Now().Add(12 * time.Hour).Unix(),
+		"sub": n.subject,
+	})
+	signingInput := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(signingInput))
+	r, s, err := ecdsa.Sign(rand.Reader, n.privateKey, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("sign VAPID token: %w", err)
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// encryptPushPayload implements the aes128gcm content coding of RFC 8291.
+func encryptPushPayload(sub PushSubscription, plaintext []byte) ([]byte, error) {
+	uaPublicRaw, err := decodeBase64URL(sub.Keys.P256dh)
+	if err != nil {
+		return nil, fmt.Errorf("decode p256dh: %w", err)
+	}
+	authSecret, err := decodeBase64URL(sub.Keys.Auth)
+	if err != nil {
+		return nil, fmt.Errorf("decode auth: %w", err)
+	}
+	asPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return encryptPushRecord(uaPublicRaw, authSecret, asPrivate, salt, plaintext)
+}
+
+// encryptPushRecord encrypts a single aes128gcm record with the given
+// ephemeral key and salt.
+func encryptPushRecord(uaPublicRaw, authSecret []byte, asPrivate *ecdh.PrivateKey, salt, plaintext []byte) ([]byte, error) {
+	uaPublic, err := ecdh.P256().NewPublicKey(uaPublicRaw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh: %w", err)
+	}
+	asPublic := asPrivate.PublicKey().Bytes()
+	ecdhSecret, err := asPrivate.ECDH(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	// IKM = HKDF(auth_secret, ecdh_secret, "WebPush: info" || 0x00 || ua_public || as_public, 32)
+	keyInfo := append([]byte("WebPush: info\x00"), uaPublicRaw...)
+	keyInfo = append(keyInfo, asPublic...)
+	ikm := hkdf(authSecret, ecdhSecret, keyInfo, 32)
+
+	cek := hkdf(salt, ikm, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	nonce := hkdf(salt, ikm, []byte("Content-Encoding: nonce\x00"), 12)
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	// Single record: payload followed by the 0x02 last-record delimiter
+	ciphertext := gcm.Seal(nil, nonce, append(append([]byte{}, plaintext...), 0x02), nil)
+
+	// Header: salt(16) || record size(4) || key id length(1) || key id (as_public)
+	header := make([]byte, 0, 21+len(asPublic))
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, pushRecordSize)
+	header = append(header, byte(len(asPublic)))
+	header = append(header, asPublic...)
+	return append(header, ciphertext...), nil
+}
+
+// hkdf is HKDF-SHA-256 (RFC 5869) for outputs of at most one hash block.
+func hkdf(salt, ikm, info []byte, length int) []byte {
+	extract := hmac.New(sha256.New, salt)
+	extract.Write(ikm)
+	prk := extract.Sum(nil)
+
+	expand := hmac.New(sha256.New, prk)
+	expand.Write(info)
+	expand.Write([]byte{0x01})
+	return expand.Sum(nil)[:length]
+}
+
+// decodeBase64URL accepts base64url with or without padding.
+func decodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// Subscribe adds or replaces a subscription (keyed by endpoint).
+func (n *WebPushNotifier) Subscribe(sub PushSubscription) (PushSubscription, error) {
+	if !n.allowsEndpoint(sub.Endpoint) {
+		return sub, fmt.Errorf("endpoint must be an https URL on a known push service (see PUSH_SERVICE_HOSTS)")
+	}
+	if _, err := encryptPushPayload(sub, nil); err != nil {
+		return sub, err
+	}
+	sub.MinSeverity = strings.ToUpper(sub.MinSeverity)
+	if _, ok := threatRank[sub.MinSeverity]; !ok {
+		sub.MinSeverity = "HIGH"
+	}
+	sub.ID = newAlertID()
+	sub.CreatedAt = time.Now().UTC()
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for i, existing := range n.subscriptions {
+		if existing.Endpoint == sub.Endpoint {
+			n.subscriptions = append(n.subscriptions[:i], n.subscriptions[i+1:]...)
+			break
+		}
+	}
+	n.subscriptions = append(n.subscriptions, sub)
+	return sub, n.saveLocked()
+}
+
+// Unsubscribe removes a subscription by endpoint.
+func (n *WebPushNotifier) Unsubscribe(endpoint string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for i, sub := range n.subscriptions {
+		if sub.Endpoint == endpoint {
+			n.subscriptions = append(n.subscriptions[:i], n.subscriptions[i+1:]...)
+			if err := n.saveLocked(); err != nil {
+				alertLog.Error("Save push subscriptions failed", "err", err)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+func (n *WebPushNotifier) saveLocked() error {
+	data, err := json.MarshalIndent(n.subscriptions, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(n.path, data, 0o600)
+}
+
+// handlePushPublicKey returns the VAPID public key for PushManager.subscribe.
+func handlePushPublicKey(w http.ResponseWriter, r *http.Request) {
+	if webPush == nil {
+		http.Error(w, "Web Push not configured", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"publicKey": webPush.PublicKey()})
+}
+
+// handlePushSubscribe registers a browser subscription.
+// POST /api/push/subscribe {"endpoint", "keys": {"p256dh", "auth"}, "minSeverity", "regions"}
+func handlePushSubscribe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if webPush == nil {
+		http.Error(w, "Web Push not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	var sub PushSubscription
+	if err := json.NewDecoder(r.Body).Decode(&sub); err != nil {
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	saved, err := webPush.Subscribe(sub)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(saved)
+}
+
+// handlePushUnsubscribe removes a browser subscription.
+// POST /api/push/unsubscribe {"endpoint"}
+func handlePushUnsubscribe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if webPush == nil {
+		http.Error(w, "Web Push not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	var body struct {
+		Endpoint string `json:"endpoint"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !webPush.Unsubscribe(body.Endpoint) {
+		http.Error(w, "Subscription not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// TestEncryptPushRecordRFC8291 checks the example in RFC 8291 Appendix A.
+func TestEncryptPushRecordRFC8291(t *testing.T) {
+	b64 := func(s string) []byte {
+		b, err := decodeBase64URL(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	asPrivate, err := ecdh.P256().NewPrivateKey(b64("yfWPiYE-n46HLnH0KqZOF1fJJU3MYrct3AELtAQ-oRw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := asPrivate.PublicKey().Bytes(), b64("BP4z9KsN6nGRTbVYI_c7VJSPQTBtkgcy27mlmlMoZIIgDll6e3vCYLocInmYWAmS6TlzAC8wEqKK6PBru3jl7A8"); !bytes.Equal(got, want) {
+		t.Fatalf("as_public = %x, want %x", got, want)
+	}
+	uaPublic := b64("BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4")
+	authSecret := b64("BTBZMqHH6r4Tts7J_aSIgg")
+	salt := b64("DGv6ra1nlYgDCS1FRnbzlw")
+
+	got, err := encryptPushRecord(uaPublic, authSecret, asPrivate, salt, []byte("When I grow up, I want to be a watermelon"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "DGv6ra1nlYgDCS1FRnbzlwAAEABBBP4z9KsN6nGRTbVYI_c7VJSPQTBtkgcy27mlmlMoZIIgDll6e3vCYLocInmYWAmS6TlzAC8wEqKK6PBru3jl7A_yl95bQpu6cVPTpK4Mqgkf1CXztLVBSt2Ks3oZwbuwXPXLWyouBWLVWGNWQexSgSxsj_Qulcy4a-fN"
+	if s := base64.RawURLEncoding.EncodeToString(got); s != want {
+		t.Errorf("body =\n%s\nwant\n%s", s, want)
+	}
+}
+
+func TestPushPayload(t *testing.T) {
+	alert := &Alert{
+		ID:       "a1",
+		Key:      "squawk:socal:a1b2c3",
+		Severity: "CRITICAL",
+		Title:    "Emergency squawk 7700",
+		Message:  strings.Repeat("é<", 3000), // escaping and multi-byte runes
+		Details:  map[string]interface{}{"history": strings.Repeat("x", 10000)},
+	}
+	payload, err := pushPayload(AlertOpened, alert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payload) > maxPushPlaintext {
+		t.Errorf("payload is %d bytes, limit %d", len(payload), maxPushPlaintext)
+	}
+	var msg map[string]string
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		t.Fatalf("payload isn't a JSON object of strings: %v", err)
+	}
+	if len(msg) != 5 || msg["title"] != "CRITICAL Emergency squawk 7700" || msg["alertId"] != "a1" || msg["tag"] != alert.Key || msg["event"] != AlertOpened {
+		t.Errorf("payload = %s", payload)
+	}
+	if !strings.HasPrefix(alert.Message, msg["body"]) || msg["body"] == "" {
+		t.Errorf("body isn't a prefix of the message: %q", msg["body"])
+	}
+
+	// Encrypted, it still fits the 4096 bytes push services accept.
+	ua, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sub PushSubscription
+	sub.Keys.P256dh = base64.RawURLEncoding.EncodeToString(ua.PublicKey().Bytes())
+	sub.Keys.Auth = "BTBZMqHH6r4Tts7J_aSIgg"
+	body, err := encryptPushPayload(sub, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(body) > pushRecordSize {
+		t.Errorf("encrypted body is %d bytes", len(body))
+	}
+}
+
+func TestAllowsEndpoint(t *testing.T) {
+	n := &WebPushNotifier{hosts: splitList(defaultPushServiceHosts)}
+	tests := []struct {
+		endpoint string
+		want     bool
+	}{
+		{"https://fcm.googleapis.com/fcm/send/abc", true},
+		{"https://updates.push.services.mozilla.com/wpush/v2/abc", true},
+		{"https://web.push.apple.com/abc", true},
+		{"https://wns2-by3p.notify.windows.com/w/?token=abc", true},
+		{"http://fcm.googleapis.com/fcm/send/abc", false},
+		{"https://fcm.googleapis.com.evil.example/abc", false},
+		{"https://notify.windows.com.evil.example/abc", false},
+		{"https://evilnotify.windows.com/abc", false},
+		{"https://user@fcm.googleapis.com/abc", false},
+		{"https://169.254.169.254/latest/meta-data", false},
+		{"https://localhost:8080/api/admin", false},
+	}
+	for _, tt := range tests {
+		if got := n.allowsEndpoint(tt.endpoint); got != tt.want {
+			t.Errorf("allowsEndpoint(%q) = %v, want %v", tt.endpoint, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,499 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Workspace is one tenant of a shared server: an analyst team that sees the
+// common track picture, but has its own regions, watchlist, alert routing,
+// credentials, and analysis budget. Its members are the principals its API
+// keys, user names, and certificate names identify.
+type Workspace struct {
+	ID             string       `json:"id"`
+	Name           string       `json:"name,omitempty"`
+	Regions        []string     `json:"regions,omitempty"`        // regions the team may watch; empty for all
+	APIKeys        []APIKey     `json:"apiKeys,omitempty"`        // keys that sign in to the workspace
+	Users          []string     `json:"users,omitempty"`          // user accounts that belong to it
+	Certs          []string     `json:"certs,omitempty"`          // mTLS client names (roles still come from MTLS_CLIENTS)
+	AlertRoutes    []AlertRoute `json:"alertRoutes,omitempty"`    // where the workspace's own alerts go
+	AnalysesPerDay int          `json:"analysesPerDay,omitempty"` // on-demand analyses per UTC day; 0 for no limit
+}
+
+type workspaceState struct {
+	Workspace
+	watchlist *Watchlist
+	usagePath string
+	day       string // UTC date analyses counts for
+	analyses  int
+	latest    map[string]workspaceAnalysis // by region
+}
+
+// workspaceAnalysis is a workspace's latest on-demand analysis of a region,
+// and the shared analysis it was run over.
+type workspaceAnalysis struct {
+	analysis *TacticalAnalysis
+	over     *TacticalAnalysis
+}
+
+// analysisUsage is a workspace's usage.json: how much of the day's analysis
+// budget it has spent, so a restart doesn't hand out a fresh one.
+type analysisUsage struct {
+	Day      string `json:"day"`
+	Analyses int    `json:"analyses"`
+}
+
+// Workspaces holds the configured tenants. With none configured the server
+// is single-tenant and every principal sees everything.
+type Workspaces struct {
+	mu    sync.Mutex // guards analysis counts and latest analyses
+	byID  map[string]*workspaceState
+	users map[string]string // username -> workspace
+	certs map[string]string // certificate name -> workspace
+}
+
+var workspaces = &Workspaces{}
+
+var errNotInWorkspace = errors.New("not in your workspace")
+
+var workspaceIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// loadWorkspacesFromEnv reads workspaces from WORKSPACES (inline JSON) or
+// WORKSPACES_FILE, e.g.
+//
+//	[{"id": "red", "name": "Red Team", "regions": ["socal"],
+//	  "apiKeys": [{"label": "red-console", "key": "...", "role": "analyst"}],
+//	  "users": ["alice"], "analysesPerDay": 50,
+//	  "alertRoutes": [{"severities": ["HIGH", "CRITICAL"], "channels": ["slack"]}]}]
+//
+// Each workspace keeps its watchlist and analysis usage in
+// DATA_DIR/workspaces/<id>/. Call it
+// after loadAPIKeysFromEnv, as workspace keys join the same key set.
+func loadWorkspacesFromEnv(dataDir string) error {
+	data := []byte(os.Getenv("WORKSPACES"))
+	if path := os.Getenv("WORKSPACES_FILE"); len(data) == 0 && path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return fmt.Errorf("read workspaces: %w", err)
+		}
+	}
+	if len(data) == 0 {
+		return nil
+	}
+
+	var list []Workspace
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("parse workspaces: %w", err)
+	}
+	loaded := &Workspaces{
+		byID:  make(map[string]*workspaceState, len(list)),
+		users: make(map[string]string),
+		certs: make(map[string]string),
+	}
+	for _, ws := range list {
+		if !workspaceIDPattern.MatchString(ws.ID) {
+			return fmt.Errorf("workspace id %q must be lower-case letters, digits, '-' or '_'", ws.ID)
+		}
+		if loaded.byID[ws.ID] != nil {
+			return fmt.Errorf("workspace %q is defined more than once", ws.ID)
+		}
+		for _, region := range ws.Regions {
+			if _, ok := regions[region]; !ok {
+				return fmt.Errorf("workspace %q has unknown region %q", ws.ID, region)
+			}
+		}
+		for _, name := range ws.Users {
+			if other, dup := loaded.users[name]; dup {
+				return fmt.Errorf("user %q is in workspaces %q and %q", name, other, ws.ID)
+			}
+			loaded.users[name] = ws.ID
+		}
+		for _, name := range ws.Certs {
+			if other, dup := loaded.certs[name]; dup {
+				return fmt.Errorf("certificate %q is in workspaces %q and %q", name, other, ws.ID)
+			}
+			loaded.certs[name] = ws.ID
+		}
+		for i, route := range ws.AlertRoutes {
+			for j, sev := range route.Severities {
+				ws.AlertRoutes[i].Severities[j] = strings.ToUpper(sev)
+			}
+		}
+		if err := registerAPIKeys(ws.APIKeys, ws.ID); err != nil {
+			return fmt.Errorf("workspace %q: %w", ws.ID, err)
+		}
+
+		dir := filepath.Join(dataDir, "workspaces", ws.ID)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("workspace %q: %w", ws.ID, err)
+		}
+		wl, err := OpenWatchlist(dir)
+		if err != nil {
+			return fmt.Errorf("workspace %q: %w", ws.ID, err)
+		}
+		state := &workspaceState{Workspace: ws, watchlist: wl, usagePath: filepath.Join(dir, "usage.json")}
+		if data, err := os.ReadFile(state.usagePath); err == nil {
+			var usage analysisUsage
+			if err := json.Unmarshal(data, &usage); err != nil {
+				return fmt.Errorf("workspace %q: parse usage: %w", ws.ID, err)
+			}
+			state.day, state.analyses = usage.Day, usage.Analyses
+		} else if !os.IsNotExist(err) {
+			return fmt.Errorf("workspace %q: read usage: %w", ws.ID, err)
+		}
+		loaded.byID[ws.ID] = state
+	}
+
+	workspaces = loaded
+	authLog.Info("Workspaces enabled", "count", len(loaded.byID))
+	return nil
+}
+
+func (ws *Workspaces) get(id string) *workspaceState {
+	if ws == nil || id == "" {
+		return nil
+	}
+	return ws.byID[id]
+}
+
+// OfUser returns the workspace a user account belongs to, if any.
+func (ws *Workspaces) OfUser(username string) string {
+	if ws == nil {
+		return ""
+	}
+	return ws.users[username]
+}
+
+// OfCert returns the workspace a client certificate belongs to, if any.
+func (ws *Workspaces) OfCert(name string) string {
+	if ws == nil {
+		return ""
+	}
+	return ws.certs[name]
+}
+
+// AlertRoutes returns a workspace's alert routes.
+func (ws *Workspaces) AlertRoutes(id string) []AlertRoute {
+	if w := ws.get(id); w != nil {
+		return w.AlertRoutes
+	}
+	return nil
+}
+
+// allows reports whether the workspace may watch a region.
+func (w *workspaceState) allows(region string) bool {
+	return len(w.Regions) == 0 || matchesAny(w.Regions, region)
+}
+
+// workspaceAllows reports whether a principal may watch a region. Server
+// operators, outside any workspace, may watch every region.
+func workspaceAllows(p *Principal, region string) bool {
+	if p == nil {
+		return true
+	}
+	w := workspaces.get(p.Workspace)
+	return w == nil || w.allows(region)
+}
+
+// clientAllows reports whether a dashboard client's workspace may hear
+// about something in any of the given regions, where "" stands for no
+// region in particular. Call with clientsMutex held.
+func clientAllows(conn *wsClient, in ...string) bool {
+	w := workspaces.get(clientWorkspaces[conn])
+	if w == nil || len(w.Regions) == 0 {
+		return true
+	}
+	for _, region := range in {
+		if region == "" || w.allows(region) {
+			return true
+		}
+	}
+	return false
+}
+
+// alertVisible reports whether a principal may see an alert: the common
+// alerts in its regions, and its own workspace's.
+func alertVisible(p *Principal, a Alert) bool {
+	if p == nil || p.Workspace == "" {
+		return true
+	}
+	return (a.Workspace == "" || a.Workspace == p.Workspace) && workspaceAllows(p, a.Region)
+}
+
+// operatorPaths are, like adminPaths, kept from workspace members whatever
+// their role: the drone fleet is shared, and its commands can reach any
+// region.
+var operatorPaths = []string{
+	"/api/tasking",
+}
+
+// scopeToWorkspace confines a workspace member's request to the workspace,
+// returning why it is refused, or "" to let it through. Server
+// administration (see adminPaths) and operatorPaths stay with operators
+// outside any workspace. A request naming a region outside the workspace is refused,
+// and one naming none gets the workspace's first region rather than the
+// server default.
+func scopeToWorkspace(p *Principal, r *http.Request) string {
+	w := workspaces.get(p.Workspace)
+	if w == nil {
+		return ""
+	}
+	if requiredRole(r) == RoleAdmin {
+		return "server administration is not available to workspace " + w.ID
+	}
+	for _, prefix := range operatorPaths {
+		if r.URL.Path == prefix || strings.HasPrefix(r.URL.Path, prefix+"/") {
+			return prefix + " is not available to workspace " + w.ID
+		}
+	}
+	if len(w.Regions) == 0 {
+		return ""
+	}
+	q := r.URL.Query()
+	region := q.Get("region")
+	if region == "" {
+		q.Set("region", w.Regions[0])
+		r.URL.RawQuery = q.Encode()
+		return ""
+	}
+	if !w.allows(region) {
+		return fmt.Sprintf("region %q is not in workspace %s", region, w.ID)
+	}
+	return ""
+}
+
+// watchlistFor returns the watchlist a request works on: its workspace's,
+// or the server-wide list for operators.
+func watchlistFor(r *http.Request) *Watchlist {
+	if p := principalFrom(r); p != nil {
+		if w := workspaces.get(p.Workspace); w != nil {
+			return w.watchlist
+		}
+	}
+	return watchlist
+}
+
+// evaluateWorkspaceContact raises a new-contact alert for each workspace
+// watching the region whose watchlist matches a newly appeared aircraft.
+// The alert is the workspace's own: only its members see it and only its
+// routes deliver it.
+func evaluateWorkspaceContact(region string, ac Aircraft) {
+	if workspaces == nil {
+		return
+	}
+	for id, w := range workspaces.byID {
+		if !w.allows(region) {
+			continue
+		}
+		entry, ok := w.watchlist.Match(ac)
+		if !ok {
+			continue
+		}
+		details := aircraftDetails(ac)
+		details["watchlistId"] = entry.ID
+		details["watchlistNote"] = entry.Note
+		message := "Watchlisted aircraft appeared"
+		if entry.Note != "" {
+			message += ": " + entry.Note
+		}
+		alertMgr.Raise(Alert{
+			Key:       fmt.Sprintf("new_contact:%s:%s:%s", region, ac.ICAO24, id),
+			Kind:      "new_contact",
+			Region:    region,
+			Severity:  entry.Severity,
+			Title:     fmt.Sprintf("New contact %s in %s", displayCallsign(ac), region),
+			Message:   message,
+			ICAO24:    ac.ICAO24,
+			Callsign:  strings.TrimSpace(ac.Callsign),
+			Details:   details,
+			Workspace: id,
+		})
+	}
+}
+
+// SpendAnalysis counts an on-demand analysis against a workspace's daily
+// budget, reporting false once the budget is used up. Operators outside any
+// workspace, and workspaces without a budget, are not limited. The slot is
+// taken before the analysis runs, so concurrent requests can't overrun the
+// budget; give it back with RefundAnalysis if the analysis fails. Counts
+// are saved to usage.json and start again at midnight UTC.
+func (ws *Workspaces) SpendAnalysis(id string) bool {
+	w := ws.get(id)
+	if w == nil || w.AnalysesPerDay <= 0 {
+		return true
+	}
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if today := time.Now().UTC().Format(time.DateOnly); w.day != today {
+		w.day, w.analyses = today, 0
+	}
+	if w.analyses >= w.AnalysesPerDay {
+		return false
+	}
+	w.analyses++
+	w.saveUsageLocked()
+	return true
+}
+
+// RefundAnalysis returns a slot SpendAnalysis took for an analysis that
+// failed.
+func (ws *Workspaces) RefundAnalysis(id string) {
+	w := ws.get(id)
+	if w == nil || w.AnalysesPerDay <= 0 {
+		return
+	}
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if w.day != time.Now().UTC().Format(time.DateOnly) || w.analyses == 0 {
+		return
+	}
+	w.analyses--
+	w.saveUsageLocked()
+}
+
+// SetAnalysis keeps an analysis a workspace ran on demand, over the shared
+// analysis of the region at the time.
+func (ws *Workspaces) SetAnalysis(id, region string, analysis, over *TacticalAnalysis) {
+	w := ws.get(id)
+	if w == nil {
+		return
+	}
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if w.latest == nil {
+		w.latest = make(map[string]workspaceAnalysis)
+	}
+	w.latest[region] = workspaceAnalysis{analysis: analysis, over: over}
+}
+
+// Analysis returns the analysis a workspace should see for a region: its
+// own on-demand analysis until the next shared one replaces the analysis
+// it was run over, then the shared one.
+func (ws *Workspaces) Analysis(id, region string, shared *TacticalAnalysis) *TacticalAnalysis {
+	w := ws.get(id)
+	if w == nil {
+		return shared
+	}
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if own, ok := w.latest[region]; ok && own.over == shared {
+		return own.analysis
+	}
+	return shared
+}
+
+// saveUsageLocked writes usage.json. A failed write is logged rather than
+// refusing the analysis: the budget still holds until the next restart.
+func (w *workspaceState) saveUsageLocked() {
+	data, _ := json.Marshal(analysisUsage{Day: w.day, Analyses: w.analyses})
+	if err := os.WriteFile(w.usagePath, data, 0o644); err != nil {
+		authLog.Error("Failed to save analysis usage", "workspace", w.ID, "err", err)
+	}
+}
+
+// nextUTCDay is when daily analysis budgets reset.
+func nextUTCDay() time.Time {
+	return time.Now().UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+}
+
+// WorkspaceInfo describes a workspace without its secrets.
+type WorkspaceInfo struct {
+	ID             string       `json:"id"`
+	Name           string       `json:"name,omitempty"`
+	Regions        []string     `json:"regions"`
+	APIKeys        []APIKey     `json:"apiKeys"` // labels and roles only
+	Users          []string     `json:"users"`
+	Certs          []string     `json:"certs"`
+	AlertRoutes    []AlertRoute `json:"alertRoutes"`
+	Watchlist      int          `json:"watchlistEntries"`
+	AnalysesPerDay int          `json:"analysesPerDay"` // 0 for no limit
+	AnalysesToday  int          `json:"analysesToday"`
+}
+
+func (ws *Workspaces) info(w *workspaceState) WorkspaceInfo {
+	ws.mu.Lock()
+	used := 0
+	if w.day == time.Now().UTC().Format(time.DateOnly) {
+		used = w.analyses
+	}
+	ws.mu.Unlock()
+	out := WorkspaceInfo{
+		ID:             w.ID,
+		Name:           w.Name,
+		Regions:        w.Regions,
+		APIKeys:        w.APIKeys,
+		Users:          w.Users,
+		Certs:          w.Certs,
+		AlertRoutes:    w.AlertRoutes,
+		Watchlist:      len(w.watchlist.Entries()),
+		AnalysesPerDay: w.AnalysesPerDay,
+		AnalysesToday:  used,
+	}
+	if len(out.Regions) == 0 {
+		out.Regions = sortedRegionNames()
+	}
+	for _, list := range []*[]string{&out.Users, &out.Certs} {
+		if *list == nil {
+			*list = []string{}
+		}
+	}
+	if out.APIKeys == nil {
+		out.APIKeys = []APIKey{}
+	}
+	if out.AlertRoutes == nil {
+		out.AlertRoutes = []AlertRoute{}
+	}
+	return out
+}
+
+func sortedRegionNames() []string {
+	names := make([]string, 0, len(regions))
+	for name := range regions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// handleWorkspace describes the caller's own workspace.
+// GET /api/workspace
+func handleWorkspace(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	p := principalFrom(r)
+	if p == nil || workspaces.get(p.Workspace) == nil {
+		http.Error(w, "Not in a workspace", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(workspaces.info(workspaces.get(p.Workspace)))
+}
+
+// handleWorkspaces lists every workspace (admin only, see adminPaths).
+// GET /api/admin/workspaces
+func handleWorkspaces(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	out := make([]WorkspaceInfo, 0)
+	if workspaces != nil {
+		for _, ws := range workspaces.byID {
+			out = append(out, workspaces.info(ws))
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
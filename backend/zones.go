@@ -0,0 +1,374 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Zone is a named airspace polygon with per-zone alerting rules.
+// Polygon vertices are [lon, lat] pairs (GeoJSON order); the ring is closed
+// implicitly.
+type Zone struct {
+	ID                 string       `json:"id"`
+	Name               string       `json:"name"`
+	Region             string       `json:"region"`
+	Polygon            [][2]float64 `json:"polygon"`
+	Severity           string       `json:"severity"`           // alert severity for this zone
+	AlertOnEntry       bool         `json:"alertOnEntry"`       // alert while an aircraft is inside
+	AlertOnExit        bool         `json:"alertOnExit"`        // one-shot alert when it leaves
+	DwellMinutes       float64      `json:"dwellMinutes"`       // alert if inside longer than this (0 = off)
+	AlertOnLostContact bool         `json:"alertOnLostContact"` // alert if an airborne track vanishes inside
+}
+
+// Predefined zones. Boundaries are simplified approximations for display
+// and alerting, not authoritative airspace definitions.
+var defaultZones = []Zone{
+	{
+		ID: "pt-mugu", Name: "Point Mugu Sea Range (W-289)", Region: "socal",
+		Polygon:  [][2]float64{{-119.9, 33.6}, {-119.0, 33.6}, {-119.0, 34.05}, {-119.9, 34.05}},
+		Severity: "HIGH", AlertOnEntry: true, AlertOnExit: true, AlertOnLostContact: true,
+	},
+	{
+		ID: "san-clemente", Name: "San Clemente Island (R-2535)", Region: "socal",
+		Polygon:  [][2]float64{{-118.65, 32.75}, {-118.3, 32.75}, {-118.3, 33.05}, {-118.65, 33.05}},
+		Severity: "HIGH", AlertOnEntry: true, AlertOnExit: true, AlertOnLostContact: true,
+	},
+	{
+		ID: "pendleton", Name: "Camp Pendleton (R-2503)", Region: "socal",
+		Polygon:  [][2]float64{{-117.6, 33.2}, {-117.25, 33.2}, {-117.25, 33.5}, {-117.6, 33.5}},
+		Severity: "MEDIUM", AlertOnEntry: true, AlertOnLostContact: true,
+	},
+	{
+		ID: "lax-classb", Name: "LAX Class B Core", Region: "socal",
+		Polygon:  [][2]float64{{-118.55, 33.85}, {-118.25, 33.85}, {-118.25, 34.05}, {-118.55, 34.05}},
+		Severity: "LOW", DwellMinutes: 30,
+	},
+	{
+		ID: "salisbury", Name: "Salisbury Plain (D123)", Region: "europe",
+		Polygon:  [][2]float64{{-2.15, 51.15}, {-1.6, 51.15}, {-1.6, 51.35}, {-2.15, 51.35}},
+		Severity: "HIGH", AlertOnEntry: true, AlertOnExit: true, AlertOnLostContact: true,
+	},
+	{
+		ID: "lakenheath", Name: "RAF Lakenheath / Mildenhall MATZ", Region: "europe",
+		Polygon:  [][2]float64{{0.4, 52.3}, {0.7, 52.3}, {0.7, 52.5}, {0.4, 52.5}},
+		Severity: "MEDIUM", AlertOnEntry: true, AlertOnLostContact: true,
+	},
+	{
+		ID: "spadeadam", Name: "Spadeadam EW Range (D510)", Region: "europe",
+		Polygon:  [][2]float64{{-2.75, 54.95}, {-2.35, 54.95}, {-2.35, 55.15}, {-2.75, 55.15}},
+		Severity: "HIGH", AlertOnEntry: true, AlertOnExit: true, AlertOnLostContact: true,
+	},
+	{
+		ID: "london-ctr", Name: "London Control Zone", Region: "europe",
+		Polygon:  [][2]float64{{-0.8, 51.3}, {0.1, 51.3}, {0.1, 51.7}, {-0.8, 51.7}},
+		Severity: "LOW", DwellMinutes: 45,
+	},
+}
+
+// zoneOccupancy tracks one aircraft inside one zone.
+type zoneOccupancy struct {
+	enteredAt time.Time
+	dwelled   bool // overstayed the zone's dwell limit
+}
+
+var (
+	zones      = defaultZones
+	zonesMutex sync.RWMutex
+
+	// region -> "zoneID|icao24" -> occupancy
+	zoneOccupants      = make(map[string]map[string]*zoneOccupancy)
+	zoneOccupantsMutex sync.Mutex
+)
+
+// loadZonesFromEnv replaces the built-in zones with ZONES_FILE (a JSON array of Zone) if set.
+func loadZonesFromEnv() error {
+	path := os.Getenv("ZONES_FILE")
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read zones file: %w", err)
+	}
+	var loaded []Zone
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return fmt.Errorf("parse zones file: %w", err)
+	}
+	for i, z := range loaded {
+		if z.ID == "" || z.Region == "" || len(z.Polygon) < 3 {
+			return fmt.Errorf("zone %d: id, region, and a polygon of at least 3 points are required", i)
+		}
+		if _, ok := threatRank[strings.ToUpper(z.Severity)]; !ok {
+			loaded[i].Severity = "MEDIUM"
+		} else {
+			loaded[i].Severity = strings.ToUpper(z.Severity)
+		}
+	}
+
+	zonesMutex.Lock()
+	zones = loaded
+	zonesMutex.Unlock()
+	alertLog.Info("Loaded zones", "count", len(loaded), "file", path)
+	return nil
+}
+
+// zonesForRegion returns the zones defined for a region.
+func zonesForRegion(region string) []Zone {
+	zonesMutex.RLock()
+	defer zonesMutex.RUnlock()
+	var result []Zone
+	for _, z := range zones {
+		if z.Region == region {
+			result = append(result, z)
+		}
+	}
+	return result
+}
+
+// Contains reports whether (lat, lon) lies inside the zone polygon (ray casting).
+func (z Zone) Contains(lat, lon float64) bool {
+	inside := false
+	n := len(z.Polygon)
+	for i, j := 0, n-1; i < n; j, i = i, i+1 {
+		xi, yi := z.Polygon[i][0], z.Polygon[i][1]
+		xj, yj := z.Polygon[j][0], z.Polygon[j][1]
+		if (yi > lat) != (yj > lat) && lon < (xj-xi)*(lat-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// PenetrationKm returns the distance in km from (lat, lon) to the nearest
+// zone boundary, using a local equirectangular projection.
+func (z Zone) PenetrationKm(lat, lon float64) float64 {
+	const kmPerDeg = 111.32
+	cosLat := math.Cos(lat * math.Pi / 180)
+	best := math.MaxFloat64
+	n := len(z.Polygon)
+	for i, j := 0, n-1; i < n; j, i = i, i+1 {
+		// Project edge endpoints into km relative to the aircraft
+		ax := (z.Polygon[j][0] - lon) * kmPerDeg * cosLat
+		ay := (z.Polygon[j][1] - lat) * kmPerDeg
+		bx := (z.Polygon[i][0] - lon) * kmPerDeg * cosLat
+		by := (z.Polygon[i][1] - lat) * kmPerDeg
+
+		dx, dy := bx-ax, by-ay
+		t := 0.0
+		if l2 := dx*dx + dy*dy; l2 > 0 {
+			t = math.Max(0, math.Min(1, -(ax*dx+ay*dy)/l2))
+		}
+		px, py := ax+t*dx, ay+t*dy
+		if d := math.Hypot(px, py); d < best {
+			best = d
+		}
+	}
+	return best
+}
+
+// evaluateGeofences updates zone occupancy for a region's latest picture and
+// raises entry, exit, and dwell alerts according to each zone's rules.
+func evaluateGeofences(region string, aircraft []Aircraft) {
+	regionZones := zonesForRegion(region)
+	if len(regionZones) == 0 {
+		return
+	}
+	now := time.Now().UTC()
+
+	// Script hooks run after the lock is released.
+	var events []ZoneEvent
+	defer func() { scriptHost.ZoneEvents(events) }()
+
+	zoneOccupantsMutex.Lock()
+	defer zoneOccupantsMutex.Unlock()
+
+	prev := zoneOccupants[region]
+	current := make(map[string]*zoneOccupancy)
+	entrySeen := make(map[string]bool)
+	dwellSeen := make(map[string]bool)
+
+	for _, ac := range aircraft {
+		if ac.Latitude == nil || ac.Longitude == nil {
+			continue
+		}
+		lat, lon := *ac.Latitude, *ac.Longitude
+
+		for _, z := range regionZones {
+			if !z.Contains(lat, lon) {
+				continue
+			}
+			occKey := z.ID + "|" + ac.ICAO24
+			occ, ok := prev[occKey]
+			if !ok {
+				// Ground traffic doesn't enter zones, but an aircraft that
+				// lands inside one is still there: no exit, and its dwell
+				// time keeps counting.
+				if ac.OnGround {
+					continue
+				}
+				occ = &zoneOccupancy{enteredAt: now}
+				events = append(events, ZoneEvent{Type: "entry", Region: region, Zone: z, Aircraft: ac})
+			}
+			current[occKey] = occ
+
+			dwell := now.Sub(occ.enteredAt)
+			details := geofenceDetails(z, ac, lat, lon)
+			details["dwellMinutes"] = math.Round(dwell.Minutes()*10) / 10
+
+			if z.AlertOnEntry {
+				key := fmt.Sprintf("geofence_entry:%s:%s:%s", region, z.ID, ac.ICAO24)
+				entrySeen[key] = true
+				alertMgr.Raise(Alert{
+					Key:      key,
+					Kind:     "geofence_entry",
+					Region:   region,
+					Severity: z.Severity,
+					Title:    fmt.Sprintf("%s entered %s", displayCallsign(ac), z.Name),
+					Message:  fmt.Sprintf("%.1f km inside %s", details["penetrationKm"], z.Name),
+					ICAO24:   ac.ICAO24,
+					Callsign: strings.TrimSpace(ac.Callsign),
+					Details:  details,
+				})
+			}
+			if z.DwellMinutes > 0 && dwell.Minutes() > z.DwellMinutes {
+				if !occ.dwelled {
+					occ.dwelled = true
+					events = append(events, ZoneEvent{Type: "dwell", Region: region, Zone: z, Aircraft: ac, DwellMinutes: details["dwellMinutes"].(float64)})
+				}
+				key := fmt.Sprintf("geofence_dwell:%s:%s:%s", region, z.ID, ac.ICAO24)
+				dwellSeen[key] = true
+				alertMgr.Raise(Alert{
+					Key:      key,
+					Kind:     "geofence_dwell",
+					Region:   region,
+					Severity: z.Severity,
+					Title:    fmt.Sprintf("%s loitering in %s", displayCallsign(ac), z.Name),
+					Message:  fmt.Sprintf("Inside %s for %.0f min (limit %.0f)", z.Name, dwell.Minutes(), z.DwellMinutes),
+					ICAO24:   ac.ICAO24,
+					Callsign: strings.TrimSpace(ac.Callsign),
+					Details:  details,
+				})
+			}
+		}
+	}
+
+	// Exits: previously inside, now still tracked but outside the zone
+	tracked := make(map[string]Aircraft, len(aircraft))
+	for _, ac := range aircraft {
+		tracked[ac.ICAO24] = ac
+	}
+	for occKey, occ := range prev {
+		if _, still := current[occKey]; still {
+			continue
+		}
+		zoneID, icao24, _ := strings.Cut(occKey, "|")
+		ac, ok := tracked[icao24]
+		if !ok || ac.Latitude == nil || ac.Longitude == nil {
+			continue // lost contact, not an exit
+		}
+		for _, z := range regionZones {
+			if z.ID != zoneID {
+				continue
+			}
+			details := geofenceDetails(z, ac, *ac.Latitude, *ac.Longitude)
+			details["penetrationKm"] = 0.0
+			details["dwellMinutes"] = math.Round(now.Sub(occ.enteredAt).Minutes()*10) / 10
+			events = append(events, ZoneEvent{Type: "exit", Region: region, Zone: z, Aircraft: ac, DwellMinutes: details["dwellMinutes"].(float64)})
+			if !z.AlertOnExit {
+				continue
+			}
+			alertMgr.Raise(Alert{
+				Key:      fmt.Sprintf("geofence_exit:%s:%s:%s", region, z.ID, icao24),
+				Kind:     "geofence_exit",
+				Region:   region,
+				Severity: z.Severity,
+				Title:    fmt.Sprintf("%s exited %s", displayCallsign(ac), z.Name),
+				Message:  fmt.Sprintf("Left %s after %.0f min", z.Name, now.Sub(occ.enteredAt).Minutes()),
+				ICAO24:   icao24,
+				Callsign: strings.TrimSpace(ac.Callsign),
+				Details:  details,
+			})
+		}
+	}
+
+	zoneOccupants[region] = current
+	alertMgr.ResolveMissing("geofence_entry", region, entrySeen)
+	alertMgr.ResolveMissing("geofence_dwell", region, dwellSeen)
+}
+
+// geofenceDetails builds the alert payload describing the aircraft and zone.
+func geofenceDetails(z Zone, ac Aircraft, lat, lon float64) map[string]interface{} {
+	details := aircraftDetails(ac)
+	details["zoneId"] = z.ID
+	details["zoneName"] = z.Name
+	details["penetrationKm"] = math.Round(z.PenetrationKm(lat, lon)*100) / 100
+	return details
+}
+
+// aircraftDetails describes an aircraft's current state for alert payloads.
+func aircraftDetails(ac Aircraft) map[string]interface{} {
+	details := map[string]interface{}{
+		"originCountry": ac.OriginCountry,
+	}
+	if ac.Latitude != nil && ac.Longitude != nil {
+		details["latitude"] = *ac.Latitude
+		details["longitude"] = *ac.Longitude
+	}
+	if ac.BaroAltitude != nil {
+		details["altitude"] = *ac.BaroAltitude
+	}
+	if ac.Velocity != nil {
+		details["velocity"] = *ac.Velocity
+	}
+	if ac.TrueTrack != nil {
+		details["heading"] = *ac.TrueTrack
+	}
+	if ac.Squawk != nil {
+		details["squawk"] = *ac.Squawk
+	}
+	return details
+}
+
+// displayCallsign returns the callsign, falling back to the ICAO24 address.
+func displayCallsign(ac Aircraft) string {
+	if cs := strings.TrimSpace(ac.Callsign); cs != "" {
+		return cs
+	}
+	return ac.ICAO24
+}
+
+// Ring returns the zone boundary as a closed ring (first point repeated at
+// the end), as GeoJSON and KML require.
+func (z Zone) Ring() [][2]float64 {
+	ring := append([][2]float64{}, z.Polygon...)
+	if n := len(ring); n > 0 && ring[0] != ring[n-1] {
+		ring = append(ring, ring[0])
+	}
+	return ring
+}
+
+// zonesFiltered returns the zones for a region, or every zone if region is empty.
+func zonesFiltered(region string) []Zone {
+	if region != "" {
+		return zonesForRegion(region)
+	}
+	zonesMutex.RLock()
+	defer zonesMutex.RUnlock()
+	return append([]Zone{}, zones...)
+}
+
+func handleGetZones(w http.ResponseWriter, r *http.Request) {
+	result := zonesFiltered(r.URL.Query().Get("region"))
+	if result == nil {
+		result = []Zone{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,30 @@
+// Service worker for SWARM C2 alert push notifications
+
+self.addEventListener('push', (event) => {
+  if (!event.data) return;
+  const msg = event.data.json();
+  const resolved = msg.event === 'resolved';
+
+  // msg is {title, body, tag, event, alertId}; titles start with the severity
+  event.waitUntil(
+    self.registration.showNotification(msg.title, {
+      body: msg.body,
+      tag: msg.tag,               // one notification per alert, updated in place
+      renotify: !resolved,
+      requireInteraction: !resolved && msg.title.startsWith('CRITICAL '),
+      data: { id: msg.alertId },
+    })
+  );
+});
+
+self.addEventListener('notificationclick', (event) => {
+  event.notification.close();
+  event.waitUntil(
+    self.clients.matchAll({ type: 'window', includeUncontrolled: true }).then((windows) => {
+      for (const win of windows) {
+        if ('focus' in win) return win.focus();
+      }
+      return self.clients.openWindow('/');
+    })
+  );
+});
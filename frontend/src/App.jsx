@@ -6,12 +6,26 @@ import AircraftList from './components/AircraftList';
 import AIAnalysisPanel from './components/AIAnalysisPanel';
 import Clock from './components/Clock';
 import DronePanel from './components/DronePanel';
+import { pushSupported, currentPushSubscription, subscribeToPush, unsubscribeFromPush } from './push';
+import { apiFetch, withAuth, onAuthRequired, startSession, currentUser, canOperate, logout } from './auth';
+import LoginDialog from './components/LoginDialog';
 
 const REGIONS = {
   socal: { name: 'Southern California', center: [-118.5, 33.5], zoom: 7 },
   europe: { name: 'United Kingdom', center: [-2.5, 54.5], zoom: 5.5 },
 };
 
+// Plays a spoken alert pushed by the backend (TTS_STREAM, backend/tts.go).
+// Browsers refuse audio until the page has been interacted with; a refused
+// clip is simply skipped.
+const playAlertAudio = (msg) => {
+  new Audio(`data:${msg.contentType};base64,${msg.data}`).play().catch(() => {});
+};
+
+// WebSocket close codes sent by the backend (backend/sessions.go)
+const WS_CLOSE_IDLE = 4000;
+const WS_CLOSE_SESSION_ENDED = 4001;
+
 function App() {
   const [aircraft, setAircraft] = useState([]);
   const [selectedAircraft, setSelectedAircraft] = useState(null);
@@ -27,11 +41,16 @@ function App() {
   const [selectedDroneId, setSelectedDroneId] = useState(null);
   const [droneEvents, setDroneEvents] = useState([]);
   const [droneConnected, setDroneConnected] = useState(false);
+  const [pushEnabled, setPushEnabled] = useState(false);
+  const [authRequired, setAuthRequired] = useState(false);
+  const [solar, setSolar] = useState(null); // day/night terminator from the server
+  const [bullseyes, setBullseyes] = useState({}); // region -> bullseye
   const wsRef = useRef(null);
   const droneWsRef = useRef(null);
   const reconnectTimer = useRef(null);
   const droneReconnectTimer = useRef(null);
   const intentionalClose = useRef(false);
+  const resumeOnActivity = useRef([]);  // reconnects waiting for the operator after an idle close
   const droneIntentionalClose = useRef(false);
   const regionRef = useRef(region);  // Always tracks current region for WS filtering
 
@@ -48,7 +67,7 @@ function App() {
 
   const fetchAnalysis = useCallback(async (rgn) => {
     try {
-      const response = await fetch(`${getApiBaseUrl()}/api/analysis?region=${rgn}`);
+      const response = await apiFetch(`${getApiBaseUrl()}/api/analysis?region=${rgn}`);
       if (response.ok) {
         const data = await response.json();
         setAiAnalysis(data);
@@ -61,7 +80,7 @@ function App() {
   const refreshAnalysis = useCallback(async () => {
     setAiLoading(true);
     try {
-      const response = await fetch(`${getApiBaseUrl()}/api/analyze?region=${region}`, {
+      const response = await apiFetch(`${getApiBaseUrl()}/api/analyze?region=${region}`, {
         method: 'POST',
       });
       if (response.ok) {
@@ -75,6 +94,21 @@ function App() {
     }
   }, [region, getApiBaseUrl]);
 
+  // Renew any stored session, then probe once so missing credentials surface
+  // up front — a WebSocket rejected with 401 just closes without saying why.
+  useEffect(() => {
+    const unsubscribe = onAuthRequired(() => setAuthRequired(true));
+    startSession(getApiBaseUrl())
+      .then(() => apiFetch(`${getApiBaseUrl()}/api/regions`))
+      .catch(() => {});
+    return unsubscribe;
+  }, [getApiBaseUrl]);
+
+  const handleLogout = useCallback(async () => {
+    await logout(getApiBaseUrl());
+    window.location.reload();
+  }, [getApiBaseUrl]);
+
   // Single WebSocket connection — survives region changes
   useEffect(() => {
     const connect = () => {
@@ -85,7 +119,7 @@ function App() {
       }
 
       intentionalClose.current = false;
-      const ws = new WebSocket(`${getWsUrl()}?region=socal`);
+      const ws = new WebSocket(withAuth(`${getWsUrl()}?region=socal&coords=mgrs`));
       wsRef.current = ws;
 
       ws.onopen = () => {
@@ -103,6 +137,18 @@ function App() {
             if (!data.region || data.region === regionRef.current) {
               setAiAnalysis(data.analysis);
             }
+          } else if (data.type === 'alert_audio') {
+            if (data.region === regionRef.current) playAlertAudio(data);
+          } else if (data.type === 'solar') {
+            setSolar(data.solar);
+          } else if (data.type === 'bullseyes') {
+            setBullseyes(Object.fromEntries((data.bullseyes || []).map(b => [b.region, b])));
+          } else if (data.type === 'bullseye') {
+            setBullseyes(prev => {
+              const next = { ...prev };
+              if (data.bullseye) next[data.region] = data.bullseye; else delete next[data.region];
+              return next;
+            });
           } else if (data.aircraft) {
             // Only accept aircraft data for current region
             if (!data.region || data.region === regionRef.current) {
@@ -116,12 +162,17 @@ function App() {
         }
       };
 
-      ws.onclose = () => {
+      ws.onclose = (event) => {
         console.log('WebSocket disconnected');
         setConnected(false);
         wsRef.current = null;
         // Only auto-reconnect if this wasn't an intentional close
-        if (!intentionalClose.current) {
+        if (intentionalClose.current) return;
+        if (event.code === WS_CLOSE_IDLE) {
+          resumeOnActivity.current.push(connect);
+        } else if (event.code === WS_CLOSE_SESSION_ENDED) {
+          apiFetch(`${getApiBaseUrl()}/api/me`).catch(() => {});
+        } else {
           reconnectTimer.current = setTimeout(connect, 3000);
         }
       };
@@ -144,7 +195,7 @@ function App() {
         wsRef.current = null;
       }
     };
-  }, [getWsUrl, fetchAnalysis]);
+  }, [getWsUrl, getApiBaseUrl, fetchAnalysis]);
 
   // Drone WebSocket connection
   useEffect(() => {
@@ -156,7 +207,7 @@ function App() {
       droneIntentionalClose.current = false;
       const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
       const host = import.meta.env.DEV ? 'localhost:8080' : window.location.host;
-      const ws = new WebSocket(`${protocol}//${host}/ws/drones`);
+      const ws = new WebSocket(withAuth(`${protocol}//${host}/ws/drones`));
       droneWsRef.current = ws;
 
       ws.onopen = () => {
@@ -177,10 +228,13 @@ function App() {
           console.error('Drone WS parse error:', err);
         }
       };
-      ws.onclose = () => {
+      ws.onclose = (event) => {
         setDroneConnected(false);
         droneWsRef.current = null;
-        if (!droneIntentionalClose.current) {
+        if (droneIntentionalClose.current) return;
+        if (event.code === WS_CLOSE_IDLE) {
+          resumeOnActivity.current.push(connectDrone);
+        } else if (event.code !== WS_CLOSE_SESSION_ENDED) {
           droneReconnectTimer.current = setTimeout(connectDrone, 3000);
         }
       };
@@ -200,6 +254,48 @@ function App() {
     };
   }, []);
 
+  // The backend closes WebSockets that stay silent for WS_IDLE_TIMEOUT. Report
+  // operator activity at most once a minute, and reconnect idle-closed
+  // sockets as soon as someone is back at the console.
+  useEffect(() => {
+    let lastReport = 0;
+    const onActivity = () => {
+      const pending = resumeOnActivity.current;
+      resumeOnActivity.current = [];
+      pending.forEach((reconnect) => reconnect());
+
+      const now = Date.now();
+      if (now - lastReport < 60000) return;
+      lastReport = now;
+      [wsRef.current, droneWsRef.current].forEach((ws) => {
+        if (ws && ws.readyState === WebSocket.OPEN) {
+          ws.send(JSON.stringify({ action: 'activity' }));
+        }
+      });
+    };
+    const events = ['pointermove', 'pointerdown', 'keydown', 'wheel'];
+    events.forEach((e) => window.addEventListener(e, onActivity, { passive: true }));
+    return () => events.forEach((e) => window.removeEventListener(e, onActivity));
+  }, []);
+
+  useEffect(() => {
+    currentPushSubscription().then((sub) => setPushEnabled(!!sub)).catch(() => {});
+  }, []);
+
+  const togglePush = async () => {
+    try {
+      if (pushEnabled) {
+        await unsubscribeFromPush(getApiBaseUrl());
+        setPushEnabled(false);
+      } else {
+        await subscribeToPush(getApiBaseUrl(), { minSeverity: 'HIGH' });
+        setPushEnabled(true);
+      }
+    } catch (err) {
+      console.error('Push subscription failed:', err);
+    }
+  };
+
   // Handle region change — just send subscribe, don't recreate WS
   const handleRegionChange = (newRegion) => {
     if (newRegion === region) return;
@@ -270,6 +366,24 @@ function App() {
               3D GLOBE
             </button>
           </div>
+          {pushSupported() && (
+            <div className="c2-view-toggle">
+              <button
+                className={`c2-view-btn ${pushEnabled ? 'active' : ''}`}
+                onClick={togglePush}
+                title="Browser notifications for HIGH and CRITICAL alerts"
+              >
+                PUSH ALERTS
+              </button>
+            </div>
+          )}
+          {currentUser() && (
+            <div className="c2-view-toggle">
+              <button className="c2-view-btn" onClick={handleLogout} title="Sign out">
+                {currentUser().username.toUpperCase()} · LOG OUT
+              </button>
+            </div>
+          )}
           <div className="c2-ops-toggle">
             <button
               className={`c2-ops-btn ${opsMode === 'aircraft' ? 'active' : ''}`}
@@ -305,6 +419,8 @@ function App() {
               region={REGIONS[region]}
               selectedAircraft={selectedAircraft}
               onSelectAircraft={handleSelectAircraft}
+              night={solar?.night}
+              bullseye={bullseyes[region]}
             />
           ) : (
             <Globe3D
@@ -361,7 +477,7 @@ function App() {
             <>
               <AIAnalysisPanel
                 analysis={aiAnalysis}
-                onRefresh={refreshAnalysis}
+                onRefresh={canOperate() ? refreshAnalysis : null}
                 isLoading={aiLoading}
                 onSelectAircraft={handleSelectAircraft}
                 aircraft={aircraft}
@@ -383,6 +499,8 @@ function App() {
           )}
         </aside>
       </main>
+
+      {authRequired && <LoginDialog apiBase={getApiBaseUrl()} />}
     </div>
   );
 }
@@ -0,0 +1,159 @@
+// Authentication helpers — see backend/auth.go and backend/users.go.
+//
+// Operators log in with a username and password (short-lived JWT access token
+// plus a rotating refresh token); service-style setups can use an API key
+// instead. Credentials live in localStorage and are sent as a Bearer token on
+// fetches and as a query parameter on WebSockets, which can't carry headers.
+
+const KEYS = {
+  apiKey: 'swarmc2.apiKey',
+  access: 'swarmc2.accessToken',
+  refresh: 'swarmc2.refreshToken',
+  user: 'swarmc2.user',
+};
+
+const store = (key, value) => {
+  if (value) localStorage.setItem(key, value);
+  else localStorage.removeItem(key);
+};
+
+export const getApiKey = () => localStorage.getItem(KEYS.apiKey) || '';
+export const setApiKey = (key) => store(KEYS.apiKey, key);
+
+export const currentUser = () => {
+  try {
+    return JSON.parse(localStorage.getItem(KEYS.user));
+  } catch {
+    return null;
+  }
+};
+
+// Viewers can't trigger analyses or change anything; the server enforces this
+// (backend/rbac.go), the UI just hides controls that would be refused. API key
+// sessions don't know their role, so they keep the controls.
+export const canOperate = () => {
+  const user = currentUser();
+  return !user || user.role !== 'viewer';
+};
+
+const credential = () => localStorage.getItem(KEYS.access) || getApiKey();
+
+export const authHeaders = (headers = {}) => {
+  const cred = credential();
+  return cred ? { ...headers, Authorization: `Bearer ${cred}` } : headers;
+};
+
+// Listeners are told when the server rejects us and there is nothing left to
+// try, so the app can show the login dialog.
+const listeners = new Set();
+export const onAuthRequired = (fn) => {
+  listeners.add(fn);
+  return () => listeners.delete(fn);
+};
+const authRequired = () => listeners.forEach((fn) => fn());
+
+let refreshTimer = null;
+let refreshing = null;
+
+function saveSession(session) {
+  store(KEYS.access, session.accessToken);
+  store(KEYS.refresh, session.refreshToken);
+  store(KEYS.user, JSON.stringify(session.user));
+  clearTimeout(refreshTimer);
+  refreshTimer = setTimeout(() => refreshSession(), session.expiresIn * 800);
+}
+
+function clearSession() {
+  clearTimeout(refreshTimer);
+  [KEYS.access, KEYS.refresh, KEYS.user].forEach((k) => localStorage.removeItem(k));
+}
+
+let apiBaseUrl = '';
+
+// Trades the refresh token for a new pair. Concurrent callers share one request.
+export function refreshSession() {
+  const refreshToken = localStorage.getItem(KEYS.refresh);
+  if (!refreshToken) return Promise.resolve(false);
+  if (!refreshing) {
+    refreshing = fetch(`${apiBaseUrl}/api/token/refresh`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ refreshToken }),
+    })
+      .then(async (resp) => {
+        if (!resp.ok) {
+          clearSession();
+          return false;
+        }
+        saveSession(await resp.json());
+        return true;
+      })
+      .catch(() => false)
+      .finally(() => { refreshing = null; });
+  }
+  return refreshing;
+}
+
+// Call once at startup: renews the stored session if its access token has
+// expired (or is about to) and schedules renewal otherwise.
+export async function startSession(apiBase) {
+  apiBaseUrl = apiBase;
+  const access = localStorage.getItem(KEYS.access);
+  if (!access) return;
+  let exp = 0;
+  try {
+    exp = JSON.parse(atob(access.split('.')[1].replace(/-/g, '+').replace(/_/g, '/'))).exp;
+  } catch {
+    // unreadable token — refresh below
+  }
+  const remaining = exp * 1000 - Date.now();
+  if (remaining < 60000) {
+    await refreshSession();
+  } else {
+    clearTimeout(refreshTimer);
+    refreshTimer = setTimeout(() => refreshSession(), remaining - 60000);
+  }
+}
+
+export async function login(apiBase, username, password) {
+  const resp = await fetch(`${apiBase}/api/login`, {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ username, password }),
+  });
+  if (!resp.ok) throw new Error(resp.status === 401 ? 'Invalid username or password' : `Login failed: ${resp.status}`);
+  saveSession(await resp.json());
+}
+
+export async function logout(apiBase) {
+  const refreshToken = localStorage.getItem(KEYS.refresh);
+  clearSession();
+  setApiKey('');
+  if (refreshToken) {
+    await fetch(`${apiBase}/api/logout`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ refreshToken }),
+    }).catch(() => {});
+  }
+}
+
+export async function apiFetch(url, options = {}) {
+  let resp = await fetch(url, { ...options, headers: authHeaders(options.headers) });
+  if (resp.status === 401) {
+    if (await refreshSession()) {
+      resp = await fetch(url, { ...options, headers: authHeaders(options.headers) });
+    }
+    if (resp.status === 401) authRequired();
+  }
+  return resp;
+}
+
+export const withAuth = (url) => {
+  const access = localStorage.getItem(KEYS.access);
+  const key = getApiKey();
+  const sep = url.includes('?') ? '&' : '?';
+  if (access) return `${url}${sep}access_token=${encodeURIComponent(access)}`;
+  if (key) return `${url}${sep}api_key=${encodeURIComponent(key)}`;
+  return url;
+};
@@ -60,13 +60,15 @@ function AIAnalysisPanel({ analysis, onRefresh, isLoading, onSelectAircraft, air
           <span className="c2-ai-status">ACTIVE</span>
         </div>
         <div className="c2-ai-controls">
-          <button 
-            className="c2-ai-refresh" 
-            onClick={onRefresh}
-            disabled={isLoading}
-          >
-            {isLoading ? '◌' : '↻'}
-          </button>
+          {onRefresh && (
+            <button 
+              className="c2-ai-refresh" 
+              onClick={onRefresh}
+              disabled={isLoading}
+            >
+              {isLoading ? '◌' : '↻'}
+            </button>
+          )}
           <button 
             className="c2-ai-toggle"
             onClick={() => setExpanded(!expanded)}
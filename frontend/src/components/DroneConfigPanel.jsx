@@ -1,4 +1,5 @@
 import React, { useState } from 'react';
+import { apiFetch } from '../auth';
 
 const API_BASE = import.meta.env.DEV ? 'http://localhost:8080' : '';
 
@@ -26,7 +27,7 @@ export default function DroneConfigPanel({ drone }) {
   const handleValidate = async () => {
     setSubmitting(true);
     try {
-      const res = await fetch(`${API_BASE}/api/drones/validate`, {
+      const res = await apiFetch(`${API_BASE}/api/drones/validate`, {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify({ ...config, droneId: drone.droneId }),
@@ -42,7 +43,7 @@ export default function DroneConfigPanel({ drone }) {
   const handleDeploy = async () => {
     setSubmitting(true);
     try {
-      const res = await fetch(`${API_BASE}/api/drones/config`, {
+      const res = await apiFetch(`${API_BASE}/api/drones/config`, {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify({ ...config, droneId: drone.droneId }),
@@ -2,8 +2,34 @@ import React, { useEffect, useRef, useState, useCallback } from 'react';
 import maplibregl from 'maplibre-gl';
 import 'maplibre-gl/dist/maplibre-gl.css';
 import AircraftPopup from './AircraftPopup';
+import { authHeaders } from '../auth';
+
+// Bullseye range rings as GeoJSON: a circle per ring plus the centre point
+function bullseyeFeatures(b) {
+  const R = 6371000;
+  const lat1 = b.latitude * Math.PI / 180;
+  const lon1 = b.longitude * Math.PI / 180;
+  const rings = (b.rings || []).map((nm) => {
+    const d = nm * 1852 / R;
+    const coords = [];
+    for (let i = 0; i <= 72; i++) {
+      const brg = (i % 72) * 5 * Math.PI / 180;
+      const lat2 = Math.asin(Math.sin(lat1) * Math.cos(d) + Math.cos(lat1) * Math.sin(d) * Math.cos(brg));
+      const lon2 = lon1 + Math.atan2(Math.sin(brg) * Math.sin(d) * Math.cos(lat1), Math.cos(d) - Math.sin(lat1) * Math.sin(lat2));
+      coords.push([lon2 * 180 / Math.PI, lat2 * 180 / Math.PI]);
+    }
+    return { type: 'Feature', geometry: { type: 'LineString', coordinates: coords }, properties: { label: `${nm}` } };
+  });
+  return {
+    type: 'FeatureCollection',
+    features: [
+      ...rings,
+      { type: 'Feature', geometry: { type: 'Point', coordinates: [b.longitude, b.latitude] }, properties: { label: b.name } },
+    ],
+  };
+}
 
-function FlightMap({ aircraft, region, selectedAircraft, onSelectAircraft }) {
+function FlightMap({ aircraft, region, selectedAircraft, onSelectAircraft, night, bullseye }) {
   const mapContainer = useRef(null);
   const map = useRef(null);
   const markersRef = useRef({});
@@ -21,11 +47,27 @@ function FlightMap({ aircraft, region, selectedAircraft, onSelectAircraft }) {
 
   const MAPTILER_KEY = import.meta.env.VITE_MAPTILER_KEY;
   const hasMaptiler = MAPTILER_KEY && MAPTILER_KEY !== 'your_maptiler_key_here';
+  // Basemap through the backend's tile proxy (backend/tiles.go): no CDN access
+  // needed from the browser, and the provider key stays on the server.
+  const useTileProxy = import.meta.env.VITE_TILE_PROXY === 'true';
 
   useEffect(() => { regionRef.current = region; }, [region]);
   useEffect(() => { onSelectRef.current = onSelectAircraft; }, [onSelectAircraft]);
 
   const getMapStyle = () => {
+    if (useTileProxy) {
+      return {
+        version: 8,
+        sources: {
+          basemap: {
+            type: 'raster',
+            tiles: [`${window.location.origin}/tiles/{z}/{x}/{y}`],
+            tileSize: 256, maxzoom: 19,
+          },
+        },
+        layers: [{ id: 'basemap', type: 'raster', source: 'basemap' }],
+      };
+    }
     if (hasMaptiler) {
       return `https://api.maptiler.com/maps/hybrid/style.json?key=${MAPTILER_KEY}`;
     }
@@ -244,6 +286,9 @@ function FlightMap({ aircraft, region, selectedAircraft, onSelectAircraft }) {
       center: regionRef.current.center,
       zoom: regionRef.current.zoom,
       antialias: true,
+      transformRequest: (url) => (
+        url.startsWith(`${window.location.origin}/tiles/`) ? { url, headers: authHeaders() } : undefined
+      ),
     });
     map.current = m;
     m.on('load', () => {
@@ -277,6 +322,56 @@ function FlightMap({ aircraft, region, selectedAircraft, onSelectAircraft }) {
     });
   }, [region.center[0], region.center[1], region.zoom, mapReady, clearAllMarkers, povMode]);
 
+  // Shade the night side of the day/night terminator
+  useEffect(() => {
+    if (!map.current || !mapReady || !night) return;
+    const m = map.current;
+    const data = { type: 'Feature', geometry: night, properties: {} };
+    try {
+      const source = m.getSource('night');
+      if (source) {
+        source.setData(data);
+      } else {
+        m.addSource('night', { type: 'geojson', data });
+        m.addLayer({
+          id: 'night-shade',
+          type: 'fill',
+          source: 'night',
+          paint: { 'fill-color': '#000814', 'fill-opacity': 0.35 },
+        });
+      }
+    } catch (e) { console.warn('Night shading failed:', e); }
+  }, [night, mapReady]);
+
+  // Draw the region's bullseye and its range rings
+  useEffect(() => {
+    if (!map.current || !mapReady) return;
+    const m = map.current;
+    const data = bullseye ? bullseyeFeatures(bullseye) : { type: 'FeatureCollection', features: [] };
+    try {
+      const source = m.getSource('bullseye');
+      if (source) {
+        source.setData(data);
+      } else {
+        m.addSource('bullseye', { type: 'geojson', data });
+        m.addLayer({
+          id: 'bullseye-rings',
+          type: 'line',
+          source: 'bullseye',
+          filter: ['==', '$type', 'LineString'],
+          paint: { 'line-color': '#00d4ff', 'line-opacity': 0.5, 'line-width': 1, 'line-dasharray': [4, 4] },
+        });
+        m.addLayer({
+          id: 'bullseye-centre',
+          type: 'circle',
+          source: 'bullseye',
+          filter: ['==', '$type', 'Point'],
+          paint: { 'circle-radius': 5, 'circle-color': 'rgba(0,0,0,0)', 'circle-stroke-color': '#00d4ff', 'circle-stroke-width': 2 },
+        });
+      }
+    } catch (e) { console.warn('Bullseye layer failed:', e); }
+  }, [bullseye, mapReady]);
+
   // Update markers (skip in POV mode)
   useEffect(() => {
     if (!map.current || !mapReady || !aircraft) return;
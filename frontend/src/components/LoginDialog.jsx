@@ -0,0 +1,83 @@
+import React, { useState } from 'react';
+import { login, setApiKey } from '../auth';
+
+// Shown when the backend answers 401. Operators sign in with their account;
+// the API key form is for deployments that only configure API_KEYS.
+export default function LoginDialog({ apiBase }) {
+  const [useKey, setUseKey] = useState(false);
+  const [username, setUsername] = useState('');
+  const [password, setPassword] = useState('');
+  const [key, setKey] = useState('');
+  const [error, setError] = useState(null);
+  const [submitting, setSubmitting] = useState(false);
+
+  const handleSubmit = async (e) => {
+    e.preventDefault();
+    setError(null);
+    if (useKey) {
+      setApiKey(key.trim());
+      window.location.reload();
+      return;
+    }
+    setSubmitting(true);
+    try {
+      await login(apiBase, username.trim(), password);
+      window.location.reload();
+    } catch (err) {
+      setError(err.message);
+      setSubmitting(false);
+    }
+  };
+
+  return (
+    <div className="modal-overlay">
+      <form className="modal-content c2-login" onSubmit={handleSubmit}>
+        <div className="modal-header">
+          <div className="modal-title-section">
+            <span className="modal-callsign">SWARM C2</span>
+            <span className="modal-icao">{useKey ? 'API KEY ACCESS' : 'OPERATOR SIGN-IN'}</span>
+          </div>
+        </div>
+
+        {useKey ? (
+          <input
+            className="c2-login-input"
+            type="password"
+            placeholder="API key"
+            value={key}
+            onChange={(e) => setKey(e.target.value)}
+            autoFocus
+          />
+        ) : (
+          <>
+            <input
+              className="c2-login-input"
+              placeholder="Username"
+              autoComplete="username"
+              value={username}
+              onChange={(e) => setUsername(e.target.value)}
+              autoFocus
+            />
+            <input
+              className="c2-login-input"
+              type="password"
+              placeholder="Password"
+              autoComplete="current-password"
+              value={password}
+              onChange={(e) => setPassword(e.target.value)}
+            />
+          </>
+        )}
+
+        {error && <div className="c2-login-error">{error}</div>}
+
+        <button className="c2-login-submit" type="submit" disabled={submitting}>
+          {submitting ? 'SIGNING IN…' : 'SIGN IN'}
+        </button>
+        <button className="c2-login-switch" type="button" onClick={() => { setUseKey(!useKey); setError(null); }}>
+          {useKey ? 'Sign in with an account' : 'Use an API key instead'}
+        </button>
+      </form>
+    </div>
+  );
+}
@@ -95,6 +95,15 @@ function TelemetryPanel({ aircraft, onClose }) {
           </div>
         </div>
 
+        {aircraft.coords?.mgrs && (
+          <div className="c2-telemetry-item" style={{ gridColumn: 'span 2' }}>
+            <div className="c2-telemetry-label">MGRS</div>
+            <div className="c2-telemetry-value" style={{ fontSize: '13px' }}>
+              {aircraft.coords.mgrs}
+            </div>
+          </div>
+        )}
+
         <div className="c2-telemetry-item" style={{ gridColumn: 'span 2' }}>
           <div className="c2-telemetry-label">ORIGIN</div>
           <div className="c2-telemetry-value" style={{ fontSize: '14px' }}>
@@ -102,6 +111,28 @@ function TelemetryPanel({ aircraft, onClose }) {
           </div>
         </div>
 
+        {aircraft.bullseye && (
+          <div className="c2-telemetry-item" style={{ gridColumn: 'span 2' }}>
+            <div className="c2-telemetry-label">BULLSEYE</div>
+            <div className="c2-telemetry-value">
+              {aircraft.bullseye.call}
+            </div>
+          </div>
+        )}
+
+        {aircraft.confidence && (
+          <div className="c2-telemetry-item" style={{ gridColumn: 'span 2' }}>
+            <div className="c2-telemetry-label">CONFIDENCE</div>
+            <div className="c2-telemetry-value" style={{
+              fontSize: '14px',
+              color: { high: '#00ff88', medium: '#ffcc00', low: '#ff3b30' }[aircraft.confidence.level],
+            }}>
+              {aircraft.confidence.level.toUpperCase()} {Math.round(aircraft.confidence.score * 100)}%
+              {aircraft.confidence.extrapolated ? ' · DEAD-RECKONED' : ''}
+            </div>
+          </div>
+        )}
+
         <div className="c2-telemetry-item">
           <div className="c2-telemetry-label">SQUAWK</div>
           <div className="c2-telemetry-value">
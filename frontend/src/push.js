@@ -0,0 +1,59 @@
+// Web Push subscription helpers — see backend/webpush.go
+
+import { apiFetch } from './auth';
+
+const urlBase64ToUint8Array = (base64) => {
+  const padded = (base64 + '='.repeat((4 - (base64.length % 4)) % 4))
+    .replace(/-/g, '+')
+    .replace(/_/g, '/');
+  return Uint8Array.from(atob(padded), (c) => c.charCodeAt(0));
+};
+
+export const pushSupported = () =>
+  'serviceWorker' in navigator && 'PushManager' in window && 'Notification' in window;
+
+export async function currentPushSubscription() {
+  if (!pushSupported()) return null;
+  const reg = await navigator.serviceWorker.getRegistration('/sw.js');
+  return reg ? reg.pushManager.getSubscription() : null;
+}
+
+// Registers the service worker, asks for notification permission, and
+// registers the browser with the backend for alerts at or above minSeverity.
+export async function subscribeToPush(apiBase, { minSeverity = 'HIGH', regions = [] } = {}) {
+  if (!pushSupported()) throw new Error('Push notifications are not supported in this browser');
+  if ((await Notification.requestPermission()) !== 'granted') {
+    throw new Error('Notification permission denied');
+  }
+
+  const reg = await navigator.serviceWorker.register('/sw.js');
+  await navigator.serviceWorker.ready;
+
+  const keyResp = await apiFetch(`${apiBase}/api/push/vapid-public-key`);
+  if (!keyResp.ok) throw new Error('Push notifications are not enabled on the server');
+  const { publicKey } = await keyResp.json();
+
+  const sub = await reg.pushManager.subscribe({
+    userVisibleOnly: true,
+    applicationServerKey: urlBase64ToUint8Array(publicKey),
+  });
+
+  const resp = await apiFetch(`${apiBase}/api/push/subscribe`, {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ ...sub.toJSON(), minSeverity, regions }),
+  });
+  if (!resp.ok) throw new Error(`Subscribe failed: ${resp.status}`);
+  return sub;
+}
+
+export async function unsubscribeFromPush(apiBase) {
+  const sub = await currentPushSubscription();
+  if (!sub) return;
+  await apiFetch(`${apiBase}/api/push/unsubscribe`, {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ endpoint: sub.endpoint }),
+  });
+  await sub.unsubscribe();
+}